@@ -7,6 +7,27 @@ const (
 	// needs to be recreated.
 	PodHashLabel = "pod-hash"
 
+	// PodGroupLabel is set on the Pods of multi-node Models to the name of
+	// the leader Pod of their group.
+	PodGroupLabel = "group.kubeai.org/leader"
+	// PodRoleLabel is set on the Pods of multi-node Models to
+	// PodRoleLeader or PodRoleWorker.
+	PodRoleLabel  = "group.kubeai.org/role"
+	PodRoleLeader = "leader"
+	PodRoleWorker = "worker"
+
+	// PodWarmPoolLabel is a label key used to store the name of the
+	// resource profile that a warm pool Pod was created for.
+	PodWarmPoolLabel = "warm-pool.kubeai.org/resource-profile"
+
+	// PodOnDemandFloorLabel is set to "true" on the Pods that are placed on
+	// on-demand Nodes to keep the MinOnDemandReplicas of a Model's capacity.
+	PodOnDemandFloorLabel = "capacity.kubeai.org/on-demand-floor"
+
+	// PodWeightsRevisionLabel is set on the Pods of Models with weight
+	// updates to the revision of the weights that they were created for.
+	PodWeightsRevisionLabel = "weights.kubeai.org/revision"
+
 	ModelFeatureLabelDomain = "features.kubeai.org"
 
 	// ModelPodIPAnnotation is the annotation key used to specify an IP
@@ -16,6 +37,19 @@ const (
 	ModelPodPortAnnotation = "model-pod-port"
 
 	ModelCacheEvictionFinalizer = "kubeai.org/cache-eviction"
+
+	// PodResourceProfileAnnotation is set on the Pods of Models with
+	// vertical scaling to the resource profile that they were created for.
+	PodResourceProfileAnnotation = "vertical-scaling.kubeai.org/resource-profile"
+
+	// ModelAlertsAnnotation is set on Models by the autoscaler to the
+	// comma-separated names of the alerts that are firing for the Model.
+	ModelAlertsAnnotation = "kubeai.org/alerts"
+
+	// ModelOwnedByLabel sets the owned_by field of a Model (and its adapters
+	// and aliases) in the /v1/models endpoint. It takes precedence over the
+	// deprecated spec.owner.
+	ModelOwnedByLabel = "kubeai.org/owned-by"
 )
 
 func PVCModelAnnotation(modelName string) string {
@@ -29,3 +63,9 @@ const (
 func PodAdapterLabel(adapterID string) string {
 	return PodAdapterLabelPrefix + adapterID
 }
+
+const (
+	// ModelBundleLabel is set on the Models of a ModelBundle to the name of
+	// the bundle.
+	ModelBundleLabel = "bundle.kubeai.org/name"
+)
@@ -18,6 +18,8 @@ package v1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // ModelSpec defines the desired state of Model.
@@ -27,11 +29,18 @@ import (
 // +kubebuilder:validation:XValidation:rule="!self.url.startsWith(\"oss://\") || has(self.cacheProfile)", message="urls of format \"oss://...\" only supported when using a cacheProfile"
 // +kubebuilder:validation:XValidation:rule="!has(self.maxReplicas) || self.minReplicas <= self.maxReplicas", message="minReplicas should be less than or equal to maxReplicas."
 // +kubebuilder:validation:XValidation:rule="!has(self.adapters) || self.engine == \"VLLM\"", message="adapters only supported with VLLM engine."
+// +kubebuilder:validation:XValidation:rule="!has(self.verticalScaling) || has(self.maxReplicas)", message="verticalScaling requires maxReplicas."
+// +kubebuilder:validation:XValidation:rule="!has(self.verticalScaling) || (has(self.resourceProfile) && self.verticalScaling.steps.exists(s, s.resourceProfile == self.resourceProfile))", message="resourceProfile must be one of the verticalScaling steps."
+// +kubebuilder:validation:XValidation:rule="(!has(self.targetQueueDepth) && !has(self.targetKVCacheUsagePercent)) || self.engine == \"VLLM\"", message="targetQueueDepth and targetKVCacheUsagePercent only supported with VLLM engine."
+// +kubebuilder:validation:XValidation:rule="(self.engine == \"Echo\") == self.url.startsWith(\"echo://\")", message="urls of format \"echo://...\" are required for and only supported with the Echo engine."
+// +kubebuilder:validation:XValidation:rule="!has(self.multiNode) || self.engine == \"VLLM\"", message="multiNode only supported with VLLM engine."
+// +kubebuilder:validation:XValidation:rule="!has(self.specDecoding) || self.engine == \"VLLM\"", message="specDecoding only supported with VLLM engine."
+// +kubebuilder:validation:XValidation:rule="!has(self.activeWindows) || ((!has(self.autoscalingDisabled) || !self.autoscalingDisabled) && (!has(self.autoscalingDryRun) || !self.autoscalingDryRun))", message="activeWindows require autoscaling (autoscalingDisabled and autoscalingDryRun must be false)."
 type ModelSpec struct {
 	// URL of the model to be served.
 	// Currently the following formats are supported:
 	//
-	// For VLLM, FasterWhisper, Infinity engines:
+	// For VLLM, FasterWhisper, Infinity, JetStream engines:
 	//
 	// "hf://<repo>/<model>"
 	// "gs://<bucket>/<path>" (only with cacheProfile)
@@ -42,19 +51,40 @@ type ModelSpec struct {
 	//
 	// "ollama://<model>"
 	//
+	// For Echo engine:
+	//
+	// "echo://<name>"
+	//
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:XValidation:rule="self == oldSelf", message="url is immutable."
-	// +kubebuilder:validation:XValidation:rule="self.startsWith(\"hf://\") || self.startsWith(\"ollama://\") || self.startsWith(\"s3://\") || self.startsWith(\"gs://\") || self.startsWith(\"oss://\")", message="url must start with \"hf://\", \"ollama://\", \"s3://\", \"gs://\", or \"oss://\" and not be empty."
+	// +kubebuilder:validation:XValidation:rule="self.startsWith(\"hf://\") || self.startsWith(\"ollama://\") || self.startsWith(\"s3://\") || self.startsWith(\"gs://\") || self.startsWith(\"oss://\") || self.startsWith(\"echo://\")", message="url must start with \"hf://\", \"ollama://\", \"s3://\", \"gs://\", \"oss://\", or \"echo://\" and not be empty."
 	URL string `json:"url"`
 
 	Adapters []Adapter `json:"adapters,omitempty"`
 
+	// Aliases are other names that the Model can be requested by (i.e. the
+	// names of models of other providers that clients are configured with).
+	// Requests for an alias are sent to the model server as requests for
+	// the Model. A Model that is named like the requested model takes
+	// precedence over aliases and if multiple Models have the same alias,
+	// the oldest Model is used. Only the aliases of Models in KubeAI's
+	// namespace are used (not those of Models in team namespaces).
+	// Aliases must not contain "_" (which separates adapter names).
+	// +kubebuilder:validation:items:Pattern=`^[^_]+$`
+	// +kubebuilder:validation:Optional
+	Aliases []string `json:"aliases,omitempty"`
+
 	// Features that the model supports.
 	// Dictates the APIs that are available for the model.
 	Features []ModelFeature `json:"features"`
 
 	// Engine to be used for the server process.
-	// +kubebuilder:validation:Enum=OLlama;VLLM;FasterWhisper;Infinity
+	// The Echo engine runs no server process: KubeAI responds to requests by
+	// echoing their input (i.e. for testing clients). Args configure the
+	// responses: "--delay=<duration>", "--token-delay=<duration>" and
+	// "--dimensions=<embedding-size>".
+	// The JetStream engine serves completions on TPUs.
+	// +kubebuilder:validation:Enum=OLlama;VLLM;FasterWhisper;Infinity;JetStream;Echo
 	// +kubebuilder:validation:Required
 	Engine string `json:"engine"`
 
@@ -79,6 +109,48 @@ type ModelSpec struct {
 	// Env variables to be added to the server process.
 	Env map[string]string `json:"env,omitempty"`
 
+	// PodTemplate customizes the Model's Pods beyond the other fields (i.e.
+	// with tolerations, affinity, sidecar or init containers, volumes or a
+	// security context). It is a partial Pod ("metadata" and "spec") that is
+	// merged into the Pods like a strategic merge patch ("kubectl patch
+	// --type=strategic"): lists such as containers, volumes and env are
+	// merged by name. The model server container is named "server".
+	// Labels that KubeAI uses to select the Pods can not be changed.
+	// Changes to the spec roll out new Pods.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+
+	// ExternalEndpoints are static addresses of model servers that run outside
+	// of the cluster (e.g. a bare-metal vLLM server or a managed endpoint).
+	// Requests are load balanced across these endpoints alongside the Model's Pods.
+	// External endpoints are health checked but are not managed by the autoscaler.
+	ExternalEndpoints []ExternalEndpoint `json:"externalEndpoints,omitempty"`
+
+	// PassthroughPaths are additional paths of the model server (e.g. "/v1/search")
+	// that can be requested through KubeAI at
+	// "/openai/v1/models/<model>/passthrough/<path>".
+	// Paths may contain wildcards (see https://pkg.go.dev/path#Match) and
+	// are only served if they are also allowed by the system's
+	// modelProxy.passthroughPathAllowlist.
+	// +kubebuilder:validation:MaxItems=32
+	// +kubebuilder:validation:items:Pattern=`^/`
+	PassthroughPaths []string `json:"passthroughPaths,omitempty"`
+
+	// ChatMessages configures fixes that are applied to the messages of chat
+	// completion requests before they are sent to the model server, for chat
+	// templates that do not accept all sequences of messages.
+	// +kubebuilder:validation:Optional
+	ChatMessages *ChatMessageNormalization `json:"chatMessages,omitempty"`
+
+	// Dependencies are the names of other Models (in the same namespace) that
+	// this Model relies on to serve requests (e.g. a draft model or an embedding model).
+	// When this Model is scaled from zero, its dependencies are scaled from zero
+	// at the same time so that requests do not serially cold-start each Model.
+	Dependencies []string `json:"dependencies,omitempty"`
+
 	// Replicas is the number of Pod replicas that should be actively
 	// serving the model. KubeAI will manage this field unless AutoscalingDisabled
 	// is set to true.
@@ -99,17 +171,231 @@ type ModelSpec struct {
 	// for the Model. When disabled, metrics will not be collected on server Pods.
 	AutoscalingDisabled bool `json:"autoscalingDisabled,omitempty"`
 
+	// AutoscalingDryRun makes the autoscaler calculate the replicas for the Model
+	// and record them (as metrics and Events) without scaling the Model.
+	// Like with AutoscalingDisabled, the replicas of the Model are not managed
+	// by KubeAI (including scale from zero) while enabled.
+	AutoscalingDryRun bool `json:"autoscalingDryRun,omitempty"`
+
 	// TargetRequests is average number of active requests that the autoscaler
 	// will try to maintain on model server Pods.
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:default=100
 	TargetRequests *int32 `json:"targetRequests"`
 
+	// TargetQueueDepth is the average number of requests waiting in the
+	// model server's queue that the autoscaler will try to maintain on model
+	// server Pods. Only supported for the VLLM engine.
+	// Empty value means that queue depth is not considered when autoscaling.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	TargetQueueDepth *int32 `json:"targetQueueDepth,omitempty"`
+
+	// TargetKVCacheUsagePercent is the average GPU KV cache utilization (0-100)
+	// that the autoscaler will try to maintain on model server Pods.
+	// Only supported for the VLLM engine.
+	// Empty value means that KV cache utilization is not considered when autoscaling.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:validation:Optional
+	TargetKVCacheUsagePercent *int32 `json:"targetKVCacheUsagePercent,omitempty"`
+
+	// TargetGPUUtilizationPercent is the average GPU compute utilization
+	// (0-100) that the autoscaler will try to maintain on model server Pods.
+	// Utilization is read from the NVIDIA DCGM exporter metrics that are
+	// configured in the system config (modelAutoscaling.gpuUtilizationMetricsURL).
+	// Empty value means that GPU utilization is not considered when autoscaling.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:validation:Optional
+	TargetGPUUtilizationPercent *int32 `json:"targetGPUUtilizationPercent,omitempty"`
+
+	// TargetP95LatencyMilliseconds is the 95th percentile of request duration
+	// (as observed by the KubeAI proxy) that the autoscaler will try to stay under.
+	// Empty value means that request duration is not considered when autoscaling.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	TargetP95LatencyMilliseconds *int32 `json:"targetP95LatencyMilliseconds,omitempty"`
+
+	// TargetP95TimeToFirstTokenMilliseconds is the 95th percentile of the time to
+	// the first byte of the response body (as observed by the KubeAI proxy) that
+	// the autoscaler will try to stay under.
+	// Empty value means that time to first token is not considered when autoscaling.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	TargetP95TimeToFirstTokenMilliseconds *int32 `json:"targetP95TimeToFirstTokenMilliseconds,omitempty"`
+
+	// AutoscalingSignals configures how the replicas calculated from each of the
+	// targets above (the autoscaling signals) are combined into the desired
+	// number of replicas.
+	// Empty value means that the largest number of replicas is used.
+	// +kubebuilder:validation:Optional
+	AutoscalingSignals *AutoscalingSignals `json:"autoscalingSignals,omitempty"`
+
+	// MaxQueueWaitSeconds is the maximum amount of time that a request may wait
+	// for an available endpoint (i.e. while the Model is scaling up). Requests
+	// that wait longer are rejected with a 503 response and a Retry-After header.
+	// Empty value means that requests wait until the client times out.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	MaxQueueWaitSeconds *int64 `json:"maxQueueWaitSeconds,omitempty"`
+
+	// MaxScaleFromZeroWaitSeconds is the maximum amount of time that a request may
+	// wait for an available endpoint while the Model has no ready replicas (i.e.
+	// while scaling from zero, which includes loading the model). It applies
+	// instead of MaxQueueWaitSeconds, which then only applies while replicas are
+	// ready but busy.
+	// Empty value means that MaxQueueWaitSeconds applies in both cases.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	MaxScaleFromZeroWaitSeconds *int64 `json:"maxScaleFromZeroWaitSeconds,omitempty"`
+
+	// MaxEndpointsPerRequest is the maximum number of distinct endpoints (replicas)
+	// that a single request can be sent to, including retries. Once a request has
+	// been sent to this many endpoints, it is only retried on those endpoints.
+	// Empty value means that requests can be sent to any number of endpoints.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	MaxEndpointsPerRequest *int32 `json:"maxEndpointsPerRequest,omitempty"`
+
+	// ScaleUpDelaySeconds is the minimum time before a deployment is scaled up after
+	// the autoscaling algorithm determines that it should be scaled up.
+	// Scaling up from zero replicas when a request arrives is never delayed.
+	// Empty value means that the deployment is scaled up immediately.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	ScaleUpDelaySeconds *int64 `json:"scaleUpDelaySeconds,omitempty"`
+
 	// ScaleDownDelay is the minimum time before a deployment is scaled down after
 	// the autoscaling algorithm determines that it should be scaled down.
 	// +kubebuilder:default=30
 	ScaleDownDelaySeconds *int64 `json:"scaleDownDelaySeconds"`
 
+	// ScalingTolerancePercent is the tolerance band around TargetRequests within
+	// which the number of replicas calculated from active requests is not changed.
+	// For example, with a tolerance of 10 percent, 3 replicas are kept as long as
+	// the average active requests per replica are between 90% and 110% of
+	// TargetRequests, instead of flapping between 3 and 4 replicas around 100%.
+	// Empty value means that there is no tolerance band.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:validation:Optional
+	ScalingTolerancePercent *int32 `json:"scalingTolerancePercent,omitempty"`
+
+	// ScaleDownStabilizationSeconds is the time window over which the autoscaler
+	// considers previously calculated replica counts when scaling down. The Model
+	// is scaled to the highest replica count calculated within the window so that
+	// transient dips in traffic do not terminate warm replicas.
+	// Empty value means that only the latest calculation is considered.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	ScaleDownStabilizationSeconds *int64 `json:"scaleDownStabilizationSeconds,omitempty"`
+
+	// ScaleToZeroIdleSeconds is the amount of time without any requests after which
+	// the Model is scaled to zero replicas, bypassing the averaging time window
+	// and ScaleDownDelaySeconds. Only applies when MinReplicas is 0.
+	// Empty value means that the Model is only scaled down by the regular
+	// autoscaling algorithm.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	ScaleToZeroIdleSeconds *int64 `json:"scaleToZeroIdleSeconds,omitempty"`
+
+	// Schedules override the replica bounds of the Model during recurring
+	// time windows (e.g. a higher MinReplicas during business hours).
+	// If multiple schedules are active at the same time, the first one applies.
+	Schedules []ModelSchedule `json:"schedules,omitempty"`
+
+	// ActiveWindows restrict the Model to recurring time windows (e.g. only
+	// weeknights for a batch workload). Outside of all windows the Model is
+	// kept at zero replicas and requests are rejected instead of waiting for
+	// a replica. Models without active windows are always active.
+	// +kubebuilder:validation:Optional
+	ActiveWindows []ModelActiveWindow `json:"activeWindows,omitempty"`
+
+	// PriorityClassName is the name of a priority class defined in the system
+	// config (modelAutoscaling.priorityClasses). When the Pods of a Model are
+	// unable to be scheduled, Models with a lower priority that use the same
+	// resource profile are scaled down to make room.
+	// Models without a priority class have a priority of 0.
+	// +kubebuilder:validation:Optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// VerticalScaling allows the autoscaler to switch the Model between
+	// resource profiles (i.e. to larger GPUs) under sustained load instead of
+	// only adding replicas of the same size. Switching resource profiles
+	// rolls out new Pods in the same way as any other update to the Model.
+	// +kubebuilder:validation:Optional
+	VerticalScaling *VerticalScaling `json:"verticalScaling,omitempty"`
+
+	// MultiNode serves each replica of the Model with a group of Pods (i.e.
+	// on multiple Nodes) for models that are too large for a single Node.
+	// The leader Pod of each group runs the model server and receives all
+	// requests, the worker Pods join its Ray cluster. Use the
+	// "--tensor-parallel-size" and "--pipeline-parallel-size" args to split
+	// the model across the GPUs of all Pods of a group.
+	// Groups are created, scaled and replaced as a whole.
+	// +kubebuilder:validation:Optional
+	MultiNode *MultiNode `json:"multiNode,omitempty"`
+
+	// SpecDecoding enables speculative decoding: a smaller draft model
+	// proposes tokens that the model verifies in a single step, which
+	// reduces the latency of generating text. The draft model runs in the
+	// model server of each Pod of the Model.
+	// +kubebuilder:validation:Optional
+	SpecDecoding *SpecDecoding `json:"specDecoding,omitempty"`
+
+	// Rollout enables canary rollouts of updates to the Model's Pods (i.e. a
+	// new image, args or resource profile). Pods of the new revision are first
+	// created in addition to the Pods of the current revision and receive a
+	// share of the requests while their health is evaluated. If they are
+	// unhealthy, the update is rolled back.
+	// Empty value means that out-of-date Pods are recreated as soon as all
+	// Pods are ready (see modelRollouts.surge in the system config).
+	// +kubebuilder:validation:Optional
+	Rollout *ModelRollout `json:"rollout,omitempty"`
+
+	// WeightUpdates configures what happens to the Model's Pods when the
+	// weights that the URL references change (i.e. a new commit of a Hugging
+	// Face repo or new versions of S3 objects). The revision of the weights
+	// is tracked in the Model's status.
+	// Empty value means that changes of the weights are not tracked.
+	// +kubebuilder:validation:Optional
+	WeightUpdates *ModelWeightUpdates `json:"weightUpdates,omitempty"`
+
+	// DisruptionBudget limits the number of the Model's replicas that can be
+	// unavailable at the same time due to voluntary disruptions (i.e. Node
+	// drains during cluster upgrades). KubeAI manages a PodDisruptionBudget
+	// for the Pods of each Model.
+	// Empty value means that at most 1 replica is disrupted at a time.
+	// +kubebuilder:validation:Optional
+	DisruptionBudget *DisruptionBudget `json:"disruptionBudget,omitempty"`
+
+	// Capacity places the Pods of the Model on spot (preemptible) or
+	// on-demand Nodes (identified by the spot settings of the system config).
+	// Empty value means that the Pods run on any Nodes of the resource profile.
+	// +kubebuilder:validation:Optional
+	Capacity *ModelCapacity `json:"capacity,omitempty"`
+
+	// Placement spreads the Pods of the Model across zones or Nodes, or packs
+	// them onto the same Nodes.
+	// Empty value means that the Pods are placed by the scheduler's defaults.
+	// +kubebuilder:validation:Optional
+	Placement *ModelPlacement `json:"placement,omitempty"`
+
+	// Deprecation marks the Model as deprecated so that clients can be
+	// migrated before it is removed. Deprecated Models are still served, but
+	// they are flagged in the /v1/models endpoint and responses include
+	// Deprecation and Sunset headers.
+	// +kubebuilder:validation:Optional
+	Deprecation *ModelDeprecation `json:"deprecation,omitempty"`
+
+	// SafetyPolicy moderates the completion and chat completion requests of
+	// the Model with a Moderation Model before they are sent to the model
+	// server. Flagged requests are rejected. Applies to requests to the HTTP
+	// API and to messaging (and batch) requests.
+	// +kubebuilder:validation:Optional
+	SafetyPolicy *ModelSafetyPolicy `json:"safetyPolicy,omitempty"`
+
 	// Owner of the model. Used solely to populate the owner field in the
 	// OpenAI /v1/models endpoint.
 	// DEPRECATED.
@@ -117,7 +403,7 @@ type ModelSpec struct {
 	Owner string `json:"owner"`
 }
 
-// +kubebuilder:validation:Enum=TextGeneration;TextEmbedding;SpeechToText
+// +kubebuilder:validation:Enum=TextGeneration;TextEmbedding;SpeechToText;TextToSpeech;Moderation
 type ModelFeature string
 
 const (
@@ -125,6 +411,11 @@ const (
 	ModelFeatureTextEmbedding  = "TextEmbedding"
 	// TODO (samos123): Add validation that Speech to Text only supports Faster Whisper.
 	ModelFeatureSpeechToText = "SpeechToText"
+	ModelFeatureTextToSpeech = "TextToSpeech"
+	// Moderation models are safety classifiers that answer chat completions
+	// with "safe" or "unsafe" and the violated categories (i.e. Llama Guard).
+	// They serve /v1/moderations.
+	ModelFeatureModeration = "Moderation"
 )
 
 const (
@@ -132,6 +423,9 @@ const (
 	VLLMEngine          = "VLLM"
 	FasterWhisperEngine = "FasterWhisper"
 	InfinityEngine      = "Infinity"
+	JetStreamEngine     = "JetStream"
+	// EchoEngine Models are served by KubeAI itself, without Pods.
+	EchoEngine = "Echo"
 )
 
 type Adapter struct {
@@ -144,21 +438,552 @@ type Adapter struct {
 	URL string `json:"url"`
 }
 
+// ChatMessageNormalization configures fixes for the messages of chat
+// completion requests.
+type ChatMessageNormalization struct {
+	// SystemToUser converts system (and developer) messages to user messages,
+	// for chat templates without a system role.
+	// +kubebuilder:validation:Optional
+	SystemToUser bool `json:"systemToUser,omitempty"`
+	// MergeConsecutiveRoles merges consecutive messages with the same role
+	// into a single message, for chat templates that require alternating roles.
+	// Applied after SystemToUser, so that converted system messages are merged
+	// into the following user message. Messages with fields other than "role"
+	// and "content" (i.e. tool calls) are not merged.
+	// +kubebuilder:validation:Optional
+	MergeConsecutiveRoles bool `json:"mergeConsecutiveRoles,omitempty"`
+}
+
+type ExternalEndpoint struct {
+	// Address of the model server in the format "<host>:<port>".
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+	// HealthPath is the HTTP path that is periodically requested to determine
+	// if the endpoint should receive traffic. Any 2xx response is considered healthy.
+	// +kubebuilder:default="/health"
+	HealthPath string `json:"healthPath,omitempty"`
+}
+
+type ModelSchedule struct {
+	// Start is a cron expression that determines when the schedule becomes active.
+	// Example: "0 9 * * 1-5" - 9:00 on weekdays.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Start string `json:"start"`
+	// Duration is the amount of time that the schedule stays active after each start.
+	// +kubebuilder:validation:Required
+	Duration metav1.Duration `json:"duration"`
+	// TimeZone is the IANA time zone name (e.g. "America/New_York") that the
+	// Start expression is evaluated in. Defaults to UTC.
+	// +kubebuilder:validation:Optional
+	TimeZone string `json:"timeZone,omitempty"`
+	// MinReplicas overrides the Model's MinReplicas while the schedule is active.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas overrides the Model's MaxReplicas while the schedule is active.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+}
+
+type ModelActiveWindow struct {
+	// Start is a cron expression that determines when the window opens.
+	// Example: "0 20 * * 1-5" - 20:00 on weekdays.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Start string `json:"start"`
+	// Duration is the amount of time that the window stays open after each start.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:XValidation:rule="duration(self) > duration('0s')", message="duration must be positive."
+	Duration metav1.Duration `json:"duration"`
+	// TimeZone is the IANA time zone name (e.g. "America/New_York") that the
+	// Start expression is evaluated in. Defaults to UTC.
+	// +kubebuilder:validation:Optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Max;Average
+type AutoscalingPolicy string
+
+const (
+	// MaxAutoscalingPolicy uses the largest number of replicas that any
+	// signal asks for.
+	MaxAutoscalingPolicy AutoscalingPolicy = "Max"
+	// AverageAutoscalingPolicy uses the weighted average of the number of
+	// replicas that the signals ask for.
+	AverageAutoscalingPolicy AutoscalingPolicy = "Average"
+)
+
+type AutoscalingSignals struct {
+	// Policy is how the replicas calculated for each signal are combined.
+	// +kubebuilder:default=Max
+	Policy AutoscalingPolicy `json:"policy,omitempty"`
+	// Weights of the signals. A weight of 0 excludes a signal.
+	// +kubebuilder:validation:Optional
+	Weights AutoscalingSignalWeights `json:"weights,omitempty"`
+}
+
+// AutoscalingSignalWeights are the relative weights of the autoscaling signals.
+// Weights are only used by the Average policy, except that a weight of 0
+// excludes a signal with either policy. Empty values default to 1.
+type AutoscalingSignalWeights struct {
+	// Requests weights the signal calculated from TargetRequests.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	Requests *int32 `json:"requests,omitempty"`
+	// QueueDepth weights the signal calculated from TargetQueueDepth.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	QueueDepth *int32 `json:"queueDepth,omitempty"`
+	// KVCacheUsage weights the signal calculated from TargetKVCacheUsagePercent.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	KVCacheUsage *int32 `json:"kvCacheUsage,omitempty"`
+	// GPUUtilization weights the signal calculated from TargetGPUUtilizationPercent.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	GPUUtilization *int32 `json:"gpuUtilization,omitempty"`
+	// Latency weights the signal calculated from TargetP95LatencyMilliseconds
+	// and TargetP95TimeToFirstTokenMilliseconds.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	Latency *int32 `json:"latency,omitempty"`
+}
+
+type VerticalScaling struct {
+	// Steps are the resource profiles that the Model can be switched between,
+	// ordered from smallest to largest. The Model's ResourceProfile must be
+	// one of the steps.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=2
+	Steps []VerticalScalingStep `json:"steps"`
+	// SustainedSeconds is the amount of time that a Model must need more than
+	// MaxReplicas before it is switched to the next larger step, or that the
+	// next smaller step would be able to serve the load with at most half of
+	// MaxReplicas before it is switched to the next smaller step.
+	// +kubebuilder:default=300
+	// +kubebuilder:validation:Minimum=1
+	SustainedSeconds int64 `json:"sustainedSeconds,omitempty"`
+	// Surge is the number of Pods of the new step that are created at a
+	// time when the Model is switched to another step. Pods of the previous
+	// step are only deleted once the ready Pods of the new step can serve
+	// their share of the Model's TargetRequests, so that switching (i.e. from
+	// 4 replicas with 1 GPU to 2 replicas with 2 GPUs) does not cause an
+	// outage.
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	Surge int32 `json:"surge,omitempty"`
+}
+
+type VerticalScalingStep struct {
+	// ResourceProfile in the same format as the Model's ResourceProfile.
+	// Example: "nvidia-gpu-a100-80gb:1".
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	ResourceProfile string `json:"resourceProfile"`
+	// TargetRequests overrides the Model's TargetRequests while the Model
+	// uses this step (larger resource profiles usually serve more requests).
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	TargetRequests *int32 `json:"targetRequests,omitempty"`
+	// Args are appended to the Model's Args while the Model uses this step.
+	// Example: ["--tensor-parallel-size=2"].
+	// +kubebuilder:validation:Optional
+	Args []string `json:"args,omitempty"`
+}
+
+type MultiNode struct {
+	// Size is the number of Pods in each group, including the leader Pod.
+	// The resource profile applies to each Pod.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=2
+	Size int32 `json:"size"`
+}
+
+type SpecDecoding struct {
+	// DraftModel is the name of the Model (in the same namespace) that is
+	// used as the draft model. It must be a VLLM Model with the
+	// TextGeneration feature, use the same tokenizer as this Model and
+	// either have no cacheProfile or the same cacheProfile as this Model.
+	// The draft Model does not need replicas of its own.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	DraftModel string `json:"draftModel"`
+	// NumSpeculativeTokens is the number of tokens that the draft model
+	// proposes in each step.
+	// +kubebuilder:default=5
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	NumSpeculativeTokens int32 `json:"numSpeculativeTokens,omitempty"`
+}
+
+type DisruptionBudget struct {
+	// MaxUnavailable is the number (i.e. 1) or percentage (i.e. "25%") of
+	// the Model's replicas that can be unavailable due to voluntary
+	// disruptions. Percentages are rounded up. Use "100%" to not limit
+	// disruptions.
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:XIntOrString
+	// +kubebuilder:validation:Optional
+	MaxUnavailable intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+type ModelCapacity struct {
+	// Type of the Nodes that the Pods of the Model run on.
+	// Spot requires spot Nodes, SpotPreferred falls back to on-demand Nodes
+	// when no spot Nodes are available and OnDemand avoids spot Nodes.
+	// +kubebuilder:default=SpotPreferred
+	// +kubebuilder:validation:Optional
+	Type CapacityType `json:"type,omitempty"`
+	// MinOnDemandReplicas is the number of replicas that are kept on
+	// on-demand Nodes regardless of Type, so that the Model keeps serving
+	// requests when its spot Nodes are preempted.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MinOnDemandReplicas int32 `json:"minOnDemandReplicas,omitempty"`
+}
+
+type ModelDeprecation struct {
+	// Deprecated marks the Model as deprecated.
+	// +kubebuilder:validation:Optional
+	Deprecated bool `json:"deprecated,omitempty"`
+	// SunsetDate is the time after which the Model is expected to be removed.
+	// Example: "2025-06-30T00:00:00Z"
+	// +kubebuilder:validation:Optional
+	SunsetDate *metav1.Time `json:"sunsetDate,omitempty"`
+	// ReplacementModel is the name of the model that clients should migrate to.
+	// +kubebuilder:validation:Optional
+	ReplacementModel string `json:"replacementModel,omitempty"`
+}
+
+type ModelSafetyPolicy struct {
+	// Model is the name of the Moderation Model that classifies the requests.
+	// Defaults to the moderation model of the system config.
+	// +kubebuilder:validation:Optional
+	Model string `json:"model,omitempty"`
+	// FailOpen sends requests to the model server if they could not be
+	// moderated because the Moderation Model is unavailable (it does not
+	// exist or responded with a 5xx status). Requests are rejected by
+	// default and whenever the moderation request was rejected.
+	// +kubebuilder:validation:Optional
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Spot;SpotPreferred;OnDemand
+type CapacityType string
+
+type ModelPlacement struct {
+	// Policy for the placement of the Pods of the Model relative to each other.
+	// SpreadZones balances the Pods across zones (topology spread constraint),
+	// SpreadNodes places at most one Pod per Node (Pod anti-affinity) and Pack
+	// places the Pods onto the same Nodes (Pod affinity), i.e. for NVLink
+	// locality.
+	// +kubebuilder:validation:Required
+	Policy PlacementPolicy `json:"policy"`
+	// TopologyKey is the Node label that the Policy applies to.
+	// Defaults to "topology.kubernetes.io/zone" for SpreadZones and to
+	// "kubernetes.io/hostname" for SpreadNodes and Pack.
+	// Example: "nvidia.com/gpu.clique" (to pack Pods in an NVLink domain).
+	// +kubebuilder:validation:Optional
+	TopologyKey string `json:"topologyKey,omitempty"`
+	// MaxSkew is the maximum difference of the number of Pods between zones
+	// for SpreadZones.
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	MaxSkew int32 `json:"maxSkew,omitempty"`
+	// Required makes the Policy a scheduling requirement: Pods stay pending
+	// when it can not be satisfied. By default the Policy is a preference.
+	// +kubebuilder:validation:Optional
+	Required bool `json:"required,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=SpreadZones;SpreadNodes;Pack
+type PlacementPolicy string
+
+const (
+	SpreadZonesPlacementPolicy PlacementPolicy = "SpreadZones"
+	SpreadNodesPlacementPolicy PlacementPolicy = "SpreadNodes"
+	PackPlacementPolicy        PlacementPolicy = "Pack"
+)
+
+const (
+	SpotCapacityType          CapacityType = "Spot"
+	SpotPreferredCapacityType CapacityType = "SpotPreferred"
+	OnDemandCapacityType      CapacityType = "OnDemand"
+)
+
+type ModelRollout struct {
+	// Surge is the number of canary Pods of the new revision that are created
+	// in addition to the Model's replicas. Pods of the current revision are
+	// replaced once the canary Pods were healthy for AnalysisSeconds.
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	Surge int32 `json:"surge,omitempty"`
+	// CanaryPercent is the percentage of requests that are sent to the canary
+	// Pods while they are evaluated.
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	CanaryPercent int32 `json:"canaryPercent,omitempty"`
+	// AnalysisSeconds is the amount of time that all canary Pods must be
+	// ready (without exceeding MaxRestarts) before the rollout continues.
+	// +kubebuilder:default=300
+	// +kubebuilder:validation:Minimum=0
+	AnalysisSeconds int64 `json:"analysisSeconds,omitempty"`
+	// ProgressDeadlineSeconds is the amount of time that the canary Pods have
+	// to become ready (i.e. to load the model) before the rollout is rolled back.
+	// +kubebuilder:default=1800
+	// +kubebuilder:validation:Minimum=1
+	ProgressDeadlineSeconds int64 `json:"progressDeadlineSeconds,omitempty"`
+	// MaxRestarts is the number of container restarts of the canary Pods
+	// that are tolerated before the rollout is rolled back.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Optional
+	MaxRestarts int32 `json:"maxRestarts,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Ignore;RollingRestart;BlueGreen
+type WeightUpdatePolicy string
+
+const (
+	// IgnoreWeightUpdatePolicy only tracks the revision of the weights.
+	// Pods keep serving the weights that they loaded.
+	IgnoreWeightUpdatePolicy WeightUpdatePolicy = "Ignore"
+	// RollingRestartWeightUpdatePolicy replaces the Pods in the same way as
+	// other updates of the Model (see Rollout).
+	RollingRestartWeightUpdatePolicy WeightUpdatePolicy = "RollingRestart"
+	// BlueGreenWeightUpdatePolicy creates a full set of Pods with the new
+	// weights, which only receive requests once all of them are ready. The
+	// Pods with the previous weights are then deleted at once.
+	BlueGreenWeightUpdatePolicy WeightUpdatePolicy = "BlueGreen"
+)
+
+type ModelWeightUpdates struct {
+	// Policy for changes of the weights.
+	// +kubebuilder:default=Ignore
+	Policy WeightUpdatePolicy `json:"policy,omitempty"`
+	// CheckIntervalSeconds is how often the revision of the weights is
+	// resolved.
+	// +kubebuilder:default=600
+	// +kubebuilder:validation:Minimum=60
+	CheckIntervalSeconds int64 `json:"checkIntervalSeconds,omitempty"`
+}
+
+// ActiveVerticalScalingStep returns the vertical scaling step that matches the
+// Model's ResourceProfile, or nil if vertical scaling is not enabled.
+func (s ModelSpec) ActiveVerticalScalingStep() *VerticalScalingStep {
+	if s.VerticalScaling == nil {
+		return nil
+	}
+	for i := range s.VerticalScaling.Steps {
+		if s.VerticalScaling.Steps[i].ResourceProfile == s.ResourceProfile {
+			return &s.VerticalScaling.Steps[i]
+		}
+	}
+	return nil
+}
+
 // ModelStatus defines the observed state of Model.
 type ModelStatus struct {
 	Replicas ModelStatusReplicas `json:"replicas,omitempty"`
 	Cache    *ModelStatusCache   `json:"cache,omitempty"`
+	// Recommendation is a right-sizing recommendation based on the load
+	// that the autoscaler observed for the Model. It is not applied
+	// automatically.
+	Recommendation *ModelStatusRecommendation `json:"recommendation,omitempty"`
+	// Rollout is the progress of the latest canary rollout (see Spec.Rollout).
+	Rollout *ModelStatusRollout `json:"rollout,omitempty"`
+	// Capabilities of the model that were discovered from the model server
+	// of a ready replica. The gateway validates requests against them.
+	Capabilities *ModelStatusCapabilities `json:"capabilities,omitempty"`
+	// Weights is the revision of the weights that the URL references (see
+	// Spec.WeightUpdates).
+	Weights *ModelStatusWeights `json:"weights,omitempty"`
+	// Conditions of the Model (i.e. Ready, Degraded or WaitingForNodes).
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// ModelConditionWaitingForNodes is True while Pods of the Model are
+	// unschedulable, i.e. while a cluster autoscaler provisions GPU Nodes.
+	ModelConditionWaitingForNodes = "WaitingForNodes"
+
+	ModelReasonPodsUnschedulable = "PodsUnschedulable"
+	ModelReasonPodsScheduled     = "PodsScheduled"
+
+	// ModelConditionReady is True while at least one replica of the Model is
+	// ready to serve requests. Otherwise its reason tells why requests wait.
+	ModelConditionReady = "Ready"
+	// ModelConditionDownloading is True while the model is loaded into its
+	// cache (only set for Models with a CacheProfile).
+	ModelConditionDownloading = "Downloading"
+	// ModelConditionLoading is True while replicas are running but not ready,
+	// i.e. while the model server loads the model.
+	ModelConditionLoading = "Loading"
+	// ModelConditionScalingUp is True while the Model has fewer ready
+	// replicas than desired replicas.
+	ModelConditionScalingUp = "ScalingUp"
+	// ModelConditionDegraded is True while replicas of the Model are unable
+	// to start (see the Unschedulable, CrashLoop and ImagePullError reasons).
+	ModelConditionDegraded = "Degraded"
+	// ModelConditionSpecDecoding is True if the draft model of a Model with
+	// SpecDecoding was resolved. While it is False, the Model's Pods are not
+	// updated.
+	ModelConditionSpecDecoding = "SpecDecoding"
+	// ModelConditionActive is True while a Model with ActiveWindows is within
+	// one of its windows. While it is False, the Model is kept at zero
+	// replicas and requests are rejected.
+	ModelConditionActive = "Active"
+
+	ModelReasonReplicasReady     = "ReplicasReady"
+	ModelReasonScaledToZero      = "ScaledToZero"
+	ModelReasonEchoEngine        = "EchoEngine"
+	ModelReasonDownloading       = "Downloading"
+	ModelReasonCacheLoaded       = "CacheLoaded"
+	ModelReasonLoading           = "Loading"
+	ModelReasonNotLoading        = "NotLoading"
+	ModelReasonPending           = "Pending"
+	ModelReasonReplicasStarting  = "ReplicasStarting"
+	ModelReasonAtDesiredReplicas = "AtDesiredReplicas"
+	ModelReasonUnschedulable     = "Unschedulable"
+	ModelReasonCrashLoop         = "CrashLoop"
+	ModelReasonImagePullError    = "ImagePullError"
+	ModelReasonHealthy           = "Healthy"
+
+	ModelReasonDraftModelResolved     = "DraftModelResolved"
+	ModelReasonDraftModelNotFound     = "DraftModelNotFound"
+	ModelReasonDraftModelIncompatible = "DraftModelIncompatible"
+	ModelReasonDraftModelNotCached    = "DraftModelNotCached"
+
+	ModelReasonInActiveWindow       = "InActiveWindow"
+	ModelReasonOutsideActiveWindows = "OutsideActiveWindows"
+	ModelReasonInvalidActiveWindows = "InvalidActiveWindows"
+
+	// ModelReasonNameConflict is the reason of the Ready condition of a Model
+	// that is not served because another Model is served under its name
+	// (a Model in KubeAI's namespace or an older Model in a team namespace).
+	ModelReasonNameConflict = "NameConflict"
+)
+
+type ModelStatusWeights struct {
+	// Revision is a hash of the latest revision of the weights (i.e. the
+	// commit of a Hugging Face repo).
+	Revision string `json:"revision,omitempty"`
+	// LastCheckTime is when the revision was last resolved.
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+	// SwapRevision is the Pod hash of the Pods with the new weights during a
+	// blue/green swap. They do not receive requests until all of them are
+	// ready.
+	SwapRevision string `json:"swapRevision,omitempty"`
+	// Message describes why the revision could not be resolved.
+	Message string `json:"message,omitempty"`
+}
+
+// ModelStatusCapabilities are the capabilities of a model as reported by its
+// model server. Fields are only set if the engine reports them.
+type ModelStatusCapabilities struct {
+	// PodHash is the hash of the Pods (see the "pod-hash" label) that the
+	// capabilities were discovered from. They are discovered again when
+	// Pods with a new hash are ready (i.e. after the Args changed).
+	PodHash string `json:"podHash"`
+	// ServedModel is the model that the model server serves (i.e. the
+	// Huggingface repo).
+	ServedModel string `json:"servedModel,omitempty"`
+	// MaxContextLength is the maximum number of tokens of the prompt and
+	// the generated tokens of a request.
+	MaxContextLength *int64 `json:"maxContextLength,omitempty"`
+	// MaxLoRARank is the maximum rank of LoRA adapters that the model
+	// server can load.
+	MaxLoRARank *int32 `json:"maxLoRARank,omitempty"`
+	// Vision is true if the model accepts images in chat messages.
+	Vision *bool `json:"vision,omitempty"`
 }
 
 type ModelStatusReplicas struct {
 	All   int32 `json:"all"`
 	Ready int32 `json:"ready"`
+	// Pending replicas are not running yet (i.e. unschedulable or
+	// pulling the image).
+	Pending int32 `json:"pending,omitempty"`
+	// Loading replicas are running but not ready yet (i.e. loading the model).
+	Loading int32 `json:"loading,omitempty"`
+	// Unhealthy replicas have containers that are crash looping or
+	// unable to pull their image.
+	Unhealthy int32 `json:"unhealthy,omitempty"`
 }
 
 type ModelStatusCache struct {
 	Loaded bool `json:"loaded"`
 }
 
+type ModelStatusRecommendation struct {
+	// Replicas that would serve the 95th percentile of the observed
+	// active requests at TargetRequests (within MinReplicas and MaxReplicas).
+	Replicas int32 `json:"replicas"`
+	// ResourceProfile is the smallest vertical scaling step that would serve
+	// the observed load within MaxReplicas. Only set if VerticalScaling is
+	// configured.
+	ResourceProfile string `json:"resourceProfile,omitempty"`
+	// MaxNumSeqs is the recommended value of the vLLM --max-num-seqs argument,
+	// based on the observed active requests per ready replica. Only set for
+	// the VLLM engine.
+	MaxNumSeqs *int32 `json:"maxNumSeqs,omitempty"`
+	// Observations that the recommendation is based on (throughput,
+	// latency and KV cache utilization).
+	Observations string `json:"observations,omitempty"`
+	// ObservedSeconds is the amount of history that the recommendation
+	// is based on.
+	ObservedSeconds int64       `json:"observedSeconds"`
+	LastUpdateTime  metav1.Time `json:"lastUpdateTime"`
+}
+
+// +kubebuilder:validation:Enum=Canary;Progressing;Complete;RolledBack
+type ModelRolloutPhase string
+
+const (
+	// RolloutPhaseCanary means that canary Pods of the new revision are
+	// created and evaluated alongside the Pods of the stable revision.
+	RolloutPhaseCanary ModelRolloutPhase = "Canary"
+	// RolloutPhaseProgressing means that the canary Pods were healthy and
+	// the remaining Pods are being replaced.
+	RolloutPhaseProgressing ModelRolloutPhase = "Progressing"
+	// RolloutPhaseComplete means that all Pods are of the new revision.
+	RolloutPhaseComplete ModelRolloutPhase = "Complete"
+	// RolloutPhaseRolledBack means that the canary Pods were unhealthy and
+	// were removed. The Model is served by the Pods of the stable revision
+	// until the Model is updated again.
+	RolloutPhaseRolledBack ModelRolloutPhase = "RolledBack"
+)
+
+type ModelStatusRollout struct {
+	// Revision is the Pod hash of the revision that is rolled out.
+	Revision string `json:"revision"`
+	// StableRevision is the Pod hash of the revision that served the Model
+	// before the rollout.
+	StableRevision string            `json:"stableRevision,omitempty"`
+	Phase          ModelRolloutPhase `json:"phase"`
+	StartTime      metav1.Time       `json:"startTime"`
+	// CanaryReadyTime is when all canary Pods were ready, which starts
+	// the analysis.
+	CanaryReadyTime *metav1.Time `json:"canaryReadyTime,omitempty"`
+	// Message describes the phase (i.e. the reason of a rollback).
+	Message string `json:"message,omitempty"`
+	// StablePod is a Pod of the stable revision, recorded when the rollout
+	// is rolled back. It is used to recreate the Pods of the stable
+	// revision when there are none (i.e. after the Model was scaled to zero).
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	StablePod *runtime.RawExtension `json:"stablePod,omitempty"`
+}
+
 // NOTE: Model name length should be limited to allow for the model name to be used in
 // the names of the resources created by the controller.
 
@@ -166,6 +991,12 @@ type ModelStatusCache struct {
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas.all
+// +kubebuilder:printcolumn:name="Engine",type=string,JSONPath=`.spec.engine`
+// +kubebuilder:printcolumn:name="Replicas",type=integer,JSONPath=`.spec.replicas`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.replicas.ready`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].message`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 // +kubebuilder:validation:XValidation:rule="size(self.metadata.name) <= 40", message="name must not exceed 40 characters."
 type Model struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -0,0 +1,95 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ModelBundleSpec defines the Models of a bundle.
+type ModelBundleSpec struct {
+	// Models of the bundle. KubeAI creates a Model (in the namespace of the
+	// bundle) for each entry and deletes the Models that are removed from the
+	// list. Each Model depends on all other Models of the bundle, so that they
+	// are scaled from zero together.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=16
+	// +listType=map
+	// +listMapKey=name
+	Models []ModelBundleModel `json:"models"`
+
+	// Suspended scales all Models of the bundle to zero replicas and disables
+	// their autoscaling until it is unset.
+	// +kubebuilder:validation:Optional
+	Suspended bool `json:"suspended,omitempty"`
+}
+
+type ModelBundleModel struct {
+	// Name of the Model.
+	// +kubebuilder:validation:MaxLength=40
+	Name string `json:"name"`
+	// Spec of the Model. It is validated when the Model is created or
+	// updated. Replicas that are managed by the autoscaler are kept.
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Spec ModelSpec `json:"spec"`
+}
+
+// ModelBundleStatus defines the observed state of ModelBundle.
+type ModelBundleStatus struct {
+	// Models is the number of Models of the bundle.
+	Models int32 `json:"models"`
+	// ReadyModels is the number of Models of the bundle that are ready.
+	ReadyModels int32 `json:"readyModels"`
+	// Conditions of the ModelBundle (i.e. Ready).
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// ModelBundleConditionReady is True while all Models of the bundle are
+	// ready to serve requests.
+	ModelBundleConditionReady = "Ready"
+
+	ModelBundleReasonModelsReady    = "ModelsReady"
+	ModelBundleReasonModelsNotReady = "ModelsNotReady"
+	ModelBundleReasonSuspended      = "Suspended"
+	// ModelBundleReasonNameConflict means that a Model of the bundle can not
+	// be created because a Model with the same name that does not belong to
+	// the bundle exists.
+	ModelBundleReasonNameConflict = "NameConflict"
+	// ModelBundleReasonModelError means that a Model of the bundle could not
+	// be created or updated (i.e. because its spec is invalid).
+	ModelBundleReasonModelError = "ModelError"
+)
+
+// ModelBundle resources deploy a set of related Models (i.e. an LLM, an
+// embedding model and a reranker of a RAG stack) that are scaled together.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Models",type=integer,JSONPath=`.status.models`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyModels`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Message",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].message`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type ModelBundle struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ModelBundleSpec   `json:"spec,omitempty"`
+	Status ModelBundleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ModelBundleList contains a list of ModelBundles.
+type ModelBundleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ModelBundle `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ModelBundle{}, &ModelBundleList{})
+}
@@ -21,6 +21,7 @@ limitations under the License.
 package v1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -39,6 +40,108 @@ func (in *Adapter) DeepCopy() *Adapter {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalingSignalWeights) DeepCopyInto(out *AutoscalingSignalWeights) {
+	*out = *in
+	if in.Requests != nil {
+		in, out := &in.Requests, &out.Requests
+		*out = new(int32)
+		**out = **in
+	}
+	if in.QueueDepth != nil {
+		in, out := &in.QueueDepth, &out.QueueDepth
+		*out = new(int32)
+		**out = **in
+	}
+	if in.KVCacheUsage != nil {
+		in, out := &in.KVCacheUsage, &out.KVCacheUsage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.GPUUtilization != nil {
+		in, out := &in.GPUUtilization, &out.GPUUtilization
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Latency != nil {
+		in, out := &in.Latency, &out.Latency
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingSignalWeights.
+func (in *AutoscalingSignalWeights) DeepCopy() *AutoscalingSignalWeights {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingSignalWeights)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalingSignals) DeepCopyInto(out *AutoscalingSignals) {
+	*out = *in
+	in.Weights.DeepCopyInto(&out.Weights)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingSignals.
+func (in *AutoscalingSignals) DeepCopy() *AutoscalingSignals {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingSignals)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChatMessageNormalization) DeepCopyInto(out *ChatMessageNormalization) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChatMessageNormalization.
+func (in *ChatMessageNormalization) DeepCopy() *ChatMessageNormalization {
+	if in == nil {
+		return nil
+	}
+	out := new(ChatMessageNormalization)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DisruptionBudget) DeepCopyInto(out *DisruptionBudget) {
+	*out = *in
+	out.MaxUnavailable = in.MaxUnavailable
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DisruptionBudget.
+func (in *DisruptionBudget) DeepCopy() *DisruptionBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(DisruptionBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalEndpoint) DeepCopyInto(out *ExternalEndpoint) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalEndpoint.
+func (in *ExternalEndpoint) DeepCopy() *ExternalEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Model) DeepCopyInto(out *Model) {
 	*out = *in
@@ -66,6 +169,175 @@ func (in *Model) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelActiveWindow) DeepCopyInto(out *ModelActiveWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelActiveWindow.
+func (in *ModelActiveWindow) DeepCopy() *ModelActiveWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelActiveWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBundle) DeepCopyInto(out *ModelBundle) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBundle.
+func (in *ModelBundle) DeepCopy() *ModelBundle {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModelBundle) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBundleList) DeepCopyInto(out *ModelBundleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ModelBundle, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBundleList.
+func (in *ModelBundleList) DeepCopy() *ModelBundleList {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBundleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModelBundleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBundleModel) DeepCopyInto(out *ModelBundleModel) {
+	*out = *in
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBundleModel.
+func (in *ModelBundleModel) DeepCopy() *ModelBundleModel {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBundleModel)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBundleSpec) DeepCopyInto(out *ModelBundleSpec) {
+	*out = *in
+	if in.Models != nil {
+		in, out := &in.Models, &out.Models
+		*out = make([]ModelBundleModel, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBundleSpec.
+func (in *ModelBundleSpec) DeepCopy() *ModelBundleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBundleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelBundleStatus) DeepCopyInto(out *ModelBundleStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelBundleStatus.
+func (in *ModelBundleStatus) DeepCopy() *ModelBundleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelBundleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelCapacity) DeepCopyInto(out *ModelCapacity) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelCapacity.
+func (in *ModelCapacity) DeepCopy() *ModelCapacity {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelCapacity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelDeprecation) DeepCopyInto(out *ModelDeprecation) {
+	*out = *in
+	if in.SunsetDate != nil {
+		in, out := &in.SunsetDate, &out.SunsetDate
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelDeprecation.
+func (in *ModelDeprecation) DeepCopy() *ModelDeprecation {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelDeprecation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ModelList) DeepCopyInto(out *ModelList) {
 	*out = *in
@@ -98,6 +370,77 @@ func (in *ModelList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelPlacement) DeepCopyInto(out *ModelPlacement) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelPlacement.
+func (in *ModelPlacement) DeepCopy() *ModelPlacement {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelPlacement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelRollout) DeepCopyInto(out *ModelRollout) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelRollout.
+func (in *ModelRollout) DeepCopy() *ModelRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelSafetyPolicy) DeepCopyInto(out *ModelSafetyPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelSafetyPolicy.
+func (in *ModelSafetyPolicy) DeepCopy() *ModelSafetyPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelSafetyPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelSchedule) DeepCopyInto(out *ModelSchedule) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelSchedule.
+func (in *ModelSchedule) DeepCopy() *ModelSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ModelSpec) DeepCopyInto(out *ModelSpec) {
 	*out = *in
@@ -106,6 +449,11 @@ func (in *ModelSpec) DeepCopyInto(out *ModelSpec) {
 		*out = make([]Adapter, len(*in))
 		copy(*out, *in)
 	}
+	if in.Aliases != nil {
+		in, out := &in.Aliases, &out.Aliases
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Features != nil {
 		in, out := &in.Features, &out.Features
 		*out = make([]ModelFeature, len(*in))
@@ -123,6 +471,31 @@ func (in *ModelSpec) DeepCopyInto(out *ModelSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExternalEndpoints != nil {
+		in, out := &in.ExternalEndpoints, &out.ExternalEndpoints
+		*out = make([]ExternalEndpoint, len(*in))
+		copy(*out, *in)
+	}
+	if in.PassthroughPaths != nil {
+		in, out := &in.PassthroughPaths, &out.PassthroughPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ChatMessages != nil {
+		in, out := &in.ChatMessages, &out.ChatMessages
+		*out = new(ChatMessageNormalization)
+		**out = **in
+	}
+	if in.Dependencies != nil {
+		in, out := &in.Dependencies, &out.Dependencies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Replicas != nil {
 		in, out := &in.Replicas, &out.Replicas
 		*out = new(int32)
@@ -138,11 +511,138 @@ func (in *ModelSpec) DeepCopyInto(out *ModelSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.TargetQueueDepth != nil {
+		in, out := &in.TargetQueueDepth, &out.TargetQueueDepth
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetKVCacheUsagePercent != nil {
+		in, out := &in.TargetKVCacheUsagePercent, &out.TargetKVCacheUsagePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetGPUUtilizationPercent != nil {
+		in, out := &in.TargetGPUUtilizationPercent, &out.TargetGPUUtilizationPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetP95LatencyMilliseconds != nil {
+		in, out := &in.TargetP95LatencyMilliseconds, &out.TargetP95LatencyMilliseconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetP95TimeToFirstTokenMilliseconds != nil {
+		in, out := &in.TargetP95TimeToFirstTokenMilliseconds, &out.TargetP95TimeToFirstTokenMilliseconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AutoscalingSignals != nil {
+		in, out := &in.AutoscalingSignals, &out.AutoscalingSignals
+		*out = new(AutoscalingSignals)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxQueueWaitSeconds != nil {
+		in, out := &in.MaxQueueWaitSeconds, &out.MaxQueueWaitSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxScaleFromZeroWaitSeconds != nil {
+		in, out := &in.MaxScaleFromZeroWaitSeconds, &out.MaxScaleFromZeroWaitSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxEndpointsPerRequest != nil {
+		in, out := &in.MaxEndpointsPerRequest, &out.MaxEndpointsPerRequest
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ScaleUpDelaySeconds != nil {
+		in, out := &in.ScaleUpDelaySeconds, &out.ScaleUpDelaySeconds
+		*out = new(int64)
+		**out = **in
+	}
 	if in.ScaleDownDelaySeconds != nil {
 		in, out := &in.ScaleDownDelaySeconds, &out.ScaleDownDelaySeconds
 		*out = new(int64)
 		**out = **in
 	}
+	if in.ScalingTolerancePercent != nil {
+		in, out := &in.ScalingTolerancePercent, &out.ScalingTolerancePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ScaleDownStabilizationSeconds != nil {
+		in, out := &in.ScaleDownStabilizationSeconds, &out.ScaleDownStabilizationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.ScaleToZeroIdleSeconds != nil {
+		in, out := &in.ScaleToZeroIdleSeconds, &out.ScaleToZeroIdleSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Schedules != nil {
+		in, out := &in.Schedules, &out.Schedules
+		*out = make([]ModelSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ActiveWindows != nil {
+		in, out := &in.ActiveWindows, &out.ActiveWindows
+		*out = make([]ModelActiveWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.VerticalScaling != nil {
+		in, out := &in.VerticalScaling, &out.VerticalScaling
+		*out = new(VerticalScaling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MultiNode != nil {
+		in, out := &in.MultiNode, &out.MultiNode
+		*out = new(MultiNode)
+		**out = **in
+	}
+	if in.SpecDecoding != nil {
+		in, out := &in.SpecDecoding, &out.SpecDecoding
+		*out = new(SpecDecoding)
+		**out = **in
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(ModelRollout)
+		**out = **in
+	}
+	if in.WeightUpdates != nil {
+		in, out := &in.WeightUpdates, &out.WeightUpdates
+		*out = new(ModelWeightUpdates)
+		**out = **in
+	}
+	if in.DisruptionBudget != nil {
+		in, out := &in.DisruptionBudget, &out.DisruptionBudget
+		*out = new(DisruptionBudget)
+		**out = **in
+	}
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		*out = new(ModelCapacity)
+		**out = **in
+	}
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(ModelPlacement)
+		**out = **in
+	}
+	if in.Deprecation != nil {
+		in, out := &in.Deprecation, &out.Deprecation
+		*out = new(ModelDeprecation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SafetyPolicy != nil {
+		in, out := &in.SafetyPolicy, &out.SafetyPolicy
+		*out = new(ModelSafetyPolicy)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelSpec.
@@ -164,6 +664,33 @@ func (in *ModelStatus) DeepCopyInto(out *ModelStatus) {
 		*out = new(ModelStatusCache)
 		**out = **in
 	}
+	if in.Recommendation != nil {
+		in, out := &in.Recommendation, &out.Recommendation
+		*out = new(ModelStatusRecommendation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(ModelStatusRollout)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Capabilities != nil {
+		in, out := &in.Capabilities, &out.Capabilities
+		*out = new(ModelStatusCapabilities)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Weights != nil {
+		in, out := &in.Weights, &out.Weights
+		*out = new(ModelStatusWeights)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelStatus.
@@ -191,6 +718,57 @@ func (in *ModelStatusCache) DeepCopy() *ModelStatusCache {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelStatusCapabilities) DeepCopyInto(out *ModelStatusCapabilities) {
+	*out = *in
+	if in.MaxContextLength != nil {
+		in, out := &in.MaxContextLength, &out.MaxContextLength
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxLoRARank != nil {
+		in, out := &in.MaxLoRARank, &out.MaxLoRARank
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Vision != nil {
+		in, out := &in.Vision, &out.Vision
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelStatusCapabilities.
+func (in *ModelStatusCapabilities) DeepCopy() *ModelStatusCapabilities {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelStatusCapabilities)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelStatusRecommendation) DeepCopyInto(out *ModelStatusRecommendation) {
+	*out = *in
+	if in.MaxNumSeqs != nil {
+		in, out := &in.MaxNumSeqs, &out.MaxNumSeqs
+		*out = new(int32)
+		**out = **in
+	}
+	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelStatusRecommendation.
+func (in *ModelStatusRecommendation) DeepCopy() *ModelStatusRecommendation {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelStatusRecommendation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ModelStatusReplicas) DeepCopyInto(out *ModelStatusReplicas) {
 	*out = *in
@@ -205,3 +783,139 @@ func (in *ModelStatusReplicas) DeepCopy() *ModelStatusReplicas {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelStatusRollout) DeepCopyInto(out *ModelStatusRollout) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	if in.CanaryReadyTime != nil {
+		in, out := &in.CanaryReadyTime, &out.CanaryReadyTime
+		*out = (*in).DeepCopy()
+	}
+	if in.StablePod != nil {
+		in, out := &in.StablePod, &out.StablePod
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelStatusRollout.
+func (in *ModelStatusRollout) DeepCopy() *ModelStatusRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelStatusRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelStatusWeights) DeepCopyInto(out *ModelStatusWeights) {
+	*out = *in
+	if in.LastCheckTime != nil {
+		in, out := &in.LastCheckTime, &out.LastCheckTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelStatusWeights.
+func (in *ModelStatusWeights) DeepCopy() *ModelStatusWeights {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelStatusWeights)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModelWeightUpdates) DeepCopyInto(out *ModelWeightUpdates) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModelWeightUpdates.
+func (in *ModelWeightUpdates) DeepCopy() *ModelWeightUpdates {
+	if in == nil {
+		return nil
+	}
+	out := new(ModelWeightUpdates)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MultiNode) DeepCopyInto(out *MultiNode) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MultiNode.
+func (in *MultiNode) DeepCopy() *MultiNode {
+	if in == nil {
+		return nil
+	}
+	out := new(MultiNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpecDecoding) DeepCopyInto(out *SpecDecoding) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpecDecoding.
+func (in *SpecDecoding) DeepCopy() *SpecDecoding {
+	if in == nil {
+		return nil
+	}
+	out := new(SpecDecoding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VerticalScaling) DeepCopyInto(out *VerticalScaling) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]VerticalScalingStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VerticalScaling.
+func (in *VerticalScaling) DeepCopy() *VerticalScaling {
+	if in == nil {
+		return nil
+	}
+	out := new(VerticalScaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VerticalScalingStep) DeepCopyInto(out *VerticalScalingStep) {
+	*out = *in
+	if in.TargetRequests != nil {
+		in, out := &in.TargetRequests, &out.TargetRequests
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VerticalScalingStep.
+func (in *VerticalScalingStep) DeepCopy() *VerticalScalingStep {
+	if in == nil {
+		return nil
+	}
+	out := new(VerticalScalingStep)
+	in.DeepCopyInto(out)
+	return out
+}
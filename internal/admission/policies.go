@@ -0,0 +1,158 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/yaml"
+)
+
+// PolicyLabel marks ConfigMaps that contain admission policies. Every key
+// of such a ConfigMap is parsed as a Policy. Only ConfigMaps in KubeAI's
+// namespace are loaded.
+const PolicyLabel = "kubeai.org/admission-policy"
+
+func NewPolicies(mgr ctrl.Manager, namespace string) (*Policies, error) {
+	p := &Policies{}
+	p.Client = mgr.GetClient()
+	p.Namespace = namespace
+	p.byConfigMap = map[types.NamespacedName][]Rule{}
+	if err := p.SetupWithManager(mgr); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Policies are the admission policies loaded from ConfigMaps. Policies are
+// reloaded when the ConfigMaps change.
+type Policies struct {
+	client.Client
+	// Namespace is the namespace that policy ConfigMaps are loaded from.
+	Namespace string
+
+	mtx         sync.RWMutex
+	byConfigMap map[types.NamespacedName][]Rule
+	// rules of all ConfigMaps, ordered by ConfigMap name.
+	rules []Rule
+}
+
+func (p *Policies) SetupWithManager(mgr ctrl.Manager) error {
+	// Policies are evaluated by every replica.
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("admission-policies").
+		WithOptions(controller.Options{NeedLeaderElection: ptr.To(false)}).
+		For(&corev1.ConfigMap{}, builder.WithPredicates(
+			predicate.NewPredicateFuncs(func(obj client.Object) bool { return obj.GetNamespace() == p.Namespace }),
+			predicate.Funcs{
+				CreateFunc: func(e event.CreateEvent) bool { return hasPolicyLabel(e.Object) },
+				// Also reload if the label was removed.
+				UpdateFunc:  func(e event.UpdateEvent) bool { return hasPolicyLabel(e.ObjectOld) || hasPolicyLabel(e.ObjectNew) },
+				DeleteFunc:  func(e event.DeleteEvent) bool { return hasPolicyLabel(e.Object) },
+				GenericFunc: func(e event.GenericEvent) bool { return hasPolicyLabel(e.Object) },
+			},
+		)).
+		Complete(p)
+}
+
+func hasPolicyLabel(obj client.Object) bool {
+	_, ok := obj.GetLabels()[PolicyLabel]
+	return ok
+}
+
+func (p *Policies) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.Namespace != p.Namespace {
+		return ctrl.Result{}, nil
+	}
+	var cm corev1.ConfigMap
+	if err := p.Get(ctx, req.NamespacedName, &cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			p.set(req.NamespacedName, nil)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !hasPolicyLabel(&cm) {
+		p.set(req.NamespacedName, nil)
+		return ctrl.Result{}, nil
+	}
+
+	rules, err := parseConfigMap(&cm)
+	if err != nil {
+		// Keep the last valid rules so that a bad edit does not
+		// remove existing deny rules.
+		log.Printf("Invalid admission policy ConfigMap %q, keeping previous rules: %v", cm.Name, err)
+		return ctrl.Result{}, nil
+	}
+	log.Printf("Loaded %d admission policy rules from ConfigMap %q", len(rules), cm.Name)
+	p.set(req.NamespacedName, rules)
+	return ctrl.Result{}, nil
+}
+
+// parseConfigMap returns the rules of all keys of a ConfigMap,
+// ordered by key.
+func parseConfigMap(cm *corev1.ConfigMap) ([]Rule, error) {
+	keys := make([]string, 0, len(cm.Data))
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var rules []Rule
+	for _, k := range keys {
+		var policy Policy
+		if err := yaml.UnmarshalStrict([]byte(cm.Data[k]), &policy); err != nil {
+			return nil, fmt.Errorf("key %q: parsing: %w", k, err)
+		}
+		if err := policy.Compile(); err != nil {
+			return nil, fmt.Errorf("key %q: %w", k, err)
+		}
+		rules = append(rules, policy.Rules...)
+	}
+	return rules, nil
+}
+
+// set replaces the rules of a ConfigMap. Nil rules remove the ConfigMap.
+func (p *Policies) set(configMap types.NamespacedName, rules []Rule) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if rules == nil {
+		delete(p.byConfigMap, configMap)
+	} else {
+		p.byConfigMap[configMap] = rules
+	}
+
+	names := make([]types.NamespacedName, 0, len(p.byConfigMap))
+	for name := range p.byConfigMap {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].String() < names[j].String() })
+	p.rules = nil
+	for _, name := range names {
+		p.rules = append(p.rules, p.byConfigMap[name]...)
+	}
+}
+
+// Admit evaluates the policies against the request. Mutations are applied
+// to req.Params. A nil Policies allows all requests.
+func (p *Policies) Admit(req *Request) Decision {
+	if p == nil {
+		return Decision{Allowed: true}
+	}
+	p.mtx.RLock()
+	rules := p.rules
+	p.mtx.RUnlock()
+	return evaluate(rules, req)
+}
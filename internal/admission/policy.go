@@ -0,0 +1,327 @@
+package admission
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+// Action is what happens to a request that matches a Rule.
+type Action string
+
+const (
+	// ActionAllow admits the request without evaluating the remaining rules.
+	ActionAllow Action = "Allow"
+	// ActionDeny rejects the request.
+	ActionDeny Action = "Deny"
+	// ActionMutate changes the request parameters and continues with the
+	// remaining rules.
+	ActionMutate Action = "Mutate"
+)
+
+// Policy is a list of rules that are evaluated in order.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+type Rule struct {
+	// Name identifies the rule in responses, logs and metrics.
+	Name string `json:"name"`
+	// Match is a CEL expression that selects the requests that the rule
+	// applies to (see matchEnv for the variables). An empty expression
+	// matches all requests.
+	Match  string `json:"match,omitempty"`
+	Action Action `json:"action"`
+	// Message is returned to the client when the request is denied.
+	Message string `json:"message,omitempty"`
+
+	// Set overwrites request parameters (Mutate only).
+	Set map[string]any `json:"set,omitempty"`
+	// Defaults sets request parameters that are not set (Mutate only).
+	Defaults map[string]any `json:"defaults,omitempty"`
+	// MaxValues caps numeric request parameters (Mutate only).
+	MaxValues map[string]float64 `json:"maxValues,omitempty"`
+
+	// program is the compiled Match expression (see Policy.Compile()).
+	program cel.Program
+}
+
+// Request is the parsed request that policies are evaluated against.
+type Request struct {
+	// Model is the name of the Model that serves the request (including
+	// the adapter, if any). Aliases are resolved to the Model's name.
+	Model string
+	// RequestedModel is the model as it was requested, i.e. an alias.
+	RequestedModel string
+	Path           string
+	// Header looks up request headers (or message metadata).
+	Header func(string) string
+	// Params is the JSON request body. It is nil if the body is not JSON
+	// (i.e. multipart form data), in which case no mutations are applied.
+	Params map[string]any
+}
+
+// Decision is the result of evaluating policies against a Request.
+type Decision struct {
+	Allowed bool
+	// Rule is the name of the rule that allowed or denied the request.
+	// Empty if no Allow or Deny rule matched.
+	Rule    string
+	Message string
+	// Mutated is true if the Request's Params were changed.
+	Mutated bool
+}
+
+// matchEnv declares the variables of Match expressions:
+//
+//	model           string               the name of the Model that serves the
+//	                                     request (including the adapter)
+//	requestedModel  string               the model as requested (i.e. an alias)
+//	path            string               the request path
+//	headers         map(string, string)  request headers (or message metadata),
+//	                                     missing headers are empty strings
+//	params          map(string, dyn)     the JSON request body
+//	estimatedTokens int                  see EstimateTokens()
+var matchEnv = func() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Variable("model", cel.StringType),
+		cel.Variable("requestedModel", cel.StringType),
+		cel.Variable("path", cel.StringType),
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("params", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("estimatedTokens", cel.IntType),
+		cel.CrossTypeNumericComparisons(true),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}()
+
+// maxMatchCost limits the cost of evaluating a Match expression
+// (i.e. iterating over large request parameters).
+const maxMatchCost = 1000000
+
+// Compile validates the rules of the Policy and compiles their
+// Match expressions.
+func (p *Policy) Compile() error {
+	var errs []error
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			errs = append(errs, fmt.Errorf("rules[%d]: name is required", i))
+		}
+		switch r.Action {
+		case ActionAllow, ActionDeny:
+			if len(r.Set) > 0 || len(r.Defaults) > 0 || len(r.MaxValues) > 0 {
+				errs = append(errs, fmt.Errorf("rules[%d]: set, defaults and maxValues are only allowed for action %s", i, ActionMutate))
+			}
+		case ActionMutate:
+			if len(r.Set) == 0 && len(r.Defaults) == 0 && len(r.MaxValues) == 0 {
+				errs = append(errs, fmt.Errorf("rules[%d]: one of set, defaults or maxValues is required for action %s", i, ActionMutate))
+			}
+			if _, ok := r.Set["model"]; ok {
+				errs = append(errs, fmt.Errorf("rules[%d]: the model parameter can not be set", i))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("rules[%d]: action must be one of %s, %s or %s", i, ActionAllow, ActionDeny, ActionMutate))
+		}
+		if r.Match == "" {
+			continue
+		}
+		ast, iss := matchEnv.Compile(r.Match)
+		if iss.Err() != nil {
+			errs = append(errs, fmt.Errorf("rules[%d]: match: %w", i, iss.Err()))
+			continue
+		}
+		if ast.OutputType() != cel.BoolType {
+			errs = append(errs, fmt.Errorf("rules[%d]: match must be a boolean expression, got %v", i, ast.OutputType()))
+			continue
+		}
+		program, err := matchEnv.Program(ast, cel.CostLimit(maxMatchCost))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d]: match: %w", i, err))
+			continue
+		}
+		r.program = program
+	}
+	return errors.Join(errs...)
+}
+
+// evaluate evaluates the rules in order against the request. Mutate rules
+// are applied and evaluation continues, the first matching Allow or Deny
+// rule decides. Requests that no Allow or Deny rule matches are allowed.
+// Requests are denied if a Match expression fails to evaluate.
+func evaluate(rules []Rule, req *Request) Decision {
+	var (
+		mutated bool
+		vars    map[string]any
+	)
+	for _, r := range rules {
+		if r.program != nil {
+			if vars == nil {
+				vars = matchVars(req)
+			}
+			out, _, err := r.program.Eval(vars)
+			if err != nil {
+				return Decision{Allowed: false, Rule: r.Name, Message: fmt.Sprintf("evaluating admission policy %q: %v", r.Name, err), Mutated: mutated}
+			}
+			if out != types.True {
+				continue
+			}
+		}
+		switch r.Action {
+		case ActionAllow:
+			return Decision{Allowed: true, Rule: r.Name, Mutated: mutated}
+		case ActionDeny:
+			msg := r.Message
+			if msg == "" {
+				msg = fmt.Sprintf("request denied by admission policy %q", r.Name)
+			}
+			return Decision{Allowed: false, Rule: r.Name, Message: msg, Mutated: mutated}
+		case ActionMutate:
+			if r.mutate(req.Params) {
+				mutated = true
+				// Later expressions see the mutated params.
+				vars = nil
+			}
+		}
+	}
+	return Decision{Allowed: true, Mutated: mutated}
+}
+
+func matchVars(req *Request) map[string]any {
+	params := req.Params
+	if params == nil {
+		params = map[string]any{}
+	}
+	header := req.Header
+	if header == nil {
+		header = func(string) string { return "" }
+	}
+	return map[string]any{
+		"model":           req.Model,
+		"requestedModel":  req.RequestedModel,
+		"path":            req.Path,
+		"headers":         headerMap(header),
+		"params":          params,
+		"estimatedTokens": EstimateTokens(req.Params),
+	}
+}
+
+// headerMap exposes the headers of a request to Match expressions without
+// copying them. Missing headers are empty strings.
+type headerMap func(string) string
+
+var _ traits.Indexer = headerMap(nil)
+
+func (h headerMap) Get(key ref.Val) ref.Val {
+	name, ok := key.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(key)
+	}
+	return types.String(h(string(name)))
+}
+
+func (h headerMap) Contains(key ref.Val) ref.Val {
+	name, ok := key.(types.String)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(key)
+	}
+	return types.Bool(h(string(name)) != "")
+}
+
+func (h headerMap) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	return nil, fmt.Errorf("headers can not be converted to %v", typeDesc)
+}
+
+func (h headerMap) ConvertToType(typeVal ref.Type) ref.Val {
+	if typeVal == types.MapType {
+		return h
+	}
+	return types.NewErr("headers can not be converted to %v", typeVal)
+}
+
+func (h headerMap) Equal(other ref.Val) ref.Val {
+	return types.False
+}
+
+func (h headerMap) Type() ref.Type {
+	return types.MapType
+}
+
+func (h headerMap) Value() any {
+	return h
+}
+
+// mutate applies the rule's mutations to the params and returns true if
+// any param was changed.
+func (r Rule) mutate(params map[string]any) bool {
+	if params == nil {
+		return false
+	}
+	var changed bool
+	for k, v := range r.Defaults {
+		if _, ok := params[k]; !ok {
+			params[k] = v
+			changed = true
+		}
+	}
+	for k, v := range r.Set {
+		params[k] = v
+		changed = true
+	}
+	for k, limit := range r.MaxValues {
+		if v, ok := params[k].(float64); ok && v > limit {
+			params[k] = limit
+			changed = true
+		}
+	}
+	return changed
+}
+
+// charsPerToken is a rough average for English text with common tokenizers.
+const charsPerToken = 4
+
+// EstimateTokens estimates the number of tokens of a request from the length
+// of the prompt ("prompt", "input" or "messages") plus the maximum number of
+// tokens requested for the completion ("max_tokens" or "max_completion_tokens").
+func EstimateTokens(params map[string]any) int {
+	var chars int
+	for _, k := range []string{"prompt", "input", "messages"} {
+		chars += textLength(params[k])
+	}
+	tokens := int(math.Ceil(float64(chars) / charsPerToken))
+	for _, k := range []string{"max_tokens", "max_completion_tokens"} {
+		if v, ok := params[k].(float64); ok {
+			tokens += int(v)
+			break
+		}
+	}
+	return tokens
+}
+
+// textLength returns the total length of the text in a JSON prompt value.
+func textLength(v any) int {
+	switch v := v.(type) {
+	case string:
+		return len(v)
+	case []any:
+		var n int
+		for _, e := range v {
+			n += textLength(e)
+		}
+		return n
+	case map[string]any:
+		// Messages ({"role": ..., "content": ...}) and content parts
+		// ({"type": "text", "text": ...}).
+		return textLength(v["content"]) + textLength(v["text"])
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package admission
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestEvaluate(t *testing.T) {
+	policy := Policy{Rules: []Rule{
+		{
+			Name:   "admins",
+			Match:  `headers["X-Admin"] != ""`,
+			Action: ActionAllow,
+		},
+		{
+			Name:      "limit-max-tokens",
+			Match:     `model.startsWith("llama-")`,
+			Action:    ActionMutate,
+			Defaults:  map[string]any{"temperature": 0.5},
+			MaxValues: map[string]float64{"max_tokens": 1000},
+		},
+		{
+			Name:    "teams",
+			Match:   `path.startsWith("/v1/") && headers["x-team"] == "blocked"`,
+			Action:  ActionDeny,
+			Message: "team is blocked",
+		},
+		{
+			Name:   "large-requests",
+			Match:  `estimatedTokens >= 2000`,
+			Action: ActionDeny,
+		},
+		{
+			Name:   "no-streaming",
+			Match:  `has(params.stream) && params.stream == true`,
+			Action: ActionDeny,
+		},
+	}}
+	require.NoError(t, policy.Compile())
+	rules := policy.Rules
+	request := func(model string, header http.Header, params map[string]any) *Request {
+		return &Request{Model: model, Path: "/v1/completions", Header: header.Get, Params: params}
+	}
+
+	// Mutations are applied and later rules are evaluated.
+	params := map[string]any{"max_tokens": 5000.0}
+	require.Equal(t, Decision{Allowed: true, Mutated: true}, evaluate(rules, request("llama-3", http.Header{}, params)))
+	require.Equal(t, map[string]any{"max_tokens": 1000.0, "temperature": 0.5}, params)
+
+	// Mutations that do not change the params are not reported.
+	params = map[string]any{"max_tokens": 10.0, "temperature": 1.0}
+	require.Equal(t, Decision{Allowed: true}, evaluate(rules, request("llama-3", http.Header{}, params)))
+
+	// Deny rules.
+	require.Equal(t, Decision{Rule: "teams", Message: "team is blocked"},
+		evaluate(rules, request("qwen", http.Header{"X-Team": {"blocked"}}, map[string]any{})))
+	require.Equal(t, Decision{Rule: "large-requests", Message: `request denied by admission policy "large-requests"`},
+		evaluate(rules, request("qwen", http.Header{}, map[string]any{"max_tokens": 3000.0})))
+
+	require.Equal(t, Decision{Rule: "no-streaming", Message: `request denied by admission policy "no-streaming"`},
+		evaluate(rules, request("qwen", http.Header{}, map[string]any{"stream": true})))
+
+	// Allow rules skip the remaining rules.
+	require.Equal(t, Decision{Allowed: true, Rule: "admins"},
+		evaluate(rules, request("qwen", http.Header{"X-Team": {"blocked"}, "X-Admin": {"1"}}, map[string]any{})))
+
+	// The requested model (i.e. an alias) is a separate variable.
+	policy = Policy{Rules: []Rule{{Name: "alias", Match: `requestedModel == "old-name" && model == "llama-3"`, Action: ActionDeny}}}
+	require.NoError(t, policy.Compile())
+	aliased := request("llama-3", http.Header{}, map[string]any{})
+	aliased.RequestedModel = "old-name"
+	require.Equal(t, "alias", evaluate(policy.Rules, aliased).Rule)
+
+	// Errors deny the request.
+	policy = Policy{Rules: []Rule{{Name: "bad", Match: `params.max_tokens > 10`, Action: ActionDeny}}}
+	require.NoError(t, policy.Compile())
+	decision := evaluate(policy.Rules, request("qwen", http.Header{}, map[string]any{}))
+	require.False(t, decision.Allowed)
+	require.Equal(t, "bad", decision.Rule)
+	require.Contains(t, decision.Message, `evaluating admission policy "bad"`)
+
+	// Non-JSON requests are not mutated.
+	require.Equal(t, Decision{Allowed: true}, evaluate(rules, request("llama-3", http.Header{}, nil)))
+}
+
+func TestEstimateTokens(t *testing.T) {
+	require.Equal(t, 0, EstimateTokens(nil))
+	require.Equal(t, 3, EstimateTokens(map[string]any{"prompt": "0123456789"}))
+	require.Equal(t, 105, EstimateTokens(map[string]any{
+		"messages": []any{
+			map[string]any{"role": "system", "content": "0123456789"},
+			map[string]any{"role": "user", "content": []any{
+				map[string]any{"type": "text", "text": "0123456789"},
+			}},
+		},
+		"max_tokens": 100.0,
+	}))
+	require.Equal(t, 4, EstimateTokens(map[string]any{"input": []any{"0123", "4567", "89"}, "max_completion_tokens": 1.0}))
+}
+
+func TestCompile(t *testing.T) {
+	require.NoError(t, (&Policy{Rules: []Rule{{Name: "a", Action: ActionDeny}}}).Compile())
+	err := (&Policy{Rules: []Rule{
+		{Action: ActionAllow},
+		{Name: "b", Action: ActionMutate},
+		{Name: "c", Action: ActionMutate, Set: map[string]any{"model": "other"}},
+		{Name: "d", Action: ActionDeny, Set: map[string]any{"a": 1}},
+		{Name: "e", Action: "Block"},
+		{Name: "f", Action: ActionDeny, Match: `model ==`},
+		{Name: "g", Action: ActionDeny, Match: `model`},
+	}}).Compile()
+	require.Error(t, err)
+	for _, msg := range []string{
+		"rules[0]: name is required",
+		"rules[1]: one of set, defaults or maxValues is required for action Mutate",
+		"rules[2]: the model parameter can not be set",
+		"rules[3]: set, defaults and maxValues are only allowed for action Mutate",
+		"rules[4]: action must be one of Allow, Deny or Mutate",
+		"rules[5]: match: ",
+		"rules[6]: match must be a boolean expression, got string",
+	} {
+		require.ErrorContains(t, err, msg)
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	cm := &corev1.ConfigMap{Data: map[string]string{
+		"b.yaml": `
+rules:
+- name: deny-all
+  action: Deny
+`,
+		"a.yaml": `
+rules:
+- name: allow-admins
+  match: headers["X-Admin"] != ""
+  action: Allow
+`,
+	}}
+	rules, err := parseConfigMap(cm)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	require.Equal(t, "allow-admins", rules[0].Name, "keys should be ordered")
+
+	_, err = parseConfigMap(&corev1.ConfigMap{Data: map[string]string{"a.yaml": "rules:\n- name: a\n  action: Deny\n  unknown: 1\n"}})
+	require.ErrorContains(t, err, `key "a.yaml": parsing`)
+
+	a := types.NamespacedName{Namespace: "kubeai", Name: "a"}
+	b := types.NamespacedName{Namespace: "kubeai", Name: "b"}
+	p := &Policies{Namespace: "kubeai", byConfigMap: map[types.NamespacedName][]Rule{}}
+	p.set(b, rules[1:])
+	p.set(a, rules[:1])
+	require.Equal(t, Decision{Allowed: true, Rule: "allow-admins"}, p.Admit(&Request{Header: http.Header{"X-Admin": {"1"}}.Get}))
+	require.Equal(t, Decision{Rule: "deny-all", Message: `request denied by admission policy "deny-all"`}, p.Admit(&Request{Header: http.Header{}.Get}))
+
+	p.set(b, nil)
+	require.Equal(t, Decision{Allowed: true}, p.Admit(&Request{Header: http.Header{}.Get}))
+
+	// ConfigMaps of other namespaces are ignored.
+	_, err = p.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "b"}})
+	require.NoError(t, err)
+	require.Len(t, p.byConfigMap, 1)
+
+	var nilPolicies *Policies
+	require.Equal(t, Decision{Allowed: true}, nilPolicies.Admit(&Request{}))
+}
@@ -0,0 +1,137 @@
+package anthropicapi_test
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/anthropicapi"
+)
+
+func TestChatCompletionParams(t *testing.T) {
+	t.Parallel()
+
+	var params map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "m",
+		"max_tokens": 10,
+		"system": [{"type": "text", "text": "Be brief."}],
+		"stop_sequences": ["\n\n"],
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "weather?"}, {"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "AA=="}}]},
+			{"role": "assistant", "content": [{"type": "thinking", "thinking": "..."}, {"type": "tool_use", "id": "t1", "name": "weather", "input": {"city": "a"}}]},
+			{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "t1", "content": [{"type": "text", "text": "sunny"}]}, {"type": "text", "text": "thanks"}]}
+		],
+		"tools": [{"name": "weather", "description": "d", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any", "disable_parallel_tool_use": true}
+	}`), &params))
+
+	chat, err := anthropicapi.ChatCompletionParams(params)
+	require.NoError(t, err)
+	exp := `{
+		"model": "m",
+		"max_tokens": 10,
+		"stop": ["\n\n"],
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "weather?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,AA=="}}]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "t1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"a\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "t1", "content": "sunny"},
+			{"role": "user", "content": [{"type": "text", "text": "thanks"}]}
+		],
+		"tools": [{"type": "function", "function": {"name": "weather", "description": "d", "parameters": {"type": "object"}}}],
+		"tool_choice": "required",
+		"parallel_tool_calls": false
+	}`
+	got, err := json.Marshal(chat)
+	require.NoError(t, err)
+	require.JSONEq(t, exp, string(got))
+
+	_, err = anthropicapi.ChatCompletionParams(map[string]any{"messages": []any{
+		map[string]any{"role": "user", "content": []any{map[string]any{"type": "document"}}},
+	}})
+	require.EqualError(t, err, "messages[0]: content blocks of type document are not supported")
+}
+
+func TestFromChatCompletion(t *testing.T) {
+	t.Parallel()
+
+	body, err := anthropicapi.FromChatCompletion(map[string]any{"model": "m"}, []byte(`{
+		"id": "chatcmpl-1", "model": "m",
+		"choices": [{"message": {"role": "assistant", "content": "Let me check.", "tool_calls": [
+			{"id": "t1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"a\"}"}}
+		]}, "finish_reason": "tool_calls"}],
+		"usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}
+	}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"id": "msg_1",
+		"type": "message",
+		"role": "assistant",
+		"model": "m",
+		"content": [
+			{"type": "text", "text": "Let me check."},
+			{"type": "tool_use", "id": "t1", "name": "weather", "input": {"city": "a"}}
+		],
+		"stop_reason": "tool_use",
+		"stop_sequence": null,
+		"usage": {"input_tokens": 3, "output_tokens": 2}
+	}`, string(body))
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	chat := `data: {"id":"chatcmpl-1","model":"m","choices":[{"delta":{"role":"assistant","content":"Let me"}}]}
+
+data: {"id":"chatcmpl-1","model":"m","choices":[{"delta":{"content":" check."}}]}
+
+data: {"id":"chatcmpl-1","model":"m","choices":[{"delta":{"tool_calls":[{"index":0,"id":"t1","function":{"name":"weather","arguments":"{\"city\":"}}]}}]}
+
+data: {"id":"chatcmpl-1","model":"m","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"a\"}"}}]},"finish_reason":"tool_calls"}]}
+
+data: {"id":"chatcmpl-1","model":"m","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}
+
+data: [DONE]
+
+`
+	out, err := io.ReadAll(anthropicapi.NewStream(map[string]any{}, io.NopCloser(strings.NewReader(chat))))
+	require.NoError(t, err)
+
+	var events []string
+	for _, line := range strings.Split(string(out), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+		switch event["type"] {
+		case "content_block_start", "content_block_stop":
+			events = append(events, event["type"].(string)+":"+string(rune('0'+int(event["index"].(float64)))))
+		case "message_delta":
+			require.Equal(t, "tool_use", event["delta"].(map[string]any)["stop_reason"])
+			require.EqualValues(t, 2, event["usage"].(map[string]any)["output_tokens"])
+			events = append(events, "message_delta")
+		default:
+			events = append(events, event["type"].(string))
+		}
+	}
+	require.Equal(t, []string{
+		"message_start",
+		"content_block_start:0",
+		"content_block_delta",
+		"content_block_delta",
+		"content_block_stop:0",
+		"content_block_start:1",
+		"content_block_delta",
+		"content_block_delta",
+		"content_block_stop:1",
+		"message_delta",
+		"message_stop",
+	}, events)
+}
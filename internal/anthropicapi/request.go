@@ -0,0 +1,229 @@
+// Package anthropicapi translates requests of the Anthropic Messages API
+// (/v1/messages) to chat completion requests and translates the chat
+// completions (and their streamed chunks) back, so that clients of the
+// Anthropic API are served by model servers of the OpenAI API.
+package anthropicapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MessagesPath is the path of Messages API requests.
+const MessagesPath = "/v1/messages"
+
+// passthroughParams are the params that have the same meaning in both APIs.
+var passthroughParams = []string{"model", "max_tokens", "temperature", "top_p", "top_k", "stream"}
+
+// ChatCompletionParams returns the params of the chat completion request
+// that serves a Messages API request.
+func ChatCompletionParams(params map[string]any) (map[string]any, error) {
+	chat := map[string]any{}
+	for _, p := range passthroughParams {
+		if v, ok := params[p]; ok {
+			chat[p] = v
+		}
+	}
+	if stream, _ := params["stream"].(bool); stream {
+		// The usage is part of the message_delta event.
+		chat["stream_options"] = map[string]any{"include_usage": true}
+	}
+	if stop, ok := params["stop_sequences"]; ok {
+		chat["stop"] = stop
+	}
+	if metadata, ok := params["metadata"].(map[string]any); ok && metadata["user_id"] != nil {
+		chat["user"] = metadata["user_id"]
+	}
+
+	var messages []any
+	switch system := params["system"].(type) {
+	case string:
+		messages = append(messages, map[string]any{"role": "system", "content": system})
+	case []any:
+		text, err := blocksText(system)
+		if err != nil {
+			return nil, fmt.Errorf("system: %w", err)
+		}
+		messages = append(messages, map[string]any{"role": "system", "content": text})
+	}
+	input, ok := params["messages"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("messages must be a list of messages")
+	}
+	for i, m := range input {
+		msg, _ := m.(map[string]any)
+		translated, err := chatMessages(msg)
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		messages = append(messages, translated...)
+	}
+	chat["messages"] = messages
+
+	if tools, ok := params["tools"].([]any); ok && len(tools) > 0 {
+		chatTools := make([]any, 0, len(tools))
+		for i, t := range tools {
+			tool, _ := t.(map[string]any)
+			if typ, ok := tool["type"]; ok && typ != "custom" {
+				return nil, fmt.Errorf("tools[%d]: tools of type %v are not supported", i, typ)
+			}
+			function := map[string]any{"name": tool["name"], "parameters": tool["input_schema"]}
+			if d, ok := tool["description"]; ok {
+				function["description"] = d
+			}
+			chatTools = append(chatTools, map[string]any{"type": "function", "function": function})
+		}
+		chat["tools"] = chatTools
+	}
+	if choice, ok := params["tool_choice"].(map[string]any); ok {
+		switch choice["type"] {
+		case "auto":
+			chat["tool_choice"] = "auto"
+		case "any":
+			chat["tool_choice"] = "required"
+		case "none":
+			chat["tool_choice"] = "none"
+		case "tool":
+			chat["tool_choice"] = map[string]any{"type": "function", "function": map[string]any{"name": choice["name"]}}
+		default:
+			return nil, fmt.Errorf("tool_choice of type %v is not supported", choice["type"])
+		}
+		if disable, _ := choice["disable_parallel_tool_use"].(bool); disable {
+			chat["parallel_tool_calls"] = false
+		}
+	}
+	return chat, nil
+}
+
+// chatMessages returns the chat messages of a message: tool results are
+// tool messages that precede the rest of the content of a user message.
+func chatMessages(msg map[string]any) ([]any, error) {
+	role, _ := msg["role"].(string)
+	if role != "user" && role != "assistant" {
+		return nil, fmt.Errorf("role must be user or assistant")
+	}
+	blocks, ok := msg["content"].([]any)
+	if !ok {
+		return []any{map[string]any{"role": role, "content": msg["content"]}}, nil
+	}
+
+	var (
+		messages  []any
+		parts     []any
+		toolCalls []any
+	)
+	for _, b := range blocks {
+		block, _ := b.(map[string]any)
+		switch block["type"] {
+		case "text":
+			parts = append(parts, map[string]any{"type": "text", "text": block["text"]})
+		case "image":
+			url, err := imageURL(block["source"])
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+		case "tool_use":
+			arguments, err := json.Marshal(block["input"])
+			if err != nil {
+				return nil, fmt.Errorf("encoding tool input: %w", err)
+			}
+			toolCalls = append(toolCalls, map[string]any{
+				"id":       block["id"],
+				"type":     "function",
+				"function": map[string]any{"name": block["name"], "arguments": string(arguments)},
+			})
+		case "tool_result":
+			content := block["content"]
+			if blocks, ok := content.([]any); ok {
+				text, err := blocksText(blocks)
+				if err != nil {
+					return nil, fmt.Errorf("tool_result: %w", err)
+				}
+				content = text
+			}
+			if isError, _ := block["is_error"].(bool); isError {
+				content = fmt.Sprintf("Error: %v", content)
+			}
+			messages = append(messages, map[string]any{"role": "tool", "tool_call_id": block["tool_use_id"], "content": content})
+		case "thinking", "redacted_thinking":
+			// Thinking is not sent back to model servers.
+		default:
+			return nil, fmt.Errorf("content blocks of type %v are not supported", block["type"])
+		}
+	}
+
+	if len(parts) == 0 && len(toolCalls) == 0 {
+		return messages, nil
+	}
+	chatMsg := map[string]any{"role": role}
+	if role == "assistant" {
+		// Assistant messages have text content.
+		var text []string
+		for _, p := range parts {
+			text = append(text, p.(map[string]any)["text"].(string))
+		}
+		chatMsg["content"] = strings.Join(text, "")
+		if len(toolCalls) > 0 {
+			chatMsg["tool_calls"] = toolCalls
+			if len(text) == 0 {
+				chatMsg["content"] = nil
+			}
+		}
+	} else {
+		chatMsg["content"] = parts
+	}
+	return append(messages, chatMsg), nil
+}
+
+// imageURL returns the URL of the source of an image block.
+func imageURL(source any) (string, error) {
+	src, _ := source.(map[string]any)
+	switch src["type"] {
+	case "base64":
+		return fmt.Sprintf("data:%v;base64,%v", src["media_type"], src["data"]), nil
+	case "url":
+		if url, ok := src["url"].(string); ok {
+			return url, nil
+		}
+	}
+	return "", fmt.Errorf("images must have a base64 or url source")
+}
+
+// blocksText returns the text of a list of text blocks.
+func blocksText(blocks []any) (string, error) {
+	var text []string
+	for _, b := range blocks {
+		block, _ := b.(map[string]any)
+		s, ok := block["text"].(string)
+		if block["type"] != "text" || !ok {
+			return "", fmt.Errorf("only text blocks are supported")
+		}
+		text = append(text, s)
+	}
+	return strings.Join(text, "\n"), nil
+}
+
+// ErrorBody returns the body of an error response.
+func ErrorBody(status int, msg string) any {
+	typ := "api_error"
+	switch status {
+	case http.StatusBadRequest:
+		typ = "invalid_request_error"
+	case http.StatusUnauthorized:
+		typ = "authentication_error"
+	case http.StatusForbidden:
+		typ = "permission_error"
+	case http.StatusNotFound:
+		typ = "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		typ = "request_too_large"
+	case http.StatusTooManyRequests:
+		typ = "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		typ = "overloaded_error"
+	}
+	return map[string]any{"type": "error", "error": map[string]any{"type": typ, "message": msg}}
+}
@@ -0,0 +1,116 @@
+package anthropicapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// chatUsage is the usage of a chat completion.
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// chatToolCall is a tool call of a chat completion (or a delta of one).
+type chatToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// stopReasons map the finish reasons of chat completions to the stop reasons
+// of messages.
+var stopReasons = map[string]string{
+	"stop":       "end_turn",
+	"length":     "max_tokens",
+	"tool_calls": "tool_use",
+}
+
+func stopReason(finishReason string) string {
+	if r, ok := stopReasons[finishReason]; ok {
+		return r
+	}
+	return "end_turn"
+}
+
+// message returns a message object without content.
+func message(chatID string, model any) map[string]any {
+	if chatID == "" {
+		chatID = strings.ReplaceAll(uuid.NewString(), "-", "")
+	}
+	return map[string]any{
+		"id":            "msg_" + strings.TrimPrefix(chatID, "chatcmpl-"),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         model,
+		"content":       []any{},
+		"stop_reason":   nil,
+		"stop_sequence": nil,
+		"usage":         map[string]any{"input_tokens": 0, "output_tokens": 0},
+	}
+}
+
+// toolInput returns the input object of the arguments of a tool call.
+func toolInput(arguments string) any {
+	var input any = map[string]any{}
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &input); err != nil {
+			// Models may generate invalid JSON.
+			return map[string]any{}
+		}
+	}
+	return input
+}
+
+// FromChatCompletion returns the body of the response to a Messages API
+// request from the body of the chat completion that served it.
+func FromChatCompletion(params map[string]any, body []byte) ([]byte, error) {
+	var chat struct {
+		ID      string `json:"id"`
+		Model   any    `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content   string         `json:"content"`
+				ToolCalls []chatToolCall `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage chatUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return nil, fmt.Errorf("decoding chat completion: %w", err)
+	}
+	if len(chat.Choices) == 0 {
+		return nil, fmt.Errorf("chat completion has no choices")
+	}
+	if chat.Model == nil {
+		chat.Model = params["model"]
+	}
+
+	msg := message(chat.ID, chat.Model)
+	choice := chat.Choices[0]
+	var content []any
+	if choice.Message.Content != "" {
+		content = append(content, map[string]any{"type": "text", "text": choice.Message.Content})
+	}
+	for _, tc := range choice.Message.ToolCalls {
+		content = append(content, map[string]any{
+			"type":  "tool_use",
+			"id":    tc.ID,
+			"name":  tc.Function.Name,
+			"input": toolInput(tc.Function.Arguments),
+		})
+	}
+	if content != nil {
+		msg["content"] = content
+	}
+	msg["stop_reason"] = stopReason(choice.FinishReason)
+	msg["usage"] = map[string]any{"input_tokens": chat.Usage.PromptTokens, "output_tokens": chat.Usage.CompletionTokens}
+	return json.Marshal(msg)
+}
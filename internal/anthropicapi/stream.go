@@ -0,0 +1,185 @@
+package anthropicapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+// NewStream returns the streamed events of the response to a Messages API
+// request from the server-sent events of the chat completion that serves it.
+func NewStream(params map[string]any, chat io.ReadCloser) io.ReadCloser {
+	return &stream{params: params, body: chat, r: bufio.NewReader(chat)}
+}
+
+type stream struct {
+	params map[string]any
+	body   io.ReadCloser
+	r      *bufio.Reader
+
+	started bool
+	// block is the index of the current content block, -1 if there is none.
+	block int
+	// blocks is the number of content blocks that were started.
+	blocks int
+	// tool is the index of the tool call of the current content block, -1
+	// if it is a text block.
+	tool         int
+	finishReason string
+	usage        *chatUsage
+
+	// out are the events that have not been read by the client.
+	out  bytes.Buffer
+	done bool
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	for s.out.Len() == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	return s.out.Read(p)
+}
+
+func (s *stream) Close() error {
+	return s.body.Close()
+}
+
+// next translates the next chat completion event.
+func (s *stream) next() error {
+	data, err := apiutils.ReadEventData(s.r)
+	if errors.Is(err, io.EOF) || string(data) == "[DONE]" {
+		s.finish()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.chunk(data)
+	return nil
+}
+
+// chunk translates a chat completion chunk.
+func (s *stream) chunk(data []byte) {
+	var chunk struct {
+		ID      string `json:"id"`
+		Model   any    `json:"model"`
+		Choices []struct {
+			Delta struct {
+				Content   string         `json:"content"`
+				ToolCalls []chatToolCall `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *chatUsage `json:"usage"`
+		Error any        `json:"error"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		s.fail(fmt.Sprintf("decoding chat completion chunk: %v", err))
+		return
+	}
+	if chunk.Error != nil {
+		msg, _ := json.Marshal(chunk.Error)
+		if e, ok := chunk.Error.(map[string]any); ok {
+			if m, ok := e["message"].(string); ok {
+				msg = []byte(m)
+			}
+		}
+		s.fail(string(msg))
+		return
+	}
+
+	if !s.started {
+		s.started = true
+		s.block = -1
+		model := chunk.Model
+		if model == nil {
+			model = s.params["model"]
+		}
+		s.emit("message_start", map[string]any{"message": message(chunk.ID, model)})
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+	choice := chunk.Choices[0]
+	if choice.FinishReason != "" {
+		s.finishReason = choice.FinishReason
+	}
+	if choice.Delta.Content != "" {
+		if s.block == -1 || s.tool != -1 {
+			s.startBlock(-1, map[string]any{"type": "text", "text": ""})
+		}
+		s.emit("content_block_delta", map[string]any{"index": s.block, "delta": map[string]any{"type": "text_delta", "text": choice.Delta.Content}})
+	}
+	for _, tc := range choice.Delta.ToolCalls {
+		if s.block == -1 || s.tool != tc.Index {
+			s.startBlock(tc.Index, map[string]any{"type": "tool_use", "id": tc.ID, "name": tc.Function.Name, "input": map[string]any{}})
+		}
+		if tc.Function.Arguments != "" {
+			s.emit("content_block_delta", map[string]any{"index": s.block, "delta": map[string]any{"type": "input_json_delta", "partial_json": tc.Function.Arguments}})
+		}
+	}
+}
+
+// startBlock stops the current content block and starts a new one.
+func (s *stream) startBlock(tool int, block map[string]any) {
+	s.stopBlock()
+	s.block = s.blocks
+	s.blocks++
+	s.tool = tool
+	s.emit("content_block_start", map[string]any{"index": s.block, "content_block": block})
+}
+
+func (s *stream) stopBlock() {
+	if s.block != -1 {
+		s.emit("content_block_stop", map[string]any{"index": s.block})
+		s.block = -1
+	}
+}
+
+// finish stops the current content block and the message.
+func (s *stream) finish() {
+	s.done = true
+	if !s.started {
+		s.fail("the model server ended the stream without a chunk")
+		return
+	}
+	s.stopBlock()
+	usage := map[string]any{"output_tokens": 0}
+	if s.usage != nil {
+		usage = map[string]any{"input_tokens": s.usage.PromptTokens, "output_tokens": s.usage.CompletionTokens}
+	}
+	s.emit("message_delta", map[string]any{
+		"delta": map[string]any{"stop_reason": stopReason(s.finishReason), "stop_sequence": nil},
+		"usage": usage,
+	})
+	s.emit("message_stop", map[string]any{})
+}
+
+// fail ends the stream with an error event.
+func (s *stream) fail(msg string) {
+	s.done = true
+	s.emit("error", map[string]any{"error": map[string]any{"type": "api_error", "message": msg}})
+}
+
+func (s *stream) emit(typ string, fields map[string]any) {
+	fields["type"] = typ
+	data, err := json.Marshal(fields)
+	if err != nil {
+		// The fields are always encodable.
+		panic(err)
+	}
+	fmt.Fprintf(&s.out, "event: %s\ndata: %s\n\n", typ, data)
+}
@@ -0,0 +1,82 @@
+package apiutils
+
+import (
+	"fmt"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+)
+
+// CheckCapabilities checks the params of a completion or chat completion
+// request against the capabilities of a Model (see Model.status.capabilities)
+// and returns an error that tells the client why the model can not serve the
+// request. Capabilities that were not discovered are not checked.
+func CheckCapabilities(params map[string]any, caps *kubeaiv1.ModelStatusCapabilities) error {
+	if caps == nil || params == nil {
+		return nil
+	}
+
+	if caps.MaxContextLength != nil {
+		maxLen := *caps.MaxContextLength
+		maxTokens, ok := intParam(params, "max_completion_tokens")
+		if !ok {
+			maxTokens, _ = intParam(params, "max_tokens")
+		}
+		if maxTokens > maxLen {
+			return fmt.Errorf("max_tokens of %d exceeds the maximum context length of the model (%d tokens)", maxTokens, maxLen)
+		}
+		// Only prompts of token IDs can be counted without the tokenizer
+		// of the model.
+		if promptLen := tokenPromptLen(params["prompt"]); promptLen+maxTokens > maxLen {
+			return fmt.Errorf("prompt of %d tokens and max_tokens of %d exceed the maximum context length of the model (%d tokens)", promptLen, maxTokens, maxLen)
+		}
+	}
+
+	if caps.Vision != nil && !*caps.Vision && hasImageContent(params) {
+		return fmt.Errorf("the model does not accept images")
+	}
+
+	return nil
+}
+
+func intParam(params map[string]any, key string) (int64, bool) {
+	// JSON numbers are decoded as float64.
+	v, ok := params[key].(float64)
+	return int64(v), ok
+}
+
+// tokenPromptLen returns the number of tokens of a prompt of token IDs (the
+// longest prompt for a batch of prompts), or 0 for text prompts.
+func tokenPromptLen(prompt any) int64 {
+	tokens, ok := prompt.([]any)
+	if !ok || len(tokens) == 0 {
+		return 0
+	}
+	switch tokens[0].(type) {
+	case float64:
+		return int64(len(tokens))
+	case []any:
+		var longest int64
+		for _, t := range tokens {
+			longest = max(longest, tokenPromptLen(t))
+		}
+		return longest
+	}
+	return 0
+}
+
+// hasImageContent returns true if any message of a chat completion request
+// has an image content part.
+func hasImageContent(params map[string]any) bool {
+	messages, _ := params["messages"].([]any)
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		parts, _ := msg["content"].([]any)
+		for _, p := range parts {
+			part, _ := p.(map[string]any)
+			if part["type"] == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
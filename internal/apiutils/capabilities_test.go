@@ -0,0 +1,76 @@
+package apiutils_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"k8s.io/utils/ptr"
+)
+
+func TestCheckCapabilities(t *testing.T) {
+	t.Parallel()
+
+	caps := &kubeaiv1.ModelStatusCapabilities{
+		MaxContextLength: ptr.To[int64](10),
+		Vision:           ptr.To(false),
+	}
+	cases := map[string]struct {
+		capabilities *kubeaiv1.ModelStatusCapabilities
+		params       string
+		expErr       string
+	}{
+		"not discovered": {
+			params: `{"max_tokens":100,"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"x"}}]}]}`,
+		},
+		"within context length": {
+			capabilities: caps,
+			params:       `{"max_tokens":10,"prompt":"a long text prompt"}`,
+		},
+		"max_tokens exceeds context length": {
+			capabilities: caps,
+			params:       `{"max_tokens":11}`,
+			expErr:       "max_tokens of 11 exceeds the maximum context length of the model (10 tokens)",
+		},
+		"max_completion_tokens exceeds context length": {
+			capabilities: caps,
+			params:       `{"max_completion_tokens":11,"max_tokens":1}`,
+			expErr:       "max_tokens of 11 exceeds the maximum context length of the model (10 tokens)",
+		},
+		"token prompt exceeds context length": {
+			capabilities: caps,
+			params:       `{"max_tokens":5,"prompt":[1,2,3,4,5,6]}`,
+			expErr:       "prompt of 6 tokens and max_tokens of 5 exceed the maximum context length of the model (10 tokens)",
+		},
+		"batch of token prompts exceeds context length": {
+			capabilities: caps,
+			params:       `{"prompt":[[1,2],[1,2,3,4,5,6,7,8,9,10,11]]}`,
+			expErr:       "prompt of 11 tokens and max_tokens of 0 exceed the maximum context length of the model (10 tokens)",
+		},
+		"image without vision": {
+			capabilities: caps,
+			params:       `{"messages":[{"role":"user","content":[{"type":"text","text":"a"},{"type":"image_url","image_url":{"url":"x"}}]}]}`,
+			expErr:       "the model does not accept images",
+		},
+		"image with vision": {
+			capabilities: &kubeaiv1.ModelStatusCapabilities{Vision: ptr.To(true)},
+			params:       `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"x"}}]}]}`,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var params map[string]any
+			require.NoError(t, json.Unmarshal([]byte(c.params), &params))
+			err := apiutils.CheckCapabilities(params, c.capabilities)
+			if c.expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, c.expErr)
+		})
+	}
+}
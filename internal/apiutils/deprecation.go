@@ -0,0 +1,21 @@
+package apiutils
+
+import (
+	"net/http"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+)
+
+// SetDeprecationHeaders sets the Deprecation and Sunset (RFC 8594) headers
+// of a response for a deprecated Model and returns whether the Model is
+// deprecated.
+func SetDeprecationHeaders(h http.Header, d *kubeaiv1.ModelDeprecation) bool {
+	if d == nil || !d.Deprecated {
+		return false
+	}
+	h.Set("Deprecation", "true")
+	if d.SunsetDate != nil {
+		h.Set("Sunset", d.SunsetDate.UTC().Format(http.TimeFormat))
+	}
+	return true
+}
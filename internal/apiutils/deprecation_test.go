@@ -0,0 +1,52 @@
+package apiutils_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/apiutils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetDeprecationHeaders(t *testing.T) {
+	t.Parallel()
+
+	sunset := metav1.NewTime(time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC))
+	cases := map[string]struct {
+		deprecation   *kubeaiv1.ModelDeprecation
+		expDeprecated bool
+		expHeaders    http.Header
+	}{
+		"not deprecated": {
+			expHeaders: http.Header{},
+		},
+		"sunset date without deprecation": {
+			deprecation: &kubeaiv1.ModelDeprecation{SunsetDate: &sunset},
+			expHeaders:  http.Header{},
+		},
+		"deprecated": {
+			deprecation:   &kubeaiv1.ModelDeprecation{Deprecated: true, ReplacementModel: "llama-3.3-70b"},
+			expDeprecated: true,
+			expHeaders:    http.Header{"Deprecation": {"true"}},
+		},
+		"deprecated with sunset date": {
+			deprecation:   &kubeaiv1.ModelDeprecation{Deprecated: true, SunsetDate: &sunset},
+			expDeprecated: true,
+			expHeaders: http.Header{
+				"Deprecation": {"true"},
+				"Sunset":      {"Mon, 30 Jun 2025 00:00:00 GMT"},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			h := http.Header{}
+			require.Equal(t, c.expDeprecated, apiutils.SetDeprecationHeaders(h, c.deprecation))
+			require.Equal(t, c.expHeaders, h)
+		})
+	}
+}
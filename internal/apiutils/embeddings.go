@@ -0,0 +1,114 @@
+package apiutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+)
+
+// EmbeddingsPath is the path of embeddings requests.
+const EmbeddingsPath = "/v1/embeddings"
+
+// EmbeddingInputs returns the inputs of an embeddings request if they are
+// text inputs, which can be coalesced with the inputs of other requests
+// (unlike token arrays).
+func EmbeddingInputs(params map[string]any) ([]any, bool) {
+	switch input := params["input"].(type) {
+	case string:
+		return []any{input}, true
+	case []any:
+		if len(input) == 0 {
+			return nil, false
+		}
+		for _, v := range input {
+			if _, ok := v.(string); !ok {
+				return nil, false
+			}
+		}
+		return input, true
+	}
+	return nil, false
+}
+
+// SplitEmbeddingResponse splits the response to a coalesced embeddings
+// request into the responses of the coalesced requests, which had the given
+// numbers of inputs. Token counts of the usage are divided by the number
+// of inputs, the parts add up to the token counts of the response.
+func SplitEmbeddingResponse(body []byte, counts []int) ([][]byte, error) {
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	var data []map[string]json.RawMessage
+	if err := json.Unmarshal(resp["data"], &data); err != nil {
+		return nil, fmt.Errorf("decoding data: %w", err)
+	}
+	var total int
+	for _, n := range counts {
+		total += n
+	}
+	if len(data) != total {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", total, len(data))
+	}
+	indexes := make([]int, len(data))
+	for i, d := range data {
+		if err := json.Unmarshal(d["index"], &indexes[i]); err != nil {
+			return nil, fmt.Errorf("decoding index of embedding %d: %w", i, err)
+		}
+	}
+	// Model servers may return the embeddings in any order.
+	sort.Sort(byIndex{data, indexes})
+
+	var usage map[string]json.RawMessage
+	if raw, ok := resp["usage"]; ok {
+		if err := json.Unmarshal(raw, &usage); err != nil {
+			return nil, fmt.Errorf("decoding usage: %w", err)
+		}
+	}
+
+	bodies := make([][]byte, len(counts))
+	offset := 0
+	for i, n := range counts {
+		prevOffset := offset
+		offset += n
+		part := data[prevOffset:offset]
+		for j, d := range part {
+			d["index"] = json.RawMessage(fmt.Sprint(j))
+		}
+		out := maps.Clone(resp)
+		out["data"], _ = json.Marshal(part)
+		if usage != nil {
+			partUsage := maps.Clone(usage)
+			for k, v := range usage {
+				// Token counts are divided, other fields are kept. The
+				// parts are the differences of the shares of the inputs up
+				// to and before the request so that the rounding remainder
+				// is not lost.
+				var tokens int
+				if json.Unmarshal(v, &tokens) == nil {
+					partUsage[k] = json.RawMessage(fmt.Sprint(tokens*offset/total - tokens*prevOffset/total))
+				}
+			}
+			out["usage"], _ = json.Marshal(partUsage)
+		}
+		var err error
+		if bodies[i], err = json.Marshal(out); err != nil {
+			return nil, fmt.Errorf("encoding response: %w", err)
+		}
+	}
+	return bodies, nil
+}
+
+// byIndex sorts embeddings by their index.
+type byIndex struct {
+	data    []map[string]json.RawMessage
+	indexes []int
+}
+
+func (s byIndex) Len() int           { return len(s.data) }
+func (s byIndex) Less(i, j int) bool { return s.indexes[i] < s.indexes[j] }
+func (s byIndex) Swap(i, j int) {
+	s.data[i], s.data[j] = s.data[j], s.data[i]
+	s.indexes[i], s.indexes[j] = s.indexes[j], s.indexes[i]
+}
@@ -0,0 +1,26 @@
+package apiutils_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+func TestSplitEmbeddingResponse(t *testing.T) {
+	_, err := apiutils.SplitEmbeddingResponse([]byte(`{"data":[{"index":0}]}`), []int{1, 1})
+	require.ErrorContains(t, err, "expected 2 embeddings, got 1")
+
+	bodies, err := apiutils.SplitEmbeddingResponse([]byte(`{"data":[{"index":1,"embedding":"b"},{"index":0,"embedding":"a"}]}`), []int{1, 1})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"data":[{"index":0,"embedding":"a"}]}`, string(bodies[0]))
+	require.JSONEq(t, `{"data":[{"index":0,"embedding":"b"}]}`, string(bodies[1]))
+
+	// Token counts that are not divisible by the number of inputs still add
+	// up to the total.
+	bodies, err = apiutils.SplitEmbeddingResponse([]byte(`{"data":[{"index":0},{"index":1},{"index":2}],"usage":{"prompt_tokens":10,"total_tokens":10}}`), []int{1, 1, 1})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"data":[{"index":0}],"usage":{"prompt_tokens":3,"total_tokens":3}}`, string(bodies[0]))
+	require.JSONEq(t, `{"data":[{"index":0}],"usage":{"prompt_tokens":3,"total_tokens":3}}`, string(bodies[1]))
+	require.JSONEq(t, `{"data":[{"index":0}],"usage":{"prompt_tokens":4,"total_tokens":4}}`, string(bodies[2]))
+}
@@ -0,0 +1,34 @@
+package apiutils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ReadEventData reads the next server-sent event and returns its data (the
+// joined "data:" lines). Events without data (i.e. comments) are skipped.
+// It returns io.EOF after the last event.
+func ReadEventData(r *bufio.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+		if d, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(d, []byte(" "))...)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) && data != nil {
+				return data, nil
+			}
+			return nil, err
+		}
+		if len(line) == 0 && data != nil {
+			return data, nil
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package apiutils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// responseFormatSchemaURL identifies the schema of a response format. It is
+// never loaded, the schema is added to the compiler as a resource.
+const responseFormatSchemaURL = "urn:kubeai:response-format"
+
+// maxSchemaSize limits the number of schemas that a JSON schema expands to
+// when its $refs are followed (i.e. chains of $defs that each reference the
+// next one twice), which bounds the cost of validating values against it.
+const maxSchemaSize = 10000
+
+// CompileJSONSchema compiles the JSON schema of a response format. Schemas
+// without $schema are compiled as draft 2020-12. Only $refs within the
+// schema are resolved (refs to files or URLs fail to compile) and formats
+// are not asserted.
+func CompileJSONSchema(schema map[string]any) (*jsonschema.Schema, error) {
+	if n := expandedSize(schema, schema, map[string]int{}, 0); n > maxSchemaSize {
+		return nil, fmt.Errorf("schema expands to more than %d schemas", maxSchemaSize)
+	}
+	c := jsonschema.NewCompiler()
+	c.DefaultDraft(jsonschema.Draft2020)
+	// The default loader reads local files.
+	c.UseLoader(jsonschema.SchemeURLLoader{})
+	if err := c.AddResource(responseFormatSchemaURL, schema); err != nil {
+		return nil, err
+	}
+	return c.Compile(responseFormatSchemaURL)
+}
+
+// ValidateJSONSchema validates a decoded JSON value against a compiled JSON
+// schema.
+func ValidateJSONSchema(schema *jsonschema.Schema, value any) error {
+	return schema.Validate(value)
+}
+
+// expandedSize returns the number of JSON objects in a value of a schema
+// plus the sizes of the local $refs in it, up to maxSchemaSize. The sizes of
+// ref targets are cached by ref. Recursive refs count once, their expansion
+// is bounded by the depth of the validated value.
+func expandedSize(root map[string]any, v any, refs map[string]int, n int) int {
+	switch v := v.(type) {
+	case map[string]any:
+		n++
+		if ref, ok := v["$ref"].(string); ok {
+			n += refSize(root, ref, refs)
+		}
+		for _, child := range v {
+			if n > maxSchemaSize {
+				break
+			}
+			n = expandedSize(root, child, refs, n)
+		}
+	case []any:
+		for _, child := range v {
+			if n > maxSchemaSize {
+				break
+			}
+			n = expandedSize(root, child, refs, n)
+		}
+	}
+	return n
+}
+
+func refSize(root map[string]any, ref string, refs map[string]int) int {
+	if size, ok := refs[ref]; ok {
+		return size
+	}
+	// Recursive refs are visited while their size is computed.
+	refs[ref] = 1
+	target := resolveRef(root, ref)
+	if target == nil {
+		// Refs that can not be resolved fail to compile.
+		return 1
+	}
+	size := expandedSize(root, target, refs, 0)
+	refs[ref] = size
+	return size
+}
+
+// resolveRef resolves a JSON pointer ref to the root schema or a schema in
+// it, i.e. "#/$defs/name" (nil if it can not be resolved).
+func resolveRef(root map[string]any, ref string) any {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil
+	}
+	var target any = root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		obj, _ := target.(map[string]any)
+		if target, ok = obj[token]; !ok {
+			return nil
+		}
+	}
+	return target
+}
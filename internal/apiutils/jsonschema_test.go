@@ -0,0 +1,164 @@
+package apiutils_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+func TestValidateJSONSchema(t *testing.T) {
+	t.Parallel()
+
+	const schema = `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+			"age": {"type": "integer", "minimum": 0},
+			"role": {"enum": ["admin", "user"]},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"address": {"$ref": "#/$defs/address"},
+			"contact": {"anyOf": [{"type": "null"}, {"type": "string"}]},
+			"email": {"type": "string", "format": "email"}
+		},
+		"required": ["name"],
+		"additionalProperties": false,
+		"$defs": {
+			"address": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}
+		}
+	}`
+
+	cases := map[string]struct {
+		value  string
+		expErr string
+	}{
+		"valid": {
+			value: `{"name": "a", "age": 3, "role": "user", "tags": ["x"], "address": {"city": "c"}, "contact": null}`,
+		},
+		"formats are not asserted": {
+			value: `{"name": "a", "email": "not an email"}`,
+		},
+		"wrong type": {
+			value:  `["a"]`,
+			expErr: "got array, want object",
+		},
+		"missing required property": {
+			value:  `{"age": 3}`,
+			expErr: "missing property 'name'",
+		},
+		"additional property": {
+			value:  `{"name": "a", "nickname": "b"}`,
+			expErr: "additional properties 'nickname' not allowed",
+		},
+		"not an integer": {
+			value:  `{"name": "a", "age": 3.5}`,
+			expErr: "at '/age': got number, want integer",
+		},
+		"below minimum": {
+			value:  `{"name": "a", "age": -1}`,
+			expErr: "at '/age': minimum: got -1, want 0",
+		},
+		"not in enum": {
+			value:  `{"name": "a", "role": "root"}`,
+			expErr: "at '/role': value must be one of 'admin', 'user'",
+		},
+		"pattern": {
+			value:  `{"name": "A"}`,
+			expErr: "at '/name': 'A' does not match pattern '^[a-z]+$'",
+		},
+		"array item": {
+			value:  `{"name": "a", "tags": [1]}`,
+			expErr: "at '/tags/0': got number, want string",
+		},
+		"too many items": {
+			value:  `{"name": "a", "tags": ["x", "y", "z"]}`,
+			expErr: "at '/tags': maxItems: got 3, want 2",
+		},
+		"ref": {
+			value:  `{"name": "a", "address": {}}`,
+			expErr: "at '/address': missing property 'city'",
+		},
+		"anyOf": {
+			value:  `{"name": "a", "contact": 1}`,
+			expErr: "at '/contact': 'anyOf' failed",
+		},
+	}
+
+	var s map[string]any
+	require.NoError(t, json.Unmarshal([]byte(schema), &s))
+	compiled, err := apiutils.CompileJSONSchema(s)
+	require.NoError(t, err)
+	for name, spec := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var v any
+			require.NoError(t, json.Unmarshal([]byte(spec.value), &v))
+			err := apiutils.ValidateJSONSchema(compiled, v)
+			if spec.expErr != "" {
+				require.ErrorContains(t, err, spec.expErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCompileJSONSchema(t *testing.T) {
+	t.Parallel()
+
+	// Each definition references the next one twice, validating a value
+	// against the first one would take 2^n steps.
+	defs := map[string]any{"d30": map[string]any{"type": "string"}}
+	for i := 0; i < 30; i++ {
+		next := map[string]any{"$ref": fmt.Sprintf("#/$defs/d%d", i+1)}
+		defs[fmt.Sprintf("d%d", i)] = map[string]any{"anyOf": []any{next, next}}
+	}
+
+	cases := map[string]struct {
+		schema map[string]any
+		expErr string
+	}{
+		"recursive ref": {
+			schema: map[string]any{"type": "object", "properties": map[string]any{
+				"children": map[string]any{"type": "array", "items": map[string]any{"$ref": "#"}},
+			}},
+		},
+		"invalid keyword value": {
+			schema: map[string]any{"type": "objekt"},
+			expErr: "is not valid against metaschema",
+		},
+		"invalid pattern": {
+			schema: map[string]any{"type": "string", "pattern": "(?<=a)"},
+			expErr: "is not valid regex",
+		},
+		"unresolvable ref": {
+			schema: map[string]any{"$ref": "#/$defs/missing"},
+			expErr: "not found",
+		},
+		"file ref": {
+			schema: map[string]any{"$ref": "file:///etc/passwd"},
+			expErr: "no URLLoader registered",
+		},
+		"remote ref": {
+			schema: map[string]any{"$ref": "https://example.com/schema.json"},
+			expErr: "no URLLoader registered",
+		},
+		"exponential refs": {
+			schema: map[string]any{"$defs": defs, "$ref": "#/$defs/d0"},
+			expErr: "schema expands to more than 10000 schemas",
+		},
+	}
+	for name, spec := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := apiutils.CompileJSONSchema(spec.schema)
+			if spec.expErr != "" {
+				require.ErrorContains(t, err, spec.expErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
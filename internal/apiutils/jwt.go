@@ -0,0 +1,32 @@
+package apiutils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// BearerTokenClaims returns the claims from the payload of a JWT bearer token
+// without verifying the token. An empty (non-nil) map is returned if the
+// token can not be parsed.
+func BearerTokenClaims(authorization string) map[string]any {
+	claims := map[string]any{}
+
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return claims
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims
+	}
+	// Ignore errors, partially decoded claims are not used.
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return map[string]any{}
+	}
+	return claims
+}
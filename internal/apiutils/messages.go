@@ -0,0 +1,86 @@
+package apiutils
+
+import (
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+)
+
+// NormalizeChatMessages applies the fixes of a Model to the "messages" of
+// a chat completion request body and returns true if they were changed.
+func NormalizeChatMessages(params map[string]any, n *kubeaiv1.ChatMessageNormalization) bool {
+	if n == nil {
+		return false
+	}
+	messages, ok := params["messages"].([]any)
+	if !ok {
+		return false
+	}
+
+	var changed bool
+	if n.SystemToUser {
+		for _, m := range messages {
+			msg, ok := m.(map[string]any)
+			if !ok {
+				continue
+			}
+			if role := msg["role"]; role == "system" || role == "developer" {
+				msg["role"] = "user"
+				changed = true
+			}
+		}
+	}
+
+	if n.MergeConsecutiveRoles {
+		merged := make([]any, 0, len(messages))
+		for _, m := range messages {
+			if len(merged) > 0 {
+				prev, prevOK := merged[len(merged)-1].(map[string]any)
+				msg, msgOK := m.(map[string]any)
+				if prevOK && msgOK && mergeable(prev) && mergeable(msg) && prev["role"] == msg["role"] {
+					merged[len(merged)-1] = map[string]any{
+						"role":    prev["role"],
+						"content": mergeContent(prev["content"], msg["content"]),
+					}
+					changed = true
+					continue
+				}
+			}
+			merged = append(merged, m)
+		}
+		params["messages"] = merged
+	}
+
+	return changed
+}
+
+// mergeable returns true if a message only has a role and content.
+func mergeable(msg map[string]any) bool {
+	for k := range msg {
+		if k != "role" && k != "content" {
+			return false
+		}
+	}
+	_, ok := msg["role"].(string)
+	return ok
+}
+
+// mergeContent concatenates the content of two messages. Text content is
+// separated by a blank line. If either content is a list of content parts,
+// the result is a list of content parts.
+func mergeContent(a, b any) any {
+	as, aText := a.(string)
+	bs, bText := b.(string)
+	if aText && bText {
+		return as + "\n\n" + bs
+	}
+	return append(contentParts(a), contentParts(b)...)
+}
+
+func contentParts(content any) []any {
+	switch c := content.(type) {
+	case string:
+		return []any{map[string]any{"type": "text", "text": c}}
+	case []any:
+		return c
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package apiutils_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+func TestNormalizeChatMessages(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		normalization *kubeaiv1.ChatMessageNormalization
+		messages      string
+		expMessages   string
+		expChanged    bool
+	}{
+		"no normalization": {
+			messages:    `[{"role":"system","content":"a"}]`,
+			expMessages: `[{"role":"system","content":"a"}]`,
+		},
+		"system to user": {
+			normalization: &kubeaiv1.ChatMessageNormalization{SystemToUser: true},
+			messages:      `[{"role":"system","content":"a"},{"role":"developer","content":"b"},{"role":"user","content":"c"}]`,
+			expMessages:   `[{"role":"user","content":"a"},{"role":"user","content":"b"},{"role":"user","content":"c"}]`,
+			expChanged:    true,
+		},
+		"system merged into user": {
+			normalization: &kubeaiv1.ChatMessageNormalization{SystemToUser: true, MergeConsecutiveRoles: true},
+			messages:      `[{"role":"system","content":"a"},{"role":"user","content":"b"},{"role":"assistant","content":"c"}]`,
+			expMessages:   `[{"role":"user","content":"a\n\nb"},{"role":"assistant","content":"c"}]`,
+			expChanged:    true,
+		},
+		"merge content parts": {
+			normalization: &kubeaiv1.ChatMessageNormalization{MergeConsecutiveRoles: true},
+			messages:      `[{"role":"user","content":"a"},{"role":"user","content":[{"type":"image_url","image_url":{"url":"x"}}]}]`,
+			expMessages:   `[{"role":"user","content":[{"type":"text","text":"a"},{"type":"image_url","image_url":{"url":"x"}}]}]`,
+			expChanged:    true,
+		},
+		"tool calls are not merged": {
+			normalization: &kubeaiv1.ChatMessageNormalization{MergeConsecutiveRoles: true},
+			messages:      `[{"role":"assistant","content":"a"},{"role":"assistant","content":null,"tool_calls":[]}]`,
+			expMessages:   `[{"role":"assistant","content":"a"},{"role":"assistant","content":null,"tool_calls":[]}]`,
+		},
+		"alternating roles": {
+			normalization: &kubeaiv1.ChatMessageNormalization{SystemToUser: true, MergeConsecutiveRoles: true},
+			messages:      `[{"role":"user","content":"a"},{"role":"assistant","content":"b"}]`,
+			expMessages:   `[{"role":"user","content":"a"},{"role":"assistant","content":"b"}]`,
+		},
+	}
+
+	for name, spec := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var messages any
+			require.NoError(t, json.Unmarshal([]byte(spec.messages), &messages))
+			params := map[string]any{"model": "my-model", "messages": messages}
+
+			changed := apiutils.NormalizeChatMessages(params, spec.normalization)
+			require.Equal(t, spec.expChanged, changed)
+			got, err := json.Marshal(params["messages"])
+			require.NoError(t, err)
+			require.JSONEq(t, spec.expMessages, string(got))
+		})
+	}
+
+	// Requests without messages are not changed.
+	params := map[string]any{"prompt": "a"}
+	require.False(t, apiutils.NormalizeChatMessages(params, &kubeaiv1.ChatMessageNormalization{SystemToUser: true}))
+	require.Equal(t, map[string]any{"prompt": "a"}, params)
+}
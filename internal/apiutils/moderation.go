@@ -0,0 +1,202 @@
+package apiutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ModerationsPath is the path of moderation requests.
+const ModerationsPath = "/v1/moderations"
+
+// moderationCategories are the categories of the OpenAI moderation API.
+var moderationCategories = []string{
+	"harassment",
+	"harassment/threatening",
+	"hate",
+	"hate/threatening",
+	"illicit",
+	"illicit/violent",
+	"self-harm",
+	"self-harm/intent",
+	"self-harm/instructions",
+	"sexual",
+	"sexual/minors",
+	"violence",
+	"violence/graphic",
+}
+
+// hazardCategories map the hazard categories of the MLCommons taxonomy that
+// Llama Guard classifies content with to the categories of the OpenAI API.
+// Hazards without an OpenAI category (i.e. "S6" for specialized advice)
+// flag content without a category.
+var hazardCategories = map[string]string{
+	"S1":  "violence",
+	"S2":  "illicit",
+	"S3":  "sexual",
+	"S4":  "sexual/minors",
+	"S5":  "harassment",
+	"S9":  "illicit/violent",
+	"S10": "hate",
+	"S11": "self-harm",
+	"S12": "sexual",
+}
+
+// ModerationResult is the classification of an input of a moderation request.
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// FlaggedCategories returns the sorted categories that the input was
+// flagged for.
+func (r ModerationResult) FlaggedCategories() []string {
+	var flagged []string
+	for _, c := range moderationCategories {
+		if r.Categories[c] {
+			flagged = append(flagged, c)
+		}
+	}
+	return flagged
+}
+
+// ModerationInputs returns the text inputs of a moderation request.
+func ModerationInputs(params map[string]any) ([]string, error) {
+	switch input := params["input"].(type) {
+	case string:
+		return []string{input}, nil
+	case []any:
+		if len(input) == 0 {
+			break
+		}
+		inputs := make([]string, len(input))
+		for i, v := range input {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("input must be a string or an array of strings (images are not supported)")
+			}
+			inputs[i] = s
+		}
+		return inputs, nil
+	}
+	return nil, fmt.Errorf("input must be a string or an array of strings (images are not supported)")
+}
+
+// ModerationChatParams returns the params of the chat completion request
+// that classifies an input with a Moderation Model.
+func ModerationChatParams(model any, input string) map[string]any {
+	return map[string]any{
+		"model": model,
+		"messages": []any{
+			map[string]any{"role": "user", "content": input},
+		},
+		"max_tokens":  20,
+		"temperature": 0,
+	}
+}
+
+// ParseModerationCompletion returns the classification of an input from the
+// chat completion response of a Moderation Model, which is "safe" or "unsafe"
+// followed by a line with the comma-separated hazard categories (i.e.
+// "unsafe\nS1,S10").
+func ParseModerationCompletion(body []byte) (ModerationResult, error) {
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return ModerationResult{}, fmt.Errorf("decoding chat completion: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return ModerationResult{}, fmt.Errorf("chat completion has no choices")
+	}
+
+	result := ModerationResult{
+		Categories:     make(map[string]bool, len(moderationCategories)),
+		CategoryScores: make(map[string]float64, len(moderationCategories)),
+	}
+	for _, c := range moderationCategories {
+		result.Categories[c] = false
+		result.CategoryScores[c] = 0
+	}
+	verdict, hazards, _ := strings.Cut(strings.TrimSpace(resp.Choices[0].Message.Content), "\n")
+	if strings.TrimSpace(verdict) != "unsafe" {
+		return result, nil
+	}
+	result.Flagged = true
+	for _, h := range strings.Split(hazards, ",") {
+		if c, ok := hazardCategories[strings.TrimSpace(h)]; ok {
+			result.Categories[c] = true
+			result.CategoryScores[c] = 1
+		}
+	}
+	return result, nil
+}
+
+// ModerationResponse returns the body of the response to a moderation request.
+func ModerationResponse(id, model string, results []ModerationResult) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"id":      "modr-" + id,
+		"model":   model,
+		"results": results,
+	})
+}
+
+// ParseModerationResponse returns the results of the response to a
+// moderation request.
+func ParseModerationResponse(body []byte) ([]ModerationResult, error) {
+	var resp struct {
+		Results []ModerationResult `json:"results"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decoding moderation response: %w", err)
+	}
+	return resp.Results, nil
+}
+
+// ModerationText returns the text of a completion or chat completion request
+// that is moderated by a safety policy: the prompts (and suffix) or the text
+// of the messages of all roles. Requests with prompts that are not text (i.e.
+// token IDs) can not be moderated and return an error.
+func ModerationText(params map[string]any) (string, error) {
+	var texts []string
+	switch prompt := params["prompt"].(type) {
+	case nil:
+	case string:
+		texts = append(texts, prompt)
+	case []any:
+		for _, p := range prompt {
+			s, ok := p.(string)
+			if !ok {
+				return "", fmt.Errorf("prompts that are not text can not be moderated")
+			}
+			texts = append(texts, s)
+		}
+	default:
+		return "", fmt.Errorf("prompts that are not text can not be moderated")
+	}
+	if suffix, ok := params["suffix"].(string); ok {
+		texts = append(texts, suffix)
+	}
+
+	messages, _ := params["messages"].([]any)
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		switch content := msg["content"].(type) {
+		case string:
+			texts = append(texts, content)
+		case []any:
+			for _, p := range content {
+				part, _ := p.(map[string]any)
+				if text, ok := part["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
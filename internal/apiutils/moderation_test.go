@@ -0,0 +1,78 @@
+package apiutils_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+func TestParseModerationCompletion(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		content       string
+		expFlagged    bool
+		expCategories []string
+	}{
+		"safe": {
+			content: "safe",
+		},
+		"unsafe": {
+			content:       "\n\nunsafe\nS1,S10",
+			expFlagged:    true,
+			expCategories: []string{"hate", "violence"},
+		},
+		"unsafe without an OpenAI category": {
+			content:    "unsafe\nS6",
+			expFlagged: true,
+		},
+	}
+
+	for name, spec := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			body, err := json.Marshal(map[string]any{
+				"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": spec.content}}},
+			})
+			require.NoError(t, err)
+			result, err := apiutils.ParseModerationCompletion(body)
+			require.NoError(t, err)
+			require.Equal(t, spec.expFlagged, result.Flagged)
+			require.Equal(t, spec.expCategories, result.FlaggedCategories())
+			require.Len(t, result.Categories, 13)
+		})
+	}
+
+	_, err := apiutils.ParseModerationCompletion([]byte(`{"choices":[]}`))
+	require.EqualError(t, err, "chat completion has no choices")
+}
+
+func TestModerationText(t *testing.T) {
+	t.Parallel()
+
+	var params map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{"messages":[
+		{"role":"system","content":"Be helpful."},
+		{"role":"developer","content":[{"type":"text","text":"Be brief."}]},
+		{"role":"user","content":"a"},
+		{"role":"assistant","content":"b"},
+		{"role":"tool","tool_call_id":"1","content":"t"},
+		{"role":"user","content":[{"type":"text","text":"c"},{"type":"image_url","image_url":{"url":"x"}}]}
+	]}`), &params))
+	text, err := apiutils.ModerationText(params)
+	require.NoError(t, err)
+	require.Equal(t, "Be helpful.\nBe brief.\na\nb\nt\nc", text)
+
+	text, err = apiutils.ModerationText(map[string]any{"prompt": "d"})
+	require.NoError(t, err)
+	require.Equal(t, "d", text)
+	text, err = apiutils.ModerationText(map[string]any{"prompt": []any{"d", "e"}, "suffix": "f"})
+	require.NoError(t, err)
+	require.Equal(t, "d\ne\nf", text)
+	_, err = apiutils.ModerationText(map[string]any{"prompt": []any{1.0, 2.0}})
+	require.Error(t, err)
+	_, err = apiutils.ModerationText(map[string]any{"prompt": []any{[]any{1.0}}})
+	require.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package apiutils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// SpeechPath is the path of text-to-speech requests.
+const SpeechPath = "/v1/audio/speech"
+
+// maxSpeechInputLength is the maximum number of characters of the input of
+// a text-to-speech request (as in the OpenAI API).
+const maxSpeechInputLength = 4096
+
+// speechResponseFormats are the audio formats of the OpenAI API.
+var speechResponseFormats = []string{"mp3", "opus", "aac", "flac", "wav", "pcm"}
+
+// CheckSpeechParams validates the params of a text-to-speech request and
+// returns an error that tells the client what is wrong with the request.
+func CheckSpeechParams(params map[string]any) error {
+	if params == nil {
+		return fmt.Errorf("the request body must be JSON")
+	}
+	input, ok := params["input"].(string)
+	if !ok || strings.TrimSpace(input) == "" {
+		return fmt.Errorf("input must be a non-empty string")
+	}
+	if n := utf8.RuneCountInString(input); n > maxSpeechInputLength {
+		return fmt.Errorf("input of %d characters exceeds the maximum of %d characters", n, maxSpeechInputLength)
+	}
+	if v, ok := params["voice"]; ok {
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("voice must be a string")
+		}
+	}
+	if v, ok := params["response_format"]; ok {
+		format, _ := v.(string)
+		if !slices.Contains(speechResponseFormats, format) {
+			return fmt.Errorf("response_format must be one of %s", strings.Join(speechResponseFormats, ", "))
+		}
+	}
+	if v, ok := params["speed"]; ok {
+		speed, ok := v.(float64)
+		if !ok || speed < 0.25 || speed > 4 {
+			return fmt.Errorf("speed must be a number between 0.25 and 4.0")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package apiutils_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+func TestCheckSpeechParams(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		params string
+		expErr string
+	}{
+		"valid": {
+			params: `{"model":"piper","input":"Hello world!","voice":"alloy","response_format":"wav","speed":1.5}`,
+		},
+		"missing input": {
+			params: `{"model":"piper"}`,
+			expErr: "input must be a non-empty string",
+		},
+		"blank input": {
+			params: `{"model":"piper","input":"  "}`,
+			expErr: "input must be a non-empty string",
+		},
+		"unsupported format": {
+			params: `{"model":"piper","input":"hi","response_format":"ogg"}`,
+			expErr: "response_format must be one of mp3, opus, aac, flac, wav, pcm",
+		},
+		"speed out of range": {
+			params: `{"model":"piper","input":"hi","speed":5}`,
+			expErr: "speed must be a number between 0.25 and 4.0",
+		},
+		"voice not a string": {
+			params: `{"model":"piper","input":"hi","voice":{"id":"x"}}`,
+			expErr: "voice must be a string",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var params map[string]any
+			require.NoError(t, json.Unmarshal([]byte(c.params), &params))
+			err := apiutils.CheckSpeechParams(params)
+			if c.expErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, c.expErr)
+			}
+		})
+	}
+}
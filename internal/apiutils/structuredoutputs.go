@@ -0,0 +1,161 @@
+package apiutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// ResponseFormatSchema returns the JSON schema that the output of a chat
+// completion request must match if it has a JSON response_format. The
+// schema of the json_object format only requires an object.
+func ResponseFormatSchema(params map[string]any) (map[string]any, bool) {
+	format, _ := params["response_format"].(map[string]any)
+	switch format["type"] {
+	case "json_schema":
+		jsonSchema, _ := format["json_schema"].(map[string]any)
+		schema, _ := jsonSchema["schema"].(map[string]any)
+		if schema == nil {
+			schema = map[string]any{}
+		}
+		return schema, true
+	case "json_object":
+		return map[string]any{"type": "object"}, true
+	}
+	return nil, false
+}
+
+// CheckStructuredOutput checks that the content of each choice of a chat
+// completion response is JSON that matches a compiled schema (see
+// CompileJSONSchema). If repair is true,
+// invalid contents are repaired with RepairJSON and the response is
+// rewritten if that made them valid. Choices with tool calls or a refusal
+// are not checked.
+func CheckStructuredOutput(body []byte, schema *jsonschema.Schema, repair bool) ([]byte, bool, error) {
+	var resp map[string]any
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, false, fmt.Errorf("decoding chat completion: %w", err)
+	}
+	choices, _ := resp["choices"].([]any)
+	var repaired bool
+	for i, c := range choices {
+		choice, _ := c.(map[string]any)
+		msg, _ := choice["message"].(map[string]any)
+		if msg["tool_calls"] != nil || msg["refusal"] != nil {
+			continue
+		}
+		content, _ := msg["content"].(string)
+		err := checkOutput(content, schema)
+		if err == nil {
+			continue
+		}
+		if repair {
+			if fixed := RepairJSON(content); fixed != content && checkOutput(fixed, schema) == nil {
+				msg["content"] = fixed
+				repaired = true
+				continue
+			}
+		}
+		return nil, false, fmt.Errorf("choices[%d]: %w", i, err)
+	}
+	if !repaired {
+		return body, false, nil
+	}
+	rewritten, err := json.Marshal(resp)
+	if err != nil {
+		return nil, false, fmt.Errorf("encoding chat completion: %w", err)
+	}
+	return rewritten, true, nil
+}
+
+func checkOutput(content string, schema *jsonschema.Schema) error {
+	var v any
+	if err := json.Unmarshal([]byte(content), &v); err != nil {
+		return fmt.Errorf("output is not valid JSON: %w", err)
+	}
+	return ValidateJSONSchema(schema, v)
+}
+
+// RepairJSON repairs common mistakes of models that generate JSON: code
+// fences and text around the JSON value, trailing commas, control
+// characters in strings and the unterminated strings, arrays and objects of
+// truncated outputs. The text is returned unchanged if it has no object or
+// array.
+func RepairJSON(text string) string {
+	s := strings.TrimSpace(text)
+	if fenced, ok := strings.CutPrefix(s, "```"); ok {
+		// The opening fence is followed by the language, i.e. ```json.
+		if _, after, found := strings.Cut(fenced, "\n"); found {
+			fenced = after
+		}
+		s = strings.TrimSuffix(strings.TrimSpace(fenced), "```")
+	}
+	start := strings.IndexAny(s, "{[")
+	if start == -1 {
+		return text
+	}
+
+	var (
+		out []byte
+		// closers are the closing brackets of the open arrays and objects.
+		closers          []byte
+		inString, escape bool
+	)
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escape:
+				escape = false
+			case c == '\\':
+				escape = true
+			case c == '"':
+				inString = false
+			case c < 0x20:
+				out = fmt.Appendf(out, `\u%04x`, c)
+				continue
+			}
+			out = append(out, c)
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			closers = append(closers, '}')
+		case '[':
+			closers = append(closers, ']')
+		case '}', ']':
+			if len(closers) == 0 || closers[len(closers)-1] != c {
+				return text
+			}
+			closers = closers[:len(closers)-1]
+			out = append(trimTrailingComma(out), c)
+			if len(closers) == 0 {
+				// Text after the value is dropped.
+				return string(out)
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+
+	// The output was truncated.
+	if inString {
+		if escape {
+			out = out[:len(out)-1]
+		}
+		out = append(out, '"')
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		out = append(trimTrailingComma(out), closers[i])
+	}
+	return string(out)
+}
+
+func trimTrailingComma(b []byte) []byte {
+	return bytes.TrimSuffix(bytes.TrimRight(b, " \t\r\n"), []byte(","))
+}
@@ -0,0 +1,88 @@
+package apiutils_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+func TestRepairJSON(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		text string
+		exp  string
+	}{
+		"valid": {
+			text: `{"a": [1, 2]}`,
+			exp:  `{"a": [1, 2]}`,
+		},
+		"code fence": {
+			text: "```json\n{\"a\": 1}\n```",
+			exp:  `{"a": 1}`,
+		},
+		"surrounding text": {
+			text: `Here is the JSON: {"a": "}"} Hope this helps!`,
+			exp:  `{"a": "}"}`,
+		},
+		"trailing commas": {
+			text: `{"a": [1, 2, ], }`,
+			exp:  `{"a": [1, 2]}`,
+		},
+		"control characters": {
+			text: "{\"a\": \"line\nbreak\"}",
+			exp:  `{"a": "line\u000abreak"}`,
+		},
+		"truncated": {
+			text: `{"a": [{"b": "tex`,
+			exp:  `{"a": [{"b": "tex"}]}`,
+		},
+		"no JSON": {
+			text: "I don't know.",
+			exp:  "I don't know.",
+		},
+		"mismatched brackets": {
+			text: `{"a": 1]`,
+			exp:  `{"a": 1]`,
+		},
+	}
+
+	for name, spec := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, spec.exp, apiutils.RepairJSON(spec.text))
+		})
+	}
+}
+
+func TestCheckStructuredOutput(t *testing.T) {
+	t.Parallel()
+
+	format, ok := apiutils.ResponseFormatSchema(map[string]any{"response_format": map[string]any{
+		"type": "json_object",
+	}})
+	require.True(t, ok)
+	schema, err := apiutils.CompileJSONSchema(format)
+	require.NoError(t, err)
+
+	body := []byte(`{"choices": [{"message": {"content": "{\"a\": 1}"}}, {"message": {"content": null, "tool_calls": []}}]}`)
+	checked, repaired, err := apiutils.CheckStructuredOutput(body, schema, false)
+	require.NoError(t, err)
+	require.False(t, repaired)
+	require.Equal(t, body, checked)
+
+	body = []byte(`{"choices": [{"message": {"content": "{\"a\": 1"}}]}`)
+	_, _, err = apiutils.CheckStructuredOutput(body, schema, false)
+	require.EqualError(t, err, "choices[0]: output is not valid JSON: unexpected end of JSON input")
+	checked, repaired, err = apiutils.CheckStructuredOutput(body, schema, true)
+	require.NoError(t, err)
+	require.True(t, repaired)
+	require.JSONEq(t, `{"choices": [{"message": {"content": "{\"a\": 1}"}}]}`, string(checked))
+
+	_, _, err = apiutils.CheckStructuredOutput([]byte(`{"choices": [{"message": {"content": "[1]"}}]}`), schema, true)
+	require.ErrorContains(t, err, "got array, want object")
+
+	_, ok = apiutils.ResponseFormatSchema(map[string]any{"response_format": map[string]any{"type": "text"}})
+	require.False(t, ok)
+}
@@ -0,0 +1,130 @@
+package apiutils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// TokenizePath is the path of tokenize requests, which have the format
+	// of the tokenize endpoint of vLLM: a "prompt" or chat "messages".
+	TokenizePath = "/v1/tokenize"
+	// CountTokensPath is the path of requests that only count the tokens of
+	// a tokenize request.
+	CountTokensPath = "/v1/count_tokens"
+)
+
+// TokenizeResponse is the response to a tokenize request. Tokens are only
+// set by the tokenizer of the model, the built-in tokenizer only estimates
+// the count.
+type TokenizeResponse struct {
+	Count       int    `json:"count"`
+	MaxModelLen *int64 `json:"max_model_len,omitempty"`
+	Tokens      []int  `json:"tokens,omitempty"`
+	Estimated   bool   `json:"estimated,omitempty"`
+}
+
+// pretokenizer splits text like the pre-tokenizers of common BPE tokenizers:
+// contractions, words and numbers (with a leading space), punctuation and
+// whitespace.
+var pretokenizer = regexp.MustCompile(`'(?:s|t|re|ve|m|ll|d)| ?\pL+| ?\pN+| ?[^\s\pL\pN]+|\s+`)
+
+const (
+	// maxWordRunes is the length of the longest words that are a single
+	// token, longer words are split.
+	maxWordRunes = 6
+	// maxNumberDigits is the length of the longest numbers that are a single
+	// token.
+	maxNumberDigits = 3
+	// tokensPerMessage are the tokens that chat templates add per message.
+	tokensPerMessage = 4
+)
+
+// EstimateTokenCount estimates the number of tokens of the prompt or the
+// messages of a tokenize request with the built-in tokenizer, which
+// approximates common BPE tokenizers.
+func EstimateTokenCount(params map[string]any) (int, error) {
+	if prompt, ok := params["prompt"].(string); ok {
+		return EstimateTextTokens(prompt), nil
+	}
+	messages, ok := params["messages"].([]any)
+	if !ok {
+		return 0, fmt.Errorf("prompt must be a string or messages must be a list of messages")
+	}
+	var count int
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		count += tokensPerMessage
+		switch content := msg["content"].(type) {
+		case string:
+			count += EstimateTextTokens(content)
+		case []any:
+			for _, p := range content {
+				part, _ := p.(map[string]any)
+				if text, ok := part["text"].(string); ok {
+					count += EstimateTextTokens(text)
+				}
+			}
+		}
+	}
+	return count, nil
+}
+
+// EstimateTextTokens estimates the number of tokens of a text with the
+// built-in tokenizer.
+func EstimateTextTokens(text string) int {
+	var count int
+	for _, piece := range pretokenizer.FindAllString(text, -1) {
+		count += pieceTokens(piece)
+	}
+	return count
+}
+
+func pieceTokens(piece string) int {
+	// The leading space is part of the first token of a piece.
+	n := max(utf8.RuneCountInString(strings.TrimPrefix(piece, " ")), 1)
+	switch r, _ := utf8.DecodeLastRuneInString(piece); {
+	case r >= '0' && r <= '9':
+		return (n + maxNumberDigits - 1) / maxNumberDigits
+	default:
+		return (n + maxWordRunes - 1) / maxWordRunes
+	}
+}
+
+// TextTokenCounter estimates the number of tokens of a text that is written
+// in parts (i.e. the chunks of a streamed response) like EstimateTextTokens,
+// without keeping the text. Only the last piece is kept because it may
+// continue in the next part.
+type TextTokenCounter struct {
+	count int
+	last  string
+}
+
+// Write adds a part of the text.
+func (c *TextTokenCounter) Write(text string) {
+	if text == "" {
+		return
+	}
+	text = c.last + text
+	pieces := pretokenizer.FindAllStringIndex(text, -1)
+	if len(pieces) == 0 {
+		c.last = ""
+		return
+	}
+	for _, p := range pieces[:len(pieces)-1] {
+		c.count += pieceTokens(text[p[0]:p[1]])
+	}
+	last := pieces[len(pieces)-1]
+	// Copied so that the text is not retained.
+	c.last = strings.Clone(text[last[0]:last[1]])
+}
+
+// Count returns the estimated number of tokens of the text written so far.
+func (c *TextTokenCounter) Count() int {
+	if c.last == "" {
+		return c.count
+	}
+	return c.count + pieceTokens(c.last)
+}
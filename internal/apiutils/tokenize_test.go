@@ -0,0 +1,65 @@
+package apiutils_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+func TestEstimateTokenCount(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		params   map[string]any
+		expCount int
+		expErr   string
+	}{
+		"prompt": {
+			// "Hello", ",", " world", "!"
+			params:   map[string]any{"prompt": "Hello, world!"},
+			expCount: 4,
+		},
+		"long words and numbers": {
+			// " tokenization" and " 123456" are 2 tokens each.
+			params:   map[string]any{"prompt": "A tokenization 123456"},
+			expCount: 5,
+		},
+		"messages": {
+			params: map[string]any{"messages": []any{
+				map[string]any{"role": "system", "content": "Be brief."},
+				map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": "Hi"}}},
+			}},
+			expCount: 4 + 3 + 4 + 1,
+		},
+		"no prompt": {
+			params: map[string]any{},
+			expErr: "prompt must be a string or messages must be a list of messages",
+		},
+	}
+
+	for name, spec := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			count, err := apiutils.EstimateTokenCount(spec.params)
+			if spec.expErr != "" {
+				require.EqualError(t, err, spec.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, spec.expCount, count)
+		})
+	}
+}
+
+func TestTextTokenCounter(t *testing.T) {
+	t.Parallel()
+
+	// Words and numbers that continue in the next part are counted once.
+	var c apiutils.TextTokenCounter
+	for _, part := range []string{"A token", "", "ization 123", "456", "!"} {
+		c.Write(part)
+	}
+	require.Equal(t, apiutils.EstimateTextTokens("A tokenization 123456!"), c.Count())
+	require.Equal(t, 6, c.Count())
+}
@@ -0,0 +1,1260 @@
+// Package batchapi implements the OpenAI Batch API (/v1/files and
+// /v1/batches) on top of the messenger: the requests of a batch are
+// published to the requests topic of a stream, their responses are received
+// from a response topic and aggregated into an output file.
+//
+// Files, batches and the results of batch requests are stored in a bucket,
+// separately for each tenant:
+//
+//	files/{tenant}/{id}                          - Uploaded and output files.
+//	batches/{tenant}/{id}.json                   - Batch objects.
+//	batches/{tenant}/{id}/output/{shard}/{index} - Successful results until the batch is finalized.
+//	batches/{tenant}/{id}/errors/{shard}/{index} - Failed results until the batch is finalized.
+//	batches/{tenant}/{id}/cancel                 - Cancellation marker until the batch is finalized.
+//	batches/{tenant}/{id}/failure                - Failure marker until the batch is finalized.
+//	active/{tenant}/{id}                         - Batches that are not finalized yet.
+//
+// Buckets do not support conditional writes, so a batch object is only
+// written by one replica at a time: the replica that publishes its
+// requests while the batch is validated and the leader (that sweeps the
+// batches) once it is in progress. Cancellations and failures of batches
+// in progress are recorded as separate marker objects that are applied
+// when batches are loaded and by the next sweep. The sweep only loads the
+// active batches.
+package batchapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/pubsub"
+)
+
+// Metadata keys of the request messages of batches. They are echoed in the
+// metadata of the response messages.
+const (
+	responseTopicMetadataKey = "response_topic"
+	batchIDMetadataKey       = "openai_batch_id"
+	tenantMetadataKey        = "openai_batch_tenant"
+	requestIndexMetadataKey  = "openai_batch_request_index"
+	customIDMetadataKey      = "custom_id"
+)
+
+// resultShardSize is the number of requests whose results are stored under
+// the same shard prefix. The results of complete shards are only counted
+// once.
+const resultShardSize = 1000
+
+// Endpoints that batches can be created for.
+var endpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/embeddings"}
+
+// completionWindow is the only supported completion window of batches.
+const completionWindow = 24 * time.Hour
+
+// ErrNotFound is returned for files and batches that do not exist.
+var ErrNotFound = errors.New("not found")
+
+// Status of a batch.
+type Status string
+
+const (
+	StatusValidating Status = "validating"
+	StatusFailed     Status = "failed"
+	StatusInProgress Status = "in_progress"
+	StatusFinalizing Status = "finalizing"
+	StatusCompleted  Status = "completed"
+	StatusExpired    Status = "expired"
+	StatusCancelling Status = "cancelling"
+	StatusCancelled  Status = "cancelled"
+)
+
+// File is an uploaded file or the output file of a batch.
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	// Purpose is "batch" for uploaded files and "batch_output" for the
+	// output files of batches.
+	Purpose string `json:"purpose"`
+}
+
+// Batch is the OpenAI batch object.
+type Batch struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"`
+	Endpoint         string            `json:"endpoint"`
+	Errors           *BatchErrors      `json:"errors,omitempty"`
+	InputFileID      string            `json:"input_file_id"`
+	CompletionWindow string            `json:"completion_window"`
+	Status           Status            `json:"status"`
+	OutputFileID     string            `json:"output_file_id,omitempty"`
+	ErrorFileID      string            `json:"error_file_id,omitempty"`
+	CreatedAt        int64             `json:"created_at"`
+	InProgressAt     int64             `json:"in_progress_at,omitempty"`
+	ExpiresAt        int64             `json:"expires_at"`
+	FinalizingAt     int64             `json:"finalizing_at,omitempty"`
+	CompletedAt      int64             `json:"completed_at,omitempty"`
+	FailedAt         int64             `json:"failed_at,omitempty"`
+	ExpiredAt        int64             `json:"expired_at,omitempty"`
+	CancellingAt     int64             `json:"cancelling_at,omitempty"`
+	CancelledAt      int64             `json:"cancelled_at,omitempty"`
+	RequestCounts    RequestCounts     `json:"request_counts"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+
+	// pending is the status that the batch is finalized with by the next
+	// sweep because of a marker (empty if there is none).
+	pending Status
+	// tenant that the batch belongs to.
+	tenant string
+	// headers are the forwarded headers of the request that created the
+	// batch, which are set as metadata of its request messages.
+	headers map[string]string
+}
+
+// storedBatch is the stored object of a batch.
+type storedBatch struct {
+	*Batch
+	Tenant  string            `json:"tenant,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type BatchErrors struct {
+	Object string       `json:"object"`
+	Data   []BatchError `json:"data"`
+}
+
+// BatchError is a reason why a batch failed.
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	// Line of the input file (starting at 1).
+	Line int `json:"line,omitempty"`
+}
+
+// batchMarker requests that a batch is cancelled or failed by the next sweep.
+type batchMarker struct {
+	At    int64       `json:"at"`
+	Error *BatchError `json:"error,omitempty"`
+}
+
+// Names of the markers of a batch.
+const (
+	cancelMarker  = "cancel"
+	failureMarker = "failure"
+)
+
+type RequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// inputLine is a request in the input file of a batch.
+type inputLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// resultLine is a line of the output or error file of a batch.
+type resultLine struct {
+	ID       string          `json:"id"`
+	CustomID string          `json:"custom_id"`
+	Response *resultResponse `json:"response"`
+	Error    *resultError    `json:"error"`
+}
+
+type resultResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type resultError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Service stores files and batches and runs the requests of batches.
+type Service struct {
+	bucket    *blob.Bucket
+	requests  *pubsub.Topic
+	responses *pubsub.Subscription
+	// responsesURL is the response topic of the request messages.
+	responsesURL string
+
+	maxRequests      int
+	maxFileBytes     int64
+	maxActiveBatches int
+	tenantHeader     string
+	forwardedHeaders []string
+	// sweepInterval is the interval at which the request counts of batches
+	// are updated and finished batches are finalized.
+	sweepInterval time.Duration
+	// isLeader limits the sweeps to the leader replica. Sweeps always run
+	// if nil.
+	isLeader *atomic.Bool
+
+	// completeShards caches the request counts of the result shards of
+	// batches in progress that have results for all of their requests, by
+	// batch ID and shard.
+	completeShardsMtx sync.Mutex
+	completeShards    map[string]map[int]RequestCounts
+
+	// ctx is the context of the goroutines that publish the requests of
+	// batches. It outlives the API requests that create the batches.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	now func() time.Time
+}
+
+// Open opens the bucket and topics of the Batch API.
+func Open(ctx context.Context, cfg config.MessageBatchAPI, isLeader *atomic.Bool) (*Service, error) {
+	bucket, err := blob.OpenBucket(ctx, cfg.FilesURL)
+	if err != nil {
+		return nil, fmt.Errorf("opening files bucket: %w", err)
+	}
+	requests, err := pubsub.OpenTopic(ctx, cfg.RequestsURL)
+	if err != nil {
+		bucket.Close()
+		return nil, fmt.Errorf("opening requests topic: %w", err)
+	}
+	responses, err := pubsub.OpenSubscription(ctx, cfg.ResponsesSubscriptionURL)
+	if err != nil {
+		bucket.Close()
+		requests.Shutdown(ctx)
+		return nil, fmt.Errorf("opening responses subscription: %w", err)
+	}
+	s := &Service{
+		bucket:           bucket,
+		requests:         requests,
+		responses:        responses,
+		responsesURL:     cfg.ResponsesURL,
+		maxRequests:      cfg.MaxRequests,
+		maxFileBytes:     cfg.MaxFileBytes,
+		maxActiveBatches: cfg.MaxActiveBatches,
+		tenantHeader:     cfg.TenantHeader,
+		forwardedHeaders: cfg.ForwardedHeaders,
+		sweepInterval:    10 * time.Second,
+		isLeader:         isLeader,
+		completeShards:   map[string]map[int]RequestCounts{},
+		now:              time.Now,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s, nil
+}
+
+// Start receives the responses of batch requests and finalizes finished
+// batches until the context is done.
+func (s *Service) Start(ctx context.Context) {
+	go s.sweepLoop(ctx)
+	for {
+		msg, err := s.responses.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error receiving batch response: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if err := s.handleResponse(ctx, msg); err != nil {
+			log.Printf("Error handling batch response %v: %v", msg.LoggableID, err)
+			if msg.Nackable() {
+				msg.Nack()
+			}
+			continue
+		}
+		msg.Ack()
+	}
+}
+
+// Close stops publishing the requests of batches and closes the bucket and
+// topics. Batches that were not published completely fail.
+func (s *Service) Close(ctx context.Context) error {
+	s.cancel()
+	s.wg.Wait()
+	return errors.Join(
+		s.requests.Shutdown(ctx),
+		s.responses.Shutdown(ctx),
+		s.bucket.Close(),
+	)
+}
+
+// CreateFile stores an uploaded file of a tenant. Files that are larger
+// than the maximum size are rejected.
+func (s *Service) CreateFile(ctx context.Context, tenant, filename, purpose string, content io.Reader) (*File, error) {
+	f := &File{
+		ID:        newID("file-"),
+		Object:    "file",
+		CreatedAt: s.now().Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+	}
+	n, err := s.writeFile(ctx, tenant, f, io.LimitReader(content, s.maxFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > s.maxFileBytes {
+		s.bucket.Delete(ctx, fileKey(tenant, f.ID))
+		return nil, fmt.Errorf("%w: file is larger than %d bytes", errInvalid, s.maxFileBytes)
+	}
+	f.Bytes = n
+	return f, nil
+}
+
+func (s *Service) writeFile(ctx context.Context, tenant string, f *File, content io.Reader) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w, err := s.newFileWriter(ctx, tenant, f)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(w, content)
+	if err != nil {
+		// Canceling the context before closing aborts the write.
+		cancel()
+		w.Close()
+		return 0, err
+	}
+	return n, w.Close()
+}
+
+// newFileWriter returns a writer of the content of a file. Cancelling the
+// context before closing the writer aborts the write.
+func (s *Service) newFileWriter(ctx context.Context, tenant string, f *File) (*blob.Writer, error) {
+	return s.bucket.NewWriter(ctx, fileKey(tenant, f.ID), &blob.WriterOptions{
+		ContentType: "application/jsonl",
+		Metadata: map[string]string{
+			"filename":   f.Filename,
+			"purpose":    f.Purpose,
+			"created_at": strconv.FormatInt(f.CreatedAt, 10),
+		},
+	})
+}
+
+// GetFile returns a file of a tenant or ErrNotFound.
+func (s *Service) GetFile(ctx context.Context, tenant, id string) (*File, error) {
+	attrs, err := s.bucket.Attributes(ctx, fileKey(tenant, id))
+	if err != nil {
+		return nil, notFound(err, "file", id)
+	}
+	createdAt, _ := strconv.ParseInt(attrs.Metadata["created_at"], 10, 64)
+	return &File{
+		ID:        id,
+		Object:    "file",
+		Bytes:     attrs.Size,
+		CreatedAt: createdAt,
+		Filename:  attrs.Metadata["filename"],
+		Purpose:   attrs.Metadata["purpose"],
+	}, nil
+}
+
+// ListFiles returns all files of a tenant, newest first.
+func (s *Service) ListFiles(ctx context.Context, tenant string) ([]*File, error) {
+	var files []*File
+	prefix := fileKey(tenant, "")
+	iter := s.bucket.List(&blob.ListOptions{Prefix: prefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		f, err := s.GetFile(ctx, tenant, strings.TrimPrefix(obj.Key, prefix))
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].CreatedAt > files[j].CreatedAt })
+	return files, nil
+}
+
+// OpenFileContent returns a reader of the content of a file of a tenant or
+// ErrNotFound.
+func (s *Service) OpenFileContent(ctx context.Context, tenant, id string) (io.ReadCloser, error) {
+	r, err := s.bucket.NewReader(ctx, fileKey(tenant, id), nil)
+	if err != nil {
+		return nil, notFound(err, "file", id)
+	}
+	return r, nil
+}
+
+// DeleteFile deletes a file of a tenant or returns ErrNotFound.
+func (s *Service) DeleteFile(ctx context.Context, tenant, id string) error {
+	return notFound(s.bucket.Delete(ctx, fileKey(tenant, id)), "file", id)
+}
+
+// CreateBatch creates a batch of a tenant for the requests in an uploaded
+// file of the tenant. The requests are validated and published in the
+// background, with the headers as metadata. Creating more than the maximum
+// number of active batches fails with errTooManyBatches.
+func (s *Service) CreateBatch(ctx context.Context, tenant string, headers map[string]string, inputFileID, endpoint, window string, metadata map[string]string) (*Batch, error) {
+	if !slices.Contains(endpoints, endpoint) {
+		return nil, fmt.Errorf("%w: unsupported endpoint %q, supported endpoints: %s",
+			errInvalid, endpoint, strings.Join(endpoints, ", "))
+	}
+	if window != "24h" {
+		return nil, fmt.Errorf("%w: unsupported completion_window %q, only \"24h\" is supported", errInvalid, window)
+	}
+	f, err := s.GetFile(ctx, tenant, inputFileID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: input file %q not found", errInvalid, inputFileID)
+		}
+		return nil, err
+	}
+	if f.Purpose != "batch" {
+		return nil, fmt.Errorf("%w: input file %q does not have the purpose \"batch\"", errInvalid, inputFileID)
+	}
+	active, err := s.countObjects(ctx, "active/")
+	if err != nil {
+		return nil, err
+	}
+	if active >= s.maxActiveBatches {
+		return nil, fmt.Errorf("%w: %d batches are validated or in progress", errTooManyBatches, active)
+	}
+
+	now := s.now()
+	b := &Batch{
+		ID:               newID("batch_"),
+		Object:           "batch",
+		Endpoint:         endpoint,
+		InputFileID:      inputFileID,
+		CompletionWindow: window,
+		Status:           StatusValidating,
+		CreatedAt:        now.Unix(),
+		ExpiresAt:        now.Add(completionWindow).Unix(),
+		Metadata:         metadata,
+		tenant:           tenant,
+		headers:          headers,
+	}
+	if err := s.saveBatch(ctx, b); err != nil {
+		return nil, err
+	}
+	if err := s.bucket.WriteAll(ctx, activeKey(tenant, b.ID), nil, nil); err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.runBatch(s.ctx, b); err != nil {
+			log.Printf("Error running batch %v: %v", b.ID, err)
+		}
+	}()
+	return b, nil
+}
+
+var (
+	// errInvalid is wrapped by errors of invalid API requests.
+	errInvalid = errors.New("invalid request")
+	// errTooManyBatches is wrapped by errors of batches that are rejected
+	// because of the maximum number of active batches.
+	errTooManyBatches = errors.New("too many active batches")
+)
+
+// GetBatch returns a batch of a tenant or ErrNotFound. The request counts
+// of batches that are in progress are up to date.
+func (s *Service) GetBatch(ctx context.Context, tenant, id string) (*Batch, error) {
+	b, err := s.loadBatch(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status == StatusInProgress {
+		if err := s.countResults(ctx, b); err != nil {
+			return nil, err
+		}
+	} else {
+		s.forgetCompleteShards(b.ID)
+	}
+	return b, nil
+}
+
+// ListBatches returns all batches of a tenant, newest first.
+func (s *Service) ListBatches(ctx context.Context, tenant string) ([]*Batch, error) {
+	var batches []*Batch
+	prefix := batchesPrefix(tenant)
+	iter := s.bucket.List(&blob.ListOptions{Prefix: prefix, Delimiter: "/"})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, ok := strings.CutSuffix(strings.TrimPrefix(obj.Key, prefix), ".json")
+		if obj.IsDir || !ok {
+			continue
+		}
+		b, err := s.loadBatch(ctx, tenant, id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+	sort.SliceStable(batches, func(i, j int) bool { return batches[i].CreatedAt > batches[j].CreatedAt })
+	return batches, nil
+}
+
+// CancelBatch stops publishing the requests of a batch of a tenant. The
+// batch is cancelled (with the results that were received so far) by the
+// next sweep.
+func (s *Service) CancelBatch(ctx context.Context, tenant, id string) (*Batch, error) {
+	b, err := s.loadBatch(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	switch b.Status {
+	case StatusValidating, StatusInProgress:
+	case StatusCancelling, StatusCancelled:
+		return b, nil
+	default:
+		return nil, fmt.Errorf("%w: batch with status %q can not be cancelled", errInvalid, b.Status)
+	}
+	marker := batchMarker{At: s.now().Unix()}
+	if err := s.writeMarker(ctx, b, cancelMarker, marker); err != nil {
+		return nil, err
+	}
+	b.Status = StatusCancelling
+	b.CancellingAt = marker.At
+	b.pending = StatusCancelled
+	return b, nil
+}
+
+// runBatch validates the input file of a batch and publishes its requests.
+// Batches whose requests can not be published (completely) fail: the
+// requests that were published are still answered, the results that are
+// received until the next sweep are kept.
+func (s *Service) runBatch(ctx context.Context, b *Batch) error {
+	err := s.publishBatch(ctx, b)
+	if err == nil {
+		return nil
+	}
+	batchErr := &BatchError{
+		Code:    "publish_failed",
+		Message: fmt.Sprintf("Publishing the requests failed: %v", err),
+	}
+	if ctx.Err() != nil {
+		// KubeAI is stopping, the marker is written before the bucket is
+		// closed.
+		batchErr = &BatchError{
+			Code:    "interrupted",
+			Message: "KubeAI was stopped before all requests were published.",
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+	}
+	return errors.Join(err, s.writeMarker(ctx, b, failureMarker, batchMarker{At: s.now().Unix(), Error: batchErr}))
+}
+
+// errBatchStopped stops publishing the requests of a batch that is no
+// longer in progress.
+var errBatchStopped = errors.New("batch stopped")
+
+func (s *Service) publishBatch(ctx context.Context, b *Batch) error {
+	total, batchErrs, err := s.validateInput(ctx, b)
+	if err != nil {
+		return err
+	}
+	// The batch might have been cancelled in the meantime.
+	current, err := s.loadBatch(ctx, b.tenant, b.ID)
+	if err != nil {
+		return err
+	}
+	if current.Status != StatusValidating {
+		return nil
+	}
+	b = current
+	if len(batchErrs) > 0 {
+		b.Status = StatusFailed
+		b.FailedAt = s.now().Unix()
+		b.Errors = &BatchErrors{Object: "list", Data: batchErrs}
+		if err := s.saveBatch(ctx, b); err != nil {
+			return err
+		}
+		return s.deleteActive(ctx, b)
+	}
+	b.Status = StatusInProgress
+	b.InProgressAt = s.now().Unix()
+	b.RequestCounts.Total = total
+	if err := s.saveBatch(ctx, b); err != nil {
+		return err
+	}
+
+	// The input file is read again instead of keeping the validated
+	// requests in memory.
+	var i int
+	err = s.scanInput(ctx, b, func(_ int, raw []byte) error {
+		// Check for cancellation every now and then.
+		if i > 0 && i%100 == 0 {
+			current, err := s.loadBatch(ctx, b.tenant, b.ID)
+			if err != nil {
+				return err
+			}
+			if current.Status != StatusInProgress {
+				return errBatchStopped
+			}
+		}
+		var line inputLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return fmt.Errorf("parsing request %d: %w", i, err)
+		}
+		metadata := map[string]any{}
+		for k, v := range b.headers {
+			metadata[k] = v
+		}
+		metadata[responseTopicMetadataKey] = s.responsesURL
+		metadata[batchIDMetadataKey] = b.ID
+		metadata[tenantMetadataKey] = b.tenant
+		metadata[requestIndexMetadataKey] = strconv.Itoa(i)
+		metadata[customIDMetadataKey] = line.CustomID
+		body, err := json.Marshal(map[string]any{
+			"metadata": metadata,
+			"path":     line.URL,
+			"body":     line.Body,
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.requests.Send(ctx, &pubsub.Message{Body: body}); err != nil {
+			return fmt.Errorf("publishing request %d: %w", i, err)
+		}
+		i++
+		return nil
+	})
+	if errors.Is(err, errBatchStopped) {
+		return nil
+	}
+	return err
+}
+
+// maxBatchErrors limits the number of validation errors that are reported.
+const maxBatchErrors = 10
+
+// validateInput validates the requests in the input file of a batch and
+// returns their number.
+func (s *Service) validateInput(ctx context.Context, b *Batch) (int, []BatchError, error) {
+	var (
+		total     int
+		batchErrs []BatchError
+		customIDs = map[string]bool{}
+	)
+	fail := func(line int, code, param, format string, args ...any) {
+		if len(batchErrs) < maxBatchErrors {
+			batchErrs = append(batchErrs, BatchError{Code: code, Message: fmt.Sprintf(format, args...), Param: param, Line: line})
+		}
+	}
+	err := s.scanInput(ctx, b, func(lineNum int, raw []byte) error {
+		total++
+		var l inputLine
+		if err := json.Unmarshal(raw, &l); err != nil {
+			fail(lineNum, "invalid_json_line", "", "This line is not parseable as valid JSON: %v", err)
+			return nil
+		}
+		var body struct {
+			Stream bool `json:"stream"`
+		}
+		switch {
+		case l.CustomID == "":
+			fail(lineNum, "missing_required_parameter", "custom_id", "Missing required parameter: custom_id.")
+		case customIDs[l.CustomID]:
+			fail(lineNum, "duplicate_custom_id", "custom_id", "The custom_id %q is used more than once.", l.CustomID)
+		case l.Method != "POST":
+			fail(lineNum, "invalid_method", "method", "The method must be POST.")
+		case l.URL != b.Endpoint:
+			fail(lineNum, "mismatched_endpoint", "url", "The url %q does not match the endpoint %q of the batch.", l.URL, b.Endpoint)
+		case json.Unmarshal(l.Body, &body) != nil:
+			fail(lineNum, "invalid_request", "body", "The body must be a JSON object.")
+		case body.Stream:
+			fail(lineNum, "invalid_request", "body.stream", "Streaming is not supported in batches.")
+		}
+		customIDs[l.CustomID] = true
+		return nil
+	})
+	if err != nil {
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return 0, []BatchError{{Code: "invalid_file", Message: "The input file was deleted."}}, nil
+		}
+		return 0, nil, err
+	}
+	switch {
+	case total == 0 && len(batchErrs) == 0:
+		fail(0, "empty_file", "", "The input file does not contain any requests.")
+	case total > s.maxRequests:
+		fail(0, "too_many_requests", "", "The input file contains %d requests, at most %d are allowed.", total, s.maxRequests)
+	}
+	return total, batchErrs, nil
+}
+
+// scanInput calls fn with the non-empty lines of the input file of a batch
+// (and their line numbers, starting at 1) while reading the file.
+func (s *Service) scanInput(ctx context.Context, b *Batch, fn func(lineNum int, raw []byte) error) error {
+	r, err := s.bucket.NewReader(ctx, fileKey(b.tenant, b.InputFileID), nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	br := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		raw, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(raw)) > 0 {
+			if err := fn(lineNum, raw); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleResponse stores the result of a batch request. Responses of unknown
+// or finished batches are dropped.
+func (s *Service) handleResponse(ctx context.Context, msg *pubsub.Message) error {
+	data, err := decompress(msg.Metadata[contentEncodingMetadataKey], msg.Body)
+	if err != nil {
+		log.Printf("Dropping batch response %v: %v", msg.LoggableID, err)
+		return nil
+	}
+	var resp struct {
+		Metadata   map[string]any  `json:"metadata"`
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+		BodyURL    string          `json:"body_url"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		log.Printf("Dropping batch response %v: %v", msg.LoggableID, err)
+		return nil
+	}
+	batchID, _ := resp.Metadata[batchIDMetadataKey].(string)
+	tenant, _ := resp.Metadata[tenantMetadataKey].(string)
+	indexStr, _ := resp.Metadata[requestIndexMetadataKey].(string)
+	index, err := strconv.Atoi(indexStr)
+	if batchID == "" || err != nil {
+		log.Printf("Dropping batch response %v: missing %s or %s metadata", msg.LoggableID, batchIDMetadataKey, requestIndexMetadataKey)
+		return nil
+	}
+	b, err := s.loadBatch(ctx, tenant, batchID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if b.Status != StatusInProgress && b.Status != StatusCancelling {
+		return nil
+	}
+
+	if resp.BodyURL != "" {
+		resp.Body, err = readBodyURL(ctx, resp.BodyURL)
+		if err != nil {
+			return fmt.Errorf("reading body_url: %w", err)
+		}
+	}
+
+	customID, _ := resp.Metadata[customIDMetadataKey].(string)
+	result := resultLine{
+		ID:       fmt.Sprintf("batch_req_%s_%d", strings.TrimPrefix(batchID, "batch_"), index),
+		CustomID: customID,
+		Response: &resultResponse{
+			StatusCode: resp.StatusCode,
+			RequestID:  msg.Metadata["request_message_id"],
+			Body:       resp.Body,
+		},
+	}
+	if !json.Valid(result.Response.Body) {
+		result.Response.Body, _ = json.Marshal(string(result.Response.Body))
+	}
+	kind := "output"
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		kind = "errors"
+	}
+	line, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return s.bucket.WriteAll(ctx, resultKey(b, kind, index), append(line, '\n'), nil)
+}
+
+func (s *Service) sweepLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.isLeader != nil && !s.isLeader.Load() {
+			continue
+		}
+		if err := s.sweep(ctx); err != nil {
+			log.Printf("Error sweeping batches: %v", err)
+		}
+	}
+}
+
+// sweep updates the request counts of the active batches and finalizes
+// batches that are finished, cancelled or expired.
+func (s *Service) sweep(ctx context.Context) error {
+	// The active batches are listed before they are finalized, which
+	// deletes them from the list.
+	var active []string
+	iter := s.bucket.List(&blob.ListOptions{Prefix: "active/"})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		active = append(active, obj.Key)
+	}
+
+	var errs []error
+	for _, key := range active {
+		tenant, id, ok := parseActiveKey(key)
+		if !ok {
+			continue
+		}
+		if err := s.sweepBatch(ctx, tenant, id); err != nil {
+			errs = append(errs, fmt.Errorf("batch %v: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) sweepBatch(ctx context.Context, tenant, id string) error {
+	b, err := s.loadBatch(ctx, tenant, id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return s.deleteActive(ctx, &Batch{ID: id, tenant: tenant})
+		}
+		return err
+	}
+	if b.pending != "" {
+		if err := s.countResults(ctx, b); err != nil {
+			return err
+		}
+		return s.finalize(ctx, b, b.pending)
+	}
+	expired := s.now().Unix() >= b.ExpiresAt
+	switch b.Status {
+	case StatusValidating:
+		// The replica that validated the batch stopped.
+		if expired {
+			return s.finalize(ctx, b, StatusExpired)
+		}
+	case StatusInProgress:
+		counts := b.RequestCounts
+		if err := s.countResults(ctx, b); err != nil {
+			return err
+		}
+		switch {
+		case b.RequestCounts.Completed+b.RequestCounts.Failed >= b.RequestCounts.Total:
+			return s.finalize(ctx, b, StatusCompleted)
+		case expired:
+			return s.finalize(ctx, b, StatusExpired)
+		case b.RequestCounts != counts:
+			return s.saveBatch(ctx, b)
+		}
+	case StatusFinalizing:
+		// The replica that finalized the batch stopped.
+		return s.finalize(ctx, b, StatusCompleted)
+	case StatusCancelling:
+		// Batches that were cancelled before cancellation markers.
+		if err := s.countResults(ctx, b); err != nil {
+			return err
+		}
+		return s.finalize(ctx, b, StatusCancelled)
+	default:
+		// The batch was finalized, but it was not removed from the
+		// active batches.
+		return s.deleteActive(ctx, b)
+	}
+	return nil
+}
+
+// countResults sets the request counts of a batch from its stored results.
+// Only the results of the shards that were not complete yet are listed.
+func (s *Service) countResults(ctx context.Context, b *Batch) error {
+	s.completeShardsMtx.Lock()
+	complete := maps.Clone(s.completeShards[b.ID])
+	s.completeShardsMtx.Unlock()
+
+	var counts RequestCounts
+	for shard := 0; shard*resultShardSize < b.RequestCounts.Total; shard++ {
+		if c, ok := complete[shard]; ok {
+			counts.Completed += c.Completed
+			counts.Failed += c.Failed
+			continue
+		}
+		completed, err := s.countObjects(ctx, resultShardPrefix(b, "output", shard))
+		if err != nil {
+			return err
+		}
+		failed, err := s.countObjects(ctx, resultShardPrefix(b, "errors", shard))
+		if err != nil {
+			return err
+		}
+		counts.Completed += completed
+		counts.Failed += failed
+		if completed+failed >= min(resultShardSize, b.RequestCounts.Total-shard*resultShardSize) {
+			s.completeShardsMtx.Lock()
+			if s.completeShards[b.ID] == nil {
+				s.completeShards[b.ID] = map[int]RequestCounts{}
+			}
+			s.completeShards[b.ID][shard] = RequestCounts{Completed: completed, Failed: failed}
+			s.completeShardsMtx.Unlock()
+		}
+	}
+	b.RequestCounts.Completed, b.RequestCounts.Failed = counts.Completed, counts.Failed
+	return nil
+}
+
+func (s *Service) forgetCompleteShards(batchID string) {
+	s.completeShardsMtx.Lock()
+	delete(s.completeShards, batchID)
+	s.completeShardsMtx.Unlock()
+}
+
+func (s *Service) countObjects(ctx context.Context, prefix string) (int, error) {
+	var n int
+	iter := s.bucket.List(&blob.ListOptions{Prefix: prefix})
+	for {
+		_, err := iter.Next(ctx)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+}
+
+// finalize aggregates the results of a batch into its output and error
+// files and sets its final status.
+func (s *Service) finalize(ctx context.Context, b *Batch, status Status) error {
+	if status == StatusCompleted && b.Status != StatusFinalizing {
+		b.Status = StatusFinalizing
+		b.FinalizingAt = s.now().Unix()
+		if err := s.saveBatch(ctx, b); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if b.OutputFileID, err = s.aggregateResults(ctx, b, "output"); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	if b.ErrorFileID, err = s.aggregateResults(ctx, b, "errors"); err != nil {
+		return fmt.Errorf("writing error file: %w", err)
+	}
+
+	now := s.now().Unix()
+	b.Status = status
+	switch status {
+	case StatusCompleted:
+		b.CompletedAt = now
+	case StatusExpired:
+		b.ExpiredAt = now
+	case StatusCancelled:
+		b.CancelledAt = now
+	}
+	if err := s.saveBatch(ctx, b); err != nil {
+		return err
+	}
+	s.forgetCompleteShards(b.ID)
+	// Also deletes the markers.
+	if err := s.deleteResults(ctx, b); err != nil {
+		return err
+	}
+	return s.deleteActive(ctx, b)
+}
+
+// aggregateResults concatenates the results of a batch of the given kind
+// into a file (in the order of the requests) and returns its ID. No file is
+// written if there are no results.
+func (s *Service) aggregateResults(ctx context.Context, b *Batch, kind string) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		f *File
+		w *blob.Writer
+	)
+	abort := func(err error) (string, error) {
+		if w != nil {
+			// Canceling the context before closing aborts the write.
+			cancel()
+			w.Close()
+		}
+		return "", err
+	}
+	// Results are listed in lexicographical order of their zero-padded
+	// shards and request indexes.
+	iter := s.bucket.List(&blob.ListOptions{Prefix: resultPrefix(b, kind)})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return abort(err)
+		}
+		if w == nil {
+			f = &File{
+				ID:        newID("file-"),
+				CreatedAt: s.now().Unix(),
+				Filename:  fmt.Sprintf("%s_%s.jsonl", b.ID, kind),
+				Purpose:   "batch_output",
+			}
+			if w, err = s.newFileWriter(ctx, b.tenant, f); err != nil {
+				return "", err
+			}
+		}
+		r, err := s.bucket.NewReader(ctx, obj.Key, nil)
+		if err != nil {
+			return abort(err)
+		}
+		_, err = io.Copy(w, r)
+		r.Close()
+		if err != nil {
+			return abort(err)
+		}
+	}
+	if w == nil {
+		return "", nil
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return f.ID, nil
+}
+
+func (s *Service) deleteActive(ctx context.Context, b *Batch) error {
+	if err := s.bucket.Delete(ctx, activeKey(b.tenant, b.ID)); err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+		return err
+	}
+	return nil
+}
+
+func (s *Service) deleteResults(ctx context.Context, b *Batch) error {
+	iter := s.bucket.List(&blob.ListOptions{Prefix: batchPrefix(b.tenant, b.ID) + "/"})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.bucket.Delete(ctx, obj.Key); err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+			return err
+		}
+	}
+}
+
+func (s *Service) loadBatch(ctx context.Context, tenant, id string) (*Batch, error) {
+	data, err := s.bucket.ReadAll(ctx, batchKey(tenant, id))
+	if err != nil {
+		return nil, notFound(err, "batch", id)
+	}
+	stored := storedBatch{Batch: &Batch{}}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("unmarshalling batch %v: %w", id, err)
+	}
+	b := stored.Batch
+	b.tenant, b.headers = stored.Tenant, stored.Headers
+	if err := s.applyMarkers(ctx, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// applyMarkers sets the status of a batch that is validated or in progress
+// to the status that a marker requests. Failures take precedence over
+// cancellations.
+func (s *Service) applyMarkers(ctx context.Context, b *Batch) error {
+	if b.Status != StatusValidating && b.Status != StatusInProgress {
+		return nil
+	}
+	failure, err := s.readMarker(ctx, b, failureMarker)
+	if err != nil {
+		return err
+	}
+	if failure != nil {
+		b.Status = StatusFailed
+		b.FailedAt = failure.At
+		if failure.Error != nil {
+			b.Errors = &BatchErrors{Object: "list", Data: []BatchError{*failure.Error}}
+		}
+		b.pending = StatusFailed
+		return nil
+	}
+	cancel, err := s.readMarker(ctx, b, cancelMarker)
+	if err != nil {
+		return err
+	}
+	if cancel != nil {
+		b.Status = StatusCancelling
+		b.CancellingAt = cancel.At
+		b.pending = StatusCancelled
+	}
+	return nil
+}
+
+// readMarker returns a marker of a batch (nil if it does not exist).
+func (s *Service) readMarker(ctx context.Context, b *Batch, name string) (*batchMarker, error) {
+	data, err := s.bucket.ReadAll(ctx, markerKey(b, name))
+	if err != nil {
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	m := &batchMarker{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("unmarshalling %s marker of batch %v: %w", name, b.ID, err)
+	}
+	return m, nil
+}
+
+func (s *Service) writeMarker(ctx context.Context, b *Batch, name string, m batchMarker) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.bucket.WriteAll(ctx, markerKey(b, name), data, &blob.WriterOptions{ContentType: "application/json"})
+}
+
+func (s *Service) saveBatch(ctx context.Context, b *Batch) error {
+	data, err := json.Marshal(storedBatch{Batch: b, Tenant: b.tenant, Headers: b.headers})
+	if err != nil {
+		return err
+	}
+	return s.bucket.WriteAll(ctx, batchKey(b.tenant, b.ID), data, &blob.WriterOptions{ContentType: "application/json"})
+}
+
+// tenantSegment returns the key segment of a tenant. Tenants are escaped
+// and prefixed so that they can not escape their prefix or collide with
+// the segment of the tenant of requests without a tenant.
+func tenantSegment(tenant string) string {
+	if tenant == "" {
+		return "default"
+	}
+	return "t-" + url.PathEscape(tenant)
+}
+
+func fileKey(tenant, id string) string {
+	return "files/" + tenantSegment(tenant) + "/" + id
+}
+
+func batchesPrefix(tenant string) string {
+	return "batches/" + tenantSegment(tenant) + "/"
+}
+
+func batchPrefix(tenant, id string) string {
+	return batchesPrefix(tenant) + id
+}
+
+func batchKey(tenant, id string) string {
+	return batchPrefix(tenant, id) + ".json"
+}
+
+func resultPrefix(b *Batch, kind string) string {
+	return batchPrefix(b.tenant, b.ID) + "/" + kind + "/"
+}
+
+func resultShardPrefix(b *Batch, kind string, shard int) string {
+	return fmt.Sprintf("%s%06d/", resultPrefix(b, kind), shard)
+}
+
+func resultKey(b *Batch, kind string, index int) string {
+	return fmt.Sprintf("%s%09d", resultShardPrefix(b, kind, index/resultShardSize), index)
+}
+
+func markerKey(b *Batch, name string) string {
+	return batchPrefix(b.tenant, b.ID) + "/" + name
+}
+
+func activeKey(tenant, id string) string {
+	return "active/" + tenantSegment(tenant) + "/" + id
+}
+
+// parseActiveKey returns the tenant and ID of the batch of an active key.
+func parseActiveKey(key string) (tenant, id string, ok bool) {
+	segment, id, ok := strings.Cut(strings.TrimPrefix(key, "active/"), "/")
+	if !ok || id == "" {
+		return "", "", false
+	}
+	if segment == "default" {
+		return "", id, true
+	}
+	escaped, ok := strings.CutPrefix(segment, "t-")
+	if !ok {
+		return "", "", false
+	}
+	tenant, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", "", false
+	}
+	return tenant, id, true
+}
+
+func newID(prefix string) string {
+	return prefix + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// notFound translates not found errors of the bucket to ErrNotFound.
+func notFound(err error, kind, id string) error {
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return fmt.Errorf("%s %q %w", kind, id, ErrNotFound)
+	}
+	return err
+}
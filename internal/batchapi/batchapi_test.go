@@ -0,0 +1,388 @@
+package batchapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	_ "gocloud.dev/blob/memblob"
+	"gocloud.dev/pubsub"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+func TestBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://batch-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	s, err := Open(ctx, config.MessageBatchAPI{
+		RequestsURL:              "mem://batch-requests",
+		ResponsesURL:             "mem://batch-responses",
+		ResponsesSubscriptionURL: "mem://batch-responses",
+		FilesURL:                 "mem://",
+		MaxRequests:              10,
+		MaxFileBytes:             1 << 20,
+		MaxActiveBatches:         100,
+		TenantHeader:             "X-Tenant",
+		ForwardedHeaders:         []string{"X-Team"},
+	}, nil)
+	require.NoError(t, err)
+	s.sweepInterval = time.Hour
+	go s.Start(ctx)
+	defer s.Close(context.Background())
+
+	// Fake messenger that responds to the requests on the response topic.
+	requests, err := pubsub.OpenSubscription(ctx, "mem://batch-requests")
+	require.NoError(t, err)
+	defer requests.Shutdown(ctx)
+	publishedMetadata := make(chan map[string]any, 100)
+	go func() {
+		for {
+			msg, err := requests.Receive(ctx)
+			if err != nil {
+				return
+			}
+			msg.Ack()
+			var req struct {
+				Metadata map[string]any `json:"metadata"`
+				Path     string         `json:"path"`
+				Body     struct {
+					Input string `json:"input"`
+				} `json:"body"`
+			}
+			if err := json.Unmarshal(msg.Body, &req); err != nil || req.Metadata[responseTopicMetadataKey] != "mem://batch-responses" {
+				continue
+			}
+			publishedMetadata <- req.Metadata
+			status := http.StatusOK
+			if req.Body.Input == "fail" {
+				status = http.StatusBadRequest
+			}
+			body, _ := json.Marshal(map[string]any{
+				"metadata":    req.Metadata,
+				"status_code": status,
+				"body":        map[string]any{"echo": req.Body.Input},
+			})
+			responsesTopic.Send(ctx, &pubsub.Message{Body: body, Metadata: map[string]string{"request_message_id": "msg-" + req.Body.Input}})
+		}
+	}()
+
+	srv := httptest.NewServer(s.NewHandler())
+	defer srv.Close()
+	tenant := "team-a"
+	do := func(method, path, contentType string, body io.Reader, wantStatus int, v any) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		req.Header.Set("X-Team", "search")
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, wantStatus, resp.StatusCode, string(data))
+		if v != nil {
+			require.NoError(t, json.Unmarshal(data, v))
+		}
+	}
+	upload := func(content string) File {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		require.NoError(t, mw.WriteField("purpose", "batch"))
+		fw, err := mw.CreateFormFile("file", "input.jsonl")
+		require.NoError(t, err)
+		fw.Write([]byte(content))
+		require.NoError(t, mw.Close())
+		var f File
+		do("POST", "/v1/files", mw.FormDataContentType(), &buf, http.StatusOK, &f)
+		return f
+	}
+	createBatch := func(fileID string) Batch {
+		var b Batch
+		do("POST", "/v1/batches", "application/json", strings.NewReader(fmt.Sprintf(
+			`{"input_file_id": %q, "endpoint": "/v1/embeddings", "completion_window": "24h"}`, fileID)), http.StatusOK, &b)
+		require.Equal(t, StatusValidating, b.Status)
+		return b
+	}
+	waitForBatch := func(id string, cond func(b Batch) bool) Batch {
+		t.Helper()
+		var b Batch
+		require.Eventually(t, func() bool {
+			do("GET", "/v1/batches/"+id, "", nil, http.StatusOK, &b)
+			return cond(b)
+		}, 5*time.Second, 10*time.Millisecond)
+		return b
+	}
+	line := func(customID, input string) string {
+		return fmt.Sprintf(`{"custom_id": %q, "method": "POST", "url": "/v1/embeddings", "body": {"model": "m", "input": %q}}`+"\n", customID, input)
+	}
+
+	// The requests of the batch are published and the responses are
+	// aggregated into the output and error files.
+	input := upload(line("a", "one") + line("b", "fail") + line("c", "three"))
+	require.Equal(t, "batch", input.Purpose)
+	b := createBatch(input.ID)
+	b = waitForBatch(b.ID, func(b Batch) bool {
+		return b.RequestCounts == RequestCounts{Total: 3, Completed: 2, Failed: 1}
+	})
+	require.Equal(t, StatusInProgress, b.Status)
+	require.NoError(t, s.sweep(ctx))
+	do("GET", "/v1/batches/"+b.ID, "", nil, http.StatusOK, &b)
+	require.Equal(t, StatusCompleted, b.Status)
+	require.NotZero(t, b.CompletedAt)
+
+	// The tenant and the forwarded headers are set as metadata of the
+	// requests, other headers are not.
+	md := <-publishedMetadata
+	require.Equal(t, "team-a", md["X-Tenant"])
+	require.Equal(t, "search", md["X-Team"])
+	require.NotContains(t, md, "Authorization")
+
+	readFile := func(id string) []resultLine {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/files/"+id+"/content", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant", tenant)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var lines []resultLine
+		dec := json.NewDecoder(resp.Body)
+		for dec.More() {
+			var l resultLine
+			require.NoError(t, dec.Decode(&l))
+			lines = append(lines, l)
+		}
+		return lines
+	}
+	output := readFile(b.OutputFileID)
+	require.Len(t, output, 2)
+	require.Equal(t, "a", output[0].CustomID)
+	require.Equal(t, "c", output[1].CustomID)
+	require.Equal(t, http.StatusOK, output[0].Response.StatusCode)
+	require.Equal(t, "msg-one", output[0].Response.RequestID)
+	require.JSONEq(t, `{"echo": "one"}`, string(output[0].Response.Body))
+	errs := readFile(b.ErrorFileID)
+	require.Len(t, errs, 1)
+	require.Equal(t, "b", errs[0].CustomID)
+	require.Equal(t, http.StatusBadRequest, errs[0].Response.StatusCode)
+
+	var outputFile File
+	do("GET", "/v1/files/"+b.OutputFileID, "", nil, http.StatusOK, &outputFile)
+	require.Equal(t, "batch_output", outputFile.Purpose)
+
+	// Invalid input files fail validation.
+	invalid := upload(line("a", "one") + line("a", "two") + `{"custom_id": "c", "method": "GET", "url": "/v1/embeddings"}` + "\n")
+	b = createBatch(invalid.ID)
+	b = waitForBatch(b.ID, func(b Batch) bool { return b.Status != StatusValidating })
+	require.Equal(t, StatusFailed, b.Status)
+	require.NotNil(t, b.Errors)
+	require.Len(t, b.Errors.Data, 2)
+	require.Equal(t, "duplicate_custom_id", b.Errors.Data[0].Code)
+	require.Equal(t, 2, b.Errors.Data[0].Line)
+	require.Equal(t, "invalid_method", b.Errors.Data[1].Code)
+
+	// Unsupported endpoints are rejected.
+	do("POST", "/v1/batches", "application/json", strings.NewReader(fmt.Sprintf(
+		`{"input_file_id": %q, "endpoint": "/v1/audio/transcriptions", "completion_window": "24h"}`, input.ID)), http.StatusBadRequest, nil)
+
+	// Cancelled batches keep the results that were received so far.
+	b = createBatch(input.ID)
+	waitForBatch(b.ID, func(b Batch) bool { return b.Status == StatusInProgress && b.RequestCounts.Completed == 2 })
+	do("POST", "/v1/batches/"+b.ID+"/cancel", "", nil, http.StatusOK, &b)
+	require.Equal(t, StatusCancelling, b.Status)
+	require.NoError(t, s.sweep(ctx))
+	do("GET", "/v1/batches/"+b.ID, "", nil, http.StatusOK, &b)
+	require.Equal(t, StatusCancelled, b.Status)
+	require.NotEmpty(t, b.OutputFileID)
+	do("POST", "/v1/batches/"+b.ID+"/cancel", "", nil, http.StatusOK, nil)
+
+	var list struct {
+		Data    []Batch `json:"data"`
+		HasMore bool    `json:"has_more"`
+	}
+	do("GET", "/v1/batches?limit=2", "", nil, http.StatusOK, &list)
+	require.Len(t, list.Data, 2)
+	require.True(t, list.HasMore)
+
+	// Files and batches of other tenants are not found.
+	tenant = "team-b"
+	do("GET", "/v1/files/"+input.ID, "", nil, http.StatusNotFound, nil)
+	do("GET", "/v1/batches/"+b.ID, "", nil, http.StatusNotFound, nil)
+	do("GET", "/v1/batches", "", nil, http.StatusOK, &list)
+	require.Empty(t, list.Data)
+	do("POST", "/v1/batches", "application/json", strings.NewReader(fmt.Sprintf(
+		`{"input_file_id": %q, "endpoint": "/v1/embeddings", "completion_window": "24h"}`, input.ID)), http.StatusBadRequest, nil)
+	tenant = ""
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+	}
+	do("GET", "/v1/files", "", nil, http.StatusUnauthorized, &errResp)
+	require.Equal(t, "invalid_request_error", errResp.Error.Type)
+	require.Contains(t, errResp.Error.Message, "X-Tenant")
+	tenant = "team-a"
+
+	do("DELETE", "/v1/files/"+input.ID, "", nil, http.StatusOK, nil)
+	do("GET", "/v1/files/"+input.ID, "", nil, http.StatusNotFound, &errResp)
+	require.Equal(t, "invalid_request_error", errResp.Error.Type)
+	do("GET", "/v1/batches/batch_unknown", "", nil, http.StatusNotFound, nil)
+
+	// Finalized batches are no longer swept.
+	active, err := s.countObjects(ctx, "active/")
+	require.NoError(t, err)
+	require.Zero(t, active)
+}
+
+func TestBatchMarkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://batch-markers-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	s, err := Open(ctx, config.MessageBatchAPI{
+		RequestsURL:              "mem://batch-markers-requests",
+		ResponsesURL:             "mem://batch-markers-responses",
+		ResponsesSubscriptionURL: "mem://batch-markers-responses",
+		FilesURL:                 "mem://",
+		MaxRequests:              10,
+		MaxFileBytes:             1 << 20,
+		MaxActiveBatches:         2,
+	}, nil)
+	require.NoError(t, err)
+	defer s.Close(context.Background())
+
+	input := `{"custom_id": "a", "method": "POST", "url": "/v1/embeddings", "body": {"model": "m", "input": "one"}}` + "\n"
+	f, err := s.CreateFile(ctx, "", "input.jsonl", "batch", strings.NewReader(input))
+	require.NoError(t, err)
+	create := func() *Batch {
+		t.Helper()
+		b, err := s.CreateBatch(ctx, "", nil, f.ID, "/v1/embeddings", "24h", nil)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			b, err = s.GetBatch(ctx, "", b.ID)
+			return err == nil && b.Status != StatusValidating
+		}, 5*time.Second, 10*time.Millisecond)
+		return b
+	}
+
+	// A cancellation is not lost if the batch is saved by a sweep that
+	// loaded it before.
+	b := create()
+	require.Equal(t, StatusInProgress, b.Status)
+	stale, err := s.loadBatch(ctx, "", b.ID)
+	require.NoError(t, err)
+	b, err = s.CancelBatch(ctx, "", b.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCancelling, b.Status)
+	stale.RequestCounts.Completed = 1
+	require.NoError(t, s.saveBatch(ctx, stale))
+	b, err = s.GetBatch(ctx, "", b.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCancelling, b.Status)
+	require.NoError(t, s.sweep(ctx))
+	b, err = s.GetBatch(ctx, "", b.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCancelled, b.Status)
+	require.NotZero(t, b.CancelledAt)
+
+	// Batches fail if their requests can not be published.
+	require.NoError(t, s.requests.Shutdown(ctx))
+	b = create()
+	require.Equal(t, StatusFailed, b.Status)
+	require.NotNil(t, b.Errors)
+	require.Equal(t, "publish_failed", b.Errors.Data[0].Code)
+	require.NoError(t, s.sweep(ctx))
+	b, err = s.loadBatch(ctx, "", b.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusFailed, b.Status)
+	require.Empty(t, b.pending)
+	require.NotZero(t, b.FailedAt)
+
+	// Batches that are interrupted by a shutdown fail.
+	b = &Batch{ID: newID("batch_"), Endpoint: "/v1/embeddings", InputFileID: f.ID, Status: StatusValidating}
+	require.NoError(t, s.saveBatch(ctx, b))
+	stopped, stop := context.WithCancel(ctx)
+	stop()
+	require.Error(t, s.runBatch(stopped, b))
+	b, err = s.loadBatch(ctx, "", b.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusFailed, b.Status)
+	require.Equal(t, "interrupted", b.Errors.Data[0].Code)
+
+	// The number of active batches is limited.
+	require.NoError(t, s.bucket.WriteAll(ctx, activeKey("", "batch_a"), nil, nil))
+	require.NoError(t, s.bucket.WriteAll(ctx, activeKey("", "batch_b"), nil, nil))
+	_, err = s.CreateBatch(ctx, "", nil, f.ID, "/v1/embeddings", "24h", nil)
+	require.ErrorIs(t, err, errTooManyBatches)
+	// Active batches that do not exist are removed by the sweep.
+	require.NoError(t, s.sweep(ctx))
+	active, err := s.countObjects(ctx, "active/")
+	require.NoError(t, err)
+	require.Zero(t, active)
+}
+
+func TestCountResults(t *testing.T) {
+	ctx := context.Background()
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://batch-count-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	s, err := Open(ctx, config.MessageBatchAPI{
+		RequestsURL:              "mem://batch-count-requests",
+		ResponsesURL:             "mem://batch-count-responses",
+		ResponsesSubscriptionURL: "mem://batch-count-responses",
+		FilesURL:                 "mem://",
+	}, nil)
+	require.NoError(t, err)
+	defer s.Close(ctx)
+
+	b := &Batch{ID: "batch_count", tenant: "team-a", RequestCounts: RequestCounts{Total: resultShardSize + 2}}
+	for i := 0; i < resultShardSize; i++ {
+		kind := "output"
+		if i%10 == 0 {
+			kind = "errors"
+		}
+		require.NoError(t, s.bucket.WriteAll(ctx, resultKey(b, kind, i), []byte("{}\n"), nil))
+	}
+	require.NoError(t, s.bucket.WriteAll(ctx, resultKey(b, "output", resultShardSize+1), []byte("{}\n"), nil))
+	require.NoError(t, s.countResults(ctx, b))
+	require.Equal(t, RequestCounts{Total: resultShardSize + 2, Completed: resultShardSize*9/10 + 1, Failed: resultShardSize / 10}, b.RequestCounts)
+
+	// The complete first shard is not counted again.
+	require.Equal(t, map[int]RequestCounts{0: {Completed: resultShardSize * 9 / 10, Failed: resultShardSize / 10}}, s.completeShards[b.ID])
+	require.NoError(t, s.bucket.Delete(ctx, resultKey(b, "output", 1)))
+	require.NoError(t, s.bucket.WriteAll(ctx, resultKey(b, "errors", resultShardSize), []byte("{}\n"), nil))
+	require.NoError(t, s.countResults(ctx, b))
+	require.Equal(t, RequestCounts{Total: resultShardSize + 2, Completed: resultShardSize*9/10 + 1, Failed: resultShardSize/10 + 1}, b.RequestCounts)
+}
+
+func Test_parseActiveKey(t *testing.T) {
+	for _, tenant := range []string{"", "team-a", "a/../b", "default", "t-x"} {
+		gotTenant, id, ok := parseActiveKey(activeKey(tenant, "batch_1"))
+		require.True(t, ok)
+		require.Equal(t, tenant, gotTenant)
+		require.Equal(t, "batch_1", id)
+	}
+	_, _, ok := parseActiveKey("active/unknown/batch_1")
+	require.False(t, ok)
+}
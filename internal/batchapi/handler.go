@@ -0,0 +1,260 @@
+package batchapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// NewHandler returns the handler of the OpenAI Files and Batches APIs:
+//
+//	POST   /v1/files              - Upload a file (multipart form with "file" and "purpose").
+//	GET    /v1/files              - List files.
+//	GET    /v1/files/{id}         - Get a file.
+//	GET    /v1/files/{id}/content - Download the content of a file.
+//	DELETE /v1/files/{id}         - Delete a file.
+//	POST   /v1/batches            - Create a batch.
+//	GET    /v1/batches            - List batches (at most "limit", after the batch ID "after").
+//	GET    /v1/batches/{id}       - Get a batch.
+//	POST   /v1/batches/{id}/cancel - Cancel a batch.
+//
+// Files and batches are scoped to the tenant of the tenant header (if
+// configured).
+func (s *Service) NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, h func(w http.ResponseWriter, r *http.Request, tenant string)) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := s.tenant(r)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			h(w, r, tenant)
+		})
+	}
+	handle("POST /v1/files", s.createFile)
+	handle("GET /v1/files", func(w http.ResponseWriter, r *http.Request, tenant string) {
+		files, err := s.ListFiles(r.Context(), tenant)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if files == nil {
+			files = []*File{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": files})
+	})
+	handle("GET /v1/files/{id}", func(w http.ResponseWriter, r *http.Request, tenant string) {
+		f, err := s.GetFile(r.Context(), tenant, r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, f)
+	})
+	handle("GET /v1/files/{id}/content", func(w http.ResponseWriter, r *http.Request, tenant string) {
+		content, err := s.OpenFileContent(r.Context(), tenant, r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer content.Close()
+		w.Header().Set("Content-Type", "application/jsonl")
+		if _, err := io.Copy(w, content); err != nil {
+			log.Printf("Error writing content of file %v: %v", r.PathValue("id"), err)
+		}
+	})
+	handle("DELETE /v1/files/{id}", func(w http.ResponseWriter, r *http.Request, tenant string) {
+		if err := s.DeleteFile(r.Context(), tenant, r.PathValue("id")); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"id": r.PathValue("id"), "object": "file", "deleted": true})
+	})
+	handle("POST /v1/batches", s.createBatch)
+	handle("GET /v1/batches", s.listBatches)
+	handle("GET /v1/batches/{id}", func(w http.ResponseWriter, r *http.Request, tenant string) {
+		b, err := s.GetBatch(r.Context(), tenant, r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, b)
+	})
+	handle("POST /v1/batches/{id}/cancel", func(w http.ResponseWriter, r *http.Request, tenant string) {
+		b, err := s.CancelBatch(r.Context(), tenant, r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, b)
+	})
+	return mux
+}
+
+// errMissingTenant is returned for requests without the tenant header.
+var errMissingTenant = errors.New("missing tenant")
+
+// tenant returns the tenant of a request (empty if no tenant header is
+// configured).
+func (s *Service) tenant(r *http.Request) (string, error) {
+	if s.tenantHeader == "" {
+		return "", nil
+	}
+	tenant := r.Header.Get(s.tenantHeader)
+	if tenant == "" {
+		return "", fmt.Errorf("%w: the %s header is required", errMissingTenant, s.tenantHeader)
+	}
+	return tenant, nil
+}
+
+// headers returns the forwarded headers of a request.
+func (s *Service) headers(r *http.Request) map[string]string {
+	headers := map[string]string{}
+	for _, h := range append([]string{s.tenantHeader}, s.forwardedHeaders...) {
+		if v := r.Header.Get(h); h != "" && v != "" {
+			headers[h] = v
+		}
+	}
+	return headers
+}
+
+func (s *Service) createFile(w http.ResponseWriter, r *http.Request, tenant string) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxFileBytes+1<<20)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errInvalid, err))
+		return
+	}
+	var (
+		purpose string
+		f       *File
+	)
+	// The purpose is expected before the file (as sent by the OpenAI
+	// clients) so that the file can be streamed to the bucket.
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, fmt.Errorf("%w: %v", errInvalid, err))
+			return
+		}
+		switch part.FormName() {
+		case "purpose":
+			v, err := io.ReadAll(io.LimitReader(part, 64))
+			if err != nil {
+				writeError(w, fmt.Errorf("%w: %v", errInvalid, err))
+				return
+			}
+			purpose = string(v)
+		case "file":
+			if purpose != "batch" {
+				writeError(w, fmt.Errorf("%w: purpose must be \"batch\" and precede the file", errInvalid))
+				return
+			}
+			f, err = s.CreateFile(r.Context(), tenant, part.FileName(), purpose, part)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		part.Close()
+	}
+	if f == nil {
+		writeError(w, fmt.Errorf("%w: missing file", errInvalid))
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+func (s *Service) createBatch(w http.ResponseWriter, r *http.Request, tenant string) {
+	var req struct {
+		InputFileID      string            `json:"input_file_id"`
+		Endpoint         string            `json:"endpoint"`
+		CompletionWindow string            `json:"completion_window"`
+		Metadata         map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errInvalid, err))
+		return
+	}
+	b, err := s.CreateBatch(r.Context(), tenant, s.headers(r), req.InputFileID, req.Endpoint, req.CompletionWindow, req.Metadata)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Service) listBatches(w http.ResponseWriter, r *http.Request, tenant string) {
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, fmt.Errorf("%w: limit must be between 1 and 100", errInvalid))
+			return
+		}
+		limit = n
+	}
+	batches, err := s.ListBatches(r.Context(), tenant)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if after := r.URL.Query().Get("after"); after != "" {
+		for i, b := range batches {
+			if b.ID == after {
+				batches = batches[i+1:]
+				break
+			}
+		}
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	resp := map[string]any{"object": "list", "data": batches, "has_more": hasMore}
+	if len(batches) > 0 {
+		resp["first_id"] = batches[0].ID
+		resp["last_id"] = batches[len(batches)-1].ID
+	} else {
+		resp["data"] = []*Batch{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response with the OpenAI error object.
+// Internal error messages are not leaked to the client.
+func writeError(w http.ResponseWriter, err error) {
+	status, typ, msg := http.StatusInternalServerError, "server_error", http.StatusText(http.StatusInternalServerError)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status, typ, msg = http.StatusNotFound, "invalid_request_error", err.Error()
+	case errors.Is(err, errInvalid):
+		status, typ, msg = http.StatusBadRequest, "invalid_request_error", err.Error()
+	case errors.Is(err, errMissingTenant):
+		status, typ, msg = http.StatusUnauthorized, "invalid_request_error", err.Error()
+	case errors.Is(err, errTooManyBatches):
+		status, typ, msg = http.StatusTooManyRequests, "rate_limit_error", err.Error()
+	default:
+		log.Printf("Batch API error: %v", err)
+	}
+	writeJSON(w, status, map[string]any{"error": map[string]any{
+		"message": msg,
+		"type":    typ,
+		"param":   nil,
+		"code":    nil,
+	}})
+}
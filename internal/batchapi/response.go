@@ -0,0 +1,91 @@
+package batchapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"gocloud.dev/blob"
+)
+
+// contentEncodingMetadataKey is the message metadata key of the compression
+// of response messages (see the compression of messaging streams).
+const contentEncodingMetadataKey = "content-encoding"
+
+// maxResponseBytes limits the size of decompressed response messages and
+// of response bodies that were written to an overflow bucket.
+const maxResponseBytes = 64 << 20
+
+// decompress decompresses a response message with the given content
+// encoding.
+func decompress(encoding string, data []byte) ([]byte, error) {
+	var r io.Reader
+	switch encoding {
+	case "", "identity":
+		return data, nil
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(data),
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(maxResponseBytes),
+			zstd.WithDecoderMaxMemory(maxResponseBytes),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unsupported %s %q", contentEncodingMetadataKey, encoding)
+	}
+	return readLimited(r)
+}
+
+// readBodyURL reads a response body that the messenger wrote to its
+// overflow bucket, i.e. "gs://my-bucket/responses/abc". The path of file://
+// URLs is the directory of the bucket and the key.
+func readBodyURL(ctx context.Context, bodyURL string) ([]byte, error) {
+	u, err := url.Parse(bodyURL)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	u.Path = ""
+	if u.Scheme == "file" {
+		u.Path, key = path.Split(key)
+		u.Path = "/" + u.Path
+	}
+	bucket, err := blob.OpenBucket(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer bucket.Close()
+	r, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r)
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResponseBytes {
+		return nil, fmt.Errorf("response is larger than %d bytes", maxResponseBytes)
+	}
+	return data, nil
+}
@@ -0,0 +1,63 @@
+package bodycodec
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBOR implements the Concise Binary Object Representation (RFC 8949).
+// Unrecognized tags are ignored when decoding (the tagged value is returned),
+// times (tags 0 and 1) are decoded to RFC 3339 strings and bignums (tags 2
+// and 3) to numbers.
+type CBOR struct{}
+
+func (CBOR) MediaType() string { return "application/cbor" }
+
+var (
+	cborEnc = mustCBOREncMode(cbor.EncOptions{
+		Sort: cbor.SortCoreDeterministic,
+	})
+	cborDec = mustCBORDecMode(cbor.DecOptions{
+		MaxNestedLevels:      maxDepth,
+		MaxArrayElements:     math.MaxInt32,
+		MaxMapPairs:          math.MaxInt32,
+		DefaultMapType:       reflect.TypeOf(map[string]any(nil)),
+		BigIntDec:            cbor.BigIntDecodePointer,
+		UnrecognizedTagToAny: cbor.UnrecognizedTagContentToAny,
+		TimeTagToAny:         cbor.TimeTagToRFC3339Nano,
+	})
+)
+
+func (CBOR) Encode(v any) ([]byte, error) {
+	v, err := normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	return cborEnc.Marshal(v)
+}
+
+func (CBOR) Decode(data []byte) (any, error) {
+	var v any
+	if err := cborDec.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func mustCBOREncMode(opts cbor.EncOptions) cbor.EncMode {
+	em, err := opts.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return em
+}
+
+func mustCBORDecMode(opts cbor.DecOptions) cbor.DecMode {
+	dm, err := opts.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return dm
+}
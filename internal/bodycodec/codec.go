@@ -0,0 +1,168 @@
+// Package bodycodec converts request and response bodies between JSON (which
+// model servers expect) and more compact binary encodings (msgpack, CBOR).
+//
+// Codecs operate on JSON-compatible values: map[string]any, []any, string,
+// []byte, bool, nil and numbers (int64, uint64, float32, float64 or json.Number).
+// Decoded floats are always float64 so that float32 values are converted to
+// JSON without losing precision.
+package bodycodec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec encodes and decodes JSON-compatible values.
+type Codec interface {
+	// MediaType is the media type that is set on encoded bodies.
+	MediaType() string
+	Encode(v any) ([]byte, error)
+	Decode(data []byte) (any, error)
+}
+
+var registry = struct {
+	sync.RWMutex
+	byMediaType map[string]Codec
+}{
+	byMediaType: map[string]Codec{},
+}
+
+func init() {
+	Register(MsgPack{}, "application/msgpack", "application/x-msgpack", "application/vnd.msgpack")
+	Register(CBOR{}, "application/cbor")
+}
+
+// Register makes a codec available for the given media types (in addition
+// to its own media type).
+func Register(c Codec, mediaTypes ...string) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.byMediaType[c.MediaType()] = c
+	for _, mt := range mediaTypes {
+		registry.byMediaType[mt] = c
+	}
+}
+
+// Lookup returns the codec for a Content-Type (parameters are ignored).
+// It returns false for JSON and unknown media types.
+func Lookup(contentType string) (Codec, bool) {
+	if contentType == "" {
+		return nil, false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	c, ok := registry.byMediaType[mediaType]
+	return c, ok
+}
+
+// Negotiate returns the codec for the first media type in an Accept header
+// that has a registered codec. If JSON is listed first or no listed media
+// types have a codec, it returns nil (JSON) unless the header is empty or
+// only contains wildcards, in which case fallback is returned.
+func Negotiate(accept string, fallback Codec) Codec {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "*/*", "application/*":
+			continue
+		case "application/json":
+			return nil
+		}
+		if c, ok := Lookup(mediaType); ok {
+			return c
+		}
+	}
+	return fallback
+}
+
+// ToJSON converts an encoded body to JSON.
+func ToJSON(c Codec, data []byte) ([]byte, error) {
+	v, err := c.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", c.MediaType(), err)
+	}
+	return json.Marshal(v)
+}
+
+// FromJSON converts a JSON body to the codec's encoding.
+func FromJSON(c Codec, data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("decoding json: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("decoding json: unexpected data after value")
+	}
+	return c.Encode(v)
+}
+
+// normalize converts the numbers of a value for encoding. JSON numbers
+// without a fraction or exponent are encoded as integers. Floats that can be
+// represented exactly as float32 (i.e. embeddings) are encoded as float32 to
+// save space.
+func normalize(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool, string, []byte, int64, uint64, float32:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		return normalizeFloat(v), nil
+	case json.Number:
+		s := string(v)
+		if !strings.ContainsAny(s, ".eE") {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+			if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return u, nil
+			}
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %w", s, err)
+		}
+		return normalizeFloat(f), nil
+	case []any:
+		arr := make([]any, len(v))
+		for i, item := range v {
+			var err error
+			if arr[i], err = normalize(item); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			var err error
+			if m[k], err = normalize(item); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+func normalizeFloat(f float64) any {
+	if float64(float32(f)) == f {
+		return float32(f)
+	}
+	return f
+}
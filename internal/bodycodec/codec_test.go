@@ -0,0 +1,199 @@
+package bodycodec
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	cases := []struct {
+		name    string
+		json    string
+		msgpack string
+		cbor    string
+	}{
+		{
+			name:    "map",
+			json:    `{"a":1,"b":[true,null]}`,
+			msgpack: "82a16101a16292c3c0",
+			cbor:    "a2616101616282f5f6",
+		},
+		{
+			name:    "negative integers",
+			json:    `[-1,-33,-1000]`,
+			msgpack: "93ffd0dfd1fc18",
+			cbor:    "8320382039 03e7",
+		},
+		{
+			name:    "large integers",
+			json:    `[255,65536,18446744073709551615]`,
+			msgpack: "93ccffce00010000cfffffffffffffffff",
+			cbor:    "8318ff1a000100001bffffffffffffffff",
+		},
+		{
+			name:    "float32",
+			json:    `[0.5]`,
+			msgpack: "91ca3f000000",
+			cbor:    "81fa3f000000",
+		},
+		{
+			name:    "float64",
+			json:    `[0.1]`,
+			msgpack: "91cb3fb999999999999a",
+			cbor:    "81fb3fb999999999999a",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, tc := range []struct {
+				codec Codec
+				hex   string
+			}{
+				{MsgPack{}, c.msgpack},
+				{CBOR{}, c.cbor},
+			} {
+				want, err := hex.DecodeString(removeSpaces(tc.hex))
+				require.NoError(t, err)
+
+				encoded, err := FromJSON(tc.codec, []byte(c.json))
+				require.NoError(t, err)
+				require.Equal(t, want, encoded, tc.codec.MediaType())
+
+				decoded, err := ToJSON(tc.codec, encoded)
+				require.NoError(t, err)
+				require.JSONEq(t, c.json, string(decoded), tc.codec.MediaType())
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	body := `{
+		"model": "my-model",
+		"input": ["a", "` + strings.Repeat("x", 300) + `"],
+		"embedding": [0.0123291015625, -0.5, 1e-7, 123456789.123],
+		"nested": {"deep": [[[{"x": {}}]], []]},
+		"unicode": "héllo wörld"
+	}`
+	for _, c := range []Codec{MsgPack{}, CBOR{}} {
+		encoded, err := FromJSON(c, []byte(body))
+		require.NoError(t, err)
+		require.Less(t, len(encoded), len(body))
+		decoded, err := ToJSON(c, encoded)
+		require.NoError(t, err)
+		require.JSONEq(t, body, string(decoded), c.MediaType())
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	cases := []struct {
+		name string
+		hex  string
+		want string
+	}{
+		{
+			name: "indefinite-length map, array and text",
+			hex:  "bf 61 61 9f 01 02 ff 61 62 7f 62 68 65 62 6c 6f ff ff",
+			want: `{"a":[1,2],"b":"helo"}`,
+		},
+		{
+			name: "half float",
+			hex:  "82 f9 3c00 f9 c400",
+			want: `[1,-4]`,
+		},
+		{
+			name: "tagged value",
+			hex:  "d8 20 63 616263",
+			want: `"abc"`,
+		},
+		{
+			name: "time",
+			hex:  "c1 1a 514b67b0",
+			want: `"2013-03-21T20:04:00Z"`,
+		},
+		{
+			name: "negative integer beyond int64",
+			hex:  "3b ffffffffffffffff",
+			want: `-18446744073709551616`,
+		},
+		{
+			name: "bytes",
+			hex:  "43 010203",
+			want: `"AQID"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := hex.DecodeString(removeSpaces(c.hex))
+			require.NoError(t, err)
+			got, err := ToJSON(CBOR{}, data)
+			require.NoError(t, err)
+			require.JSONEq(t, c.want, string(got))
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		codec Codec
+		hex   string
+	}{
+		{"msgpack truncated", MsgPack{}, "82a161"},
+		{"msgpack huge array", MsgPack{}, "ddffffffff"},
+		{"msgpack non-string key", MsgPack{}, "810101"},
+		{"msgpack trailing data", MsgPack{}, "c0c0"},
+		{"msgpack extension", MsgPack{}, "d40100"},
+		{"cbor truncated", CBOR{}, "a16161"},
+		{"cbor huge map", CBOR{}, "bbffffffffffffffff"},
+		{"cbor unexpected break", CBOR{}, "ff"},
+		{"cbor invalid utf-8", CBOR{}, "61ff"},
+		{"msgpack invalid utf-8", MsgPack{}, "a1ff"},
+		{"msgpack too deep", MsgPack{}, strings.Repeat("91", maxDepth+1) + "c0"},
+		{"cbor too deep", CBOR{}, strings.Repeat("81", maxDepth+1) + "f6"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := hex.DecodeString(c.hex)
+			require.NoError(t, err)
+			_, err = c.codec.Decode(data)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c, ok := Lookup("application/x-msgpack; charset=binary")
+	require.True(t, ok)
+	require.Equal(t, MsgPack{}, c)
+
+	c, ok = Lookup("application/cbor")
+	require.True(t, ok)
+	require.Equal(t, CBOR{}, c)
+
+	_, ok = Lookup("application/json")
+	require.False(t, ok)
+	_, ok = Lookup("")
+	require.False(t, ok)
+}
+
+func TestNegotiate(t *testing.T) {
+	require.Equal(t, CBOR{}, Negotiate("", CBOR{}))
+	require.Equal(t, CBOR{}, Negotiate("*/*", CBOR{}))
+	require.Equal(t, MsgPack{}, Negotiate("application/msgpack, application/json", nil))
+	require.Nil(t, Negotiate("application/json, application/msgpack", CBOR{}))
+	require.Equal(t, CBOR{}, Negotiate("text/html", CBOR{}))
+}
+
+func removeSpaces(s string) string {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' {
+			out = append(out, s[i])
+		}
+	}
+	return string(out)
+}
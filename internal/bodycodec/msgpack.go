@@ -0,0 +1,134 @@
+package bodycodec
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// maxDepth limits the nesting of decoded values.
+const maxDepth = 1000
+
+// MsgPack implements the MessagePack encoding (https://msgpack.org).
+// Extension types are not supported.
+type MsgPack struct{}
+
+func (MsgPack) MediaType() string { return "application/msgpack" }
+
+func (MsgPack) Encode(v any) ([]byte, error) {
+	v, err := normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgPack) Decode(data []byte) (any, error) {
+	r := bytes.NewReader(data)
+	d := &msgPackDecoder{Decoder: msgpack.NewDecoder(r), r: r}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("unexpected data after value at offset %d", len(data)-r.Len())
+	}
+	return v, nil
+}
+
+// msgPackDecoder decodes arrays and maps itself so that their nesting
+// and preallocated sizes can be limited.
+type msgPackDecoder struct {
+	*msgpack.Decoder
+	r *bytes.Reader
+}
+
+func (d *msgPackDecoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("maximum nesting depth exceeded")
+	}
+	c, err := d.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+		n, err := d.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		// Each item is at least 1 byte.
+		arr := make([]any, 0, min(n, d.r.Len()))
+		for i := 0; i < n; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case msgpcode.IsFixedMap(c) || c == msgpcode.Map16 || c == msgpcode.Map32:
+		n, err := d.DecodeMapLen()
+		if err != nil {
+			return nil, err
+		}
+		// Each entry is at least 2 bytes.
+		m := make(map[string]any, min(n, d.r.Len()/2))
+		for i := 0; i < n; i++ {
+			if c, err := d.PeekCode(); err != nil {
+				return nil, err
+			} else if !msgpcode.IsString(c) {
+				return nil, fmt.Errorf("unsupported map key type 0x%02x", c)
+			}
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k.(string)] = v
+		}
+		return m, nil
+	case msgpcode.IsExt(c):
+		return nil, fmt.Errorf("unsupported msgpack extension type 0x%02x", c)
+	}
+
+	v, err := d.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case string:
+		if !utf8.ValidString(v) {
+			return nil, fmt.Errorf("invalid utf-8 string")
+		}
+	}
+	return v, nil
+}
@@ -3,7 +3,13 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -17,10 +23,20 @@ type System struct {
 
 	ModelLoading ModelLoading `json:"modelLoading" validate:"required"`
 
-	ResourceProfiles map[string]ResourceProfile `json:"resourceProfiles" validate:"required"`
+	ResourceProfiles map[string]ResourceProfile `json:"resourceProfiles" validate:"required,dive"`
 
 	CacheProfiles map[string]CacheProfile `json:"cacheProfiles"`
 
+	// ModelNamespaces are the namespaces (besides the namespace KubeAI is
+	// deployed in) that Models are watched in and served from. If Models in
+	// multiple namespaces have the same name, the Model in the earliest
+	// namespace is served (KubeAI's own namespace comes first).
+	ModelNamespaces []string `json:"modelNamespaces,omitempty" validate:"dive,required"`
+
+	// Spot identifies the spot (preemptible) Nodes that Models with a
+	// capacity type are placed on or kept off.
+	Spot Spot `json:"spot,omitempty"`
+
 	Messaging Messaging `json:"messaging"`
 
 	// MetricsAddr is the address the metric endpoint binds to.
@@ -31,6 +47,12 @@ type System struct {
 	// Defaults to ":8081"
 	HealthAddress string `json:"healthAddress" validate:"required"`
 
+	// AdminAddr is the address the admin API (draining and debug logs)
+	// binds to. The admin API is not authenticated, so it only listens on
+	// the loopback interface by default (reachable via kubectl port-forward).
+	// Defaults to "127.0.0.1:8082"
+	AdminAddr string `json:"adminAddr" validate:"required"`
+
 	ModelAutoscaling ModelAutoscaling `json:"modelAutoscaling" validate:"required"`
 
 	ModelServerPods ModelServerPods `json:"modelServerPods,omitempty"`
@@ -39,6 +61,18 @@ type System struct {
 
 	LeaderElection LeaderElection `json:"leaderElection"`
 
+	Shutdown Shutdown `json:"shutdown"`
+
+	Metrics Metrics `json:"metrics"`
+
+	ModelProxy ModelProxy `json:"modelProxy"`
+
+	// ModelValidation configures the validating admission webhook for Models.
+	ModelValidation ModelValidation `json:"modelValidation,omitempty"`
+
+	// Webhooks are notified of Model lifecycle and traffic events.
+	Webhooks []Webhook `json:"webhooks,omitempty" validate:"dive"`
+
 	// AllowPodAddressOverride will allow the pod address to be overridden by the Model objects. Useful for development purposes.
 	AllowPodAddressOverride bool `json:"allowPodAddressOverride"`
 
@@ -46,6 +80,18 @@ type System struct {
 	FixedSelfMetricAddrs []string `json:"fixedSelfMetricAddrs,omitempty"`
 }
 
+// ServedNamespaces returns the namespaces that Models are served from in
+// order of precedence, starting with the given namespace of KubeAI.
+func (s *System) ServedNamespaces(namespace string) []string {
+	namespaces := []string{namespace}
+	for _, ns := range s.ModelNamespaces {
+		if !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
 func (s *System) DefaultAndValidate() error {
 	if s.MetricsAddr == "" {
 		s.MetricsAddr = ":8080"
@@ -53,11 +99,138 @@ func (s *System) DefaultAndValidate() error {
 	if s.HealthAddress == "" {
 		s.HealthAddress = ":8081"
 	}
+	if s.AdminAddr == "" {
+		s.AdminAddr = "127.0.0.1:8082"
+	}
+	if s.ModelValidation.Port == 0 {
+		s.ModelValidation.Port = 9443
+	}
 
+	streamNames := map[string]struct{}{}
 	for i := range s.Messaging.Streams {
+		if s.Messaging.Streams[i].Name == "" {
+			s.Messaging.Streams[i].Name = strconv.Itoa(i)
+		}
+		if _, ok := streamNames[s.Messaging.Streams[i].Name]; ok {
+			return fmt.Errorf("messaging.streams[%d]: duplicate name %q", i, s.Messaging.Streams[i].Name)
+		}
+		streamNames[s.Messaging.Streams[i].Name] = struct{}{}
 		if s.Messaging.Streams[i].MaxHandlers == 0 {
 			s.Messaging.Streams[i].MaxHandlers = 1
 		}
+		if k := s.Messaging.Streams[i].Transport.Keepalive; k != nil {
+			if k.Timeout.Duration == 0 {
+				k.Timeout.Duration = time.Minute
+			}
+			if k.Interval.Duration == 0 {
+				k.Interval.Duration = k.Timeout.Duration / 2
+			}
+		}
+		if k := s.Messaging.Streams[i].Transport.Kafka; k != nil && k.MaxBufferedMessages == 0 {
+			k.MaxBufferedMessages = 100
+		}
+		if s.Messaging.Streams[i].Batches.ProgressInterval.Duration == 0 {
+			s.Messaging.Streams[i].Batches.ProgressInterval.Duration = 30 * time.Second
+		}
+		if p := s.Messaging.Streams[i].Priorities; p != nil {
+			if p.MetadataKey == "" {
+				p.MetadataKey = "priority"
+			}
+			if len(p.Classes) == 0 {
+				p.Classes = []string{"high", "normal", "low"}
+			}
+			if p.Default == "" {
+				p.Default = p.Classes[len(p.Classes)-1]
+				if slices.Contains(p.Classes, "normal") {
+					p.Default = "normal"
+				}
+			}
+			if p.MaxQueued == 0 {
+				p.MaxQueued = s.Messaging.Streams[i].MaxHandlers
+			}
+		}
+		if l := s.Messaging.Streams[i].ConcurrencyLimits; l != nil && l.MaxWaiting == 0 {
+			l.MaxWaiting = s.Messaging.Streams[i].MaxHandlers
+		}
+		if a := s.Messaging.Streams[i].AdaptiveHandlers; a != nil {
+			if a.MinHandlers == 0 {
+				a.MinHandlers = 1
+			}
+			if a.MaxErrorPercent == 0 {
+				a.MaxErrorPercent = 5
+			}
+			if a.Interval.Duration == 0 {
+				a.Interval.Duration = 10 * time.Second
+			}
+		}
+		if c := s.Messaging.Streams[i].Compression; c != nil {
+			if c.Encoding == "" {
+				c.Encoding = "gzip"
+			}
+			if c.MinBytes == 0 {
+				c.MinBytes = 16 * 1024
+			}
+		}
+		if e := s.Messaging.Streams[i].EmbeddingCoalescing; e != nil {
+			if e.MaxBatchSize == 0 {
+				e.MaxBatchSize = 32
+			}
+			if e.MaxLatency.Duration == 0 {
+				e.MaxLatency.Duration = 20 * time.Millisecond
+			}
+		}
+		for j := range s.Messaging.Streams[i].ForwardedMetadata {
+			if f := &s.Messaging.Streams[i].ForwardedMetadata[j]; f.Header == "" {
+				f.Header = f.Key
+			}
+		}
+		if d := s.Messaging.Streams[i].Deduplication; d != nil {
+			if d.TTL.Duration == 0 {
+				d.TTL.Duration = time.Hour
+			}
+			if d.MaxEntries == 0 {
+				d.MaxEntries = 10000
+			}
+			if r := d.Redis; r != nil {
+				if r.KeyPrefix == "" {
+					r.KeyPrefix = "kubeai:responses:"
+				}
+				if r.Timeout.Duration == 0 {
+					r.Timeout.Duration = time.Second
+				}
+			}
+		}
+		if s.Messaging.Streams[i].DeadLetter != nil && s.Messaging.Streams[i].MaxAttempts == 0 {
+			s.Messaging.Streams[i].MaxAttempts = 5
+		}
+		if o := s.Messaging.Streams[i].Overflow; o != nil && o.MaxMessageBytes == 0 {
+			o.MaxMessageBytes = 240 * 1024
+		}
+		if err := s.Messaging.Streams[i].validate(); err != nil {
+			return fmt.Errorf("messaging.streams[%d]: %w", i, err)
+		}
+	}
+	if idx := s.Messaging.RequestIndex; idx != nil && idx.Retention.Duration == 0 {
+		idx.Retention.Duration = 24 * time.Hour
+	}
+	if b := s.Messaging.BatchAPI; b != nil {
+		if b.MaxRequests == 0 {
+			b.MaxRequests = 50000
+		}
+		if b.MaxFileBytes == 0 {
+			b.MaxFileBytes = 200 << 20
+		}
+		if b.MaxActiveBatches == 0 {
+			b.MaxActiveBatches = 100
+		}
+		if b.TenantHeader != "" && !headerNameRegexp.MatchString(b.TenantHeader) {
+			return fmt.Errorf("messaging.batchAPI.tenantHeader: invalid header name %q", b.TenantHeader)
+		}
+		for _, h := range b.ForwardedHeaders {
+			if !headerNameRegexp.MatchString(h) {
+				return fmt.Errorf("messaging.batchAPI.forwardedHeaders: invalid header name %q", h)
+			}
+		}
 	}
 
 	if s.ModelAutoscaling.Interval.Duration == 0 {
@@ -66,6 +239,16 @@ func (s *System) DefaultAndValidate() error {
 	if s.ModelAutoscaling.TimeWindow.Duration == 0 {
 		s.ModelAutoscaling.TimeWindow.Duration = 10 * time.Minute
 	}
+	if s.ModelAutoscaling.RecommendationWindow.Duration == 0 {
+		s.ModelAutoscaling.RecommendationWindow.Duration = 24 * time.Hour
+	}
+
+	for name, pc := range s.ModelAutoscaling.PriorityClasses {
+		if pc.PreemptAfter.Duration == 0 {
+			pc.PreemptAfter.Duration = time.Minute
+			s.ModelAutoscaling.PriorityClasses[name] = pc
+		}
+	}
 
 	if s.LeaderElection.LeaseDuration.Duration == 0 {
 		s.LeaderElection.LeaseDuration.Duration = 15 * time.Second
@@ -77,6 +260,72 @@ func (s *System) DefaultAndValidate() error {
 		s.LeaderElection.RetryPeriod.Duration = 2 * time.Second
 	}
 
+	if s.Metrics.Alerts.ErrorRatePercent == 0 {
+		s.Metrics.Alerts.ErrorRatePercent = 10
+	}
+	if s.Metrics.Alerts.MinRequests == 0 {
+		s.Metrics.Alerts.MinRequests = 10
+	}
+	if s.Metrics.Alerts.QueueGrowthIntervals == 0 {
+		s.Metrics.Alerts.QueueGrowthIntervals = 6
+	}
+	if s.Metrics.Alerts.NoReadyEndpointsAfter.Duration == 0 {
+		s.Metrics.Alerts.NoReadyEndpointsAfter.Duration = 15 * time.Minute
+	}
+
+	if s.Shutdown.DrainTimeout.Duration == 0 {
+		s.Shutdown.DrainTimeout.Duration = 5 * time.Second
+	}
+
+	for i := range s.Webhooks {
+		if s.Webhooks[i].Timeout.Duration == 0 {
+			s.Webhooks[i].Timeout.Duration = 5 * time.Second
+		}
+	}
+
+	if s.ModelServerPods.TerminationGracePeriod.Duration == 0 {
+		s.ModelServerPods.TerminationGracePeriod.Duration = 10 * time.Minute
+	}
+
+	if s.ModelProxy.StreamBufferSize == 0 {
+		s.ModelProxy.StreamBufferSize = 64
+	}
+	if s.ModelProxy.SlowClientPolicy == "" {
+		s.ModelProxy.SlowClientPolicy = SlowClientPolicyBlock
+	}
+	if s.ModelProxy.Dialer.ConnectTimeout.Duration == 0 {
+		s.ModelProxy.Dialer.ConnectTimeout.Duration = 5 * time.Second
+	}
+	if s.ModelProxy.Dialer.KeepAlive.Duration == 0 {
+		s.ModelProxy.Dialer.KeepAlive.Duration = 30 * time.Second
+	}
+	if s.ModelProxy.Dialer.IdleConnTimeout.Duration == 0 {
+		s.ModelProxy.Dialer.IdleConnTimeout.Duration = 90 * time.Second
+	}
+	if s.ModelProxy.Dialer.AddressCacheTTL.Duration == 0 {
+		s.ModelProxy.Dialer.AddressCacheTTL.Duration = 30 * time.Second
+	}
+	if e := s.ModelProxy.EmbeddingCoalescing; e != nil {
+		if e.MaxBatchSize == 0 {
+			e.MaxBatchSize = 32
+		}
+		if e.MaxLatency.Duration == 0 {
+			e.MaxLatency.Duration = 10 * time.Millisecond
+		}
+	}
+
+	for _, pattern := range s.ModelProxy.PassthroughPathAllowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid modelProxy.passthroughPathAllowlist pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, rp := range s.ResourceProfiles {
+		if rp.WarmPool != nil && rp.WarmPool.Multiple == 0 {
+			rp.WarmPool.Multiple = 1
+		}
+	}
+
 	if s.CacheProfiles == nil {
 		s.CacheProfiles = map[string]CacheProfile{}
 	}
@@ -111,6 +360,29 @@ type LeaderElection struct {
 	RetryPeriod Duration `json:"retryPeriod"`
 }
 
+type ModelValidation struct {
+	// Enabled serves the validating admission webhook that rejects Models
+	// with args that KubeAI sets or that do not fit their resource profile
+	// (i.e. a tensor parallel size above the GPU count).
+	Enabled bool `json:"enabled,omitempty"`
+	// Port of the webhook server.
+	// Defaults to 9443.
+	Port int `json:"port,omitempty"`
+	// CertDir is the directory of the serving certificate of the webhook
+	// server (tls.crt and tls.key).
+	// Defaults to "/tmp/k8s-webhook-server/serving-certs".
+	CertDir string `json:"certDir,omitempty"`
+}
+
+type Shutdown struct {
+	// DrainTimeout is the maximum amount of time to wait for in-flight
+	// requests and messages to complete when shutting down. Requests that
+	// are still in-flight after this time are cancelled.
+	// Should be less than the Pod's terminationGracePeriodSeconds.
+	// Defaults to 5 seconds.
+	DrainTimeout Duration `json:"drainTimeout"`
+}
+
 type ModelRollouts struct {
 	// Surge is the number of additional Pods to create when rolling out an update.
 	Surge int32 `json:"surge"`
@@ -130,6 +402,70 @@ type ModelAutoscaling struct {
 	// its state.
 	// Required.
 	StateConfigMapName string `json:"stateConfigMapName" validate:"required"`
+	// MaxScaleUpReplicas is the maximum number of replicas that will be
+	// added to a Model in a single autoscaling interval.
+	// Defaults to 0 (no limit).
+	MaxScaleUpReplicas int32 `json:"maxScaleUpReplicas" validate:"gte=0"`
+	// MaxScaleUpPercent is the maximum number of replicas that will be
+	// added to a Model in a single autoscaling interval, as a percentage of
+	// the current number of replicas. At least one replica can always be added.
+	// Defaults to 0 (no limit).
+	MaxScaleUpPercent int32 `json:"maxScaleUpPercent" validate:"gte=0"`
+	// PauseScaleUpWhileWaitingForNodes keeps Models at their current
+	// replicas while they have unschedulable Pods (the WaitingForNodes
+	// condition), so that no additional Pods are queued until the Nodes
+	// that are being provisioned (i.e. by a cluster autoscaler) arrive.
+	// Defaults to false.
+	PauseScaleUpWhileWaitingForNodes bool `json:"pauseScaleUpWhileWaitingForNodes"`
+	// RecommendationWindow is the amount of load history that replica
+	// right-sizing recommendations (.status.recommendation) are based on.
+	// Defaults to 24 hours.
+	RecommendationWindow Duration `json:"recommendationWindow"`
+	// GPUUtilizationMetricsURL is a metrics endpoint (in the Prometheus text
+	// format) that serves the DCGM_FI_DEV_GPU_UTIL metric of the NVIDIA DCGM
+	// exporter, labeled with the pod and namespace that use each GPU. For
+	// example the /federate endpoint of a Prometheus server that scrapes the
+	// DCGM exporters. Required for Models with a targetGPUUtilizationPercent.
+	GPUUtilizationMetricsURL string `json:"gpuUtilizationMetricsURL,omitempty"`
+	// PriorityClasses that Models can reference by name (.spec.priorityClassName).
+	// Models without a priority class have a priority of 0.
+	PriorityClasses map[string]PriorityClass `json:"priorityClasses,omitempty" validate:"dive"`
+}
+
+// PriorityClass allows Models to preempt (scale down) Models with a lower
+// priority when their Pods are unable to be scheduled (i.e. due to a lack of GPUs).
+type PriorityClass struct {
+	// Value is the priority of Models in this class. Higher values
+	// take precedence.
+	Value int32 `json:"value"`
+	// PreemptAfter is the amount of time that a Model's Pods need to be
+	// unschedulable before lower-priority Models with the same resource
+	// profile are scaled down to make room.
+	// Defaults to 1 minute.
+	PreemptAfter Duration `json:"preemptAfter"`
+}
+
+// Priority returns the priority value of the given priority class name.
+func (a *ModelAutoscaling) Priority(className string) int32 {
+	return a.PriorityClasses[className].Value
+}
+
+// LimitScaleUp returns the desired number of replicas capped by the
+// MaxScaleUpReplicas and MaxScaleUpPercent limits. When both limits are set,
+// the stricter one applies.
+func (a *ModelAutoscaling) LimitScaleUp(current, desired int32) int32 {
+	if desired <= current {
+		return desired
+	}
+	limit := desired
+	if a.MaxScaleUpReplicas > 0 {
+		limit = min(limit, current+a.MaxScaleUpReplicas)
+	}
+	if a.MaxScaleUpPercent > 0 {
+		step := int32(math.Ceil(float64(current) * float64(a.MaxScaleUpPercent) / 100))
+		limit = min(limit, current+max(step, 1))
+	}
+	return limit
 }
 
 // RequiredConsecutiveScaleDowns returns the number of consecutive scale down
@@ -139,12 +475,212 @@ func (a *ModelAutoscaling) RequiredConsecutiveScaleDowns(scaleDownDelaySeconds i
 	return int(math.Ceil(float64(time.Duration(scaleDownDelaySeconds)*time.Second) / float64(a.Interval.Duration)))
 }
 
+// RequiredConsecutiveScaleUps returns the number of consecutive scale up
+// operations required before the deployment is scaled up. This is calculated
+// by dividing the ScaleUpDelay by the Interval.
+func (a *ModelAutoscaling) RequiredConsecutiveScaleUps(scaleUpDelaySeconds int64) int {
+	return a.RequiredConsecutiveScaleDowns(scaleUpDelaySeconds)
+}
+
+// RecommendationWindowCount returns the number of intervals that will be
+// considered when calculating right-sizing recommendations.
+func (a *ModelAutoscaling) RecommendationWindowCount() int {
+	return int(math.Ceil(float64(a.RecommendationWindow.Duration) / float64(a.Interval.Duration)))
+}
+
 // AverageWindowCount returns the number of intervals that will be considered when
 // calculating the average value.
 func (a *ModelAutoscaling) AverageWindowCount() int {
 	return int(math.Ceil(float64(a.TimeWindow.Duration) / float64(a.Interval.Duration)))
 }
 
+type ModelProxy struct {
+	// StreamBufferSize is the maximum number of server-sent events that are
+	// read ahead from a model server for a streaming response before
+	// the SlowClientPolicy is applied.
+	// Defaults to 64.
+	StreamBufferSize int `json:"streamBufferSize" validate:"gte=1"`
+	// SlowClientPolicy determines what happens when a client reads a
+	// streaming response slower than the model server produces it and
+	// the stream buffer is full. One of:
+	//
+	// "Block": Stop reading from the model server until the client catches up.
+	// "Coalesce": Merge buffered text chunks into fewer events, falling back to "Block"
+	// when there is nothing left to merge.
+	//
+	// Defaults to "Block".
+	SlowClientPolicy string `json:"slowClientPolicy" validate:"oneof=Block Coalesce"`
+	// PassthroughPathAllowlist is the list of model server paths that Models
+	// are allowed to expose via .spec.passthroughPaths. Paths may contain
+	// wildcards (see https://pkg.go.dev/path#Match).
+	// No passthrough paths are served if empty.
+	PassthroughPathAllowlist []string `json:"passthroughPathAllowlist,omitempty" validate:"dive,startswith=/"`
+	// MaxParkDuration is the maximum amount of time that a request waits for
+	// an endpoint of a Model without ready replicas (i.e. scaled to zero).
+	// Requests that wait longer are rejected with a 503 response and a
+	// Retry-After header with the estimated remaining cold start time.
+	// Applies to Models that do not set .spec.maxScaleFromZeroWaitSeconds
+	// or .spec.maxQueueWaitSeconds.
+	// Zero means no limit.
+	MaxParkDuration Duration `json:"maxParkDuration"`
+	// Dialer configures the connections to model servers.
+	Dialer ModelProxyDialer `json:"dialer"`
+	// EmbeddingCoalescing coalesces concurrent embeddings requests for the
+	// same model into one request to a model server (with the inputs of
+	// all requests), which increases the throughput of model servers that
+	// process batches of inputs for clients that send many small requests.
+	// Disabled if not set.
+	EmbeddingCoalescing *ModelProxyEmbeddingCoalescing `json:"embeddingCoalescing,omitempty"`
+	// Moderation configures the Moderation Model (see the Moderation feature
+	// of Models) that serves /v1/moderations requests without a model and
+	// the safety policies of Models that do not name a Moderation Model.
+	Moderation *ModelProxyModeration `json:"moderation,omitempty"`
+	// StructuredOutputs checks that the outputs of non-streamed chat
+	// completion requests with a JSON response_format (json_schema or
+	// json_object) are valid JSON that matches the schema of the request
+	// before they are returned, because smaller models often generate
+	// invalid JSON. Disabled if not set.
+	StructuredOutputs *ModelProxyStructuredOutputs `json:"structuredOutputs,omitempty"`
+}
+
+type ModelProxyStructuredOutputs struct {
+	// MaxRetries is the number of times that a request is sent again if
+	// its output does not match the schema. The last output is returned
+	// if no output matched.
+	// Defaults to 0 (outputs are only checked and counted).
+	MaxRetries int `json:"maxRetries,omitempty" validate:"gte=0"`
+	// Repair fixes common mistakes of outputs before they are checked:
+	// code fences and text around the JSON value, trailing commas,
+	// control characters in strings and the unterminated strings, arrays
+	// and objects of truncated outputs.
+	Repair bool `json:"repair,omitempty"`
+}
+
+type ModelProxyModeration struct {
+	// Model is the name of the default Moderation Model.
+	Model string `json:"model" validate:"required"`
+}
+
+type ModelProxyEmbeddingCoalescing struct {
+	// MaxBatchSize is the maximum number of inputs that are sent to a
+	// model server in one request. Requests with more inputs are not
+	// coalesced with other requests.
+	// Defaults to 32.
+	MaxBatchSize int `json:"maxBatchSize,omitempty" validate:"gte=0"`
+	// MaxLatency is the maximum time that a request waits for other
+	// requests to be coalesced with.
+	// Defaults to 10 milliseconds.
+	MaxLatency Duration `json:"maxLatency,omitempty"`
+}
+
+// ModelProxyDialer configures how connections to model servers are dialed.
+type ModelProxyDialer struct {
+	// ConnectTimeout is the maximum amount of time that a connection to a
+	// model server may take to establish. Connection attempts that time out
+	// are retried like other failed requests.
+	// Defaults to 5 seconds.
+	ConnectTimeout Duration `json:"connectTimeout"`
+	// KeepAlive is the interval between TCP keep-alive probes on idle
+	// connections, which keeps conntrack entries of pooled connections
+	// from expiring. Negative disables keep-alive probes.
+	// Defaults to 30 seconds.
+	KeepAlive Duration `json:"keepAlive"`
+	// IdleConnTimeout is the maximum amount of time that a pooled connection
+	// to a model server is kept open without being used.
+	// Defaults to 90 seconds.
+	IdleConnTimeout Duration `json:"idleConnTimeout"`
+	// AddressCacheTTL is how long the resolved IP addresses of an endpoint
+	// hostname (i.e. of an external endpoint) are cached. Endpoints that
+	// are IP addresses (i.e. Pods) are never resolved.
+	// Defaults to 30 seconds.
+	AddressCacheTTL Duration `json:"addressCacheTTL"`
+}
+
+// PassthroughPathAllowed returns true if the given model server path
+// matches the PassthroughPathAllowlist.
+func (p ModelProxy) PassthroughPathAllowed(urlPath string) bool {
+	for _, pattern := range p.PassthroughPathAllowlist {
+		if ok, _ := path.Match(pattern, urlPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	SlowClientPolicyBlock    = "Block"
+	SlowClientPolicyCoalesce = "Coalesce"
+)
+
+// Webhook is an HTTP endpoint that events are POSTed to as JSON.
+type Webhook struct {
+	// URL that events are POSTed to.
+	URL string `json:"url" validate:"required,url"`
+	// Events are the types of events that are sent to the webhook.
+	// All events are sent if empty.
+	Events []string `json:"events,omitempty" validate:"dive,oneof=ColdStartCompleted ScaledToZero AlertFiring AlertResolved"`
+	// Headers are added to each request (i.e. for authorization).
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout of each delivery attempt.
+	// Defaults to 5 seconds.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+type Metrics struct {
+	// RequestTags are extracted from incoming requests and recorded as
+	// attributes on request metrics. Tags should be low-cardinality
+	// (e.g. team, app, environment).
+	RequestTags []RequestTag `json:"requestTags" validate:"dive"`
+	// Alerts are evaluated by the autoscaler on KubeAI's own metrics
+	// and reported as Events on Models.
+	Alerts Alerts `json:"alerts"`
+}
+
+// Alerts configures the anomalies that are detected for each Model.
+type Alerts struct {
+	// Disabled turns off alert evaluation.
+	Disabled bool `json:"disabled"`
+	// ErrorRatePercent is the percentage of requests failing with a server
+	// error (5xx) within an autoscaling interval that triggers the
+	// HighErrorRate alert.
+	// Defaults to 10.
+	ErrorRatePercent int32 `json:"errorRatePercent" validate:"gte=0,lte=100"`
+	// MinRequests is the minimum number of requests within an autoscaling
+	// interval for the error rate to be evaluated.
+	// Defaults to 10.
+	MinRequests int64 `json:"minRequests" validate:"gte=0"`
+	// QueueGrowthIntervals is the number of consecutive autoscaling intervals
+	// in which the queued requests (active requests and messaging backlog)
+	// need to grow to trigger the QueueGrowing alert.
+	// Defaults to 6.
+	QueueGrowthIntervals int `json:"queueGrowthIntervals" validate:"gte=0"`
+	// NoReadyEndpointsAfter is the amount of time that a Model with desired
+	// replicas needs to have no ready replicas to trigger the
+	// NoReadyEndpoints alert.
+	// Defaults to 15 minutes.
+	NoReadyEndpointsAfter Duration `json:"noReadyEndpointsAfter"`
+}
+
+// RequestTag describes where the value of a request metric attribute
+// comes from. Exactly one source (Header, JWTClaim, or Env) should be set.
+type RequestTag struct {
+	// Name of the tag. Recorded as the "request.tag.<name>" attribute.
+	Name string `json:"name" validate:"required"`
+	// Header is the name of the HTTP header (or message metadata key
+	// for messenger requests) that contains the tag value.
+	Header string `json:"header" validate:"required_without_all=JWTClaim Env"`
+	// JWTClaim is the name of a claim in the bearer token of the
+	// Authorization header that contains the tag value.
+	// NOTE: The token signature is not verified, tags are only used for reporting.
+	JWTClaim string `json:"jwtClaim" validate:"required_without_all=Header Env"`
+	// Env is the name of an environment variable of the KubeAI process
+	// that contains the tag value (i.e. a static tag for all requests).
+	Env string `json:"env" validate:"required_without_all=Header JWTClaim"`
+	// AllowedValues limits the cardinality of the tag. Values that are
+	// not in the list are recorded as "other". Empty means all values are allowed.
+	AllowedValues []string `json:"allowedValues,omitempty"`
+}
+
 type SecretNames struct {
 	Alibaba     string `json:"alibaba" required:"true"`
 	AWS         string `json:"aws" required:"true"`
@@ -156,7 +692,68 @@ type Messaging struct {
 	// ErrorMaxBackoff is the maximum backoff time that will be applied when
 	// consecutive errors are encountered.
 	ErrorMaxBackoff Duration        `json:"errorMaxBackoff"`
-	Streams         []MessageStream `json:"streams"`
+	Streams         []MessageStream `json:"streams" validate:"dive"`
+	// RequestIndex records the status of the request messages of all
+	// streams so that they can be queried. Disabled if not set.
+	RequestIndex *MessageRequestIndex `json:"requestIndex,omitempty"`
+	// BatchAPI serves the OpenAI Batch API (/openai/v1/batches and
+	// /openai/v1/files) on top of a stream. Disabled if not set.
+	BatchAPI *MessageBatchAPI `json:"batchAPI,omitempty"`
+}
+
+type MessageBatchAPI struct {
+	// RequestsURL is the topic that the requests of batches are published
+	// to, the topic of the requestsURL subscription of a stream.
+	// Example: "gcppubsub://projects/my-project/topics/requests"
+	RequestsURL string `json:"requestsURL" validate:"required"`
+	// ResponsesURL is the topic that the responses of batch requests are
+	// published to. It must be allowed by the responseTopics of the stream.
+	// Example: "gcppubsub://projects/my-project/topics/batch-responses"
+	ResponsesURL string `json:"responsesURL" validate:"required"`
+	// ResponsesSubscriptionURL is the subscription of the ResponsesURL topic
+	// that the responses are received from.
+	// Example: "gcppubsub://projects/my-project/subscriptions/batch-responses"
+	ResponsesSubscriptionURL string `json:"responsesSubscriptionURL" validate:"required"`
+	// FilesURL is the bucket that uploaded files, batches and their output
+	// files are stored in (see https://gocloud.dev/howto/blob/).
+	// Example: "gs://my-bucket?prefix=batches/"
+	FilesURL string `json:"filesURL" validate:"required"`
+	// MaxRequests is the maximum number of requests of a batch.
+	// Defaults to 50000.
+	MaxRequests int `json:"maxRequests,omitempty" validate:"gte=0"`
+	// MaxFileBytes is the maximum size of uploaded files.
+	// Defaults to 200MiB.
+	MaxFileBytes int64 `json:"maxFileBytes,omitempty" validate:"gte=0"`
+	// MaxActiveBatches is the maximum number of batches that are validated
+	// or in progress at the same time (of all tenants). Creating more
+	// batches fails with 429 Too Many Requests.
+	// Defaults to 100.
+	MaxActiveBatches int `json:"maxActiveBatches,omitempty" validate:"gte=0"`
+	// TenantHeader is the request header that identifies the tenant of
+	// files and batches (i.e. set by an authenticating gateway). Tenants
+	// only see their own files and batches, requests without the header
+	// are rejected. All requests share one tenant if empty.
+	// Example: "X-Tenant"
+	TenantHeader string `json:"tenantHeader,omitempty"`
+	// ForwardedHeaders are the headers of requests that create batches
+	// which are set as metadata of the request messages of the batch (with
+	// the header name as the metadata key), so that admission policies and
+	// the forwardedMetadata of the stream see them like the headers of API
+	// requests. The TenantHeader is always forwarded.
+	// Example: ["X-Team", "X-Priority"]
+	ForwardedHeaders []string `json:"forwardedHeaders,omitempty"`
+}
+
+type MessageRequestIndex struct {
+	// URL of the document collection that requests are recorded in
+	// (see https://gocloud.dev/howto/docstore/). The key field of the
+	// collection must be "id".
+	// Example: "mem://requests/id?filename=/data/requests.gob"
+	URL string `json:"url" validate:"required"`
+	// Retention is the amount of time after their last update that
+	// requests are removed from the index.
+	// Defaults to 24 hours.
+	Retention Duration `json:"retention,omitempty"`
 }
 
 type Duration struct {
@@ -196,6 +793,77 @@ type ResourceProfile struct {
 	Affinity         *corev1.Affinity    `json:"affinity,omitempty"`
 	Tolerations      []corev1.Toleration `json:"tolerations,omitempty"`
 	RuntimeClassName *string             `json:"runtimeClassName,omitempty"`
+	// WarmPool keeps placeholder Pods running on Nodes of this profile
+	// so that Models can be scaled from zero without waiting for a Node
+	// to be provisioned and the server image to be pulled.
+	WarmPool *WarmPool `json:"warmPool,omitempty"`
+	// GPUSharing packs multiple Pods onto each physical GPU with MIG slices
+	// or time-slicing (both configured with the NVIDIA GPU operator). The GPU
+	// requests, limits and node selector of the profile are derived from it,
+	// each unit of the profile (i.e. "nvidia-gpu-a100-1g:1") is one slice.
+	GPUSharing *GPUSharing `json:"gpuSharing,omitempty"`
+	// Accelerator is the type of the accelerator of the profile. It selects
+	// device-specific model server args and the server image if ImageName is
+	// not set. Inferred from the accelerator resource of the limits if empty.
+	Accelerator Accelerator `json:"accelerator,omitempty" validate:"omitempty,oneof=nvidia-gpu amd-gpu google-tpu aws-neuron"`
+	// Env is added to the model server containers of Models that use the
+	// profile (i.e. runtime settings of the accelerator). Env of the Model
+	// takes precedence.
+	Env []corev1.EnvVar `json:"env,omitempty"`
+}
+
+type Accelerator string
+
+const (
+	NVIDIAGPUAccelerator Accelerator = "nvidia-gpu"
+	// AMDGPUAccelerator is an AMD GPU with the ROCm software stack.
+	AMDGPUAccelerator    Accelerator = "amd-gpu"
+	GoogleTPUAccelerator Accelerator = "google-tpu"
+	// AWSNeuronAccelerator is an AWS Inferentia or Trainium chip.
+	AWSNeuronAccelerator Accelerator = "aws-neuron"
+)
+
+type GPUSharing struct {
+	// MIGProfile is the MIG slice that each unit of the profile requests
+	// (e.g. "1g.10gb"). The slice is requested as the "nvidia.com/mig-<profile>"
+	// resource that the device plugin advertises with the mixed MIG strategy.
+	MIGProfile string `json:"migProfile,omitempty" validate:"required_without=TimeSlicingReplicas,excluded_with=TimeSlicingReplicas"`
+	// TimeSlicingReplicas is the number of replicas that each GPU is
+	// advertised as by the time-slicing config of the device plugin. Each unit
+	// of the profile requests one of them, i.e. 1/TimeSlicingReplicas of a GPU.
+	// As time-sliced GPUs do not isolate memory, the memory that the model
+	// server allocates is limited to the same fraction where supported (vLLM).
+	TimeSlicingReplicas int32 `json:"timeSlicingReplicas,omitempty" validate:"gte=0"`
+	// ResourceName overrides the name of the requested resource
+	// (e.g. "nvidia.com/gpu.shared" if the device plugin renames time-sliced GPUs).
+	ResourceName string `json:"resourceName,omitempty"`
+}
+
+type WarmPool struct {
+	// Replicas is the number of warm Pods that are kept for the profile.
+	Replicas int32 `json:"replicas" validate:"min=1"`
+	// Multiple is the number of resource profile units that each warm Pod
+	// requests. Warm Pods are only claimed by Models that request at most
+	// this many units (i.e. "nvidia-gpu-l4:2" requires a Multiple of at least 2).
+	// Defaults to 1.
+	Multiple int32 `json:"multiple,omitempty" validate:"min=0"`
+	// Image is pulled by the warm Pods. It must contain a "sleep" binary.
+	// Defaults to the vLLM server image of the profile.
+	Image string `json:"image,omitempty"`
+	// PriorityClassName of the warm Pods. A PriorityClass with a negative
+	// value allows any other Pod to preempt warm Pods.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+type Spot struct {
+	// NodeLabelKey and NodeLabelValue are the label of spot Nodes
+	// (i.e. "karpenter.sh/capacity-type: spot" or "cloud.google.com/gke-spot: true").
+	// Nodes without the label are on-demand Nodes.
+	NodeLabelKey   string `json:"nodeLabelKey,omitempty"`
+	NodeLabelValue string `json:"nodeLabelValue,omitempty" validate:"required_with=NodeLabelKey"`
+	// Tolerations are added to Pods that may run on spot Nodes
+	// (i.e. for the taints of spot node pools).
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
 }
 
 type CacheProfile struct {
@@ -211,18 +879,419 @@ type CacheSharedFilesystem struct {
 }
 
 type MessageStream struct {
+	// Name identifies the stream in metrics and the request index
+	// (i.e. the team or priority of the requests). Must be unique.
+	// Defaults to the index of the stream.
+	Name         string `json:"name,omitempty"`
 	RequestsURL  string `json:"requestsURL"`
 	ResponsesURL string `json:"responsesURL"`
 	// MaxHandlers is the maximum number of handlers that will be started for this stream.
 	// Must be greater than 0. Defaults to 1.
 	MaxHandlers int `json:"maxHandlers" validate:"min=1"`
+	// Transport configures provider-specific tuning of the requests subscription.
+	// Only the section that matches the scheme of RequestsURL may be set.
+	Transport MessageTransport `json:"transport,omitempty"`
+	// Deduplication re-publishes the previous response of a request message
+	// that is redelivered (i.e. because its acknowledgement was lost) instead
+	// of running inference again.
+	Deduplication *MessageDeduplication `json:"deduplication,omitempty"`
+	// Batches configures the handling of batch request messages
+	// (messages with a "batch" field instead of a "body" field).
+	Batches MessageBatches `json:"batches,omitempty"`
+	// MaxAttempts is the number of times that a request message is handled
+	// before it is no longer redelivered (i.e. when its response can not be
+	// published). The message is then published to the dead-letter topic if
+	// one is configured and dropped otherwise.
+	// Defaults to 5 if DeadLetter is set, otherwise to 0 (no limit).
+	MaxAttempts int `json:"maxAttempts,omitempty" validate:"gte=0"`
+	// DeadLetter configures a topic that request messages are published
+	// to when they can not be parsed or handled.
+	DeadLetter *MessageDeadLetter `json:"deadLetter,omitempty"`
+	// Overflow configures a bucket that large response bodies are written
+	// to instead of being published in the response message.
+	Overflow *MessageOverflow `json:"overflow,omitempty"`
+	// Priorities handles request messages by the priority class that they
+	// declare in their metadata instead of in the order that they were received.
+	Priorities *MessagePriorities `json:"priorities,omitempty"`
+	// ConcurrencyLimits limits the number of handlers that requests for the
+	// same model (or with the same request metadata value) can use, so that
+	// a backlog of one model does not use all MaxHandlers.
+	ConcurrencyLimits *MessageConcurrencyLimits `json:"concurrencyLimits,omitempty"`
+	// AdaptiveHandlers adjusts the number of handlers between MinHandlers
+	// and MaxHandlers based on the latency and errors of backend requests,
+	// instead of always using MaxHandlers.
+	AdaptiveHandlers *MessageAdaptiveHandlers `json:"adaptiveHandlers,omitempty"`
+	// ForwardedMetadata are request metadata keys that are sent to model
+	// servers as HTTP headers (i.e. for tracing). Other metadata is not
+	// sent to model servers.
+	ForwardedMetadata []ForwardedMetadata `json:"forwardedMetadata,omitempty" validate:"dive"`
+	// ResponseTopics are the URLs of topics that request messages may
+	// select with the "response_topic" metadata to receive their responses
+	// on instead of ResponsesURL. The host and path of the URLs may contain
+	// path.Match patterns (i.e.
+	// "awssqs://sqs.us-east-1.amazonaws.com/123/responses-*"), the other
+	// parts (including query parameters) must match exactly.
+	ResponseTopics []string `json:"responseTopics,omitempty" validate:"dive,required"`
+	// EmbeddingCoalescing coalesces embeddings request messages for the same
+	// model into one request to a model server (with the inputs of all
+	// messages), which increases the throughput of model servers that
+	// process batches of inputs.
+	EmbeddingCoalescing *MessageEmbeddingCoalescing `json:"embeddingCoalescing,omitempty"`
+	// Compression compresses large response messages. Compressed request
+	// messages (with the "content-encoding" metadata) are decompressed
+	// whether or not this is set.
+	Compression *MessageCompression `json:"compression,omitempty"`
+}
+
+type MessageCompression struct {
+	// Encoding is the compression of response messages: "gzip" or "zstd".
+	// Responses to compressed request messages use the compression of
+	// the request message.
+	// Defaults to "gzip".
+	Encoding string `json:"encoding,omitempty" validate:"omitempty,oneof=gzip zstd"`
+	// MinBytes is the size above which response messages are compressed.
+	// Defaults to 16384.
+	MinBytes int `json:"minBytes,omitempty" validate:"gte=0"`
+}
+
+type MessageEmbeddingCoalescing struct {
+	// MaxBatchSize is the maximum number of inputs that are sent to a
+	// model server in one request. Messages with more inputs are not
+	// coalesced with other messages.
+	// Defaults to 32.
+	MaxBatchSize int `json:"maxBatchSize,omitempty" validate:"gte=0"`
+	// MaxLatency is the maximum time that a message waits for other
+	// messages to be coalesced with.
+	// Defaults to 20 milliseconds.
+	MaxLatency Duration `json:"maxLatency,omitempty"`
+}
+
+// headerNameRegexp matches valid HTTP header names (RFC 9110 tokens).
+var headerNameRegexp = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+type ForwardedMetadata struct {
+	// Key of the request metadata, which is read from the "metadata" field
+	// of the request message or else from the message metadata.
+	Key string `json:"key" validate:"required"`
+	// Header that the value is sent in.
+	// Defaults to the key.
+	Header string `json:"header,omitempty"`
+}
+
+type MessageAdaptiveHandlers struct {
+	// MinHandlers is the minimum number of handlers.
+	// Defaults to 1.
+	MinHandlers int `json:"minHandlers,omitempty" validate:"gte=0"`
+	// TargetLatency is the average duration of backend requests above which
+	// the number of handlers is decreased. Streamed requests are not included.
+	TargetLatency Duration `json:"targetLatency"`
+	// MaxErrorPercent is the percentage of backend requests that fail
+	// (with an error or a 5xx response) above which the number of
+	// handlers is decreased.
+	// Defaults to 5.
+	MaxErrorPercent int `json:"maxErrorPercent,omitempty" validate:"gte=0,lte=100"`
+	// Interval is the time between adjustments.
+	// Defaults to 10 seconds.
+	Interval Duration `json:"interval,omitempty"`
+}
+
+type MessageConcurrencyLimits struct {
+	// MetadataKey limits requests with the same value of a request metadata
+	// key (i.e. a tenant) instead of requests for the same model. Requests
+	// without the key are not limited.
+	MetadataKey string `json:"metadataKey,omitempty"`
+	// MaxHandlers is the maximum number of handlers for requests for the
+	// same model (or with the same metadata value).
+	MaxHandlers int `json:"maxHandlers" validate:"min=1"`
+	// Overrides of MaxHandlers by model (or metadata value).
+	Overrides map[string]int `json:"overrides,omitempty" validate:"dive,min=1"`
+	// MaxWaiting is the maximum number of received request messages that wait
+	// because their model (or metadata value) reached its limit. When
+	// MaxWaiting messages are waiting, receiving stops at the next message
+	// that would have to wait.
+	// Defaults to the MaxHandlers of the stream.
+	MaxWaiting int `json:"maxWaiting,omitempty" validate:"gte=0"`
+}
+
+type MessagePriorities struct {
+	// MetadataKey is the request metadata key of the priority class of a request.
+	// Defaults to "priority".
+	MetadataKey string `json:"metadataKey,omitempty"`
+	// Classes are the names of the priority classes, from the highest to
+	// the lowest priority.
+	// Defaults to ["high", "normal", "low"].
+	Classes []string `json:"classes,omitempty" validate:"omitempty,unique,dive,required"`
+	// Default is the priority class of requests without a (known) priority class.
+	// Defaults to "normal" if it is a class, otherwise to the lowest priority class.
+	Default string `json:"default,omitempty"`
+	// MaxQueued is the maximum number of received request messages that
+	// wait for a handler. Waiting messages are handled by priority class,
+	// so that a larger queue lets high-priority messages overtake more
+	// low-priority messages (which are hidden from other consumers while
+	// they wait).
+	// Defaults to MaxHandlers.
+	MaxQueued int `json:"maxQueued,omitempty" validate:"gte=0"`
+}
+
+type MessageDeadLetter struct {
+	// URL of the dead-letter topic.
+	URL string `json:"url" validate:"required"`
+}
+
+type MessageOverflow struct {
+	// URL of the bucket (i.e. "gs://my-bucket?prefix=responses/").
+	URL string `json:"url" validate:"required"`
+	// MaxMessageBytes is the size of the largest response message that is
+	// published with its body.
+	// Defaults to 240KiB (below the 256KiB message size limit of AWS SQS).
+	MaxMessageBytes int `json:"maxMessageBytes,omitempty" validate:"gte=0"`
+}
+
+type MessageBatches struct {
+	// ProgressInterval is the time between progress events that are
+	// published while the items of a batch are handled. A final progress
+	// event is always published after the last item.
+	// Defaults to 30 seconds.
+	ProgressInterval Duration `json:"progressInterval,omitempty"`
+	// ProgressURL is the topic that progress events are published to.
+	// Defaults to the responses topic of the stream.
+	ProgressURL string `json:"progressURL,omitempty"`
+}
+
+type MessageDeduplication struct {
+	// IdempotencyKey is the request metadata key that identifies
+	// redelivered requests. Its values must be unique for each request
+	// (of the stream). Requests without the key are not deduplicated.
+	IdempotencyKey string `json:"idempotencyKey" validate:"required"`
+	// TTL is the amount of time that responses are remembered for.
+	// Defaults to 1 hour.
+	TTL Duration `json:"ttl,omitempty"`
+	// MaxEntries is the maximum number of responses that are remembered.
+	// The least recently published responses are forgotten first.
+	// Defaults to 10000. Ignored if responses are stored in Redis.
+	MaxEntries int `json:"maxEntries,omitempty" validate:"omitempty,min=1"`
+	// Redis stores responses in Redis instead of in the memory of each
+	// KubeAI instance, so that requests are deduplicated across instances
+	// and restarts.
+	Redis *RedisResponseStore `json:"redis,omitempty"`
+}
+
+type RedisResponseStore struct {
+	// URL of the Redis server: "redis://[[username]:password@]host[:port][/db]"
+	// ("rediss://" for TLS). The password defaults to $REDIS_PASSWORD.
+	URL string `json:"url" validate:"required"`
+	// KeyPrefix is prepended to the name of the stream and the idempotency
+	// keys, i.e. "kubeai:responses:<stream>:<idempotency key>".
+	// Defaults to "kubeai:responses:".
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+	// Timeout of Redis commands. Requests are not deduplicated if
+	// Redis can not be reached in time.
+	// Defaults to 1 second.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+type MessageTransport struct {
+	// AWSSQS tunes "awssqs://" subscriptions.
+	AWSSQS *AWSSQSTransport `json:"awsSQS,omitempty"`
+	// GCPPubSub tunes "gcppubsub://" subscriptions.
+	GCPPubSub *GCPPubSubTransport `json:"gcpPubSub,omitempty"`
+	// Kafka tunes "kafka://" subscriptions.
+	Kafka *KafkaTransport `json:"kafka,omitempty"`
+	// NATSJetStream tunes "jetstream://" subscriptions.
+	NATSJetStream *NATSJetStreamTransport `json:"natsJetStream,omitempty"`
+	// Keepalive periodically extends the time that a message is hidden from
+	// other consumers while it is being handled (the SQS visibility timeout
+	// or the Pub/Sub ack deadline) so that long requests are not processed
+	// more than once. Supported for "awssqs://", "gcppubsub://" and
+	// "jetstream://" subscriptions.
+	Keepalive *MessageKeepalive `json:"keepalive,omitempty"`
+}
+
+type MessageKeepalive struct {
+	// Timeout is the amount of time that a message is hidden from other
+	// consumers after each extension.
+	// Defaults to 1 minute.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Interval is the time between extensions. Must be less than Timeout.
+	// Defaults to half of Timeout.
+	Interval Duration `json:"interval,omitempty"`
+}
+
+type AWSSQSTransport struct {
+	// ReceiveBatchSize is the maximum number of messages received per request.
+	// Must be between 1 and 10. Defaults to 10.
+	ReceiveBatchSize int `json:"receiveBatchSize,omitempty" validate:"omitempty,min=1,max=10"`
+	// VisibilityTimeout is applied to each message when it is received,
+	// overriding the visibility timeout of the queue.
+	// Must be at most 12 hours. Defaults to the visibility timeout of the queue.
+	VisibilityTimeout Duration `json:"visibilityTimeout,omitempty"`
+	// WaitTime is the maximum amount of time to wait for messages when
+	// long polling. Must be at most 20 seconds.
+	WaitTime Duration `json:"waitTime,omitempty"`
+}
+
+type GCPPubSubTransport struct {
+	// MaxOutstandingMessages is the (approximate) maximum number of messages
+	// that are pulled from the subscription but not yet acknowledged.
+	// Defaults to 1000 messages per pull request with 10 concurrent requests.
+	MaxOutstandingMessages int `json:"maxOutstandingMessages,omitempty" validate:"omitempty,min=1,max=1000"`
+}
+
+type KafkaTransport struct {
+	// FetchMinBytes is the minimum number of bytes to fetch in a request.
+	FetchMinBytes int32 `json:"fetchMinBytes,omitempty" validate:"gte=0"`
+	// FetchDefaultBytes is the default number of bytes to fetch from the
+	// broker in each request.
+	FetchDefaultBytes int32 `json:"fetchDefaultBytes,omitempty" validate:"gte=0"`
+	// FetchMaxBytes is the maximum number of bytes to fetch from the broker
+	// in a single request. 0 means no limit.
+	FetchMaxBytes int32 `json:"fetchMaxBytes,omitempty" validate:"gte=0"`
+	// KeyName is the metadata key that the Kafka message key (i.e. a session
+	// ID) of request messages is stored in. Responses are published with the
+	// same metadata, so that responses topics opened with "?key_name=<KeyName>"
+	// are partitioned by the same key.
+	KeyName string `json:"keyName,omitempty"`
+	// Native consumes the requests topic with KubeAI's own consumer group
+	// client instead of the gocloud.dev one:
+	//
+	// - Offsets are committed per partition once the responses to all
+	//   earlier messages of the partition were published.
+	// - Failed messages are redelivered (see maxAttempts).
+	// - Messages with the same Kafka message key are handled one at a time,
+	//   in the order of the partition.
+	Native bool `json:"native,omitempty"`
+	// MaxBufferedMessages is the maximum number of messages per partition
+	// that are received but not yet committed when Native is set.
+	// Defaults to 100.
+	MaxBufferedMessages int `json:"maxBufferedMessages,omitempty" validate:"gte=0"`
+}
+
+type NATSJetStreamTransport struct {
+	// FetchBatchSize is the maximum number of messages pulled per request.
+	// Defaults to 1.
+	FetchBatchSize int `json:"fetchBatchSize,omitempty" validate:"omitempty,min=1,max=256"`
+	// FilterSubject is the subject filter of the consumer
+	// (i.e. "kubeai.requests.llama-3.1-8b").
+	// Only applies to consumers that are created by KubeAI.
+	FilterSubject string `json:"filterSubject,omitempty"`
+	// MaxAckPending is the maximum number of messages that are delivered
+	// but not yet acknowledged across all KubeAI instances.
+	// Only applies to consumers that are created by KubeAI.
+	MaxAckPending int `json:"maxAckPending,omitempty" validate:"gte=0"`
+}
+
+// validate checks that the transport matches the scheme of the
+// requests URL and that durations are within the provider limits.
+func (s MessageStream) validate() error {
+	u, err := url.Parse(s.RequestsURL)
+	if err != nil {
+		return fmt.Errorf("parsing requestsURL: %w", err)
+	}
+	t := s.Transport
+	if t.AWSSQS != nil {
+		if u.Scheme != "awssqs" {
+			return fmt.Errorf("transport.awsSQS requires an awssqs:// requestsURL, got %q", u.Scheme)
+		}
+		if d := t.AWSSQS.VisibilityTimeout.Duration; d < 0 || d > 12*time.Hour {
+			return fmt.Errorf("transport.awsSQS.visibilityTimeout must be between 0 and 12h, got %v", d)
+		}
+		if d := t.AWSSQS.WaitTime.Duration; d < 0 || d > 20*time.Second {
+			return fmt.Errorf("transport.awsSQS.waitTime must be between 0 and 20s, got %v", d)
+		}
+	}
+	if t.GCPPubSub != nil && u.Scheme != "gcppubsub" {
+		return fmt.Errorf("transport.gcpPubSub requires a gcppubsub:// requestsURL, got %q", u.Scheme)
+	}
+	if t.NATSJetStream != nil && u.Scheme != "jetstream" {
+		return fmt.Errorf("transport.natsJetStream requires a jetstream:// requestsURL, got %q", u.Scheme)
+	}
+	if k := t.Keepalive; k != nil {
+		var maxTimeout time.Duration
+		switch u.Scheme {
+		case "awssqs":
+			maxTimeout = 12 * time.Hour
+		case "gcppubsub":
+			maxTimeout = 10 * time.Minute
+		case "jetstream":
+			// The timeout is the ack wait of the consumer, which is not limited.
+			maxTimeout = 24 * time.Hour
+		default:
+			return fmt.Errorf("transport.keepalive is not supported for %q requestsURLs", u.Scheme)
+		}
+		if k.Timeout.Duration <= 0 || k.Timeout.Duration > maxTimeout {
+			return fmt.Errorf("transport.keepalive.timeout must be between 0 and %v, got %v", maxTimeout, k.Timeout.Duration)
+		}
+		if k.Interval.Duration <= 0 || k.Interval.Duration >= k.Timeout.Duration {
+			return fmt.Errorf("transport.keepalive.interval must be greater than 0 and less than the timeout, got %v", k.Interval.Duration)
+		}
+	}
+	if p := s.Priorities; p != nil && !slices.Contains(p.Classes, p.Default) {
+		return fmt.Errorf("priorities.default %q is not one of priorities.classes", p.Default)
+	}
+	if a := s.AdaptiveHandlers; a != nil {
+		if a.TargetLatency.Duration <= 0 {
+			return fmt.Errorf("adaptiveHandlers.targetLatency must be greater than 0")
+		}
+		if a.MinHandlers > s.MaxHandlers {
+			return fmt.Errorf("adaptiveHandlers.minHandlers must not be greater than maxHandlers (%d)", s.MaxHandlers)
+		}
+		if a.Interval.Duration <= 0 {
+			return fmt.Errorf("adaptiveHandlers.interval must be greater than 0")
+		}
+	}
+	if e := s.EmbeddingCoalescing; e != nil && e.MaxLatency.Duration < 0 {
+		return fmt.Errorf("embeddingCoalescing.maxLatency must not be negative")
+	}
+	for _, pattern := range s.ResponseTopics {
+		u, err := url.Parse(pattern)
+		if err == nil {
+			_, err = path.Match(u.Host, "")
+		}
+		if err == nil {
+			_, err = path.Match(u.Path, "")
+		}
+		if err != nil {
+			return fmt.Errorf("responseTopics: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	for _, f := range s.ForwardedMetadata {
+		if !headerNameRegexp.MatchString(f.Header) {
+			return fmt.Errorf("forwardedMetadata: invalid header name %q", f.Header)
+		}
+	}
+	if d := s.Deduplication; d != nil && d.Redis != nil {
+		ru, err := url.Parse(d.Redis.URL)
+		if err != nil {
+			return fmt.Errorf("parsing deduplication.redis.url: %w", err)
+		}
+		if ru.Scheme != "redis" && ru.Scheme != "rediss" {
+			return fmt.Errorf("deduplication.redis.url must be a redis:// or rediss:// URL, got %q", ru.Scheme)
+		}
+	}
+	if t.Kafka != nil {
+		if u.Scheme != "kafka" {
+			return fmt.Errorf("transport.kafka requires a kafka:// requestsURL, got %q", u.Scheme)
+		}
+		if t.Kafka.FetchMaxBytes > 0 && t.Kafka.FetchDefaultBytes > t.Kafka.FetchMaxBytes {
+			return fmt.Errorf("transport.kafka.fetchDefaultBytes must not be greater than fetchMaxBytes")
+		}
+	}
+	return nil
 }
 
 type ModelServers struct {
-	OLlama        ModelServer `json:"OLlama"`
-	VLLM          ModelServer `json:"VLLM"`
-	FasterWhisper ModelServer `json:"FasterWhisper"`
-	Infinity      ModelServer `json:"Infinity"`
+	OLlama        ModelServer          `json:"OLlama"`
+	VLLM          ModelServer          `json:"VLLM"`
+	FasterWhisper ModelServer          `json:"FasterWhisper"`
+	Infinity      ModelServer          `json:"Infinity"`
+	JetStream     JetStreamModelServer `json:"JetStream"`
+}
+
+// JetStreamModelServer is the JetStream engine for TPUs. Its images run the
+// gRPC server of JetStream and HTTPImage runs the HTTP frontend of the server.
+type JetStreamModelServer struct {
+	Images    map[string]string `json:"images"`
+	HTTPImage string            `json:"httpImage"`
 }
 
 type ModelServer struct {
@@ -242,4 +1311,11 @@ type ModelServerPods struct {
 
 	// Security Context for the model pod containers
 	ModelContainerSecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// TerminationGracePeriod is the maximum amount of time that in-flight
+	// requests (i.e. long-running streams) are given to complete when a Ready
+	// model Pod is deleted (i.e. when scaling down). Should be at least as
+	// long as the deadlines of client requests.
+	// Defaults to 10 minutes.
+	TerminationGracePeriod Duration `json:"terminationGracePeriod,omitempty"`
 }
@@ -55,3 +55,477 @@ func TestAutoscalingConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestLimitScaleUp(t *testing.T) {
+	cases := []struct {
+		name             string
+		cfg              config.ModelAutoscaling
+		current, desired int32
+		expectedReplicas int32
+	}{
+		{
+			name:             "no limits",
+			current:          1,
+			desired:          50,
+			expectedReplicas: 50,
+		},
+		{
+			name:             "scale down is not limited",
+			cfg:              config.ModelAutoscaling{MaxScaleUpReplicas: 1, MaxScaleUpPercent: 10},
+			current:          10,
+			desired:          1,
+			expectedReplicas: 1,
+		},
+		{
+			name:             "absolute",
+			cfg:              config.ModelAutoscaling{MaxScaleUpReplicas: 4},
+			current:          2,
+			desired:          50,
+			expectedReplicas: 6,
+		},
+		{
+			name:             "percent",
+			cfg:              config.ModelAutoscaling{MaxScaleUpPercent: 50},
+			current:          3,
+			desired:          50,
+			expectedReplicas: 5,
+		},
+		{
+			name:             "percent from zero",
+			cfg:              config.ModelAutoscaling{MaxScaleUpPercent: 50},
+			current:          0,
+			desired:          50,
+			expectedReplicas: 1,
+		},
+		{
+			name:             "stricter limit applies",
+			cfg:              config.ModelAutoscaling{MaxScaleUpReplicas: 4, MaxScaleUpPercent: 100},
+			current:          10,
+			desired:          50,
+			expectedReplicas: 14,
+		},
+		{
+			name:             "desired within limits",
+			cfg:              config.ModelAutoscaling{MaxScaleUpReplicas: 4, MaxScaleUpPercent: 100},
+			current:          10,
+			desired:          12,
+			expectedReplicas: 12,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expectedReplicas, c.cfg.LimitScaleUp(c.current, c.desired))
+		})
+	}
+}
+
+func TestPassthroughPathAllowed(t *testing.T) {
+	cfg := config.ModelProxy{PassthroughPathAllowlist: []string{"/v1/search", "/v1/collections/*"}}
+	require.True(t, cfg.PassthroughPathAllowed("/v1/search"))
+	require.True(t, cfg.PassthroughPathAllowed("/v1/collections/docs"))
+	require.False(t, cfg.PassthroughPathAllowed("/v1/collections/docs/points"))
+	require.False(t, cfg.PassthroughPathAllowed("/v1/load_lora_adapter"))
+	require.False(t, config.ModelProxy{}.PassthroughPathAllowed("/v1/search"))
+}
+
+func TestMessageStreamTransportValidation(t *testing.T) {
+	base := func() *config.System {
+		return &config.System{
+			SecretNames:      config.SecretNames{Huggingface: "hf"},
+			ModelServers:     config.ModelServers{VLLM: config.ModelServer{Images: map[string]string{"default": "vllm"}}},
+			ResourceProfiles: map[string]config.ResourceProfile{},
+			ModelLoading:     config.ModelLoading{Image: "loader"},
+			ModelAutoscaling: config.ModelAutoscaling{StateConfigMapName: "state"},
+		}
+	}
+	cases := []struct {
+		name   string
+		stream config.MessageStream
+		expErr string
+	}{
+		{
+			name: "sqs",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Transport: config.MessageTransport{AWSSQS: &config.AWSSQSTransport{
+					ReceiveBatchSize:  1,
+					VisibilityTimeout: config.Duration{Duration: 10 * time.Minute},
+				}},
+			},
+		},
+		{
+			name: "scheme mismatch",
+			stream: config.MessageStream{
+				RequestsURL: "gcppubsub://projects/p/subscriptions/s",
+				Transport:   config.MessageTransport{AWSSQS: &config.AWSSQSTransport{}},
+			},
+			expErr: "transport.awsSQS requires an awssqs:// requestsURL",
+		},
+		{
+			name: "sqs visibility timeout too long",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Transport: config.MessageTransport{AWSSQS: &config.AWSSQSTransport{
+					VisibilityTimeout: config.Duration{Duration: 13 * time.Hour},
+				}},
+			},
+			expErr: "visibilityTimeout must be between 0 and 12h",
+		},
+		{
+			name: "sqs batch size too large",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Transport: config.MessageTransport{AWSSQS: &config.AWSSQSTransport{
+					ReceiveBatchSize: 11,
+				}},
+			},
+			expErr: "ReceiveBatchSize",
+		},
+		{
+			name: "gcp pubsub",
+			stream: config.MessageStream{
+				RequestsURL: "gcppubsub://projects/p/subscriptions/s",
+				Transport: config.MessageTransport{GCPPubSub: &config.GCPPubSubTransport{
+					MaxOutstandingMessages: 4,
+				}},
+			},
+		},
+		{
+			name: "sqs keepalive",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Transport: config.MessageTransport{Keepalive: &config.MessageKeepalive{
+					Timeout: config.Duration{Duration: 5 * time.Minute},
+				}},
+			},
+		},
+		{
+			name: "pubsub keepalive timeout too long",
+			stream: config.MessageStream{
+				RequestsURL: "gcppubsub://projects/p/subscriptions/s",
+				Transport: config.MessageTransport{Keepalive: &config.MessageKeepalive{
+					Timeout: config.Duration{Duration: time.Hour},
+				}},
+			},
+			expErr: "transport.keepalive.timeout must be between 0 and 10m0s",
+		},
+		{
+			name: "keepalive interval not less than timeout",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Transport: config.MessageTransport{Keepalive: &config.MessageKeepalive{
+					Timeout:  config.Duration{Duration: time.Minute},
+					Interval: config.Duration{Duration: time.Minute},
+				}},
+			},
+			expErr: "transport.keepalive.interval must be greater than 0 and less than the timeout",
+		},
+		{
+			name: "keepalive not supported",
+			stream: config.MessageStream{
+				RequestsURL: "kafka://group?topic=requests",
+				Transport:   config.MessageTransport{Keepalive: &config.MessageKeepalive{}},
+			},
+			expErr: `transport.keepalive is not supported for "kafka" requestsURLs`,
+		},
+		{
+			name: "deduplication",
+			stream: config.MessageStream{
+				RequestsURL:   "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Deduplication: &config.MessageDeduplication{IdempotencyKey: "request-id"},
+			},
+		},
+		{
+			name: "deduplication max entries negative",
+			stream: config.MessageStream{
+				RequestsURL:   "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Deduplication: &config.MessageDeduplication{IdempotencyKey: "request-id", MaxEntries: -1},
+			},
+			expErr: "MaxEntries",
+		},
+		{
+			name: "deduplication without idempotency key",
+			stream: config.MessageStream{
+				RequestsURL:   "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Deduplication: &config.MessageDeduplication{},
+			},
+			expErr: "IdempotencyKey",
+		},
+		{
+			name: "priorities",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Priorities:  &config.MessagePriorities{Classes: []string{"interactive", "batch"}, Default: "batch"},
+			},
+		},
+		{
+			name: "priorities unknown default",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Priorities:  &config.MessagePriorities{Classes: []string{"interactive", "batch"}, Default: "normal"},
+			},
+			expErr: `priorities.default "normal" is not one of priorities.classes`,
+		},
+		{
+			name: "priorities duplicate classes",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Priorities:  &config.MessagePriorities{Classes: []string{"high", "high"}},
+			},
+			expErr: "Classes",
+		},
+		{
+			name: "concurrency limits",
+			stream: config.MessageStream{
+				RequestsURL:       "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				ConcurrencyLimits: &config.MessageConcurrencyLimits{MaxHandlers: 2, Overrides: map[string]int{"big-model": 1}},
+			},
+		},
+		{
+			name: "concurrency limits without max handlers",
+			stream: config.MessageStream{
+				RequestsURL:       "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				ConcurrencyLimits: &config.MessageConcurrencyLimits{MetadataKey: "tenant"},
+			},
+			expErr: "MaxHandlers",
+		},
+		{
+			name: "concurrency limits invalid override",
+			stream: config.MessageStream{
+				RequestsURL:       "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				ConcurrencyLimits: &config.MessageConcurrencyLimits{MaxHandlers: 2, Overrides: map[string]int{"big-model": 0}},
+			},
+			expErr: "Overrides",
+		},
+		{
+			name: "adaptive handlers",
+			stream: config.MessageStream{
+				RequestsURL:      "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				MaxHandlers:      10,
+				AdaptiveHandlers: &config.MessageAdaptiveHandlers{MinHandlers: 2, TargetLatency: config.Duration{Duration: 30 * time.Second}},
+			},
+		},
+		{
+			name: "adaptive handlers without target latency",
+			stream: config.MessageStream{
+				RequestsURL:      "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				AdaptiveHandlers: &config.MessageAdaptiveHandlers{},
+			},
+			expErr: "adaptiveHandlers.targetLatency must be greater than 0",
+		},
+		{
+			name: "adaptive handlers min greater than max",
+			stream: config.MessageStream{
+				RequestsURL:      "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				MaxHandlers:      2,
+				AdaptiveHandlers: &config.MessageAdaptiveHandlers{MinHandlers: 3, TargetLatency: config.Duration{Duration: time.Second}},
+			},
+			expErr: "adaptiveHandlers.minHandlers must not be greater than maxHandlers (2)",
+		},
+		{
+			name: "compression",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Compression: &config.MessageCompression{Encoding: "zstd"},
+			},
+		},
+		{
+			name: "compression unknown encoding",
+			stream: config.MessageStream{
+				RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Compression: &config.MessageCompression{Encoding: "br"},
+			},
+			expErr: "Encoding",
+		},
+		{
+			name: "embedding coalescing",
+			stream: config.MessageStream{
+				RequestsURL:         "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				EmbeddingCoalescing: &config.MessageEmbeddingCoalescing{},
+			},
+		},
+		{
+			name: "embedding coalescing negative max latency",
+			stream: config.MessageStream{
+				RequestsURL:         "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				EmbeddingCoalescing: &config.MessageEmbeddingCoalescing{MaxLatency: config.Duration{Duration: -time.Second}},
+			},
+			expErr: "embeddingCoalescing.maxLatency must not be negative",
+		},
+		{
+			name: "forwarded metadata",
+			stream: config.MessageStream{
+				RequestsURL:       "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				ForwardedMetadata: []config.ForwardedMetadata{{Key: "trace_id", Header: "X-Trace-Id"}, {Key: "user"}},
+			},
+		},
+		{
+			name: "forwarded metadata invalid header",
+			stream: config.MessageStream{
+				RequestsURL:       "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				ForwardedMetadata: []config.ForwardedMetadata{{Key: "user id"}},
+			},
+			expErr: `forwardedMetadata: invalid header name "user id"`,
+		},
+		{
+			name: "response topics",
+			stream: config.MessageStream{
+				RequestsURL:    "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				ResponseTopics: []string{"awssqs://sqs.us-east-1.amazonaws.com/123/responses-*"},
+			},
+		},
+		{
+			name: "response topics invalid pattern",
+			stream: config.MessageStream{
+				RequestsURL:    "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				ResponseTopics: []string{"mem://responses-["},
+			},
+			expErr: `responseTopics: invalid pattern "mem://responses-["`,
+		},
+		{
+			name: "deduplication redis",
+			stream: config.MessageStream{
+				RequestsURL:   "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Deduplication: &config.MessageDeduplication{IdempotencyKey: "request-id", Redis: &config.RedisResponseStore{URL: "rediss://redis:6380/1"}},
+			},
+		},
+		{
+			name: "deduplication redis invalid url",
+			stream: config.MessageStream{
+				RequestsURL:   "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+				Deduplication: &config.MessageDeduplication{IdempotencyKey: "request-id", Redis: &config.RedisResponseStore{URL: "http://redis"}},
+			},
+			expErr: "deduplication.redis.url must be a redis:// or rediss:// URL",
+		},
+		{
+			name: "kafka fetch sizes",
+			stream: config.MessageStream{
+				RequestsURL: "kafka://group?topic=requests",
+				Transport: config.MessageTransport{Kafka: &config.KafkaTransport{
+					FetchDefaultBytes: 2048,
+					FetchMaxBytes:     1024,
+				}},
+			},
+			expErr: "fetchDefaultBytes must not be greater than fetchMaxBytes",
+		},
+		{
+			name: "jetstream keepalive",
+			stream: config.MessageStream{
+				RequestsURL: "jetstream://REQUESTS/kubeai",
+				Transport: config.MessageTransport{
+					NATSJetStream: &config.NATSJetStreamTransport{FetchBatchSize: 10},
+					Keepalive:     &config.MessageKeepalive{},
+				},
+			},
+		},
+		{
+			name: "jetstream scheme mismatch",
+			stream: config.MessageStream{
+				RequestsURL: "kafka://group?topic=requests",
+				Transport:   config.MessageTransport{NATSJetStream: &config.NATSJetStreamTransport{}},
+			},
+			expErr: `transport.natsJetStream requires a jetstream:// requestsURL, got "kafka"`,
+		},
+	}
+	t.Run("names", func(t *testing.T) {
+		cfg := base()
+		cfg.Messaging.Streams = []config.MessageStream{
+			{RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/team-a", Name: "team-a"},
+			{RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/team-b"},
+		}
+		require.NoError(t, cfg.DefaultAndValidate())
+		require.Equal(t, "team-a", cfg.Messaging.Streams[0].Name)
+		require.Equal(t, "1", cfg.Messaging.Streams[1].Name)
+
+		cfg.Messaging.Streams[1].Name = "team-a"
+		require.ErrorContains(t, cfg.DefaultAndValidate(), `messaging.streams[1]: duplicate name "team-a"`)
+	})
+	t.Run("priorities defaults", func(t *testing.T) {
+		cfg := base()
+		cfg.Messaging.Streams = []config.MessageStream{{
+			RequestsURL: "awssqs://sqs.us-east-1.amazonaws.com/123/requests",
+			MaxHandlers: 4,
+			Priorities:  &config.MessagePriorities{},
+		}}
+		require.NoError(t, cfg.DefaultAndValidate())
+		require.Equal(t, &config.MessagePriorities{
+			MetadataKey: "priority",
+			Classes:     []string{"high", "normal", "low"},
+			Default:     "normal",
+			MaxQueued:   4,
+		}, cfg.Messaging.Streams[0].Priorities)
+	})
+	t.Run("batch api", func(t *testing.T) {
+		cfg := base()
+		cfg.Messaging.BatchAPI = &config.MessageBatchAPI{
+			RequestsURL:              "mem://requests",
+			ResponsesURL:             "mem://responses",
+			ResponsesSubscriptionURL: "mem://responses",
+			FilesURL:                 "mem://",
+			TenantHeader:             "X-Tenant",
+		}
+		require.NoError(t, cfg.DefaultAndValidate())
+		require.Equal(t, 100, cfg.Messaging.BatchAPI.MaxActiveBatches)
+
+		cfg.Messaging.BatchAPI.ForwardedHeaders = []string{"X Team"}
+		require.ErrorContains(t, cfg.DefaultAndValidate(), `messaging.batchAPI.forwardedHeaders: invalid header name "X Team"`)
+	})
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := base()
+			cfg.Messaging.Streams = []config.MessageStream{c.stream}
+			err := cfg.DefaultAndValidate()
+			if c.expErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, c.expErr)
+			}
+		})
+	}
+}
+
+func TestGPUSharingValidation(t *testing.T) {
+	cases := []struct {
+		name    string
+		sharing config.GPUSharing
+		expErr  string
+	}{
+		{
+			name:    "mig",
+			sharing: config.GPUSharing{MIGProfile: "1g.10gb"},
+		},
+		{
+			name:    "time slicing",
+			sharing: config.GPUSharing{TimeSlicingReplicas: 4},
+		},
+		{
+			name:   "neither",
+			expErr: "MIGProfile",
+		},
+		{
+			name:    "both",
+			sharing: config.GPUSharing{MIGProfile: "1g.10gb", TimeSlicingReplicas: 4},
+			expErr:  "MIGProfile",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := &config.System{
+				SecretNames:  config.SecretNames{Huggingface: "hf"},
+				ModelServers: config.ModelServers{VLLM: config.ModelServer{Images: map[string]string{"default": "vllm"}}},
+				ResourceProfiles: map[string]config.ResourceProfile{
+					"shared-gpu": {GPUSharing: &c.sharing},
+				},
+				ModelLoading:     config.ModelLoading{Image: "loader"},
+				ModelAutoscaling: config.ModelAutoscaling{StateConfigMapName: "state"},
+			}
+			err := cfg.DefaultAndValidate()
+			if c.expErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, c.expErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Package cronwindow evaluates recurring time windows that open at the times
+// of a cron expression and stay open for a duration (see the schedules and
+// active windows of a Model).
+package cronwindow
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+)
+
+type Window struct {
+	// Start is a standard cron expression (e.g. "0 9 * * 1-5").
+	Start    string
+	Duration time.Duration
+	// TimeZone is the IANA time zone name that Start is evaluated in.
+	// Defaults to UTC.
+	TimeZone string
+}
+
+// Open returns true if the window opened within the last duration. The
+// returned time is when the window closes if it is open, or when it opens
+// next if it is closed.
+func (w Window) Open(now time.Time) (bool, time.Time, error) {
+	if w.Duration <= 0 {
+		return false, time.Time{}, fmt.Errorf("duration %v is not positive", w.Duration)
+	}
+	sched, err := cron.ParseStandard(w.Start)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("parsing start %q: %w", w.Start, err)
+	}
+	loc := time.UTC
+	if w.TimeZone != "" {
+		loc, err = time.LoadLocation(w.TimeZone)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("loading time zone %q: %w", w.TimeZone, err)
+		}
+	}
+
+	// Next() returns the first start time that is strictly after the given time.
+	start := sched.Next(now.In(loc).Add(-w.Duration))
+	if start.After(now) {
+		return false, start, nil
+	}
+	return true, start.Add(w.Duration), nil
+}
+
+// ModelActive returns true if the Model is within one of its active windows
+// (Models without active windows are always active). The returned time is
+// when the Model is reevaluated next: the earliest close of the open windows
+// if it is active, or the earliest open of the windows if it is not. It is
+// zero for Models without active windows.
+func ModelActive(m *kubeaiv1.Model, now time.Time) (bool, time.Time, error) {
+	if len(m.Spec.ActiveWindows) == 0 {
+		return true, time.Time{}, nil
+	}
+
+	var (
+		active     bool
+		nextOpen   time.Time
+		firstClose time.Time
+	)
+	for i, aw := range m.Spec.ActiveWindows {
+		open, change, err := Window{
+			Start:    aw.Start,
+			Duration: aw.Duration.Duration,
+			TimeZone: aw.TimeZone,
+		}.Open(now)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("active window %d: %w", i, err)
+		}
+		if open {
+			active = true
+			if firstClose.IsZero() || change.Before(firstClose) {
+				firstClose = change
+			}
+		} else if nextOpen.IsZero() || change.Before(nextOpen) {
+			nextOpen = change
+		}
+	}
+	if active {
+		return true, firstClose, nil
+	}
+	return false, nextOpen, nil
+}
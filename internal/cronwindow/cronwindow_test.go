@@ -0,0 +1,97 @@
+package cronwindow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestModelActive(t *testing.T) {
+	weeknights := kubeaiv1.ModelActiveWindow{
+		Start:    "0 20 * * 1-5",
+		Duration: metav1.Duration{Duration: 10 * time.Hour},
+	}
+	lunch := kubeaiv1.ModelActiveWindow{
+		Start:    "0 12 * * *",
+		Duration: metav1.Duration{Duration: time.Hour},
+	}
+
+	// Wednesday.
+	day := time.Date(2024, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		windows    []kubeaiv1.ModelActiveWindow
+		now        time.Time
+		expActive  bool
+		expChange  time.Time
+		expErrPart string
+	}{
+		{
+			name:      "no windows",
+			now:       day,
+			expActive: true,
+		},
+		{
+			name:      "before start",
+			windows:   []kubeaiv1.ModelActiveWindow{weeknights},
+			now:       day.Add(19 * time.Hour),
+			expChange: day.Add(20 * time.Hour),
+		},
+		{
+			name:      "at start",
+			windows:   []kubeaiv1.ModelActiveWindow{weeknights},
+			now:       day.Add(20 * time.Hour),
+			expActive: true,
+			expChange: day.Add(30 * time.Hour),
+		},
+		{
+			name:      "past midnight",
+			windows:   []kubeaiv1.ModelActiveWindow{weeknights},
+			now:       day.Add(29 * time.Hour),
+			expActive: true,
+			expChange: day.Add(30 * time.Hour),
+		},
+		{
+			name:      "at end",
+			windows:   []kubeaiv1.ModelActiveWindow{weeknights},
+			now:       day.Add(30 * time.Hour),
+			expChange: day.Add(44 * time.Hour),
+		},
+		{
+			name:      "earliest next open",
+			windows:   []kubeaiv1.ModelActiveWindow{weeknights, lunch},
+			now:       day.Add(8 * time.Hour),
+			expChange: day.Add(12 * time.Hour),
+		},
+		{
+			name:       "invalid window",
+			windows:    []kubeaiv1.ModelActiveWindow{weeknights, {Start: "not a cron", Duration: metav1.Duration{Duration: time.Hour}}},
+			now:        day,
+			expErrPart: "active window 1: parsing start",
+		},
+		{
+			name:       "zero duration",
+			windows:    []kubeaiv1.ModelActiveWindow{{Start: "0 20 * * 1-5"}},
+			now:        day,
+			expErrPart: "active window 0: duration 0s is not positive",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := &kubeaiv1.Model{Spec: kubeaiv1.ModelSpec{ActiveWindows: c.windows}}
+			active, change, err := ModelActive(m, c.now)
+			if c.expErrPart != "" {
+				require.ErrorContains(t, err, c.expErrPart)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expActive, active)
+			require.True(t, c.expChange.Equal(change), "expected change at %v, got %v", c.expChange, change)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package debuglog provides debug-level logging that is enabled at runtime
+// for specific models or requests, without enabling verbose logging globally.
+package debuglog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTTL is used when a filter is created without a TTL.
+	DefaultTTL = 10 * time.Minute
+	// MaxTTL is the longest time that a filter can be active for.
+	MaxTTL = 24 * time.Hour
+)
+
+// Filter enables debug logs for requests that match all of its (non-empty) fields.
+type Filter struct {
+	ID string `json:"id"`
+	// Model name to match. Empty matches all models.
+	Model string `json:"model,omitempty"`
+	// RequestIDPattern is a regular expression that is matched against request IDs.
+	// Empty matches all requests.
+	RequestIDPattern string    `json:"requestIDPattern,omitempty"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+
+	requestIDRegexp *regexp.Regexp
+}
+
+func (f *Filter) matches(model, requestID string, now time.Time) bool {
+	if now.After(f.ExpiresAt) {
+		return false
+	}
+	if f.Model != "" && f.Model != model {
+		return false
+	}
+	if f.requestIDRegexp != nil && !f.requestIDRegexp.MatchString(requestID) {
+		return false
+	}
+	return true
+}
+
+var (
+	filtersMtx sync.RWMutex
+	// map[<filter-id>]*Filter
+	filters = map[string]*Filter{}
+)
+
+// AddFilter enables debug logs for matching requests until the TTL expires.
+func AddFilter(model, requestIDPattern string, ttl time.Duration) (Filter, error) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if ttl > MaxTTL {
+		return Filter{}, fmt.Errorf("ttl must not exceed %v", MaxTTL)
+	}
+
+	f := &Filter{
+		ID:               newFilterID(),
+		Model:            model,
+		RequestIDPattern: requestIDPattern,
+		ExpiresAt:        time.Now().Add(ttl),
+	}
+	if requestIDPattern != "" {
+		var err error
+		f.requestIDRegexp, err = regexp.Compile(requestIDPattern)
+		if err != nil {
+			return Filter{}, fmt.Errorf("parsing request ID pattern: %w", err)
+		}
+	}
+
+	filtersMtx.Lock()
+	defer filtersMtx.Unlock()
+	removeExpired(time.Now())
+	filters[f.ID] = f
+
+	return *f, nil
+}
+
+// RemoveFilter disables a filter. It returns false if the filter was not found.
+func RemoveFilter(id string) bool {
+	filtersMtx.Lock()
+	defer filtersMtx.Unlock()
+	_, ok := filters[id]
+	delete(filters, id)
+	return ok
+}
+
+// ListFilters returns all filters that have not yet expired.
+func ListFilters() []Filter {
+	filtersMtx.Lock()
+	defer filtersMtx.Unlock()
+	removeExpired(time.Now())
+
+	list := make([]Filter, 0, len(filters))
+	for _, f := range filters {
+		list = append(list, *f)
+	}
+	return list
+}
+
+func removeExpired(now time.Time) {
+	for id, f := range filters {
+		if now.After(f.ExpiresAt) {
+			delete(filters, id)
+		}
+	}
+}
+
+// Enabled returns true if debug logs are enabled for the given model and request.
+func Enabled(model, requestID string) bool {
+	filtersMtx.RLock()
+	defer filtersMtx.RUnlock()
+
+	if len(filters) == 0 {
+		return false
+	}
+	now := time.Now()
+	for _, f := range filters {
+		if f.matches(model, requestID, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Printf logs a debug message if debug logs are enabled for the given model and request.
+func Printf(model, requestID, format string, args ...any) {
+	if !Enabled(model, requestID) {
+		return
+	}
+	log.Printf("DEBUG [model=%s request=%s] %s", model, requestID, fmt.Sprintf(format, args...))
+}
+
+func newFilterID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
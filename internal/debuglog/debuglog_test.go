@@ -0,0 +1,83 @@
+package debuglog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilters(t *testing.T) {
+	t.Cleanup(func() {
+		for _, f := range ListFilters() {
+			RemoveFilter(f.ID)
+		}
+	})
+
+	require.False(t, Enabled("model-a", "req-1"), "debug logs should be disabled by default")
+
+	modelFilter, err := AddFilter("model-a", "", time.Minute)
+	require.NoError(t, err)
+	require.True(t, Enabled("model-a", "req-1"))
+	require.False(t, Enabled("model-b", "req-1"))
+
+	_, err = AddFilter("", "^abc-", time.Minute)
+	require.NoError(t, err)
+	require.True(t, Enabled("model-b", "abc-123"))
+	require.False(t, Enabled("model-b", "123-abc"))
+
+	require.True(t, RemoveFilter(modelFilter.ID))
+	require.False(t, RemoveFilter(modelFilter.ID))
+	require.False(t, Enabled("model-a", "req-1"))
+
+	expired, err := AddFilter("model-c", "", time.Nanosecond)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	require.False(t, Enabled("model-c", "req-1"), "expired filters should not match")
+	for _, f := range ListFilters() {
+		require.NotEqual(t, expired.ID, f.ID, "expired filters should not be listed")
+	}
+
+	_, err = AddFilter("", "(", time.Minute)
+	require.Error(t, err, "invalid pattern")
+	_, err = AddFilter("", "", MaxTTL+time.Second)
+	require.Error(t, err, "ttl too long")
+}
+
+func TestHandler(t *testing.T) {
+	t.Cleanup(func() {
+		for _, f := range ListFilters() {
+			RemoveFilter(f.ID)
+		}
+	})
+	h := NewHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/filters", strings.NewReader(`{"model":"model-a","ttl":"5m"}`)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.True(t, Enabled("model-a", "req-1"))
+
+	filters := ListFilters()
+	require.Len(t, filters, 1)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/debug/filters", strings.NewReader(`{"ttl":"abc"}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/filters", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), filters[0].ID)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/debug/filters/"+filters[0].ID, nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.False(t, Enabled("model-a", "req-1"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/debug/filters/"+filters[0].ID, nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,64 @@
+package debuglog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// NewHandler returns an admin API handler for managing debug log filters:
+//
+//	GET    /debug/filters      - List active filters.
+//	POST   /debug/filters      - Create a filter: {"model": "...", "requestIDPattern": "...", "ttl": "10m"}
+//	DELETE /debug/filters/{id} - Remove a filter.
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/filters", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ListFilters())
+	})
+	mux.HandleFunc("POST /debug/filters", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model            string `json:"model"`
+			RequestIDPattern string `json:"requestIDPattern"`
+			TTL              string `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "decoding request body: %v", err)
+			return
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			var err error
+			ttl, err = time.ParseDuration(req.TTL)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "parsing ttl: %v", err)
+				return
+			}
+		}
+		f, err := AddFilter(req.Model, req.RequestIDPattern, ttl)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, f)
+	})
+	mux.HandleFunc("DELETE /debug/filters/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !RemoveFilter(r.PathValue("id")) {
+			writeError(w, http.StatusNotFound, "filter not found: %v", r.PathValue("id"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
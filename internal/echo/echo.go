@@ -0,0 +1,570 @@
+// Package echo implements the Echo engine: an OpenAI-compatible model server
+// that runs inside of KubeAI and responds to requests by echoing their input.
+// It allows clients to be integrated against the KubeAI API (i.e. in CI)
+// without any model server Pods.
+package echo
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenizePath is the path of the tokenize endpoint of the Echo engine, which
+// serves requests of the format of vLLM.
+const TokenizePath = "/tokenize"
+
+// Host is the address that requests to the Echo engine are sent to.
+// Requests are served in-process (see Handler.RoundTrip).
+const Host = "echo"
+
+const defaultDimensions = 16
+
+// Options configure the responses of the Echo engine. They are parsed from
+// the Args of a Model.
+type Options struct {
+	// Delay is the time to wait before responding.
+	Delay time.Duration
+	// TokenDelay is the time to wait between tokens of streamed responses.
+	TokenDelay time.Duration
+	// Dimensions is the size of embeddings if requests do not specify it.
+	Dimensions int
+}
+
+// ParseArgs parses the Args of a Model ("--delay=1s", "--token-delay=50ms",
+// "--dimensions=384").
+func ParseArgs(args []string) (Options, error) {
+	var opts Options
+	fs := flag.NewFlagSet("echo", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.DurationVar(&opts.Delay, "delay", 0, "")
+	fs.DurationVar(&opts.TokenDelay, "token-delay", 0, "")
+	fs.IntVar(&opts.Dimensions, "dimensions", defaultDimensions, "")
+	if err := fs.Parse(args); err != nil {
+		return opts, fmt.Errorf("parsing echo engine args: %w", err)
+	}
+	if fs.NArg() > 0 {
+		return opts, fmt.Errorf("parsing echo engine args: unexpected argument %q", fs.Arg(0))
+	}
+	if opts.Delay < 0 || opts.TokenDelay < 0 || opts.Dimensions < 1 {
+		return opts, fmt.Errorf("parsing echo engine args: delays must not be negative and dimensions must be positive")
+	}
+	return opts, nil
+}
+
+// Handler serves the OpenAI API of a Model that uses the Echo engine:
+//
+//   - Chat completions echo the content of the last message.
+//   - Completions echo the prompt.
+//   - Embeddings are pseudo-random unit vectors derived from the input.
+//   - Transcriptions echo the "prompt" form field (streamed if "stream" is "true").
+//   - Speech is silence of 100ms per token of the input (wav or pcm only).
+//   - Tokenize requests (see TokenizePath) return hashes of the tokens as IDs.
+//
+// Tokens are approximated as whitespace-separated words. Responses are
+// truncated to "max_tokens" (with a finish reason of "length").
+type Handler struct {
+	opts Options
+	mux  *http.ServeMux
+}
+
+// NewHandler returns a Handler for a Model with the given Args.
+func NewHandler(args []string) (*Handler, error) {
+	opts, err := ParseArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	h := &Handler{opts: opts, mux: http.NewServeMux()}
+	h.mux.HandleFunc("POST /v1/chat/completions", h.chatCompletions)
+	h.mux.HandleFunc("POST /v1/completions", h.completions)
+	h.mux.HandleFunc("POST /v1/embeddings", h.embeddings)
+	h.mux.HandleFunc("POST /v1/audio/transcriptions", h.transcriptions)
+	h.mux.HandleFunc("POST /v1/audio/speech", h.speech)
+	h.mux.HandleFunc("POST "+TokenizePath, h.tokenize)
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Delay > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(h.opts.Delay):
+		}
+	}
+	if _, pattern := h.mux.Handler(r); pattern == "" {
+		sendError(w, http.StatusNotFound, "path %s is not supported by the Echo engine", r.URL.Path)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeParams(w, r)
+	if !ok {
+		return
+	}
+	messages, _ := params["messages"].([]any)
+	var prompt []string
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		prompt = append(prompt, tokens(messageText(msg["content"]))...)
+	}
+	var last string
+	if len(messages) > 0 {
+		msg, _ := messages[len(messages)-1].(map[string]any)
+		last = messageText(msg["content"])
+	}
+	maxTokens := intParam(params, "max_completion_tokens")
+	if maxTokens == 0 {
+		maxTokens = intParam(params, "max_tokens")
+	}
+	completion, finishReason := truncate(tokens(last), maxTokens)
+
+	resp := response{
+		ID:      "chatcmpl-" + uuid.New().String(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   stringParam(params, "model"),
+	}
+	usage := &usage{PromptTokens: len(prompt), CompletionTokens: len(completion), TotalTokens: len(prompt) + len(completion)}
+
+	if stream, _ := params["stream"].(bool); !stream {
+		resp.Choices = []map[string]any{{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": strings.Join(completion, "")},
+			"finish_reason": finishReason,
+		}}
+		resp.Usage = usage
+		sendJSON(w, resp)
+		return
+	}
+
+	resp.Object = "chat.completion.chunk"
+	s := h.newStream(w, r)
+	resp.Choices = []map[string]any{{"index": 0, "delta": map[string]any{"role": "assistant", "content": ""}}}
+	s.send(resp)
+	for _, t := range completion {
+		if !s.wait() {
+			return
+		}
+		resp.Choices = []map[string]any{{"index": 0, "delta": map[string]any{"content": t}}}
+		s.send(resp)
+	}
+	resp.Choices = []map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": finishReason}}
+	s.send(resp)
+	if includeUsage(params) {
+		resp.Choices, resp.Usage = []map[string]any{}, usage
+		s.send(resp)
+	}
+	s.done()
+}
+
+func (h *Handler) completions(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeParams(w, r)
+	if !ok {
+		return
+	}
+	var prompts []string
+	switch p := params["prompt"].(type) {
+	case string:
+		prompts = []string{p}
+	case []any:
+		for _, v := range p {
+			s, _ := v.(string)
+			prompts = append(prompts, s)
+		}
+	}
+	maxTokens := intParam(params, "max_tokens")
+
+	resp := response{
+		ID:      "cmpl-" + uuid.New().String(),
+		Object:  "text_completion",
+		Created: time.Now().Unix(),
+		Model:   stringParam(params, "model"),
+	}
+	usage := &usage{}
+	completions := make([][]string, len(prompts))
+	finishReasons := make([]string, len(prompts))
+	for i, p := range prompts {
+		prompt := tokens(p)
+		completions[i], finishReasons[i] = truncate(prompt, maxTokens)
+		usage.PromptTokens += len(prompt)
+		usage.CompletionTokens += len(completions[i])
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	if stream, _ := params["stream"].(bool); !stream {
+		resp.Choices = []map[string]any{}
+		for i := range prompts {
+			resp.Choices = append(resp.Choices, map[string]any{
+				"index":         i,
+				"text":          strings.Join(completions[i], ""),
+				"finish_reason": finishReasons[i],
+			})
+		}
+		resp.Usage = usage
+		sendJSON(w, resp)
+		return
+	}
+
+	s := h.newStream(w, r)
+	for i := range prompts {
+		for _, t := range completions[i] {
+			if !s.wait() {
+				return
+			}
+			resp.Choices = []map[string]any{{"index": i, "text": t}}
+			s.send(resp)
+		}
+		resp.Choices = []map[string]any{{"index": i, "text": "", "finish_reason": finishReasons[i]}}
+		s.send(resp)
+	}
+	if includeUsage(params) {
+		resp.Choices, resp.Usage = []map[string]any{}, usage
+		s.send(resp)
+	}
+	s.done()
+}
+
+func (h *Handler) embeddings(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeParams(w, r)
+	if !ok {
+		return
+	}
+	var inputs []any
+	switch input := params["input"].(type) {
+	case []any:
+		inputs = input
+		if len(input) > 0 {
+			if _, ok := input[0].(float64); ok {
+				// A single input of token IDs.
+				inputs = []any{input}
+			}
+		}
+	default:
+		inputs = []any{input}
+	}
+	dimensions := intParam(params, "dimensions")
+	if dimensions <= 0 {
+		dimensions = h.opts.Dimensions
+	}
+	base64Encoded := stringParam(params, "encoding_format") == "base64"
+
+	var data []map[string]any
+	var promptTokens int
+	for i, input := range inputs {
+		var key []byte
+		if s, ok := input.(string); ok {
+			key = []byte(s)
+			promptTokens += len(tokens(s))
+		} else {
+			key, _ = json.Marshal(input)
+			ids, _ := input.([]any)
+			promptTokens += len(ids)
+		}
+		vector := embedding(key, dimensions)
+		var encoded any = vector
+		if base64Encoded {
+			buf := make([]byte, 4*len(vector))
+			for j, v := range vector {
+				binary.LittleEndian.PutUint32(buf[4*j:], math.Float32bits(v))
+			}
+			encoded = base64.StdEncoding.EncodeToString(buf)
+		}
+		data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": encoded})
+	}
+	sendJSON(w, map[string]any{
+		"object": "list",
+		"data":   data,
+		"model":  stringParam(params, "model"),
+		"usage":  map[string]any{"prompt_tokens": promptTokens, "total_tokens": promptTokens},
+	})
+}
+
+func (h *Handler) transcriptions(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		sendError(w, http.StatusBadRequest, "parsing multipart form: %v", err)
+		return
+	}
+	text := r.FormValue("prompt")
+	if r.FormValue("stream") == "true" {
+		// Partial transcriptions in the format of the OpenAI API.
+		s := h.newStream(w, r)
+		for _, t := range tokens(text) {
+			if !s.wait() {
+				return
+			}
+			s.send(map[string]any{"type": "transcript.text.delta", "delta": t})
+		}
+		s.send(map[string]any{"type": "transcript.text.done", "text": text})
+		s.done()
+		return
+	}
+	if r.FormValue("response_format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, text)
+		return
+	}
+	sendJSON(w, map[string]any{"text": text})
+}
+
+// Speech is 16-bit mono PCM at 24kHz, as the "pcm" format of the OpenAI API.
+const (
+	speechSampleRate  = 24000
+	speechTokenSample = speechSampleRate / 10
+)
+
+func (h *Handler) speech(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeParams(w, r)
+	if !ok {
+		return
+	}
+	format := stringParam(params, "response_format")
+	if format == "" {
+		format = "wav"
+	}
+	if format != "wav" && format != "pcm" {
+		sendError(w, http.StatusBadRequest, "response_format %q is not supported by the Echo engine (supported: wav, pcm)", format)
+		return
+	}
+
+	toks := tokens(stringParam(params, "input"))
+	dataLen := len(toks) * speechTokenSample * 2
+	if format == "wav" {
+		w.Header().Set("Content-Type", "audio/wav")
+	} else {
+		w.Header().Set("Content-Type", "audio/pcm")
+	}
+	w.WriteHeader(http.StatusOK)
+	if format == "wav" {
+		_, _ = w.Write(wavHeader(dataLen))
+	}
+	// Audio is streamed as it is "generated".
+	s := &stream{w: w, r: r, tokenDelay: h.opts.TokenDelay}
+	silence := make([]byte, speechTokenSample*2)
+	for range toks {
+		if !s.wait() {
+			return
+		}
+		_, _ = w.Write(silence)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+func (h *Handler) tokenize(w http.ResponseWriter, r *http.Request) {
+	params, ok := decodeParams(w, r)
+	if !ok {
+		return
+	}
+	var words []string
+	if prompt, ok := params["prompt"].(string); ok {
+		words = tokens(prompt)
+	} else {
+		messages, _ := params["messages"].([]any)
+		for _, m := range messages {
+			msg, _ := m.(map[string]any)
+			words = append(words, tokens(messageText(msg["content"]))...)
+		}
+	}
+	ids := make([]uint32, len(words))
+	for i, word := range words {
+		hash := fnv.New32a()
+		hash.Write([]byte(word))
+		ids[i] = hash.Sum32() % 32000
+	}
+	sendJSON(w, map[string]any{"count": len(ids), "tokens": ids})
+}
+
+// wavHeader returns the header of a wav file of 16-bit mono PCM audio
+// with dataLen bytes of samples.
+func wavHeader(dataLen int) []byte {
+	const (
+		channels      = 1
+		bitsPerSample = 16
+		blockAlign    = channels * bitsPerSample / 8
+	)
+	b := make([]byte, 0, 44)
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(36+dataLen))
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, 1) // PCM
+	b = binary.LittleEndian.AppendUint16(b, channels)
+	b = binary.LittleEndian.AppendUint32(b, speechSampleRate)
+	b = binary.LittleEndian.AppendUint32(b, speechSampleRate*blockAlign)
+	b = binary.LittleEndian.AppendUint16(b, blockAlign)
+	b = binary.LittleEndian.AppendUint16(b, bitsPerSample)
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(dataLen))
+	return b
+}
+
+// embedding returns a pseudo-random unit vector that is derived from the input,
+// so that identical inputs have identical embeddings.
+func embedding(input []byte, dimensions int) []float32 {
+	hash := fnv.New64a()
+	hash.Write(input)
+	rnd := rand.New(rand.NewSource(int64(hash.Sum64())))
+	vector := make([]float32, dimensions)
+	var norm float64
+	for i := range vector {
+		v := rnd.NormFloat64()
+		vector[i] = float32(v)
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+type response struct {
+	ID      string           `json:"id"`
+	Object  string           `json:"object"`
+	Created int64            `json:"created"`
+	Model   string           `json:"model"`
+	Choices []map[string]any `json:"choices"`
+	Usage   *usage           `json:"usage,omitempty"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// tokenPattern matches a word and the whitespace before it, so that
+// joining the tokens of a text reproduces the text (without trailing whitespace).
+var tokenPattern = regexp.MustCompile(`\s*\S+`)
+
+func tokens(text string) []string {
+	return tokenPattern.FindAllString(text, -1)
+}
+
+// truncate limits tokens to maxTokens (if positive) and returns the finish reason.
+func truncate(tokens []string, maxTokens int) ([]string, string) {
+	if maxTokens > 0 && len(tokens) > maxTokens {
+		return tokens[:maxTokens], "length"
+	}
+	return tokens, "stop"
+}
+
+// messageText returns the text of message content, which is either
+// a string or a list of content parts.
+func messageText(content any) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []any:
+		var texts []string
+		for _, part := range c {
+			if p, ok := part.(map[string]any); ok && p["type"] == "text" {
+				text, _ := p["text"].(string)
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+func decodeParams(w http.ResponseWriter, r *http.Request) (map[string]any, bool) {
+	var params map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		sendError(w, http.StatusBadRequest, "decoding request body: %v", err)
+		return nil, false
+	}
+	return params, true
+}
+
+func stringParam(params map[string]any, key string) string {
+	s, _ := params[key].(string)
+	return s
+}
+
+func intParam(params map[string]any, key string) int {
+	f, _ := params[key].(float64)
+	return int(f)
+}
+
+func includeUsage(params map[string]any) bool {
+	opts, _ := params["stream_options"].(map[string]any)
+	include, _ := opts["include_usage"].(bool)
+	return include
+}
+
+func sendJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// sendError sends an error in the format of the OpenAI API.
+func sendError(w http.ResponseWriter, status int, format string, args ...any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"message": fmt.Sprintf(format, args...),
+			"type":    "invalid_request_error",
+			"code":    status,
+		},
+	})
+}
+
+// stream writes server-sent events.
+type stream struct {
+	w          http.ResponseWriter
+	r          *http.Request
+	tokenDelay time.Duration
+}
+
+func (h *Handler) newStream(w http.ResponseWriter, r *http.Request) *stream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	return &stream{w: w, r: r, tokenDelay: h.opts.TokenDelay}
+}
+
+func (s *stream) send(v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(s.w, "data: %s\n\n", data)
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// wait waits for the token delay and returns false if the request was cancelled.
+func (s *stream) wait() bool {
+	if s.tokenDelay == 0 {
+		return s.r.Context().Err() == nil
+	}
+	select {
+	case <-s.r.Context().Done():
+		return false
+	case <-time.After(s.tokenDelay):
+		return true
+	}
+}
+
+func (s *stream) done() {
+	fmt.Fprint(s.w, "data: [DONE]\n\n")
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
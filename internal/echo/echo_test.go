@@ -0,0 +1,211 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := ParseArgs(nil)
+	require.NoError(t, err)
+	require.Equal(t, Options{Dimensions: defaultDimensions}, opts)
+
+	opts, err = ParseArgs([]string{"--delay=1s", "--token-delay=50ms", "--dimensions=384"})
+	require.NoError(t, err)
+	require.Equal(t, Options{Delay: time.Second, TokenDelay: 50 * time.Millisecond, Dimensions: 384}, opts)
+
+	for _, args := range [][]string{
+		{"--unknown"},
+		{"--delay=soon"},
+		{"--delay=-1s"},
+		{"--dimensions=0"},
+		{"positional"},
+	} {
+		_, err := ParseArgs(args)
+		require.Error(t, err, "args: %v", args)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h, err := NewHandler(nil)
+	require.NoError(t, err)
+	client := &http.Client{Transport: h}
+
+	post := func(t *testing.T, path, body string) (*http.Response, string) {
+		t.Helper()
+		resp, err := client.Post("http://"+Host+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(respBody)
+	}
+	decode := func(t *testing.T, body string) map[string]any {
+		t.Helper()
+		var v map[string]any
+		require.NoError(t, json.Unmarshal([]byte(body), &v))
+		return v
+	}
+
+	t.Run("chat completion", func(t *testing.T) {
+		resp, body := post(t, "/v1/chat/completions", `{"model":"m","messages":[{"role":"system","content":"be brief"},{"role":"user","content":[{"type":"text","text":"hello  world"}]}]}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		v := decode(t, body)
+		require.Equal(t, "chat.completion", v["object"])
+		require.Equal(t, "m", v["model"])
+		require.Equal(t, []any{map[string]any{
+			"index":         0.0,
+			"message":       map[string]any{"role": "assistant", "content": "hello  world"},
+			"finish_reason": "stop",
+		}}, v["choices"])
+		require.Equal(t, map[string]any{"prompt_tokens": 4.0, "completion_tokens": 2.0, "total_tokens": 6.0}, v["usage"])
+	})
+
+	t.Run("chat completion is truncated", func(t *testing.T) {
+		_, body := post(t, "/v1/chat/completions", `{"messages":[{"role":"user","content":"one two three"}],"max_completion_tokens":2}`)
+		choice := decode(t, body)["choices"].([]any)[0].(map[string]any)
+		require.Equal(t, "one two", choice["message"].(map[string]any)["content"])
+		require.Equal(t, "length", choice["finish_reason"])
+	})
+
+	t.Run("streamed chat completion", func(t *testing.T) {
+		resp, body := post(t, "/v1/chat/completions", `{"messages":[{"role":"user","content":"one two"}],"stream":true,"stream_options":{"include_usage":true}}`)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		events := strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n")
+		require.Len(t, events, 6)
+		var content string
+		for _, e := range events[:4] {
+			chunk := decode(t, strings.TrimPrefix(e, "data: "))
+			require.Equal(t, "chat.completion.chunk", chunk["object"])
+			delta := chunk["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)
+			c, _ := delta["content"].(string)
+			content += c
+		}
+		require.Equal(t, "one two", content)
+		require.Equal(t, "stop", decode(t, strings.TrimPrefix(events[3], "data: "))["choices"].([]any)[0].(map[string]any)["finish_reason"])
+		require.NotNil(t, decode(t, strings.TrimPrefix(events[4], "data: "))["usage"])
+		require.Equal(t, "data: [DONE]", events[5])
+	})
+
+	t.Run("completions", func(t *testing.T) {
+		_, body := post(t, "/v1/completions", `{"prompt":["a b","c"]}`)
+		v := decode(t, body)
+		require.Equal(t, "text_completion", v["object"])
+		require.Equal(t, []any{
+			map[string]any{"index": 0.0, "text": "a b", "finish_reason": "stop"},
+			map[string]any{"index": 1.0, "text": "c", "finish_reason": "stop"},
+		}, v["choices"])
+	})
+
+	t.Run("embeddings", func(t *testing.T) {
+		_, body := post(t, "/v1/embeddings", `{"input":["a","b","a"],"dimensions":4}`)
+		data := decode(t, body)["data"].([]any)
+		require.Len(t, data, 3)
+		a := data[0].(map[string]any)["embedding"].([]any)
+		require.Len(t, a, 4)
+		require.Equal(t, a, data[2].(map[string]any)["embedding"], "Identical inputs should have identical embeddings")
+		require.NotEqual(t, a, data[1].(map[string]any)["embedding"])
+
+		var norm float64
+		for _, v := range a {
+			norm += v.(float64) * v.(float64)
+		}
+		require.InDelta(t, 1, norm, 1e-5)
+
+		_, body = post(t, "/v1/embeddings", `{"input":"a","encoding_format":"base64"}`)
+		encoded := decode(t, body)["data"].([]any)[0].(map[string]any)["embedding"].(string)
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		require.NoError(t, err)
+		require.Len(t, raw, 4*defaultDimensions)
+	})
+
+	t.Run("transcriptions", func(t *testing.T) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		require.NoError(t, mw.WriteField("prompt", "hello"))
+		require.NoError(t, mw.Close())
+		resp, err := client.Post("http://"+Host+"/v1/audio/transcriptions", mw.FormDataContentType(), &buf)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"text":"hello"}`, string(body))
+	})
+
+	t.Run("streamed transcriptions", func(t *testing.T) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		require.NoError(t, mw.WriteField("prompt", "hello world"))
+		require.NoError(t, mw.WriteField("stream", "true"))
+		require.NoError(t, mw.Close())
+		resp, err := client.Post("http://"+Host+"/v1/audio/transcriptions", mw.FormDataContentType(), &buf)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		require.Equal(t, ""+
+			`data: {"delta":"hello","type":"transcript.text.delta"}`+"\n\n"+
+			`data: {"delta":" world","type":"transcript.text.delta"}`+"\n\n"+
+			`data: {"text":"hello world","type":"transcript.text.done"}`+"\n\n"+
+			"data: [DONE]\n\n", string(body))
+	})
+
+	t.Run("speech", func(t *testing.T) {
+		resp, body := post(t, "/v1/audio/speech", `{"model":"m","input":"hello world","response_format":"wav"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "audio/wav", resp.Header.Get("Content-Type"))
+		require.Len(t, body, 44+2*speechTokenSample*2)
+		require.True(t, strings.HasPrefix(body, "RIFF"))
+
+		resp, body = post(t, "/v1/audio/speech", `{"model":"m","input":"hello","response_format":"pcm"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "audio/pcm", resp.Header.Get("Content-Type"))
+		require.Len(t, body, speechTokenSample*2)
+
+		resp, _ = post(t, "/v1/audio/speech", `{"model":"m","input":"hello","response_format":"mp3"}`)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("tokenize", func(t *testing.T) {
+		resp, body := post(t, "/tokenize", `{"model":"m","messages":[{"role":"user","content":"one two"},{"role":"user","content":"one"}]}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var tokenized struct {
+			Count  int   `json:"count"`
+			Tokens []int `json:"tokens"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &tokenized))
+		require.Equal(t, 3, tokenized.Count)
+		require.Len(t, tokenized.Tokens, 3)
+		require.Equal(t, tokenized.Tokens[0], tokenized.Tokens[2])
+	})
+
+	t.Run("unsupported path", func(t *testing.T) {
+		resp, body := post(t, "/v1/rerank", `{}`)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		require.Contains(t, body, "not supported by the Echo engine")
+	})
+}
+
+func TestHandlerDelay(t *testing.T) {
+	h, err := NewHandler([]string{"--delay=1h"})
+	require.NoError(t, err)
+	client := &http.Client{Transport: h}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+Host+"/v1/completions", strings.NewReader(`{"prompt":"hi"}`))
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,79 @@
+package echo
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// RoundTrip serves a request in-process, so that the Echo engine can be
+// used in place of the transport to model servers. The response body is
+// streamed as it is written by the handler.
+func (h *Handler) RoundTrip(req *http.Request) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	w := &pipeResponseWriter{
+		req:      req,
+		header:   http.Header{},
+		body:     pr,
+		pw:       pw,
+		response: make(chan *http.Response, 1),
+	}
+	go func() {
+		defer pw.Close()
+		if req.Body != nil {
+			// RoundTrippers must close request bodies.
+			defer req.Body.Close()
+		}
+		h.ServeHTTP(w, req)
+		w.WriteHeader(http.StatusOK)
+	}()
+
+	select {
+	case resp := <-w.response:
+		return resp, nil
+	case <-req.Context().Done():
+		// Unblock the handler.
+		pr.CloseWithError(req.Context().Err())
+		return nil, req.Context().Err()
+	}
+}
+
+// pipeResponseWriter sends the response once the handler writes the
+// header (or body) and pipes the body to the client.
+type pipeResponseWriter struct {
+	req      *http.Request
+	header   http.Header
+	body     *io.PipeReader
+	pw       *io.PipeWriter
+	once     sync.Once
+	response chan *http.Response
+}
+
+func (w *pipeResponseWriter) Header() http.Header { return w.header }
+
+func (w *pipeResponseWriter) WriteHeader(code int) {
+	w.once.Do(func() {
+		w.response <- &http.Response{
+			Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+			StatusCode:    code,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        w.header.Clone(),
+			Body:          w.body,
+			ContentLength: -1,
+			Request:       w.req,
+		}
+	})
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.pw.Write(p)
+}
+
+// Flush is a no-op, writes are unbuffered.
+func (w *pipeResponseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
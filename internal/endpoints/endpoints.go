@@ -1,56 +1,157 @@
 package endpoints
 
 import (
+	"container/list"
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand/v2"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
-func newEndpointGroup() *endpointGroup {
+func newEndpointGroup(model string) *endpointGroup {
 	e := &endpointGroup{}
+	e.model = model
 	e.endpoints = make(map[string]endpoint)
-	e.bcast = make(chan struct{})
+	e.waiters = list.New()
 	return e
 }
 
 type endpointGroup struct {
-	mtx       sync.RWMutex
+	model string
+
+	mtx       sync.Mutex
 	endpoints map[string]endpoint
+	// maxEndpointsPerRequest is the maximum number of distinct endpoints
+	// that a request with retry targeting is sent to (0 means no limit).
+	maxEndpointsPerRequest int
+	// canaryRevision is the revision (Pod hash) of the canary Pods while a
+	// canary rollout of the Model is evaluated, which are preferred for
+	// canaryPercent of the requests.
+	canaryRevision string
+	canaryPercent  int
 
-	bmtx  sync.RWMutex
-	bcast chan struct{} // closed when there's a broadcast
+	// waiters is a queue of *waiter that are blocked until an endpoint
+	// becomes available, ordered by priority and then arrival (see
+	// WithPriority). It only contains waiters for which no matching
+	// endpoint currently exists.
+	waiters *list.List
 }
 
 func newEndpoint(attrs endpointAttrs) endpoint {
 	return endpoint{
 		inFlight:      &atomic.Int64{},
+		usage:         &endpointUsage{},
 		endpointAttrs: attrs,
 	}
 }
 
 type endpoint struct {
 	inFlight *atomic.Int64
+	usage    *endpointUsage
 	endpointAttrs
 }
 
+// Errors returned by AwaitBestAddress when the context is done before an
+// address became available. They wrap the error of the context.
+var (
+	// ErrNoCapacity means that the Model had no endpoints.
+	ErrNoCapacity = errors.New("no endpoints available")
+	// ErrAdapterNotLoaded means that the Model had endpoints, but none of
+	// them had the requested adapter loaded.
+	ErrAdapterNotLoaded = errors.New("adapter not loaded")
+)
+
+// waiter is a request that is blocked in getBestAddr().
+type waiter struct {
+	adapter  string
+	priority int
+	// attempts is nil unless retry targeting is enabled for the request.
+	attempts *attempts
+	// reserved is set (under the group lock) when an address has been
+	// reserved for the waiter and sent on the result channel.
+	reserved bool
+	result   chan reservation
+}
+
+type reservation struct {
+	addr string
+	// decrement decrements the in-flight count of the address and returns
+	// the accelerator time (in seconds) that is attributed to the request.
+	decrement func() float64
+}
+
 // getBestAddr returns the best "IP:Port". It blocks until there are available endpoints
 // in the endpoint group. It selects the host with the minimum in-flight requests
-// among all the available endpoints.
-func (e *endpointGroup) getBestAddr(ctx context.Context, adapter string, awaitChangeEndpoints bool) (string, func(), error) {
-	e.mtx.RLock()
-	// await endpoints exists
-	for awaitChangeEndpoints || len(e.endpoints) == 0 {
-		e.mtx.RUnlock()
-		select {
-		case <-e.awaitEndpoints():
-		case <-ctx.Done():
-			return "", func() {}, ctx.Err()
+// among all the available endpoints (preferring other failure domains than
+// previous attempts if retry targeting is enabled in the context).
+// Blocked callers are served by priority and then in the order that they arrived.
+func (e *endpointGroup) getBestAddr(ctx context.Context, adapter string) (string, func(), error) {
+	attempts := attemptsFromContext(ctx)
+	e.mtx.Lock()
+	if res, ok := e.reserveBestAddr(adapter, attempts); ok {
+		if e.waiters.Len() > 0 {
+			// Earlier waiters are queued for endpoints (i.e. with a specific adapter)
+			// that do not exist yet.
+			e.recordQueueJump(ctx)
 		}
-		e.mtx.RLock()
+		e.mtx.Unlock()
+		return res.addr, usageFromContext(ctx).track(res), nil
+	}
+	w := &waiter{
+		adapter:  adapter,
+		priority: priorityFromContext(ctx),
+		attempts: attempts,
+		result:   make(chan reservation, 1),
 	}
+	elem := e.enqueueWaiter(w)
+	e.mtx.Unlock()
+
+	select {
+	case res := <-w.result:
+		return res.addr, usageFromContext(ctx).track(res), nil
+	case <-ctx.Done():
+		e.mtx.Lock()
+		reserved := w.reserved
+		if !reserved {
+			e.waiters.Remove(elem)
+		}
+		kind := ErrNoCapacity
+		if adapter != "" && len(e.endpoints) > 0 {
+			kind = ErrAdapterNotLoaded
+		}
+		e.mtx.Unlock()
+		if reserved {
+			// An address was reserved concurrently with cancellation,
+			// release it.
+			(<-w.result).decrement()
+		}
+		return "", func() {}, fmt.Errorf("%w: %w", kind, ctx.Err())
+	}
+}
+
+// reserveBestAddr selects the address with the minimum in-flight requests
+// that supports the given adapter and increments its in-flight count.
+// Addresses that share a failure domain with previous attempts are only
+// selected if there are no other addresses. Once the request was sent to
+// maxEndpointsPerRequest addresses, only those addresses are selected.
+// During a canary rollout, canary addresses are selected for canaryPercent
+// of the requests (if they support the adapter) and other addresses for
+// the rest.
+// Must be called with the lock held.
+func (e *endpointGroup) reserveBestAddr(adapter string, attempts *attempts) (reservation, bool) {
+	limited := attempts.limited(e.maxEndpointsPerRequest)
+	preferCanary := e.canaryRevision != "" && rand.IntN(100) < e.canaryPercent
 	var bestAddr string
-	var minInFlight int
+	var bestMismatch bool
+	var minInFlight, minPenalty int
 	for addr, ep := range e.endpoints {
 		if adapter != "" {
 			// Skip endpoints that don't have the requested adapter.
@@ -58,36 +159,92 @@ func (e *endpointGroup) getBestAddr(ctx context.Context, adapter string, awaitCh
 				continue
 			}
 		}
-		inFlight := int(e.endpoints[addr].inFlight.Load())
-		if bestAddr == "" || inFlight < minInFlight {
-			bestAddr = addr
-			minInFlight = inFlight
+		if limited && !attempts.sent(addr) {
+			// Skip endpoints that would exceed the maximum fan-out of the request.
+			continue
 		}
+		// mismatch is true if the address is not in the preferred
+		// group of a canary rollout.
+		mismatch := e.canaryRevision != "" && (ep.revision == e.canaryRevision) != preferCanary
+		penalty := attempts.penalty(addr, ep.failureDomain)
+		inFlight := int(ep.inFlight.Load())
+		switch {
+		case bestAddr == "":
+		case mismatch != bestMismatch:
+			if mismatch {
+				continue
+			}
+		case penalty != minPenalty:
+			if penalty > minPenalty {
+				continue
+			}
+		case inFlight >= minInFlight:
+			continue
+		}
+		bestAddr = addr
+		bestMismatch = mismatch
+		minInFlight = inFlight
+		minPenalty = penalty
 	}
 
 	if bestAddr == "" {
-		e.mtx.RUnlock()
-		return e.getBestAddr(ctx, adapter, true)
+		return reservation{}, false
 	}
 
+	if limited {
+		e.recordFanoutLimited()
+	}
 	ep := e.endpoints[bestAddr]
+	attempts.record(bestAddr, ep.failureDomain)
 	ep.inFlight.Add(1)
-	decFunc := func() {
-		log.Printf("decrementing in-flight count for %s, new in-flight: %v", bestAddr, ep.inFlight.Add(-1))
+	start := ep.usage.start(time.Now(), ep.accelerators)
+	return reservation{
+		addr: bestAddr,
+		decrement: func() float64 {
+			gpuSeconds := ep.usage.end(time.Now(), ep.accelerators) - start
+			log.Printf("decrementing in-flight count for %s, new in-flight: %v", bestAddr, ep.inFlight.Add(-1))
+			return gpuSeconds
+		},
+	}, true
+}
+
+// serveWaiters reserves addresses for queued waiters in queue order.
+// Waiters that can not be served remain queued in their original order.
+// Must be called with the lock held.
+func (e *endpointGroup) serveWaiters() {
+	var skipped bool
+	for elem := e.waiters.Front(); elem != nil; {
+		next := elem.Next()
+		w := elem.Value.(*waiter)
+		if res, ok := e.reserveBestAddr(w.adapter, w.attempts); ok {
+			if skipped {
+				e.recordQueueJump(context.Background())
+			}
+			w.reserved = true
+			w.result <- res
+			e.waiters.Remove(elem)
+		} else {
+			skipped = true
+		}
+		elem = next
 	}
-	e.mtx.RUnlock()
-	return bestAddr, decFunc, nil
 }
 
-func (e *endpointGroup) awaitEndpoints() chan struct{} {
-	e.bmtx.RLock()
-	defer e.bmtx.RUnlock()
-	return e.bcast
+func (e *endpointGroup) recordQueueJump(ctx context.Context) {
+	metrics.EndpointWaitQueueJumps.Add(ctx, 1, metric.WithAttributeSet(attribute.NewSet(
+		metrics.AttrRequestModel.String(e.model),
+	)))
+}
+
+func (e *endpointGroup) recordFanoutLimited() {
+	metrics.EndpointFanoutLimited.Add(context.Background(), 1, metric.WithAttributeSet(attribute.NewSet(
+		metrics.AttrRequestModel.String(e.model),
+	)))
 }
 
 func (e *endpointGroup) getAllAddrs() []string {
-	e.mtx.RLock()
-	defer e.mtx.RUnlock()
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
 
 	var hosts []string
 	for ip := range e.endpoints {
@@ -97,21 +254,63 @@ func (e *endpointGroup) getAllAddrs() []string {
 	return hosts
 }
 
+// getInFlightByPod returns the number of in-flight requests for each
+// endpoint that is backed by a Pod.
+func (g *endpointGroup) getInFlightByPod() map[string]int64 {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	inFlight := make(map[string]int64, len(g.endpoints))
+	for _, ep := range g.endpoints {
+		if ep.podName != "" {
+			inFlight[ep.podName] += ep.inFlight.Load()
+		}
+	}
+	return inFlight
+}
+
 func (g *endpointGroup) lenIPs() int {
-	g.mtx.RLock()
-	defer g.mtx.RUnlock()
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
 	return len(g.endpoints)
 }
 
 type endpointAttrs struct {
+	// podName is empty for external endpoints.
+	podName  string
 	adapters map[string]struct{}
+	// accelerators is the number of GPUs (or TPUs) of the endpoint.
+	// Zero for external endpoints.
+	accelerators float64
+	// revision is the Pod hash of the endpoint (empty for external endpoints).
+	revision string
+	failureDomain
+}
+
+func (g *endpointGroup) setMaxEndpointsPerRequest(max int) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.maxEndpointsPerRequest = max
+}
+
+// setCanary sets the revision of the canary Pods of a canary rollout and
+// the percentage of requests that are sent to them. An empty revision
+// means that no canary rollout is in progress.
+func (g *endpointGroup) setCanary(revision string, percent int) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.canaryRevision = revision
+	g.canaryPercent = percent
 }
 
 func (g *endpointGroup) setAddrs(addrs map[string]endpointAttrs) {
 	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
 	for addr, attrs := range addrs {
 		if ep, ok := g.endpoints[addr]; ok {
-			ep.adapters = attrs.adapters
+			ep.endpointAttrs = attrs
+			g.endpoints[addr] = ep
 		} else {
 			g.endpoints[addr] = newEndpoint(attrs)
 		}
@@ -121,18 +320,9 @@ func (g *endpointGroup) setAddrs(addrs map[string]endpointAttrs) {
 			delete(g.endpoints, addr)
 		}
 	}
-	g.mtx.Unlock()
 
-	// notify waiting requests
+	// Notify waiting requests.
 	if len(addrs) > 0 {
-		g.broadcastEndpoints()
+		g.serveWaiters()
 	}
 }
-
-func (g *endpointGroup) broadcastEndpoints() {
-	g.bmtx.Lock()
-	defer g.bmtx.Unlock()
-
-	close(g.bcast)
-	g.bcast = make(chan struct{})
-}
@@ -6,12 +6,12 @@ import (
 )
 
 func BenchmarkEndpointGroup(b *testing.B) {
-	e := newEndpointGroup()
+	e := newEndpointGroup("my-model")
 	e.setAddrs(map[string]endpointAttrs{"10.0.0.1": {}})
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			_, f, err := e.getBestAddr(context.Background(), "", false)
+			_, f, err := e.getBestAddr(context.Background(), "")
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -5,9 +5,11 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/metrics/metricstest"
 
 	"k8s.io/apimachinery/pkg/util/rand"
 )
@@ -25,13 +27,13 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 	for name, spec := range testCases {
 		randomReadFn := []func(g *endpointGroup){
-			func(g *endpointGroup) { g.getBestAddr(context.Background(), "", false) },
+			func(g *endpointGroup) { g.getBestAddr(context.Background(), "") },
 			func(g *endpointGroup) { g.getAllAddrs() },
 			func(g *endpointGroup) { g.lenIPs() },
 		}
 		t.Run(name, func(t *testing.T) {
 			// setup endpoint with one service so that requests are not waiting
-			endpoint := newEndpointGroup()
+			endpoint := newEndpointGroup("my-model")
 			endpoint.setAddrs(
 				map[string]endpointAttrs{myModel: {}},
 			)
@@ -77,10 +79,10 @@ func TestBlockAndWaitForEndpoints(t *testing.T) {
 			}()
 		}
 	}
-	endpoint := newEndpointGroup()
+	endpoint := newEndpointGroup("my-model")
 	ctx := context.TODO()
 	startTogether(100, func() {
-		endpoint.getBestAddr(ctx, "", false)
+		endpoint.getBestAddr(ctx, "")
 	})
 	startWg.Wait()
 
@@ -101,8 +103,8 @@ func TestAbortOnCtxCancel(t *testing.T) {
 	doneWg.Add(1)
 	go func(t *testing.T) {
 		startWg.Wait()
-		endpoint := newEndpointGroup()
-		_, f, err := endpoint.getBestAddr(ctx, "", false)
+		endpoint := newEndpointGroup("my-model")
+		_, f, err := endpoint.getBestAddr(ctx, "")
 		defer f()
 		require.Error(t, err)
 		doneWg.Done()
@@ -112,3 +114,225 @@ func TestAbortOnCtxCancel(t *testing.T) {
 
 	doneWg.Wait()
 }
+
+func TestWaitQueue(t *testing.T) {
+	metricstest.Init(t)
+
+	const (
+		model   = "my-model"
+		adapter = "my-adapter"
+	)
+	g := newEndpointGroup(model)
+
+	requireWaiters := func(n int) {
+		require.Eventually(t, func() bool {
+			g.mtx.Lock()
+			defer g.mtx.Unlock()
+			return g.waiters.Len() == n
+		}, time.Second, time.Millisecond)
+	}
+
+	type result struct {
+		addr string
+		err  error
+	}
+	adapterCtx, cancelAdapter := context.WithCancel(context.Background())
+	adapterResult := make(chan result, 1)
+	go func() {
+		addr, _, err := g.getBestAddr(adapterCtx, adapter)
+		adapterResult <- result{addr, err}
+	}()
+	requireWaiters(1)
+
+	plainResult := make(chan result, 1)
+	go func() {
+		addr, _, err := g.getBestAddr(context.Background(), "")
+		plainResult <- result{addr, err}
+	}()
+	requireWaiters(2)
+
+	// An endpoint without the adapter should only serve the second waiter.
+	g.setAddrs(map[string]endpointAttrs{"10.0.0.1:8000": {}})
+	res := <-plainResult
+	require.NoError(t, res.err)
+	require.Equal(t, "10.0.0.1:8000", res.addr)
+	requireWaiters(1)
+	metricstest.RequireEndpointWaitQueueJumpsMetric(t, metricstest.Collect(t), model, 1)
+
+	// Cancelled waiters should be removed from the queue.
+	cancelAdapter()
+	res = <-adapterResult
+	require.ErrorIs(t, res.err, context.Canceled)
+	require.ErrorIs(t, res.err, ErrAdapterNotLoaded)
+	requireWaiters(0)
+}
+
+func TestWaitQueuePriority(t *testing.T) {
+	g := newEndpointGroup("my-model")
+
+	// Waiters are queued while the Model has no endpoints.
+	done := make(chan struct{}, 4)
+	for i, priority := range []int{0, 1, 0, 2} {
+		go func() {
+			_, _, err := g.getBestAddr(WithPriority(context.Background(), priority), "")
+			require.NoError(t, err)
+			done <- struct{}{}
+		}()
+		require.Eventually(t, func() bool {
+			g.mtx.Lock()
+			defer g.mtx.Unlock()
+			return g.waiters.Len() == i+1
+		}, time.Second, time.Millisecond)
+	}
+
+	g.mtx.Lock()
+	var order []int
+	for elem := g.waiters.Front(); elem != nil; elem = elem.Next() {
+		order = append(order, elem.Value.(*waiter).priority)
+	}
+	g.mtx.Unlock()
+	require.Equal(t, []int{2, 1, 0, 0}, order)
+
+	g.setAddrs(map[string]endpointAttrs{"10.0.0.1:8000": {}})
+	for range 4 {
+		<-done
+	}
+}
+
+func TestRetryTargeting(t *testing.T) {
+	g := newEndpointGroup("my-model")
+	g.setAddrs(map[string]endpointAttrs{
+		"10.0.0.1:8000": {failureDomain: failureDomain{node: "node-a", zone: "zone-1"}},
+		"10.0.0.2:8000": {failureDomain: failureDomain{node: "node-a", zone: "zone-1"}},
+		"10.0.0.3:8000": {failureDomain: failureDomain{node: "node-b", zone: "zone-1"}},
+		"10.0.0.4:8000": {failureDomain: failureDomain{node: "node-c", zone: "zone-2"}},
+	})
+	// Load the endpoints in other failure domains so that they would not
+	// be selected based on in-flight requests alone.
+	for _, addr := range []string{"10.0.0.3:8000", "10.0.0.4:8000", "10.0.0.4:8000"} {
+		g.endpoints[addr].inFlight.Add(1)
+	}
+
+	ctx := WithRetryTargeting(context.Background())
+	first, _, err := g.getBestAddr(ctx, "")
+	require.NoError(t, err)
+	require.Contains(t, []string{"10.0.0.1:8000", "10.0.0.2:8000"}, first)
+
+	second, _, err := g.getBestAddr(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.4:8000", second, "retries should prefer other zones")
+
+	third, _, err := g.getBestAddr(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.3:8000", third, "retries should prefer other nodes")
+
+	fourth, _, err := g.getBestAddr(ctx, "")
+	require.NoError(t, err)
+	require.NotEqual(t, first, fourth, "retries should prefer other addresses")
+
+	// Without retry targeting, only in-flight requests are considered.
+	addr, _, err := g.getBestAddr(context.Background(), "")
+	require.NoError(t, err)
+	require.Contains(t, []string{"10.0.0.1:8000", "10.0.0.2:8000"}, addr)
+}
+
+func TestMaxEndpointsPerRequest(t *testing.T) {
+	metricstest.Init(t)
+
+	const model = "my-model"
+	g := newEndpointGroup(model)
+	g.setAddrs(map[string]endpointAttrs{
+		"10.0.0.1:8000": {failureDomain: failureDomain{node: "node-a"}},
+		"10.0.0.2:8000": {failureDomain: failureDomain{node: "node-b"}},
+		"10.0.0.3:8000": {failureDomain: failureDomain{node: "node-c"}},
+	})
+	g.setMaxEndpointsPerRequest(2)
+
+	ctx := WithRetryTargeting(context.Background())
+	sent := map[string]struct{}{}
+	for range 4 {
+		addr, _, err := g.getBestAddr(ctx, "")
+		require.NoError(t, err)
+		sent[addr] = struct{}{}
+	}
+	require.Len(t, sent, 2, "retries should only be sent to the first two endpoints")
+	require.Equal(t, 2, RequestEndpoints(ctx))
+	metricstest.RequireEndpointFanoutLimitedMetric(t, metricstest.Collect(t), model, 2)
+
+	// Without a limit, retries are spread over all endpoints.
+	g.setMaxEndpointsPerRequest(0)
+	ctx = WithRetryTargeting(context.Background())
+	for range 3 {
+		_, _, err := g.getBestAddr(ctx, "")
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, RequestEndpoints(ctx))
+	require.Zero(t, RequestEndpoints(context.Background()))
+}
+
+func TestCanary(t *testing.T) {
+	g := newEndpointGroup("my-model")
+	g.setAddrs(map[string]endpointAttrs{
+		"10.0.0.1:8000": {revision: "stable"},
+		"10.0.0.2:8000": {revision: "stable"},
+		"10.0.0.3:8000": {revision: "canary", adapters: map[string]struct{}{"my-adapter": {}}},
+	})
+
+	countCanary := func(adapter string) int {
+		var n int
+		for range 1000 {
+			addr, decrement, err := g.getBestAddr(context.Background(), adapter)
+			require.NoError(t, err)
+			decrement()
+			if addr == "10.0.0.3:8000" {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Without a canary rollout, the revision does not matter.
+	require.NotZero(t, countCanary(""))
+
+	g.setCanary("canary", 10)
+	require.InDelta(t, 100, countCanary(""), 40)
+
+	g.setCanary("canary", 0)
+	require.Zero(t, countCanary(""))
+	require.Equal(t, 1000, countCanary("my-adapter"), "canary endpoints should be used if no other endpoint matches")
+
+	g.setCanary("", 0)
+	require.NotZero(t, countCanary(""))
+}
+
+func TestGPUSeconds(t *testing.T) {
+	g := newEndpointGroup("my-model")
+	g.setAddrs(map[string]endpointAttrs{
+		"10.0.0.1:8000": {accelerators: 2},
+	})
+
+	// The first request has both GPUs to itself for 100ms.
+	first := WithUsage(context.Background())
+	_, done, err := g.getBestAddr(first, "")
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	// Then the second request shares the GPUs with the first request
+	// for 100ms.
+	second := WithUsage(context.Background())
+	_, secondDone, err := g.getBestAddr(second, "")
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	done()
+	secondDone()
+
+	require.InDelta(t, 0.3, GPUSeconds(first), 0.05)
+	require.InDelta(t, 0.1, GPUSeconds(second), 0.025)
+	// The requests are attributed the time that the GPUs were busy.
+	require.InDelta(t, 0.4, GPUSeconds(first)+GPUSeconds(second), 0.05)
+
+	// Usage is not tracked without WithUsage.
+	_, done, err = g.getBestAddr(context.Background(), "")
+	require.NoError(t, err)
+	done()
+	require.Zero(t, GPUSeconds(context.Background()))
+}
@@ -0,0 +1,32 @@
+package endpoints
+
+import (
+	"container/list"
+	"context"
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context in which AwaitBestAddress serves the request
+// before requests with a lower priority when they are waiting for an endpoint.
+// Requests without a priority have a priority of 0. Requests with the same
+// priority are served in the order that they arrived.
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priorityFromContext(ctx context.Context) int {
+	p, _ := ctx.Value(priorityKey{}).(int)
+	return p
+}
+
+// enqueueWaiter adds a waiter behind the waiters with the same or a higher
+// priority. Must be called with the lock held.
+func (e *endpointGroup) enqueueWaiter(w *waiter) *list.Element {
+	for elem := e.waiters.Back(); elem != nil; elem = elem.Prev() {
+		if elem.Value.(*waiter).priority >= w.priority {
+			return e.waiters.InsertAfter(w, elem)
+		}
+	}
+	return e.waiters.PushFront(w)
+}
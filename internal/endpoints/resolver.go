@@ -4,24 +4,38 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
 	"github.com/substratusai/kubeai/internal/k8sutils"
+	"github.com/substratusai/kubeai/internal/modelnamespaces"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func NewResolver(mgr ctrl.Manager) (*Resolver, error) {
+// externalHealthCheckInterval is the time between health checks of
+// a Model's external endpoints.
+const externalHealthCheckInterval = 10 * time.Second
+
+func NewResolver(mgr ctrl.Manager, namespaces []string) (*Resolver, error) {
 	r := &Resolver{}
 	r.Client = mgr.GetClient()
+	r.Namespaces = namespaces
 	r.endpoints = map[string]*endpointGroup{}
+	r.externalAddrs = map[string]map[string]endpointAttrs{}
 	r.ExcludePods = map[string]struct{}{}
+	r.HealthCheckClient = &http.Client{Timeout: 3 * time.Second}
 	if err := r.SetupWithManager(mgr); err != nil {
 		return nil, err
 	}
@@ -38,10 +52,32 @@ type Resolver struct {
 	selfIPsMtx sync.RWMutex
 	selfIPs    []string
 
+	externalAddrsMtx sync.RWMutex
+	// map[<model-name>]map[<addr>]endpointAttrs
+	// Only contains external endpoints that passed the last health check.
+	externalAddrs map[string]map[string]endpointAttrs
+
+	// HealthCheckClient is used to check the health of external endpoints.
+	HealthCheckClient *http.Client
+
 	ExcludePods map[string]struct{}
+
+	// Namespaces that Models are served from in order of precedence.
+	// Endpoints of shadowed Models (see the modelnamespaces package)
+	// are ignored.
+	Namespaces []string
 }
 
 func (r *Resolver) SetupWithManager(mgr ctrl.Manager) error {
+	if err := ctrl.NewControllerManagedBy(mgr).
+		Named("external-endpoints").
+		WithOptions(controller.Options{NeedLeaderElection: ptr.To(false)}).
+		For(&kubeaiv1.Model{}).
+		Watches(&kubeaiv1.Model{}, handler.EnqueueRequestsFromMapFunc(modelnamespaces.SameNameRequests(r.Namespaces))).
+		Complete(reconcile.Func(r.reconcileExternalEndpoints)); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		WithOptions(controller.Options{NeedLeaderElection: ptr.To(false)}).
 		For(&corev1.Pod{}).
@@ -85,9 +121,27 @@ func (r *Resolver) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result
 		return ctrl.Result{}, nil
 	}
 
+	if err := r.syncModelEndpoints(ctx, pod.Namespace, modelName); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// syncModelEndpoints recalculates the set of addresses for the given Model
+// from its ready Pods and healthy external endpoints.
+func (r *Resolver) syncModelEndpoints(ctx context.Context, namespace, modelName string) error {
+	shadowing, err := modelnamespaces.Shadowing(ctx, r.Client, r.Namespaces, types.NamespacedName{Namespace: namespace, Name: modelName})
+	if err != nil {
+		return fmt.Errorf("checking for models with the same name: %w", err)
+	}
+	if shadowing != nil {
+		return nil
+	}
+
 	var podList corev1.PodList
-	if err := r.List(ctx, &podList, client.InNamespace(pod.Namespace), client.MatchingLabels{kubeaiv1.PodModelLabel: modelName}); err != nil {
-		return ctrl.Result{}, fmt.Errorf("listing matching pods: %w", err)
+	if err := r.List(ctx, &podList, client.InNamespace(namespace), client.MatchingLabels{kubeaiv1.PodModelLabel: modelName}); err != nil {
+		return fmt.Errorf("listing matching pods: %w", err)
 	}
 
 	addrs := map[string]endpointAttrs{}
@@ -95,9 +149,23 @@ func (r *Resolver) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result
 		if _, exclude := r.ExcludePods[pod.Name]; exclude {
 			continue
 		}
+		// Requests of multi-node Models are only sent to the leader Pods.
+		if pod.Labels[kubeaiv1.PodRoleLabel] == kubeaiv1.PodRoleWorker {
+			continue
+		}
 		if !k8sutils.PodIsReady(&pod) {
 			continue
 		}
+		// Stop sending new requests to terminating Pods so that they can
+		// drain before the end of their grace period.
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		// Same for Pods that are about to be terminated
+		// (i.e. on a preempted spot Node).
+		if k8sutils.PodIsDisrupted(&pod) {
+			continue
+		}
 
 		// The Model controller should always set the port annotation in the Pods it creates
 		// to communicate the port that the given backend listens on.
@@ -121,14 +189,129 @@ func (r *Resolver) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result
 		addrs[ip+":"+port] = getEndpointAttrs(pod)
 	}
 
+	r.externalAddrsMtx.RLock()
+	for addr, attrs := range r.externalAddrs[modelName] {
+		addrs[addr] = attrs
+	}
+	r.externalAddrsMtx.RUnlock()
+
 	r.getEndpoints(modelName).setAddrs(addrs)
 
-	return ctrl.Result{}, nil
+	return nil
+}
+
+// reconcileExternalEndpoints health checks the external endpoints of a Model
+// and registers the healthy ones alongside the Model's Pod endpoints.
+// It requeues itself to continuously health check the endpoints.
+// It also applies the Model's maxEndpointsPerRequest and the traffic split
+// of a canary rollout to its endpoints.
+func (r *Resolver) reconcileExternalEndpoints(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if shadowing, err := modelnamespaces.Shadowing(ctx, r.Client, r.Namespaces, req.NamespacedName); err != nil {
+		return ctrl.Result{}, fmt.Errorf("checking for models with the same name: %w", err)
+	} else if shadowing != nil {
+		return ctrl.Result{}, nil
+	}
+
+	var model kubeaiv1.Model
+	if err := r.Get(ctx, req.NamespacedName, &model); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		if r.setExternalAddrs(req.Name, nil) {
+			return ctrl.Result{}, r.syncModelEndpoints(ctx, req.Namespace, req.Name)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	r.getEndpoints(model.Name).setMaxEndpointsPerRequest(int(ptr.Deref(model.Spec.MaxEndpointsPerRequest, 0)))
+	if w := model.Status.Weights; w != nil && w.SwapRevision != "" {
+		// Pods with new weights only serve requests once all of them are
+		// ready (or if no other Pods are left).
+		r.getEndpoints(model.Name).setCanary(w.SwapRevision, 0)
+	} else if ro := model.Status.Rollout; ro != nil && ro.Phase == kubeaiv1.RolloutPhaseCanary && model.Spec.Rollout != nil {
+		r.getEndpoints(model.Name).setCanary(ro.Revision, int(model.Spec.Rollout.CanaryPercent))
+	} else {
+		r.getEndpoints(model.Name).setCanary("", 0)
+	}
+
+	healthy := r.checkExternalEndpoints(ctx, model.Spec.ExternalEndpoints)
+	if r.setExternalAddrs(model.Name, healthy) {
+		if err := r.syncModelEndpoints(ctx, model.Namespace, model.Name); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if len(model.Spec.ExternalEndpoints) == 0 {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: externalHealthCheckInterval}, nil
+}
+
+// checkExternalEndpoints returns the addresses of the endpoints that
+// responded to a health check with a 2xx status code.
+// External endpoints are not associated with any adapters.
+func (r *Resolver) checkExternalEndpoints(ctx context.Context, eps []kubeaiv1.ExternalEndpoint) map[string]endpointAttrs {
+	healthy := map[string]endpointAttrs{}
+	for _, ep := range eps {
+		path := ep.HealthPath
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+ep.Address+path, nil)
+		if err != nil {
+			log.Printf("ERROR: Creating health check request for external endpoint %s: %v", ep.Address, err)
+			continue
+		}
+		resp, err := r.HealthCheckClient.Do(req)
+		if err != nil {
+			log.Printf("External endpoint %s failed health check: %v", ep.Address, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			log.Printf("External endpoint %s failed health check: status %d", ep.Address, resp.StatusCode)
+			continue
+		}
+		healthy[ep.Address] = endpointAttrs{adapters: map[string]struct{}{}}
+	}
+	return healthy
+}
+
+// setExternalAddrs stores the healthy external addresses for a model and
+// returns true if they changed.
+func (r *Resolver) setExternalAddrs(model string, addrs map[string]endpointAttrs) bool {
+	r.externalAddrsMtx.Lock()
+	defer r.externalAddrsMtx.Unlock()
+
+	prev := r.externalAddrs[model]
+	changed := len(prev) != len(addrs)
+	for addr := range addrs {
+		if _, ok := prev[addr]; !ok {
+			changed = true
+		}
+	}
+
+	if len(addrs) == 0 {
+		delete(r.externalAddrs, model)
+	} else {
+		r.externalAddrs[model] = addrs
+	}
+
+	return changed
 }
 
 func getEndpointAttrs(pod corev1.Pod) endpointAttrs {
 	attrs := endpointAttrs{
-		adapters: map[string]struct{}{},
+		podName:      pod.Name,
+		adapters:     map[string]struct{}{},
+		accelerators: k8sutils.PodAccelerators(&pod),
+		revision:     pod.Labels[kubeaiv1.PodHashLabel],
+		failureDomain: failureDomain{
+			node: pod.Spec.NodeName,
+			// The zone label is only set on Pods if it is copied from the Node
+			// (i.e. by the PodTopologyLabels admission plugin or a webhook).
+			zone: pod.Labels[corev1.LabelTopologyZone],
+		},
 	}
 
 	for k := range pod.GetLabels() {
@@ -151,7 +334,7 @@ func (r *Resolver) getEndpoints(model string) *endpointGroup {
 	r.endpointsMtx.Lock()
 	e, ok := r.endpoints[model]
 	if !ok {
-		e = newEndpointGroup()
+		e = newEndpointGroup(model)
 		r.endpoints[model] = e
 	}
 	r.endpointsMtx.Unlock()
@@ -165,10 +348,16 @@ func (r *Resolver) GetSelfIPs() []string {
 }
 
 // AwaitBestAddress returns the "IP:Port" with the lowest number of in-flight requests. It will block until an endpoint
-// becomes available or the context times out. It returns a function that should be called when the
-// request is complete to decrement the in-flight count.
+// becomes available or the context times out (returning ErrNoCapacity or ErrAdapterNotLoaded). It returns a
+// function that should be called when the request is complete to decrement the in-flight count.
 func (r *Resolver) AwaitBestAddress(ctx context.Context, model, adapter string) (string, func(), error) {
-	return r.getEndpoints(model).getBestAddr(ctx, adapter, false)
+	return r.getEndpoints(model).getBestAddr(ctx, adapter)
+}
+
+// InFlightByPod returns the number of requests that this replica has in
+// flight to each of a Model's Pods, by Pod name.
+func (r *Resolver) InFlightByPod(model string) map[string]int64 {
+	return r.getEndpoints(model).getInFlightByPod()
 }
 
 // GetAllHosts retrieves the list of all hosts for a given model.
@@ -2,11 +2,17 @@ package endpoints
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestAwaitBestHost(t *testing.T) {
@@ -47,7 +53,7 @@ func TestAwaitBestHost(t *testing.T) {
 			addrs: map[string]endpointAttrs{
 				myAddrWithoutAdapter: {},
 			},
-			expErr: context.DeadlineExceeded,
+			expErr: ErrNoCapacity,
 		},
 		// not covered: unknown port with multiple ports on entrypoint
 	}
@@ -61,7 +67,8 @@ func TestAwaitBestHost(t *testing.T) {
 
 			gotAddr, gotFunc, gotErr := manager.AwaitBestAddress(ctx, spec.model, spec.adapter)
 			if spec.expErr != nil {
-				require.ErrorIs(t, spec.expErr, gotErr)
+				require.ErrorIs(t, gotErr, spec.expErr)
+				require.ErrorIs(t, gotErr, context.DeadlineExceeded)
 				return
 			}
 			require.NoError(t, gotErr)
@@ -70,3 +77,87 @@ func TestAwaitBestHost(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckExternalEndpoints(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	healthyAddr := strings.TrimPrefix(healthy.URL, "http://")
+	unhealthyAddr := strings.TrimPrefix(unhealthy.URL, "http://")
+	unreachableAddr := strings.TrimPrefix(unreachable.URL, "http://")
+
+	r := &Resolver{
+		endpoints:         map[string]*endpointGroup{},
+		externalAddrs:     map[string]map[string]endpointAttrs{},
+		HealthCheckClient: &http.Client{Timeout: time.Second},
+	}
+
+	got := r.checkExternalEndpoints(context.Background(), []kubeaiv1.ExternalEndpoint{
+		{Address: healthyAddr, HealthPath: "healthz"},
+		{Address: unreachableAddr, HealthPath: "/healthz"},
+		{Address: unhealthyAddr, HealthPath: "/health"},
+	})
+	require.Len(t, got, 1)
+	require.Contains(t, got, healthyAddr)
+
+	require.True(t, r.setExternalAddrs("my-model", got), "first set should report a change")
+	require.False(t, r.setExternalAddrs("my-model", got), "same addresses should not report a change")
+	require.True(t, r.setExternalAddrs("my-model", nil), "removing addresses should report a change")
+	require.NotContains(t, r.externalAddrs, "my-model")
+}
+
+func TestGetEndpointAttrs(t *testing.T) {
+	attrs := getEndpointAttrs(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-pod",
+			Labels: map[string]string{
+				kubeaiv1.PodAdapterLabelPrefix + "my-adapter": "hash",
+				corev1.LabelTopologyZone:                      "zone-1",
+			},
+		},
+		Spec: corev1.PodSpec{NodeName: "node-a"},
+	})
+	require.Equal(t, endpointAttrs{
+		podName:       "my-pod",
+		adapters:      map[string]struct{}{"my-adapter": {}},
+		failureDomain: failureDomain{node: "node-a", zone: "zone-1"},
+	}, attrs)
+}
+
+func TestInFlightByPod(t *testing.T) {
+	r := &Resolver{endpoints: map[string]*endpointGroup{}}
+	r.getEndpoints("my-model").setAddrs(map[string]endpointAttrs{
+		"10.0.0.1:8000":          {podName: "pod-a"},
+		"10.0.0.2:8000":          {podName: "pod-b"},
+		"external.example.com:1": {},
+	})
+
+	ctx := context.Background()
+	var decrements []func()
+	for i := 0; i < 3; i++ {
+		_, decrement, err := r.AwaitBestAddress(ctx, "my-model", "")
+		require.NoError(t, err)
+		decrements = append(decrements, decrement)
+	}
+	inFlight := r.InFlightByPod("my-model")
+	require.Len(t, inFlight, 2, "external endpoints should not be reported")
+	require.Equal(t, int64(2), inFlight["pod-a"]+inFlight["pod-b"])
+
+	for _, decrement := range decrements {
+		decrement()
+	}
+	require.Equal(t, map[string]int64{"pod-a": 0, "pod-b": 0}, r.InFlightByPod("my-model"))
+}
@@ -0,0 +1,113 @@
+package endpoints
+
+import (
+	"context"
+	"sync"
+)
+
+// failureDomain is the location of an endpoint. Endpoints in the same
+// failure domain are likely to fail together (i.e. when a Node fails).
+// Empty fields are unknown (i.e. for external endpoints).
+type failureDomain struct {
+	node string
+	zone string
+}
+
+// Penalties for selecting an endpoint that shares a failure domain with an
+// endpoint that was selected for a previous attempt of the same request.
+const (
+	penaltyNone = iota
+	penaltySameZone
+	penaltySameNode
+	penaltySameAddr
+)
+
+// attempts records the endpoints that were selected for previous
+// attempts of a request.
+type attempts struct {
+	mtx     sync.Mutex
+	addrs   map[string]struct{}
+	domains []failureDomain
+}
+
+type attemptsKey struct{}
+
+// WithRetryTargeting returns a context in which the endpoints that are
+// selected by AwaitBestAddress are remembered. When AwaitBestAddress is called
+// again with the context (i.e. to retry a failed request), endpoints in other
+// failure domains (Nodes and zones) than the previously selected endpoints are
+// preferred, so that correlated failures do not consume all retry attempts.
+func WithRetryTargeting(ctx context.Context) context.Context {
+	return context.WithValue(ctx, attemptsKey{}, &attempts{addrs: map[string]struct{}{}})
+}
+
+func attemptsFromContext(ctx context.Context) *attempts {
+	a, _ := ctx.Value(attemptsKey{}).(*attempts)
+	return a
+}
+
+// record remembers a selected endpoint. It is a no-op on a nil receiver.
+func (a *attempts) record(addr string, domain failureDomain) {
+	if a == nil {
+		return
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.addrs[addr] = struct{}{}
+	a.domains = append(a.domains, domain)
+}
+
+// limited returns true if the request was already sent to the maximum
+// number of distinct addresses (no limit if max is 0). It returns false
+// on a nil receiver.
+func (a *attempts) limited(max int) bool {
+	if a == nil || max == 0 {
+		return false
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return len(a.addrs) >= max
+}
+
+// sent returns true if the request was already sent to the address.
+func (a *attempts) sent(addr string) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	_, ok := a.addrs[addr]
+	return ok
+}
+
+// RequestEndpoints returns the number of distinct endpoints that were
+// selected by AwaitBestAddress with a context from WithRetryTargeting.
+func RequestEndpoints(ctx context.Context) int {
+	a := attemptsFromContext(ctx)
+	if a == nil {
+		return 0
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return len(a.addrs)
+}
+
+// penalty returns how strongly an endpoint should be avoided based on
+// the previous attempts. It returns penaltyNone on a nil receiver.
+func (a *attempts) penalty(addr string, domain failureDomain) int {
+	if a == nil {
+		return penaltyNone
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if _, ok := a.addrs[addr]; ok {
+		return penaltySameAddr
+	}
+	p := penaltyNone
+	for _, prev := range a.domains {
+		switch {
+		case domain.node != "" && domain.node == prev.node:
+			return penaltySameNode
+		case domain.zone != "" && domain.zone == prev.zone:
+			p = penaltySameZone
+		}
+	}
+	return p
+}
@@ -0,0 +1,97 @@
+package endpoints
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// usage accumulates the accelerator time that is attributed to a request.
+type usage struct {
+	mtx        sync.Mutex
+	gpuSeconds float64
+}
+
+type usageKey struct{}
+
+// WithUsage returns a context in which the accelerator time of the endpoints
+// that are selected by AwaitBestAddress is accumulated (see GPUSeconds).
+func WithUsage(ctx context.Context) context.Context {
+	return context.WithValue(ctx, usageKey{}, &usage{})
+}
+
+func usageFromContext(ctx context.Context) *usage {
+	u, _ := ctx.Value(usageKey{}).(*usage)
+	return u
+}
+
+// GPUSeconds returns the approximate accelerator time that was used by the
+// request of a context from WithUsage: the number of GPUs (or TPUs) of each
+// selected endpoint divided by its in-flight requests, integrated from the
+// selection until the in-flight count was decremented. Requests that are in
+// flight on an endpoint at the same time share its accelerators, so the
+// accelerator time of all requests adds up to the time that the endpoint was
+// busy. It returns 0 if usage is not tracked.
+func GPUSeconds(ctx context.Context) float64 {
+	u := usageFromContext(ctx)
+	if u == nil {
+		return 0
+	}
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	return u.gpuSeconds
+}
+
+// track returns the decrement function of a reservation which also adds the
+// accelerator time of the reservation to the usage (unless the receiver is
+// nil).
+func (u *usage) track(res reservation) func() {
+	return func() {
+		gpuSeconds := res.decrement()
+		if u == nil {
+			return
+		}
+		u.mtx.Lock()
+		u.gpuSeconds += gpuSeconds
+		u.mtx.Unlock()
+	}
+}
+
+// endpointUsage shares the accelerators of an endpoint between its in-flight
+// requests. It accumulates the accelerator time per request: the number of
+// accelerators divided by the number of in-flight requests, integrated over
+// time. The accelerator time of a request is the difference of the
+// accumulated time between its end and start.
+type endpointUsage struct {
+	mtx        sync.Mutex
+	inFlight   int
+	last       time.Time
+	perRequest float64
+}
+
+// advance accumulates the accelerator time per request until now.
+// Must be called with the lock held.
+func (u *endpointUsage) advance(now time.Time, accelerators float64) {
+	if u.inFlight > 0 {
+		u.perRequest += now.Sub(u.last).Seconds() * accelerators / float64(u.inFlight)
+	}
+	u.last = now
+}
+
+// start adds a request and returns the accumulated time at its start.
+func (u *endpointUsage) start(now time.Time, accelerators float64) float64 {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	u.advance(now, accelerators)
+	u.inFlight++
+	return u.perRequest
+}
+
+// end removes a request and returns the accumulated time at its end.
+func (u *endpointUsage) end(now time.Time, accelerators float64) float64 {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	u.advance(now, accelerators)
+	u.inFlight--
+	return u.perRequest
+}
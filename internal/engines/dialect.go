@@ -0,0 +1,78 @@
+// Package engines holds the parts of model serving engines (see the engine
+// of a Model) that are shared by the model proxy and the messenger.
+package engines
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Dialect adapts the OpenAI-compatible API that KubeAI serves to the API of
+// a model server that differs from it (i.e. other paths or parameters).
+// Engines whose model servers implement the OpenAI API have no Dialect.
+type Dialect interface {
+	// RewriteRequest rewrites the decoded JSON body of a request in place
+	// (see RewriteRequest for a copy) and returns the path that the request is sent to on the model server.
+	RewriteRequest(path string, params map[string]interface{}) (string, error)
+	// RewriteResponse rewrites the body of a successful, non-streaming JSON
+	// response to a request that was received on the given path.
+	// Event streams are passed through unchanged.
+	RewriteResponse(path string, body []byte) ([]byte, error)
+}
+
+var (
+	dialectsMtx sync.RWMutex
+	dialects    = map[string]Dialect{}
+)
+
+// RegisterDialect registers the Dialect of an engine. It is meant to be
+// called from init functions and panics if the engine already has one.
+func RegisterDialect(engine string, d Dialect) {
+	dialectsMtx.Lock()
+	defer dialectsMtx.Unlock()
+	if _, ok := dialects[engine]; ok {
+		panic(fmt.Sprintf("engines: dialect of engine %q registered twice", engine))
+	}
+	dialects[engine] = d
+}
+
+// RewriteRequest rewrites a copy of the decoded JSON body of a request for
+// a Dialect, so that the params of the request are left as received (i.e.
+// for retries and token estimates). It returns the path and the rewritten
+// params.
+func RewriteRequest(d Dialect, path string, params map[string]interface{}) (string, map[string]interface{}, error) {
+	params = copyJSON(params).(map[string]interface{})
+	path, err := d.RewriteRequest(path, params)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, params, nil
+}
+
+// copyJSON returns a deep copy of a decoded JSON value.
+func copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = copyJSON(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = copyJSON(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// LookupDialect returns the Dialect of an engine or nil if the model server
+// of the engine implements the OpenAI API.
+func LookupDialect(engine string) Dialect {
+	dialectsMtx.RLock()
+	defer dialectsMtx.RUnlock()
+	return dialects[engine]
+}
@@ -0,0 +1,50 @@
+package engines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type nopDialect struct{}
+
+func (nopDialect) RewriteRequest(path string, params map[string]interface{}) (string, error) {
+	return path, nil
+}
+
+func (nopDialect) RewriteResponse(path string, body []byte) ([]byte, error) {
+	return body, nil
+}
+
+// renameDialect renames the model parameter and the nested options.
+type renameDialect struct{}
+
+func (renameDialect) RewriteRequest(path string, params map[string]interface{}) (string, error) {
+	params["model_name"] = params["model"]
+	delete(params, "model")
+	params["options"].(map[string]interface{})["n"] = 2
+	return "/generate", nil
+}
+
+func (renameDialect) RewriteResponse(path string, body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func TestRewriteRequest(t *testing.T) {
+	params := map[string]interface{}{"model": "m", "options": map[string]interface{}{"n": 1}}
+	path, rewritten, err := RewriteRequest(renameDialect{}, "/v1/completions", params)
+	require.NoError(t, err)
+	require.Equal(t, "/generate", path)
+	require.Equal(t, map[string]interface{}{"model_name": "m", "options": map[string]interface{}{"n": 2}}, rewritten)
+	// The params of the request are not rewritten.
+	require.Equal(t, map[string]interface{}{"model": "m", "options": map[string]interface{}{"n": 1}}, params)
+}
+
+func TestRegisterDialect(t *testing.T) {
+	require.Nil(t, LookupDialect("Test"))
+
+	RegisterDialect("Test", nopDialect{})
+	require.Equal(t, nopDialect{}, LookupDialect("Test"))
+
+	require.Panics(t, func() { RegisterDialect("Test", nopDialect{}) })
+}
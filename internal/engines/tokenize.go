@@ -0,0 +1,32 @@
+package engines
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	tokenizePathsMtx sync.RWMutex
+	tokenizePaths    = map[string]string{}
+)
+
+// RegisterTokenizePath registers the path of the tokenize endpoint of the
+// model server of an engine (i.e. "/tokenize" for vLLM), which serves
+// requests of the format of vLLM. It is meant to be called from init
+// functions and panics if the engine already has one.
+func RegisterTokenizePath(engine, path string) {
+	tokenizePathsMtx.Lock()
+	defer tokenizePathsMtx.Unlock()
+	if _, ok := tokenizePaths[engine]; ok {
+		panic(fmt.Sprintf("engines: tokenize path of engine %q registered twice", engine))
+	}
+	tokenizePaths[engine] = path
+}
+
+// LookupTokenizePath returns the path of the tokenize endpoint of the model
+// server of an engine or "" if it has none.
+func LookupTokenizePath(engine string) string {
+	tokenizePathsMtx.RLock()
+	defer tokenizePathsMtx.RUnlock()
+	return tokenizePaths[engine]
+}
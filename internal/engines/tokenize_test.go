@@ -0,0 +1,16 @@
+package engines
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterTokenizePath(t *testing.T) {
+	require.Empty(t, LookupTokenizePath("Test"))
+
+	RegisterTokenizePath("Test", "/tokenize")
+	require.Equal(t, "/tokenize", LookupTokenizePath("Test"))
+
+	require.Panics(t, func() { RegisterTokenizePath("Test", "/tokenize") })
+}
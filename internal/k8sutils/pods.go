@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"hash"
 	"hash/fnv"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/dump"
@@ -23,6 +25,47 @@ func PodIsReady(pod *corev1.Pod) bool {
 	return false
 }
 
+// PodIsDisrupted returns true if the Pod is about to be terminated due to a
+// disruption (i.e. the preemption of its spot Node or a Node drain).
+func PodIsDisrupted(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.DisruptionTarget && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// PodUnschedulableSince returns the time since which a pending Pod has been
+// unable to be scheduled (i.e. because there is no Node with free GPUs).
+func PodUnschedulableSince(pod *corev1.Pod) (time.Time, bool) {
+	if pod.Status.Phase != corev1.PodPending || pod.DeletionTimestamp != nil {
+		return time.Time{}, false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse &&
+			c.Reason == corev1.PodReasonUnschedulable {
+			return c.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// PodAccelerators returns the number of accelerators (GPUs and TPUs) that
+// the containers of a Pod are limited to, based on the names of the extended
+// resources (i.e. "nvidia.com/gpu", "amd.com/gpu" or "google.com/tpu").
+func PodAccelerators(pod *corev1.Pod) float64 {
+	var n float64
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Limits {
+			if strings.HasSuffix(string(name), "/gpu") || strings.HasSuffix(string(name), "/tpu") {
+				n += q.AsApproximateFloat64()
+			}
+		}
+	}
+	return n
+}
+
 // PodHash returns a hash value calculated from Pod spec.
 // Inspired by k8s.io/kubernetes/pkg/controller.ComputeHash()
 func PodHash(podSpec corev1.PodSpec) string {
@@ -0,0 +1,198 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// drainer starts a graceful shutdown when requested through the admin API
+// (in the same way as a termination signal) and reports its progress, so
+// that instances can be drained before they are restarted.
+type drainer struct {
+	// defaultTimeout is the timeout of the drain phase unless
+	// a different timeout is requested.
+	defaultTimeout time.Duration
+	streams        []drainStream
+	// requested is closed when draining is requested.
+	requested chan struct{}
+
+	mtx sync.Mutex
+	// timeout is the requested timeout of the drain phase (0 for the default).
+	timeout   time.Duration
+	startedAt time.Time
+	phase     string
+	// errors of the shutdown phases that did not complete cleanly.
+	errors []string
+	// done is true once the drain phase finished.
+	done bool
+}
+
+// drainStream is a messaging stream whose in-flight messages
+// are reported and waited for while draining.
+type drainStream struct {
+	name      string
+	messenger interface {
+		ActiveHandlers() int
+		WaitHandlers(ctx context.Context) error
+	}
+}
+
+func newDrainer(defaultTimeout time.Duration, streams []drainStream) *drainer {
+	return &drainer{
+		defaultTimeout: defaultTimeout,
+		streams:        streams,
+		requested:      make(chan struct{}),
+	}
+}
+
+// DrainStatus is the response of the drain endpoint.
+type DrainStatus struct {
+	// State is "running", "draining" or "drained".
+	State     string     `json:"state"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	// Phase is the current shutdown phase.
+	Phase   string   `json:"phase,omitempty"`
+	Timeout string   `json:"timeout"`
+	Errors  []string `json:"errors,omitempty"`
+	// ActiveHandlers are the numbers of request messages that are
+	// being handled by messaging stream.
+	ActiveHandlers map[string]int `json:"activeHandlers"`
+}
+
+// NewHandler returns an admin API handler for draining the instance:
+//
+//	GET  /drain                - Report the drain progress.
+//	POST /drain?timeout=5m     - Stop receiving messages, wait (up to the optional timeout
+//	                             instead of shutdown.drainTimeout) for in-flight requests
+//	                             and messages and then exit.
+func (d *drainer) NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /drain", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.status())
+	})
+	mux.HandleFunc("POST /drain", func(w http.ResponseWriter, r *http.Request) {
+		var timeout time.Duration
+		if v := r.URL.Query().Get("timeout"); v != "" {
+			var err error
+			timeout, err = time.ParseDuration(v)
+			if err != nil || timeout <= 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid timeout: %q", v)})
+				return
+			}
+		}
+		d.request(timeout)
+		writeJSON(w, http.StatusAccepted, d.status())
+	})
+	return mux
+}
+
+// request starts draining. Later requests do not change the timeout.
+func (d *drainer) request(timeout time.Duration) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	select {
+	case <-d.requested:
+		return
+	default:
+	}
+	Log.Info("drain requested", "timeout", timeout)
+	d.timeout = timeout
+	close(d.requested)
+}
+
+// drainTimeout returns the timeout of the drain phase.
+func (d *drainer) drainTimeout() time.Duration {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.timeout > 0 {
+		return d.timeout
+	}
+	return d.defaultTimeout
+}
+
+// waitHandlers blocks until the messages of all streams are handled or
+// the context is done.
+func (d *drainer) waitHandlers(ctx context.Context) error {
+	for _, s := range d.streams {
+		if err := s.messenger.WaitHandlers(ctx); err != nil {
+			return fmt.Errorf("waiting for handlers of stream %q: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// drainPhase is the name of the shutdown phase that waits for in-flight
+// requests and messages. The instance is drained once it finished.
+const drainPhase = "drain"
+
+// track records the progress of the shutdown phases.
+func (d *drainer) track(phases []shutdownPhase) []shutdownPhase {
+	tracked := make([]shutdownPhase, len(phases))
+	for i, p := range phases {
+		tracked[i] = p
+		tracked[i].run = func(ctx context.Context) error {
+			d.mtx.Lock()
+			if d.startedAt.IsZero() {
+				d.startedAt = time.Now()
+			}
+			d.phase = p.name
+			d.mtx.Unlock()
+
+			err := p.run(ctx)
+
+			d.mtx.Lock()
+			defer d.mtx.Unlock()
+			if err != nil {
+				d.errors = append(d.errors, fmt.Sprintf("%s: %v", p.name, err))
+			}
+			if p.name == drainPhase {
+				d.done = true
+			}
+			return err
+		}
+	}
+	return tracked
+}
+
+func (d *drainer) status() DrainStatus {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	status := DrainStatus{
+		State:          "running",
+		Phase:          d.phase,
+		Errors:         slices.Clone(d.errors),
+		ActiveHandlers: map[string]int{},
+	}
+	status.Timeout = d.defaultTimeout.String()
+	if d.timeout > 0 {
+		status.Timeout = d.timeout.String()
+	}
+	if !d.startedAt.IsZero() {
+		startedAt := d.startedAt
+		status.StartedAt = &startedAt
+		status.State = "draining"
+	}
+	var active int
+	for _, s := range d.streams {
+		n := s.messenger.ActiveHandlers()
+		status.ActiveHandlers[s.name] = n
+		active += n
+	}
+	// Messages that were not finished within the drain timeout are
+	// still being handled.
+	if d.done && active == 0 {
+		status.State = "drained"
+	}
+	return status
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
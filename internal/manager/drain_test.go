@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMessenger struct {
+	active atomic.Int32
+}
+
+func (f *fakeMessenger) ActiveHandlers() int { return int(f.active.Load()) }
+
+func (f *fakeMessenger) WaitHandlers(ctx context.Context) error {
+	if f.active.Load() > 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func TestDrainer(t *testing.T) {
+	msgr := &fakeMessenger{}
+	msgr.active.Store(2)
+	d := newDrainer(5*time.Second, []drainStream{{name: "a", messenger: msgr}})
+	h := d.NewHandler()
+
+	do := func(method, url string) (int, DrainStatus) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		var status DrainStatus
+		if w.Code < 300 {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		}
+		return w.Code, status
+	}
+
+	code, status := do(http.MethodGet, "/drain")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "running", status.State)
+	require.Equal(t, map[string]int{"a": 2}, status.ActiveHandlers)
+	require.Equal(t, 5*time.Second, d.drainTimeout())
+
+	code, _ = do(http.MethodPost, "/drain?timeout=-1s")
+	require.Equal(t, http.StatusBadRequest, code)
+	select {
+	case <-d.requested:
+		t.Fatal("drain should not be requested")
+	default:
+	}
+
+	code, status = do(http.MethodPost, "/drain?timeout=1m")
+	require.Equal(t, http.StatusAccepted, code)
+	require.Equal(t, "1m0s", status.Timeout)
+	<-d.requested
+	require.Equal(t, time.Minute, d.drainTimeout())
+	// Later requests do not change the timeout.
+	code, _ = do(http.MethodPost, "/drain")
+	require.Equal(t, http.StatusAccepted, code)
+	require.Equal(t, time.Minute, d.drainTimeout())
+
+	drainStarted := make(chan struct{})
+	finishDrain := make(chan struct{})
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- shutdown(d.track([]shutdownPhase{
+			{name: "stop intake", timeout: time.Second, run: func(context.Context) error { return nil }},
+			{name: drainPhase, timeout: time.Second, run: func(context.Context) error {
+				close(drainStarted)
+				<-finishDrain
+				return nil
+			}},
+		}))
+	}()
+
+	<-drainStarted
+	_, status = do(http.MethodGet, "/drain")
+	require.Equal(t, "draining", status.State)
+	require.Equal(t, drainPhase, status.Phase)
+	require.NotNil(t, status.StartedAt)
+
+	close(finishDrain)
+	require.NoError(t, <-shutdownDone)
+	// Messages that were not finished within the timeout are still handled.
+	_, status = do(http.MethodGet, "/drain")
+	require.Equal(t, "draining", status.State)
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, d.waitHandlers(timeoutCtx), context.DeadlineExceeded)
+
+	msgr.active.Store(0)
+	require.NoError(t, d.waitHandlers(context.Background()))
+	_, status = do(http.MethodGet, "/drain")
+	require.Equal(t, "drained", status.State)
+}
@@ -3,12 +3,17 @@ package manager
 import (
 	"context"
 	"errors"
+	"os"
 
 	"github.com/substratusai/kubeai/internal/metrics"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 // setupOTelSDK bootstraps the OpenTelemetry pipeline.
@@ -38,13 +43,15 @@ func setupOTelSDK(ctx context.Context) (shutdown func(context.Context) error, er
 	otel.SetTextMapPropagator(prop)
 
 	// Set up trace provider.
-	//tracerProvider, err := newTraceProvider()
-	//if err != nil {
-	//	handleErr(err)
-	//	return
-	//}
-	//shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
-	//otel.SetTracerProvider(tracerProvider)
+	if tracingEnabled() {
+		tracerProvider, tpErr := newTraceProvider(ctx)
+		if tpErr != nil {
+			handleErr(tpErr)
+			return
+		}
+		shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
+		otel.SetTracerProvider(tracerProvider)
+	}
 
 	// Set up meter provider.
 	meterProvider, err := newMeterProvider()
@@ -79,20 +86,45 @@ func newPropagator() propagation.TextMapPropagator {
 	)
 }
 
-//func newTraceProvider() (*trace.TracerProvider, error) {
-//	traceExporter, err := stdouttrace.New(
-//		stdouttrace.WithPrettyPrint())
-//	if err != nil {
-//		return nil, err
-//	}
-//
-//	traceProvider := trace.NewTracerProvider(
-//		trace.WithBatcher(traceExporter,
-//			// Default is 5s. Set to 1s for demonstrative purposes.
-//			trace.WithBatchTimeout(time.Second)),
-//	)
-//	return traceProvider, nil
-//}
+// tracingEnabled returns true if an OTLP endpoint is configured for traces.
+// Otherwise spans are not recorded, but the trace context of requests is
+// still propagated.
+func tracingEnabled() bool {
+	for _, env := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"} {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// newTraceProvider returns a trace provider that exports spans over
+// OTLP/HTTP. The exporter, sampler and resource (i.e. OTEL_SERVICE_NAME)
+// are configured with the standard OTEL_* environment variables.
+func newTraceProvider(ctx context.Context) (*trace.TracerProvider, error) {
+	traceExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName("kubeai"),
+	))
+	if err != nil {
+		return nil, err
+	}
+	// Environment variables take precedence over the default service name.
+	res, err = resource.Merge(res, resource.Environment())
+	if err != nil {
+		return nil, err
+	}
+
+	traceProvider := trace.NewTracerProvider(
+		trace.WithBatcher(traceExporter),
+		trace.WithResource(res),
+	)
+	return traceProvider, nil
+}
 
 func newMeterProvider() (*metric.MeterProvider, error) {
 	//stdoutExporter, err := stdoutmetric.New()
@@ -0,0 +1,37 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceProvider(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	require.False(t, tracingEnabled())
+
+	var exported atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+			exported.Add(1)
+		}
+	}))
+	defer collector.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	require.True(t, tracingEnabled())
+
+	ctx := context.Background()
+	tp, err := newTraceProvider(ctx)
+	require.NoError(t, err)
+	_, span := tp.Tracer("test").Start(ctx, "test")
+	span.End()
+
+	// Spans are flushed on shutdown.
+	require.NoError(t, tp.Shutdown(ctx))
+	require.Equal(t, int32(1), exported.Load())
+}
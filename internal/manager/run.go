@@ -2,6 +2,7 @@ package manager
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -20,6 +21,7 @@ import (
 	"k8s.io/utils/ptr"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
@@ -31,19 +33,35 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/batchapi"
+	"github.com/substratusai/kubeai/internal/debuglog"
 	"github.com/substratusai/kubeai/internal/endpoints"
 	"github.com/substratusai/kubeai/internal/leader"
 	"github.com/substratusai/kubeai/internal/messenger"
+	"github.com/substratusai/kubeai/internal/metrics"
 	"github.com/substratusai/kubeai/internal/modelautoscaler"
+	"github.com/substratusai/kubeai/internal/modelbundlecontroller"
 	"github.com/substratusai/kubeai/internal/modelcontroller"
 	"github.com/substratusai/kubeai/internal/modelproxy"
 	"github.com/substratusai/kubeai/internal/modelscaler"
+	"github.com/substratusai/kubeai/internal/ollamaclient"
 	"github.com/substratusai/kubeai/internal/openaiserver"
+	"github.com/substratusai/kubeai/internal/requestindex"
 	"github.com/substratusai/kubeai/internal/vllmclient"
+	"github.com/substratusai/kubeai/internal/webhooks"
+	"github.com/substratusai/kubeai/internal/weightsclient"
 
 	// Pulling in these packages will register the gocloud implementations.
+	_ "gocloud.dev/blob/azureblob"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/gcsblob"
+	_ "gocloud.dev/blob/memblob"
+	_ "gocloud.dev/blob/s3blob"
+	_ "gocloud.dev/docstore/awsdynamodb"
+	_ "gocloud.dev/docstore/memdocstore"
 	_ "gocloud.dev/pubsub/awssnssqs"
 	_ "gocloud.dev/pubsub/azuresb"
 	_ "gocloud.dev/pubsub/gcppubsub"
@@ -53,6 +71,7 @@ import (
 
 	// +kubebuilder:scaffold:imports
 
+	"github.com/substratusai/kubeai/internal/admission"
 	"github.com/substratusai/kubeai/internal/config"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
@@ -86,6 +105,7 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 	if err != nil {
 		return err
 	}
+	metrics.SetRequestTags(cfg.Metrics.RequestTags)
 	// Handle shutdown properly so nothing leaks.
 	defer func() {
 		if err = errors.Join(err, otelShutdown(context.Background())); err != nil {
@@ -97,6 +117,11 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 	if !found {
 		return errors.New("POD_NAMESPACE not set")
 	}
+	modelNamespaces := cfg.ServedNamespaces(namespace)
+	cacheNamespaces := map[string]cache.Config{}
+	for _, ns := range modelNamespaces {
+		cacheNamespaces[ns] = cache.Config{}
+	}
 
 	{
 		cfgYaml, err := yaml.Marshal(cfg)
@@ -106,24 +131,22 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 		Log.Info("loaded config", "config", string(cfgYaml))
 	}
 
-	// if the enable-http2 flag is false (the default), http/2 should be disabled
-	// due to its vulnerabilities. More specifically, disabling http/2 will
+	// http/2 is disabled for the webhook server due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
 	// Rapid Reset CVEs. For more information see:
 	// - https://github.com/advisories/GHSA-qppj-fm5r-hxr3
 	// - https://github.com/advisories/GHSA-4374-p667-p6c8
-	//disableHTTP2 := func(c *tls.Config) {
-	//	Log.Info("disabling http/2")
-	//	c.NextProtos = []string{"http/1.1"}
-	//}
-
-	//if !enableHTTP2 {
-	//	tlsOpts = append(tlsOpts, disableHTTP2)
-	//}
+	disableHTTP2 := func(c *tls.Config) {
+		c.NextProtos = []string{"http/1.1"}
+	}
 
-	//webhookServer := webhook.NewServer(webhook.Options{
-	//	TLSOpts: tlsOpts,
-	//})
+	// The webhook server is only started if the Model validation webhook
+	// is enabled.
+	webhookServer := webhook.NewServer(webhook.Options{
+		Port:    cfg.ModelValidation.Port,
+		CertDir: cfg.ModelValidation.CertDir,
+		TLSOpts: []func(*tls.Config){disableHTTP2},
+	})
 
 	// Metrics endpoint is enabled in 'config/default/kustomization.yaml'. The Metrics options configure the server.
 	// More info:
@@ -138,9 +161,9 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 	}
 
 	mgr, err := ctrl.NewManager(k8sCfg, ctrl.Options{
-		Scheme:  Scheme,
-		Metrics: metricsServerOptions,
-		//WebhookServer:          webhookServer,
+		Scheme:                 Scheme,
+		Metrics:                metricsServerOptions,
+		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: cfg.HealthAddress,
 		// TODO: Consolidate controller and autoscaler leader election.
 		LeaderElection:          true,
@@ -151,10 +174,14 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 		RetryPeriod:             ptr.To(cfg.LeaderElection.RetryPeriod.Duration),
 		Cache: cache.Options{
 			Scheme: Scheme, //mgr.GetScheme(),
-			DefaultNamespaces: map[string]cache.Config{
-				// Restrict operations to this Namespace.
-				// (this should also be enforced by Namespaced RBAC rules)
-				namespace: {},
+			// Restrict operations to this Namespace and the namespaces
+			// that Models are served from.
+			// (this should also be enforced by Namespaced RBAC rules)
+			DefaultNamespaces: cacheNamespaces,
+			ByObject: map[client.Object]cache.ByObject{
+				// ConfigMaps (admission policies and the autoscaler state)
+				// are only read from this Namespace.
+				&corev1.ConfigMap{}: {Namespaces: map[string]cache.Config{namespace: {}}},
 			},
 		},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
@@ -204,32 +231,69 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 		cfg.LeaderElection.RetryPeriod.Duration,
 	)
 
-	endpointResolver, err := endpoints.NewResolver(mgr)
+	endpointResolver, err := endpoints.NewResolver(mgr, modelNamespaces)
 	if err != nil {
 		return fmt.Errorf("unable to setup model resolver: %w", err)
 	}
 
+	admissionPolicies, err := admission.NewPolicies(mgr, namespace)
+	if err != nil {
+		return fmt.Errorf("unable to setup admission policies: %w", err)
+	}
+
+	weightsClient := &weightsclient.Client{
+		HTTPClient:       &http.Client{Timeout: 10 * time.Second},
+		HuggingfaceToken: os.Getenv("HF_TOKEN"),
+	}
 	modelReconciler := &modelcontroller.ModelReconciler{
 		Client:                  mgr.GetClient(),
 		RESTConfig:              mgr.GetConfig(),
 		PodRESTClient:           podRESTClient,
 		Scheme:                  mgr.GetScheme(),
 		Namespace:               namespace,
+		ModelNamespaces:         modelNamespaces,
 		AllowPodAddressOverride: cfg.AllowPodAddressOverride,
 		SecretNames:             cfg.SecretNames,
 		ResourceProfiles:        cfg.ResourceProfiles,
 		CacheProfiles:           cfg.CacheProfiles,
+		Spot:                    cfg.Spot,
 		ModelServers:            cfg.ModelServers,
 		ModelServerPods:         cfg.ModelServerPods,
 		ModelLoaders:            cfg.ModelLoading,
 		ModelRollouts:           cfg.ModelRollouts,
+		InFlight:                endpointResolver,
 		VLLMClient: &vllmclient.Client{
 			HTTPClient: &http.Client{Timeout: 10 * time.Second},
 		},
+		OLlamaClient: &ollamaclient.Client{
+			HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		},
+		WeightsRevisions: weightsClient,
+		Vocabularies:     weightsClient,
 	}
 	if err = modelReconciler.SetupWithManager(mgr); err != nil {
 		return fmt.Errorf("unable to create Model controller: %w", err)
 	}
+	if cfg.ModelValidation.Enabled {
+		if err = modelReconciler.SetupWebhookWithManager(mgr); err != nil {
+			return fmt.Errorf("unable to create Model validation webhook: %w", err)
+		}
+	}
+	if err = (&modelbundlecontroller.ModelBundleReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create ModelBundle controller: %w", err)
+	}
+	if err := mgr.Add(&modelcontroller.WarmPool{
+		Client:           mgr.GetClient(),
+		Namespace:        namespace,
+		ResourceProfiles: cfg.ResourceProfiles,
+		ModelServers:     cfg.ModelServers,
+		Interval:         10 * time.Second,
+	}); err != nil {
+		return fmt.Errorf("unable to add warm pool: %w", err)
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -239,20 +303,26 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 		return fmt.Errorf("unable to set up ready check: %w", err)
 	}
 
-	modelScaler := modelscaler.NewModelScaler(mgr.GetClient(), namespace)
+	eventRecorder := mgr.GetEventRecorderFor("kubeai-autoscaler")
+	modelScaler := modelscaler.NewModelScaler(mgr.GetClient(), modelNamespaces, eventRecorder)
 
 	metricsPort, err := parsePortFromAddr(cfg.MetricsAddr)
 	if err != nil {
 		return fmt.Errorf("unable to parse metrics port: %w", err)
 	}
 
+	notifier := webhooks.New(cfg.Webhooks)
+
 	modelAutoscaler, err := modelautoscaler.New(
 		ctx,
 		k8sClient,
 		leaderElection,
 		modelScaler,
+		eventRecorder,
+		notifier,
 		endpointResolver,
 		cfg.ModelAutoscaling,
+		cfg.Metrics.Alerts,
 		metricsPort,
 		types.NamespacedName{Name: cfg.ModelAutoscaling.StateConfigMapName, Namespace: namespace},
 		cfg.FixedSelfMetricAddrs,
@@ -261,12 +331,38 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 		return fmt.Errorf("unable to create model autoscaler: %w", err)
 	}
 
-	modelProxy := modelproxy.NewHandler(modelScaler, endpointResolver, 3, nil)
-	openaiHandler := openaiserver.NewHandler(mgr.GetClient(), modelProxy)
+	// Components are stopped in dependency order by the shutdown sequence
+	// at the end of Run() instead of all at once when ctx is cancelled:
+	//
+	// intakeCtx: Messenger receive loops and the autoscaler.
+	// serveCtx: In-flight API requests (only cancelled if draining times out).
+	// lbCtx: Controllers (including the endpoint resolver) and leader election.
+	intakeCtx, stopIntake := context.WithCancel(context.Background())
+	defer stopIntake()
+	serveCtx, cancelServe := context.WithCancel(context.Background())
+	defer cancelServe()
+	lbCtx, stopLB := context.WithCancel(context.Background())
+	defer stopLB()
+
+	modelProxy := modelproxy.NewHandler(modelScaler, endpointResolver, 3, nil, cfg.ModelProxy)
+	modelProxy.Admission = admissionPolicies
+	modelProxy.Webhooks = notifier
+	var (
+		batchAPI        *batchapi.Service
+		batchAPIHandler http.Handler
+	)
+	if b := cfg.Messaging.BatchAPI; b != nil {
+		batchAPI, err = batchapi.Open(ctx, *b, leaderElection.IsLeader)
+		if err != nil {
+			return fmt.Errorf("unable to open batch api: %w", err)
+		}
+		batchAPIHandler = batchAPI.NewHandler()
+	}
+	openaiHandler := openaiserver.NewHandler(mgr.GetClient(), modelNamespaces, modelProxy, batchAPIHandler)
 	mux := http.NewServeMux()
 	mux.Handle("/openai/", openaiHandler)
 	apiServer := &http.Server{
-		BaseContext: func(_ net.Listener) context.Context { return ctx },
+		BaseContext: func(_ net.Listener) context.Context { return serveCtx },
 		Addr:        ":8000",
 		Handler:     mux,
 	}
@@ -277,16 +373,27 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 		Handler: metricsMux,
 	}
 	metricsMux.Handle("/metrics", promhttp.Handler())
+	metricsMux.Handle("/external-metrics/", modelAutoscaler.NewExternalMetricsHandler())
+	metricsMux.Handle("/alerts", modelAutoscaler.NewAlertsHandler())
+
+	var requestIndex *requestindex.Index
+	if idx := cfg.Messaging.RequestIndex; idx != nil {
+		requestIndex, err = requestindex.Open(ctx, idx.URL, idx.Retention.Duration)
+		if err != nil {
+			return fmt.Errorf("unable to open request index: %w", err)
+		}
+	}
 
-	httpClient := &http.Client{}
+	httpClient := &http.Client{Transport: modelProxy.Transport()}
 
-	var msgrs []*messenger.Messenger
+	var (
+		msgrs        []*messenger.Messenger
+		drainStreams []drainStream
+	)
 	for i, stream := range cfg.Messaging.Streams {
 		msgr, err := messenger.NewMessenger(
 			ctx,
-			stream.RequestsURL,
-			stream.ResponsesURL,
-			stream.MaxHandlers,
+			stream,
 			cfg.Messaging.ErrorMaxBackoff.Duration,
 			modelScaler,
 			endpointResolver,
@@ -295,25 +402,67 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 		if err != nil {
 			return fmt.Errorf("unable to create messenger[%v]: %w", i, err)
 		}
+		msgr.Admission = admissionPolicies
+		msgr.Moderator = modelProxy
+		if requestIndex != nil {
+			msgr.RequestIndex = requestIndex
+		}
 		msgrs = append(msgrs, msgr)
+		drainStreams = append(drainStreams, drainStream{name: stream.Name, messenger: msgr})
+	}
+	drain := newDrainer(cfg.Shutdown.DrainTimeout.Duration, drainStreams)
+
+	// The admin API is served separately from the metrics, which are
+	// scraped over the Pod network.
+	adminMux := http.NewServeMux()
+	adminServer := &http.Server{
+		Addr:    cfg.AdminAddr,
+		Handler: adminMux,
+	}
+	adminMux.Handle("/debug/", debuglog.NewHandler())
+	adminMux.Handle("/drain", drain.NewHandler())
+	if requestIndex != nil {
+		requestsHandler := requestIndex.NewHandler()
+		adminMux.Handle("/requests", requestsHandler)
+		adminMux.Handle("/requests/", requestsHandler)
 	}
 
-	var wg sync.WaitGroup
+	var (
+		// Each WaitGroup tracks the components stopped by a single shutdown phase.
+		intakeWG     sync.WaitGroup
+		messengersWG sync.WaitGroup
+		serversWG    sync.WaitGroup
+		lbWG         sync.WaitGroup
+	)
 
-	wg.Add(1)
+	intakeWG.Add(1)
 	go func() {
 		defer func() {
 			Log.Info("autoscaler stopped")
-			wg.Done()
+			intakeWG.Done()
 		}()
-		modelAutoscaler.Start(ctx)
+		modelAutoscaler.Start(intakeCtx)
 	}()
+	if requestIndex != nil {
+		intakeWG.Add(1)
+		go func() {
+			defer intakeWG.Done()
+			requestIndex.Start(intakeCtx)
+		}()
+	}
+	if batchAPI != nil {
+		intakeWG.Add(1)
+		go func() {
+			defer intakeWG.Done()
+			batchAPI.Start(intakeCtx)
+		}()
+	}
 
-	wg.Add(1)
+	serversWG.Add(1)
 	go func() {
 		defer func() {
 			Log.Info("api server stopped")
-			wg.Done()
+			serversWG.Done()
 		}()
 		Log.Info("starting api server", "addr", apiServer.Addr)
 		if err := apiServer.ListenAndServe(); err != nil {
@@ -325,11 +474,11 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 			}
 		}
 	}()
-	wg.Add(1)
+	serversWG.Add(1)
 	go func() {
 		defer func() {
 			Log.Info("metrics server stopped")
-			wg.Done()
+			serversWG.Done()
 		}()
 		Log.Info("starting metrics server", "addr", metricsServer.Addr)
 		if err := metricsServer.ListenAndServe(); err != nil {
@@ -341,14 +490,35 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 			}
 		}
 	}()
-	wg.Add(1)
+	serversWG.Add(1)
+	go func() {
+		defer func() {
+			Log.Info("admin server stopped")
+			serversWG.Done()
+		}()
+		Log.Info("starting admin server", "addr", adminServer.Addr)
+		if err := adminServer.ListenAndServe(); err != nil {
+			if errors.Is(err, http.ErrServerClosed) {
+				Log.Info("admin server closed")
+			} else {
+				Log.Error(err, "error serving admin server")
+				os.Exit(1)
+			}
+		}
+	}()
+	lbWG.Add(1)
+	go func() {
+		defer lbWG.Done()
+		notifier.Start(lbCtx)
+	}()
+	lbWG.Add(1)
 	go func() {
 		defer func() {
 			Log.Info("leader election stopped")
-			wg.Done()
+			lbWG.Done()
 		}()
 		Log.Info("starting leader election")
-		err := leaderElection.Start(ctx)
+		err := leaderElection.Start(lbCtx)
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
 				Log.Info("context cancelled while running leader election")
@@ -359,14 +529,14 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 		}
 	}()
 	for i := range msgrs {
-		wg.Add(1)
+		messengersWG.Add(1)
 		go func() {
 			defer func() {
 				Log.Info("messenger stopped", "index", i)
-				wg.Done()
+				messengersWG.Done()
 			}()
 			Log.Info("Starting messenger", "index", i)
-			err := msgrs[i].Start(ctx)
+			err := msgrs[i].Start(intakeCtx)
 			if err != nil {
 				if errors.Is(err, context.Canceled) {
 					Log.Info("context cancelled while running manager")
@@ -379,24 +549,91 @@ func Run(ctx context.Context, k8sCfg *rest.Config, cfg config.System) error {
 	}
 
 	Log.Info("starting controller-manager")
-	wg.Add(1)
+	lbWG.Add(1)
 	go func() {
 		defer func() {
 			Log.Info("controller-manager stopped")
-			wg.Done()
+			lbWG.Done()
 		}()
-		if err := mgr.Start(ctx); err != nil {
+		if err := mgr.Start(lbCtx); err != nil {
 			if !errors.Is(err, context.Canceled) {
 				Log.Error(err, "error running controller-manager")
 				os.Exit(1)
 			}
 		}
-		apiServer.Shutdown(context.Background())
-		metricsServer.Shutdown(context.Background())
 	}()
 
 	Log.Info("run launched all goroutines")
-	wg.Wait()
+	select {
+	case <-ctx.Done():
+		Log.Info("run context done, shutting down")
+	case <-drain.requested:
+		Log.Info("drain requested, shutting down")
+	}
+
+	shutdownErr := shutdown(drain.track([]shutdownPhase{
+		{
+			// Stop receiving new messages and stop making scaling decisions.
+			name:    "stop intake",
+			timeout: time.Second,
+			run: func(ctx context.Context) error {
+				stopIntake()
+				return waitWithContext(ctx, &intakeWG)
+			},
+		},
+		{
+			// Stop accepting new API requests and wait for in-flight
+			// requests and messages to complete. The load balancer is still
+			// running at this point so that requests can find a backend.
+			name:    drainPhase,
+			timeout: drain.drainTimeout(),
+			run: func(ctx context.Context) error {
+				err := errors.Join(
+					apiServer.Shutdown(ctx),
+					waitWithContext(ctx, &messengersWG),
+					drain.waitHandlers(ctx),
+				)
+				if err != nil {
+					// Abort any requests that are still in-flight.
+					cancelServe()
+				}
+				if requestIndex != nil {
+					// Persists in-memory indexes that are configured with a filename.
+					err = errors.Join(err, requestIndex.Close())
+				}
+				if batchAPI != nil {
+					// Batches that are still being published expire.
+					err = errors.Join(err, batchAPI.Close(ctx))
+				}
+				return err
+			},
+		},
+		{
+			name:    "stop load balancer",
+			timeout: 2 * time.Second,
+			run: func(ctx context.Context) error {
+				stopLB()
+				return waitWithContext(ctx, &lbWG)
+			},
+		},
+		{
+			// Stop the metrics and admin servers last so that metrics
+			// and the progress of the drain phase can still be read.
+			name:    "flush metrics",
+			timeout: time.Second,
+			run: func(ctx context.Context) error {
+				return errors.Join(
+					metricsServer.Shutdown(ctx),
+					adminServer.Shutdown(ctx),
+					waitWithContext(ctx, &serversWG),
+					otelShutdown(ctx),
+				)
+			},
+		},
+	}))
+	if shutdownErr != nil {
+		Log.Error(shutdownErr, "shutdown did not complete cleanly")
+	}
 	Log.Info("run goroutines finished")
 
 	return nil
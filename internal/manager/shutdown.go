@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// shutdownPhase is a single step in the ordered shutdown sequence.
+type shutdownPhase struct {
+	name    string
+	timeout time.Duration
+	run     func(ctx context.Context) error
+}
+
+// shutdown runs each phase in order, giving each phase its own timeout.
+// A phase that fails or times out is logged and the remaining phases
+// are still run.
+func shutdown(phases []shutdownPhase) error {
+	var err error
+	for _, p := range phases {
+		start := time.Now()
+		Log.Info("starting shutdown phase", "phase", p.name, "timeout", p.timeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		phaseErr := p.run(ctx)
+		cancel()
+
+		if phaseErr != nil {
+			Log.Error(phaseErr, "shutdown phase did not complete cleanly", "phase", p.name, "duration", time.Since(start))
+			err = errors.Join(err, fmt.Errorf("%s: %w", p.name, phaseErr))
+			continue
+		}
+		Log.Info("finished shutdown phase", "phase", p.name, "duration", time.Since(start))
+	}
+	return err
+}
+
+// waitWithContext waits for the WaitGroup to complete or for the
+// context to be done, whichever happens first.
+func waitWithContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
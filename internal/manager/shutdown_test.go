@@ -0,0 +1,38 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown(t *testing.T) {
+	var order []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	var blocked sync.WaitGroup
+	blocked.Add(1)
+	defer blocked.Done()
+
+	err := shutdown([]shutdownPhase{
+		{name: "first", timeout: time.Second, run: record("first")},
+		{name: "times-out", timeout: 10 * time.Millisecond, run: func(ctx context.Context) error {
+			order = append(order, "times-out")
+			return waitWithContext(ctx, &blocked)
+		}},
+		{name: "last", timeout: time.Second, run: record("last")},
+	})
+
+	require.Equal(t, []string{"first", "times-out", "last"}, order, "all phases should run in order")
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "timed out phase should be reported")
+	require.ErrorContains(t, err, "times-out")
+}
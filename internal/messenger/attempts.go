@@ -0,0 +1,145 @@
+package messenger
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"strconv"
+	"sync"
+
+	pb "cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	sqstypesv2 "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go/aws"
+	sqsv1 "github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"gocloud.dev/pubsub"
+)
+
+// maxTrackedAttempts is the maximum number of messages that attempts are
+// counted for. The messages that were first counted the longest time ago
+// are forgotten first.
+const maxTrackedAttempts = 10000
+
+// attemptCounter counts the failed attempts to handle request messages.
+// All methods are no-ops on a nil receiver.
+//
+// NOTE: Attempts are counted in memory, so redeliveries to other KubeAI
+// instances are counted separately. See deliveryAttempt() for providers
+// that count deliveries themselves.
+type attemptCounter struct {
+	mtx sync.Mutex
+	// order is ordered from the least to the most recently added key.
+	order *list.List
+	byKey map[string]*list.Element
+}
+
+type attemptEntry struct {
+	key      string
+	attempts int
+}
+
+func newAttemptCounter() *attemptCounter {
+	return &attemptCounter{order: list.New(), byKey: map[string]*list.Element{}}
+}
+
+// add counts a failed attempt and returns the number of failed attempts.
+func (c *attemptCounter) add(key string) int {
+	if c == nil {
+		return 0
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	e, ok := c.byKey[key]
+	if !ok {
+		e = c.order.PushBack(&attemptEntry{key: key})
+		c.byKey[key] = e
+		for c.order.Len() > maxTrackedAttempts {
+			front := c.order.Front()
+			c.order.Remove(front)
+			delete(c.byKey, front.Value.(*attemptEntry).key)
+		}
+	}
+	entry := e.Value.(*attemptEntry)
+	entry.attempts++
+	return entry.attempts
+}
+
+// remove forgets the attempts of a message that was handled.
+func (c *attemptCounter) remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if e, ok := c.byKey[key]; ok {
+		c.order.Remove(e)
+		delete(c.byKey, key)
+	}
+}
+
+// deliveryAttempt returns the number of times that a message was delivered
+// according to the messaging provider (including the current delivery) or
+// 0 if the provider does not count deliveries:
+//
+//   - AWS SQS: the ApproximateReceiveCount attribute.
+//   - GCP Pub/Sub: the delivery attempt, which is only counted for
+//     subscriptions with a dead-letter policy.
+//   - NATS JetStream: the number of deliveries to the consumer.
+func deliveryAttempt(msg *pubsub.Message) int {
+	const sqsReceiveCount = string(sqstypesv2.MessageSystemAttributeNameApproximateReceiveCount)
+
+	var sqsV2 sqstypesv2.Message
+	if msg.As(&sqsV2) {
+		n, _ := strconv.Atoi(sqsV2.Attributes[sqsReceiveCount])
+		return n
+	}
+	var sqsV1 *sqsv1.Message
+	if msg.As(&sqsV1) {
+		n, _ := strconv.Atoi(aws.StringValue(sqsV1.Attributes[sqsReceiveCount]))
+		return n
+	}
+	var gcp *pb.ReceivedMessage
+	if msg.As(&gcp) {
+		return int(gcp.GetDeliveryAttempt())
+	}
+	var js jetstream.Msg
+	if msg.As(&js) {
+		if meta, err := js.Metadata(); err == nil {
+			return int(meta.NumDelivered)
+		}
+	}
+	return 0
+}
+
+// nack returns a request message for redelivery after a failed attempt to
+// handle it. Once the message was attempted maxAttempts times, it is
+// published to the dead-letter topic (if configured) or dropped, and
+// acknowledged instead.
+func (m *Messenger) nack(msg *pubsub.Message, cause error) {
+	attempts := max(m.attempts.add(msg.LoggableID), deliveryAttempt(msg))
+	if m.maxAttempts > 0 && attempts >= m.maxAttempts {
+		if m.deadLetter == nil {
+			log.Printf("Dropping message %s after %d attempts: %v", msg.LoggableID, attempts, cause)
+			metrics.MessengerDropped.Add(context.Background(), 1, metric.WithAttributeSet(attribute.NewSet(
+				metrics.AttrMessengerStream.String(m.stream),
+			)))
+			m.attempts.remove(msg.LoggableID)
+			m.ack(msg)
+			return
+		}
+		if err := m.sendDeadLetter(context.Background(), msg, deadLetterReasonMaxAttempts, cause, attempts); err != nil {
+			log.Printf("Error sending message %s to dead-letter topic: %v", msg.LoggableID, err)
+		} else {
+			m.attempts.remove(msg.LoggableID)
+			m.ack(msg)
+			return
+		}
+	}
+	if attempts > 0 {
+		log.Printf("Returning message %s for redelivery after %d failed attempts", msg.LoggableID, attempts)
+	}
+	m.redeliver(msg)
+}
@@ -0,0 +1,71 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+func TestAttemptCounter(t *testing.T) {
+	c := newAttemptCounter()
+	require.Equal(t, 1, c.add("a"))
+	require.Equal(t, 2, c.add("a"))
+	require.Equal(t, 1, c.add("b"))
+	c.remove("a")
+	require.Equal(t, 1, c.add("a"))
+
+	// The messages that were counted first are forgotten first.
+	for i := range maxTrackedAttempts {
+		c.add(fmt.Sprint(i))
+	}
+	require.Equal(t, maxTrackedAttempts, c.order.Len())
+	require.Equal(t, 1, c.add("b"))
+
+	// No-ops when no dead-letter topic is configured.
+	var disabled *attemptCounter
+	require.Equal(t, 0, disabled.add("a"))
+	disabled.remove("a")
+}
+
+func TestNackMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+
+	topic, err := pubsub.OpenTopic(ctx, "mem://max-attempts-test")
+	require.NoError(t, err)
+	defer topic.Shutdown(ctx)
+	sub, err := pubsub.OpenSubscription(ctx, "mem://max-attempts-test")
+	require.NoError(t, err)
+	defer sub.Shutdown(ctx)
+
+	receive := func() (*pubsub.Message, error) {
+		receiveCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		return sub.Receive(receiveCtx)
+	}
+
+	m := &Messenger{
+		stream:      "0",
+		maxAttempts: 3,
+		attempts:    newAttemptCounter(),
+	}
+	require.NoError(t, topic.Send(ctx, &pubsub.Message{Body: []byte(`{}`)}))
+
+	// Redelivered until the third failed attempt.
+	for range 3 {
+		msg, err := receive()
+		require.NoError(t, err)
+		require.Zero(t, deliveryAttempt(msg), "the in-memory provider does not count deliveries")
+		m.nack(msg, errors.New("failed"))
+	}
+
+	// Dropped after the third failed attempt.
+	_, err = receive()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Zero(t, m.attempts.order.Len())
+}
@@ -0,0 +1,140 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+
+	sqsv2 "github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypesv2 "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go/aws"
+	sqsv1 "github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/nats-io/nats.go/jetstream"
+	"gocloud.dev/pubsub"
+)
+
+// backlogFunc returns the number of messages that are waiting to be
+// received from a requests subscription.
+type backlogFunc func(ctx context.Context) (int64, error)
+
+// newBacklogFunc returns a function for reading the backlog of the
+// subscription or nil if the provider is not supported.
+func newBacklogFunc(requestsURL string, sub *pubsub.Subscription) (backlogFunc, error) {
+	u, err := url.Parse(requestsURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing requests url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "awssqs":
+		// Matches the queue URL that is used by the gocloud.dev driver.
+		queueURL := "https://" + path.Join(u.Host, u.Path)
+		var clientV2 *sqsv2.Client
+		if sub.As(&clientV2) {
+			return sqsBacklogV2(clientV2, queueURL), nil
+		}
+		var clientV1 *sqsv1.SQS
+		if sub.As(&clientV1) {
+			return sqsBacklogV1(clientV1, queueURL), nil
+		}
+	case jetStreamScheme:
+		var consumer jetstream.Consumer
+		if sub.As(&consumer) {
+			return jetStreamBacklog(consumer), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func sqsBacklogV2(client *sqsv2.Client, queueURL string) backlogFunc {
+	return func(ctx context.Context) (int64, error) {
+		out, err := client.GetQueueAttributes(ctx, &sqsv2.GetQueueAttributesInput{
+			QueueUrl:       &queueURL,
+			AttributeNames: []sqstypesv2.QueueAttributeName{sqstypesv2.QueueAttributeNameApproximateNumberOfMessages},
+		})
+		if err != nil {
+			return 0, fmt.Errorf("getting queue attributes: %w", err)
+		}
+		return parseSQSMessageCount(out.Attributes[string(sqstypesv2.QueueAttributeNameApproximateNumberOfMessages)])
+	}
+}
+
+func sqsBacklogV1(client *sqsv1.SQS, queueURL string) backlogFunc {
+	return func(ctx context.Context) (int64, error) {
+		out, err := client.GetQueueAttributesWithContext(ctx, &sqsv1.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queueURL),
+			AttributeNames: []*string{aws.String(sqsv1.QueueAttributeNameApproximateNumberOfMessages)},
+		})
+		if err != nil {
+			return 0, fmt.Errorf("getting queue attributes: %w", err)
+		}
+		return parseSQSMessageCount(aws.StringValue(out.Attributes[sqsv1.QueueAttributeNameApproximateNumberOfMessages]))
+	}
+}
+
+func parseSQSMessageCount(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing message count %q: %w", s, err)
+	}
+	return n, nil
+}
+
+// modelMix tracks the models of the most recently received messages.
+// It is used to attribute a subscription's backlog to models.
+type modelMix struct {
+	mtx    sync.Mutex
+	recent []string
+	next   int
+}
+
+func newModelMix(size int) *modelMix {
+	return &modelMix{recent: make([]string, 0, size)}
+}
+
+func (m *modelMix) observe(model string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if len(m.recent) < cap(m.recent) {
+		m.recent = append(m.recent, model)
+		return
+	}
+	m.recent[m.next] = model
+	m.next = (m.next + 1) % len(m.recent)
+}
+
+// split divides n between models in proportion to the number of
+// recently received messages for each model.
+func (m *modelMix) split(n int64) map[string]int64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	counts := map[string]int64{}
+	for _, model := range m.recent {
+		counts[model]++
+	}
+	total := int64(len(m.recent))
+
+	shares := make(map[string]int64, len(counts))
+	for model, count := range counts {
+		// Round up so that small backlogs are not attributed to no model.
+		shares[model] = (n*count + total - 1) / total
+	}
+	return shares
+}
+
+// jetStreamBacklog returns the number of messages that were not yet
+// delivered to the consumer.
+func jetStreamBacklog(consumer jetstream.Consumer) backlogFunc {
+	return func(ctx context.Context) (int64, error) {
+		info, err := consumer.Info(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("getting consumer info: %w", err)
+		}
+		return int64(info.NumPending), nil
+	}
+}
@@ -0,0 +1,42 @@
+package messenger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+func TestModelMix(t *testing.T) {
+	mix := newModelMix(4)
+	require.Empty(t, mix.split(10), "no messages observed")
+
+	mix.observe("a")
+	mix.observe("a")
+	mix.observe("a")
+	mix.observe("b")
+	require.Equal(t, map[string]int64{"a": 8, "b": 3}, mix.split(10), "shares should be rounded up")
+	require.Equal(t, map[string]int64{"a": 0, "b": 0}, mix.split(0))
+
+	// Oldest observations should be replaced.
+	mix.observe("c")
+	mix.observe("c")
+	require.Equal(t, map[string]int64{"a": 1, "b": 1, "c": 2}, mix.split(4))
+}
+
+func TestNewBacklogFuncUnsupported(t *testing.T) {
+	ctx := context.Background()
+	const url = "mem://backlog-test"
+	topic, err := pubsub.OpenTopic(ctx, url)
+	require.NoError(t, err)
+	t.Cleanup(func() { topic.Shutdown(ctx) })
+	sub, err := pubsub.OpenSubscription(ctx, url)
+	require.NoError(t, err)
+	t.Cleanup(func() { sub.Shutdown(ctx) })
+
+	backlog, err := newBacklogFunc(url, sub)
+	require.NoError(t, err)
+	require.Nil(t, backlog)
+}
@@ -0,0 +1,214 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/substratusai/kubeai/internal/bodycodec"
+	"github.com/substratusai/kubeai/internal/requestindex"
+	"gocloud.dev/pubsub"
+)
+
+const (
+	// batchIndexMetadataKey is added to the metadata of the response to
+	// each item of a batch request message.
+	batchIndexMetadataKey = "batch_index"
+	// messageTypeMetadataKey is set on progress event messages so that they
+	// can be told apart from responses on the same topic.
+	messageTypeMetadataKey   = "message_type"
+	messageTypeBatchProgress = "batch_progress"
+)
+
+// batchProgress is published while the items of a batch request
+// message are handled.
+type batchProgress struct {
+	// Completed is the number of items that a response was published for
+	// (including failed items).
+	Completed int `json:"completed"`
+	// Failed is the number of items with an error response.
+	Failed int  `json:"failed"`
+	Total  int  `json:"total"`
+	Done   bool `json:"done"`
+}
+
+// handleBatch handles the items of a batch request message one at a time.
+// Each item is a request body for the path of the message:
+/*
+	{
+		"metadata": {"batch-id": 123},
+		"path": "/v1/embeddings",
+		"batch": [
+			{"model": "test-model", "input": "first"},
+			{"model": "test-model", "input": "second"}
+		]
+	}
+*/
+// A response is published for each item (with the index of the item in the
+// metadata) and progress events are published periodically and after the
+// last item. The message is acknowledged once all responses were published.
+func (m *Messenger) handleBatch(ctx context.Context, req *request) {
+	log.Printf("Handling batch of %d items for message %s", len(req.batch), req.msg.LoggableID)
+
+	var (
+		progressMtx sync.Mutex
+		progress    = batchProgress{Total: len(req.batch)}
+	)
+	currentProgress := func() batchProgress {
+		progressMtx.Lock()
+		defer progressMtx.Unlock()
+		return progress
+	}
+	m.indexBatch(req, progress)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	if interval := m.batches.ProgressInterval.Duration; interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+				}
+				p := currentProgress()
+				if err := m.publishProgress(req, p); err != nil {
+					log.Printf("Error sending batch progress for message %s: %v", req.msg.LoggableID, err)
+				}
+				m.indexBatch(req, p)
+			}
+		}()
+	}
+	stopProgress := func() {
+		close(stop)
+		wg.Wait()
+	}
+
+	for i, body := range req.batch {
+		item := req.batchItem(i)
+		var (
+			respBody   []byte
+			statusCode int
+		)
+		if err := item.setBody(body); err != nil {
+			respBody, statusCode = m.jsonError("error parsing batch item %d: %v", i, err), http.StatusBadRequest
+		} else {
+			respBody, statusCode = m.infer(ctx, item)
+		}
+
+		if _, err := m.publishResponse(item, respBody, statusCode); err != nil {
+			stopProgress()
+			log.Printf("Error sending response for item %d of message %s: %v", i, req.msg.LoggableID, err)
+			m.addConsecutiveError()
+
+			// If a response cant be sent, the whole batch should be redelivered.
+			m.nack(req.msg, err)
+			return
+		}
+
+		progressMtx.Lock()
+		progress.Completed++
+		if statusCode >= 300 {
+			progress.Failed++
+		}
+		progressMtx.Unlock()
+	}
+
+	stopProgress()
+	final := currentProgress()
+	final.Done = true
+	if err := m.publishProgress(req, final); err != nil {
+		log.Printf("Error sending batch progress for message %s: %v", req.msg.LoggableID, err)
+	}
+	m.indexBatch(req, final)
+
+	log.Printf("Handled batch of %d items (%d failed) for message %s", final.Total, final.Failed, req.msg.LoggableID)
+	if final.Failed == 0 {
+		m.resetConsecutiveErrors()
+	}
+	m.attempts.remove(req.msg.LoggableID)
+	m.ack(req.msg)
+}
+
+// batchItem returns the request for the item of a batch request message
+// at the given index.
+func (r *request) batchItem(i int) *request {
+	metadata := make(map[string]interface{}, len(r.metadata)+1)
+	for k, v := range r.metadata {
+		metadata[k] = v
+	}
+	metadata[batchIndexMetadataKey] = i
+
+	return &request{
+		ctx:          r.ctx,
+		msg:          r.msg,
+		metadata:     metadata,
+		path:         r.path,
+		codec:        r.codec,
+		encoding:     r.encoding,
+		version:      r.version,
+		priority:     r.priority,
+		responses:    r.responses,
+		responsesURL: r.responsesURL,
+	}
+}
+
+// indexBatch records the progress of a batch request message in the
+// request index. Batches with failed items are indexed as failed once done.
+func (m *Messenger) indexBatch(req *request, p batchProgress) {
+	status := requestindex.StatusRunning
+	if p.Done {
+		status = requestindex.StatusSucceeded
+		if p.Failed > 0 {
+			status = requestindex.StatusFailed
+		}
+	}
+	m.indexRequest(req, status, 0, &requestindex.BatchStatus{
+		Total:     p.Total,
+		Completed: p.Completed,
+		Failed:    p.Failed,
+	})
+}
+
+// publishProgress publishes a progress event for a batch request message
+// to the progress topic (the responses topic by default).
+func (m *Messenger) publishProgress(req *request, p batchProgress) error {
+	body, err := json.Marshal(struct {
+		Version       int                    `json:"version,omitempty"`
+		Metadata      map[string]interface{} `json:"metadata"`
+		BatchProgress batchProgress          `json:"batch_progress"`
+	}{
+		Version:       req.version,
+		Metadata:      req.metadata,
+		BatchProgress: p,
+	})
+	if err != nil {
+		return fmt.Errorf("marshalling progress: %w", err)
+	}
+	if req.codec != nil {
+		body, err = bodycodec.FromJSON(req.codec, body)
+		if err != nil {
+			return fmt.Errorf("converting progress to %s: %w", req.codec.MediaType(), err)
+		}
+	}
+
+	md := m.responseMetadata(req)
+	md[messageTypeMetadataKey] = messageTypeBatchProgress
+
+	topic := m.progress
+	if topic == nil {
+		topic = m.responsesTopic(req)
+	}
+	return topic.Send(req.ctx, &pubsub.Message{
+		Body:     body,
+		Metadata: md,
+	})
+}
@@ -0,0 +1,139 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/requestindex"
+	"gocloud.dev/pubsub"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+func TestHandleBatch(t *testing.T) {
+	ctx := context.Background()
+
+	// The first item is blocked until a periodic progress event was received.
+	release := make(chan struct{})
+	var releaseOnce sync.Once
+	releaseFirst := func() { releaseOnce.Do(func() { close(release) }) }
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"result":"ok"}`))
+	}))
+	defer backend.Close()
+	defer releaseFirst()
+
+	openTopic := func(name string) (*pubsub.Topic, *pubsub.Subscription) {
+		topic, err := pubsub.OpenTopic(ctx, "mem://batch-test-"+name)
+		require.NoError(t, err)
+		t.Cleanup(func() { topic.Shutdown(ctx) })
+		sub, err := pubsub.OpenSubscription(ctx, "mem://batch-test-"+name)
+		require.NoError(t, err)
+		t.Cleanup(func() { sub.Shutdown(ctx) })
+		return topic, sub
+	}
+	requestsTopic, requests := openTopic("requests")
+	responsesTopic, responses := openTopic("responses")
+	progressTopic, progress := openTopic("progress")
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	index := &testIndex{}
+	m := &Messenger{
+		modelScaler:  fake,
+		resolver:     fake,
+		HTTPC:        http.DefaultClient,
+		RequestIndex: index,
+		responses:    responsesTopic,
+		progress:     progressTopic,
+		batches:      config.MessageBatches{ProgressInterval: config.Duration{Duration: 60 * time.Millisecond}},
+		modelMix:     newModelMix(10),
+	}
+
+	require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{Body: []byte(`{
+	"metadata": {"batch-id": "abc"},
+	"path": "/v1/embeddings",
+	"batch": [
+		{"model": "test-model", "input": "first"},
+		{"model": "does-not-exist", "input": "second"},
+		{"model": "test-model", "input": "third"}
+	]
+}`)}))
+	msg, err := requests.Receive(ctx)
+	require.NoError(t, err)
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		m.handleRequest(ctx, msg)
+	}()
+
+	// The in-memory topic does not preserve the order of messages, so the
+	// progress events are only checked for the order that they can be
+	// received in.
+	receiveProgress := func() batchProgress {
+		ev, err := progress.Receive(ctx)
+		require.NoError(t, err)
+		ev.Ack()
+		require.Equal(t, "batch_progress", ev.Metadata["message_type"])
+		var body struct {
+			Metadata      map[string]interface{} `json:"metadata"`
+			BatchProgress batchProgress          `json:"batch_progress"`
+		}
+		require.NoError(t, json.Unmarshal(ev.Body, &body))
+		require.Equal(t, map[string]interface{}{"batch-id": "abc"}, body.Metadata)
+		return body.BatchProgress
+	}
+
+	// Only periodic progress events are published while the first item is in progress.
+	require.Equal(t, batchProgress{Total: 3}, receiveProgress())
+	releaseFirst()
+	<-handled
+
+	// One response per item (not necessarily received in order).
+	codes := map[float64]int{}
+	for range 3 {
+		resp, err := responses.Receive(ctx)
+		require.NoError(t, err)
+		resp.Ack()
+		var body struct {
+			Metadata   map[string]interface{} `json:"metadata"`
+			StatusCode int                    `json:"status_code"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body, &body))
+		require.Equal(t, "abc", body.Metadata["batch-id"])
+		codes[body.Metadata["batch_index"].(float64)] = body.StatusCode
+	}
+	require.Equal(t, map[float64]int{0: http.StatusOK, 1: http.StatusNotFound, 2: http.StatusOK}, codes)
+
+	// Periodic progress events and a final event.
+	var events []batchProgress
+	for len(events) == 0 || !events[len(events)-1].Done {
+		events = append(events, receiveProgress())
+	}
+	for _, ev := range events[:len(events)-1] {
+		require.Equal(t, 3, ev.Total)
+		require.Less(t, ev.Completed, 3)
+	}
+	require.Equal(t, batchProgress{Completed: 3, Failed: 1, Total: 3, Done: true}, events[len(events)-1])
+
+	// The batch is indexed when it is received, with each progress event, and once done.
+	require.GreaterOrEqual(t, len(index.records), 3)
+	first, last := index.records[0], index.records[len(index.records)-1]
+	require.Equal(t, requestindex.StatusRunning, first.Status)
+	require.Equal(t, &requestindex.BatchStatus{Total: 3}, first.Batch)
+	require.Equal(t, requestindex.StatusFailed, last.Status)
+	require.Equal(t, &requestindex.BatchStatus{Total: 3, Completed: 3, Failed: 1}, last.Batch)
+	require.Equal(t, map[string]string{"batch-id": "abc"}, last.Metadata)
+}
@@ -0,0 +1,127 @@
+package messenger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/substratusai/kubeai/internal/config"
+)
+
+// contentEncodingMetadataKey is the message metadata key that specifies the
+// compression of request and response messages (uncompressed if not set).
+const contentEncodingMetadataKey = "content-encoding"
+
+// Supported content encodings.
+const (
+	gzipEncoding = "gzip"
+	zstdEncoding = "zstd"
+)
+
+// maxDecompressedBytes limits the size of decompressed request messages.
+const maxDecompressedBytes = 64 << 20
+
+// zstdEncoder returns the encoder of zstd responses, which is safe for
+// concurrent use with EncodeAll().
+var zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+	return zstd.NewWriter(nil)
+})
+
+// decompress decompresses a request message body with the given
+// content encoding.
+func decompress(encoding string, data []byte) ([]byte, error) {
+	var r io.Reader
+	switch encoding {
+	case "", "identity":
+		return data, nil
+	case gzipEncoding:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	case zstdEncoding:
+		// The window (and memory) of the decoder is limited so that a small
+		// message can not make it allocate more than the decompressed size.
+		zr, err := zstd.NewReader(bytes.NewReader(data),
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(maxDecompressedBytes),
+			zstd.WithDecoderMaxMemory(maxDecompressedBytes),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unsupported %s %q", contentEncodingMetadataKey, encoding)
+	}
+
+	decompressed, err := io.ReadAll(io.LimitReader(r, maxDecompressedBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) > maxDecompressedBytes {
+		return nil, fmt.Errorf("decompressed message is larger than %d bytes", maxDecompressedBytes)
+	}
+	return decompressed, nil
+}
+
+func compress(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case gzipEncoding:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case zstdEncoding:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("unsupported %s %q", contentEncodingMetadataKey, encoding)
+}
+
+// messageCompression compresses response messages that are larger than
+// minBytes.
+type messageCompression struct {
+	encoding string
+	minBytes int
+}
+
+func newMessageCompression(cfg *config.MessageCompression) *messageCompression {
+	return &messageCompression{encoding: cfg.Encoding, minBytes: cfg.MinBytes}
+}
+
+// compressResponse compresses the body of a response message (if enabled
+// and the body is large enough) and sets (or removes) the content-encoding
+// metadata. Responses to compressed request messages use the encoding of
+// the request. The body is returned uncompressed if compressing fails.
+func (m *Messenger) compressResponse(req *request, body []byte, md map[string]string) []byte {
+	delete(md, contentEncodingMetadataKey)
+	if m.compression == nil || len(body) < m.compression.minBytes {
+		return body
+	}
+	encoding := m.compression.encoding
+	if req.encoding != "" {
+		encoding = req.encoding
+	}
+	compressed, err := compress(encoding, body)
+	if err != nil {
+		log.Printf("Error compressing response to message %s: %v", req.msg.LoggableID, err)
+		return body
+	}
+	md[contentEncodingMetadataKey] = encoding
+	return compressed
+}
@@ -0,0 +1,107 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+)
+
+func TestCompression(t *testing.T) {
+	data := []byte(strings.Repeat(`{"model":"test-model"}`, 100))
+	for _, encoding := range []string{gzipEncoding, zstdEncoding} {
+		t.Run(encoding, func(t *testing.T) {
+			compressed, err := compress(encoding, data)
+			require.NoError(t, err)
+			require.Less(t, len(compressed), len(data))
+			decompressed, err := decompress(encoding, compressed)
+			require.NoError(t, err)
+			require.Equal(t, data, decompressed)
+		})
+	}
+
+	_, err := decompress("br", data)
+	require.ErrorContains(t, err, `unsupported content-encoding "br"`)
+
+	bomb, err := compress(zstdEncoding, bytes.Repeat([]byte{0}, maxDecompressedBytes+1))
+	require.NoError(t, err)
+	_, err = decompress(zstdEncoding, bomb)
+	require.ErrorContains(t, err, "decompressed message is larger than")
+
+	// A frame that declares a 128MiB window is rejected before the decoder
+	// allocates it.
+	largeWindow := []byte{
+		0x28, 0xb5, 0x2f, 0xfd, // Magic number.
+		0x00,             // Frame header descriptor.
+		17 << 3,          // Window descriptor (window log 27).
+		0x09, 0x00, 0x00, // Last raw block of 1 byte.
+		'x',
+	}
+	_, err = decompress(zstdEncoding, largeWindow)
+	require.ErrorIs(t, err, zstd.ErrWindowSizeExceeded)
+}
+
+func TestCompressedMessages(t *testing.T) {
+	ctx := context.Background()
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://compression-test-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	responses, err := pubsub.OpenSubscription(ctx, "mem://compression-test-responses")
+	require.NoError(t, err)
+	defer responses.Shutdown(ctx)
+
+	m := &Messenger{
+		responses:   responsesTopic,
+		compression: &messageCompression{encoding: gzipEncoding, minBytes: 100},
+	}
+	receive := func() (*pubsub.Message, []byte) {
+		t.Helper()
+		msg, err := responses.Receive(ctx)
+		require.NoError(t, err)
+		msg.Ack()
+		body, err := decompress(msg.Metadata[contentEncodingMetadataKey], msg.Body)
+		require.NoError(t, err)
+		return msg, body
+	}
+
+	body, err := compress(zstdEncoding, []byte(`{"metadata":{"id":"1"},"body":{"model":"test-model"}}`))
+	require.NoError(t, err)
+	req, err := parseRequest(ctx, &pubsub.Message{
+		Body:     body,
+		Metadata: map[string]string{contentEncodingMetadataKey: zstdEncoding},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "test-model", req.model)
+
+	// Small responses are not compressed.
+	_, err = m.publishResponse(req, []byte(`{}`), http.StatusOK)
+	require.NoError(t, err)
+	msg, _ := receive()
+	require.NotContains(t, msg.Metadata, contentEncodingMetadataKey)
+
+	// Large responses use the compression of the request.
+	large := []byte(`{"text":"` + strings.Repeat("a", 1000) + `"}`)
+	_, err = m.publishResponse(req, large, http.StatusOK)
+	require.NoError(t, err)
+	msg, decompressed := receive()
+	require.Equal(t, zstdEncoding, msg.Metadata[contentEncodingMetadataKey])
+	var response struct {
+		Body json.RawMessage `json:"body"`
+	}
+	require.NoError(t, json.Unmarshal(decompressed, &response))
+	require.JSONEq(t, string(large), string(response.Body))
+
+	// Responses to uncompressed requests use the configured compression.
+	req, err = parseRequest(ctx, &pubsub.Message{Body: []byte(`{"body":{"model":"test-model"}}`)})
+	require.NoError(t, err)
+	_, err = m.publishResponse(req, large, http.StatusOK)
+	require.NoError(t, err)
+	msg, _ = receive()
+	require.Equal(t, gzipEncoding, msg.Metadata[contentEncodingMetadataKey])
+}
@@ -0,0 +1,221 @@
+package messenger
+
+import (
+	"context"
+	"sync"
+
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// concurrencyLimiter limits the number of handlers of requests for the same
+// model (or with the same value of a request metadata key). Requests over
+// the limit wait without using a handler until a handler of a request with
+// the same key finishes.
+type concurrencyLimiter struct {
+	metadataKey string
+	maxHandlers int
+	overrides   map[string]int
+	// waitSlots has an element for each request that can wait
+	// before no more requests are admitted.
+	waitSlots chan struct{}
+
+	mtx     sync.Mutex
+	active  map[string]int
+	waiting map[string][]queuedRequest
+}
+
+func newConcurrencyLimiter(cfg *config.MessageConcurrencyLimits) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		metadataKey: cfg.MetadataKey,
+		maxHandlers: cfg.MaxHandlers,
+		overrides:   cfg.Overrides,
+		waitSlots:   make(chan struct{}, cfg.MaxWaiting),
+		active:      map[string]int{},
+		waiting:     map[string][]queuedRequest{},
+	}
+	for range cfg.MaxWaiting {
+		l.waitSlots <- struct{}{}
+	}
+	return l
+}
+
+// key returns the key that a request is limited by or an empty string
+// if the request is not limited (i.e. batch requests are not limited by
+// model).
+func (l *concurrencyLimiter) key(req *request) string {
+	if l.metadataKey == "" {
+		return req.model
+	}
+	v, _ := requestMetadata(req, l.metadataKey)
+	s, _ := v.(string)
+	return s
+}
+
+func (l *concurrencyLimiter) limit(key string) int {
+	if n, ok := l.overrides[key]; ok {
+		return n
+	}
+	return l.maxHandlers
+}
+
+// admit returns true if the request can be handled. Otherwise the request
+// waits until it is returned by release(). It blocks while the request has
+// to wait and the maximum number of requests are waiting.
+func (l *concurrencyLimiter) admit(ctx context.Context, qr queuedRequest) (bool, error) {
+	key := l.key(qr.req)
+	if key == "" {
+		return true, nil
+	}
+
+	if l.tryAcquire(key) {
+		return true, nil
+	}
+
+	select {
+	case <-l.waitSlots:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	// A handler may have finished while waiting for a slot.
+	if l.active[key] < l.limit(key) {
+		l.active[key]++
+		l.waitSlots <- struct{}{}
+		return true, nil
+	}
+	l.waiting[key] = append(l.waiting[key], qr)
+	return false, nil
+}
+
+func (l *concurrencyLimiter) tryAcquire(key string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.active[key] < l.limit(key) {
+		l.active[key]++
+		return true
+	}
+	return false
+}
+
+// release is called when the handler of a request that was admitted
+// finishes. It returns the next waiting request with the same key, which
+// takes the place of the finished request.
+func (l *concurrencyLimiter) release(req *request) (queuedRequest, bool) {
+	key := l.key(req)
+	if key == "" {
+		return queuedRequest{}, false
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if waiting := l.waiting[key]; len(waiting) > 0 {
+		next := waiting[0]
+		if len(waiting) == 1 {
+			delete(l.waiting, key)
+		} else {
+			l.waiting[key] = waiting[1:]
+		}
+		l.waitSlots <- struct{}{}
+		return next, true
+	}
+	if l.active[key]--; l.active[key] == 0 {
+		delete(l.active, key)
+	}
+	return queuedRequest{}, false
+}
+
+// drain removes all waiting requests.
+func (l *concurrencyLimiter) drain() []queuedRequest {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	var drained []queuedRequest
+	for key, waiting := range l.waiting {
+		drained = append(drained, waiting...)
+		delete(l.waiting, key)
+	}
+	return drained
+}
+
+// submit starts handling a parsed request message unless the concurrency
+// limit of its model (or metadata value) was reached. It blocks while no
+// handler is available (or while the priority queue is full).
+func (m *Messenger) submit(ctx context.Context, sem *handlerSemaphore, qr queuedRequest) error {
+	if m.limiter != nil && qr.err == nil {
+		admitted, err := m.limiter.admit(ctx, qr)
+		if err != nil {
+			return err
+		}
+		if !admitted {
+			metrics.MessengerConcurrencyLimited.Add(ctx, 1, metric.WithAttributeSet(attribute.NewSet(
+				metrics.AttrMessengerStream.String(m.stream),
+			)))
+			// Started by handle() when a handler of the same key finishes.
+			return nil
+		}
+	}
+	if m.priorities != nil {
+		// Started by dispatch() in the order of priority.
+		return m.enqueue(ctx, qr)
+	}
+	if err := sem.acquire(ctx); err != nil {
+		return err
+	}
+	go m.handle(ctx, sem, qr)
+	return nil
+}
+
+// handle handles a request that acquired the semaphore and then starts
+// the next request that was waiting for the same concurrency limit.
+func (m *Messenger) handle(ctx context.Context, sem *handlerSemaphore, qr queuedRequest) {
+	for {
+		func() {
+			defer sem.release()
+			defer qr.done()
+			m.handleParsedRequest(context.Background(), qr.req, qr.err)
+		}()
+
+		if m.limiter == nil || qr.err != nil {
+			return
+		}
+		next, ok := m.limiter.release(qr.req)
+		if !ok {
+			return
+		}
+		if ctx.Err() != nil {
+			// The messenger is shutting down.
+			m.redeliverQueued(next)
+			return
+		}
+		if m.priorities != nil {
+			if err := m.enqueue(ctx, next); err != nil {
+				m.redeliverQueued(next)
+			}
+			return
+		}
+		if err := sem.acquire(ctx); err != nil {
+			m.redeliverQueued(next)
+			return
+		}
+		qr = next
+	}
+}
+
+// nackWaiting returns requests that are still waiting for their
+// concurrency limit to the messaging system, so that they are redelivered.
+func (m *Messenger) nackWaiting() {
+	for _, qr := range m.limiter.drain() {
+		m.redeliverQueued(qr)
+	}
+}
+
+// redeliverQueued stops the keepalive of a request that was not handled
+// and returns its message to the messaging system.
+func (m *Messenger) redeliverQueued(qr queuedRequest) {
+	qr.done()
+	m.redeliver(qr.req.msg)
+}
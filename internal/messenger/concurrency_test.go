@@ -0,0 +1,172 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/pubsub"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := newConcurrencyLimiter(&config.MessageConcurrencyLimits{
+		MaxHandlers: 2,
+		Overrides:   map[string]int{"small": 1},
+		MaxWaiting:  2,
+	})
+	qr := func(model string) queuedRequest {
+		return queuedRequest{req: &request{model: model}}
+	}
+	admit := func(model string) bool {
+		t.Helper()
+		ok, err := l.admit(ctx, qr(model))
+		require.NoError(t, err)
+		return ok
+	}
+
+	require.True(t, admit("small"))
+	require.False(t, admit("small"))
+	require.True(t, admit("big"))
+	require.True(t, admit("big"))
+	require.False(t, admit("big"))
+	// Batch requests are not limited.
+	require.True(t, admit(""))
+
+	// The maximum number of requests are waiting.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := l.admit(timeoutCtx, qr("big"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Finished requests are replaced by waiting requests with the same key.
+	next, ok := l.release(qr("small").req)
+	require.True(t, ok)
+	require.Equal(t, "small", next.req.model)
+	_, ok = l.release(qr("small").req)
+	require.False(t, ok)
+	require.True(t, admit("small"))
+
+	drained := l.drain()
+	require.Len(t, drained, 1)
+	require.Equal(t, "big", drained[0].req.model)
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Requests for the slow model block until they are unblocked.
+	unblock := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer backend.Close()
+
+	requestsTopic, err := pubsub.OpenTopic(ctx, "mem://concurrency-test-requests")
+	require.NoError(t, err)
+	defer requestsTopic.Shutdown(ctx)
+	requests, err := pubsub.OpenSubscription(ctx, "mem://concurrency-test-requests")
+	require.NoError(t, err)
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://concurrency-test-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	responses, err := pubsub.OpenSubscription(ctx, "mem://concurrency-test-responses")
+	require.NoError(t, err)
+	defer responses.Shutdown(ctx)
+
+	// Messages are extended while they are handled or wait for a handler.
+	var (
+		extendedMtx sync.Mutex
+		extended    = map[string]int{}
+	)
+	keepalive := func(ctx context.Context, msg *pubsub.Message, timeout time.Duration) error {
+		var body struct {
+			Metadata map[string]string `json:"metadata"`
+		}
+		_ = json.Unmarshal(msg.Body, &body)
+		extendedMtx.Lock()
+		defer extendedMtx.Unlock()
+		extended[body.Metadata["id"]]++
+		return nil
+	}
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		HTTPC:       http.DefaultClient,
+		MaxHandlers: 2,
+		stream:      "0",
+		requests:    requests,
+		responses:   responsesTopic,
+		modelMix:    newModelMix(10),
+		keepalive:   keepalive,
+		transport: config.MessageTransport{
+			Keepalive: &config.MessageKeepalive{
+				Timeout:  config.Duration{Duration: time.Minute},
+				Interval: config.Duration{Duration: 10 * time.Millisecond},
+			},
+		},
+		limiter: newConcurrencyLimiter(&config.MessageConcurrencyLimits{
+			MaxHandlers: 1,
+			MaxWaiting:  2,
+		}),
+	}
+	started := make(chan error)
+	go func() { started <- m.Start(ctx) }()
+
+	send := func(id, model string) {
+		t.Helper()
+		require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{
+			Body: []byte(`{"metadata":{"id":"` + id + `"},"body":{"model":"` + model + `"}}`),
+		}))
+	}
+	receive := func() string {
+		t.Helper()
+		receiveCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		resp, err := responses.Receive(receiveCtx)
+		require.NoError(t, err)
+		resp.Ack()
+		var body struct {
+			Metadata map[string]string `json:"metadata"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body, &body))
+		return body.Metadata["id"]
+	}
+
+	// Without the limit, the requests for the slow model would use both
+	// handlers and block the request for the other model.
+	send("slow-1", "test-model")
+	send("slow-2", "test-model")
+	send("slow-3", "test-model")
+	send("other", "other-model")
+	require.Equal(t, "other", receive())
+	// slow-2 and slow-3 wait for the handler of slow-1.
+	require.Eventually(t, func() bool {
+		extendedMtx.Lock()
+		defer extendedMtx.Unlock()
+		// The first extension applies the timeout on receipt.
+		return extended["slow-2"] > 1 && extended["slow-3"] > 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(unblock)
+	var ids []string
+	for range 3 {
+		ids = append(ids, receive())
+	}
+	require.ElementsMatch(t, []string{"slow-1", "slow-2", "slow-3"}, ids)
+
+	cancel()
+	require.ErrorIs(t, <-started, context.Canceled)
+}
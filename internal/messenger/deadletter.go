@@ -0,0 +1,66 @@
+package messenger
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"gocloud.dev/pubsub"
+)
+
+// Reasons that request messages are published to the dead-letter topic.
+const (
+	deadLetterReasonParseError  = "parse_error"
+	deadLetterReasonMaxAttempts = "max_attempts"
+	deadLetterReasonExpired     = "expired"
+)
+
+// Metadata that is added to dead-lettered messages (in addition to the
+// metadata of the request message).
+const (
+	deadLetterReasonMetadataKey   = "dead_letter_reason"
+	deadLetterErrorMetadataKey    = "dead_letter_error"
+	deadLetterAttemptsMetadataKey = "dead_letter_attempts"
+)
+
+// sendDeadLetter publishes a request message (with its original body) to the
+// dead-letter topic along with the reason and error.
+func (m *Messenger) sendDeadLetter(ctx context.Context, msg *pubsub.Message, reason string, cause error, attempts int) error {
+	log.Printf("Sending message %s to dead-letter topic: %s: %v", msg.LoggableID, reason, cause)
+
+	md := make(map[string]string, len(msg.Metadata)+4)
+	for k, v := range msg.Metadata {
+		md[k] = v
+	}
+	md["request_message_id"] = msg.LoggableID
+	md[deadLetterReasonMetadataKey] = reason
+	md[deadLetterErrorMetadataKey] = cause.Error()
+	md[deadLetterAttemptsMetadataKey] = strconv.Itoa(attempts)
+	if err := m.deadLetter.Send(ctx, &pubsub.Message{
+		Body:     msg.Body,
+		Metadata: md,
+	}); err != nil {
+		return err
+	}
+
+	metrics.MessengerDeadLettered.Add(ctx, 1, metric.WithAttributeSet(attribute.NewSet(
+		metrics.AttrMessengerStream.String(m.stream),
+		metrics.AttrDeadLetterReason.String(reason),
+	)))
+	return nil
+}
+
+// deadLetterUnparsable publishes a request message that could not be parsed
+// to the dead-letter topic instead of publishing an error response.
+func (m *Messenger) deadLetterUnparsable(msg *pubsub.Message, cause error) {
+	m.addConsecutiveError()
+	if err := m.sendDeadLetter(context.Background(), msg, deadLetterReasonParseError, cause, 1); err != nil {
+		log.Printf("Error sending message %s to dead-letter topic: %v", msg.LoggableID, err)
+		m.redeliver(msg)
+		return
+	}
+	m.ack(msg)
+}
@@ -0,0 +1,98 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+func TestDeadLetter(t *testing.T) {
+	ctx := context.Background()
+
+	openTopic := func(name string) (*pubsub.Topic, *pubsub.Subscription) {
+		topic, err := pubsub.OpenTopic(ctx, "mem://dead-letter-test-"+name)
+		require.NoError(t, err)
+		t.Cleanup(func() { topic.Shutdown(ctx) })
+		sub, err := pubsub.OpenSubscription(ctx, "mem://dead-letter-test-"+name)
+		require.NoError(t, err)
+		t.Cleanup(func() { sub.Shutdown(ctx) })
+		return topic, sub
+	}
+	requestsTopic, requests := openTopic("requests")
+	responsesTopic, responses := openTopic("responses")
+	deadLetterTopic, deadLetters := openTopic("dead-letters")
+
+	m := &Messenger{
+		stream:      "0",
+		responses:   responsesTopic,
+		deadLetter:  deadLetterTopic,
+		maxAttempts: 2,
+		attempts:    newAttemptCounter(),
+		modelMix:    newModelMix(10),
+	}
+
+	receive := func(sub *pubsub.Subscription) (*pubsub.Message, error) {
+		receiveCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		return sub.Receive(receiveCtx)
+	}
+
+	t.Run("parse error", func(t *testing.T) {
+		require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{
+			Body:     []byte(`not json`),
+			Metadata: map[string]string{"origin": "test"},
+		}))
+		msg, err := receive(requests)
+		require.NoError(t, err)
+		m.handleRequest(ctx, msg)
+
+		dl, err := receive(deadLetters)
+		require.NoError(t, err)
+		dl.Ack()
+		require.Equal(t, "not json", string(dl.Body))
+		require.Equal(t, "test", dl.Metadata["origin"])
+		require.Equal(t, msg.LoggableID, dl.Metadata["request_message_id"])
+		require.Equal(t, deadLetterReasonParseError, dl.Metadata[deadLetterReasonMetadataKey])
+		require.Contains(t, dl.Metadata[deadLetterErrorMetadataKey], "invalid character")
+		require.Equal(t, "1", dl.Metadata[deadLetterAttemptsMetadataKey])
+
+		// No error response is published.
+		_, err = receive(responses)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{Body: []byte(`{}`)}))
+
+		// The first failed attempt is redelivered.
+		msg, err := receive(requests)
+		require.NoError(t, err)
+		m.nack(msg, errors.New("first"))
+		_, err = receive(deadLetters)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// The second failed attempt is dead-lettered.
+		redelivered, err := receive(requests)
+		require.NoError(t, err)
+		require.Equal(t, msg.LoggableID, redelivered.LoggableID)
+		m.nack(redelivered, errors.New("second"))
+
+		dl, err := receive(deadLetters)
+		require.NoError(t, err)
+		dl.Ack()
+		require.Equal(t, "{}", string(dl.Body))
+		require.Equal(t, deadLetterReasonMaxAttempts, dl.Metadata[deadLetterReasonMetadataKey])
+		require.Equal(t, "second", dl.Metadata[deadLetterErrorMetadataKey])
+		require.Equal(t, "2", dl.Metadata[deadLetterAttemptsMetadataKey])
+		require.Zero(t, m.attempts.order.Len())
+
+		// The dead-lettered message is not redelivered.
+		_, err = receive(requests)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,220 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// embeddingCoalescer coalesces embeddings requests for the same model (with
+// the same parameters) into batches that are sent to a model server in one
+// request. A batch is sent when it has maxBatchSize inputs or maxLatency
+// after its first request was added.
+type embeddingCoalescer struct {
+	maxBatchSize int
+	maxLatency   time.Duration
+
+	mtx sync.Mutex
+	// pending are the batches that were not sent yet by key
+	// (see embeddingKey()).
+	pending map[string]*embeddingBatch
+}
+
+func newEmbeddingCoalescer(cfg *config.MessageEmbeddingCoalescing) *embeddingCoalescer {
+	return &embeddingCoalescer{
+		maxBatchSize: cfg.MaxBatchSize,
+		maxLatency:   cfg.MaxLatency.Duration,
+		pending:      map[string]*embeddingBatch{},
+	}
+}
+
+type embeddingBatch struct {
+	key    string
+	reqs   []*coalescedEmbedding
+	inputs int
+	timer  *time.Timer
+}
+
+// coalescedEmbedding is a request in a batch. The response to the request
+// is sent to done.
+type coalescedEmbedding struct {
+	req    *request
+	inputs []any
+	done   chan inferResult
+}
+
+type inferResult struct {
+	body       []byte
+	statusCode int
+}
+
+// add adds a request to the pending batch of its key. The send function is
+// called (in a new goroutine) with each batch that is ready to be sent.
+func (c *embeddingCoalescer) add(key string, e *coalescedEmbedding, send func(*embeddingBatch)) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	b, ok := c.pending[key]
+	if ok && b.inputs+len(e.inputs) > c.maxBatchSize {
+		// The request does not fit into the pending batch.
+		c.take(b)
+		go send(b)
+		ok = false
+	}
+	if !ok {
+		b = &embeddingBatch{key: key}
+		b.timer = time.AfterFunc(c.maxLatency, func() {
+			c.mtx.Lock()
+			defer c.mtx.Unlock()
+			if c.take(b) {
+				go send(b)
+			}
+		})
+		c.pending[key] = b
+	}
+	b.reqs = append(b.reqs, e)
+	b.inputs += len(e.inputs)
+	if b.inputs >= c.maxBatchSize {
+		c.take(b)
+		go send(b)
+	}
+}
+
+// take removes a pending batch. It returns false if the batch was
+// already removed. Must be called with the lock held.
+func (c *embeddingCoalescer) take(b *embeddingBatch) bool {
+	if c.pending[b.key] != b {
+		return false
+	}
+	delete(c.pending, b.key)
+	b.timer.Stop()
+	return true
+}
+
+// inferCoalesced is like infer() but coalesces embeddings requests with
+// other requests if embedding coalescing is enabled.
+func (m *Messenger) inferCoalesced(ctx context.Context, req *request) ([]byte, int) {
+	if m.embeddings == nil || req.stream || req.path != apiutils.EmbeddingsPath {
+		return m.infer(ctx, req)
+	}
+	// Admission policies apply to each request and not to the batch.
+	if body, code, ok := m.resolveModel(ctx, req); !ok {
+		return body, code
+	}
+	if body, code, ok := m.admit(ctx, req); !ok {
+		return body, code
+	}
+	req.admitted = true
+
+	inputs, ok := apiutils.EmbeddingInputs(req.params)
+	if !ok {
+		return m.infer(ctx, req)
+	}
+	e := &coalescedEmbedding{req: req, inputs: inputs, done: make(chan inferResult, 1)}
+	m.embeddings.add(m.embeddingKey(req), e, m.sendEmbeddingBatch)
+	res := <-e.done
+	return res.body, res.statusCode
+}
+
+// embeddingKey returns the key of the requests that a request can be
+// coalesced with: requests for the same model with the same parameters
+// (except the input) and forwarded metadata.
+func (m *Messenger) embeddingKey(req *request) string {
+	params := maps.Clone(req.params)
+	delete(params, "input")
+	// Map keys are sorted when encoded.
+	paramsKey, _ := json.Marshal(params)
+	header := http.Header{}
+	m.forwardMetadata(header, req)
+	headerKey, _ := json.Marshal(header)
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s", req.model, req.adapter, paramsKey, headerKey)
+}
+
+// sendEmbeddingBatch sends the inputs of a batch to a model server and
+// sends the part of the response of each request to the request.
+func (m *Messenger) sendEmbeddingBatch(b *embeddingBatch) {
+	// Continues the trace of the first request.
+	ctx := b.reqs[0].req.ctx
+	metrics.MessengerCoalescedEmbeddings.Record(ctx, int64(len(b.reqs)), metric.WithAttributeSet(attribute.NewSet(
+		metrics.AttrMessengerStream.String(m.stream),
+	)))
+
+	if len(b.reqs) == 1 {
+		e := b.reqs[0]
+		body, code := m.infer(ctx, e.req)
+		e.done <- inferResult{body: body, statusCode: code}
+		return
+	}
+
+	first := b.reqs[0].req
+	counts := make([]int, len(b.reqs))
+	var inputs []any
+	for i, e := range b.reqs {
+		inputs = append(inputs, e.inputs...)
+		counts[i] = len(e.inputs)
+	}
+	params := maps.Clone(first.params)
+	params["input"] = inputs
+	body, err := json.Marshal(params)
+	if err != nil {
+		m.sendEmbeddingResults(b, nil, inferResult{
+			body:       m.jsonError("error encoding coalesced request: %v", err),
+			statusCode: http.StatusInternalServerError,
+		})
+		return
+	}
+	batchReq := &request{
+		ctx:            first.ctx,
+		msg:            first.msg,
+		metadata:       first.metadata,
+		path:           first.path,
+		body:           body,
+		params:         params,
+		requestedModel: first.requestedModel,
+		model:          first.model,
+		adapter:        first.adapter,
+		priority:       first.priority,
+		admitted:       true,
+	}
+
+	respBody, code := m.infer(ctx, batchReq)
+	for i, e := range b.reqs {
+		e.req.gpuSeconds = batchReq.gpuSeconds * float64(counts[i]) / float64(len(inputs))
+	}
+	if code < 200 || code >= 300 {
+		// Every request gets the error response.
+		m.sendEmbeddingResults(b, nil, inferResult{body: respBody, statusCode: code})
+		return
+	}
+	bodies, err := apiutils.SplitEmbeddingResponse(respBody, counts)
+	if err != nil {
+		m.sendEmbeddingResults(b, nil, inferResult{
+			body:       m.jsonError("error splitting coalesced response: %v", err),
+			statusCode: http.StatusBadGateway,
+		})
+		return
+	}
+	m.sendEmbeddingResults(b, bodies, inferResult{statusCode: code})
+}
+
+// sendEmbeddingResults sends the response bodies to the requests of a
+// batch (or res.body to all requests if bodies is nil).
+func (m *Messenger) sendEmbeddingResults(b *embeddingBatch, bodies [][]byte, res inferResult) {
+	for i, e := range b.reqs {
+		r := res
+		if bodies != nil {
+			r.body = bodies[i]
+		}
+		e.done <- r
+	}
+}
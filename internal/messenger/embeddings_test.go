@@ -0,0 +1,100 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/pubsub"
+)
+
+func TestEmbeddingCoalescing(t *testing.T) {
+	ctx := context.Background()
+
+	// The backend returns embeddings of the length of each input
+	// in reverse order.
+	var backendRequests atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendRequests.Add(1)
+		var req struct {
+			Input json.RawMessage `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		var input []string
+		if json.Unmarshal(req.Input, &input) != nil {
+			input = make([]string, 1)
+			require.NoError(t, json.Unmarshal(req.Input, &input[0]))
+		}
+		var data []string
+		for i := len(input) - 1; i >= 0; i-- {
+			data = append(data, fmt.Sprintf(`{"object":"embedding","index":%d,"embedding":[%d]}`, i, len(input[i])))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"object":"list","model":"test-model","data":[%s],"usage":{"prompt_tokens":%d,"total_tokens":%d}}`,
+			strings.Join(data, ","), 10*len(input), 10*len(input))
+	}))
+	defer backend.Close()
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		HTTPC:       http.DefaultClient,
+		modelMix:    newModelMix(10),
+		embeddings: newEmbeddingCoalescer(&config.MessageEmbeddingCoalescing{
+			MaxBatchSize: 4,
+			MaxLatency:   config.Duration{Duration: time.Minute},
+		}),
+	}
+
+	// The batch is sent once it has 4 inputs.
+	inputs := []string{`"a"`, `["bb","ccc"]`, `"dddd"`}
+	bodies := make([]string, len(inputs))
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := parseRequest(ctx, &pubsub.Message{
+				Body: []byte(`{"path":"/v1/embeddings","body":{"model":"test-model","input":` + input + `}}`),
+			})
+			require.NoError(t, err)
+			body, code := m.inferCoalesced(ctx, req)
+			require.Equal(t, http.StatusOK, code)
+			bodies[i] = string(body)
+		}()
+	}
+	wg.Wait()
+
+	require.EqualValues(t, 1, backendRequests.Load())
+	require.JSONEq(t, `{"object":"list","model":"test-model","data":[{"object":"embedding","index":0,"embedding":[1]}],"usage":{"prompt_tokens":10,"total_tokens":10}}`, bodies[0])
+	require.JSONEq(t, `{"object":"list","model":"test-model","data":[{"object":"embedding","index":0,"embedding":[2]},{"object":"embedding","index":1,"embedding":[3]}],"usage":{"prompt_tokens":20,"total_tokens":20}}`, bodies[1])
+	require.JSONEq(t, `{"object":"list","model":"test-model","data":[{"object":"embedding","index":0,"embedding":[4]}],"usage":{"prompt_tokens":10,"total_tokens":10}}`, bodies[2])
+
+	// Requests with different parameters are not coalesced and a batch
+	// is sent after the maximum latency.
+	m.embeddings.maxLatency = 10 * time.Millisecond
+	for _, dims := range []string{"1", "2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := parseRequest(ctx, &pubsub.Message{
+				Body: []byte(`{"path":"/v1/embeddings","body":{"model":"test-model","input":"a","dimensions":` + dims + `}}`),
+			})
+			require.NoError(t, err)
+			_, code := m.inferCoalesced(ctx, req)
+			require.Equal(t, http.StatusOK, code)
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 3, backendRequests.Load())
+}
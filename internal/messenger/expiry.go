@@ -0,0 +1,165 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	pb "cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"github.com/IBM/sarama"
+	sqstypesv2 "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go/aws"
+	sqsv1 "github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"gocloud.dev/pubsub"
+)
+
+// Request metadata keys that limit how long a request message is worth
+// handling. They are read from the "metadata" field of the request message
+// or else from the message metadata (attributes/headers).
+const (
+	// expiresAtMetadataKey is an RFC 3339 timestamp or a Unix timestamp in seconds.
+	expiresAtMetadataKey = "expires_at"
+	// maxAgeMetadataKey is a number of seconds or a duration (i.e. "10m")
+	// after the message was published (see publishTime()).
+	maxAgeMetadataKey = "max_age"
+)
+
+// requestExpiry returns the time that a request expires at (the earlier
+// of expires_at and max_age) or the zero time if it does not expire.
+func requestExpiry(req *request) (time.Time, error) {
+	var expiry time.Time
+
+	if v, ok := requestMetadata(req, expiresAtMetadataKey); ok {
+		t, err := parseExpiresAt(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %q metadata: %w", expiresAtMetadataKey, err)
+		}
+		expiry = t
+	}
+
+	if v, ok := requestMetadata(req, maxAgeMetadataKey); ok {
+		maxAge, err := parseMaxAge(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %q metadata: %w", maxAgeMetadataKey, err)
+		}
+		published, ok := publishTime(req.msg)
+		if !ok {
+			log.Printf("Ignoring %q metadata of message %s: the publish time of the message is unknown", maxAgeMetadataKey, req.msg.LoggableID)
+		} else if t := published.Add(maxAge); expiry.IsZero() || t.Before(expiry) {
+			expiry = t
+		}
+	}
+
+	return expiry, nil
+}
+
+func requestMetadata(req *request, key string) (any, bool) {
+	if v, ok := req.metadata[key]; ok {
+		return v, true
+	}
+	v, ok := req.msg.Metadata[key]
+	return v, ok
+}
+
+func parseExpiresAt(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))), nil
+	case string:
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Unix(0, int64(secs*float64(time.Second))), nil
+		}
+		return time.Parse(time.RFC3339, v)
+	}
+	return time.Time{}, fmt.Errorf("expected a timestamp, got %v", v)
+}
+
+func parseMaxAge(v any) (time.Duration, error) {
+	var d time.Duration
+	switch v := v.(type) {
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	case string:
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			d = time.Duration(secs * float64(time.Second))
+		} else if d, err = time.ParseDuration(v); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("expected a duration, got %v", v)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// publishTime returns the time that a message was published according to
+// the messaging provider, if it is known:
+//
+//   - AWS SQS: the SentTimestamp attribute.
+//   - GCP Pub/Sub: the publish time.
+//   - Kafka: the timestamp of the message.
+//   - NATS JetStream: the time the message was stored in the stream.
+func publishTime(msg *pubsub.Message) (time.Time, bool) {
+	const sqsSentTimestamp = string(sqstypesv2.MessageSystemAttributeNameSentTimestamp)
+	millis := func(s string) (time.Time, bool) {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		return time.UnixMilli(ms), err == nil
+	}
+
+	var sqsV2 sqstypesv2.Message
+	if msg.As(&sqsV2) {
+		return millis(sqsV2.Attributes[sqsSentTimestamp])
+	}
+	var sqsV1 *sqsv1.Message
+	if msg.As(&sqsV1) {
+		return millis(aws.StringValue(sqsV1.Attributes[sqsSentTimestamp]))
+	}
+	var gcp *pb.ReceivedMessage
+	if msg.As(&gcp) {
+		if t := gcp.GetMessage().GetPublishTime(); t != nil {
+			return t.AsTime(), true
+		}
+	}
+	var kafka *sarama.ConsumerMessage
+	if msg.As(&kafka) && !kafka.Timestamp.IsZero() {
+		return kafka.Timestamp, true
+	}
+	var js jetstream.Msg
+	if msg.As(&js) {
+		if meta, err := js.Metadata(); err == nil {
+			return meta.Timestamp, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// skipExpired skips a request message that expired before it was handled:
+// it is published to the dead-letter topic (if configured) or answered
+// with an error response, without being sent to a model server.
+func (m *Messenger) skipExpired(req *request, expiry time.Time) {
+	log.Printf("Skipping message %s: expired at %v", req.msg.LoggableID, expiry)
+	metrics.MessengerExpired.Add(context.Background(), 1, metric.WithAttributeSet(attribute.NewSet(
+		metrics.AttrMessengerStream.String(m.stream),
+	)))
+
+	cause := fmt.Errorf("request expired at %s", expiry.UTC().Format(time.RFC3339))
+	if m.deadLetter != nil {
+		if err := m.sendDeadLetter(context.Background(), req.msg, deadLetterReasonExpired, cause, 0); err != nil {
+			log.Printf("Error sending message %s to dead-letter topic: %v", req.msg.LoggableID, err)
+			m.redeliver(req.msg)
+			return
+		}
+		m.ack(req.msg)
+		return
+	}
+	m.sendResponse(req, m.jsonError("%v", cause), http.StatusRequestTimeout)
+}
@@ -0,0 +1,157 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+)
+
+func TestRequestExpiry(t *testing.T) {
+	published := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		metadata    map[string]any
+		msgMetadata map[string]string
+		// published is the Kafka timestamp of the message (unknown if zero).
+		published time.Time
+		exp       time.Time
+		expErr    string
+	}{
+		"no expiry": {},
+		"expires_at rfc3339": {
+			metadata: map[string]any{"expires_at": "2024-01-01T00:10:00Z"},
+			exp:      published.Add(10 * time.Minute),
+		},
+		"expires_at unix seconds": {
+			metadata: map[string]any{"expires_at": float64(published.Unix() + 60)},
+			exp:      published.Add(time.Minute),
+		},
+		"expires_at message metadata": {
+			msgMetadata: map[string]string{"expires_at": "2024-01-01T00:10:00Z"},
+			exp:         published.Add(10 * time.Minute),
+		},
+		"max_age seconds": {
+			metadata:  map[string]any{"max_age": 30.0},
+			published: published,
+			exp:       published.Add(30 * time.Second),
+		},
+		"max_age duration": {
+			msgMetadata: map[string]string{"max_age": "10m"},
+			published:   published,
+			exp:         published.Add(10 * time.Minute),
+		},
+		"max_age with unknown publish time": {
+			metadata: map[string]any{"max_age": 30.0},
+		},
+		"earliest expiry": {
+			metadata:  map[string]any{"expires_at": "2024-01-01T00:10:00Z", "max_age": "1m"},
+			published: published,
+			exp:       published.Add(time.Minute),
+		},
+		"invalid expires_at": {
+			metadata: map[string]any{"expires_at": "tomorrow"},
+			expErr:   `invalid "expires_at" metadata`,
+		},
+		"invalid max_age": {
+			metadata: map[string]any{"max_age": -1.0},
+			expErr:   `invalid "max_age" metadata`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			msg := kafkaPubsubMessage(t, &sarama.ConsumerMessage{Timestamp: c.published}, c.msgMetadata)
+			expiry, err := requestExpiry(&request{msg: msg, metadata: c.metadata})
+			if c.expErr != "" {
+				require.ErrorContains(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, c.exp.Equal(expiry), "expected %v, got %v", c.exp, expiry)
+		})
+	}
+}
+
+// kafkaPubsubMessage returns a message that is received from the native
+// Kafka driver.
+func kafkaPubsubMessage(t *testing.T, cm *sarama.ConsumerMessage, md map[string]string) *pubsub.Message {
+	s := newKafkaSubscription("", 10)
+	require.NoError(t, s.Setup(&testKafkaSession{ctx: context.Background(), offsets: map[int32]int64{}}))
+	cm.Topic = "requests"
+	for k, v := range md {
+		cm.Headers = append(cm.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	require.True(t, s.offer(context.Background(), cm))
+	sub := pubsub.NewSubscription(s, nil, nil)
+	t.Cleanup(func() { sub.Shutdown(context.Background()) })
+	msg, err := sub.Receive(context.Background())
+	require.NoError(t, err)
+	return msg
+}
+
+func TestSkipExpired(t *testing.T) {
+	ctx := context.Background()
+
+	openTopic := func(name string) (*pubsub.Topic, *pubsub.Subscription) {
+		topic, err := pubsub.OpenTopic(ctx, "mem://expiry-test-"+name)
+		require.NoError(t, err)
+		t.Cleanup(func() { topic.Shutdown(ctx) })
+		sub, err := pubsub.OpenSubscription(ctx, "mem://expiry-test-"+name)
+		require.NoError(t, err)
+		t.Cleanup(func() { sub.Shutdown(ctx) })
+		return topic, sub
+	}
+	requestsTopic, requests := openTopic("requests")
+	responsesTopic, responses := openTopic("responses")
+	deadLetterTopic, deadLetters := openTopic("dead-letters")
+
+	receive := func(sub *pubsub.Subscription) (*pubsub.Message, error) {
+		receiveCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		return sub.Receive(receiveCtx)
+	}
+	const expired = `{"metadata":{"expires_at":"2024-01-01T00:00:00Z"},"body":{"model":"test-model"}}`
+
+	t.Run("error response", func(t *testing.T) {
+		// The model is not looked up.
+		m := &Messenger{stream: "0", responses: responsesTopic, modelMix: newModelMix(10)}
+		require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{Body: []byte(expired)}))
+		msg, err := receive(requests)
+		require.NoError(t, err)
+		m.handleRequest(ctx, msg)
+
+		resp, err := receive(responses)
+		require.NoError(t, err)
+		resp.Ack()
+		var body struct {
+			StatusCode int             `json:"status_code"`
+			Body       json.RawMessage `json:"body"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body, &body))
+		require.Equal(t, http.StatusRequestTimeout, body.StatusCode)
+		require.Contains(t, string(body.Body), "request expired at 2024-01-01T00:00:00Z")
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		m := &Messenger{stream: "0", responses: responsesTopic, deadLetter: deadLetterTopic, modelMix: newModelMix(10)}
+		require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{Body: []byte(expired)}))
+		msg, err := receive(requests)
+		require.NoError(t, err)
+		m.handleRequest(ctx, msg)
+
+		dl, err := receive(deadLetters)
+		require.NoError(t, err)
+		dl.Ack()
+		require.Equal(t, expired, string(dl.Body))
+		require.Equal(t, deadLetterReasonExpired, dl.Metadata[deadLetterReasonMetadataKey])
+
+		// No error response is published.
+		_, err = receive(responses)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
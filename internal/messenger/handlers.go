@@ -0,0 +1,192 @@
+package messenger
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// handlerSemaphore limits the number of active handlers.
+// Unlike a buffered channel, its limit can be changed while it is in use.
+type handlerSemaphore struct {
+	mtx    sync.Mutex
+	limit  int
+	active int
+	// saturated is true if the limit was reached since it was last reset.
+	saturated bool
+	// changed is closed (and replaced) when a handler is released
+	// or the limit is changed.
+	changed chan struct{}
+}
+
+func newHandlerSemaphore(limit int) *handlerSemaphore {
+	return &handlerSemaphore{limit: limit, changed: make(chan struct{})}
+}
+
+// acquire blocks until a handler is available or the context is done.
+func (s *handlerSemaphore) acquire(ctx context.Context) error {
+	for {
+		s.mtx.Lock()
+		if s.active < s.limit {
+			s.active++
+			if s.active == s.limit {
+				s.saturated = true
+			}
+			s.mtx.Unlock()
+			return nil
+		}
+		s.saturated = true
+		changed := s.changed
+		s.mtx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *handlerSemaphore) release() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.active--
+	s.notify()
+}
+
+func (s *handlerSemaphore) activeCount() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.active
+}
+
+// wait blocks until all handlers were released or the context is done.
+func (s *handlerSemaphore) wait(ctx context.Context) error {
+	for {
+		s.mtx.Lock()
+		if s.active == 0 {
+			s.mtx.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.mtx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// setLimit changes the number of handlers. Active handlers are not
+// interrupted if the limit is decreased.
+func (s *handlerSemaphore) setLimit(limit int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.limit = limit
+	s.notify()
+}
+
+// resetSaturated returns the limit and whether it was reached since the
+// last call.
+func (s *handlerSemaphore) resetSaturated() (limit int, saturated bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	saturated = s.saturated || s.active >= s.limit
+	s.saturated = false
+	return s.limit, saturated
+}
+
+// Must be called with the lock held.
+func (s *handlerSemaphore) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// adaptiveHandlers adjusts the number of handlers based on the latency
+// and errors of backend requests: the number is decreased by a quarter
+// after an interval in which the backend was overloaded and increased by
+// one after an interval in which all handlers were in use.
+type adaptiveHandlers struct {
+	cfg config.MessageAdaptiveHandlers
+
+	mtx      sync.Mutex
+	requests int
+	errors   int
+	latency  time.Duration
+}
+
+// observe records the result of a backend request.
+func (a *adaptiveHandlers) observe(latency time.Duration, failed bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.requests++
+	a.latency += latency
+	if failed {
+		a.errors++
+	}
+}
+
+// next returns the number of handlers for the next interval based on the
+// backend requests that were observed since the last call.
+func (a *adaptiveHandlers) next(limit, maxHandlers int, saturated bool) int {
+	a.mtx.Lock()
+	requests, errors, latency := a.requests, a.errors, a.latency
+	a.requests, a.errors, a.latency = 0, 0, 0
+	a.mtx.Unlock()
+
+	if requests > 0 {
+		errorPercent := 100 * float64(errors) / float64(requests)
+		avgLatency := latency / time.Duration(requests)
+		if errorPercent > float64(a.cfg.MaxErrorPercent) || avgLatency > a.cfg.TargetLatency.Duration {
+			return max(a.cfg.MinHandlers, limit*3/4)
+		}
+	}
+	if saturated {
+		return min(maxHandlers, limit+1)
+	}
+	return limit
+}
+
+// adaptHandlers adjusts the number of handlers every interval until the
+// context is done.
+func (m *Messenger) adaptHandlers(ctx context.Context, sem *handlerSemaphore) {
+	ticker := time.NewTicker(m.adaptive.cfg.Interval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		limit, saturated := sem.resetSaturated()
+		if next := m.adaptive.next(limit, m.MaxHandlers, saturated); next != limit {
+			log.Printf("Changing the number of handlers of messaging stream %q from %d to %d", m.stream, limit, next)
+			sem.setLimit(next)
+			m.recordHandlers(ctx, next)
+		}
+	}
+}
+
+// observeBackendRequest records the result of a (non-streamed) backend
+// request for adapting the number of handlers.
+func (m *Messenger) observeBackendRequest(latency time.Duration, statusCode int, err error) {
+	if m.adaptive == nil {
+		return
+	}
+	m.adaptive.observe(latency, err != nil || statusCode >= 500)
+}
+
+func (m *Messenger) recordHandlers(ctx context.Context, limit int) {
+	metrics.MessengerHandlers.Record(ctx, int64(limit), metric.WithAttributeSet(attribute.NewSet(
+		metrics.AttrMessengerStream.String(m.stream),
+	)))
+}
@@ -0,0 +1,78 @@
+package messenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+)
+
+func TestHandlerSemaphore(t *testing.T) {
+	ctx := context.Background()
+	s := newHandlerSemaphore(1)
+
+	require.NoError(t, s.acquire(ctx))
+	_, saturated := s.resetSaturated()
+	require.True(t, saturated)
+
+	acquired := make(chan error)
+	go func() { acquired <- s.acquire(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired more handlers than the limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Increasing the limit unblocks waiting handlers.
+	s.setLimit(2)
+	require.NoError(t, <-acquired)
+
+	// Decreasing the limit does not interrupt active handlers.
+	s.setLimit(1)
+	s.release()
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.acquire(timeoutCtx), context.DeadlineExceeded)
+
+	timeoutCtx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.wait(timeoutCtx), context.DeadlineExceeded)
+
+	waited := make(chan struct{})
+	go func() {
+		require.NoError(t, s.wait(ctx))
+		close(waited)
+	}()
+	s.release()
+	<-waited
+}
+
+func TestAdaptiveHandlers(t *testing.T) {
+	a := &adaptiveHandlers{cfg: config.MessageAdaptiveHandlers{
+		MinHandlers:     2,
+		TargetLatency:   config.Duration{Duration: time.Second},
+		MaxErrorPercent: 10,
+	}}
+
+	// Increased while saturated, up to the maximum.
+	require.Equal(t, 9, a.next(8, 10, true))
+	require.Equal(t, 10, a.next(10, 10, true))
+	// Unchanged while not saturated.
+	a.observe(100*time.Millisecond, false)
+	require.Equal(t, 8, a.next(8, 10, false))
+
+	// Decreased if the latency is above the target.
+	a.observe(500*time.Millisecond, false)
+	a.observe(2*time.Second, false)
+	require.Equal(t, 6, a.next(8, 10, true))
+
+	// Decreased if the error rate is above the maximum, down to the minimum.
+	for i := range 5 {
+		a.observe(100*time.Millisecond, i == 0)
+	}
+	require.Equal(t, 2, a.next(2, 10, true))
+	a.observe(100*time.Millisecond, true)
+	require.Equal(t, 3, a.next(4, 10, true))
+}
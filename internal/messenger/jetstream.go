@@ -0,0 +1,278 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/batcher"
+	"gocloud.dev/pubsub/driver"
+)
+
+// jetStreamScheme is the URL scheme of NATS JetStream topics
+// ("jetstream://<subject>") and subscriptions ("jetstream://<stream>/<consumer>").
+const jetStreamScheme = "jetstream"
+
+func init() {
+	o := &jetStreamURLOpener{}
+	pubsub.DefaultURLMux().RegisterTopic(jetStreamScheme, o)
+	pubsub.DefaultURLMux().RegisterSubscription(jetStreamScheme, o)
+}
+
+var jetStreamConn struct {
+	init sync.Once
+	js   jetstream.JetStream
+	err  error
+}
+
+// jetStreamConnect connects to the NATS server at $NATS_SERVER_URL
+// (like the gocloud.dev natspubsub driver). The connection is shared
+// by all topics and subscriptions.
+func jetStreamConnect() (jetstream.JetStream, error) {
+	jetStreamConn.init.Do(func() {
+		serverURL := os.Getenv("NATS_SERVER_URL")
+		if serverURL == "" {
+			jetStreamConn.err = fmt.Errorf("NATS_SERVER_URL environment variable not set")
+			return
+		}
+		nc, err := nats.Connect(serverURL)
+		if err != nil {
+			jetStreamConn.err = fmt.Errorf("connecting to nats: %w", err)
+			return
+		}
+		jetStreamConn.js, jetStreamConn.err = jetstream.New(nc)
+	})
+	return jetStreamConn.js, jetStreamConn.err
+}
+
+type jetStreamURLOpener struct{}
+
+func (o *jetStreamURLOpener) OpenTopicURL(ctx context.Context, u *url.URL) (*pubsub.Topic, error) {
+	js, err := jetStreamConnect()
+	if err != nil {
+		return nil, err
+	}
+	subject := u.Host + strings.TrimSuffix(u.Path, "/")
+	if subject == "" {
+		return nil, fmt.Errorf("open topic %v: missing subject", u)
+	}
+	return pubsub.NewTopic(&jetStreamTopic{js: js, subject: subject}, nil), nil
+}
+
+func (o *jetStreamURLOpener) OpenSubscriptionURL(ctx context.Context, u *url.URL) (*pubsub.Subscription, error) {
+	return openJetStreamSubscription(ctx, u, config.MessageTransport{})
+}
+
+// openJetStreamSubscription opens a "jetstream://<stream>/<consumer>"
+// subscription that pulls messages from a durable consumer. The consumer
+// is created if it does not exist.
+func openJetStreamSubscription(ctx context.Context, u *url.URL, transport config.MessageTransport) (*pubsub.Subscription, error) {
+	js, err := jetStreamConnect()
+	if err != nil {
+		return nil, err
+	}
+	stream, name := u.Host, strings.Trim(u.Path, "/")
+	if stream == "" || name == "" {
+		return nil, fmt.Errorf("open subscription %v: expected jetstream://<stream>/<consumer>", u)
+	}
+
+	t := transport.NATSJetStream
+	if t == nil {
+		t = &config.NATSJetStreamTransport{}
+	}
+	consumer, err := js.Consumer(ctx, stream, name)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		cfg := jetstream.ConsumerConfig{
+			Durable:       name,
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			FilterSubject: t.FilterSubject,
+			MaxAckPending: t.MaxAckPending,
+		}
+		if k := transport.Keepalive; k != nil {
+			// Keepalives reset the ack wait of the consumer.
+			cfg.AckWait = k.Timeout.Duration
+		}
+		consumer, err = js.CreateConsumer(ctx, stream, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open subscription %v: %w", u, err)
+	}
+
+	batchSize := t.FetchBatchSize
+	if batchSize == 0 {
+		batchSize = 1
+	}
+	return pubsub.NewSubscription(&jetStreamSubscription{consumer: consumer}, &batcher.Options{MaxBatchSize: batchSize, MaxHandlers: 1}, nil), nil
+}
+
+// jetStreamTopic is a gocloud.dev pubsub driver that publishes messages to
+// a JetStream subject, waiting for the stream to acknowledge each message.
+type jetStreamTopic struct {
+	js      jetstream.JetStream
+	subject string
+}
+
+func (t *jetStreamTopic) SendBatch(ctx context.Context, dms []*driver.Message) error {
+	for _, dm := range dms {
+		msg := &nats.Msg{Subject: t.subject, Data: dm.Body, Header: nats.Header{}}
+		for k, v := range dm.Metadata {
+			msg.Header.Set(k, v)
+		}
+		asFunc := func(i interface{}) bool {
+			if p, ok := i.(**nats.Msg); ok {
+				*p = msg
+				return true
+			}
+			return false
+		}
+		if dm.BeforeSend != nil {
+			if err := dm.BeforeSend(asFunc); err != nil {
+				return err
+			}
+		}
+		if _, err := t.js.PublishMsg(ctx, msg); err != nil {
+			return err
+		}
+		if dm.AfterSend != nil {
+			if err := dm.AfterSend(func(interface{}) bool { return false }); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (*jetStreamTopic) IsRetryable(error) bool { return false }
+
+func (t *jetStreamTopic) As(i interface{}) bool {
+	if p, ok := i.(*jetstream.JetStream); ok {
+		*p = t.js
+		return true
+	}
+	return false
+}
+
+func (*jetStreamTopic) ErrorAs(err error, i interface{}) bool { return errors.As(err, i) }
+
+func (*jetStreamTopic) ErrorCode(err error) gcerrors.ErrorCode { return jetStreamErrorCode(err) }
+
+func (*jetStreamTopic) Close() error { return nil }
+
+// jetStreamSubscription is a gocloud.dev pubsub driver that pulls messages
+// from a JetStream consumer. Messages are acknowledged explicitly and nacked
+// messages are redelivered immediately.
+type jetStreamSubscription struct {
+	consumer jetstream.Consumer
+}
+
+func (s *jetStreamSubscription) ReceiveBatch(ctx context.Context, maxMessages int) ([]*driver.Message, error) {
+	batch, err := s.consumer.Fetch(maxMessages, jetstream.FetchMaxWait(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	var dms []*driver.Message
+	for msg := range batch.Messages() {
+		dms = append(dms, jetStreamDriverMessage(msg))
+	}
+	if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+		return dms, err
+	}
+	return dms, nil
+}
+
+func jetStreamDriverMessage(msg jetstream.Msg) *driver.Message {
+	md := map[string]string{}
+	for k := range msg.Headers() {
+		md[k] = msg.Headers().Get(k)
+	}
+	loggableID := msg.Subject()
+	if meta, err := msg.Metadata(); err == nil {
+		loggableID = fmt.Sprintf("%s/%d", meta.Stream, meta.Sequence.Stream)
+	}
+	return &driver.Message{
+		LoggableID: loggableID,
+		Body:       msg.Data(),
+		Metadata:   md,
+		AckID:      msg,
+		AsFunc: func(i interface{}) bool {
+			if p, ok := i.(*jetstream.Msg); ok {
+				*p = msg
+				return true
+			}
+			return false
+		},
+	}
+}
+
+func (s *jetStreamSubscription) SendAcks(ctx context.Context, ids []driver.AckID) error {
+	for _, id := range ids {
+		// Wait for the server to confirm acks so that handled
+		// messages are not redelivered.
+		if err := id.(jetstream.Msg).DoubleAck(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*jetStreamSubscription) CanNack() bool { return true }
+
+func (s *jetStreamSubscription) SendNacks(ctx context.Context, ids []driver.AckID) error {
+	for _, id := range ids {
+		if err := id.(jetstream.Msg).Nak(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (*jetStreamSubscription) IsRetryable(error) bool { return false }
+
+func (s *jetStreamSubscription) As(i interface{}) bool {
+	if p, ok := i.(*jetstream.Consumer); ok {
+		*p = s.consumer
+		return true
+	}
+	return false
+}
+
+func (*jetStreamSubscription) ErrorAs(err error, i interface{}) bool { return errors.As(err, i) }
+
+func (*jetStreamSubscription) ErrorCode(err error) gcerrors.ErrorCode {
+	return jetStreamErrorCode(err)
+}
+
+func (*jetStreamSubscription) Close() error { return nil }
+
+func jetStreamErrorCode(err error) gcerrors.ErrorCode {
+	switch {
+	case errors.Is(err, jetstream.ErrStreamNotFound), errors.Is(err, jetstream.ErrConsumerNotFound),
+		errors.Is(err, jetstream.ErrNoStreamResponse):
+		return gcerrors.NotFound
+	case errors.Is(err, nats.ErrConnectionClosed):
+		return gcerrors.FailedPrecondition
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, nats.ErrTimeout):
+		return gcerrors.DeadlineExceeded
+	}
+	return gcerrors.Unknown
+}
+
+// jetStreamKeepalive resets the ack wait of a message. The ack wait is
+// configured on the consumer, so the timeout is ignored.
+func jetStreamKeepalive(ctx context.Context, msg *pubsub.Message, _ time.Duration) error {
+	var m jetstream.Msg
+	if !msg.As(&m) {
+		return fmt.Errorf("message is not a jetstream message")
+	}
+	return m.InProgress()
+}
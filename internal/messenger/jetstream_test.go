@@ -0,0 +1,88 @@
+package messenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/pubsub"
+)
+
+func TestJetStream(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := server.NewServer(&server.Options{Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	require.NoError(t, err)
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+	require.True(t, srv.ReadyForConnections(5*time.Second))
+	t.Setenv("NATS_SERVER_URL", srv.ClientURL())
+
+	js, err := jetStreamConnect()
+	require.NoError(t, err)
+	// A stream per model.
+	_, err = js.CreateStream(ctx, jetstream.StreamConfig{Name: "REQUESTS_M1", Subjects: []string{"kubeai.requests.m1"}})
+	require.NoError(t, err)
+
+	topic, err := pubsub.OpenTopic(ctx, "jetstream://kubeai.requests.m1")
+	require.NoError(t, err)
+	t.Cleanup(func() { topic.Shutdown(ctx) })
+
+	sub, err := openSubscription(ctx, "jetstream://REQUESTS_M1/kubeai", config.MessageTransport{
+		NATSJetStream: &config.NATSJetStreamTransport{FilterSubject: "kubeai.requests.m1"},
+		Keepalive:     &config.MessageKeepalive{Timeout: config.Duration{Duration: time.Minute}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { sub.Shutdown(ctx) })
+
+	var consumer jetstream.Consumer
+	require.True(t, sub.As(&consumer))
+	info, err := consumer.Info(ctx)
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, info.Config.AckWait, "The keepalive timeout should be the ack wait of created consumers")
+
+	require.NoError(t, topic.Send(ctx, &pubsub.Message{
+		Body:     []byte(`{"model":"m1"}`),
+		Metadata: map[string]string{"origin": "test"},
+	}))
+	backlog, err := newBacklogFunc("jetstream://REQUESTS_M1/kubeai", sub)
+	require.NoError(t, err)
+	require.NotNil(t, backlog)
+	n, err := backlog(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	receive := func() *pubsub.Message {
+		t.Helper()
+		receiveCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		msg, err := sub.Receive(receiveCtx)
+		require.NoError(t, err)
+		return msg
+	}
+
+	msg := receive()
+	require.Equal(t, `{"model":"m1"}`, string(msg.Body))
+	require.Equal(t, "test", msg.Metadata["origin"])
+	require.Equal(t, "REQUESTS_M1/1", msg.LoggableID)
+	require.Equal(t, 1, deliveryAttempt(msg))
+	keepalive, err := newKeepaliveFunc("jetstream://REQUESTS_M1/kubeai", sub)
+	require.NoError(t, err)
+	require.NoError(t, keepalive(ctx, msg, time.Minute))
+
+	// Nacked messages are redelivered.
+	msg.Nack()
+	msg = receive()
+	require.Equal(t, "REQUESTS_M1/1", msg.LoggableID)
+	require.Equal(t, 2, deliveryAttempt(msg))
+	msg.Ack()
+
+	require.Eventually(t, func() bool {
+		info, err := consumer.Info(ctx)
+		return err == nil && info.NumAckPending == 0 && info.NumPending == 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,163 @@
+package messenger
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// responseStore remembers the responses that were published for request
+// messages (by idempotency key) so that duplicate requests can be answered
+// without running inference again.
+type responseStore interface {
+	// get returns the response that was published for the given key.
+	get(key string) ([]byte, bool)
+	// put records the response that was published for the given key.
+	put(key string, response []byte)
+}
+
+// responseJournal remembers the responses that were published for request
+// messages so that redelivered messages (i.e. after an acknowledgement was
+// lost) can be answered without running inference again.
+//
+// NOTE: The journal is kept in memory, so only redeliveries to the same
+// KubeAI instance are deduplicated (see redisResponseStore).
+type responseJournal struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mtx sync.Mutex
+	// entries is ordered from the least to the most recently published response.
+	entries *list.List
+	byKey   map[string]*list.Element
+}
+
+type journalEntry struct {
+	key       string
+	response  []byte
+	expiresAt time.Time
+}
+
+func newResponseJournal(ttl time.Duration, maxEntries int) *responseJournal {
+	return &responseJournal{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    list.New(),
+		byKey:      map[string]*list.Element{},
+	}
+}
+
+// get returns the response that was published for the given key.
+func (j *responseJournal) get(key string) ([]byte, bool) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	j.expire()
+
+	e, ok := j.byKey[key]
+	if !ok {
+		return nil, false
+	}
+	return e.Value.(*journalEntry).response, true
+}
+
+// put records the response that was published for the given key.
+func (j *responseJournal) put(key string, response []byte) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if e, ok := j.byKey[key]; ok {
+		j.entries.Remove(e)
+	}
+	j.byKey[key] = j.entries.PushBack(&journalEntry{
+		key:       key,
+		response:  response,
+		expiresAt: j.now().Add(j.ttl),
+	})
+	for j.entries.Len() > j.maxEntries {
+		j.remove(j.entries.Front())
+	}
+	j.expire()
+}
+
+// expire removes entries that have outlived the TTL.
+// Must be called with the mutex held.
+func (j *responseJournal) expire() {
+	now := j.now()
+	for e := j.entries.Front(); e != nil; e = j.entries.Front() {
+		if e.Value.(*journalEntry).expiresAt.After(now) {
+			return
+		}
+		j.remove(e)
+	}
+}
+
+func (j *responseJournal) remove(e *list.Element) {
+	j.entries.Remove(e)
+	delete(j.byKey, e.Value.(*journalEntry).key)
+}
+
+// redisResponseStore is a responseStore that is shared by all KubeAI
+// instances. Redis errors are logged and treated like missing responses:
+// requests are handled again rather than failed.
+type redisResponseStore struct {
+	client *redis.Client
+	// prefix of the keys of the stream, so that the same idempotency key
+	// of requests of different streams does not collide.
+	prefix  string
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+// newRedisResponseStore returns a store for the responses of a stream on
+// the Redis server at the given URL:
+// "redis://[[username]:password@]host[:port][/db]" ("rediss://" for TLS).
+// The password defaults to $REDIS_PASSWORD.
+func newRedisResponseStore(url, keyPrefix, stream string, ttl, timeout time.Duration) (*redisResponseStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis url: %w", err)
+	}
+	if opts.Password == "" {
+		opts.Password = os.Getenv("REDIS_PASSWORD")
+	}
+	return &redisResponseStore{
+		client:  redis.NewClient(opts),
+		prefix:  keyPrefix + stream + ":",
+		ttl:     ttl,
+		timeout: timeout,
+	}, nil
+}
+
+func (s *redisResponseStore) get(key string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	response, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Error getting response of idempotency key %q from Redis: %v", key, err)
+		}
+		return nil, false
+	}
+	return response, true
+}
+
+func (s *redisResponseStore) put(key string, response []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.client.Set(ctx, s.prefix+key, response, s.ttl).Err(); err != nil {
+		log.Printf("Error storing response of idempotency key %q in Redis: %v", key, err)
+	}
+}
+
+func (s *redisResponseStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,131 @@
+package messenger
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+func TestResponseJournal(t *testing.T) {
+	now := time.Now()
+	j := newResponseJournal(time.Minute, 2)
+	j.now = func() time.Time { return now }
+
+	j.put("a", []byte("response-a"))
+	j.put("b", []byte("response-b"))
+	resp, ok := j.get("a")
+	require.True(t, ok)
+	require.Equal(t, "response-a", string(resp))
+
+	// The least recently published response is forgotten first.
+	j.put("c", []byte("response-c"))
+	_, ok = j.get("a")
+	require.False(t, ok)
+	_, ok = j.get("b")
+	require.True(t, ok)
+
+	// Republishing moves a response to the back.
+	now = now.Add(30 * time.Second)
+	j.put("b", []byte("response-b2"))
+	resp, ok = j.get("b")
+	require.True(t, ok)
+	require.Equal(t, "response-b2", string(resp))
+
+	// Responses expire after the TTL.
+	now = now.Add(45 * time.Second)
+	_, ok = j.get("c")
+	require.False(t, ok)
+	_, ok = j.get("b")
+	require.True(t, ok)
+	require.Equal(t, 1, j.entries.Len())
+}
+
+func TestRedisResponseStoreUnavailable(t *testing.T) {
+	// Nothing listens on the port.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+	s, err := newRedisResponseStore("redis://"+ln.Addr().String(), "test:", "0", time.Minute, time.Second)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Errors are treated like missing responses.
+	s.put("a", []byte("response-a"))
+	_, ok := s.get("a")
+	require.False(t, ok)
+}
+
+func TestRedisResponseStore(t *testing.T) {
+	srv := miniredis.RunT(t)
+	srv.RequireAuth("secret")
+	t.Setenv("REDIS_PASSWORD", "secret")
+	newStore := func(stream string) *redisResponseStore {
+		s, err := newRedisResponseStore("redis://"+srv.Addr()+"/0", "kubeai:responses:", stream, time.Minute, time.Second)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+	a, b := newStore("a"), newStore("b")
+
+	_, ok := a.get("request-1")
+	require.False(t, ok)
+	a.put("request-1", []byte("response-1"))
+	resp, ok := a.get("request-1")
+	require.True(t, ok)
+	require.Equal(t, "response-1", string(resp))
+
+	// Keys are namespaced by stream and expire after the TTL.
+	_, ok = b.get("request-1")
+	require.False(t, ok)
+	require.True(t, srv.Exists("kubeai:responses:a:request-1"))
+	require.Equal(t, time.Minute, srv.TTL("kubeai:responses:a:request-1"))
+	srv.FastForward(time.Minute)
+	_, ok = a.get("request-1")
+	require.False(t, ok)
+
+	_, err := newRedisResponseStore("http://"+srv.Addr(), "", "a", time.Minute, time.Second)
+	require.Error(t, err)
+}
+
+func TestHandleRedeliveredRequest(t *testing.T) {
+	ctx := context.Background()
+
+	requestsTopic, err := pubsub.OpenTopic(ctx, "mem://journal-test-requests")
+	require.NoError(t, err)
+	defer requestsTopic.Shutdown(ctx)
+	requests, err := pubsub.OpenSubscription(ctx, "mem://journal-test-requests")
+	require.NoError(t, err)
+	defer requests.Shutdown(ctx)
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://journal-test-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	responses, err := pubsub.OpenSubscription(ctx, "mem://journal-test-responses")
+	require.NoError(t, err)
+	defer responses.Shutdown(ctx)
+
+	m := &Messenger{
+		// No model scaler or resolver: inference must not be attempted.
+		responses:      responsesTopic,
+		journal:        newResponseJournal(time.Hour, 10),
+		idempotencyKey: "request-id",
+	}
+	m.journal.put("abc", []byte(`{"previous":"response"}`))
+
+	require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{
+		Body: []byte(`{"metadata":{"request-id":"abc"},"body":{"model":"test-model"}}`),
+	}))
+	msg, err := requests.Receive(ctx)
+	require.NoError(t, err)
+	m.handleRequest(ctx, msg)
+
+	resp, err := responses.Receive(ctx)
+	require.NoError(t, err)
+	resp.Ack()
+	require.Equal(t, `{"previous":"response"}`, string(resp.Body))
+}
@@ -0,0 +1,423 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/batcher"
+	"gocloud.dev/pubsub/driver"
+)
+
+// openKafkaSubscription opens a "kafka://<group>?topic=<topic>" subscription
+// that is consumed by a kafkaSubscription.
+func openKafkaSubscription(u *url.URL, t *config.KafkaTransport) (*pubsub.Subscription, error) {
+	brokers, err := kafkaBrokers()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := kafkaConfig(t)
+	// Offsets are committed after messages are acknowledged.
+	cfg.Consumer.Offsets.AutoCommit.Enable = false
+
+	var topics []string
+	for param, value := range u.Query() {
+		switch param {
+		case "topic":
+			topics = value
+		case "offset":
+			switch value[0] {
+			case "oldest":
+				cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+			case "newest":
+				cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+			default:
+				return nil, fmt.Errorf("invalid kafka offset %q", value[0])
+			}
+		default:
+			return nil, fmt.Errorf("invalid kafka subscription query parameter %q", param)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("missing kafka topic query parameter")
+	}
+
+	group, err := sarama.NewConsumerGroup(brokers, path.Join(u.Host, u.Path), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating kafka consumer group: %w", err)
+	}
+	ds := newKafkaSubscription(t.KeyName, t.MaxBufferedMessages)
+	ds.consume(group, topics)
+
+	// Messages are handed out one at a time, so that ordering by key
+	// is not undone by batching.
+	return pubsub.NewSubscription(ds, &batcher.Options{MaxBatchSize: 1, MaxHandlers: 1}, nil), nil
+}
+
+// kafkaSubscription is a gocloud.dev pubsub driver for Kafka consumer groups.
+//
+// Unlike the gocloud.dev kafkapubsub driver, the offset of each partition is
+// committed as soon as all messages of the partition up to that offset were
+// acknowledged, nacked messages are redelivered and messages with the same
+// key are handed out one at a time in the order of their partition.
+//
+// When partitions are rebalanced, messages that were handed out but not
+// acknowledged are redelivered to the new owner of the partition.
+type kafkaSubscription struct {
+	keyName     string
+	maxBuffered int
+
+	group   sarama.ConsumerGroup
+	cancel  context.CancelFunc
+	closeCh chan struct{}
+
+	mtx sync.Mutex
+	// changed is closed (and replaced) when messages become ready or
+	// partitions have space for more messages.
+	changed    chan struct{}
+	sess       sarama.ConsumerGroupSession
+	generation int
+	partitions map[kafkaTopicPartition]*kafkaPartition
+	// ready are the messages that can be handed out, in the order that
+	// they became ready.
+	ready    []*kafkaAck
+	closed   bool
+	closeErr error
+}
+
+type kafkaTopicPartition struct {
+	topic     string
+	partition int32
+}
+
+type kafkaPartition struct {
+	// pending are the messages that were received but not acknowledged,
+	// in offset order.
+	pending []*kafkaAck
+	// busy are the keys of messages that are ready or handed out.
+	busy map[string]bool
+}
+
+type kafkaAck struct {
+	msg        *sarama.ConsumerMessage
+	key        string
+	generation int
+	scheduled  bool
+	acked      bool
+}
+
+func newKafkaSubscription(keyName string, maxBuffered int) *kafkaSubscription {
+	return &kafkaSubscription{
+		keyName:     keyName,
+		maxBuffered: max(maxBuffered, 1),
+		changed:     make(chan struct{}),
+		partitions:  map[kafkaTopicPartition]*kafkaPartition{},
+	}
+}
+
+// consume joins the consumer group in the background until the
+// subscription is closed.
+func (s *kafkaSubscription) consume(group sarama.ConsumerGroup, topics []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.group = group
+	s.cancel = cancel
+	s.closeCh = make(chan struct{})
+	go func() {
+		defer close(s.closeCh)
+		for {
+			// Consume returns when partitions are rebalanced.
+			err := group.Consume(ctx, topics, s)
+			if err != nil || ctx.Err() != nil {
+				s.mtx.Lock()
+				s.closed = true
+				s.closeErr = err
+				s.broadcast()
+				s.mtx.Unlock()
+				group.Close()
+				return
+			}
+		}
+	}()
+}
+
+// broadcast wakes up all waiters. Must be called with mtx held.
+func (s *kafkaSubscription) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Setup implements sarama.ConsumerGroupHandler.
+func (s *kafkaSubscription) Setup(sess sarama.ConsumerGroupSession) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.sess = sess
+	s.generation++
+	s.partitions = map[kafkaTopicPartition]*kafkaPartition{}
+	s.ready = nil
+	s.broadcast()
+	return nil
+}
+
+// Cleanup implements sarama.ConsumerGroupHandler.
+func (s *kafkaSubscription) Cleanup(sarama.ConsumerGroupSession) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.sess = nil
+	s.generation++
+	s.partitions = map[kafkaTopicPartition]*kafkaPartition{}
+	s.ready = nil
+	s.broadcast()
+	return nil
+}
+
+// ConsumeClaim implements sarama.ConsumerGroupHandler.
+func (s *kafkaSubscription) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !s.offer(sess.Context(), msg) {
+				return nil
+			}
+		case <-sess.Context().Done():
+			return nil
+		}
+	}
+}
+
+// offer adds a received message to its partition once the partition has
+// space for it. It returns false if the session ended first.
+func (s *kafkaSubscription) offer(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	tp := kafkaTopicPartition{topic: msg.Topic, partition: msg.Partition}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for {
+		if s.closed {
+			return false
+		}
+		p, ok := s.partitions[tp]
+		if !ok {
+			p = &kafkaPartition{busy: map[string]bool{}}
+			s.partitions[tp] = p
+		}
+		if len(p.pending) < s.maxBuffered {
+			p.pending = append(p.pending, &kafkaAck{
+				msg:        msg,
+				key:        string(msg.Key),
+				generation: s.generation,
+			})
+			s.schedule(p)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		changed := s.changed
+		s.mtx.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+		s.mtx.Lock()
+	}
+}
+
+// schedule makes the pending messages of a partition ready, unless an
+// earlier message with the same key was not acknowledged yet.
+// Must be called with mtx held.
+func (s *kafkaSubscription) schedule(p *kafkaPartition) {
+	blocked := map[string]bool{}
+	var added bool
+	for _, a := range p.pending {
+		if a.acked || a.scheduled {
+			continue
+		}
+		if a.key != "" {
+			if p.busy[a.key] || blocked[a.key] {
+				blocked[a.key] = true
+				continue
+			}
+			p.busy[a.key] = true
+		}
+		a.scheduled = true
+		s.ready = append(s.ready, a)
+		added = true
+	}
+	if added {
+		s.broadcast()
+	}
+}
+
+// ReceiveBatch implements driver.Subscription.
+func (s *kafkaSubscription) ReceiveBatch(ctx context.Context, maxMessages int) ([]*driver.Message, error) {
+	// Wait for messages for up to 100ms, like the gocloud.dev driver.
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for len(s.ready) == 0 {
+		if s.closed {
+			return nil, s.closeErr
+		}
+		changed := s.changed
+		s.mtx.Unlock()
+		select {
+		case <-changed:
+		case <-waitCtx.Done():
+		}
+		s.mtx.Lock()
+		if waitCtx.Err() != nil && len(s.ready) == 0 {
+			return nil, ctx.Err()
+		}
+	}
+
+	n := min(maxMessages, len(s.ready))
+	dms := make([]*driver.Message, 0, n)
+	for _, a := range s.ready[:n] {
+		dms = append(dms, s.driverMessage(a))
+	}
+	s.ready = s.ready[n:]
+	return dms, nil
+}
+
+func (s *kafkaSubscription) driverMessage(a *kafkaAck) *driver.Message {
+	msg := a.msg
+	md := make(map[string]string, len(msg.Headers)+1)
+	for _, h := range msg.Headers {
+		md[string(h.Key)] = string(h.Value)
+	}
+	if a.key != "" && s.keyName != "" {
+		md[s.keyName] = a.key
+	}
+	return &driver.Message{
+		// Message keys are not unique, so messages are identified by offset.
+		LoggableID: fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset),
+		Body:       msg.Value,
+		Metadata:   md,
+		AckID:      a,
+		AsFunc: func(i interface{}) bool {
+			if p, ok := i.(**sarama.ConsumerMessage); ok {
+				*p = msg
+				return true
+			}
+			return false
+		},
+	}
+}
+
+// SendAcks implements driver.Subscription. The offset of each partition is
+// committed up to the first message that was not acknowledged yet.
+func (s *kafkaSubscription) SendAcks(ctx context.Context, ids []driver.AckID) error {
+	s.mtx.Lock()
+	sess := s.sess
+	var marked bool
+	for tp, p := range s.ackedPartitions(ids, true) {
+		var last *kafkaAck
+		for len(p.pending) > 0 && p.pending[0].acked {
+			last = p.pending[0]
+			p.pending = p.pending[1:]
+		}
+		if last != nil && sess != nil {
+			sess.MarkOffset(tp.topic, tp.partition, last.msg.Offset+1, "")
+			marked = true
+		}
+		s.schedule(p)
+	}
+	s.broadcast()
+	s.mtx.Unlock()
+
+	if marked {
+		sess.Commit()
+	}
+	return nil
+}
+
+// CanNack implements driver.Subscription.
+func (s *kafkaSubscription) CanNack() bool { return true }
+
+// SendNacks implements driver.Subscription. Nacked messages are handed out
+// again before later messages with the same key.
+func (s *kafkaSubscription) SendNacks(ctx context.Context, ids []driver.AckID) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, p := range s.ackedPartitions(ids, false) {
+		s.schedule(p)
+	}
+	return nil
+}
+
+// ackedPartitions releases the keys of the given messages of the current
+// session (marking them as acked or as not scheduled) and returns their
+// partitions. Messages of earlier sessions are redelivered to the new owner
+// of their partition. Must be called with mtx held.
+func (s *kafkaSubscription) ackedPartitions(ids []driver.AckID, acked bool) map[kafkaTopicPartition]*kafkaPartition {
+	partitions := map[kafkaTopicPartition]*kafkaPartition{}
+	for _, id := range ids {
+		a := id.(*kafkaAck)
+		if a.generation != s.generation {
+			continue
+		}
+		tp := kafkaTopicPartition{topic: a.msg.Topic, partition: a.msg.Partition}
+		p, ok := s.partitions[tp]
+		if !ok {
+			continue
+		}
+		if acked {
+			a.acked = true
+		} else {
+			a.scheduled = false
+		}
+		if a.key != "" {
+			delete(p.busy, a.key)
+		}
+		partitions[tp] = p
+	}
+	return partitions
+}
+
+// Close implements driver.Subscription.
+func (s *kafkaSubscription) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.closeCh
+	}
+	return nil
+}
+
+// IsRetryable implements driver.Subscription.
+func (*kafkaSubscription) IsRetryable(error) bool { return false }
+
+// As implements driver.Subscription.
+func (s *kafkaSubscription) As(i interface{}) bool {
+	if p, ok := i.(*sarama.ConsumerGroup); ok {
+		*p = s.group
+		return true
+	}
+	return false
+}
+
+// ErrorAs implements driver.Subscription.
+func (*kafkaSubscription) ErrorAs(err error, i interface{}) bool {
+	return errors.As(err, i)
+}
+
+// ErrorCode implements driver.Subscription.
+func (*kafkaSubscription) ErrorCode(err error) gcerrors.ErrorCode {
+	if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+		return gcerrors.FailedPrecondition
+	}
+	return gcerrors.Unknown
+}
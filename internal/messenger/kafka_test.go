@@ -0,0 +1,142 @@
+package messenger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/driver"
+)
+
+type testKafkaSession struct {
+	sarama.ConsumerGroupSession
+	ctx     context.Context
+	offsets map[int32]int64
+	commits int
+}
+
+func (s *testKafkaSession) Context() context.Context { return s.ctx }
+
+func (s *testKafkaSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.offsets[partition] = offset
+}
+
+func (s *testKafkaSession) Commit() { s.commits++ }
+
+func TestKafkaSubscription(t *testing.T) {
+	ctx := context.Background()
+
+	newSub := func(t *testing.T, maxBuffered int) (*kafkaSubscription, *testKafkaSession) {
+		sess := &testKafkaSession{ctx: ctx, offsets: map[int32]int64{}}
+		s := newKafkaSubscription("session_id", maxBuffered)
+		require.NoError(t, s.Setup(sess))
+		return s, sess
+	}
+	offer := func(t *testing.T, s *kafkaSubscription, partition int32, offset int64, key string) {
+		t.Helper()
+		msg := &sarama.ConsumerMessage{Topic: "requests", Partition: partition, Offset: offset, Value: []byte("{}")}
+		if key != "" {
+			msg.Key = []byte(key)
+		}
+		require.True(t, s.offer(ctx, msg))
+	}
+	receive := func(t *testing.T, s *kafkaSubscription) []string {
+		t.Helper()
+		dms, err := s.ReceiveBatch(ctx, 10)
+		require.NoError(t, err)
+		var ids []string
+		for _, dm := range dms {
+			ids = append(ids, dm.LoggableID)
+		}
+		return ids
+	}
+	ackID := func(t *testing.T, s *kafkaSubscription, partition int32, offset int64) driver.AckID {
+		t.Helper()
+		for _, a := range s.partitions[kafkaTopicPartition{topic: "requests", partition: partition}].pending {
+			if a.msg.Offset == offset {
+				return a
+			}
+		}
+		t.Fatalf("no pending message at offset %d", offset)
+		return nil
+	}
+
+	t.Run("offsets are committed per partition", func(t *testing.T) {
+		s, sess := newSub(t, 10)
+		offer(t, s, 0, 0, "")
+		offer(t, s, 0, 1, "")
+		offer(t, s, 1, 0, "")
+		require.Equal(t, []string{"requests/0/0", "requests/0/1", "requests/1/0"}, receive(t, s))
+
+		// Offset 1 can not be committed before offset 0.
+		require.NoError(t, s.SendAcks(ctx, []driver.AckID{ackID(t, s, 0, 1)}))
+		require.Empty(t, sess.offsets)
+
+		// Other partitions are not held back.
+		require.NoError(t, s.SendAcks(ctx, []driver.AckID{ackID(t, s, 1, 0)}))
+		require.Equal(t, map[int32]int64{1: 1}, sess.offsets)
+
+		require.NoError(t, s.SendAcks(ctx, []driver.AckID{ackID(t, s, 0, 0)}))
+		require.Equal(t, map[int32]int64{0: 2, 1: 1}, sess.offsets)
+		require.Equal(t, 2, sess.commits)
+	})
+
+	t.Run("messages with the same key are ordered", func(t *testing.T) {
+		s, _ := newSub(t, 10)
+		offer(t, s, 0, 0, "a")
+		offer(t, s, 0, 1, "a")
+		offer(t, s, 0, 2, "b")
+		dms, err := s.ReceiveBatch(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, dms, 2)
+		require.Equal(t, "requests/0/0", dms[0].LoggableID)
+		require.Equal(t, "a", dms[0].Metadata["session_id"])
+		require.Equal(t, "requests/0/2", dms[1].LoggableID)
+
+		// A nacked message is redelivered before the next message with its key.
+		require.NoError(t, s.SendNacks(ctx, []driver.AckID{ackID(t, s, 0, 0)}))
+		require.Equal(t, []string{"requests/0/0"}, receive(t, s))
+
+		require.NoError(t, s.SendAcks(ctx, []driver.AckID{ackID(t, s, 0, 0)}))
+		require.Equal(t, []string{"requests/0/1"}, receive(t, s))
+	})
+
+	t.Run("partitions are bounded", func(t *testing.T) {
+		s, _ := newSub(t, 1)
+		offer(t, s, 0, 0, "")
+		require.Equal(t, []string{"requests/0/0"}, receive(t, s))
+
+		ended, cancel := context.WithCancel(ctx)
+		cancel()
+		require.False(t, s.offer(ended, &sarama.ConsumerMessage{Topic: "requests", Offset: 1}), "The partition should be full")
+		require.True(t, s.offer(ended, &sarama.ConsumerMessage{Topic: "requests", Partition: 1}), "Other partitions should not be full")
+
+		require.NoError(t, s.SendAcks(ctx, []driver.AckID{ackID(t, s, 0, 0)}))
+		offer(t, s, 0, 1, "")
+	})
+
+	t.Run("acks of earlier sessions are ignored", func(t *testing.T) {
+		s, sess := newSub(t, 10)
+		offer(t, s, 0, 0, "")
+		require.Equal(t, []string{"requests/0/0"}, receive(t, s))
+		stale := ackID(t, s, 0, 0)
+
+		// Rebalance.
+		require.NoError(t, s.Cleanup(sess))
+		require.NoError(t, s.Setup(sess))
+		require.NoError(t, s.SendAcks(ctx, []driver.AckID{stale}))
+		require.Empty(t, sess.offsets)
+	})
+}
+
+func TestResponseMetadataKey(t *testing.T) {
+	m := &Messenger{transport: config.MessageTransport{Kafka: &config.KafkaTransport{KeyName: "session_id"}}}
+	req := &request{msg: &pubsub.Message{LoggableID: "requests/0/1", Metadata: map[string]string{"session_id": "abc"}}}
+	require.Equal(t, map[string]string{
+		"request_message_id": "requests/0/1",
+		"session_id":         "abc",
+	}, m.responseMetadata(req))
+}
@@ -0,0 +1,142 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"time"
+
+	raw "cloud.google.com/go/pubsub/apiv1"
+	pb "cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	sqsv2 "github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypesv2 "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go/aws"
+	sqsv1 "github.com/aws/aws-sdk-go/service/sqs"
+	"gocloud.dev/pubsub"
+)
+
+// keepaliveFunc hides a received message from other consumers for the
+// given amount of time (starting now).
+type keepaliveFunc func(ctx context.Context, msg *pubsub.Message, timeout time.Duration) error
+
+// newKeepaliveFunc returns the keepalive hook of the transport of the
+// subscription or nil if the transport is not supported.
+func newKeepaliveFunc(requestsURL string, sub *pubsub.Subscription) (keepaliveFunc, error) {
+	u, err := url.Parse(requestsURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing requests url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "awssqs":
+		// Matches the queue URL that is used by the gocloud.dev driver.
+		queueURL := "https://" + path.Join(u.Host, u.Path)
+		var clientV2 *sqsv2.Client
+		if sub.As(&clientV2) {
+			return sqsKeepaliveV2(clientV2, queueURL), nil
+		}
+		var clientV1 *sqsv1.SQS
+		if sub.As(&clientV1) {
+			return sqsKeepaliveV1(clientV1, queueURL), nil
+		}
+	case jetStreamScheme:
+		return jetStreamKeepalive, nil
+	case "gcppubsub":
+		var client *raw.SubscriberClient
+		if sub.As(&client) {
+			return gcpPubSubKeepalive(client, path.Join(u.Host, u.Path)), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func sqsKeepaliveV2(client *sqsv2.Client, queueURL string) keepaliveFunc {
+	return func(ctx context.Context, msg *pubsub.Message, timeout time.Duration) error {
+		var m sqstypesv2.Message
+		if !msg.As(&m) {
+			return fmt.Errorf("message is not an sqs message")
+		}
+		_, err := client.ChangeMessageVisibility(ctx, &sqsv2.ChangeMessageVisibilityInput{
+			QueueUrl:          &queueURL,
+			ReceiptHandle:     m.ReceiptHandle,
+			VisibilityTimeout: int32(timeout.Seconds()),
+		})
+		return err
+	}
+}
+
+func sqsKeepaliveV1(client *sqsv1.SQS, queueURL string) keepaliveFunc {
+	return func(ctx context.Context, msg *pubsub.Message, timeout time.Duration) error {
+		var m *sqsv1.Message
+		if !msg.As(&m) {
+			return fmt.Errorf("message is not an sqs message")
+		}
+		_, err := client.ChangeMessageVisibilityWithContext(ctx, &sqsv1.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(queueURL),
+			ReceiptHandle:     m.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(int64(timeout.Seconds())),
+		})
+		return err
+	}
+}
+
+func gcpPubSubKeepalive(client *raw.SubscriberClient, subscription string) keepaliveFunc {
+	return func(ctx context.Context, msg *pubsub.Message, timeout time.Duration) error {
+		var m *pb.ReceivedMessage
+		if !msg.As(&m) {
+			return fmt.Errorf("message is not a pubsub message")
+		}
+		return client.ModifyAckDeadline(ctx, &pb.ModifyAckDeadlineRequest{
+			Subscription:       subscription,
+			AckIds:             []string{m.AckId},
+			AckDeadlineSeconds: int32(timeout.Seconds()),
+		})
+	}
+}
+
+// startKeepalive extends the time that the message is hidden from other
+// consumers every keepalive interval until the returned function is called.
+func (m *Messenger) startKeepalive(msg *pubsub.Message) (stop func()) {
+	if m.keepalive == nil || m.transport.Keepalive == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(m.transport.Keepalive.Interval.Duration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := m.keepalive(ctx, msg, m.transport.Keepalive.Timeout.Duration); err != nil && ctx.Err() == nil {
+				log.Printf("Error extending keepalive of message %v: %v", msg.LoggableID, err)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// receiveTimeout returns the amount of time that a message is hidden from
+// other consumers for once it is received or 0 if the default of the
+// transport should be kept.
+func (m *Messenger) receiveTimeout() time.Duration {
+	if sqs := m.transport.AWSSQS; sqs != nil && sqs.VisibilityTimeout.Duration > 0 {
+		return sqs.VisibilityTimeout.Duration
+	}
+	if m.transport.Keepalive != nil {
+		return m.transport.Keepalive.Timeout.Duration
+	}
+	return 0
+}
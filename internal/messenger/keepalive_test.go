@@ -0,0 +1,63 @@
+package messenger
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/pubsub"
+)
+
+func TestStartKeepalive(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		timeouts []time.Duration
+	)
+	m := &Messenger{
+		transport: config.MessageTransport{
+			Keepalive: &config.MessageKeepalive{
+				Timeout:  config.Duration{Duration: time.Minute},
+				Interval: config.Duration{Duration: 10 * time.Millisecond},
+			},
+		},
+		keepalive: func(ctx context.Context, msg *pubsub.Message, timeout time.Duration) error {
+			mtx.Lock()
+			defer mtx.Unlock()
+			timeouts = append(timeouts, timeout)
+			return nil
+		},
+	}
+
+	stop := m.startKeepalive(&pubsub.Message{})
+	require.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(timeouts) >= 2
+	}, time.Second, 5*time.Millisecond)
+	stop()
+
+	mtx.Lock()
+	n := len(timeouts)
+	require.Equal(t, time.Minute, timeouts[0])
+	mtx.Unlock()
+
+	// No more extensions after stopping.
+	time.Sleep(30 * time.Millisecond)
+	mtx.Lock()
+	require.Equal(t, n, len(timeouts))
+	mtx.Unlock()
+}
+
+func TestReceiveTimeout(t *testing.T) {
+	m := &Messenger{}
+	require.Equal(t, time.Duration(0), m.receiveTimeout())
+
+	m.transport.Keepalive = &config.MessageKeepalive{Timeout: config.Duration{Duration: time.Minute}}
+	require.Equal(t, time.Minute, m.receiveTimeout())
+
+	m.transport.AWSSQS = &config.AWSSQSTransport{VisibilityTimeout: config.Duration{Duration: 5 * time.Minute}}
+	require.Equal(t, 5*time.Minute, m.receiveTimeout())
+}
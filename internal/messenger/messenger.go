@@ -11,10 +11,21 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/admission"
 	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/bodycodec"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/debuglog"
+	"github.com/substratusai/kubeai/internal/echo"
+	"github.com/substratusai/kubeai/internal/endpoints"
+	"github.com/substratusai/kubeai/internal/engines"
 	"github.com/substratusai/kubeai/internal/metrics"
+	"github.com/substratusai/kubeai/internal/modelproxy"
+	"github.com/substratusai/kubeai/internal/requestindex"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"gocloud.dev/pubsub"
@@ -24,74 +35,278 @@ type Messenger struct {
 	modelScaler ModelScaler
 	resolver    EndpointResolver
 
+	// stream identifies the messaging stream in metrics.
+	stream string
+
 	HTTPC *http.Client
+	// Admission evaluates admission policies for requests. Nil allows all requests.
+	Admission Admission
+	// RequestIndex records the status of request messages. Nil disables indexing.
+	RequestIndex RequestIndex
+	// Moderator moderates the requests of Models with a safety policy.
+	// Nil fails the moderation of these requests.
+	Moderator Moderator
 
 	MaxHandlers     int
 	ErrorMaxBackoff time.Duration
 
 	requestsURL string
+	transport   config.MessageTransport
 	requests    *pubsub.Subscription
 	responses   *pubsub.Topic
+	// responsesURL is recorded in the request index as the result location.
+	responsesURL string
+	// responseTopics is nil unless requests may select their responses
+	// topic (see resolveResponseTopic()).
+	responseTopics *responseTopics
+
+	// deadLetter is nil unless a dead-letter topic is configured.
+	deadLetter *pubsub.Topic
+	// maxAttempts is the number of times that a request message is handled
+	// before it is no longer redelivered (0 means no limit).
+	maxAttempts int
+	// attempts is nil unless maxAttempts is set.
+	attempts *attemptCounter
+	// overflow is nil unless an overflow bucket is configured.
+	overflow *overflowBucket
+	// priorities is nil unless priority classes are configured.
+	priorities *priorities
+	// limiter is nil unless concurrency limits are configured.
+	limiter *concurrencyLimiter
+	// forwardedMetadata is sent to model servers as HTTP headers.
+	forwardedMetadata []config.ForwardedMetadata
+
+	// adaptive is nil unless the number of handlers is adapted
+	// (up to MaxHandlers).
+	adaptive *adaptiveHandlers
+	// compression is nil unless response messages are compressed.
+	compression *messageCompression
+	// embeddings is nil unless embeddings requests are coalesced.
+	embeddings *embeddingCoalescer
+	// handlers is the semaphore of the handlers once started.
+	handlers atomic.Pointer[handlerSemaphore]
+
+	batches config.MessageBatches
+	// progress is nil if batch progress events are published
+	// to the responses topic.
+	progress *pubsub.Topic
+
+	// journal is nil unless deduplication of redelivered requests is enabled.
+	journal        responseStore
+	idempotencyKey string
+
+	// keepalive is nil if the transport of the requests subscription
+	// does not support hiding messages from other consumers.
+	keepalive keepaliveFunc
 
 	consecutiveErrorsMtx sync.RWMutex
 	consecutiveErrors    int
+
+	// backlog is nil if the backlog of the requests subscription
+	// can not be determined.
+	backlog  backlogFunc
+	modelMix *modelMix
 }
 
+// backlogPollInterval is the time between reads of the requests subscription backlog.
+const backlogPollInterval = 10 * time.Second
+
+// NewMessenger returns the Messenger of a messaging stream. errorMaxBackoff
+// applies to all streams (see config.Messaging).
 func NewMessenger(
 	ctx context.Context,
-	requestsURL string,
-	responsesURL string,
-	maxHandlers int,
+	cfg config.MessageStream,
 	errorMaxBackoff time.Duration,
 	modelScaler ModelScaler,
 	resolver EndpointResolver,
 	httpClient *http.Client,
 ) (*Messenger, error) {
-	requests, err := pubsub.OpenSubscription(ctx, requestsURL)
+	requests, err := openSubscription(ctx, cfg.RequestsURL, cfg.Transport)
 	if err != nil {
 		return nil, err
 	}
 
-	responses, err := pubsub.OpenTopic(ctx, responsesURL)
+	responses, err := pubsub.OpenTopic(ctx, cfg.ResponsesURL)
 	if err != nil {
 		return nil, err
 	}
 
+	var progress *pubsub.Topic
+	if cfg.Batches.ProgressURL != "" {
+		progress, err = pubsub.OpenTopic(ctx, cfg.Batches.ProgressURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var deadLetterTopic *pubsub.Topic
+	if cfg.DeadLetter != nil {
+		deadLetterTopic, err = pubsub.OpenTopic(ctx, cfg.DeadLetter.URL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var bucket *overflowBucket
+	if cfg.Overflow != nil {
+		bucket, err = openOverflowBucket(ctx, cfg.Overflow)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var attempts *attemptCounter
+	if cfg.MaxAttempts > 0 {
+		attempts = newAttemptCounter()
+	}
+
+	backlog, err := newBacklogFunc(cfg.RequestsURL, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	keepalive, err := newKeepaliveFunc(cfg.RequestsURL, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		journal        responseStore
+		idempotencyKey string
+	)
+	if cfg.Deduplication != nil {
+		if r := cfg.Deduplication.Redis; r != nil {
+			journal, err = newRedisResponseStore(r.URL, r.KeyPrefix, cfg.Name, cfg.Deduplication.TTL.Duration, r.Timeout.Duration)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			journal = newResponseJournal(cfg.Deduplication.TTL.Duration, cfg.Deduplication.MaxEntries)
+		}
+		idempotencyKey = cfg.Deduplication.IdempotencyKey
+	}
+
+	var prios *priorities
+	if cfg.Priorities != nil {
+		prios = newPriorities(cfg.Priorities)
+	}
+
+	var limiter *concurrencyLimiter
+	if cfg.ConcurrencyLimits != nil {
+		limiter = newConcurrencyLimiter(cfg.ConcurrencyLimits)
+	}
+
+	var adaptive *adaptiveHandlers
+	if cfg.AdaptiveHandlers != nil {
+		adaptive = &adaptiveHandlers{cfg: *cfg.AdaptiveHandlers}
+	}
+
+	var embeddings *embeddingCoalescer
+	if cfg.EmbeddingCoalescing != nil {
+		embeddings = newEmbeddingCoalescer(cfg.EmbeddingCoalescing)
+	}
+
+	var compression *messageCompression
+	if cfg.Compression != nil {
+		compression = newMessageCompression(cfg.Compression)
+	}
+
 	return &Messenger{
-		modelScaler:     modelScaler,
-		resolver:        resolver,
-		HTTPC:           httpClient,
-		requestsURL:     requestsURL,
-		requests:        requests,
-		responses:       responses,
-		MaxHandlers:     maxHandlers,
-		ErrorMaxBackoff: errorMaxBackoff,
+		stream:            cfg.Name,
+		backlog:           backlog,
+		modelMix:          newModelMix(100),
+		modelScaler:       modelScaler,
+		resolver:          resolver,
+		HTTPC:             httpClient,
+		requestsURL:       cfg.RequestsURL,
+		transport:         cfg.Transport,
+		requests:          requests,
+		keepalive:         keepalive,
+		journal:           journal,
+		idempotencyKey:    idempotencyKey,
+		responses:         responses,
+		responsesURL:      cfg.ResponsesURL,
+		deadLetter:        deadLetterTopic,
+		maxAttempts:       cfg.MaxAttempts,
+		overflow:          bucket,
+		priorities:        prios,
+		limiter:           limiter,
+		adaptive:          adaptive,
+		embeddings:        embeddings,
+		compression:       compression,
+		forwardedMetadata: cfg.ForwardedMetadata,
+		responseTopics:    responseTopicsFor(cfg.ResponseTopics),
+		attempts:          attempts,
+		batches:           cfg.Batches,
+		progress:          progress,
+		MaxHandlers:       cfg.MaxHandlers,
+		ErrorMaxBackoff:   errorMaxBackoff,
 	}, nil
 }
 
 type ModelScaler interface {
-	LookupModel(ctx context.Context, model, adapter string, selectors []string) (bool, error)
+	LookupModel(ctx context.Context, model, adapter string, selectors []string) (string, bool, error)
+	LookupChatMessageNormalization(ctx context.Context, model string) (*kubeaiv1.ChatMessageNormalization, error)
+	LookupCapabilities(ctx context.Context, model string) (*kubeaiv1.ModelStatusCapabilities, error)
+	LookupDeprecation(ctx context.Context, model string) (*kubeaiv1.ModelDeprecation, error)
+	LookupActive(ctx context.Context, model string) (bool, time.Time, error)
+	LookupEngine(ctx context.Context, model string) (string, []string, error)
+	LookupSafetyPolicy(ctx context.Context, model string) (*kubeaiv1.ModelSafetyPolicy, error)
 	ScaleAtLeastOneReplica(ctx context.Context, model string) error
 }
 
+type Admission interface {
+	Admit(req *admission.Request) admission.Decision
+}
+
+type RequestIndex interface {
+	Put(ctx context.Context, r *requestindex.Record) error
+}
+
+// Moderator is implemented by the model proxy (see modelproxy.Handler.Moderate).
+type Moderator interface {
+	Moderate(ctx context.Context, id string, policy *kubeaiv1.ModelSafetyPolicy, params map[string]any) (string, error)
+}
+
 type EndpointResolver interface {
 	AwaitBestAddress(ctx context.Context, model, adapter string) (string, func(), error)
 }
 
 func (m *Messenger) Start(ctx context.Context) error {
-	sem := make(chan struct{}, m.MaxHandlers)
+	sem := newHandlerSemaphore(m.MaxHandlers)
+	m.handlers.Store(sem)
+	m.recordHandlers(ctx, m.MaxHandlers)
+	if m.adaptive != nil {
+		go m.adaptHandlers(ctx, sem)
+	}
 
 	var restartAttempt int
 	const maxRestartAttempts = 20
 	const maxRestartBackoff = 10 * time.Second
 
+	if m.backlog != nil {
+		go m.pollBacklog(ctx)
+	} else {
+		log.Printf("Backlog of requests subscription %q is not supported, messages waiting in the subscription will not be considered when autoscaling", m.requestsURL)
+	}
+
+	var dispatched chan struct{}
+	if m.priorities != nil {
+		dispatched = make(chan struct{})
+		go func() {
+			defer close(dispatched)
+			m.dispatch(ctx, sem)
+		}()
+	}
+
 	log.Printf("Messenger starting receive loop for requests subscription %q", m.requestsURL)
 recvLoop:
 	for {
 		msg, err := m.requests.Receive(ctx)
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
-				return err
+				// In-flight messages are still handled below.
+				break recvLoop
 			}
 
 			if restartAttempt > maxRestartAttempts {
@@ -115,7 +330,13 @@ recvLoop:
 			time.Sleep(restartWait)
 
 			var subErr error
-			m.requests, subErr = pubsub.OpenSubscription(ctx, m.requestsURL)
+			m.requests, subErr = openSubscription(ctx, m.requestsURL, m.transport)
+			if subErr != nil {
+				log.Printf("Error recreating requests subscription %v: %v",
+					m.requestsURL, subErr)
+				return subErr
+			}
+			m.keepalive, subErr = newKeepaliveFunc(m.requestsURL, m.requests)
 			if subErr != nil {
 				log.Printf("Error recreating requests subscription %v: %v",
 					m.requestsURL, subErr)
@@ -129,20 +350,42 @@ recvLoop:
 		}
 
 		log.Println("Received message:", msg.LoggableID)
+		m.recordReceived(msg)
 
-		// Wait if there are too many active handle goroutines and acquire the
-		// semaphore. If the context is canceled, stop waiting and start shutting
-		// down.
-		select {
-		case sem <- struct{}{}:
-		case <-ctx.Done():
-			break recvLoop
+		if timeout := m.receiveTimeout(); timeout > 0 && m.keepalive != nil {
+			// Applied before waiting for a handler so that messages do not
+			// become visible again while waiting.
+			if err := m.keepalive(ctx, msg, timeout); err != nil {
+				log.Printf("Error setting visibility timeout of message %v: %v", msg.LoggableID, err)
+			}
 		}
 
-		go func() {
-			defer func() { <-sem }()
-			m.handleRequest(context.Background(), msg)
-		}()
+		if m.priorities != nil || m.limiter != nil {
+			// The request is parsed to look up its priority class or
+			// concurrency limit.
+			req, err := parseRequest(context.Background(), msg)
+			// The message is extended while it waits for a handler, which
+			// can take longer than the keepalive timeout.
+			qr := queuedRequest{req: req, err: err, stopKeepalive: m.startKeepalive(msg)}
+			if err := m.submit(ctx, sem, qr); err != nil {
+				m.redeliverQueued(qr)
+				break recvLoop
+			}
+		} else {
+			// Wait if there are too many active handle goroutines and acquire the
+			// semaphore. If the context is canceled, stop waiting and start shutting
+			// down.
+			if err := sem.acquire(ctx); err != nil {
+				break recvLoop
+			}
+
+			go func() {
+				defer sem.release()
+				stopKeepalive := m.startKeepalive(msg)
+				defer stopKeepalive()
+				m.handleRequest(context.Background(), msg)
+			}()
+		}
 
 		// Slow down a bit to avoid churning through messages and running
 		// up cloud costs PubSub & GPUs when no meaningful work is being done.
@@ -159,13 +402,65 @@ recvLoop:
 		}
 	}
 
+	if m.priorities != nil {
+		<-dispatched
+		m.nackQueued()
+	}
+
 	// We're no longer receiving messages. Wait to finish handling any
-	// unacknowledged messages by totally acquiring the semaphore.
-	for n := 0; n < m.MaxHandlers; n++ {
-		sem <- struct{}{}
+	// unacknowledged messages.
+	sem.wait(context.Background())
+	if m.limiter != nil {
+		m.nackWaiting()
+	}
+	if err := m.responseTopics.shutdown(context.Background()); err != nil {
+		log.Printf("Error shutting down response topics: %v", err)
+	}
+	if c, ok := m.journal.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("Error closing response store: %v", err)
+		}
 	}
 
-	return nil
+	return ctx.Err()
+}
+
+// pollBacklog periodically records the backlog of the requests
+// subscription, attributed to models based on recently received messages.
+func (m *Messenger) pollBacklog(ctx context.Context) {
+	ticker := time.NewTicker(backlogPollInterval)
+	defer ticker.Stop()
+
+	// Models that a backlog was last recorded for. Used to reset
+	// the backlog to zero for models that are no longer receiving messages.
+	var lastModels map[string]int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := m.backlog(ctx)
+		if err != nil {
+			log.Printf("Failed to read backlog of requests subscription %q: %v", m.requestsURL, err)
+			continue
+		}
+
+		byModel := m.modelMix.split(n)
+		for model := range lastModels {
+			if _, ok := byModel[model]; !ok {
+				byModel[model] = 0
+			}
+		}
+		for model, backlog := range byModel {
+			metrics.MessengerBacklog.Record(ctx, backlog, metric.WithAttributeSet(attribute.NewSet(
+				metrics.AttrRequestModel.String(model),
+				metrics.AttrMessengerStream.String(m.stream),
+			)))
+		}
+		lastModels = byModel
+	}
 }
 
 func consecutiveErrBackoff(n int, max time.Duration) time.Duration {
@@ -192,52 +487,323 @@ func (m *Messenger) handleRequest(ctx context.Context, msg *pubsub.Message) {
 			}
 		}
 	*/
+	// Or a batch of request bodies in the "batch" field instead of "body"
+	// (see handleBatch()). If "stream" is true, the response is published
+	// incrementally (see streamBackendRequest()).
 	req, err := parseRequest(ctx, msg)
+	m.handleParsedRequest(ctx, req, err)
+}
+
+// handleParsedRequest handles a request message that was parsed by
+// parseRequest() (which returned the given error).
+func (m *Messenger) handleParsedRequest(ctx context.Context, req *request, err error) {
+	msg := req.msg
+	start := time.Now()
+	ctx, span := m.startRequestSpan(ctx, req)
+	var statusCode int
+	defer func() {
+		endRequestSpan(span, req, statusCode)
+		m.recordHandled(start, statusCode)
+		m.releaseResponseTopic(req)
+	}()
+
+	var expiry time.Time
+	if err == nil {
+		expiry, err = requestExpiry(req)
+	}
+	if err == nil {
+		err = m.resolveResponseTopic(req)
+	}
 	if err != nil {
-		m.sendResponse(req, m.jsonError("error parsing request: %v", err), http.StatusBadRequest)
+		if m.deadLetter != nil {
+			m.deadLetterUnparsable(msg, err)
+			return
+		}
+		statusCode = http.StatusBadRequest
+		var msgErr *messageError
+		if errors.As(err, &msgErr) {
+			m.sendResponse(req, m.jsonMessageError(msgErr), http.StatusBadRequest)
+		} else {
+			m.sendResponse(req, m.jsonError("error parsing request: %v", err), http.StatusBadRequest)
+		}
+		return
+	}
+	if !expiry.IsZero() && !time.Now().Before(expiry) {
+		m.skipExpired(req, expiry)
 		return
 	}
 
-	metricAttrs := metric.WithAttributeSet(attribute.NewSet(
+	if req.batch != nil {
+		m.handleBatch(ctx, req)
+		return
+	}
+	m.indexRequest(req, requestindex.StatusRunning, 0, nil)
+
+	// Streamed responses consist of multiple messages and
+	// are not deduplicated.
+	if m.journal != nil && !req.stream {
+		req.idempotencyKey = m.requestIdempotencyKey(req)
+	}
+	if req.idempotencyKey != "" {
+		if response, ok := m.journal.get(req.idempotencyKey); ok {
+			m.resendResponse(req, response)
+			return
+		}
+	}
+
+	var body []byte
+	body, statusCode = m.inferCoalesced(ctx, req)
+	m.sendResponse(req, body, statusCode)
+}
+
+// infer sends a request to a model server and returns the response
+// (or an error response).
+func (m *Messenger) infer(ctx context.Context, req *request) (respBody []byte, respCode int) {
+	msg := req.msg
+	debuglog.Printf(req.model, msg.LoggableID, "received message: path: %s, adapter: %q, metadata: %v", req.path, req.adapter, req.metadata)
+
+	if body, code, ok := m.resolveModel(ctx, req); !ok {
+		return body, code
+	}
+	if !req.admitted {
+		if body, code, ok := m.admit(ctx, req); !ok {
+			return body, code
+		}
+	}
+
+	// Metrics (and the backlog) are recorded by the name of the Model (not
+	// the alias that was requested) as the autoscaler scales Models by them.
+	m.modelMix.observe(req.model)
+	metricAttrs := metric.WithAttributeSet(attribute.NewSet(append(
+		metrics.RequestTagAttributes(req.metadataValue),
 		metrics.AttrRequestModel.String(req.model),
 		metrics.AttrRequestType.String(metrics.AttrRequestTypeMessage),
-	))
+	)...))
+	metrics.InferenceRequests.Add(ctx, 1, metricAttrs)
 	metrics.InferenceRequestsActive.Add(ctx, 1, metricAttrs)
 	defer metrics.InferenceRequestsActive.Add(ctx, -1, metricAttrs)
+	defer func() {
+		if respCode >= 500 {
+			metrics.InferenceRequestErrors.Add(ctx, 1, metricAttrs)
+		}
+	}()
 
-	modelExists, err := m.modelScaler.LookupModel(ctx, req.model, req.adapter, nil)
+	deprecation, err := m.modelScaler.LookupDeprecation(ctx, req.model)
 	if err != nil {
-		m.sendResponse(req, m.jsonError("error checking if model exists: %v", err), http.StatusInternalServerError)
-		return
+		return m.jsonError("error looking up model: %v", err), http.StatusInternalServerError
 	}
-	if !modelExists {
-		// Send a 400 response to the client, however it is possible the backend
-		// will be deployed soon or another subscriber will handle it.
-		m.sendResponse(req, m.jsonError("model not found: %s", req.model), http.StatusNotFound)
-		return
+	if deprecation != nil && deprecation.Deprecated {
+		// Responses of messages have no headers to flag the deprecation,
+		// the requests are only counted.
+		metrics.InferenceDeprecatedRequests.Add(ctx, 1, metricAttrs)
+	}
+
+	active, activeAt, err := m.modelScaler.LookupActive(ctx, req.model)
+	if err != nil {
+		return m.jsonError("error looking up model: %v", err), http.StatusInternalServerError
+	}
+	if !active {
+		return m.jsonError("%v: %s is outside of its active windows until %s",
+			modelproxy.ErrModelInactive, req.model, activeAt.UTC().Format(time.RFC3339)), http.StatusServiceUnavailable
 	}
 
-	// Ensure the backend is scaled to at least one Pod.
-	m.modelScaler.ScaleAtLeastOneReplica(ctx, req.model)
+	chatMessages, err := m.modelScaler.LookupChatMessageNormalization(ctx, req.model)
+	if err != nil {
+		return m.jsonError("error looking up model: %v", err), http.StatusInternalServerError
+	}
+	if apiutils.NormalizeChatMessages(req.params, chatMessages) {
+		body, err := json.Marshal(req.params)
+		if err != nil {
+			return m.jsonError("error encoding normalized request: %v", err), http.StatusInternalServerError
+		}
+		req.body = body
+	}
+
+	capabilities, err := m.modelScaler.LookupCapabilities(ctx, req.model)
+	if err != nil {
+		return m.jsonError("error looking up model: %v", err), http.StatusInternalServerError
+	}
+	if err := apiutils.CheckCapabilities(req.params, capabilities); err != nil {
+		return m.jsonError("%v", err), http.StatusBadRequest
+	}
 
-	log.Printf("Awaiting host for message %s", msg.LoggableID)
+	if req.path == "/v1/chat/completions" || req.path == "/v1/completions" {
+		policy, err := m.modelScaler.LookupSafetyPolicy(ctx, req.model)
+		if err != nil {
+			return m.jsonError("error looking up model: %v", err), http.StatusInternalServerError
+		}
+		if policy != nil {
+			if body, code, ok := m.moderate(ctx, req, policy, metricAttrs); !ok {
+				return body, code
+			}
+		}
+	}
 
-	host, completeFunc, err := m.resolver.AwaitBestAddress(ctx, req.model, req.adapter)
+	engine, args, err := m.modelScaler.LookupEngine(ctx, req.model)
 	if err != nil {
-		m.sendResponse(req, m.jsonError("error awaiting host for backend: %v", err), http.StatusBadGateway)
-		return
+		return m.jsonError("error looking up model: %v", err), http.StatusInternalServerError
 	}
-	defer completeFunc()
 
-	url := fmt.Sprintf("http://%s%s", host, req.path)
+	path := req.path
+	dialect := engines.LookupDialect(engine)
+	if dialect != nil {
+		var params map[string]interface{}
+		if path, params, err = engines.RewriteRequest(dialect, req.path, req.params); err != nil {
+			return m.jsonError("error rewriting request for engine %s: %v", engine, err), http.StatusBadRequest
+		}
+		body, err := json.Marshal(params)
+		if err != nil {
+			return m.jsonError("error encoding rewritten request: %v", err), http.StatusInternalServerError
+		}
+		req.body = body
+	}
+
+	httpc := m.HTTPC
+	var host string
+	if engine == kubeaiv1.EchoEngine {
+		// Echo Models are served in-process and never scaled.
+		h, err := echo.NewHandler(args)
+		if err != nil {
+			return m.jsonError("error configuring echo engine: %v", err), http.StatusInternalServerError
+		}
+		httpc, host = &http.Client{Transport: h}, echo.Host
+	} else {
+		// Ensure the backend is scaled to at least one Pod.
+		m.modelScaler.ScaleAtLeastOneReplica(ctx, req.model)
+
+		log.Printf("Awaiting host for message %s", msg.LoggableID)
+
+		usageCtx := endpoints.WithUsage(m.withEndpointPriority(ctx, req))
+		var completeFunc func()
+		host, completeFunc, err = m.resolver.AwaitBestAddress(usageCtx, req.model, req.adapter)
+		if err != nil {
+			if errors.Is(err, modelproxy.ErrNoCapacity) || errors.Is(err, modelproxy.ErrAdapterNotLoaded) {
+				// No model server was reached.
+				return m.jsonError("error awaiting host for backend: %v", err), http.StatusServiceUnavailable
+			}
+			return m.jsonError("error awaiting host for backend: %v", err), http.StatusBadGateway
+		}
+		defer func() {
+			// Runs after completeFunc() added the usage of the endpoint.
+			req.gpuSeconds = endpoints.GPUSeconds(usageCtx)
+			if req.gpuSeconds > 0 {
+				metrics.InferenceGPUSeconds.Add(ctx, req.gpuSeconds, metricAttrs)
+			}
+		}()
+		defer completeFunc()
+		debuglog.Printf(req.model, msg.LoggableID, "selected endpoint %s", host)
+	}
+
+	url := fmt.Sprintf("http://%s%s", host, path)
 	log.Printf("Sending request to backend for message %s: %s", msg.LoggableID, url)
-	respPayload, respCode, err := m.sendBackendRequest(ctx, url, req.body)
+	var respPayload []byte
+	if req.stream {
+		respPayload, respCode, err = m.streamBackendRequest(ctx, httpc, url, req)
+	} else {
+		start := time.Now()
+		respPayload, respCode, err = m.sendBackendRequest(ctx, httpc, url, req)
+		m.observeBackendRequest(time.Since(start), respCode, err)
+	}
 	if err != nil {
-		m.sendResponse(req, m.jsonError("error sending request to backend: %v", err), http.StatusBadGateway)
-		return
+		return m.jsonError("error sending request to backend: %v", err), http.StatusBadGateway
+	}
+	m.recordBackendResponse(req, respCode)
+	if dialect != nil && !req.stream && respCode >= 200 && respCode < 300 {
+		if respPayload, err = dialect.RewriteResponse(req.path, respPayload); err != nil {
+			return m.jsonError("error rewriting response of engine %s: %v", engine, err), http.StatusBadGateway
+		}
 	}
+	debuglog.Printf(req.model, msg.LoggableID, "received response from %s: %d", host, respCode)
 
-	m.sendResponse(req, respPayload, respCode)
+	return respPayload, respCode
+}
+
+// resolveModel resolves the alias of the requested model to the name of the
+// Model and returns an error response if there is no such Model.
+func (m *Messenger) resolveModel(ctx context.Context, req *request) (respBody []byte, respCode int, ok bool) {
+	model, modelExists, err := m.modelScaler.LookupModel(ctx, req.model, req.adapter, nil)
+	if err != nil {
+		return m.jsonError("error checking if model exists: %v", err), http.StatusInternalServerError, false
+	}
+	if !modelExists {
+		// Send a 400 response to the client, however it is possible the backend
+		// will be deployed soon or another subscriber will handle it.
+		return m.jsonError("%v: %s", modelproxy.ErrModelNotFound, req.model), http.StatusNotFound, false
+	}
+	if err := req.resolveAlias(model); err != nil {
+		return m.jsonError("error resolving model alias: %v", err), http.StatusInternalServerError, false
+	}
+	return nil, 0, true
+}
+
+// admit evaluates the admission policies for a request (with a resolved
+// model, see resolveModel()) and returns an error response if the request
+// is denied. Policies may mutate the body.
+func (m *Messenger) admit(ctx context.Context, req *request) (respBody []byte, respCode int, ok bool) {
+	if m.Admission == nil {
+		return nil, 0, true
+	}
+	decision := m.Admission.Admit(&admission.Request{
+		Model:          apiutils.MergeModelAdapter(req.model, req.adapter),
+		RequestedModel: req.requestedModel,
+		Path:           req.path,
+		Header:         req.metadataValue,
+		Params:         req.params,
+	})
+	if !decision.Allowed {
+		metrics.AdmissionDenials.Add(ctx, 1, metric.WithAttributes(metrics.AttrAdmissionRule.String(decision.Rule)))
+		return m.jsonError("%s", decision.Message), http.StatusForbidden, false
+	}
+	if decision.Mutated {
+		body, err := json.Marshal(req.params)
+		if err != nil {
+			return m.jsonError("error encoding mutated request: %v", err), http.StatusInternalServerError, false
+		}
+		req.body = body
+	}
+	return nil, 0, true
+}
+
+// moderate moderates a request with the safety policy of its Model in the
+// same way as the model proxy does. It returns an error response and false
+// if the request must not be sent to the model server.
+func (m *Messenger) moderate(ctx context.Context, req *request, policy *kubeaiv1.ModelSafetyPolicy, metricAttrs metric.MeasurementOption) (respBody []byte, respCode int, ok bool) {
+	if m.Moderator == nil {
+		if policy.FailOpen {
+			return nil, 0, true
+		}
+		return m.jsonError("unable to moderate request: no moderator configured"), http.StatusBadGateway, false
+	}
+	flagged, err := m.Moderator.Moderate(ctx, req.msg.LoggableID, policy, req.params)
+	if err != nil {
+		return m.jsonError("%v", err), http.StatusBadGateway, false
+	}
+	if flagged != "" {
+		metrics.ModerationFlagged.Add(ctx, 1, metricAttrs)
+		return m.jsonError("%s", flagged), http.StatusBadRequest, false
+	}
+	return nil, 0, true
+}
+
+// ActiveHandlers returns the number of request messages that are being
+// handled. After the context of Start() is done, it reports the progress of
+// finishing the messages.
+func (m *Messenger) ActiveHandlers() int {
+	sem := m.handlers.Load()
+	if sem == nil {
+		return 0
+	}
+	return sem.activeCount()
+}
+
+// WaitHandlers blocks until the request messages that are being handled
+// are finished or the context is done.
+func (m *Messenger) WaitHandlers(ctx context.Context) error {
+	sem := m.handlers.Load()
+	if sem == nil {
+		return nil
+	}
+	return sem.wait(ctx)
 }
 
 func (m *Messenger) Stop(ctx context.Context) error {
@@ -245,14 +811,58 @@ func (m *Messenger) Stop(ctx context.Context) error {
 }
 
 type request struct {
-	ctx            context.Context
-	msg            *pubsub.Message
-	metadata       map[string]interface{}
-	path           string
-	body           json.RawMessage
+	ctx      context.Context
+	msg      *pubsub.Message
+	metadata map[string]interface{}
+	path     string
+	body     json.RawMessage
+	// params is the decoded body.
+	params         map[string]interface{}
 	requestedModel string
 	model          string
 	adapter        string
+	// idempotencyKey is empty unless deduplication is enabled.
+	idempotencyKey string
+	// codec is set if the request message is not JSON. The response
+	// message is encoded using the same codec.
+	codec bodycodec.Codec
+	// encoding is the compression of the request message (empty if it is
+	// not compressed).
+	encoding string
+	// batch is nil unless the message is a batch request message.
+	batch []json.RawMessage
+	// stream is true if the response should be published incrementally.
+	stream bool
+	// version is the protocol version of the request message or 0 if the
+	// message has no version (i.e. a version 1 message of a producer that
+	// predates versioning). Response messages have the same version.
+	version int
+	// responses is the topic (with the URL responsesURL) that the responses
+	// of the request are published to if it is not the responses topic of
+	// the stream.
+	responses    *pubsub.Topic
+	responsesURL string
+	// admitted is true if the admission policies were already evaluated
+	// (i.e. before the request was coalesced with other requests).
+	admitted bool
+	// priority is the priority class of the request (an index of
+	// priorities.classes). It is 0 unless priorities are configured.
+	priority int
+	// sequence is the sequence number of the next streamed message.
+	sequence int
+	// indexedAt is the time that the request was first recorded in
+	// the request index.
+	indexedAt time.Time
+	// gpuSeconds is the approximate GPU time that was used by the request
+	// (see endpoints.GPUSeconds).
+	gpuSeconds float64
+}
+
+// metadataValue returns the string value of the given metadata key
+// or an empty string if it is not set.
+func (r *request) metadataValue(key string) string {
+	v, _ := r.metadata[key].(string)
+	return v
 }
 
 func parseRequest(ctx context.Context, msg *pubsub.Message) (*request, error) {
@@ -261,12 +871,39 @@ func parseRequest(ctx context.Context, msg *pubsub.Message) (*request, error) {
 		msg: msg,
 	}
 
+	msgBody := msg.Body
+	if encoding := msg.Metadata[contentEncodingMetadataKey]; encoding != "" {
+		decompressed, err := decompress(encoding, msg.Body)
+		if err != nil {
+			return req, fmt.Errorf("decompressing message: %w", err)
+		}
+		if encoding != "identity" {
+			req.encoding = encoding
+		}
+		msgBody = decompressed
+	}
+	if codec, ok := bodycodec.Lookup(msg.Metadata[contentTypeMetadataKey]); ok {
+		req.codec = codec
+		jsonBody, err := bodycodec.ToJSON(codec, msgBody)
+		if err != nil {
+			return req, fmt.Errorf("converting message to json: %w", err)
+		}
+		msgBody = jsonBody
+	}
+
+	if err := validateMessage(msgBody); err != nil {
+		return req, err
+	}
+
 	var payload struct {
+		Version  int                    `json:"version"`
 		Metadata map[string]interface{} `json:"metadata"`
 		Path     string                 `json:"path"`
 		Body     json.RawMessage        `json:"body"`
+		Batch    []json.RawMessage      `json:"batch"`
+		Stream   bool                   `json:"stream"`
 	}
-	if err := json.Unmarshal(msg.Body, &payload); err != nil {
+	if err := json.Unmarshal(msgBody, &payload); err != nil {
 		return req, fmt.Errorf("unmarshalling message as json: %w", err)
 	}
 
@@ -277,26 +914,51 @@ func parseRequest(ctx context.Context, msg *pubsub.Message) (*request, error) {
 	} else if !strings.HasPrefix(payload.Path, "/") {
 		path = "/" + payload.Path
 	}
+	if path == apiutils.SpeechPath {
+		// Response bodies are embedded in JSON response messages.
+		return req, fmt.Errorf("path %s is not supported over messaging (binary response)", path)
+	}
 
+	req.version = payload.Version
 	req.metadata = payload.Metadata
 	req.path = path
-	req.body = payload.Body
+	req.stream = payload.Stream
+
+	if payload.Batch != nil {
+		if len(payload.Batch) == 0 {
+			return req, fmt.Errorf("empty '.batch' field")
+		}
+		req.batch = payload.Batch
+		return req, nil
+	}
+
+	if err := req.setBody(payload.Body); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// setBody sets the body that is sent to the model server and the
+// model that is requested in the body.
+func (req *request) setBody(body json.RawMessage) error {
+	req.body = body
 
 	var payloadBody map[string]interface{}
-	if err := json.Unmarshal(payload.Body, &payloadBody); err != nil {
-		return nil, fmt.Errorf("decoding: %w", err)
+	if err := json.Unmarshal(body, &payloadBody); err != nil {
+		return fmt.Errorf("decoding: %w", err)
 	}
 	modelInf, ok := payloadBody["model"]
 	if !ok {
-		return nil, fmt.Errorf("missing '.body.model' field")
+		return fmt.Errorf("missing '.body.model' field")
 	}
 	modelStr, ok := modelInf.(string)
 	if !ok {
-		return nil, fmt.Errorf("field '.body.model' should be a string")
+		return fmt.Errorf("field '.body.model' should be a string")
 	}
 
 	req.requestedModel = modelStr
 	req.model, req.adapter = apiutils.SplitModelAdapter(modelStr)
+	req.params = payloadBody
 
 	// Assuming this is a vLLM request.
 	// vLLM expects the adapter to be in the model field.
@@ -304,24 +966,47 @@ func parseRequest(ctx context.Context, msg *pubsub.Message) (*request, error) {
 		payloadBody["model"] = req.adapter
 		rewrittenBody, err := json.Marshal(payloadBody)
 		if err != nil {
-			return nil, fmt.Errorf("remarshalling: %w", err)
+			return fmt.Errorf("remarshalling: %w", err)
 		}
 		req.body = rewrittenBody
 	}
 
-	return req, nil
+	return nil
+}
+
+// resolveAlias replaces the requested model with the Model that it is an
+// alias of, both in the request and in the body that is sent to the model
+// server (which only serves the model by the name of the Model).
+func (req *request) resolveAlias(model string) error {
+	if model == req.model {
+		return nil
+	}
+	req.model = model
+	if req.adapter != "" {
+		// vLLM expects the adapter in the model field.
+		return nil
+	}
+	req.params["model"] = model
+	body, err := json.Marshal(req.params)
+	if err != nil {
+		return fmt.Errorf("remarshalling: %w", err)
+	}
+	req.body = body
+	return nil
 }
 
-func (m *Messenger) sendBackendRequest(ctx context.Context, url string, body []byte) ([]byte, int, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+func (m *Messenger) sendBackendRequest(ctx context.Context, httpc *http.Client, url string, req *request) ([]byte, int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req.body))
 	if err != nil {
 		return nil, 0, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+	m.forwardMetadata(httpReq.Header, req)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	injectTraceContext(ctx, httpReq.Header)
 
-	resp, err := m.HTTPC.Do(req)
+	resp, err := httpc.Do(httpReq)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -336,45 +1021,212 @@ func (m *Messenger) sendBackendRequest(ctx context.Context, url string, body []b
 }
 
 func (m *Messenger) sendResponse(req *request, body []byte, statusCode int) {
+	jsonResponse, err := m.publishResponse(req, body, statusCode)
+	if err != nil {
+		log.Printf("Error sending response for message %s: %v", req.msg.LoggableID, err)
+		m.addConsecutiveError()
+
+		// If a response cant be sent, the message should be redelivered.
+		m.nack(req.msg, err)
+		return
+	}
+
+	log.Printf("Send response for message: %s", req.msg.LoggableID)
+	m.indexRequest(req, resultStatus(statusCode), statusCode, nil)
+	if req.idempotencyKey != "" {
+		m.journal.put(req.idempotencyKey, jsonResponse)
+	}
+	if statusCode < 300 {
+		m.resetConsecutiveErrors()
+	}
+	m.attempts.remove(req.msg.LoggableID)
+	m.ack(req.msg)
+}
+
+// publishResponse publishes a response message to the responses topic
+// and returns the published message body.
+func (m *Messenger) publishResponse(req *request, body []byte, statusCode int) ([]byte, error) {
 	log.Printf("Sending response to message: %v", req.msg.LoggableID)
 
 	response := struct {
+		Version    int                    `json:"version,omitempty"`
 		Metadata   map[string]interface{} `json:"metadata"`
 		StatusCode int                    `json:"status_code"`
 		Body       json.RawMessage        `json:"body"`
+		// BodyURL is set instead of Body if the body was written
+		// to the overflow bucket.
+		BodyURL string `json:"body_url,omitempty"`
+		// Sequence and Done terminate streamed responses.
+		Sequence *int `json:"sequence,omitempty"`
+		Done     bool `json:"done,omitempty"`
 	}{
+		Version:    req.version,
 		Metadata:   req.metadata,
 		StatusCode: statusCode,
 		Body:       body,
 	}
+	md := m.responseMetadata(req)
+	if req.stream {
+		response.Sequence = &req.sequence
+		response.Done = true
+		md[messageTypeMetadataKey] = messageTypeStreamDone
+	}
 
-	jsonResponse, err := json.Marshal(response)
-	if err != nil {
-		log.Println("Error marshalling response:", err)
-		m.addConsecutiveError()
+	encode := func() []byte {
+		jsonResponse, err := json.Marshal(response)
+		if err != nil {
+			log.Println("Error marshalling response:", err)
+			m.addConsecutiveError()
+		}
+		if req.codec != nil {
+			jsonResponse, err = bodycodec.FromJSON(req.codec, jsonResponse)
+			if err != nil {
+				log.Printf("Error converting response to %s: %v", req.codec.MediaType(), err)
+				m.addConsecutiveError()
+			}
+		}
+		return jsonResponse
+	}
+	jsonResponse := encode()
+	msgBody := m.compressResponse(req, jsonResponse, md)
+	if m.overflow != nil && len(msgBody) > m.overflow.maxMessageBytes {
+		bodyURL, err := m.overflow.write(req.ctx, overflowKey(req), body)
+		if err != nil {
+			return nil, fmt.Errorf("writing response body to overflow bucket: %w", err)
+		}
+		metrics.MessengerOverflowed.Add(req.ctx, 1, metric.WithAttributeSet(attribute.NewSet(
+			metrics.AttrMessengerStream.String(m.stream),
+		)))
+		response.Body = nil
+		response.BodyURL = bodyURL
+		jsonResponse = encode()
+		msgBody = m.compressResponse(req, jsonResponse, md)
 	}
 
-	if err := m.responses.Send(req.ctx, &pubsub.Message{
-		Body: jsonResponse,
-		Metadata: map[string]string{
-			"request_message_id": req.msg.LoggableID,
-		},
+	if err := m.responsesTopic(req).Send(req.ctx, &pubsub.Message{
+		Body:     msgBody,
+		Metadata: md,
 	}); err != nil {
-		log.Printf("Error sending response for message %s: %v", req.msg.LoggableID, err)
-		m.addConsecutiveError()
+		return nil, err
+	}
+	return jsonResponse, nil
+}
 
-		// If a response cant be sent, the message should be redelivered.
-		if req.msg.Nackable() {
-			req.msg.Nack()
-		}
+// requestIdempotencyKey returns the key that identifies redeliveries of
+// the request or an empty string if the request should not be deduplicated.
+// The IDs of messages are not used: they are only meant for logging and
+// not unique for all messaging providers.
+func (m *Messenger) requestIdempotencyKey(req *request) string {
+	return req.metadataValue(m.idempotencyKey)
+}
+
+// resendResponse publishes the previously published response of a
+// redelivered request without running inference again.
+func (m *Messenger) resendResponse(req *request, jsonResponse []byte) {
+	log.Printf("Resending previous response to redelivered message: %v", req.msg.LoggableID)
+
+	md := m.responseMetadata(req)
+	if err := m.responsesTopic(req).Send(req.ctx, &pubsub.Message{
+		Body:     m.compressResponse(req, jsonResponse, md),
+		Metadata: md,
+	}); err != nil {
+		log.Printf("Error resending response for message %s: %v", req.msg.LoggableID, err)
+		m.nack(req.msg, err)
 		return
 	}
 
-	log.Printf("Send response for message: %s", req.msg.LoggableID)
+	metrics.MessengerDuplicateRequests.Add(req.ctx, 1, metric.WithAttributeSet(attribute.NewSet(
+		metrics.AttrRequestModel.String(req.model),
+		metrics.AttrMessengerStream.String(m.stream),
+	)))
+	m.ack(req.msg)
+}
+
+// indexRequest records the status of a request message in the request index
+// (if enabled). Failures are logged because the index is informational.
+func (m *Messenger) indexRequest(req *request, status requestindex.Status, statusCode int, batch *requestindex.BatchStatus) {
+	if m.RequestIndex == nil || req == nil || req.msg.LoggableID == "" {
+		return
+	}
+	if req.indexedAt.IsZero() {
+		req.indexedAt = time.Now()
+	}
+	metadata := map[string]string{}
+	for k, v := range req.metadata {
+		if s, ok := v.(string); ok {
+			metadata[k] = s
+		}
+	}
+	if err := m.RequestIndex.Put(req.ctx, &requestindex.Record{
+		ID:         req.msg.LoggableID,
+		Stream:     m.stream,
+		Model:      req.requestedModel,
+		Path:       req.path,
+		Status:     status,
+		StatusCode: statusCode,
+		Metadata:   metadata,
+		ResultURL:  m.responsesTopicURL(req),
+		Batch:      batch,
+		GPUSeconds: req.gpuSeconds,
+		CreatedAt:  req.indexedAt,
+	}); err != nil {
+		log.Printf("Error indexing message %s: %v", req.msg.LoggableID, err)
+	}
+}
+
+// resultStatus returns the indexed status of a request
+// with the given response status code.
+func resultStatus(statusCode int) requestindex.Status {
 	if statusCode < 300 {
-		m.resetConsecutiveErrors()
+		return requestindex.StatusSucceeded
+	}
+	return requestindex.StatusFailed
+}
+
+// contentTypeMetadataKey is the message metadata key that specifies the
+// encoding of request and response messages (JSON if not set).
+const contentTypeMetadataKey = "content-type"
+
+// forwardMetadata sets the headers of the request metadata that is
+// forwarded to model servers. Values that are not strings are JSON-encoded.
+func (m *Messenger) forwardMetadata(header http.Header, req *request) {
+	for _, f := range m.forwardedMetadata {
+		v, ok := requestMetadata(req, f.Key)
+		if !ok {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			b, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			s = string(b)
+		}
+		if strings.ContainsAny(s, "\r\n\x00") {
+			log.Printf("Not forwarding %q metadata of message %s: invalid header value", f.Key, req.msg.LoggableID)
+			continue
+		}
+		header.Set(f.Header, s)
 	}
-	req.msg.Ack()
+}
+
+func (m *Messenger) responseMetadata(req *request) map[string]string {
+	md := map[string]string{
+		"request_message_id": req.msg.LoggableID,
+	}
+	if req.codec != nil {
+		md[contentTypeMetadataKey] = req.codec.MediaType()
+	}
+	injectMessageTraceContext(req, md)
+	// Responses keep the key of the request (i.e. a session ID) so that
+	// they can be partitioned by it.
+	if k := m.transport.Kafka; k != nil && k.KeyName != "" {
+		if v, ok := req.msg.Metadata[k.KeyName]; ok {
+			md[k.KeyName] = v
+		}
+	}
+	return md
 }
 
 func (m *Messenger) jsonError(format string, args ...interface{}) []byte {
@@ -404,12 +1256,16 @@ func (m *Messenger) addConsecutiveError() {
 	m.consecutiveErrorsMtx.Lock()
 	defer m.consecutiveErrorsMtx.Unlock()
 	m.consecutiveErrors++
+	m.recordConsecutiveErrors(m.consecutiveErrors)
 }
 
 func (m *Messenger) resetConsecutiveErrors() {
 	m.consecutiveErrorsMtx.Lock()
 	defer m.consecutiveErrorsMtx.Unlock()
-	m.consecutiveErrors = 0
+	if m.consecutiveErrors > 0 {
+		m.consecutiveErrors = 0
+		m.recordConsecutiveErrors(0)
+	}
 }
 
 func (m *Messenger) getConsecutiveErrors() int {
@@ -0,0 +1,391 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/bodycodec"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/modelproxy"
+	"github.com/substratusai/kubeai/internal/requestindex"
+	"gocloud.dev/pubsub"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+func TestHandleMsgPackRequest(t *testing.T) {
+	ctx := context.Background()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		// Model servers should receive JSON.
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.JSONEq(t, `{"model":"test-model","input":"hello"}`, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"embedding":[0.5,-0.25]}]}`))
+	}))
+	defer backend.Close()
+
+	requestsTopic, err := pubsub.OpenTopic(ctx, "mem://codec-test-requests")
+	require.NoError(t, err)
+	defer requestsTopic.Shutdown(ctx)
+	requests, err := pubsub.OpenSubscription(ctx, "mem://codec-test-requests")
+	require.NoError(t, err)
+	defer requests.Shutdown(ctx)
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://codec-test-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	responses, err := pubsub.OpenSubscription(ctx, "mem://codec-test-responses")
+	require.NoError(t, err)
+	defer responses.Shutdown(ctx)
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	index := &testIndex{}
+	m := &Messenger{
+		modelScaler:  fake,
+		resolver:     fake,
+		HTTPC:        http.DefaultClient,
+		RequestIndex: index,
+		stream:       "0",
+		responses:    responsesTopic,
+		responsesURL: "mem://codec-test-responses",
+		modelMix:     newModelMix(10),
+	}
+
+	body, err := bodycodec.FromJSON(bodycodec.MsgPack{}, []byte(`{
+	"metadata": {"id": "abc"},
+	"path": "/v1/embeddings",
+	"body": {"model": "test-model", "input": "hello"}
+}`))
+	require.NoError(t, err)
+	require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{
+		Body:     body,
+		Metadata: map[string]string{"content-type": "application/msgpack"},
+	}))
+	msg, err := requests.Receive(ctx)
+	require.NoError(t, err)
+	m.handleRequest(ctx, msg)
+
+	resp, err := responses.Receive(ctx)
+	require.NoError(t, err)
+	resp.Ack()
+	require.Equal(t, "application/msgpack", resp.Metadata["content-type"])
+	jsonResp, err := bodycodec.ToJSON(bodycodec.MsgPack{}, resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+	"metadata": {"id": "abc"},
+	"status_code": 200,
+	"body": {"data": [{"embedding": [0.5, -0.25]}]}
+}`, string(jsonResp))
+
+	// The request is indexed when it is received and when the response is published.
+	require.Len(t, index.records, 2)
+	require.Equal(t, requestindex.StatusRunning, index.records[0].Status)
+	last := index.records[1]
+	require.Equal(t, msg.LoggableID, last.ID)
+	require.Equal(t, requestindex.StatusSucceeded, last.Status)
+	require.Equal(t, http.StatusOK, last.StatusCode)
+	require.Equal(t, "0", last.Stream)
+	require.Equal(t, "test-model", last.Model)
+	require.Equal(t, "/v1/embeddings", last.Path)
+	require.Equal(t, map[string]string{"id": "abc"}, last.Metadata)
+	require.Equal(t, "mem://codec-test-responses", last.ResultURL)
+	require.Equal(t, index.records[0].CreatedAt, last.CreatedAt)
+}
+
+func TestInferErrors(t *testing.T) {
+	ctx := context.Background()
+	fake := &testModels{}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		modelMix:    newModelMix(10),
+	}
+
+	body, code := m.infer(ctx, &request{ctx: ctx, msg: &pubsub.Message{}, model: "does-not-exist"})
+	require.Equal(t, http.StatusNotFound, code)
+	require.Contains(t, string(body), "model not found: does-not-exist")
+
+	fake.awaitErr = fmt.Errorf("%w: %w", modelproxy.ErrNoCapacity, context.DeadlineExceeded)
+	_, code = m.infer(ctx, &request{ctx: ctx, msg: &pubsub.Message{}, model: "test-model"})
+	require.Equal(t, http.StatusServiceUnavailable, code)
+
+	fake.awaitErr = errors.New("other")
+	_, code = m.infer(ctx, &request{ctx: ctx, msg: &pubsub.Message{}, model: "test-model"})
+	require.Equal(t, http.StatusBadGateway, code)
+}
+
+func TestInferEcho(t *testing.T) {
+	ctx := context.Background()
+	// Echo Models are served without resolving an endpoint.
+	fake := &testModels{engine: kubeaiv1.EchoEngine, awaitErr: errors.New("should not be called")}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		modelMix:    newModelMix(10),
+	}
+
+	body, code := m.infer(ctx, &request{
+		ctx:   ctx,
+		msg:   &pubsub.Message{},
+		model: "test-model",
+		path:  "/v1/chat/completions",
+		body:  []byte(`{"model":"test-model","messages":[{"role":"user","content":"hello"}]}`),
+	})
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, string(body), `"content":"hello"`)
+}
+
+type testModerator struct {
+	err error
+}
+
+func (t *testModerator) Moderate(ctx context.Context, id string, policy *kubeaiv1.ModelSafetyPolicy, params map[string]any) (string, error) {
+	if t.err != nil {
+		return "", t.err
+	}
+	if text, _ := apiutils.ModerationText(params); strings.Contains(text, "unsafe") {
+		return "flagged", nil
+	}
+	return "", nil
+}
+
+func TestInferModeration(t *testing.T) {
+	ctx := context.Background()
+	fake := &testModels{engine: kubeaiv1.EchoEngine, safetyPolicy: &kubeaiv1.ModelSafetyPolicy{}}
+	moderator := &testModerator{}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		modelMix:    newModelMix(10),
+		Moderator:   moderator,
+	}
+	infer := func(content string) ([]byte, int) {
+		req := &request{
+			ctx:      ctx,
+			msg:      &pubsub.Message{},
+			model:    "test-model",
+			path:     "/v1/chat/completions",
+			metadata: map[string]any{"X-Team": "a", "attempt": 1.0},
+			params:   map[string]any{"model": "test-model", "messages": []any{map[string]any{"role": "user", "content": content}}},
+		}
+		req.body, _ = json.Marshal(req.params)
+		return m.infer(ctx, req)
+	}
+
+	_, code := infer("hello")
+	require.Equal(t, http.StatusOK, code)
+
+	body, code := infer("unsafe")
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, string(body), "flagged")
+
+	moderator.err = errors.New("unable to moderate request: unavailable")
+	_, code = infer("hello")
+	require.Equal(t, http.StatusBadGateway, code)
+
+	// Requests are not sent without moderation unless the policy fails open.
+	m.Moderator = nil
+	_, code = infer("hello")
+	require.Equal(t, http.StatusBadGateway, code)
+	fake.safetyPolicy.FailOpen = true
+	_, code = infer("hello")
+	require.Equal(t, http.StatusOK, code)
+}
+
+func TestForwardMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	headers := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer backend.Close()
+
+	requestsTopic, err := pubsub.OpenTopic(ctx, "mem://forward-test-requests")
+	require.NoError(t, err)
+	defer requestsTopic.Shutdown(ctx)
+	requests, err := pubsub.OpenSubscription(ctx, "mem://forward-test-requests")
+	require.NoError(t, err)
+	defer requests.Shutdown(ctx)
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://forward-test-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	responses, err := pubsub.OpenSubscription(ctx, "mem://forward-test-responses")
+	require.NoError(t, err)
+	defer responses.Shutdown(ctx)
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		HTTPC:       http.DefaultClient,
+		stream:      "0",
+		responses:   responsesTopic,
+		modelMix:    newModelMix(10),
+		forwardedMetadata: []config.ForwardedMetadata{
+			{Key: "trace_id", Header: "X-Trace-Id"},
+			{Key: "user", Header: "user"},
+			{Key: "attempt", Header: "X-Attempt"},
+			{Key: "tenant", Header: "X-Tenant"},
+			{Key: "missing", Header: "X-Missing"},
+			{Key: "format", Header: "Content-Type"},
+		},
+	}
+
+	require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{
+		Body:     []byte(`{"metadata":{"trace_id":"abc","user":"jane","attempt":2,"secret":"s","format":"text/plain"},"body":{"model":"test-model"}}`),
+		Metadata: map[string]string{"tenant": "team-a"},
+	}))
+	msg, err := requests.Receive(ctx)
+	require.NoError(t, err)
+	m.handleRequest(ctx, msg)
+
+	h := <-headers
+	require.Equal(t, "abc", h.Get("X-Trace-Id"))
+	require.Equal(t, "jane", h.Get("User"))
+	require.Equal(t, "2", h.Get("X-Attempt"))
+	require.Equal(t, "team-a", h.Get("X-Tenant"))
+	require.NotContains(t, h, "X-Missing")
+	require.NotContains(t, h, "Secret")
+	// Forwarded metadata does not override the headers of the proxy.
+	require.Equal(t, "application/json", h.Get("Content-Type"))
+
+	resp, err := responses.Receive(ctx)
+	require.NoError(t, err)
+	resp.Ack()
+}
+
+func TestStartWaitsForHandlers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan struct{})
+	unblock := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-unblock
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer backend.Close()
+
+	requestsTopic, err := pubsub.OpenTopic(ctx, "mem://start-wait-test-requests")
+	require.NoError(t, err)
+	defer requestsTopic.Shutdown(context.Background())
+	requests, err := pubsub.OpenSubscription(ctx, "mem://start-wait-test-requests")
+	require.NoError(t, err)
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://start-wait-test-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(context.Background())
+	responses, err := pubsub.OpenSubscription(ctx, "mem://start-wait-test-responses")
+	require.NoError(t, err)
+	defer responses.Shutdown(context.Background())
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		HTTPC:       http.DefaultClient,
+		MaxHandlers: 1,
+		stream:      "0",
+		requests:    requests,
+		responses:   responsesTopic,
+		modelMix:    newModelMix(10),
+	}
+	started := make(chan error)
+	go func() { started <- m.Start(ctx) }()
+
+	require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{
+		Body: []byte(`{"metadata":{"id":"a"},"body":{"model":"test-model"}}`),
+	}))
+	<-received
+	cancel()
+	select {
+	case err := <-started:
+		close(unblock)
+		t.Fatalf("Start returned while a message was being handled: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(unblock)
+	require.ErrorIs(t, <-started, context.Canceled)
+	resp, err := responses.Receive(context.Background())
+	require.NoError(t, err)
+	resp.Ack()
+}
+
+// testIndex records every indexed request.
+type testIndex struct {
+	mtx     sync.Mutex
+	records []requestindex.Record
+}
+
+func (t *testIndex) Put(ctx context.Context, r *requestindex.Record) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.records = append(t.records, *r)
+	return nil
+}
+
+type testModels struct {
+	address string
+	// awaitErr is returned by AwaitBestAddress if set.
+	awaitErr     error
+	chatMessages *kubeaiv1.ChatMessageNormalization
+	engine       string
+	safetyPolicy *kubeaiv1.ModelSafetyPolicy
+}
+
+func (t *testModels) LookupModel(ctx context.Context, model, adapter string, selectors []string) (string, bool, error) {
+	return model, model == "test-model", nil
+}
+
+func (t *testModels) LookupChatMessageNormalization(ctx context.Context, model string) (*kubeaiv1.ChatMessageNormalization, error) {
+	return t.chatMessages, nil
+}
+
+func (t *testModels) LookupCapabilities(ctx context.Context, model string) (*kubeaiv1.ModelStatusCapabilities, error) {
+	return nil, nil
+}
+
+func (t *testModels) LookupDeprecation(ctx context.Context, model string) (*kubeaiv1.ModelDeprecation, error) {
+	return nil, nil
+}
+
+func (t *testModels) LookupActive(ctx context.Context, model string) (bool, time.Time, error) {
+	return true, time.Time{}, nil
+}
+
+func (t *testModels) LookupEngine(ctx context.Context, model string) (string, []string, error) {
+	return t.engine, nil, nil
+}
+
+func (t *testModels) LookupSafetyPolicy(ctx context.Context, model string) (*kubeaiv1.ModelSafetyPolicy, error) {
+	return t.safetyPolicy, nil
+}
+
+func (t *testModels) ScaleAtLeastOneReplica(ctx context.Context, model string) error {
+	return nil
+}
+
+func (t *testModels) AwaitBestAddress(ctx context.Context, model, adapter string) (string, func(), error) {
+	if t.awaitErr != nil {
+		return "", func() {}, t.awaitErr
+	}
+	return t.address, func() {}, nil
+}
@@ -0,0 +1,60 @@
+package messenger
+
+import (
+	"context"
+	"time"
+
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"gocloud.dev/pubsub"
+)
+
+func (m *Messenger) streamAttrs(attrs ...attribute.KeyValue) metric.MeasurementOption {
+	return metric.WithAttributeSet(attribute.NewSet(append(attrs, metrics.AttrMessengerStream.String(m.stream))...))
+}
+
+// recordReceived records a received request message and its age.
+func (m *Messenger) recordReceived(msg *pubsub.Message) {
+	ctx := context.Background()
+	metrics.MessengerReceived.Add(ctx, 1, m.streamAttrs())
+	if published, ok := publishTime(msg); ok {
+		metrics.MessengerBacklogAge.Record(ctx, time.Since(published).Seconds(), m.streamAttrs())
+	}
+}
+
+// ack acknowledges a request message.
+func (m *Messenger) ack(msg *pubsub.Message) {
+	msg.Ack()
+	metrics.MessengerAcked.Add(context.Background(), 1, m.streamAttrs())
+}
+
+// redeliver returns a request message to the messaging system for
+// redelivery (if the messaging system supports it). Unlike nack(), it is
+// not counted as a failed attempt.
+func (m *Messenger) redeliver(msg *pubsub.Message) {
+	if !msg.Nackable() {
+		return
+	}
+	msg.Nack()
+	metrics.MessengerNacked.Add(context.Background(), 1, m.streamAttrs())
+}
+
+// recordHandled records the time taken to handle a request message.
+func (m *Messenger) recordHandled(start time.Time, statusCode int) {
+	metrics.MessengerHandlerDuration.Record(context.Background(), time.Since(start).Seconds(), m.streamAttrs(
+		metrics.AttrResponseStatusCode.Int(statusCode),
+	))
+}
+
+// recordBackendResponse records the status code of a model server response.
+func (m *Messenger) recordBackendResponse(req *request, statusCode int) {
+	metrics.MessengerBackendResponses.Add(context.Background(), 1, m.streamAttrs(
+		metrics.AttrRequestModel.String(req.model),
+		metrics.AttrResponseStatusCode.Int(statusCode),
+	))
+}
+
+func (m *Messenger) recordConsecutiveErrors(n int) {
+	metrics.MessengerConsecutiveErrors.Record(context.Background(), int64(n), m.streamAttrs())
+}
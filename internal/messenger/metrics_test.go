@@ -0,0 +1,81 @@
+package messenger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"github.com/substratusai/kubeai/internal/metrics/metricstest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"gocloud.dev/pubsub"
+)
+
+func TestMessageMetrics(t *testing.T) {
+	metricstest.Init(t)
+	ctx := context.Background()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+
+	requestsTopic, err := pubsub.OpenTopic(ctx, "mem://metrics-test-requests")
+	require.NoError(t, err)
+	defer requestsTopic.Shutdown(ctx)
+	requests, err := pubsub.OpenSubscription(ctx, "mem://metrics-test-requests")
+	require.NoError(t, err)
+	defer requests.Shutdown(ctx)
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://metrics-test-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		HTTPC:       http.DefaultClient,
+		stream:      "0",
+		responses:   responsesTopic,
+		modelMix:    newModelMix(10),
+	}
+
+	for _, body := range []string{`{"body":{"model":"test-model"}}`, `not json`} {
+		require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{Body: []byte(body)}))
+		msg, err := requests.Receive(ctx)
+		require.NoError(t, err)
+		m.recordReceived(msg)
+		m.handleRequest(ctx, msg)
+	}
+
+	mets := metricstest.Collect(t)
+	stream := metrics.AttrMessengerStream.String("0")
+	metricstest.RequireCounterMetric(t, mets, metrics.MessengerReceivedMetricName, attribute.NewSet(stream), 2)
+	metricstest.RequireCounterMetric(t, mets, metrics.MessengerAckedMetricName, attribute.NewSet(stream), 2)
+	metricstest.RequireCounterMetric(t, mets, metrics.MessengerBackendResponsesMetricName, attribute.NewSet(
+		stream,
+		metrics.AttrRequestModel.String("test-model"),
+		metrics.AttrResponseStatusCode.Int(http.StatusTooManyRequests),
+	), 1)
+
+	var codes []int64
+	for _, sm := range mets.ScopeMetrics {
+		for _, met := range sm.Metrics {
+			if met.Name != metrics.MessengerHandlerDurationMetricName {
+				continue
+			}
+			for _, dp := range met.Data.(metricdata.Histogram[float64]).DataPoints {
+				code, _ := dp.Attributes.Value(metrics.AttrResponseStatusCode)
+				codes = append(codes, code.AsInt64())
+				require.EqualValues(t, 1, dp.Count)
+			}
+		}
+	}
+	require.ElementsMatch(t, []int64{http.StatusTooManyRequests, http.StatusBadRequest}, codes)
+}
@@ -0,0 +1,64 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/google/uuid"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/blob"
+)
+
+// overflowBucket stores response bodies that would make response messages
+// larger than the messaging provider allows.
+type overflowBucket struct {
+	bucket *blob.Bucket
+	url    *url.URL
+	// maxMessageBytes is the size of the largest response message
+	// that is published with its body.
+	maxMessageBytes int
+}
+
+func openOverflowBucket(ctx context.Context, cfg *config.MessageOverflow) (*overflowBucket, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing overflow url: %w", err)
+	}
+	bucket, err := blob.OpenBucket(ctx, cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("opening overflow bucket: %w", err)
+	}
+	return &overflowBucket{bucket: bucket, url: u, maxMessageBytes: cfg.MaxMessageBytes}, nil
+}
+
+// write stores a response body under the given key and returns its URL.
+func (o *overflowBucket) write(ctx context.Context, key string, body []byte) (string, error) {
+	if err := o.bucket.WriteAll(ctx, key, body, &blob.WriterOptions{
+		ContentType: "application/json",
+	}); err != nil {
+		return "", err
+	}
+	return o.objectURL(key), nil
+}
+
+// objectURL returns the URL of an object in the bucket, i.e.
+// "gs://my-bucket/responses/abc" for the key "abc" in the bucket
+// "gs://my-bucket?prefix=responses/".
+func (o *overflowBucket) objectURL(key string) string {
+	u := *o.url
+	q := u.Query()
+	key = q.Get("prefix") + key
+	q.Del("prefix")
+	u.RawQuery = q.Encode()
+	u.Path = path.Join("/", u.Path, key)
+	return u.String()
+}
+
+// overflowKey returns a new key for an overflowed response body. Message IDs
+// are not unique across providers (or redeliveries) and may contain
+// characters that are not valid in object keys.
+func overflowKey(*request) string {
+	return uuid.NewString()
+}
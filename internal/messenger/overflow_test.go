@@ -0,0 +1,87 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	_ "gocloud.dev/blob/memblob"
+	"gocloud.dev/pubsub"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+func TestOverflowObjectURL(t *testing.T) {
+	cases := map[string]string{
+		"gs://my-bucket":                    "gs://my-bucket/abc",
+		"gs://my-bucket?prefix=responses/":  "gs://my-bucket/responses/abc",
+		"file:///data/responses":            "file:///data/responses/abc",
+		"file:///data?prefix=responses/&x=": "file:///data/responses/abc?x=",
+	}
+	for bucketURL, exp := range cases {
+		u, err := url.Parse(bucketURL)
+		require.NoError(t, err)
+		o := &overflowBucket{url: u}
+		require.Equal(t, exp, o.objectURL("abc"), bucketURL)
+	}
+}
+
+func TestPublishOverflowedResponse(t *testing.T) {
+	ctx := context.Background()
+
+	topic, err := pubsub.OpenTopic(ctx, "mem://overflow-test-responses")
+	require.NoError(t, err)
+	defer topic.Shutdown(ctx)
+	responses, err := pubsub.OpenSubscription(ctx, "mem://overflow-test-responses")
+	require.NoError(t, err)
+	defer responses.Shutdown(ctx)
+
+	bucket, err := openOverflowBucket(ctx, &config.MessageOverflow{URL: "mem://", MaxMessageBytes: 100})
+	require.NoError(t, err)
+	defer bucket.bucket.Close()
+
+	m := &Messenger{responses: topic, overflow: bucket}
+	req := &request{
+		ctx:      ctx,
+		msg:      &pubsub.Message{LoggableID: "msg-1"},
+		metadata: map[string]interface{}{"id": "abc"},
+	}
+
+	receive := func() map[string]interface{} {
+		receiveCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		msg, err := responses.Receive(receiveCtx)
+		require.NoError(t, err)
+		msg.Ack()
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(msg.Body, &body))
+		return body
+	}
+
+	// Small bodies are published in the response message.
+	_, err = m.publishResponse(req, []byte(`{"result":"ok"}`), 200)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"result": "ok"}, receive()["body"])
+
+	// Large bodies are written to the bucket.
+	large := []byte(`{"result":"` + strings.Repeat("x", 200) + `"}`)
+	_, err = m.publishResponse(req, large, 200)
+	require.NoError(t, err)
+	resp := receive()
+	require.Nil(t, resp["body"])
+	bodyURL, _ := resp["body_url"].(string)
+	key, ok := strings.CutPrefix(bodyURL, "mem:///")
+	require.True(t, ok, bodyURL)
+	require.NoError(t, uuid.Validate(key))
+	require.Equal(t, map[string]interface{}{"id": "abc"}, resp["metadata"])
+	require.Equal(t, float64(200), resp["status_code"])
+
+	stored, err := bucket.bucket.ReadAll(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, large, stored)
+}
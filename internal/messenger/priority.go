@@ -0,0 +1,215 @@
+package messenger
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/endpoints"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// priorities handles request messages by priority class: received messages
+// wait in a queue per class, and handlers are started for the messages of
+// the highest priority class first.
+type priorities struct {
+	metadataKey string
+	// classes are the names of the priority classes from the
+	// highest to the lowest priority.
+	classes      []string
+	defaultClass int
+	queue        *priorityQueue
+}
+
+func newPriorities(cfg *config.MessagePriorities) *priorities {
+	p := &priorities{
+		metadataKey: cfg.MetadataKey,
+		classes:     cfg.Classes,
+		queue:       newPriorityQueue(len(cfg.Classes), cfg.MaxQueued),
+	}
+	p.defaultClass, _ = p.lookup(cfg.Default)
+	return p
+}
+
+func (p *priorities) lookup(name string) (int, bool) {
+	for i, c := range p.classes {
+		if c == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// class returns the priority class of a request, which is read from the
+// "metadata" field of the request message or else from the message
+// metadata (attributes/headers).
+func (p *priorities) class(req *request) int {
+	v, ok := requestMetadata(req, p.metadataKey)
+	if !ok {
+		return p.defaultClass
+	}
+	name, _ := v.(string)
+	class, ok := p.lookup(name)
+	if !ok {
+		log.Printf("Message %s has unknown priority class %v, using %q", req.msg.LoggableID, v, p.classes[p.defaultClass])
+		return p.defaultClass
+	}
+	return class
+}
+
+// endpointPriority is the priority of a request of a class when waiting
+// for an endpoint (see endpoints.WithPriority). The lowest class has a
+// priority of 0 like requests without a priority (i.e. from the proxy).
+func (p *priorities) endpointPriority(class int) int {
+	return len(p.classes) - 1 - class
+}
+
+// queuedRequest is a received request message that waits for a handler.
+type queuedRequest struct {
+	req *request
+	// err is the error of parsing the request.
+	err   error
+	class int
+	// stopKeepalive stops extending the message, which is hidden from
+	// other consumers from when it is received until it is handled (or
+	// redelivered). It is nil if the keepalive was not started.
+	stopKeepalive func()
+}
+
+// done stops the keepalive of the request's message once it was handled.
+func (qr queuedRequest) done() {
+	if qr.stopKeepalive != nil {
+		qr.stopKeepalive()
+	}
+}
+
+// priorityQueue is a bounded queue of received request messages. Messages
+// are removed by priority class and then in the order that they were added.
+type priorityQueue struct {
+	// slots has an element for each message that can be added
+	// before the queue is full.
+	slots chan struct{}
+	// queued has an element for each message in the queue.
+	queued chan struct{}
+
+	mtx sync.Mutex
+	// byClass are the queued messages of each priority class.
+	byClass [][]queuedRequest
+}
+
+func newPriorityQueue(classes, maxQueued int) *priorityQueue {
+	q := &priorityQueue{
+		slots:   make(chan struct{}, maxQueued),
+		queued:  make(chan struct{}, maxQueued),
+		byClass: make([][]queuedRequest, classes),
+	}
+	for range maxQueued {
+		q.slots <- struct{}{}
+	}
+	return q
+}
+
+// push adds a request to the queue. It blocks while the queue is full.
+func (q *priorityQueue) push(ctx context.Context, qr queuedRequest) error {
+	select {
+	case <-q.slots:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	q.mtx.Lock()
+	q.byClass[qr.class] = append(q.byClass[qr.class], qr)
+	q.mtx.Unlock()
+	q.queued <- struct{}{}
+	return nil
+}
+
+// pop removes the first request of the highest priority class.
+// It blocks while the queue is empty.
+func (q *priorityQueue) pop(ctx context.Context) (queuedRequest, error) {
+	select {
+	case <-q.queued:
+	case <-ctx.Done():
+		return queuedRequest{}, ctx.Err()
+	}
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	for class, reqs := range q.byClass {
+		if len(reqs) > 0 {
+			qr := reqs[0]
+			q.byClass[class] = reqs[1:]
+			q.slots <- struct{}{}
+			return qr, nil
+		}
+	}
+	panic("priorityQueue: queued element without a request")
+}
+
+// drain removes all queued requests. The queue must not be used afterwards.
+func (q *priorityQueue) drain() []queuedRequest {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	var drained []queuedRequest
+	for class, reqs := range q.byClass {
+		drained = append(drained, reqs...)
+		q.byClass[class] = nil
+	}
+	return drained
+}
+
+// enqueue adds a received request to the queue of its priority class.
+// It blocks while the queue is full.
+func (m *Messenger) enqueue(ctx context.Context, qr queuedRequest) error {
+	qr.class = m.priorities.class(qr.req)
+	qr.req.priority = qr.class
+	m.recordQueued(qr, 1)
+	if err := m.priorities.queue.push(ctx, qr); err != nil {
+		m.recordQueued(qr, -1)
+		return err
+	}
+	return nil
+}
+
+// dispatch starts handlers for queued requests (as handler slots of the
+// semaphore become available) until the context is done.
+func (m *Messenger) dispatch(ctx context.Context, sem *handlerSemaphore) {
+	for {
+		if err := sem.acquire(ctx); err != nil {
+			return
+		}
+		qr, err := m.priorities.queue.pop(ctx)
+		if err != nil {
+			sem.release()
+			return
+		}
+		m.recordQueued(qr, -1)
+		go m.handle(ctx, sem, qr)
+	}
+}
+
+// nackQueued returns requests that are still queued after dispatch()
+// stopped to the messaging system, so that they are redelivered.
+func (m *Messenger) nackQueued() {
+	for _, qr := range m.priorities.queue.drain() {
+		m.recordQueued(qr, -1)
+		m.redeliverQueued(qr)
+	}
+}
+
+func (m *Messenger) recordQueued(qr queuedRequest, n int64) {
+	metrics.MessengerQueued.Add(context.Background(), n, metric.WithAttributeSet(attribute.NewSet(
+		metrics.AttrMessengerStream.String(m.stream),
+		metrics.AttrMessengerPriority.String(m.priorities.classes[qr.class]),
+	)))
+}
+
+// withEndpointPriority returns a context in which the request is served
+// before requests of lower priority classes while waiting for an endpoint.
+func (m *Messenger) withEndpointPriority(ctx context.Context, req *request) context.Context {
+	if m.priorities == nil {
+		return ctx
+	}
+	return endpoints.WithPriority(ctx, m.priorities.endpointPriority(req.priority))
+}
@@ -0,0 +1,78 @@
+package messenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	ctx := context.Background()
+	q := newPriorityQueue(3, 4)
+
+	push := func(class int, model string) {
+		t.Helper()
+		require.NoError(t, q.push(ctx, queuedRequest{req: &request{model: model}, class: class}))
+	}
+	push(2, "low-1")
+	push(1, "normal")
+	push(2, "low-2")
+	push(0, "high")
+
+	// The queue is full.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.push(timeoutCtx, queuedRequest{req: &request{}}), context.DeadlineExceeded)
+
+	var popped []string
+	for range 3 {
+		qr, err := q.pop(ctx)
+		require.NoError(t, err)
+		popped = append(popped, qr.req.model)
+	}
+	require.Equal(t, []string{"high", "normal", "low-1"}, popped)
+
+	// Popping makes room.
+	push(0, "high-2")
+	var drained []string
+	for _, qr := range q.drain() {
+		drained = append(drained, qr.req.model)
+	}
+	require.Equal(t, []string{"high-2", "low-2"}, drained)
+}
+
+func TestPriorityClass(t *testing.T) {
+	p := newPriorities(&config.MessagePriorities{
+		MetadataKey: "priority",
+		Classes:     []string{"high", "normal", "low"},
+		Default:     "normal",
+		MaxQueued:   1,
+	})
+
+	cases := map[string]struct {
+		metadata    map[string]any
+		msgMetadata map[string]string
+		exp         string
+	}{
+		"default":          {exp: "normal"},
+		"request metadata": {metadata: map[string]any{"priority": "high"}, exp: "high"},
+		"message metadata": {msgMetadata: map[string]string{"priority": "low"}, exp: "low"},
+		"unknown class":    {metadata: map[string]any{"priority": "urgent"}, exp: "normal"},
+		"not a string":     {metadata: map[string]any{"priority": 1.0}, exp: "normal"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			msg := kafkaPubsubMessage(t, &sarama.ConsumerMessage{}, c.msgMetadata)
+			class := p.class(&request{msg: msg, metadata: c.metadata})
+			require.Equal(t, c.exp, p.classes[class])
+		})
+	}
+
+	// The lowest class waits for endpoints like requests without a priority.
+	require.Equal(t, 2, p.endpointPriority(0))
+	require.Equal(t, 0, p.endpointPriority(2))
+}
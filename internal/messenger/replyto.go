@@ -0,0 +1,217 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"sync"
+
+	"gocloud.dev/pubsub"
+)
+
+// responseTopicMetadataKey is the request metadata key of the URL of the
+// topic that the responses of a request are published to (instead of the
+// responses topic of the stream). It is read from the "metadata" field of
+// the request message or else from the message metadata.
+const responseTopicMetadataKey = "response_topic"
+
+// maxResponseTopics limits the number of response topics that are kept
+// open. The least recently used topic that no request is publishing to is
+// shut down when another one is opened.
+const maxResponseTopics = 64
+
+// responseTopics opens the topics that requests may select with the
+// response_topic metadata.
+type responseTopics struct {
+	// allowed are the parsed topic URL patterns (see matchTopicURL()).
+	allowed []*url.URL
+
+	mtx    sync.Mutex
+	topics map[string]*openResponseTopic
+	// uses counts the calls of get() to order the topics by their last use.
+	uses uint64
+}
+
+type openResponseTopic struct {
+	topic *pubsub.Topic
+	// refs is the number of requests that publish to the topic.
+	refs    int
+	lastUse uint64
+}
+
+// responseTopicsFor returns nil if no response topics are allowed.
+func responseTopicsFor(allowed []string) *responseTopics {
+	if len(allowed) == 0 {
+		return nil
+	}
+	r := &responseTopics{topics: map[string]*openResponseTopic{}}
+	for _, pattern := range allowed {
+		// Patterns are validated in the system config.
+		if u, err := url.Parse(pattern); err == nil {
+			r.allowed = append(r.allowed, u)
+		}
+	}
+	return r
+}
+
+// get returns the topic with the given URL if it is allowed. Topics are
+// opened once and reused, each call must be followed by a call of release
+// once the request stopped publishing to the topic.
+func (r *responseTopics) get(ctx context.Context, topicURL string) (*pubsub.Topic, error) {
+	if !r.isAllowed(topicURL) {
+		return nil, fmt.Errorf("%s %q is not allowed", responseTopicMetadataKey, topicURL)
+	}
+
+	r.mtx.Lock()
+	r.uses++
+	if t, ok := r.topics[topicURL]; ok {
+		t.refs++
+		t.lastUse = r.uses
+		r.mtx.Unlock()
+		return t.topic, nil
+	}
+	evicted := r.evictLocked()
+	topic, err := pubsub.OpenTopic(ctx, topicURL)
+	if err == nil {
+		r.topics[topicURL] = &openResponseTopic{topic: topic, refs: 1, lastUse: r.uses}
+	}
+	r.mtx.Unlock()
+
+	if evicted != nil {
+		if err := evicted.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down response topic: %v", err)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s %q: %w", responseTopicMetadataKey, topicURL, err)
+	}
+	return topic, nil
+}
+
+// evictLocked removes the least recently used topic that is not in use if
+// the limit of open topics is reached and returns it to be shut down.
+func (r *responseTopics) evictLocked() *pubsub.Topic {
+	if len(r.topics) < maxResponseTopics {
+		return nil
+	}
+	var (
+		lru    string
+		oldest *openResponseTopic
+	)
+	for u, t := range r.topics {
+		if t.refs == 0 && (oldest == nil || t.lastUse < oldest.lastUse) {
+			lru, oldest = u, t
+		}
+	}
+	if oldest == nil {
+		// All topics are in use, the limit is exceeded until they are
+		// released.
+		return nil
+	}
+	delete(r.topics, lru)
+	return oldest.topic
+}
+
+// release releases a topic that was returned by get.
+func (r *responseTopics) release(topicURL string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if t, ok := r.topics[topicURL]; ok {
+		t.refs--
+	}
+}
+
+// shutdown shuts down all open topics.
+func (r *responseTopics) shutdown(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	var errs []error
+	for u, t := range r.topics {
+		if err := t.topic.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutting down response topic %q: %w", u, err))
+		}
+		delete(r.topics, u)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *responseTopics) isAllowed(topicURL string) bool {
+	if r == nil {
+		return false
+	}
+	u, err := url.Parse(topicURL)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range r.allowed {
+		if matchTopicURL(pattern, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTopicURL returns true if a topic URL matches a pattern. The host and
+// path are matched with path.Match, all other parts of the URL (including
+// the query parameters, which can i.e. set the endpoint of the broker) must
+// equal the pattern's.
+func matchTopicURL(pattern, u *url.URL) bool {
+	if u.Scheme != pattern.Scheme || u.Opaque != pattern.Opaque || u.User.String() != pattern.User.String() ||
+		u.RawQuery != pattern.RawQuery || u.Fragment != pattern.Fragment {
+		return false
+	}
+	if ok, _ := path.Match(pattern.Host, u.Host); !ok {
+		return false
+	}
+	ok, _ := path.Match(pattern.Path, u.Path)
+	return ok
+}
+
+// resolveResponseTopic sets the topic that the responses of a request are
+// published to if the request selects one with the response_topic metadata.
+func (m *Messenger) resolveResponseTopic(req *request) error {
+	v, ok := requestMetadata(req, responseTopicMetadataKey)
+	if !ok {
+		return nil
+	}
+	topicURL, _ := v.(string)
+	if topicURL == "" {
+		return fmt.Errorf("%s must be a non-empty string", responseTopicMetadataKey)
+	}
+	topic, err := m.responseTopics.get(req.ctx, topicURL)
+	if err != nil {
+		return err
+	}
+	req.responses, req.responsesURL = topic, topicURL
+	return nil
+}
+
+// releaseResponseTopic releases the topic that was selected by
+// resolveResponseTopic once all responses of the request are published.
+func (m *Messenger) releaseResponseTopic(req *request) {
+	if req.responses != nil {
+		m.responseTopics.release(req.responsesURL)
+	}
+}
+
+// responsesTopic returns the topic that the responses of a request are
+// published to.
+func (m *Messenger) responsesTopic(req *request) *pubsub.Topic {
+	if req.responses != nil {
+		return req.responses
+	}
+	return m.responses
+}
+
+func (m *Messenger) responsesTopicURL(req *request) string {
+	if req.responses != nil {
+		return req.responsesURL
+	}
+	return m.responsesURL
+}
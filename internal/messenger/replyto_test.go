@@ -0,0 +1,158 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+)
+
+func TestResponseTopic(t *testing.T) {
+	ctx := context.Background()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer backend.Close()
+
+	openTopic := func(name string) (*pubsub.Topic, *pubsub.Subscription) {
+		topic, err := pubsub.OpenTopic(ctx, "mem://reply-to-test-"+name)
+		require.NoError(t, err)
+		t.Cleanup(func() { topic.Shutdown(ctx) })
+		sub, err := pubsub.OpenSubscription(ctx, "mem://reply-to-test-"+name)
+		require.NoError(t, err)
+		t.Cleanup(func() { sub.Shutdown(ctx) })
+		return topic, sub
+	}
+	requestsTopic, requests := openTopic("requests")
+	responsesTopic, responses := openTopic("responses")
+	_, teamResponses := openTopic("responses-team-a")
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	m := &Messenger{
+		modelScaler:    fake,
+		resolver:       fake,
+		HTTPC:          http.DefaultClient,
+		stream:         "0",
+		responses:      responsesTopic,
+		modelMix:       newModelMix(10),
+		responseTopics: responseTopicsFor([]string{"mem://reply-to-test-responses-*"}),
+	}
+
+	handle := func(body string, md map[string]string) {
+		t.Helper()
+		require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{Body: []byte(body), Metadata: md}))
+		msg, err := requests.Receive(ctx)
+		require.NoError(t, err)
+		m.handleRequest(ctx, msg)
+	}
+	receive := func(sub *pubsub.Subscription) (int, string) {
+		t.Helper()
+		receiveCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		resp, err := sub.Receive(receiveCtx)
+		require.NoError(t, err)
+		resp.Ack()
+		var body struct {
+			StatusCode int             `json:"status_code"`
+			Body       json.RawMessage `json:"body"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body, &body))
+		return body.StatusCode, string(body.Body)
+	}
+
+	t.Run("request metadata", func(t *testing.T) {
+		handle(`{"metadata":{"response_topic":"mem://reply-to-test-responses-team-a"},"body":{"model":"test-model"}}`, nil)
+		code, _ := receive(teamResponses)
+		require.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("message metadata", func(t *testing.T) {
+		handle(`{"body":{"model":"test-model"}}`, map[string]string{"response_topic": "mem://reply-to-test-responses-team-a"})
+		code, _ := receive(teamResponses)
+		require.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		// The error response is published to the responses topic of the stream.
+		handle(`{"metadata":{"response_topic":"mem://reply-to-test-requests"},"body":{"model":"test-model"}}`, nil)
+		code, body := receive(responses)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Contains(t, body, `response_topic \"mem://reply-to-test-requests\" is not allowed`)
+	})
+
+	t.Run("query parameters are not matched by patterns", func(t *testing.T) {
+		handle(`{"metadata":{"response_topic":"mem://reply-to-test-responses-team-a?endpoint=attacker.example"},"body":{"model":"test-model"}}`, nil)
+		code, body := receive(responses)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Contains(t, body, "is not allowed")
+	})
+
+	t.Run("no allowed topics", func(t *testing.T) {
+		m.responseTopics = nil
+		handle(`{"metadata":{"response_topic":"mem://reply-to-test-responses-team-a"},"body":{"model":"test-model"}}`, nil)
+		code, _ := receive(responses)
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestResponseTopicsEviction(t *testing.T) {
+	ctx := context.Background()
+	r := responseTopicsFor([]string{"mem://eviction-test-*"})
+	for i := 0; i <= maxResponseTopics; i++ {
+		name := fmt.Sprintf("eviction-test-%d", i)
+		topic, err := pubsub.OpenTopic(ctx, "mem://"+name)
+		require.NoError(t, err)
+		t.Cleanup(func() { topic.Shutdown(ctx) })
+	}
+
+	// The first topic is in use and is not evicted.
+	inUse, err := r.get(ctx, "mem://eviction-test-0")
+	require.NoError(t, err)
+	for i := 1; i < maxResponseTopics; i++ {
+		u := fmt.Sprintf("mem://eviction-test-%d", i)
+		_, err := r.get(ctx, u)
+		require.NoError(t, err)
+		r.release(u)
+	}
+	_, err = r.get(ctx, fmt.Sprintf("mem://eviction-test-%d", maxResponseTopics))
+	require.NoError(t, err)
+	require.Len(t, r.topics, maxResponseTopics)
+	require.Contains(t, r.topics, "mem://eviction-test-0")
+	require.NotContains(t, r.topics, "mem://eviction-test-1")
+	require.NoError(t, inUse.Send(ctx, &pubsub.Message{Body: []byte("{}")}))
+
+	require.NoError(t, r.shutdown(ctx))
+	require.Empty(t, r.topics)
+}
+
+func Test_matchTopicURL(t *testing.T) {
+	cases := []struct {
+		pattern, url string
+		want         bool
+	}{
+		{"awssqs://sqs.us-east-1.amazonaws.com/123/responses-*?region=us-east-1", "awssqs://sqs.us-east-1.amazonaws.com/123/responses-a?region=us-east-1", true},
+		{"awssqs://sqs.us-east-1.amazonaws.com/123/responses-*?region=us-east-1", "awssqs://sqs.us-east-1.amazonaws.com/123/responses-a?region=us-east-1&endpoint=attacker.example", false},
+		{"awssqs://sqs.us-east-1.amazonaws.com/123/responses-*", "awssqs://sqs.us-east-1.amazonaws.com/123/responses-a?endpoint=attacker.example", false},
+		{"awssqs://sqs.us-east-1.amazonaws.com/123/responses-*", "awssqs://sqs.us-east-1.amazonaws.com/123/responses-a/b", false},
+		{"awssqs://sqs.us-east-1.amazonaws.com/123/responses-*", "awssqs://attacker.example/123/responses-a", false},
+		{"mem://responses-*", "mem://responses-a", true},
+		{"mem://responses-*", "kafka://responses-a", false},
+	}
+	for _, c := range cases {
+		pattern, err := url.Parse(c.pattern)
+		require.NoError(t, err)
+		u, err := url.Parse(c.url)
+		require.NoError(t, err)
+		require.Equal(t, c.want, matchTopicURL(pattern, u), "%s %s", c.pattern, c.url)
+	}
+}
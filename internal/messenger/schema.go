@@ -0,0 +1,216 @@
+package messenger
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// The version of the messenger protocol is set in the "version" field of
+// request messages. Messages without a version are version 1 messages, which
+// is the version of messages that were published before the field existed.
+const (
+	versionField   = "version"
+	defaultVersion = 1
+)
+
+// requestSchemas are the JSON Schemas of request messages by version.
+var requestSchemas = map[int]*jsonschema.Schema{
+	1: mustLoadSchema("schemas/request-v1.json"),
+}
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+func mustLoadSchema(name string) *jsonschema.Schema {
+	data, err := schemaFiles.ReadFile(name)
+	if err != nil {
+		panic(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		panic(fmt.Sprintf("parsing schema %s: %v", name, err))
+	}
+	s, err := apiutils.CompileJSONSchema(doc)
+	if err != nil {
+		panic(fmt.Sprintf("compiling schema %s: %v", name, err))
+	}
+	return s
+}
+
+// supportedVersions returns the supported versions in ascending order.
+func supportedVersions() []int {
+	versions := make([]int, 0, len(requestSchemas))
+	for v := range requestSchemas {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// fieldErrors returns the errors of the fields of a message that failed
+// to validate against its schema, sorted by field.
+func fieldErrors(err error) []fieldError {
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return []fieldError{{Field: ".", Message: err.Error()}}
+	}
+	var errs []fieldError
+	var walk func(*jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) > 0 {
+			for _, c := range e.Causes {
+				walk(c)
+			}
+			return
+		}
+		field := fieldName(e.InstanceLocation)
+		if req, ok := e.ErrorKind.(*kind.Required); ok {
+			// Reported for the missing fields rather than their parent.
+			for _, name := range req.Missing {
+				errs = append(errs, fieldError{Field: strings.TrimSuffix(field, ".") + "." + name, Message: "is required"})
+			}
+			return
+		}
+		errs = append(errs, fieldError{Field: field, Message: e.ErrorKind.LocalizedString(schemaErrorPrinter)})
+	}
+	walk(ve)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+var schemaErrorPrinter = message.NewPrinter(language.English)
+
+// fieldName returns the name of a field from its location in a message,
+// i.e. ".body.model".
+func fieldName(location []string) string {
+	if len(location) == 0 {
+		return "."
+	}
+	return "." + strings.Join(location, ".")
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// fieldError is an error of a field of a request message. Fields are
+// written like ".body.model".
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// messageError is returned for request messages that are not valid
+// messages of a supported version of the protocol. The response to the
+// message lists the errors.
+type messageError struct {
+	code   string
+	errors []fieldError
+}
+
+// Error codes of messageErrors.
+const (
+	invalidMessageCode     = "invalid_message"
+	unsupportedVersionCode = "unsupported_version"
+)
+
+func (e *messageError) Error() string {
+	msgs := make([]string, len(e.errors))
+	for i, fe := range e.errors {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid message: " + strings.Join(msgs, "; ")
+}
+
+// validateMessage validates a (JSON) request message against the schema of
+// its version.
+func validateMessage(data []byte) error {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("unmarshalling message as json: %w", err)
+	}
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return &messageError{code: invalidMessageCode, errors: []fieldError{
+			{Field: ".", Message: fmt.Sprintf("should be of type object, got %s", jsonType(doc))},
+		}}
+	}
+
+	version := defaultVersion
+	if v, ok := obj[versionField]; ok {
+		f, ok := v.(float64)
+		if !ok || f != math.Trunc(f) {
+			return &messageError{code: invalidMessageCode, errors: []fieldError{
+				{Field: "." + versionField, Message: fmt.Sprintf("should be of type integer, got %s", jsonType(v))},
+			}}
+		}
+		version = int(f)
+	}
+	s, ok := requestSchemas[version]
+	if !ok {
+		return &messageError{code: unsupportedVersionCode, errors: []fieldError{
+			{Field: "." + versionField, Message: fmt.Sprintf("version %d is not supported, supported versions: %v", version, supportedVersions())},
+		}}
+	}
+
+	if err := apiutils.ValidateJSONSchema(s, obj); err != nil {
+		return &messageError{code: invalidMessageCode, errors: fieldErrors(err)}
+	}
+	return nil
+}
+
+// jsonMessageError returns the response to a request message that is not
+// valid. Like other error responses, it is an OpenAI style error with
+// additional fields.
+func (m *Messenger) jsonMessageError(err *messageError) []byte {
+	m.addConsecutiveError()
+	log.Printf("error parsing request: %v", err)
+
+	type errorBody struct {
+		Message           string       `json:"message"`
+		Type              string       `json:"type"`
+		Code              string       `json:"code"`
+		Errors            []fieldError `json:"errors"`
+		SupportedVersions []int        `json:"supported_versions"`
+	}
+	resp, mErr := json.Marshal(struct {
+		Error errorBody `json:"error"`
+	}{errorBody{
+		Message:           "error parsing request: " + err.Error(),
+		Type:              "invalid_request_error",
+		Code:              err.code,
+		Errors:            err.errors,
+		SupportedVersions: supportedVersions(),
+	}})
+	if mErr != nil {
+		// Not expected: the response only contains strings and numbers.
+		panic(mErr)
+	}
+	return resp
+}
@@ -0,0 +1,97 @@
+package messenger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+)
+
+func TestParseRequestVersion(t *testing.T) {
+	cases := map[string]struct {
+		body       string
+		expVersion int
+		expCode    string
+		expErrors  []fieldError
+	}{
+		"no version": {
+			body: `{"body":{"model":"test-model"}}`,
+		},
+		"version 1": {
+			body:       `{"version":1,"body":{"model":"test-model"}}`,
+			expVersion: 1,
+		},
+		"unknown fields": {
+			body: `{"body":{"model":"test-model"},"later_field":true}`,
+		},
+		"unsupported version": {
+			body:    `{"version":2,"body":{"model":"test-model"}}`,
+			expCode: unsupportedVersionCode,
+			expErrors: []fieldError{
+				{Field: ".version", Message: "version 2 is not supported, supported versions: [1]"},
+			},
+		},
+		"version not an integer": {
+			body:    `{"version":"1","body":{"model":"test-model"}}`,
+			expCode: invalidMessageCode,
+			expErrors: []fieldError{
+				{Field: ".version", Message: "should be of type integer, got string"},
+			},
+		},
+		"not an object": {
+			body:    `["test-model"]`,
+			expCode: invalidMessageCode,
+			expErrors: []fieldError{
+				{Field: ".", Message: "should be of type object, got array"},
+			},
+		},
+		"invalid fields": {
+			body:    `{"path":1,"body":{},"stream":"yes"}`,
+			expCode: invalidMessageCode,
+			expErrors: []fieldError{
+				{Field: ".body.model", Message: "is required"},
+				{Field: ".path", Message: "got number, want string"},
+				{Field: ".stream", Message: "got string, want boolean"},
+			},
+		},
+		"empty batch": {
+			body:    `{"batch":[]}`,
+			expCode: invalidMessageCode,
+			expErrors: []fieldError{
+				{Field: ".batch", Message: "minItems: got 0, want 1"},
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			req, err := parseRequest(context.Background(), &pubsub.Message{Body: []byte(c.body)})
+			if c.expCode == "" {
+				require.NoError(t, err)
+				require.Equal(t, c.expVersion, req.version)
+				return
+			}
+			var msgErr *messageError
+			require.ErrorAs(t, err, &msgErr)
+			require.Equal(t, c.expCode, msgErr.code)
+			require.Equal(t, c.expErrors, msgErr.errors)
+		})
+	}
+}
+
+func TestJSONMessageError(t *testing.T) {
+	m := &Messenger{}
+	resp := m.jsonMessageError(&messageError{
+		code:   invalidMessageCode,
+		errors: []fieldError{{Field: ".body.model", Message: "is required"}},
+	})
+	require.JSONEq(t, `{
+		"error": {
+			"message": "error parsing request: invalid message: .body.model: is required",
+			"type": "invalid_request_error",
+			"code": "invalid_message",
+			"errors": [{"field": ".body.model", "message": "is required"}],
+			"supported_versions": [1]
+		}
+	}`, string(resp))
+}
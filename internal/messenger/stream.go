@@ -0,0 +1,137 @@
+package messenger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/substratusai/kubeai/internal/bodycodec"
+	"gocloud.dev/pubsub"
+)
+
+const (
+	// messageTypeStreamChunk is set on the incremental response messages of
+	// streamed requests and messageTypeStreamDone on the final response.
+	messageTypeStreamChunk = "stream_chunk"
+	messageTypeStreamDone  = "stream_done"
+)
+
+// streamBackendRequest sends a request to a model server and publishes each
+// server-sent event of the response as a chunk message. The response body is
+// only returned if the response is not an event stream (i.e. an error
+// response), in which case it is published with the final response.
+func (m *Messenger) streamBackendRequest(ctx context.Context, httpc *http.Client, url string, req *request) ([]byte, int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req.body))
+	if err != nil {
+		return nil, 0, err
+	}
+	m.forwardMetadata(httpReq.Header, req)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream, application/json")
+	injectTraceContext(ctx, httpReq.Header)
+
+	resp, err := httpc.Do(httpReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		payload, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, 0, err
+		}
+		return payload, resp.StatusCode, nil
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for {
+		data, ok, err := readEventData(r)
+		if ok && !bytes.Equal(data, []byte("[DONE]")) {
+			if err := m.publishChunk(req, resp.StatusCode, data); err != nil {
+				return nil, 0, fmt.Errorf("publishing chunk %d: %w", req.sequence, err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, resp.StatusCode, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// readEventData reads a single server-sent event and returns its data
+// (multiple data lines are joined with newlines). ok is false for events
+// without data (i.e. comments).
+func readEventData(r *bufio.Reader) (data []byte, ok bool, err error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+		if value, found := bytes.CutPrefix(line, []byte("data:")); found {
+			if ok {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(value, []byte(" "))...)
+			ok = true
+		}
+		if err != nil {
+			return data, ok, err
+		}
+		if len(line) == 0 && ok {
+			return data, ok, nil
+		}
+	}
+}
+
+// publishChunk publishes the data of a server-sent event as a chunk message
+// with the next sequence number of the request.
+func (m *Messenger) publishChunk(req *request, statusCode int, data []byte) error {
+	// Data that is not JSON (OpenAI chunks are) is published as a string.
+	if !json.Valid(data) {
+		var err error
+		data, err = json.Marshal(string(data))
+		if err != nil {
+			return err
+		}
+	}
+	body, err := json.Marshal(struct {
+		Version    int                    `json:"version,omitempty"`
+		Metadata   map[string]interface{} `json:"metadata"`
+		StatusCode int                    `json:"status_code"`
+		Sequence   int                    `json:"sequence"`
+		Data       json.RawMessage        `json:"data"`
+	}{
+		Version:    req.version,
+		Metadata:   req.metadata,
+		StatusCode: statusCode,
+		Sequence:   req.sequence,
+		Data:       data,
+	})
+	if err != nil {
+		return fmt.Errorf("marshalling chunk: %w", err)
+	}
+	if req.codec != nil {
+		body, err = bodycodec.FromJSON(req.codec, body)
+		if err != nil {
+			return fmt.Errorf("converting chunk to %s: %w", req.codec.MediaType(), err)
+		}
+	}
+
+	md := m.responseMetadata(req)
+	md[messageTypeMetadataKey] = messageTypeStreamChunk
+	if err := m.responsesTopic(req).Send(req.ctx, &pubsub.Message{
+		Body:     m.compressResponse(req, body, md),
+		Metadata: md,
+	}); err != nil {
+		return err
+	}
+	req.sequence++
+	return nil
+}
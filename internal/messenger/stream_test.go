@@ -0,0 +1,108 @@
+package messenger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+)
+
+func TestHandleStreamRequest(t *testing.T) {
+	ctx := context.Background()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, ": keepalive\n\n")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"text\":\"Hello\"}]}\n\n")
+		_, _ = io.WriteString(w, "data: {\"choices\":[{\"text\":\" world\"}]}\n\n")
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer backend.Close()
+
+	requestsTopic, err := pubsub.OpenTopic(ctx, "mem://stream-test-requests")
+	require.NoError(t, err)
+	defer requestsTopic.Shutdown(ctx)
+	requests, err := pubsub.OpenSubscription(ctx, "mem://stream-test-requests")
+	require.NoError(t, err)
+	defer requests.Shutdown(ctx)
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://stream-test-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	responses, err := pubsub.OpenSubscription(ctx, "mem://stream-test-responses")
+	require.NoError(t, err)
+	defer responses.Shutdown(ctx)
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		HTTPC:       http.DefaultClient,
+		responses:   responsesTopic,
+		modelMix:    newModelMix(10),
+	}
+
+	require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{Body: []byte(`{
+	"metadata": {"id": "abc"},
+	"stream": true,
+	"body": {"model": "test-model", "prompt": "hi", "stream": true}
+}`)}))
+	msg, err := requests.Receive(ctx)
+	require.NoError(t, err)
+	m.handleRequest(ctx, msg)
+
+	// The in-memory topic does not preserve the order of messages.
+	type streamed struct {
+		messageType string
+		body        string
+	}
+	var received []streamed
+	receiveCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	for {
+		resp, err := responses.Receive(receiveCtx)
+		if err != nil {
+			break
+		}
+		resp.Ack()
+		received = append(received, streamed{resp.Metadata["message_type"], string(resp.Body)})
+	}
+	sort.Slice(received, func(i, j int) bool {
+		seq := func(body string) float64 {
+			var v struct{ Sequence float64 }
+			require.NoError(t, json.Unmarshal([]byte(body), &v))
+			return v.Sequence
+		}
+		return seq(received[i].body) < seq(received[j].body)
+	})
+
+	require.Len(t, received, 3)
+	require.Equal(t, "stream_chunk", received[0].messageType)
+	require.JSONEq(t, `{"metadata":{"id":"abc"},"status_code":200,"sequence":0,"data":{"choices":[{"text":"Hello"}]}}`, received[0].body)
+	require.Equal(t, "stream_chunk", received[1].messageType)
+	require.JSONEq(t, `{"metadata":{"id":"abc"},"status_code":200,"sequence":1,"data":{"choices":[{"text":" world"}]}}`, received[1].body)
+	require.Equal(t, "stream_done", received[2].messageType)
+	require.JSONEq(t, `{"metadata":{"id":"abc"},"status_code":200,"sequence":2,"done":true,"body":null}`, received[2].body)
+}
+
+func TestReadEventData(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("event: message\ndata: a\ndata: b\n\n: comment\n\ndata: c"))
+
+	data, ok, err := readEventData(r)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "a\nb", string(data))
+
+	data, ok, err = readEventData(r)
+	require.ErrorIs(t, err, io.EOF)
+	require.True(t, ok, "comments should be skipped and the last event should be returned without a trailing blank line")
+	require.Equal(t, "c", string(data))
+}
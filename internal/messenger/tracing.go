@@ -0,0 +1,82 @@
+package messenger
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/substratusai/kubeai/internal/messenger")
+
+// requestCarrier reads the trace context (i.e. the W3C "traceparent" and
+// "tracestate") of a request message from the "metadata" field of the
+// message or else from the message metadata (attributes/headers).
+type requestCarrier struct {
+	req *request
+}
+
+func (c requestCarrier) Get(key string) string {
+	v, _ := requestMetadata(c.req, key)
+	s, _ := v.(string)
+	return s
+}
+
+// Set is not supported: the trace context of request messages is only read.
+func (c requestCarrier) Set(key, value string) {}
+
+func (c requestCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.req.metadata)+len(c.req.msg.Metadata))
+	for k := range c.req.metadata {
+		keys = append(keys, k)
+	}
+	for k := range c.req.msg.Metadata {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startRequestSpan starts the span of handling a request message, which
+// continues the trace of the request message (if any). The context of the
+// request is replaced so that response messages continue the trace as well.
+func (m *Messenger) startRequestSpan(ctx context.Context, req *request) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, requestCarrier{req: req})
+	ctx, span := tracer.Start(ctx, "kubeai.messenger.request",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.message.id", req.msg.LoggableID),
+			attribute.String("kubeai.messenger.stream", m.stream),
+		),
+	)
+	req.ctx = trace.ContextWithSpan(req.ctx, span)
+	return ctx, span
+}
+
+// endRequestSpan records the status code of the response to a request
+// message (0 if no single response was sent) and ends its span.
+func endRequestSpan(span trace.Span, req *request, statusCode int) {
+	span.SetAttributes(attribute.String("kubeai.request.model", req.model))
+	if statusCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	}
+	if statusCode >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+	span.End()
+}
+
+// injectTraceContext sets the trace context of ctx in the headers of a
+// request to a model server.
+func injectTraceContext(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// injectMessageTraceContext sets the trace context of a request in the
+// metadata of a response message.
+func injectMessageTraceContext(req *request, md map[string]string) {
+	otel.GetTextMapPropagator().Inject(req.ctx, propagation.MapCarrier(md))
+}
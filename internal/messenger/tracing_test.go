@@ -0,0 +1,85 @@
+package messenger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"gocloud.dev/pubsub"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	ctx := context.Background()
+	prevPropagator := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(prevPropagator)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	backendTraceparent := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendTraceparent <- r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer backend.Close()
+
+	requestsTopic, err := pubsub.OpenTopic(ctx, "mem://tracing-test-requests")
+	require.NoError(t, err)
+	defer requestsTopic.Shutdown(ctx)
+	requests, err := pubsub.OpenSubscription(ctx, "mem://tracing-test-requests")
+	require.NoError(t, err)
+	defer requests.Shutdown(ctx)
+	responsesTopic, err := pubsub.OpenTopic(ctx, "mem://tracing-test-responses")
+	require.NoError(t, err)
+	defer responsesTopic.Shutdown(ctx)
+	responses, err := pubsub.OpenSubscription(ctx, "mem://tracing-test-responses")
+	require.NoError(t, err)
+	defer responses.Shutdown(ctx)
+
+	fake := &testModels{address: strings.TrimPrefix(backend.URL, "http://")}
+	m := &Messenger{
+		modelScaler: fake,
+		resolver:    fake,
+		HTTPC:       http.DefaultClient,
+		stream:      "0",
+		responses:   responsesTopic,
+		modelMix:    newModelMix(10),
+	}
+
+	cases := map[string]struct {
+		body string
+		md   map[string]string
+	}{
+		"message metadata": {
+			body: `{"body":{"model":"test-model"}}`,
+			md:   map[string]string{"traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"},
+		},
+		"request metadata": {
+			body: `{"metadata":{"traceparent":"00-` + traceID + `-00f067aa0ba902b7-01"},"body":{"model":"test-model"}}`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, requestsTopic.Send(ctx, &pubsub.Message{Body: []byte(c.body), Metadata: c.md}))
+			msg, err := requests.Receive(ctx)
+			require.NoError(t, err)
+			m.handleRequest(ctx, msg)
+
+			require.Contains(t, <-backendTraceparent, traceID)
+
+			receiveCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			resp, err := responses.Receive(receiveCtx)
+			require.NoError(t, err)
+			resp.Ack()
+			require.Contains(t, resp.Metadata["traceparent"], traceID)
+		})
+	}
+}
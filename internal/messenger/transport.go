@@ -0,0 +1,147 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/substratusai/kubeai/internal/config"
+	gcaws "gocloud.dev/aws"
+	"gocloud.dev/gcp"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/awssnssqs"
+	"gocloud.dev/pubsub/batcher"
+	"gocloud.dev/pubsub/gcppubsub"
+	"gocloud.dev/pubsub/kafkapubsub"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// openSubscription opens the requests subscription, applying the
+// transport-specific tuning. Subscriptions without tuning are opened
+// using the default gocloud.dev URL openers.
+func openSubscription(ctx context.Context, requestsURL string, transport config.MessageTransport) (*pubsub.Subscription, error) {
+	u, err := url.Parse(requestsURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing requests url: %w", err)
+	}
+
+	var opener pubsub.SubscriptionURLOpener
+	switch {
+	case transport.AWSSQS != nil:
+		opener, err = sqsOpener(u, transport.AWSSQS)
+	case transport.GCPPubSub != nil:
+		opener, err = gcpPubSubOpener(ctx, transport.GCPPubSub)
+	case u.Scheme == jetStreamScheme:
+		return openJetStreamSubscription(ctx, u, transport)
+	case transport.Kafka != nil && transport.Kafka.Native:
+		return openKafkaSubscription(u, transport.Kafka)
+	case transport.Kafka != nil:
+		opener, err = kafkaOpener(transport.Kafka)
+	default:
+		return pubsub.OpenSubscription(ctx, requestsURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return opener.OpenSubscriptionURL(ctx, u)
+}
+
+func sqsOpener(u *url.URL, t *config.AWSSQSTransport) (*awssnssqs.URLOpener, error) {
+	opener := &awssnssqs.URLOpener{
+		UseV2: gcaws.UseV2(u.Query()),
+		SubscriptionOptions: awssnssqs.SubscriptionOptions{
+			WaitTime: t.WaitTime.Duration,
+			ReceiveBatcherOptions: batcher.Options{
+				MaxBatchSize: t.ReceiveBatchSize,
+			},
+		},
+	}
+	if !opener.UseV2 {
+		sess, err := gcaws.NewDefaultSession()
+		if err != nil {
+			return nil, fmt.Errorf("creating aws session: %w", err)
+		}
+		opener.ConfigProvider = sess
+	}
+	return opener, nil
+}
+
+var gcpPubSubConn struct {
+	init sync.Once
+	conn *grpc.ClientConn
+	err  error
+}
+
+func gcpPubSubOpener(ctx context.Context, t *config.GCPPubSubTransport) (*gcppubsub.URLOpener, error) {
+	// The connection is shared by all subscriptions (including those that
+	// are recreated after errors), matching the default gocloud.dev opener.
+	gcpPubSubConn.init.Do(func() {
+		if e := os.Getenv("PUBSUB_EMULATOR_HOST"); e != "" {
+			gcpPubSubConn.conn, gcpPubSubConn.err = grpc.NewClient(e, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			return
+		}
+		creds, err := gcp.DefaultCredentials(ctx)
+		if err != nil {
+			gcpPubSubConn.err = err
+			return
+		}
+		gcpPubSubConn.conn, _, gcpPubSubConn.err = gcppubsub.Dial(ctx, gcp.CredentialsTokenSource(creds))
+	})
+	if gcpPubSubConn.err != nil {
+		return nil, fmt.Errorf("connecting to gcp pubsub: %w", gcpPubSubConn.err)
+	}
+
+	opener := &gcppubsub.URLOpener{Conn: gcpPubSubConn.conn}
+	if t.MaxOutstandingMessages > 0 {
+		// Pull at most MaxOutstandingMessages at a time and only
+		// pull more after they have been handed out to handlers.
+		opener.SubscriptionOptions.MaxBatchSize = t.MaxOutstandingMessages
+		opener.SubscriptionOptions.ReceiveBatcherOptions.MaxHandlers = 1
+	}
+	return opener, nil
+}
+
+func kafkaOpener(t *config.KafkaTransport) (*kafkapubsub.URLOpener, error) {
+	brokers, err := kafkaBrokers()
+	if err != nil {
+		return nil, err
+	}
+	return &kafkapubsub.URLOpener{
+		Brokers:             brokers,
+		Config:              kafkaConfig(t),
+		SubscriptionOptions: kafkapubsub.SubscriptionOptions{KeyName: t.KeyName},
+	}, nil
+}
+
+// kafkaBrokers matches the brokers used by the default gocloud.dev opener.
+func kafkaBrokers() ([]string, error) {
+	brokerList := os.Getenv("KAFKA_BROKERS")
+	if brokerList == "" {
+		return nil, fmt.Errorf("KAFKA_BROKERS environment variable not set")
+	}
+	brokers := strings.Split(brokerList, ",")
+	for i, b := range brokers {
+		brokers[i] = strings.TrimSpace(b)
+	}
+	return brokers, nil
+}
+
+func kafkaConfig(t *config.KafkaTransport) *sarama.Config {
+	cfg := kafkapubsub.MinimalConfig()
+	if t.FetchMinBytes > 0 {
+		cfg.Consumer.Fetch.Min = t.FetchMinBytes
+	}
+	if t.FetchDefaultBytes > 0 {
+		cfg.Consumer.Fetch.Default = t.FetchDefaultBytes
+	}
+	if t.FetchMaxBytes > 0 {
+		cfg.Consumer.Fetch.Max = t.FetchMaxBytes
+	}
+	return cfg
+}
@@ -0,0 +1,40 @@
+package messenger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"gocloud.dev/pubsub"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+func TestKafkaConfig(t *testing.T) {
+	defaults := kafkaConfig(&config.KafkaTransport{})
+	require.Equal(t, int32(1), defaults.Consumer.Fetch.Min)
+
+	cfg := kafkaConfig(&config.KafkaTransport{
+		FetchMinBytes:     512,
+		FetchDefaultBytes: 4096,
+		FetchMaxBytes:     8192,
+	})
+	require.Equal(t, int32(512), cfg.Consumer.Fetch.Min)
+	require.Equal(t, int32(4096), cfg.Consumer.Fetch.Default)
+	require.Equal(t, int32(8192), cfg.Consumer.Fetch.Max)
+}
+
+func TestOpenSubscriptionWithoutTransport(t *testing.T) {
+	ctx := context.Background()
+	topic, err := pubsub.OpenTopic(ctx, "mem://transport-test")
+	require.NoError(t, err)
+	defer topic.Shutdown(ctx)
+
+	sub, err := openSubscription(ctx, "mem://transport-test", config.MessageTransport{})
+	require.NoError(t, err)
+	defer sub.Shutdown(ctx)
+
+	keepalive, err := newKeepaliveFunc("mem://transport-test", sub)
+	require.NoError(t, err)
+	require.Nil(t, keepalive, "mem:// subscriptions do not support keepalive")
+}
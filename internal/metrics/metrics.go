@@ -5,6 +5,7 @@ import (
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 )
 
 const (
@@ -13,22 +14,185 @@ const (
 
 // Metrics used to autoscale models:
 var (
-	InferenceRequestsActiveMetricName = "kubeai.inference.requests.active"
-	InferenceRequestsActive           metric.Int64UpDownCounter
+	InferenceRequestsActiveMetricName  = "kubeai.inference.requests.active"
+	InferenceRequestsActive            metric.Int64UpDownCounter
+	InferenceRequestsMetricName        = "kubeai.inference.requests"
+	InferenceRequests                  metric.Int64Counter
+	InferenceRequestErrorsMetricName   = "kubeai.inference.requests.errors"
+	InferenceRequestErrors             metric.Int64Counter
+	InferenceRequestDurationMetricName = "kubeai.inference.requests.duration"
+	InferenceRequestDuration           metric.Float64Histogram
+	InferenceTimeToFirstByteMetricName = "kubeai.inference.requests.time_to_first_byte"
+	InferenceTimeToFirstByte           metric.Float64Histogram
+	// InferenceGPUSeconds is the approximate accelerator time used by
+	// requests (see endpoints.GPUSeconds).
+	InferenceGPUSecondsMetricName = "kubeai.inference.requests.gpu_seconds"
+	InferenceGPUSeconds           metric.Float64Counter
+	// InferenceDeprecatedRequests counts requests for deprecated Models
+	// (see Model.spec.deprecation).
+	InferenceDeprecatedRequestsMetricName = "kubeai.inference.requests.deprecated"
+	InferenceDeprecatedRequests           metric.Int64Counter
+	MessengerHandlersMetricName           = "kubeai.messenger.handlers"
+	MessengerHandlers                     metric.Int64Gauge
+	MessengerBacklogMetricName            = "kubeai.messenger.backlog"
+	MessengerBacklog                      metric.Int64Gauge
+)
+
+// Messaging metrics:
+var (
+	MessengerDuplicateRequestsMetricName  = "kubeai.messenger.requests.duplicate"
+	MessengerDuplicateRequests            metric.Int64Counter
+	MessengerDeadLetteredMetricName       = "kubeai.messenger.requests.dead_lettered"
+	MessengerDeadLettered                 metric.Int64Counter
+	MessengerDroppedMetricName            = "kubeai.messenger.requests.dropped"
+	MessengerDropped                      metric.Int64Counter
+	MessengerExpiredMetricName            = "kubeai.messenger.requests.expired"
+	MessengerExpired                      metric.Int64Counter
+	MessengerConcurrencyLimitedMetricName = "kubeai.messenger.requests.concurrency_limited"
+	MessengerConcurrencyLimited           metric.Int64Counter
+	MessengerQueuedMetricName             = "kubeai.messenger.requests.queued"
+	MessengerQueued                       metric.Int64UpDownCounter
+	MessengerOverflowedMetricName         = "kubeai.messenger.responses.overflowed"
+	MessengerOverflowed                   metric.Int64Counter
+	// MessengerCoalescedEmbeddings is the number of embeddings request
+	// messages that were sent to a model server in one request.
+	MessengerCoalescedEmbeddingsMetricName = "kubeai.messenger.embeddings.coalesced"
+	MessengerCoalescedEmbeddings           metric.Int64Histogram
+	MessengerReceivedMetricName            = "kubeai.messenger.messages.received"
+	MessengerReceived                      metric.Int64Counter
+	MessengerAckedMetricName               = "kubeai.messenger.messages.acked"
+	MessengerAcked                         metric.Int64Counter
+	MessengerNackedMetricName              = "kubeai.messenger.messages.nacked"
+	MessengerNacked                        metric.Int64Counter
+	MessengerHandlerDurationMetricName     = "kubeai.messenger.handler.duration"
+	MessengerHandlerDuration               metric.Float64Histogram
+	// MessengerBackendResponses are the responses of model servers to
+	// request messages by status code.
+	MessengerBackendResponsesMetricName = "kubeai.messenger.backend.responses"
+	MessengerBackendResponses           metric.Int64Counter
+	// MessengerBacklogAge is the time since the most recently received
+	// request message was published, which approximates the age of the
+	// oldest message in the backlog.
+	MessengerBacklogAgeMetricName        = "kubeai.messenger.backlog.age"
+	MessengerBacklogAge                  metric.Float64Gauge
+	MessengerConsecutiveErrorsMetricName = "kubeai.messenger.consecutive_errors"
+	MessengerConsecutiveErrors           metric.Int64Gauge
+	WebhookFailuresMetricName            = "kubeai.webhooks.failures"
+	WebhookFailures                      metric.Int64Counter
+)
+
+// LatencyBucketBoundaries are the histogram buckets (in seconds) used for
+// request latency metrics.
+var LatencyBucketBoundaries = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Autoscaling metrics:
+var (
+	ModelReplicasDesiredMetricName       = "kubeai.model.replicas.desired"
+	ModelReplicasDesired                 metric.Int64Gauge
+	ModelReplicasActualMetricName        = "kubeai.model.replicas.actual"
+	ModelReplicasActual                  metric.Int64Gauge
+	ModelReplicasUnschedulableMetricName = "kubeai.model.replicas.unschedulable"
+	ModelReplicasUnschedulable           metric.Int64Gauge
+	ModelPreemptionsMetricName           = "kubeai.model.preemptions"
+	ModelPreemptions                     metric.Int64Counter
+)
+
+// Streaming metrics:
+var (
+	InferenceStreamBufferFullMetricName      = "kubeai.inference.stream.buffer_full"
+	InferenceStreamBufferFull                metric.Int64Counter
+	InferenceStreamEventsCoalescedMetricName = "kubeai.inference.stream.events_coalesced"
+	InferenceStreamEventsCoalesced           metric.Int64Counter
+)
+
+// Load balancing metrics:
+var (
+	EndpointWaitQueueJumpsMetricName    = "kubeai.endpoints.wait_queue.jumps"
+	EndpointWaitQueueJumps              metric.Int64Counter
+	EndpointWaitQueueTimeoutsMetricName = "kubeai.endpoints.wait_queue.timeouts"
+	EndpointWaitQueueTimeouts           metric.Int64Counter
+	// EndpointFanoutLimited counts endpoint selections that were limited
+	// to the endpoints that a request was already sent to because of the
+	// Model's maxEndpointsPerRequest.
+	EndpointFanoutLimitedMetricName = "kubeai.endpoints.fanout.limited"
+	EndpointFanoutLimited           metric.Int64Counter
+	// InferenceRequestEndpoints is the number of distinct endpoints that
+	// a request was sent to (including retries).
+	InferenceRequestEndpointsMetricName = "kubeai.inference.requests.endpoints"
+	InferenceRequestEndpoints           metric.Int64Histogram
+	// InferenceCoalescedEmbeddings is the number of embeddings requests
+	// that were sent to a model server in one request.
+	InferenceCoalescedEmbeddingsMetricName = "kubeai.inference.embeddings.coalesced"
+	InferenceCoalescedEmbeddings           metric.Int64Histogram
+
+	AdmissionDenialsMetricName = "kubeai.admission.denials"
+	AdmissionDenials           metric.Int64Counter
+	// ModerationFlagged counts requests that were rejected because they
+	// were flagged by the safety policy of their Model.
+	ModerationFlaggedMetricName = "kubeai.moderation.flagged"
+	ModerationFlagged           metric.Int64Counter
+	// InferencePromptTokens and InferenceCompletionTokens count the tokens
+	// of completions and chat completions from the usage of the responses
+	// (estimated if a streamed response had no usage).
+	InferencePromptTokensMetricName     = "kubeai.inference.tokens.prompt"
+	InferencePromptTokens               metric.Int64Counter
+	InferenceCompletionTokensMetricName = "kubeai.inference.tokens.completion"
+	InferenceCompletionTokens           metric.Int64Counter
+	// InferenceStructuredOutputs counts the responses to requests with a
+	// JSON response format that the proxy checked by result (see
+	// AttrStructuredOutputResult).
+	InferenceStructuredOutputsMetricName = "kubeai.inference.structured_outputs"
+	InferenceStructuredOutputs           metric.Int64Counter
 )
 
 // Attributes:
 var (
 	AttrRequestModel = attribute.Key("request.model")
 	AttrRequestType  = attribute.Key("request.type")
+	// AttrAdmissionRule is the name of the admission policy rule that denied a request.
+	AttrAdmissionRule = attribute.Key("admission.rule")
+	// AttrMessengerStream is the index of the messaging stream in the system config.
+	AttrMessengerStream = attribute.Key("messenger.stream")
+	// AttrMessengerPriority is the priority class of a request message.
+	AttrMessengerPriority = attribute.Key("messenger.priority")
+	// AttrDeadLetterReason is why a message was published to the dead-letter topic.
+	AttrDeadLetterReason = attribute.Key("dead_letter.reason")
+	// AttrResponseStatusCode is the HTTP status code of a response
+	// (0 if no single response was sent, i.e. for batches).
+	AttrResponseStatusCode = attribute.Key("response.status_code")
+	// AttrPreemptedModel is the Model that was scaled down to make room for AttrPreemptingModel.
+	AttrPreemptedModel  = attribute.Key("preempted.model")
+	AttrPreemptingModel = attribute.Key("preempting.model")
+
+	AttrWebhookEvent = attribute.Key("webhook.event")
+	// AttrUsageEstimated is true if token counts were estimated by KubeAI
+	// instead of reported by the model server.
+	AttrUsageEstimated = attribute.Key("usage.estimated")
+	// AttrStructuredOutputResult is the result of the check of a structured
+	// output: valid, repaired, retried (valid after a retry) or invalid
+	// (returned although it did not match the schema).
+	AttrStructuredOutputResult = attribute.Key("structured_output.result")
 )
 
 // Attribute values:
 const (
 	AttrRequestTypeHTTP    = "http"
 	AttrRequestTypeMessage = "message"
+
+	AttrStructuredOutputResultValid    = "valid"
+	AttrStructuredOutputResultRepaired = "repaired"
+	AttrStructuredOutputResultRetried  = "retried"
+	AttrStructuredOutputResultInvalid  = "invalid"
 )
 
+func init() {
+	// Default to no-op metrics so that packages can record
+	// metrics before (or without) Init being called (i.e. in unit tests).
+	if err := Init(noop.NewMeterProvider().Meter(MeterName)); err != nil {
+		panic(err)
+	}
+}
+
 // Init sets up global metric variables.
 func Init(meter metric.Meter) error {
 	var err error
@@ -38,6 +202,256 @@ func Init(meter metric.Meter) error {
 	if err != nil {
 		return err
 	}
+	InferenceRequests, err = meter.Int64Counter(InferenceRequestsMetricName,
+		metric.WithDescription("The total number of requests received by model"),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceRequestErrors, err = meter.Int64Counter(InferenceRequestErrorsMetricName,
+		metric.WithDescription("The total number of requests that failed with a server error (5xx) by model"),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceRequestDuration, err = meter.Float64Histogram(InferenceRequestDurationMetricName,
+		metric.WithDescription("The time in seconds taken to serve proxied requests by model"),
+		metric.WithExplicitBucketBoundaries(LatencyBucketBoundaries...),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceTimeToFirstByte, err = meter.Float64Histogram(InferenceTimeToFirstByteMetricName,
+		metric.WithDescription("The time in seconds until the first byte of the response body was received from the model server by model"),
+		metric.WithExplicitBucketBoundaries(LatencyBucketBoundaries...),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceGPUSeconds, err = meter.Float64Counter(InferenceGPUSecondsMetricName,
+		metric.WithDescription("The approximate GPU time in seconds used by requests by model (the time on each endpoint times the endpoint's GPUs divided by its in-flight requests)"),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceDeprecatedRequests, err = meter.Int64Counter(InferenceDeprecatedRequestsMetricName,
+		metric.WithDescription("The total number of requests for deprecated models by model"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerHandlers, err = meter.Int64Gauge(MessengerHandlersMetricName,
+		metric.WithDescription("The maximum number of concurrent handlers of a messaging stream (adjusted over time if adaptive handlers are enabled)"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerBacklog, err = meter.Int64Gauge(MessengerBacklogMetricName,
+		metric.WithDescription("The estimated number of messages waiting in a messaging stream's requests subscription by model"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerDuplicateRequests, err = meter.Int64Counter(MessengerDuplicateRequestsMetricName,
+		metric.WithDescription("The number of redelivered request messages that were answered with a previously published response"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerDeadLettered, err = meter.Int64Counter(MessengerDeadLetteredMetricName,
+		metric.WithDescription("The number of request messages that were published to the dead-letter topic by reason"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerDropped, err = meter.Int64Counter(MessengerDroppedMetricName,
+		metric.WithDescription("The number of request messages that were acknowledged without a response after the stream's maxAttempts"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerExpired, err = meter.Int64Counter(MessengerExpiredMetricName,
+		metric.WithDescription("The number of request messages that were skipped because they expired before they were received"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerConcurrencyLimited, err = meter.Int64Counter(MessengerConcurrencyLimitedMetricName,
+		metric.WithDescription("The number of request messages that waited because their model (or metadata value) reached its concurrency limit"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerQueued, err = meter.Int64UpDownCounter(MessengerQueuedMetricName,
+		metric.WithDescription("The number of received request messages that are waiting for a handler, by priority class"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerOverflowed, err = meter.Int64Counter(MessengerOverflowedMetricName,
+		metric.WithDescription("The number of response bodies that were written to the overflow bucket because the response message would have been too large"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerCoalescedEmbeddings, err = meter.Int64Histogram(MessengerCoalescedEmbeddingsMetricName,
+		metric.WithDescription("The number of embeddings request messages that were coalesced into one request to a model server"),
+		metric.WithExplicitBucketBoundaries(1, 2, 4, 8, 16, 32, 64, 128),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerReceived, err = meter.Int64Counter(MessengerReceivedMetricName,
+		metric.WithDescription("The number of request messages that were received from a messaging stream's requests subscription"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerAcked, err = meter.Int64Counter(MessengerAckedMetricName,
+		metric.WithDescription("The number of request messages that were acknowledged (handled, dead-lettered or dropped)"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerNacked, err = meter.Int64Counter(MessengerNackedMetricName,
+		metric.WithDescription("The number of request messages that were returned to the messaging system for redelivery"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerHandlerDuration, err = meter.Float64Histogram(MessengerHandlerDurationMetricName,
+		metric.WithDescription("The time in seconds taken to handle request messages (from parsing to publishing the response) by response status code"),
+		metric.WithExplicitBucketBoundaries(LatencyBucketBoundaries...),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerBackendResponses, err = meter.Int64Counter(MessengerBackendResponsesMetricName,
+		metric.WithDescription("The number of responses of model servers to request messages by model and status code"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerBacklogAge, err = meter.Float64Gauge(MessengerBacklogAgeMetricName,
+		metric.WithDescription("The time in seconds since the most recently received request message was published"),
+	)
+	if err != nil {
+		return err
+	}
+	MessengerConsecutiveErrors, err = meter.Int64Gauge(MessengerConsecutiveErrorsMetricName,
+		metric.WithDescription("The number of consecutive errors of a messaging stream, which slow down receiving messages"),
+	)
+	if err != nil {
+		return err
+	}
+	WebhookFailures, err = meter.Int64Counter(WebhookFailuresMetricName,
+		metric.WithDescription("The number of webhook events that could not be delivered after retries (or were dropped because the queue was full)"),
+	)
+	if err != nil {
+		return err
+	}
+	ModelReplicasDesired, err = meter.Int64Gauge(ModelReplicasDesiredMetricName,
+		metric.WithDescription("The number of replicas that the autoscaler last calculated for a Model (within its min and max replicas)"),
+	)
+	if err != nil {
+		return err
+	}
+	ModelReplicasActual, err = meter.Int64Gauge(ModelReplicasActualMetricName,
+		metric.WithDescription("The number of ready replicas of a Model at the time of the last autoscaling decision"),
+	)
+	if err != nil {
+		return err
+	}
+	ModelReplicasUnschedulable, err = meter.Int64Gauge(ModelReplicasUnschedulableMetricName,
+		metric.WithDescription("The number of Pods of a Model that are waiting for a Node to be provisioned (unschedulable)"),
+	)
+	if err != nil {
+		return err
+	}
+	ModelPreemptions, err = meter.Int64Counter(ModelPreemptionsMetricName,
+		metric.WithDescription("The number of replicas of lower-priority Models that were scaled down to make room for higher-priority Models"),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceStreamBufferFull, err = meter.Int64Counter(InferenceStreamBufferFullMetricName,
+		metric.WithDescription("The number of times a streaming response buffer was full because a client was reading slower than the model server was producing"),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceStreamEventsCoalesced, err = meter.Int64Counter(InferenceStreamEventsCoalescedMetricName,
+		metric.WithDescription("The number of streaming response events that were merged into other events for slow clients"),
+	)
+	if err != nil {
+		return err
+	}
+	EndpointWaitQueueJumps, err = meter.Int64Counter(EndpointWaitQueueJumpsMetricName,
+		metric.WithDescription("The number of times a request was assigned an endpoint while an earlier request for the same model was still waiting"),
+	)
+	if err != nil {
+		return err
+	}
+	EndpointWaitQueueTimeouts, err = meter.Int64Counter(EndpointWaitQueueTimeoutsMetricName,
+		metric.WithDescription("The number of requests that were rejected because they waited longer than the Model's maxQueueWaitSeconds for an endpoint"),
+	)
+	if err != nil {
+		return err
+	}
+	EndpointFanoutLimited, err = meter.Int64Counter(EndpointFanoutLimitedMetricName,
+		metric.WithDescription("The number of times an endpoint was selected for a request only from the endpoints that the request was already sent to because of the Model's maxEndpointsPerRequest"),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceRequestEndpoints, err = meter.Int64Histogram(InferenceRequestEndpointsMetricName,
+		metric.WithDescription("The number of distinct endpoints that proxied requests were sent to (including retries) by model"),
+		metric.WithExplicitBucketBoundaries(1, 2, 3, 4, 5, 10),
+	)
+	if err != nil {
+		return err
+	}
+
+	InferenceCoalescedEmbeddings, err = meter.Int64Histogram(InferenceCoalescedEmbeddingsMetricName,
+		metric.WithDescription("The number of embeddings requests that were coalesced into one request to a model server by model"),
+		metric.WithExplicitBucketBoundaries(1, 2, 4, 8, 16, 32, 64, 128),
+	)
+	if err != nil {
+		return err
+	}
+
+	AdmissionDenials, err = meter.Int64Counter(AdmissionDenialsMetricName,
+		metric.WithDescription("The number of requests that were denied by admission policies by rule"),
+	)
+	if err != nil {
+		return err
+	}
+
+	ModerationFlagged, err = meter.Int64Counter(ModerationFlaggedMetricName,
+		metric.WithDescription("The number of requests that were rejected by the safety policy of their model by model"),
+	)
+	if err != nil {
+		return err
+	}
+
+	InferencePromptTokens, err = meter.Int64Counter(InferencePromptTokensMetricName,
+		metric.WithDescription("The number of prompt tokens of completion and chat completion requests by model"),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceCompletionTokens, err = meter.Int64Counter(InferenceCompletionTokensMetricName,
+		metric.WithDescription("The number of generated tokens of completion and chat completion requests by model"),
+	)
+	if err != nil {
+		return err
+	}
+	InferenceStructuredOutputs, err = meter.Int64Counter(InferenceStructuredOutputsMetricName,
+		metric.WithDescription("The number of checked outputs of requests with a JSON response format by model and result"),
+	)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -46,6 +460,12 @@ func OtelNameToPromName(name string) string {
 	return strings.ReplaceAll(name, ".", "_")
 }
 
+// OtelCounterNameToPromName returns the name that the Prometheus exporter
+// uses for a monotonic counter.
+func OtelCounterNameToPromName(name string) string {
+	return OtelNameToPromName(name) + "_total"
+}
+
 func OtelAttrToPromLabel(k attribute.Key) string {
 	return OtelNameToPromName(string(k))
 }
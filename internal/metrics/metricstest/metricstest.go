@@ -56,6 +56,63 @@ func RequireActiveRequestsMetric(t *testing.T, mets metricdata.ResourceMetrics,
 	)
 }
 
+func RequireEndpointWaitQueueJumpsMetric(t *testing.T, mets metricdata.ResourceMetrics, model string, val int64) {
+	met := requireMetricExists(t, mets, metrics.MeterName, metrics.EndpointWaitQueueJumpsMetricName)
+	metricdatatest.AssertAggregationsEqual(t,
+		metricdata.Sum[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+			DataPoints: []metricdata.DataPoint[int64]{
+				{
+					Attributes: attribute.NewSet(
+						metrics.AttrRequestModel.String(model),
+					),
+					Value: val,
+				},
+			},
+		},
+		met.Data,
+		metricdatatest.IgnoreExemplars(),
+		metricdatatest.IgnoreTimestamp(),
+	)
+}
+
+func RequireEndpointFanoutLimitedMetric(t *testing.T, mets metricdata.ResourceMetrics, model string, val int64) {
+	met := requireMetricExists(t, mets, metrics.MeterName, metrics.EndpointFanoutLimitedMetricName)
+	metricdatatest.AssertAggregationsEqual(t,
+		metricdata.Sum[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+			DataPoints: []metricdata.DataPoint[int64]{
+				{
+					Attributes: attribute.NewSet(
+						metrics.AttrRequestModel.String(model),
+					),
+					Value: val,
+				},
+			},
+		},
+		met.Data,
+		metricdatatest.IgnoreExemplars(),
+		metricdatatest.IgnoreTimestamp(),
+	)
+}
+
+// RequireCounterMetric requires an Int64Counter to have the value
+// for the attributes.
+func RequireCounterMetric(t *testing.T, mets metricdata.ResourceMetrics, name string, attrs attribute.Set, val int64) {
+	met := requireMetricExists(t, mets, metrics.MeterName, name)
+	sum, ok := met.Data.(metricdata.Sum[int64])
+	require.True(t, ok, "metric %q is not an int64 counter", name)
+	for _, dp := range sum.DataPoints {
+		if dp.Attributes.Equals(&attrs) {
+			require.Equal(t, val, dp.Value, "value of metric %q with attributes %v", name, attrs.Encoded(attribute.DefaultEncoder()))
+			return
+		}
+	}
+	t.Fatalf("metric %q has no data point with attributes %v", name, attrs.Encoded(attribute.DefaultEncoder()))
+}
+
 func requireMetricExists(t *testing.T, mets metricdata.ResourceMetrics, scope, name string) metricdata.Metrics {
 	for _, sm := range mets.ScopeMetrics {
 		if sm.Scope.Name == scope {
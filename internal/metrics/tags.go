@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AttrRequestTagPrefix is prepended to the name of configured request tags.
+const AttrRequestTagPrefix = "request.tag."
+
+// AttrRequestTagOtherValue is recorded for tag values that are not allowed.
+const AttrRequestTagOtherValue = "other"
+
+var (
+	requestTagsMtx sync.RWMutex
+	requestTags    []config.RequestTag
+)
+
+// SetRequestTags configures the tags that are extracted from requests
+// by RequestTagAttributes.
+func SetRequestTags(tags []config.RequestTag) {
+	requestTagsMtx.Lock()
+	defer requestTagsMtx.Unlock()
+	requestTags = tags
+}
+
+// RequestTagAttributes returns the configured request tags as metric attributes.
+// The getHeader function is used to look up header (or message metadata) values.
+// Tags without a value are omitted.
+func RequestTagAttributes(getHeader func(string) string) []attribute.KeyValue {
+	requestTagsMtx.RLock()
+	defer requestTagsMtx.RUnlock()
+
+	var attrs []attribute.KeyValue
+	var claims map[string]any
+	for _, tag := range requestTags {
+		var val string
+		switch {
+		case tag.Header != "":
+			val = getHeader(tag.Header)
+		case tag.JWTClaim != "":
+			if claims == nil {
+				claims = apiutils.BearerTokenClaims(getHeader("Authorization"))
+			}
+			if v, ok := claims[tag.JWTClaim]; ok {
+				val = fmt.Sprint(v)
+			}
+		case tag.Env != "":
+			val = os.Getenv(tag.Env)
+		}
+		if val == "" {
+			continue
+		}
+		if len(tag.AllowedValues) > 0 && !slices.Contains(tag.AllowedValues, val) {
+			val = AttrRequestTagOtherValue
+		}
+		attrs = append(attrs, attribute.String(AttrRequestTagPrefix+tag.Name, val))
+	}
+
+	return attrs
+}
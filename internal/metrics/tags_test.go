@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestRequestTagAttributes(t *testing.T) {
+	t.Setenv("TEST_ENVIRONMENT", "staging")
+	SetRequestTags([]config.RequestTag{
+		{Name: "team", Header: "X-Team"},
+		{Name: "app", JWTClaim: "app"},
+		{Name: "environment", Env: "TEST_ENVIRONMENT"},
+		{Name: "tier", Header: "X-Tier", AllowedValues: []string{"free", "paid"}},
+	})
+	t.Cleanup(func() { SetRequestTags(nil) })
+
+	jwt := func(payload string) string {
+		return "Bearer header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+	}
+
+	cases := []struct {
+		name     string
+		headers  http.Header
+		expected []attribute.KeyValue
+	}{
+		{
+			name: "all tags",
+			headers: http.Header{
+				"X-Team":        {"ml"},
+				"X-Tier":        {"paid"},
+				"Authorization": {jwt(`{"app":"chatbot","sub":"123"}`)},
+			},
+			expected: []attribute.KeyValue{
+				attribute.String("request.tag.team", "ml"),
+				attribute.String("request.tag.app", "chatbot"),
+				attribute.String("request.tag.environment", "staging"),
+				attribute.String("request.tag.tier", "paid"),
+			},
+		},
+		{
+			name: "missing values are omitted",
+			headers: http.Header{
+				"Authorization": {"Bearer not-a-jwt"},
+			},
+			expected: []attribute.KeyValue{
+				attribute.String("request.tag.environment", "staging"),
+			},
+		},
+		{
+			name: "disallowed values",
+			headers: http.Header{
+				"X-Tier": {"enterprise"},
+			},
+			expected: []attribute.KeyValue{
+				attribute.String("request.tag.environment", "staging"),
+				attribute.String("request.tag.tier", "other"),
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, RequestTagAttributes(c.headers.Get))
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package modelautoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/webhooks"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Alerts (also used as Event reasons) detected from KubeAI's own metrics.
+const (
+	AlertHighErrorRate    = "HighErrorRate"
+	AlertQueueGrowing     = "QueueGrowing"
+	AlertNoReadyEndpoints = "NoReadyEndpoints"
+
+	EventReasonAlertResolved = "AlertResolved"
+)
+
+// alertState is the state of the alert evaluation for a Model.
+type alertState struct {
+	observed              bool
+	lastTotal, lastErrors int64
+	queue                 []int64
+	noReadyEndpointsSince time.Time
+	firing                map[string]string
+}
+
+// alertObservation is the load of a Model observed in one autoscaling interval.
+type alertObservation struct {
+	// totalRequests and errorRequests are counters across all KubeAI instances.
+	totalRequests int64
+	errorRequests int64
+	// queued is the number of active requests and messages in the backlog.
+	queued int64
+}
+
+// evaluate returns the alerts that are firing for the Model (by name, with
+// a message describing the anomaly).
+func (s *alertState) evaluate(cfg config.Alerts, m kubeaiv1.Model, o alertObservation, now time.Time) map[string]string {
+	firing := map[string]string{}
+
+	if s.observed && o.totalRequests >= s.lastTotal && o.errorRequests >= s.lastErrors {
+		total, errors := o.totalRequests-s.lastTotal, o.errorRequests-s.lastErrors
+		if total >= cfg.MinRequests && total > 0 && errors*100 >= int64(cfg.ErrorRatePercent)*total {
+			firing[AlertHighErrorRate] = fmt.Sprintf("%d of %d requests failed with a server error (errorRatePercent=%d)", errors, total, cfg.ErrorRatePercent)
+		}
+	}
+	s.observed = true
+	s.lastTotal, s.lastErrors = o.totalRequests, o.errorRequests
+
+	s.queue = append(s.queue, o.queued)
+	if len(s.queue) > cfg.QueueGrowthIntervals+1 {
+		s.queue = s.queue[len(s.queue)-cfg.QueueGrowthIntervals-1:]
+	}
+	if len(s.queue) == cfg.QueueGrowthIntervals+1 && growing(s.queue) {
+		firing[AlertQueueGrowing] = fmt.Sprintf("queued requests grew from %d to %d over %d intervals", s.queue[0], s.queue[len(s.queue)-1], cfg.QueueGrowthIntervals)
+	}
+
+	if ptr.Deref(m.Spec.Replicas, 0) > 0 && m.Status.Replicas.Ready == 0 {
+		if s.noReadyEndpointsSince.IsZero() {
+			s.noReadyEndpointsSince = now
+		}
+		if d := now.Sub(s.noReadyEndpointsSince); d >= cfg.NoReadyEndpointsAfter.Duration {
+			firing[AlertNoReadyEndpoints] = fmt.Sprintf("no ready replicas for %v (desired replicas: %d)", d.Round(time.Second), *m.Spec.Replicas)
+		}
+	} else {
+		s.noReadyEndpointsSince = time.Time{}
+	}
+
+	return firing
+}
+
+// growing returns true if every value is larger than the previous one.
+func growing(values []int64) bool {
+	for i := 1; i < len(values); i++ {
+		if values[i] <= values[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluateAlerts detects anomalies for all Models, records Events when
+// alerts start firing or are resolved, and keeps the alerts annotation
+// of the Models up to date.
+func (a *Autoscaler) evaluateAlerts(ctx context.Context, models []kubeaiv1.Model, agg *metricsAggregation, now time.Time) {
+	if a.alerts.Disabled {
+		return
+	}
+	seen := map[string]struct{}{}
+	for i := range models {
+		m := &models[i]
+		seen[m.Name] = struct{}{}
+
+		s, ok := a.alertsByModel[m.Name]
+		if !ok {
+			s = &alertState{firing: map[string]string{}}
+			a.alertsByModel[m.Name] = s
+		}
+		var queued int64
+		for _, n := range agg.activeRequestsByModel[m.Name] {
+			queued += n
+		}
+		queued += agg.backlog(m.Name)
+
+		firing := s.evaluate(a.alerts, *m, alertObservation{
+			totalRequests: agg.totalRequestsByModel[m.Name],
+			errorRequests: agg.errorRequestsByModel[m.Name],
+			queued:        queued,
+		}, now)
+		for name, msg := range firing {
+			if _, ok := s.firing[name]; !ok {
+				log.Printf("Alert %s firing for model %q: %s", name, m.Name, msg)
+				a.recorder.Eventf(m, corev1.EventTypeWarning, name, "%s", msg)
+				a.notifier.Notify(webhooks.Event{Type: webhooks.EventAlertFiring, Model: m.Name, Reason: name, Message: msg})
+			}
+		}
+		for name := range s.firing {
+			if _, ok := firing[name]; !ok {
+				log.Printf("Alert %s resolved for model %q", name, m.Name)
+				a.recorder.Eventf(m, corev1.EventTypeNormal, EventReasonAlertResolved, "%s resolved", name)
+				a.notifier.Notify(webhooks.Event{Type: webhooks.EventAlertResolved, Model: m.Name, Reason: name, Message: name + " resolved"})
+			}
+		}
+		s.firing = firing
+
+		if annotation := alertsAnnotation(firing); annotation != m.Annotations[kubeaiv1.ModelAlertsAnnotation] {
+			if err := a.setAlertsAnnotation(ctx, m, annotation); err != nil {
+				log.Printf("Failed to update alerts annotation of model %q: %v", m.Name, err)
+			}
+		}
+	}
+	for name := range a.alertsByModel {
+		if _, ok := seen[name]; !ok {
+			delete(a.alertsByModel, name)
+		}
+	}
+}
+
+// alertsAnnotation returns the sorted, comma-separated names of the alerts.
+func alertsAnnotation(firing map[string]string) string {
+	names := make([]string, 0, len(firing))
+	for name := range firing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (a *Autoscaler) setAlertsAnnotation(ctx context.Context, m *kubeaiv1.Model, annotation string) error {
+	patch := client.MergeFrom(m.DeepCopy())
+	if annotation == "" {
+		delete(m.Annotations, kubeaiv1.ModelAlertsAnnotation)
+	} else {
+		if m.Annotations == nil {
+			m.Annotations = map[string]string{}
+		}
+		m.Annotations[kubeaiv1.ModelAlertsAnnotation] = annotation
+	}
+	return a.k8sClient.Patch(ctx, m, patch)
+}
+
+// AlertsStatus is served by the alerts status endpoint.
+type AlertsStatus struct {
+	// Alerting is true if any alert is firing.
+	Alerting bool `json:"alerting"`
+	// Models maps Model names to the alerts that are firing for them.
+	Models map[string][]string `json:"models"`
+}
+
+// NewAlertsHandler returns a handler that serves the alerts that are firing
+// for Models as JSON:
+//
+//	GET /alerts
+//
+// The alerts are read from the Model annotations, so any instance can serve
+// them (not only the leader).
+func (a *Autoscaler) NewAlertsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /alerts", func(w http.ResponseWriter, r *http.Request) {
+		models, err := a.scaler.ListAllModels(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "listing models: %v", err)
+			return
+		}
+		status := alertsStatus(models)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("Failed to encode alerts status: %v", err)
+		}
+	})
+	return mux
+}
+
+func alertsStatus(models []kubeaiv1.Model) AlertsStatus {
+	status := AlertsStatus{Models: map[string][]string{}}
+	for _, m := range models {
+		annotation := m.Annotations[kubeaiv1.ModelAlertsAnnotation]
+		if annotation == "" {
+			continue
+		}
+		status.Alerting = true
+		status.Models[m.Name] = strings.Split(annotation, ",")
+	}
+	return status
+}
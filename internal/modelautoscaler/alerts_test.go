@@ -0,0 +1,64 @@
+package modelautoscaler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestAlertStateEvaluate(t *testing.T) {
+	cfg := config.Alerts{
+		ErrorRatePercent:      10,
+		MinRequests:           10,
+		QueueGrowthIntervals:  3,
+		NoReadyEndpointsAfter: config.Duration{Duration: time.Minute},
+	}
+	m := kubeaiv1.Model{Spec: kubeaiv1.ModelSpec{Replicas: ptr.To[int32](1)}}
+	m.Status.Replicas.Ready = 1
+	s := &alertState{}
+	t0 := time.Now()
+
+	require.Empty(t, s.evaluate(cfg, m, alertObservation{totalRequests: 100, errorRequests: 50}, t0),
+		"first observation should not count previous errors")
+	require.Empty(t, s.evaluate(cfg, m, alertObservation{totalRequests: 105, errorRequests: 55}, t0),
+		"error rate should not be evaluated below minRequests")
+	require.Equal(t, map[string]string{
+		AlertHighErrorRate: "2 of 20 requests failed with a server error (errorRatePercent=10)",
+	}, s.evaluate(cfg, m, alertObservation{totalRequests: 125, errorRequests: 57, queued: 1}, t0))
+	require.Empty(t, s.evaluate(cfg, m, alertObservation{totalRequests: 145, errorRequests: 58, queued: 2}, t0))
+
+	require.Equal(t, map[string]string{
+		AlertQueueGrowing: "queued requests grew from 0 to 5 over 3 intervals",
+	}, s.evaluate(cfg, m, alertObservation{totalRequests: 145, errorRequests: 58, queued: 5}, t0))
+	require.Empty(t, s.evaluate(cfg, m, alertObservation{totalRequests: 145, errorRequests: 58, queued: 5}, t0))
+
+	m.Status.Replicas.Ready = 0
+	require.Empty(t, s.evaluate(cfg, m, alertObservation{totalRequests: 145, errorRequests: 58}, t0))
+	require.Equal(t, map[string]string{
+		AlertNoReadyEndpoints: "no ready replicas for 1m0s (desired replicas: 1)",
+	}, s.evaluate(cfg, m, alertObservation{totalRequests: 145, errorRequests: 58}, t0.Add(time.Minute)))
+	m.Spec.Replicas = ptr.To[int32](0)
+	require.Empty(t, s.evaluate(cfg, m, alertObservation{totalRequests: 145, errorRequests: 58}, t0.Add(2*time.Minute)),
+		"models scaled to zero should not alert")
+}
+
+func TestAlertsStatus(t *testing.T) {
+	require.Equal(t, "HighErrorRate,NoReadyEndpoints", alertsAnnotation(map[string]string{
+		AlertNoReadyEndpoints: "", AlertHighErrorRate: "",
+	}))
+	require.Equal(t, "", alertsAnnotation(map[string]string{}))
+
+	require.Equal(t, AlertsStatus{Models: map[string][]string{}}, alertsStatus([]kubeaiv1.Model{{}}))
+	require.Equal(t, AlertsStatus{
+		Alerting: true,
+		Models:   map[string][]string{"a": {AlertHighErrorRate, AlertQueueGrowing}},
+	}, alertsStatus([]kubeaiv1.Model{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Annotations: map[string]string{kubeaiv1.ModelAlertsAnnotation: "HighErrorRate,QueueGrowing"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+	}))
+}
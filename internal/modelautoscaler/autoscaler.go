@@ -8,12 +8,19 @@ import (
 	"sync"
 	"time"
 
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
 	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/cronwindow"
 	"github.com/substratusai/kubeai/internal/endpoints"
 	"github.com/substratusai/kubeai/internal/leader"
 	"github.com/substratusai/kubeai/internal/modelscaler"
 	"github.com/substratusai/kubeai/internal/movingaverage"
+	"github.com/substratusai/kubeai/internal/webhooks"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -22,22 +29,36 @@ func New(
 	k8sClient client.Client,
 	leaderElection *leader.Election,
 	scaler *modelscaler.ModelScaler,
+	recorder record.EventRecorder,
+	notifier *webhooks.Notifier,
 	resolver *endpoints.Resolver,
 	cfg config.ModelAutoscaling,
+	alerts config.Alerts,
 	metricsPort int,
 	stateConfigMapRef types.NamespacedName,
 	fixedSelfMetricAddrs []string,
 ) (*Autoscaler, error) {
 	a := &Autoscaler{
-		k8sClient:            k8sClient,
-		leaderElection:       leaderElection,
-		scaler:               scaler,
-		resolver:             resolver,
-		movingAvgByModel:     map[string]*movingaverage.Simple{},
-		cfg:                  cfg,
-		metricsPort:          metricsPort,
-		stateConfigMapRef:    stateConfigMapRef,
-		fixedSelfMetricAddrs: fixedSelfMetricAddrs,
+		k8sClient:               k8sClient,
+		leaderElection:          leaderElection,
+		scaler:                  scaler,
+		recorder:                recorder,
+		notifier:                notifier,
+		resolver:                resolver,
+		movingAvgByModel:        map[string]*movingaverage.Simple{},
+		lastActivityByModel:     map[string]modelActivity{},
+		recommendationsByModel:  map[string][]recommendation{},
+		lastLatencyByModel:      map[string]latencyHistograms{},
+		preemptionsByModel:      map[string]preemption{},
+		lastPreemptionByModel:   map[string]time.Time{},
+		verticalPressureByModel: map[string]verticalPressure{},
+		sizingHistoryByModel:    map[string]*sizingHistory{},
+		alerts:                  alerts,
+		alertsByModel:           map[string]*alertState{},
+		cfg:                     cfg,
+		metricsPort:             metricsPort,
+		stateConfigMapRef:       stateConfigMapRef,
+		fixedSelfMetricAddrs:    fixedSelfMetricAddrs,
 	}
 
 	// Load preloaded moving averages from the last known state.
@@ -79,6 +100,9 @@ type Autoscaler struct {
 	leaderElection *leader.Election
 
 	scaler   *modelscaler.ModelScaler
+	recorder record.EventRecorder
+	// notifier sends lifecycle events to webhooks.
+	notifier *webhooks.Notifier
 	resolver *endpoints.Resolver
 
 	cfg config.ModelAutoscaling
@@ -88,16 +112,61 @@ type Autoscaler struct {
 	movingAvgByModelMtx sync.Mutex
 	movingAvgByModel    map[string]*movingaverage.Simple
 
+	// lastActivityByModel is only accessed from the Start() loop.
+	lastActivityByModel map[string]modelActivity
+
+	// recommendationsByModel is only accessed from the Start() loop.
+	recommendationsByModel map[string][]recommendation
+
+	// lastLatencyByModel is only accessed from the Start() loop.
+	lastLatencyByModel map[string]latencyHistograms
+	// latencyByModel is the latency of the last autoscaling interval
+	// (see observeLatencies()).
+	latencyMtx     sync.Mutex
+	latencyByModel map[string]observedLatency
+
+	// preemptionsByModel and lastPreemptionByModel are only accessed from the Start() loop.
+	preemptionsByModel    map[string]preemption
+	lastPreemptionByModel map[string]time.Time
+
+	// verticalPressureByModel is only accessed from the Start() loop.
+	verticalPressureByModel map[string]verticalPressure
+
+	// sizingHistoryByModel is only accessed from the Start() loop.
+	sizingHistoryByModel map[string]*sizingHistory
+
+	alerts config.Alerts
+	// alertsByModel is only accessed from the Start() loop.
+	alertsByModel map[string]*alertState
+
 	fixedSelfMetricAddrs []string
 }
 
 func (a *Autoscaler) Start(ctx context.Context) {
 	ticker := time.NewTicker(a.cfg.Interval.Duration)
 	defer ticker.Stop()
-	for range ticker.C {
-		if ctx.Err() != nil {
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+		}
+		selfAddrs := a.selfMetricAddrs()
+		if len(selfAddrs) == 0 {
+			log.Println("Unable to resolve KubeAI addresses, skipping")
+			continue
+		}
+
+		log.Printf("Aggregating metrics from KubeAI addresses %v", selfAddrs)
+		agg := newMetricsAggregation()
+		if err := aggregateAllMetrics(agg, selfAddrs, "/metrics"); err != nil {
+			log.Printf("Failed to aggregate metrics: %v", err)
+			continue
 		}
+		// Latencies are observed on every instance so that any instance can
+		// serve them as external metrics.
+		a.observeLatencies(agg)
+
 		if !a.leaderElection.IsLeader.Load() {
 			log.Println("Not leader, doing nothing")
 			continue
@@ -115,25 +184,15 @@ func (a *Autoscaler) Start(ctx context.Context) {
 
 		nextModelState := newTotalModelState()
 
-		var selfAddrs []string
-		if len(a.fixedSelfMetricAddrs) > 0 {
-			selfAddrs = a.fixedSelfMetricAddrs
-		} else {
-			selfIPs := a.resolver.GetSelfIPs()
-			for _, ip := range selfIPs {
-				selfAddrs = append(selfAddrs, fmt.Sprintf("%s:%d", ip, a.metricsPort))
-			}
-		}
-		if len(selfAddrs) == 0 {
-			log.Println("Unable to resolve KubeAI addresses, skipping")
-			continue
-		}
+		a.evaluateAlerts(ctx, models, agg, time.Now())
+		a.preempt(ctx, models, time.Now())
 
-		log.Printf("Aggregating metrics from KubeAI addresses %v", selfAddrs)
-		agg := newMetricsAggregation()
-		if err := aggregateAllMetrics(agg, selfAddrs, "/metrics"); err != nil {
-			log.Printf("Failed to aggregate metrics: %v", err)
-			continue
+		var gpuUtilization map[types.NamespacedName]float64
+		if usesGPUUtilization(models) && a.cfg.GPUUtilizationMetricsURL != "" {
+			gpuUtilization, err = scrapeGPUUtilization(a.cfg.GPUUtilizationMetricsURL)
+			if err != nil {
+				log.Printf("Failed to scrape GPU utilization: %v", err)
+			}
 		}
 
 		for _, m := range models {
@@ -141,9 +200,63 @@ func (a *Autoscaler) Start(ctx context.Context) {
 				log.Printf("Model %q has autoscaling disabled, skipping", m.Name)
 				continue
 			}
+			if m.Spec.Engine == kubeaiv1.EchoEngine {
+				// Echo Models are served by KubeAI itself.
+				continue
+			}
+			if active, _, err := cronwindow.ModelActive(&m, time.Now()); err == nil && !active {
+				// The Model is kept at zero replicas by the controller outside
+				// of its active windows. Clear the history so that it is not
+				// scaled up based on old requests once a window opens.
+				a.resetMovingAvgActiveReqPerModel(m.Name)
+				delete(a.recommendationsByModel, m.Name)
+				nextModelState.Models[m.Name] = modelState{}
+				continue
+			}
+
+			if sched, err := activeSchedule(m.Spec.Schedules, time.Now()); err != nil {
+				log.Printf("Failed to evaluate schedules for model %q: %v", m.Name, err)
+			} else if sched != nil {
+				log.Printf("Schedule %q is active for model %q", sched.Start, m.Name)
+				applySchedule(&m, sched)
+			}
 
 			activeRequests, ok := agg.activeRequestsByModel[m.Name]
-			if !ok {
+			// Messages waiting in messaging streams are treated the same as
+			// active requests as they are not yet reflected in the active requests
+			// metric (limited by the number of messaging handlers).
+			backlog := agg.backlog(m.Name)
+			if backlog > 0 {
+				activeRequests = append(activeRequests, backlog)
+				ok = true
+			}
+
+			idleFor := a.observeActivity(m.Name, activeRequests, agg.totalRequestsByModel[m.Name], time.Now())
+			if idleTimeout := m.Spec.ScaleToZeroIdleSeconds; idleTimeout != nil && m.Spec.MinReplicas == 0 &&
+				idleFor >= time.Duration(*idleTimeout)*time.Second {
+				log.Printf("Model %q has been idle for %v, scaling to zero", m.Name, idleFor)
+				// Clear the history so that the Model is not scaled back up
+				// on the next interval based on requests that are no longer active.
+				a.resetMovingAvgActiveReqPerModel(m.Name)
+				delete(a.recommendationsByModel, m.Name)
+				reason := fmt.Sprintf("idle for %v (scaleToZeroIdleSeconds=%d)", idleFor.Round(time.Second), *idleTimeout)
+				if err := a.scaler.Scale(ctx, &m, 0, 0, 0, reason); err != nil {
+					log.Printf("Failed to scale model %q to zero: %v", m.Name, err)
+				} else if m.Spec.Replicas == nil || *m.Spec.Replicas > 0 {
+					a.notifier.Notify(webhooks.Event{
+						Type:    webhooks.EventScaledToZero,
+						Model:   m.Name,
+						Message: "scaled to zero after being " + reason,
+					})
+				}
+				a.updateSizing(ctx, m, sizingSample{readyReplicas: m.Status.Replicas.Ready, kvCacheUsage: -1}, agg.totalRequestsByModel[m.Name])
+				nextModelState.Models[m.Name] = modelState{}
+				continue
+			}
+
+			// Models with schedules are still scaled without metrics so
+			// that the schedule's replica bounds are enforced.
+			if !ok && len(m.Spec.Schedules) == 0 {
 				log.Printf("No metrics found for model %q, skipping", m.Name)
 				continue
 			}
@@ -155,11 +268,137 @@ func (a *Autoscaler) Start(ctx context.Context) {
 			avg := a.getMovingAvgActiveReqPerModel(m.Name)
 			avg.Next(float64(activeRequestSum))
 			avgActiveRequests := avg.Calculate()
-			normalized := avgActiveRequests / float64(*m.Spec.TargetRequests)
+			target := targetRequests(m)
+			normalized := avgActiveRequests / float64(target)
 			ceil := math.Ceil(normalized)
 			log.Printf("Calculated target replicas for model %q: ceil(%v/%v) = %v, current requests: sum(%v) = %v, history: %v",
-				m.Name, avgActiveRequests, *m.Spec.TargetRequests, ceil, activeRequests, activeRequestSum, avg.History())
-			a.scaler.Scale(ctx, &m, int32(ceil), a.cfg.RequiredConsecutiveScaleDowns(*m.Spec.ScaleDownDelaySeconds))
+				m.Name, avgActiveRequests, target, ceil, activeRequests, activeRequestSum, avg.History())
+			replicas := int32(ceil)
+
+			d := decision{
+				model:                 m.Name,
+				currentReplicas:       ptr.Deref(m.Spec.Replicas, 0),
+				dryRun:                m.Spec.AutoscalingDryRun,
+				averageActiveRequests: avgActiveRequests,
+				backlog:               backlog,
+				targetRequests:        target,
+			}
+
+			if tolerance := m.Spec.ScalingTolerancePercent; tolerance != nil && replicas != d.currentReplicas &&
+				withinTolerance(avgActiveRequests, target, d.currentReplicas, *tolerance) {
+				log.Printf("Keeping target replicas for model %q at %v instead of %v (tolerance: %v%%)", m.Name, d.currentReplicas, replicas, *tolerance)
+				d.adjust("tolerance %d->%d (scalingTolerancePercent=%d)", replicas, d.currentReplicas, *tolerance)
+				replicas = d.currentReplicas
+			}
+
+			sig := autoscalingSignals(m)
+			signals := []signal{{name: "requests", replicas: replicas, weight: weight(sig.Weights.Requests)}}
+
+			kvCacheUsage := -1.0
+			if usesBackendMetrics(m) {
+				bm, err := scrapeBackendMetrics(a.resolver.GetAllAddresses(m.Name), "/metrics")
+				if err != nil {
+					// The metrics of the endpoints that were scraped would
+					// understate the load, so the signals are skipped.
+					log.Printf("Failed to scrape backend metrics for model %q, skipping queue depth and kv cache usage: %v", m.Name, err)
+				} else {
+					if bm.endpoints > 0 {
+						kvCacheUsage = bm.kvCacheUsage / float64(bm.endpoints)
+					}
+					log.Printf("Scraped backend metrics for model %q, requests waiting: %v, kv cache usage: %v, endpoints: %v",
+						m.Name, bm.requestsWaiting, bm.kvCacheUsage, bm.endpoints)
+					if r, ok := queueDepthReplicas(m, bm); ok {
+						signals = append(signals, signal{name: "queueDepth", replicas: r, weight: weight(sig.Weights.QueueDepth)})
+					}
+					if r, ok := kvCacheUsageReplicas(m, bm); ok {
+						signals = append(signals, signal{name: "kvCacheUsage", replicas: r, weight: weight(sig.Weights.KVCacheUsage)})
+					}
+				}
+			}
+
+			if m.Spec.TargetGPUUtilizationPercent != nil {
+				if a.cfg.GPUUtilizationMetricsURL == "" {
+					log.Printf("Model %q has a GPU utilization target but modelAutoscaling.gpuUtilizationMetricsURL is not configured", m.Name)
+				} else if gpuUtilization != nil {
+					var pods corev1.PodList
+					if err := a.k8sClient.List(ctx, &pods, client.InNamespace(m.Namespace), client.MatchingLabels{kubeaiv1.PodModelLabel: m.Name}); err != nil {
+						log.Printf("Failed to list pods for model %q: %v", m.Name, err)
+					} else if r, ok := gpuUtilizationReplicas(m, pods.Items, gpuUtilization); ok {
+						signals = append(signals, signal{name: "gpuUtilization", replicas: r, weight: weight(sig.Weights.GPUUtilization)})
+					}
+				}
+			}
+
+			latency := a.observedLatency(m.Name)
+			if latencyReplicas := latencyTargetReplicas(m, latency); latencyReplicas > 0 {
+				log.Printf("Calculated target replicas for model %q from latency: %v, p95 latency: %v, p95 time to first token: %v",
+					m.Name, latencyReplicas, latency.p95Duration, latency.p95TimeToFirstByte)
+				signals = append(signals, signal{name: "latency", replicas: latencyReplicas, weight: weight(sig.Weights.Latency)})
+			}
+
+			if combined := combineSignals(sig.Policy, signals); combined != replicas {
+				formatted := formatSignals(sig.Policy, signals)
+				log.Printf("Combined target replicas for model %q from signals: %v, policy: %v, signals: %v", m.Name, combined, sig.Policy, formatted)
+				d.adjust("signals %d->%d (policy=%s %s)", replicas, combined, sig.Policy, formatted)
+				replicas = combined
+			}
+
+			// Checked before stabilization and limits so that the
+			// actual demand is compared to the current step.
+			resourceProfile, verticalReason := a.verticalTarget(m, avgActiveRequests, replicas, time.Now())
+
+			if window := m.Spec.ScaleDownStabilizationSeconds; window != nil {
+				if stabilized := a.stabilize(m.Name, replicas, time.Duration(*window)*time.Second, time.Now()); stabilized != replicas {
+					log.Printf("Stabilized target replicas for model %q from %v to %v (window: %vs)", m.Name, replicas, stabilized, *window)
+					d.adjust("stabilization %d->%d (scaleDownStabilizationSeconds=%d)", replicas, stabilized, *window)
+					replicas = stabilized
+				}
+			}
+
+			if limited := a.cfg.LimitScaleUp(d.currentReplicas, replicas); limited != replicas {
+				log.Printf("Limiting scale up of model %q from %v to %v replicas (target: %v)", m.Name, d.currentReplicas, limited, replicas)
+				d.adjust("scale up limit %d->%d", replicas, limited)
+				replicas = limited
+			}
+
+			if a.cfg.PauseScaleUpWhileWaitingForNodes && replicas > d.currentReplicas && waitingForNodes(m) {
+				log.Printf("Model %q is waiting for nodes, pausing scale up from %v to %v replicas", m.Name, d.currentReplicas, replicas)
+				d.adjust("waiting for nodes %d->%d", replicas, d.currentReplicas)
+				replicas = d.currentReplicas
+			}
+
+			if p, ok := a.preemptionsByModel[m.Name]; ok && replicas > p.maxReplicas {
+				log.Printf("Model %q was preempted by model %q, limiting replicas from %v to %v", m.Name, p.by, replicas, p.maxReplicas)
+				d.adjust("preempted by %q %d->%d", p.by, replicas, p.maxReplicas)
+				replicas = p.maxReplicas
+			}
+
+			if resourceProfile != "" {
+				// The replicas are switched along with the resource profile,
+				// so that the Pods of the new step replace the current ones
+				// without reducing the capacity of the Model.
+				stepReplicas := replicasForStep(m, resourceProfile, avgActiveRequests)
+				log.Printf("Switching model %q from resource profile %q to %q with %v replicas: %s", m.Name, m.Spec.ResourceProfile, resourceProfile, stepReplicas, verticalReason)
+				if err := a.scaler.SwitchResourceProfile(ctx, &m, resourceProfile, stepReplicas, verticalReason); err != nil {
+					log.Printf("Failed to switch resource profile of model %q: %v", m.Name, err)
+				}
+			} else {
+				d.desiredReplicas = replicas
+				log.Printf("Scale decision: %s", d)
+				if err := a.scaler.Scale(ctx, &m, replicas,
+					a.cfg.RequiredConsecutiveScaleDowns(*m.Spec.ScaleDownDelaySeconds),
+					a.cfg.RequiredConsecutiveScaleUps(ptr.Deref(m.Spec.ScaleUpDelaySeconds, 0)),
+					d.explanation()); err != nil {
+					log.Printf("Failed to scale model %q: %v", m.Name, err)
+				}
+			}
+
+			a.updateSizing(ctx, m, sizingSample{
+				activeRequests: float64(activeRequestSum),
+				readyReplicas:  m.Status.Replicas.Ready,
+				p95Latency:     latency.p95Duration,
+				kvCacheUsage:   kvCacheUsage,
+			}, agg.totalRequestsByModel[m.Name])
 
 			nextModelState.Models[m.Name] = modelState{
 				AverageActiveRequests: avgActiveRequests,
@@ -172,6 +411,18 @@ func (a *Autoscaler) Start(ctx context.Context) {
 	}
 }
 
+// selfMetricAddrs returns the metrics addresses of all KubeAI instances.
+func (a *Autoscaler) selfMetricAddrs() []string {
+	if len(a.fixedSelfMetricAddrs) > 0 {
+		return a.fixedSelfMetricAddrs
+	}
+	var addrs []string
+	for _, ip := range a.resolver.GetSelfIPs() {
+		addrs = append(addrs, fmt.Sprintf("%s:%d", ip, a.metricsPort))
+	}
+	return addrs
+}
+
 func (a *Autoscaler) getMovingAvgActiveReqPerModel(model string) *movingaverage.Simple {
 	a.movingAvgByModelMtx.Lock()
 	avg, ok := a.movingAvgByModel[model]
@@ -183,6 +434,215 @@ func (a *Autoscaler) getMovingAvgActiveReqPerModel(model string) *movingaverage.
 	return avg
 }
 
+func (a *Autoscaler) resetMovingAvgActiveReqPerModel(model string) {
+	a.movingAvgByModelMtx.Lock()
+	a.movingAvgByModel[model] = movingaverage.NewSimple(make([]float64, a.cfg.AverageWindowCount()))
+	a.movingAvgByModelMtx.Unlock()
+}
+
+type modelActivity struct {
+	lastActive    time.Time
+	totalRequests int64
+}
+
+// observeActivity records whether a model has received any requests since the
+// last observation and returns the amount of time that the model has been idle.
+// A model is considered active if it has in-flight requests or if the total number
+// of requests received has changed since the last observation.
+func (a *Autoscaler) observeActivity(model string, activeRequests []int64, totalRequests int64, now time.Time) time.Duration {
+	activity, ok := a.lastActivityByModel[model]
+
+	active := !ok || activity.totalRequests != totalRequests
+	for _, n := range activeRequests {
+		if n > 0 {
+			active = true
+			break
+		}
+	}
+	if active {
+		activity.lastActive = now
+	}
+	activity.totalRequests = totalRequests
+	a.lastActivityByModel[model] = activity
+
+	return now.Sub(activity.lastActive)
+}
+
+func usesBackendMetrics(m kubeaiv1.Model) bool {
+	return m.Spec.Engine == kubeaiv1.VLLMEngine &&
+		(m.Spec.TargetQueueDepth != nil || m.Spec.TargetKVCacheUsagePercent != nil)
+}
+
+// queueDepthReplicas calculates the number of replicas required to keep the
+// per-replica queue depth at the Model's target. It returns false if no
+// queue depth target is set.
+func queueDepthReplicas(m kubeaiv1.Model, bm backendMetrics) (int32, bool) {
+	target := m.Spec.TargetQueueDepth
+	if target == nil {
+		return 0, false
+	}
+	return int32(math.Ceil(bm.requestsWaiting / float64(*target))), true
+}
+
+// kvCacheUsageReplicas calculates the number of replicas required to keep the
+// per-replica KV cache utilization at the Model's target. It returns false if
+// no KV cache utilization target is set.
+func kvCacheUsageReplicas(m kubeaiv1.Model, bm backendMetrics) (int32, bool) {
+	target := m.Spec.TargetKVCacheUsagePercent
+	if target == nil {
+		return 0, false
+	}
+	// KV cache usage is reported as a fraction (0-1) by vLLM.
+	return int32(math.Ceil(bm.kvCacheUsage * 100 / float64(*target))), true
+}
+
+func usesGPUUtilization(models []kubeaiv1.Model) bool {
+	for _, m := range models {
+		if m.Spec.TargetGPUUtilizationPercent != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// gpuUtilizationReplicas calculates the number of replicas required to keep
+// the per-replica GPU utilization at the Model's target. It returns false if
+// no GPU utilization target is set or no utilization was reported for the
+// Model's Pods.
+func gpuUtilizationReplicas(m kubeaiv1.Model, pods []corev1.Pod, utilization map[types.NamespacedName]float64) (int32, bool) {
+	target := m.Spec.TargetGPUUtilizationPercent
+	if target == nil {
+		return 0, false
+	}
+	var sum float64
+	var reported bool
+	for _, pod := range pods {
+		if u, ok := utilization[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}]; ok {
+			sum += u
+			reported = true
+		}
+	}
+	if !reported {
+		return 0, false
+	}
+	return int32(math.Ceil(sum / float64(*target))), true
+}
+
+type latencyHistograms struct {
+	requestDuration histogram
+	timeToFirstByte histogram
+}
+
+// observedLatency is the latency of the requests for a model that were
+// completed since the last observation.
+type observedLatency struct {
+	// p95Duration and p95TimeToFirstByte are 0 if there were no observations.
+	p95Duration        time.Duration
+	p95TimeToFirstByte time.Duration
+}
+
+// observeLatencies records the latency of the requests for each model
+// that were completed since the previous autoscaling interval.
+func (a *Autoscaler) observeLatencies(agg *metricsAggregation) {
+	current := map[string]latencyHistograms{}
+	for model := range agg.requestDurationByModel {
+		current[model] = agg.latencyHistograms(model)
+	}
+	for model := range agg.timeToFirstByteByModel {
+		current[model] = agg.latencyHistograms(model)
+	}
+	latencies := make(map[string]observedLatency, len(current))
+	for model, histograms := range current {
+		latencies[model] = latencySince(histograms, a.lastLatencyByModel[model])
+	}
+	a.lastLatencyByModel = current
+
+	a.latencyMtx.Lock()
+	defer a.latencyMtx.Unlock()
+	a.latencyByModel = latencies
+}
+
+// observedLatency returns the latency of the requests for a model in
+// the last autoscaling interval.
+func (a *Autoscaler) observedLatency(model string) observedLatency {
+	a.latencyMtx.Lock()
+	defer a.latencyMtx.Unlock()
+	return a.latencyByModel[model]
+}
+
+// latencySince returns the latency of the requests that were completed
+// between two observations of the latency histograms.
+func latencySince(current, last latencyHistograms) observedLatency {
+	var l observedLatency
+	if p95, ok := current.requestDuration.sub(last.requestDuration).quantile(0.95); ok {
+		l.p95Duration = time.Duration(p95 * float64(time.Second))
+	}
+	if p95, ok := current.timeToFirstByte.sub(last.timeToFirstByte).quantile(0.95); ok {
+		l.p95TimeToFirstByte = time.Duration(p95 * float64(time.Second))
+	}
+	return l
+}
+
+// latencyTargetReplicas calculates the number of replicas required to keep the
+// observed latency under the Model's targets, assuming that latency decreases
+// proportionally with the number of replicas. It returns 0 if no latency
+// targets are set or if there were no observations.
+func latencyTargetReplicas(m kubeaiv1.Model, l observedLatency) int32 {
+	current := float64(ptr.Deref(m.Spec.Replicas, 0))
+	var replicas float64
+	if target := m.Spec.TargetP95LatencyMilliseconds; target != nil && l.p95Duration > 0 {
+		replicas = math.Max(replicas, math.Ceil(current*float64(l.p95Duration.Milliseconds())/float64(*target)))
+	}
+	if target := m.Spec.TargetP95TimeToFirstTokenMilliseconds; target != nil && l.p95TimeToFirstByte > 0 {
+		replicas = math.Max(replicas, math.Ceil(current*float64(l.p95TimeToFirstByte.Milliseconds())/float64(*target)))
+	}
+	return int32(replicas)
+}
+
+type recommendation struct {
+	replicas int32
+	time     time.Time
+}
+
+// waitingForNodes returns true if the Model has unschedulable Pods
+// according to its WaitingForNodes condition.
+func waitingForNodes(m kubeaiv1.Model) bool {
+	return meta.IsStatusConditionTrue(m.Status.Conditions, kubeaiv1.ModelConditionWaitingForNodes)
+}
+
+// withinTolerance returns true if the average active requests per current
+// replica are within the tolerance (in percent) of the target requests.
+func withinTolerance(averageActiveRequests float64, targetRequests, currentReplicas, tolerancePercent int32) bool {
+	if currentReplicas <= 0 {
+		return false
+	}
+	ratio := averageActiveRequests / float64(currentReplicas) / float64(targetRequests)
+	return math.Abs(ratio-1) <= float64(tolerancePercent)/100
+}
+
+// stabilize records the desired number of replicas for a model and returns
+// the highest number of replicas that was desired within the given window.
+func (a *Autoscaler) stabilize(model string, replicas int32, window time.Duration, now time.Time) int32 {
+	recs := append(a.recommendationsByModel[model], recommendation{replicas: replicas, time: now})
+
+	// Drop recommendations that are outside of the window.
+	cutoff := now.Add(-window)
+	var start int
+	for start < len(recs) && recs[start].time.Before(cutoff) {
+		start++
+	}
+	recs = recs[start:]
+	a.recommendationsByModel[model] = recs
+
+	max := replicas
+	for _, r := range recs {
+		if r.replicas > max {
+			max = r.replicas
+		}
+	}
+	return max
+}
+
 func newPrefilledFloat64Slice(length int, value float64) []float64 {
 	s := make([]float64, length)
 	for i := range s {
@@ -0,0 +1,198 @@
+package modelautoscaler
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+)
+
+func TestObserveActivity(t *testing.T) {
+	const model = "my-model"
+	a := &Autoscaler{lastActivityByModel: map[string]modelActivity{}}
+	t0 := time.Now()
+
+	require.Equal(t, time.Duration(0), a.observeActivity(model, nil, 0, t0),
+		"first observation should count as activity")
+	require.Equal(t, time.Minute, a.observeActivity(model, []int64{0, 0}, 0, t0.Add(time.Minute)),
+		"no active or new requests should accumulate idle time")
+	require.Equal(t, time.Duration(0), a.observeActivity(model, []int64{0, 1}, 0, t0.Add(2*time.Minute)),
+		"active requests should reset idle time")
+	require.Equal(t, time.Minute, a.observeActivity(model, []int64{0, 0}, 0, t0.Add(3*time.Minute)))
+	require.Equal(t, time.Duration(0), a.observeActivity(model, []int64{0, 0}, 5, t0.Add(4*time.Minute)),
+		"requests completed between observations should reset idle time")
+	require.Equal(t, time.Minute, a.observeActivity(model, nil, 5, t0.Add(5*time.Minute)))
+	require.Equal(t, time.Duration(0), a.observeActivity(model, nil, 2, t0.Add(6*time.Minute)),
+		"counter reset (i.e. KubeAI restart) should count as activity")
+}
+
+func TestBackendMetricsReplicas(t *testing.T) {
+	cases := []struct {
+		name                 string
+		spec                 kubeaiv1.ModelSpec
+		metrics              backendMetrics
+		expectedQueueDepth   int32
+		expectedKVCacheUsage int32
+	}{
+		{
+			name:    "no targets",
+			metrics: backendMetrics{endpoints: 2, requestsWaiting: 100, kvCacheUsage: 1.8},
+		},
+		{
+			name:               "queue depth",
+			spec:               kubeaiv1.ModelSpec{TargetQueueDepth: ptr.To[int32](10)},
+			metrics:            backendMetrics{endpoints: 2, requestsWaiting: 25},
+			expectedQueueDepth: 3,
+		},
+		{
+			name:                 "kv cache usage",
+			spec:                 kubeaiv1.ModelSpec{TargetKVCacheUsagePercent: ptr.To[int32](60)},
+			metrics:              backendMetrics{endpoints: 2, kvCacheUsage: 1.8},
+			expectedKVCacheUsage: 3,
+		},
+		{
+			name: "both targets",
+			spec: kubeaiv1.ModelSpec{
+				TargetQueueDepth:          ptr.To[int32](10),
+				TargetKVCacheUsagePercent: ptr.To[int32](80),
+			},
+			metrics:              backendMetrics{endpoints: 3, requestsWaiting: 45, kvCacheUsage: 2.4},
+			expectedQueueDepth:   5,
+			expectedKVCacheUsage: 3,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := kubeaiv1.Model{Spec: c.spec}
+			queueDepth, ok := queueDepthReplicas(m, c.metrics)
+			require.Equal(t, c.spec.TargetQueueDepth != nil, ok)
+			require.Equal(t, c.expectedQueueDepth, queueDepth)
+			kvCacheUsage, ok := kvCacheUsageReplicas(m, c.metrics)
+			require.Equal(t, c.spec.TargetKVCacheUsagePercent != nil, ok)
+			require.Equal(t, c.expectedKVCacheUsage, kvCacheUsage)
+		})
+	}
+}
+
+func TestGPUUtilizationReplicas(t *testing.T) {
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "model-a-0"}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "model-a-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "model-a-2"}},
+	}
+	utilization := map[types.NamespacedName]float64{
+		{Namespace: "default", Name: "model-a-0"}: 90,
+		{Namespace: "default", Name: "model-a-1"}: 80,
+		{Namespace: "other", Name: "model-a-2"}:   100,
+	}
+
+	_, ok := gpuUtilizationReplicas(kubeaiv1.Model{}, pods, utilization)
+	require.False(t, ok, "no target")
+
+	m := kubeaiv1.Model{Spec: kubeaiv1.ModelSpec{TargetGPUUtilizationPercent: ptr.To[int32](60)}}
+	r, ok := gpuUtilizationReplicas(m, pods, utilization)
+	require.True(t, ok)
+	require.Equal(t, int32(3), r)
+
+	_, ok = gpuUtilizationReplicas(m, pods, map[types.NamespacedName]float64{})
+	require.False(t, ok, "no utilization reported for the Model's Pods")
+}
+
+func TestStabilize(t *testing.T) {
+	const model = "my-model"
+	a := &Autoscaler{recommendationsByModel: map[string][]recommendation{}}
+	t0 := time.Now()
+	window := 5 * time.Minute
+
+	require.Equal(t, int32(3), a.stabilize(model, 3, window, t0))
+	require.Equal(t, int32(5), a.stabilize(model, 5, window, t0.Add(time.Minute)),
+		"scale up should not be delayed")
+	require.Equal(t, int32(5), a.stabilize(model, 1, window, t0.Add(2*time.Minute)),
+		"scale down should use the highest recommendation in the window")
+	require.Equal(t, int32(5), a.stabilize(model, 2, window, t0.Add(6*time.Minute)))
+	require.Equal(t, int32(2), a.stabilize(model, 1, window, t0.Add(6*time.Minute+time.Second)),
+		"recommendations outside of the window should be dropped")
+	require.Len(t, a.recommendationsByModel[model], 3)
+}
+
+func TestLatencyTargetReplicas(t *testing.T) {
+	cases := []struct {
+		name     string
+		spec     kubeaiv1.ModelSpec
+		latency  observedLatency
+		expected int32
+	}{
+		{
+			name:     "no targets",
+			spec:     kubeaiv1.ModelSpec{Replicas: ptr.To[int32](2)},
+			latency:  observedLatency{p95Duration: 10 * time.Second},
+			expected: 0,
+		},
+		{
+			name: "no observations",
+			spec: kubeaiv1.ModelSpec{
+				Replicas:                     ptr.To[int32](2),
+				TargetP95LatencyMilliseconds: ptr.To[int32](1000),
+			},
+			expected: 0,
+		},
+		{
+			name: "latency over target",
+			spec: kubeaiv1.ModelSpec{
+				Replicas:                     ptr.To[int32](2),
+				TargetP95LatencyMilliseconds: ptr.To[int32](1000),
+			},
+			latency:  observedLatency{p95Duration: 2500 * time.Millisecond},
+			expected: 5,
+		},
+		{
+			name: "highest target wins",
+			spec: kubeaiv1.ModelSpec{
+				Replicas:                              ptr.To[int32](2),
+				TargetP95LatencyMilliseconds:          ptr.To[int32](10000),
+				TargetP95TimeToFirstTokenMilliseconds: ptr.To[int32](200),
+			},
+			latency:  observedLatency{p95Duration: 5 * time.Second, p95TimeToFirstByte: 300 * time.Millisecond},
+			expected: 3,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, latencyTargetReplicas(kubeaiv1.Model{Spec: c.spec}, c.latency))
+		})
+	}
+}
+
+func TestObserveLatency(t *testing.T) {
+	const model = "my-model"
+	inf := math.Inf(1)
+	a := &Autoscaler{lastLatencyByModel: map[string]latencyHistograms{}}
+
+	agg := newMetricsAggregation()
+	agg.requestDurationByModel[model] = histogram{1: 100, 2: 100, inf: 100}
+	a.observeLatencies(agg)
+	l := a.observedLatency(model)
+	require.Equal(t, 950*time.Millisecond, l.p95Duration)
+	require.Equal(t, time.Duration(0), l.p95TimeToFirstByte, "no observations")
+
+	agg = newMetricsAggregation()
+	agg.requestDurationByModel[model] = histogram{1: 100, 2: 200, inf: 200}
+	a.observeLatencies(agg)
+	l = a.observedLatency(model)
+	require.Equal(t, 1950*time.Millisecond, l.p95Duration, "only requests since the last observation should be considered")
+	require.Equal(t, l, a.observedLatency(model), "reading the latency should not change it")
+}
+
+func TestWithinTolerance(t *testing.T) {
+	require.True(t, withinTolerance(310, 100, 3, 10), "3.1 requests per target should keep 3 replicas")
+	require.True(t, withinTolerance(270, 100, 3, 10))
+	require.False(t, withinTolerance(340, 100, 3, 10))
+	require.False(t, withinTolerance(260, 100, 3, 10))
+	require.False(t, withinTolerance(10, 100, 0, 10), "scaling up from zero should not be prevented")
+}
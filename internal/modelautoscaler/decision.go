@@ -0,0 +1,48 @@
+package modelautoscaler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// decision records the inputs and output of a single autoscaling
+// calculation for a Model so that it can be logged and attached to Events.
+type decision struct {
+	model string
+
+	currentReplicas int32
+	desiredReplicas int32
+	// dryRun is true if the desired replicas are only recorded.
+	dryRun bool
+
+	averageActiveRequests float64
+	backlog               int64
+	targetRequests        int32
+
+	// adjustments describe (in order) the steps that changed the desired
+	// replicas after the calculation based on active requests.
+	adjustments []string
+}
+
+func (d *decision) adjust(format string, args ...any) {
+	d.adjustments = append(d.adjustments, fmt.Sprintf(format, args...))
+}
+
+// explanation returns the inputs of the decision as a human readable string.
+func (d decision) explanation() string {
+	s := fmt.Sprintf("averageActiveRequests=%.2f backlog=%d targetRequests=%d",
+		d.averageActiveRequests, d.backlog, d.targetRequests)
+	if len(d.adjustments) > 0 {
+		s += " adjustments=[" + strings.Join(d.adjustments, "; ") + "]"
+	}
+	return s
+}
+
+// String returns the decision as structured key=value pairs.
+func (d decision) String() string {
+	s := fmt.Sprintf("model=%q currentReplicas=%d desiredReplicas=%d", d.model, d.currentReplicas, d.desiredReplicas)
+	if d.dryRun {
+		s += " dryRun=true"
+	}
+	return s + " " + d.explanation()
+}
@@ -0,0 +1,35 @@
+package modelautoscaler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecisionString(t *testing.T) {
+	d := decision{
+		model:                 "my-model",
+		currentReplicas:       2,
+		averageActiveRequests: 150,
+		backlog:               20,
+		targetRequests:        100,
+	}
+	require.Equal(t, `model="my-model" currentReplicas=2 desiredReplicas=0 averageActiveRequests=150.00 backlog=20 targetRequests=100`, d.String())
+
+	d.adjust("stabilization %d->%d", 2, 3)
+	d.adjust("scale up limit %d->%d", 3, 2)
+	d.desiredReplicas = 2
+	require.Equal(t, "averageActiveRequests=150.00 backlog=20 targetRequests=100 adjustments=[stabilization 2->3; scale up limit 3->2]", d.explanation())
+	require.Equal(t, `model="my-model" currentReplicas=2 desiredReplicas=2 averageActiveRequests=150.00 backlog=20 targetRequests=100 adjustments=[stabilization 2->3; scale up limit 3->2]`, d.String())
+}
+
+func TestDecisionStringDryRun(t *testing.T) {
+	d := decision{
+		model:           "my-model",
+		currentReplicas: 1,
+		desiredReplicas: 3,
+		dryRun:          true,
+		targetRequests:  100,
+	}
+	require.Equal(t, `model="my-model" currentReplicas=1 desiredReplicas=3 dryRun=true averageActiveRequests=0.00 backlog=0 targetRequests=100`, d.String())
+}
@@ -0,0 +1,108 @@
+package modelautoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// ExternalMetrics are the signals that the autoscaler scales a Model on.
+// They are served so that Models can be scaled by HPA-based autoscalers
+// (i.e. the KEDA "metrics-api" scaler) via the Model scale subresource.
+type ExternalMetrics struct {
+	Model string `json:"model"`
+	// ActiveRequests is the number of in-flight requests across all KubeAI instances.
+	ActiveRequests int64 `json:"activeRequests"`
+	// Backlog is the number of messages waiting in messaging streams.
+	Backlog int64 `json:"backlog"`
+	// Concurrency is the sum of ActiveRequests and Backlog
+	// (the value that is compared to .spec.targetRequests).
+	Concurrency int64 `json:"concurrency"`
+	// P95LatencyMilliseconds and P95TimeToFirstTokenMilliseconds are
+	// calculated from the requests that were completed in the last
+	// autoscaling interval (0 if there were none).
+	P95LatencyMilliseconds          int64 `json:"p95LatencyMilliseconds"`
+	P95TimeToFirstTokenMilliseconds int64 `json:"p95TimeToFirstTokenMilliseconds"`
+}
+
+// NewExternalMetricsHandler returns a handler that serves the autoscaling
+// signals of Models as JSON:
+//
+//	GET /external-metrics/models/{model}
+//
+// The request counts are aggregated from all KubeAI instances on every
+// request and the latencies of the last autoscaling interval are observed by
+// every instance, so any instance can serve them (not only the leader).
+func (a *Autoscaler) NewExternalMetricsHandler() http.Handler {
+	h := &externalMetricsHandler{
+		lookupModel: func(ctx context.Context, model string) (bool, error) {
+			// Metrics are only recorded by the name of a Model,
+			// not by its aliases.
+			name, ok, err := a.scaler.LookupModel(ctx, model, "", nil)
+			return ok && name == model, err
+		},
+		selfMetricAddrs: a.selfMetricAddrs,
+		observedLatency: a.observedLatency,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /external-metrics/models/{model}", h.serveModel)
+	return mux
+}
+
+type externalMetricsHandler struct {
+	lookupModel     func(ctx context.Context, model string) (bool, error)
+	selfMetricAddrs func() []string
+	observedLatency func(model string) observedLatency
+}
+
+func (h *externalMetricsHandler) serveModel(w http.ResponseWriter, r *http.Request) {
+	model := r.PathValue("model")
+	exists, err := h.lookupModel(r.Context(), model)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "looking up model: %v", err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "model not found: %s", model)
+		return
+	}
+
+	addrs := h.selfMetricAddrs()
+	if len(addrs) == 0 {
+		writeError(w, http.StatusServiceUnavailable, "unable to resolve KubeAI addresses")
+		return
+	}
+	agg := newMetricsAggregation()
+	if err := aggregateAllMetrics(agg, addrs, "/metrics"); err != nil {
+		// Partial results are still served, matching the autoscaler which
+		// only skips an interval if no metrics could be aggregated.
+		log.Printf("Failed to aggregate metrics for external metrics of model %q: %v", model, err)
+	}
+
+	m := ExternalMetrics{
+		Model:   model,
+		Backlog: agg.backlog(model),
+	}
+	for _, n := range agg.activeRequestsByModel[model] {
+		m.ActiveRequests += n
+	}
+	m.Concurrency = m.ActiveRequests + m.Backlog
+
+	latency := h.observedLatency(model)
+	m.P95LatencyMilliseconds = latency.p95Duration.Milliseconds()
+	m.P95TimeToFirstTokenMilliseconds = latency.p95TimeToFirstByte.Milliseconds()
+
+	writeJSON(w, http.StatusOK, m)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,65 @@
+package modelautoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExternalMetricsHandler(t *testing.T) {
+	newServer := func(active int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "# TYPE kubeai_inference_requests_active gauge")
+			fmt.Fprintf(w, "kubeai_inference_requests_active{request_model=\"my-model\"} %v\n", active)
+			fmt.Fprintln(w, "# TYPE kubeai_messenger_backlog gauge")
+			fmt.Fprintln(w, "kubeai_messenger_backlog{messenger_stream=\"0\",request_model=\"my-model\"} 5")
+		}))
+	}
+	srv1 := newServer(3)
+	defer srv1.Close()
+	srv2 := newServer(4)
+	defer srv2.Close()
+
+	h := &externalMetricsHandler{
+		lookupModel: func(_ context.Context, model string) (bool, error) {
+			return model == "my-model", nil
+		},
+		selfMetricAddrs: func() []string {
+			return []string{
+				strings.TrimPrefix(srv1.URL, "http://"),
+				strings.TrimPrefix(srv2.URL, "http://"),
+			}
+		},
+		observedLatency: func(model string) observedLatency {
+			return observedLatency{p95Duration: 1500 * time.Millisecond}
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /external-metrics/models/{model}", h.serveModel)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/external-metrics/models/my-model", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var m ExternalMetrics
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &m))
+	require.Equal(t, ExternalMetrics{
+		Model:          "my-model",
+		ActiveRequests: 7,
+		Backlog:        5,
+		Concurrency:    12,
+
+		P95LatencyMilliseconds: 1500,
+	}, m)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/external-metrics/models/other-model", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.JSONEq(t, `{"error":"model not found: other-model"}`, w.Body.String())
+}
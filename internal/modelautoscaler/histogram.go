@@ -0,0 +1,82 @@
+package modelautoscaler
+
+import (
+	"math"
+	"sort"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// histogram holds cumulative bucket counts by upper bound.
+// The +Inf bucket holds the total number of observations.
+type histogram map[float64]uint64
+
+// add adds the buckets of a Prometheus histogram to h. The +Inf bucket is
+// added from the sample count because it is optional in the exposition
+// formats (the text format has it, the protobuf format does not).
+func (h histogram) add(ph *io_prometheus_client.Histogram) {
+	for _, b := range ph.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		h[b.GetUpperBound()] += b.GetCumulativeCount()
+	}
+	h[math.Inf(1)] += ph.GetSampleCount()
+}
+
+// sub returns the observations in h that were made since prev.
+// If any bucket count decreased (i.e. a KubeAI instance restarted),
+// h is returned as-is.
+func (h histogram) sub(prev histogram) histogram {
+	delta := make(histogram, len(h))
+	for ub, n := range h {
+		p := prev[ub]
+		if p > n {
+			return h
+		}
+		delta[ub] = n - p
+	}
+	return delta
+}
+
+func (h histogram) count() uint64 {
+	return h[math.Inf(1)]
+}
+
+// quantile estimates the q-quantile (0-1) of the observations by linearly
+// interpolating within buckets (the same approach as PromQL's histogram_quantile).
+// It returns false if there are no observations.
+func (h histogram) quantile(q float64) (float64, bool) {
+	total := h.count()
+	if total == 0 {
+		return 0, false
+	}
+
+	bounds := make([]float64, 0, len(h))
+	for ub := range h {
+		bounds = append(bounds, ub)
+	}
+	sort.Float64s(bounds)
+
+	rank := q * float64(total)
+	var (
+		lowerBound float64
+		lowerCount uint64
+	)
+	for _, ub := range bounds {
+		count := h[ub]
+		if float64(count) >= rank {
+			if math.IsInf(ub, 1) {
+				// The quantile falls in the +Inf bucket, return
+				// the highest finite bound.
+				return lowerBound, true
+			}
+			if count == lowerCount {
+				return ub, true
+			}
+			return lowerBound + (ub-lowerBound)*(rank-float64(lowerCount))/float64(count-lowerCount), true
+		}
+		lowerBound, lowerCount = ub, count
+	}
+	return lowerBound, true
+}
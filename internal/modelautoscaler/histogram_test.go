@@ -0,0 +1,73 @@
+package modelautoscaler
+
+import (
+	"context"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/metrics"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	inf := math.Inf(1)
+
+	_, ok := histogram{}.quantile(0.95)
+	require.False(t, ok, "no observations")
+
+	h := histogram{1: 50, 2: 90, 4: 100, inf: 100}
+	p50, ok := h.quantile(0.5)
+	require.True(t, ok)
+	require.InDelta(t, 1.0, p50, 0.0001)
+	p95, _ := h.quantile(0.95)
+	require.InDelta(t, 3.0, p95, 0.0001)
+
+	p95, _ = histogram{1: 10, 2: 10, inf: 100}.quantile(0.95)
+	require.Equal(t, 2.0, p95, "quantile in +Inf bucket should return the highest finite bound")
+}
+
+func TestHistogramSub(t *testing.T) {
+	inf := math.Inf(1)
+	prev := histogram{1: 5, 2: 10, inf: 10}
+
+	require.Equal(t, histogram{1: 1, 2: 3, inf: 3}, histogram{1: 6, 2: 13, inf: 13}.sub(prev))
+	require.Equal(t, histogram{1: 2, 2: 2, inf: 2}, histogram{1: 2, 2: 2, inf: 2}.sub(prev),
+		"counter reset should return the current histogram")
+}
+
+// TestHistogramFromExporter tests the histograms of the metrics that a real
+// KubeAI instance exports.
+func TestHistogramFromExporter(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	exporter, err := otelprom.New(otelprom.WithRegisterer(reg))
+	require.NoError(t, err)
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(exporter))
+	require.NoError(t, metrics.Init(mp.Meter(metrics.MeterName)))
+
+	attrs := otelmetric.WithAttributes(metrics.AttrRequestModel.String("my-model"))
+	for i := range 100 {
+		d := 0.3
+		if i < 5 {
+			d = 2
+		}
+		metrics.InferenceRequestDuration.Record(context.Background(), d, attrs)
+	}
+
+	srv := httptest.NewServer(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	agg := newMetricsAggregation()
+	require.NoError(t, aggregateAllMetrics(agg, []string{strings.TrimPrefix(srv.URL, "http://")}, "/metrics"))
+
+	h := agg.latencyHistograms("my-model").requestDuration
+	require.Equal(t, uint64(100), h.count())
+	p95, ok := h.quantile(0.95)
+	require.True(t, ok)
+	require.InDelta(t, 0.5, p95, 0.0001, "the p95 should be in the bucket of the 95 fast requests")
+}
@@ -6,54 +6,121 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	io_prometheus_client "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 	"github.com/substratusai/kubeai/internal/metrics"
+	"k8s.io/apimachinery/pkg/types"
 )
 
-func aggregateAllMetrics(agg *metricsAggregation, addrs []string, path string) (err error) {
-	// TODO: Consider concurrently scraping metrics from all endpoints.
-	for _, addr := range addrs {
-		if e := scrapeAndAggregateMetrics(agg, fmt.Sprintf("http://%s%s", addr, path)); e != nil {
-			err = errors.Join(err, e)
+func aggregateAllMetrics(agg *metricsAggregation, addrs []string, path string) error {
+	all, err := scrapeAllMetricFamilies(addrs, path)
+	for _, metricFamilies := range all {
+		if metricFamilies != nil {
+			aggregateMetricFamilies(agg, metricFamilies)
 		}
 	}
-
 	return err
 }
 
+// scrapeTimeout is the maximum time that scraping the metrics of an endpoint
+// may take, so that an unresponsive Pod does not stall the autoscaling loop.
+const scrapeTimeout = 5 * time.Second
+
+var scrapeClient = &http.Client{Timeout: scrapeTimeout}
+
+// scrapeAllMetricFamilies scrapes the metrics of all addresses concurrently.
+// The metric families of addresses that failed to be scraped are nil.
+func scrapeAllMetricFamilies(addrs []string, path string) ([]map[string]*io_prometheus_client.MetricFamily, error) {
+	all := make([]map[string]*io_prometheus_client.MetricFamily, len(addrs))
+	errs := make([]error, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			all[i], errs[i] = scrapeMetricFamilies(fmt.Sprintf("http://%s%s", addr, path))
+		}()
+	}
+	wg.Wait()
+	return all, errors.Join(errs...)
+}
+
 type metricsAggregation struct {
 	activeRequestsByModel map[string][]int64
+	// totalRequestsByModel is the sum of the total request counters
+	// across all KubeAI instances.
+	totalRequestsByModel map[string]int64
+	// errorRequestsByModel is the sum of the server error counters
+	// across all KubeAI instances.
+	errorRequestsByModel map[string]int64
+	// requestDurationByModel and timeToFirstByteByModel are the sums of the
+	// latency histograms across all KubeAI instances.
+	requestDurationByModel map[string]histogram
+	timeToFirstByteByModel map[string]histogram
+	// backlogByModel is the messaging backlog by model and stream.
+	// All KubeAI instances report the backlog of the same streams,
+	// so the maximum reported value is used.
+	backlogByModel map[string]map[string]int64
+}
+
+// backlog returns the total number of messages waiting for the model
+// across all messaging streams.
+func (agg *metricsAggregation) backlog(model string) int64 {
+	var total int64
+	for _, n := range agg.backlogByModel[model] {
+		total += n
+	}
+	return total
+}
+
+// latencyHistograms returns the latency histograms of the model
+// across all KubeAI instances.
+func (agg *metricsAggregation) latencyHistograms(model string) latencyHistograms {
+	return latencyHistograms{
+		requestDuration: agg.requestDurationByModel[model],
+		timeToFirstByte: agg.timeToFirstByteByModel[model],
+	}
 }
 
 func newMetricsAggregation() *metricsAggregation {
 	return &metricsAggregation{
-		activeRequestsByModel: make(map[string][]int64),
+		activeRequestsByModel:  make(map[string][]int64),
+		totalRequestsByModel:   make(map[string]int64),
+		errorRequestsByModel:   make(map[string]int64),
+		requestDurationByModel: make(map[string]histogram),
+		timeToFirstByteByModel: make(map[string]histogram),
+		backlogByModel:         make(map[string]map[string]int64),
 	}
 }
 
-func scrapeAndAggregateMetrics(agg *metricsAggregation, url string) error {
+func scrapeMetricFamilies(url string) (map[string]*io_prometheus_client.MetricFamily, error) {
 	// Perform the HTTP GET request
-	resp, err := http.Get(url)
+	resp, err := scrapeClient.Get(url)
 	if err != nil {
-		return fmt.Errorf("failed to scrape metrics: %w", err)
+		return nil, fmt.Errorf("failed to scrape metrics: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	// Use the expfmt library to parse the Prometheus metrics
 	parser := expfmt.TextParser{}
 	metricFamilies, err := parser.TextToMetricFamilies(strings.NewReader(string(body)))
 	if err != nil {
-		return fmt.Errorf("failed to parse metrics: %w", err)
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
 	}
 
+	return metricFamilies, nil
+}
+
+func aggregateMetricFamilies(agg *metricsAggregation, metricFamilies map[string]*io_prometheus_client.MetricFamily) {
 	if fam, ok := metricFamilies[metrics.OtelNameToPromName(metrics.InferenceRequestsActiveMetricName)]; ok {
 		for _, m := range fam.Metric {
 			for _, label := range m.Label {
@@ -67,7 +134,67 @@ func scrapeAndAggregateMetrics(agg *metricsAggregation, url string) error {
 		}
 	}
 
-	return nil
+	if fam, ok := metricFamilies[metrics.OtelCounterNameToPromName(metrics.InferenceRequestsMetricName)]; ok {
+		for _, m := range fam.Metric {
+			for _, label := range m.Label {
+				if label.GetName() == metrics.OtelAttrToPromLabel(metrics.AttrRequestModel) {
+					agg.totalRequestsByModel[label.GetValue()] += getMetricsValue(fam, m)
+				}
+			}
+		}
+	}
+
+	if fam, ok := metricFamilies[metrics.OtelCounterNameToPromName(metrics.InferenceRequestErrorsMetricName)]; ok {
+		for _, m := range fam.Metric {
+			for _, label := range m.Label {
+				if label.GetName() == metrics.OtelAttrToPromLabel(metrics.AttrRequestModel) {
+					agg.errorRequestsByModel[label.GetValue()] += getMetricsValue(fam, m)
+				}
+			}
+		}
+	}
+
+	if fam, ok := metricFamilies[metrics.OtelNameToPromName(metrics.MessengerBacklogMetricName)]; ok {
+		for _, m := range fam.Metric {
+			var model, stream string
+			for _, label := range m.Label {
+				switch label.GetName() {
+				case metrics.OtelAttrToPromLabel(metrics.AttrRequestModel):
+					model = label.GetValue()
+				case metrics.OtelAttrToPromLabel(metrics.AttrMessengerStream):
+					stream = label.GetValue()
+				}
+			}
+			if model == "" {
+				continue
+			}
+			if agg.backlogByModel[model] == nil {
+				agg.backlogByModel[model] = map[string]int64{}
+			}
+			agg.backlogByModel[model][stream] = max(agg.backlogByModel[model][stream], getMetricsValue(fam, m))
+		}
+	}
+
+	aggregateHistograms(agg.requestDurationByModel, metricFamilies[metrics.OtelNameToPromName(metrics.InferenceRequestDurationMetricName)])
+	aggregateHistograms(agg.timeToFirstByteByModel, metricFamilies[metrics.OtelNameToPromName(metrics.InferenceTimeToFirstByteMetricName)])
+}
+
+func aggregateHistograms(byModel map[string]histogram, fam *io_prometheus_client.MetricFamily) {
+	if fam == nil || fam.GetType() != io_prometheus_client.MetricType_HISTOGRAM {
+		return
+	}
+	for _, m := range fam.Metric {
+		for _, label := range m.Label {
+			if label.GetName() == metrics.OtelAttrToPromLabel(metrics.AttrRequestModel) {
+				h, ok := byModel[label.GetValue()]
+				if !ok {
+					h = histogram{}
+					byModel[label.GetValue()] = h
+				}
+				h.add(m.GetHistogram())
+			}
+		}
+	}
 }
 
 func getMetricsValue(mf *io_prometheus_client.MetricFamily, m *io_prometheus_client.Metric) int64 {
@@ -78,3 +205,91 @@ func getMetricsValue(mf *io_prometheus_client.MetricFamily, m *io_prometheus_cli
 	}
 	return 0
 }
+
+const (
+	vllmNumRequestsWaitingMetricName = "vllm:num_requests_waiting"
+	vllmGPUCacheUsageMetricName      = "vllm:gpu_cache_usage_perc"
+)
+
+// backendMetrics are metrics that are reported by the model servers
+// (as opposed to KubeAI itself).
+type backendMetrics struct {
+	// endpoints is the number of model servers that were successfully scraped.
+	endpoints int
+	// requestsWaiting is the sum of queued requests across all model servers.
+	requestsWaiting float64
+	// kvCacheUsage is the sum of KV cache utilization (0-1) across all model servers.
+	kvCacheUsage float64
+}
+
+// scrapeBackendMetrics scrapes vLLM metrics from all of the given model server
+// addresses. Addresses that fail to be scraped are skipped and reported via the
+// returned error.
+func scrapeBackendMetrics(addrs []string, path string) (backendMetrics, error) {
+	var bm backendMetrics
+	all, err := scrapeAllMetricFamilies(addrs, path)
+	for _, metricFamilies := range all {
+		if metricFamilies == nil {
+			continue
+		}
+		bm.endpoints++
+		bm.requestsWaiting += sumGaugeValues(metricFamilies[vllmNumRequestsWaitingMetricName])
+		bm.kvCacheUsage += sumGaugeValues(metricFamilies[vllmGPUCacheUsageMetricName])
+	}
+	return bm, err
+}
+
+// dcgmGPUUtilMetricName is the GPU utilization (0-100) that is reported by
+// the NVIDIA DCGM exporter.
+const dcgmGPUUtilMetricName = "DCGM_FI_DEV_GPU_UTIL"
+
+// scrapeGPUUtilization scrapes the GPU utilization (0-100) of Pods from
+// DCGM exporter metrics. Series are matched to Pods by their pod and
+// namespace labels. The utilization of Pods with several GPUs is averaged.
+func scrapeGPUUtilization(url string) (map[types.NamespacedName]float64, error) {
+	metricFamilies, err := scrapeMetricFamilies(url)
+	if err != nil {
+		return nil, err
+	}
+	type podUtilization struct {
+		sum  float64
+		gpus int
+	}
+	byPod := map[types.NamespacedName]podUtilization{}
+	for _, m := range metricFamilies[dcgmGPUUtilMetricName].GetMetric() {
+		var pod types.NamespacedName
+		for _, label := range m.GetLabel() {
+			switch label.GetName() {
+			case "pod":
+				pod.Name = label.GetValue()
+			case "namespace":
+				pod.Namespace = label.GetValue()
+			}
+		}
+		if pod.Name == "" {
+			// GPUs that are not used by a Pod.
+			continue
+		}
+		u := byPod[pod]
+		// Federated metrics are untyped.
+		u.sum += m.GetGauge().GetValue() + m.GetUntyped().GetValue()
+		u.gpus++
+		byPod[pod] = u
+	}
+	utilization := make(map[types.NamespacedName]float64, len(byPod))
+	for pod, u := range byPod {
+		utilization[pod] = u.sum / float64(u.gpus)
+	}
+	return utilization, nil
+}
+
+func sumGaugeValues(mf *io_prometheus_client.MetricFamily) float64 {
+	if mf == nil || mf.GetType() != io_prometheus_client.MetricType_GAUGE {
+		return 0
+	}
+	var sum float64
+	for _, m := range mf.Metric {
+		sum += m.GetGauge().GetValue()
+	}
+	return sum
+}
@@ -0,0 +1,101 @@
+package modelautoscaler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestScrapeBackendMetrics(t *testing.T) {
+	newServer := func(waiting, cacheUsage float64) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `# TYPE vllm:num_requests_waiting gauge
+vllm:num_requests_waiting{model_name="my-model"} %v
+# TYPE vllm:gpu_cache_usage_perc gauge
+vllm:gpu_cache_usage_perc{model_name="my-model"} %v
+`, waiting, cacheUsage)
+		}))
+	}
+	srv1 := newServer(3, 0.5)
+	defer srv1.Close()
+	srv2 := newServer(4, 0.25)
+	defer srv2.Close()
+	unreachable := httptest.NewServer(nil)
+	unreachable.Close()
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+
+	defaultClient := scrapeClient
+	scrapeClient = &http.Client{Timeout: 100 * time.Millisecond}
+	t.Cleanup(func() { scrapeClient = defaultClient })
+
+	start := time.Now()
+	bm, err := scrapeBackendMetrics([]string{
+		strings.TrimPrefix(hung.URL, "http://"),
+		strings.TrimPrefix(srv1.URL, "http://"),
+		strings.TrimPrefix(hung.URL, "http://"),
+		strings.TrimPrefix(srv2.URL, "http://"),
+		strings.TrimPrefix(unreachable.URL, "http://"),
+	}, "/metrics")
+	require.Error(t, err, "unreachable and hung endpoints should be reported")
+	require.Less(t, time.Since(start), time.Second, "hung endpoints should time out concurrently")
+	require.Equal(t, backendMetrics{
+		endpoints:       2,
+		requestsWaiting: 7,
+		kvCacheUsage:    0.75,
+	}, bm)
+}
+
+func TestScrapeGPUUtilization(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Federated metrics from Prometheus.
+		fmt.Fprint(w, `# TYPE DCGM_FI_DEV_GPU_UTIL untyped
+DCGM_FI_DEV_GPU_UTIL{gpu="0",namespace="default",pod="model-a-0"} 90
+DCGM_FI_DEV_GPU_UTIL{gpu="1",namespace="default",pod="model-a-0"} 70
+DCGM_FI_DEV_GPU_UTIL{gpu="2",namespace="default",pod="model-a-1"} 20
+DCGM_FI_DEV_GPU_UTIL{gpu="3",namespace="team-b",pod="model-a-1"} 50
+DCGM_FI_DEV_GPU_UTIL{gpu="4",namespace="",pod=""} 0
+`)
+	}))
+	defer srv.Close()
+
+	utilization, err := scrapeGPUUtilization(srv.URL + "/federate")
+	require.NoError(t, err)
+	require.Equal(t, map[types.NamespacedName]float64{
+		{Namespace: "default", Name: "model-a-0"}: 80,
+		{Namespace: "default", Name: "model-a-1"}: 20,
+		{Namespace: "team-b", Name: "model-a-1"}:  50,
+	}, utilization)
+}
+
+func TestAggregateBacklog(t *testing.T) {
+	newServer := func(backlog map[string]int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "# TYPE kubeai_messenger_backlog gauge")
+			for stream, n := range backlog {
+				fmt.Fprintf(w, "kubeai_messenger_backlog{messenger_stream=%q,request_model=\"my-model\"} %v\n", stream, n)
+			}
+		}))
+	}
+	// Both instances observe the same streams.
+	srv1 := newServer(map[string]int{"0": 10, "1": 4})
+	defer srv1.Close()
+	srv2 := newServer(map[string]int{"0": 12, "1": 3})
+	defer srv2.Close()
+
+	agg := newMetricsAggregation()
+	require.NoError(t, aggregateAllMetrics(agg, []string{
+		strings.TrimPrefix(srv1.URL, "http://"),
+		strings.TrimPrefix(srv2.URL, "http://"),
+	}, "/metrics"))
+	require.Equal(t, int64(16), agg.backlog("my-model"), "backlog should be the max across instances, summed across streams")
+	require.Equal(t, int64(0), agg.backlog("other-model"))
+}
@@ -0,0 +1,219 @@
+package modelautoscaler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/metric"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Event reasons recorded on Models when preemption occurs.
+const (
+	EventReasonPreempted      = "Preempted"
+	EventReasonPreemptedModel = "PreemptedModel"
+)
+
+// preemption limits the replicas of a Model that was scaled down to make
+// room for a higher-priority Model.
+type preemption struct {
+	// by is the name of the preempting Model.
+	by string
+	// byReplicas is the number of replicas of the preempting Model at the
+	// time of preemption. The preemption ends once the preempting Model is
+	// scaled below this number of replicas.
+	byReplicas int32
+	// maxReplicas is the number of replicas that the preempted Model is limited to.
+	maxReplicas int32
+}
+
+// preemptionAction is a planned scale down of a lower-priority Model.
+type preemptionAction struct {
+	victim   string
+	by       string
+	replicas int32
+}
+
+// preempt scales down lower-priority Models to make room for the unschedulable
+// Pods of higher-priority Models. The replicas of preempted Models are updated in place.
+func (a *Autoscaler) preempt(ctx context.Context, models []kubeaiv1.Model, now time.Time) {
+	a.releasePreemptions(models)
+
+	unschedulable := map[string]int32{}
+	for _, m := range models {
+		// Models in dry run mode are not actuated, so they should not
+		// cause other Models to be scaled down.
+		if m.Spec.PriorityClassName == "" || m.Spec.AutoscalingDryRun {
+			continue
+		}
+		pc, ok := a.cfg.PriorityClasses[m.Spec.PriorityClassName]
+		if !ok {
+			log.Printf("Model %q references unknown priority class %q", m.Name, m.Spec.PriorityClassName)
+			continue
+		}
+		// Give the previous preemption time to take effect.
+		if now.Sub(a.lastPreemptionByModel[m.Name]) < pc.PreemptAfter.Duration {
+			continue
+		}
+		var pods corev1.PodList
+		if err := a.k8sClient.List(ctx, &pods, client.InNamespace(m.Namespace), client.MatchingLabels{"model": m.Name}); err != nil {
+			log.Printf("Failed to list pods for model %q: %v", m.Name, err)
+			continue
+		}
+		if n := unschedulablePods(pods.Items, now.Add(-pc.PreemptAfter.Duration)); n > 0 {
+			unschedulable[m.Name] = n
+		}
+	}
+	if len(unschedulable) == 0 {
+		return
+	}
+
+	modelsByName := map[string]*kubeaiv1.Model{}
+	for i := range models {
+		modelsByName[models[i].Name] = &models[i]
+	}
+	priority := func(m kubeaiv1.Model) int32 {
+		return a.cfg.Priority(m.Spec.PriorityClassName)
+	}
+	for _, action := range planPreemptions(models, priority, unschedulable) {
+		victim, by := modelsByName[action.victim], modelsByName[action.by]
+		replicas := ptr.Deref(victim.Spec.Replicas, 0) - action.replicas
+		log.Printf("Preempting %v replicas of model %q for model %q with %v unschedulable pods",
+			action.replicas, victim.Name, by.Name, unschedulable[by.Name])
+		if err := a.scaler.Scale(ctx, victim, replicas, 0, 0, fmt.Sprintf("preempted by higher priority Model %q", by.Name)); err != nil {
+			log.Printf("Failed to preempt model %q: %v", victim.Name, err)
+			continue
+		}
+		victim.Spec.Replicas = ptr.To(replicas)
+		a.preemptionsByModel[victim.Name] = preemption{
+			by:          by.Name,
+			byReplicas:  ptr.Deref(by.Spec.Replicas, 0),
+			maxReplicas: replicas,
+		}
+		a.lastPreemptionByModel[by.Name] = now
+
+		a.recorder.Eventf(victim, corev1.EventTypeWarning, EventReasonPreempted,
+			"Scaled down by %d replicas to make room for higher priority Model %q", action.replicas, by.Name)
+		a.recorder.Eventf(by, corev1.EventTypeNormal, EventReasonPreemptedModel,
+			"Scaled down Model %q by %d replicas to make room for unschedulable Pods", victim.Name, action.replicas)
+		metrics.ModelPreemptions.Add(ctx, int64(action.replicas), metric.WithAttributes(
+			metrics.AttrPreemptedModel.String(victim.Name),
+			metrics.AttrPreemptingModel.String(by.Name),
+		))
+	}
+}
+
+// releasePreemptions ends preemptions once the preempting Model no longer
+// needs the capacity (it was deleted or scaled down).
+func (a *Autoscaler) releasePreemptions(models []kubeaiv1.Model) {
+	replicas := map[string]int32{}
+	for _, m := range models {
+		replicas[m.Name] = ptr.Deref(m.Spec.Replicas, 0)
+	}
+	for victim, p := range a.preemptionsByModel {
+		if _, ok := replicas[victim]; !ok {
+			delete(a.preemptionsByModel, victim)
+			continue
+		}
+		if byReplicas, ok := replicas[p.by]; !ok || byReplicas < p.byReplicas {
+			log.Printf("Model %q is no longer preempted by model %q", victim, p.by)
+			delete(a.preemptionsByModel, victim)
+		}
+	}
+}
+
+// unschedulablePods returns the number of Pods that have been unable to be
+// scheduled since before the given time.
+func unschedulablePods(pods []corev1.Pod, before time.Time) int32 {
+	var n int32
+	for i := range pods {
+		if since, ok := k8sutils.PodUnschedulableSince(&pods[i]); ok && since.Before(before) {
+			n++
+		}
+	}
+	return n
+}
+
+// planPreemptions returns the replicas of lower-priority Models that should
+// be removed to make room for the unschedulable replicas of higher-priority
+// Models. Only Models with the same resource profile (i.e. "nvidia-gpu-l4")
+// are preempted, taking the number of resources per replica into account.
+// Models are never scaled below their MinReplicas.
+//
+// NOTE: Pending replicas of lower-priority Models are assumed to be running.
+// If too few resources are freed, preemption is repeated after the
+// preempting Model's PreemptAfter duration.
+func planPreemptions(models []kubeaiv1.Model, priority func(kubeaiv1.Model) int32, unschedulable map[string]int32) []preemptionAction {
+	sorted := make([]kubeaiv1.Model, len(models))
+	copy(sorted, models)
+	// Lowest priority first (the order that victims are chosen in).
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if pi, pj := priority(sorted[i]), priority(sorted[j]); pi != pj {
+			return pi < pj
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	available := map[string]int32{}
+	for _, m := range sorted {
+		if m.Spec.AutoscalingDisabled || m.Spec.AutoscalingDryRun {
+			continue
+		}
+		available[m.Name] = max(ptr.Deref(m.Spec.Replicas, 0)-m.Spec.MinReplicas, 0)
+	}
+
+	var actions []preemptionAction
+	// Highest priority preempts first.
+	for i := len(sorted) - 1; i >= 0; i-- {
+		p := sorted[i]
+		if unschedulable[p.Name] == 0 {
+			continue
+		}
+		profile, perReplica := parseResourceProfile(p.Spec.ResourceProfile)
+		if profile == "" {
+			continue
+		}
+		needed := unschedulable[p.Name] * perReplica
+
+		for _, v := range sorted {
+			if needed <= 0 || priority(v) >= priority(p) {
+				break
+			}
+			vProfile, vPerReplica := parseResourceProfile(v.Spec.ResourceProfile)
+			if vProfile != profile || available[v.Name] == 0 {
+				continue
+			}
+			n := min(available[v.Name], int32(math.Ceil(float64(needed)/float64(vPerReplica))))
+			available[v.Name] -= n
+			needed -= n * vPerReplica
+			actions = append(actions, preemptionAction{victim: v.Name, by: p.Name, replicas: n})
+		}
+	}
+
+	return actions
+}
+
+// parseResourceProfile splits a Model's resource profile ("<name>:<count>")
+// into the name of the profile and the number of resources per replica.
+func parseResourceProfile(resourceProfile string) (string, int32) {
+	name, count, found := strings.Cut(resourceProfile, ":")
+	if !found {
+		return name, 1
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return name, 1
+	}
+	return name, int32(n)
+}
@@ -0,0 +1,160 @@
+package modelautoscaler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestPlanPreemptions(t *testing.T) {
+	model := func(name, priorityClass, profile string, replicas, minReplicas int32) kubeaiv1.Model {
+		return kubeaiv1.Model{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: kubeaiv1.ModelSpec{
+				PriorityClassName: priorityClass,
+				ResourceProfile:   profile,
+				Replicas:          ptr.To(replicas),
+				MinReplicas:       minReplicas,
+			},
+		}
+	}
+	priorities := map[string]int32{"high": 100, "low": -100}
+	priority := func(m kubeaiv1.Model) int32 { return priorities[m.Spec.PriorityClassName] }
+
+	cases := []struct {
+		name          string
+		models        []kubeaiv1.Model
+		unschedulable map[string]int32
+		exp           []preemptionAction
+	}{
+		{
+			name: "lowest priority is preempted first",
+			models: []kubeaiv1.Model{
+				model("critical", "high", "nvidia-gpu-l4:1", 3, 0),
+				model("default", "", "nvidia-gpu-l4:1", 2, 0),
+				model("batch", "low", "nvidia-gpu-l4:1", 2, 0),
+			},
+			unschedulable: map[string]int32{"critical": 3},
+			exp: []preemptionAction{
+				{victim: "batch", by: "critical", replicas: 2},
+				{victim: "default", by: "critical", replicas: 1},
+			},
+		},
+		{
+			name: "min replicas are respected",
+			models: []kubeaiv1.Model{
+				model("critical", "high", "nvidia-gpu-l4:1", 3, 0),
+				model("batch", "low", "nvidia-gpu-l4:1", 2, 1),
+			},
+			unschedulable: map[string]int32{"critical": 3},
+			exp: []preemptionAction{
+				{victim: "batch", by: "critical", replicas: 1},
+			},
+		},
+		{
+			name: "different resource profiles are not preempted",
+			models: []kubeaiv1.Model{
+				model("critical", "high", "nvidia-gpu-h100:1", 1, 0),
+				model("batch", "low", "nvidia-gpu-l4:1", 2, 0),
+			},
+			unschedulable: map[string]int32{"critical": 1},
+		},
+		{
+			name: "equal priority is not preempted",
+			models: []kubeaiv1.Model{
+				model("a", "low", "nvidia-gpu-l4:1", 1, 0),
+				model("b", "low", "nvidia-gpu-l4:1", 2, 0),
+			},
+			unschedulable: map[string]int32{"a": 1},
+		},
+		{
+			name: "resources per replica are taken into account",
+			models: []kubeaiv1.Model{
+				model("critical", "high", "nvidia-gpu-l4:4", 1, 0),
+				model("batch", "low", "nvidia-gpu-l4:1", 8, 0),
+			},
+			unschedulable: map[string]int32{"critical": 1},
+			exp: []preemptionAction{
+				{victim: "batch", by: "critical", replicas: 4},
+			},
+		},
+		{
+			name: "partial replicas are rounded up",
+			models: []kubeaiv1.Model{
+				model("critical", "high", "nvidia-gpu-l4:1", 1, 0),
+				model("batch", "low", "nvidia-gpu-l4:2", 2, 0),
+			},
+			unschedulable: map[string]int32{"critical": 1},
+			exp: []preemptionAction{
+				{victim: "batch", by: "critical", replicas: 1},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.exp, planPreemptions(c.models, priority, c.unschedulable))
+		})
+	}
+}
+
+func TestUnschedulablePods(t *testing.T) {
+	now := time.Now()
+	pod := func(phase corev1.PodPhase, reason string, since time.Time) corev1.Pod {
+		return corev1.Pod{Status: corev1.PodStatus{
+			Phase: phase,
+			Conditions: []corev1.PodCondition{{
+				Type:               corev1.PodScheduled,
+				Status:             corev1.ConditionFalse,
+				Reason:             reason,
+				LastTransitionTime: metav1.NewTime(since),
+			}},
+		}}
+	}
+	pods := []corev1.Pod{
+		pod(corev1.PodPending, corev1.PodReasonUnschedulable, now.Add(-2*time.Minute)),
+		pod(corev1.PodPending, corev1.PodReasonUnschedulable, now.Add(-2*time.Minute)),
+		// Not unschedulable for long enough.
+		pod(corev1.PodPending, corev1.PodReasonUnschedulable, now),
+		pod(corev1.PodPending, "SchedulingGated", now.Add(-2*time.Minute)),
+		pod(corev1.PodRunning, "", now.Add(-2*time.Minute)),
+	}
+	require.Equal(t, int32(2), unschedulablePods(pods, now.Add(-time.Minute)))
+}
+
+func TestReleasePreemptions(t *testing.T) {
+	a := &Autoscaler{preemptionsByModel: map[string]preemption{
+		"batch-a": {by: "critical", byReplicas: 3, maxReplicas: 0},
+		"batch-b": {by: "critical", byReplicas: 4, maxReplicas: 0},
+		"batch-c": {by: "deleted", byReplicas: 1, maxReplicas: 0},
+	}}
+	a.releasePreemptions([]kubeaiv1.Model{
+		{ObjectMeta: metav1.ObjectMeta{Name: "critical"}, Spec: kubeaiv1.ModelSpec{Replicas: ptr.To[int32](3)}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "batch-a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "batch-b"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "batch-c"}},
+	})
+	require.Equal(t, map[string]preemption{
+		"batch-a": {by: "critical", byReplicas: 3, maxReplicas: 0},
+	}, a.preemptionsByModel)
+}
+
+func TestParseResourceProfile(t *testing.T) {
+	for in, exp := range map[string]struct {
+		name  string
+		count int32
+	}{
+		"nvidia-gpu-l4:2": {"nvidia-gpu-l4", 2},
+		"cpu":             {"cpu", 1},
+		"cpu:invalid":     {"cpu", 1},
+		"":                {"", 1},
+	} {
+		name, count := parseResourceProfile(in)
+		require.Equal(t, exp.name, name, in)
+		require.Equal(t, exp.count, count, in)
+	}
+}
@@ -0,0 +1,46 @@
+package modelautoscaler
+
+import (
+	"fmt"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/cronwindow"
+)
+
+// activeSchedule returns the first of the given schedules that is active
+// at the given time, or nil if none are active.
+func activeSchedule(schedules []kubeaiv1.ModelSchedule, now time.Time) (*kubeaiv1.ModelSchedule, error) {
+	for i, s := range schedules {
+		active, err := scheduleActive(s, now)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %d: %w", i, err)
+		}
+		if active {
+			return &schedules[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// scheduleActive returns true if the schedule started within the
+// last schedule duration.
+func scheduleActive(s kubeaiv1.ModelSchedule, now time.Time) (bool, error) {
+	active, _, err := cronwindow.Window{
+		Start:    s.Start,
+		Duration: s.Duration.Duration,
+		TimeZone: s.TimeZone,
+	}.Open(now)
+	return active, err
+}
+
+// applySchedule overrides the replica bounds of the Model with those of
+// the schedule.
+func applySchedule(m *kubeaiv1.Model, s *kubeaiv1.ModelSchedule) {
+	if s.MinReplicas != nil {
+		m.Spec.MinReplicas = *s.MinReplicas
+	}
+	if s.MaxReplicas != nil {
+		m.Spec.MaxReplicas = s.MaxReplicas
+	}
+}
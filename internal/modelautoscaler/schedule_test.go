@@ -0,0 +1,88 @@
+package modelautoscaler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestActiveSchedule(t *testing.T) {
+	businessHours := kubeaiv1.ModelSchedule{
+		Start:       "0 9 * * 1-5",
+		Duration:    metav1.Duration{Duration: 8 * time.Hour},
+		MinReplicas: ptr.To[int32](4),
+	}
+	newYork := businessHours
+	newYork.TimeZone = "America/New_York"
+	newYork.MinReplicas = ptr.To[int32](2)
+
+	// Wednesday.
+	day := time.Date(2024, 10, 16, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		schedules []kubeaiv1.ModelSchedule
+		now       time.Time
+		expected  *int32
+	}{
+		{
+			name:      "before start",
+			schedules: []kubeaiv1.ModelSchedule{businessHours},
+			now:       day.Add(8*time.Hour + 59*time.Minute),
+		},
+		{
+			name:      "at start",
+			schedules: []kubeaiv1.ModelSchedule{businessHours},
+			now:       day.Add(9 * time.Hour),
+			expected:  ptr.To[int32](4),
+		},
+		{
+			name:      "before end",
+			schedules: []kubeaiv1.ModelSchedule{businessHours},
+			now:       day.Add(16*time.Hour + 59*time.Minute),
+			expected:  ptr.To[int32](4),
+		},
+		{
+			name:      "after end",
+			schedules: []kubeaiv1.ModelSchedule{businessHours},
+			now:       day.Add(17 * time.Hour),
+		},
+		{
+			name:      "weekend",
+			schedules: []kubeaiv1.ModelSchedule{businessHours},
+			now:       day.Add(3*24*time.Hour + 10*time.Hour),
+		},
+		{
+			name:      "time zone",
+			schedules: []kubeaiv1.ModelSchedule{newYork},
+			// 9:00 in New York is 13:00 UTC (EDT).
+			now:      day.Add(13 * time.Hour),
+			expected: ptr.To[int32](2),
+		},
+		{
+			name:      "first active schedule wins",
+			schedules: []kubeaiv1.ModelSchedule{newYork, businessHours},
+			now:       day.Add(13 * time.Hour),
+			expected:  ptr.To[int32](2),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := activeSchedule(c.schedules, c.now)
+			require.NoError(t, err)
+			if c.expected == nil {
+				require.Nil(t, s)
+				return
+			}
+			require.NotNil(t, s)
+			require.Equal(t, *c.expected, *s.MinReplicas)
+		})
+	}
+
+	_, err := activeSchedule([]kubeaiv1.ModelSchedule{{Start: "invalid"}}, day)
+	require.Error(t, err)
+}
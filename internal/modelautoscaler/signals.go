@@ -0,0 +1,84 @@
+package modelautoscaler
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"k8s.io/utils/ptr"
+)
+
+// signal is the number of replicas that a single autoscaling signal
+// (i.e. active requests or queue depth) asks for.
+type signal struct {
+	name     string
+	replicas int32
+	weight   int32
+}
+
+// autoscalingSignals returns the Model's AutoscalingSignals with the
+// default policy applied.
+func autoscalingSignals(m kubeaiv1.Model) kubeaiv1.AutoscalingSignals {
+	var s kubeaiv1.AutoscalingSignals
+	if m.Spec.AutoscalingSignals != nil {
+		s = *m.Spec.AutoscalingSignals
+	}
+	if s.Policy == "" {
+		s.Policy = kubeaiv1.MaxAutoscalingPolicy
+	}
+	return s
+}
+
+// weight returns the weight of a signal, defaulting to 1.
+func weight(w *int32) int32 {
+	return ptr.Deref(w, 1)
+}
+
+// combineSignals combines the number of replicas that the signals ask for
+// according to the policy. Signals with a weight of 0 are ignored. If all
+// signals are ignored, the first signal (active requests) is used.
+func combineSignals(policy kubeaiv1.AutoscalingPolicy, signals []signal) int32 {
+	var (
+		maxReplicas       int32
+		weightedSum       float64
+		weightSum         int64
+		anyWeightedSignal bool
+	)
+	for _, s := range signals {
+		if s.weight <= 0 {
+			continue
+		}
+		anyWeightedSignal = true
+		maxReplicas = max(maxReplicas, s.replicas)
+		weightedSum += float64(s.weight) * float64(s.replicas)
+		weightSum += int64(s.weight)
+	}
+	if !anyWeightedSignal {
+		if len(signals) == 0 {
+			return 0
+		}
+		return signals[0].replicas
+	}
+	if policy == kubeaiv1.AverageAutoscalingPolicy {
+		return int32(math.Ceil(weightedSum / float64(weightSum)))
+	}
+	return maxReplicas
+}
+
+// formatSignals returns the signals as name=replicas pairs, including the
+// weights if they are used by the policy.
+func formatSignals(policy kubeaiv1.AutoscalingPolicy, signals []signal) string {
+	parts := make([]string, 0, len(signals))
+	for _, s := range signals {
+		switch {
+		case s.weight <= 0:
+			parts = append(parts, fmt.Sprintf("%s=%d(ignored)", s.name, s.replicas))
+		case policy == kubeaiv1.AverageAutoscalingPolicy:
+			parts = append(parts, fmt.Sprintf("%s=%d(weight=%d)", s.name, s.replicas, s.weight))
+		default:
+			parts = append(parts, fmt.Sprintf("%s=%d", s.name, s.replicas))
+		}
+	}
+	return strings.Join(parts, " ")
+}
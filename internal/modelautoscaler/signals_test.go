@@ -0,0 +1,29 @@
+package modelautoscaler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+)
+
+func TestCombineSignals(t *testing.T) {
+	signals := []signal{
+		{name: "requests", replicas: 2, weight: 1},
+		{name: "queueDepth", replicas: 5, weight: 2},
+		{name: "latency", replicas: 9, weight: 0},
+	}
+
+	require.Equal(t, int32(5), combineSignals(kubeaiv1.MaxAutoscalingPolicy, signals),
+		"max should ignore signals with a weight of 0")
+	require.Equal(t, int32(4), combineSignals(kubeaiv1.AverageAutoscalingPolicy, signals),
+		"average should round up ((1*2 + 2*5) / 3 = 4)")
+	require.Equal(t, "requests=2 queueDepth=5 latency=9(ignored)", formatSignals(kubeaiv1.MaxAutoscalingPolicy, signals))
+	require.Equal(t, "requests=2(weight=1) queueDepth=5(weight=2) latency=9(ignored)", formatSignals(kubeaiv1.AverageAutoscalingPolicy, signals))
+
+	require.Equal(t, int32(3), combineSignals(kubeaiv1.AverageAutoscalingPolicy, []signal{
+		{name: "requests", replicas: 3, weight: 0},
+	}), "requests should be used if all signals are ignored")
+
+	require.Equal(t, kubeaiv1.MaxAutoscalingPolicy, autoscalingSignals(kubeaiv1.Model{}).Policy)
+}
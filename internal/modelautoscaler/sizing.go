@@ -0,0 +1,178 @@
+package modelautoscaler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// sizingRefreshInterval is the maximum age of a Model's recommendation
+// before it is updated even if the recommended values did not change.
+const sizingRefreshInterval = time.Hour
+
+// maxNumSeqsHeadroom is applied to the observed active requests per
+// replica when recommending --max-num-seqs.
+const maxNumSeqsHeadroom = 1.25
+
+// sizingSample is the load of a Model observed in one autoscaling interval.
+type sizingSample struct {
+	activeRequests    float64
+	readyReplicas     int32
+	completedRequests int64
+	// p95Latency is 0 if no requests were completed.
+	p95Latency time.Duration
+	// kvCacheUsage is the average KV cache utilization (0-1) of the
+	// replicas, or -1 if it was not scraped.
+	kvCacheUsage float64
+}
+
+// sizingHistory holds the samples of a Model within the recommendation
+// window in a ring buffer.
+type sizingHistory struct {
+	samples           []sizingSample
+	next              int
+	lastTotalRequests int64
+}
+
+// observeSizing records a sample for a Model and returns all samples within
+// the recommendation window (oldest first). The completed requests of the
+// sample are calculated from the total requests counter.
+func (a *Autoscaler) observeSizing(model string, s sizingSample, totalRequests int64) []sizingSample {
+	h, ok := a.sizingHistoryByModel[model]
+	if !ok {
+		h = &sizingHistory{lastTotalRequests: totalRequests}
+		a.sizingHistoryByModel[model] = h
+	}
+	if totalRequests >= h.lastTotalRequests {
+		s.completedRequests = totalRequests - h.lastTotalRequests
+	} else {
+		// Counter reset (i.e. KubeAI restart).
+		s.completedRequests = totalRequests
+	}
+	h.lastTotalRequests = totalRequests
+
+	size := a.cfg.RecommendationWindowCount()
+	if len(h.samples) < size {
+		h.samples = append(h.samples, s)
+		return slices.Clone(h.samples)
+	}
+	h.samples[h.next] = s
+	h.next = (h.next + 1) % len(h.samples)
+	return slices.Concat(h.samples[h.next:], h.samples[:h.next])
+}
+
+// updateSizing records a sample for a Model and writes its right-sizing
+// recommendation to the Model's status if it changed.
+func (a *Autoscaler) updateSizing(ctx context.Context, m kubeaiv1.Model, s sizingSample, totalRequests int64) {
+	samples := a.observeSizing(m.Name, s, totalRequests)
+	rec := sizingRecommendation(m, samples, a.cfg.RecommendationWindowCount(), a.cfg.Interval.Duration, time.Now())
+	if rec == nil || !recommendationChanged(m.Status.Recommendation, rec) {
+		return
+	}
+	if err := a.scaler.UpdateRecommendation(ctx, &m, rec); err != nil {
+		log.Printf("Failed to update recommendation of model %q: %v", m.Name, err)
+	}
+}
+
+// sizingRecommendation calculates a right-sizing recommendation for a Model
+// from its samples. It returns nil until samples for at least a quarter of
+// the recommendation window (of the given number of samples) were observed.
+func sizingRecommendation(m kubeaiv1.Model, samples []sizingSample, windowCount int, interval time.Duration, now time.Time) *kubeaiv1.ModelStatusRecommendation {
+	if len(samples) == 0 || len(samples) < windowCount/4 {
+		return nil
+	}
+
+	var (
+		active      = make([]float64, 0, len(samples))
+		perReplica  []float64
+		latencies   []float64
+		kvCacheSum  float64
+		kvCacheN    int
+		completed   int64
+		observedFor = time.Duration(len(samples)) * interval
+	)
+	for _, s := range samples {
+		active = append(active, s.activeRequests)
+		if s.readyReplicas > 0 {
+			perReplica = append(perReplica, s.activeRequests/float64(s.readyReplicas))
+		}
+		if s.p95Latency > 0 {
+			latencies = append(latencies, s.p95Latency.Seconds())
+		}
+		if s.kvCacheUsage >= 0 {
+			kvCacheSum += s.kvCacheUsage
+			kvCacheN++
+		}
+		completed += s.completedRequests
+	}
+	p95Active := percentile(active, 0.95)
+
+	rec := &kubeaiv1.ModelStatusRecommendation{
+		Replicas:        boundReplicas(m, int32(math.Ceil(p95Active/float64(targetRequests(m))))),
+		ObservedSeconds: int64(observedFor.Seconds()),
+		LastUpdateTime:  metav1.NewTime(now),
+	}
+
+	if vs := m.Spec.VerticalScaling; vs != nil && len(vs.Steps) > 0 {
+		rec.ResourceProfile = vs.Steps[len(vs.Steps)-1].ResourceProfile
+		for _, step := range vs.Steps {
+			stepModel := m
+			stepModel.Spec.ResourceProfile = step.ResourceProfile
+			replicas := int32(math.Ceil(p95Active / float64(targetRequests(stepModel))))
+			if m.Spec.MaxReplicas == nil || replicas <= *m.Spec.MaxReplicas {
+				rec.ResourceProfile = step.ResourceProfile
+				rec.Replicas = boundReplicas(m, replicas)
+				break
+			}
+		}
+	}
+
+	if m.Spec.Engine == kubeaiv1.VLLMEngine && len(perReplica) > 0 {
+		rec.MaxNumSeqs = ptr.To(max(1, int32(math.Ceil(percentile(perReplica, 0.95)*maxNumSeqsHeadroom))))
+	}
+
+	rec.Observations = fmt.Sprintf("p95ActiveRequests=%.2f throughput=%.2freq/s", p95Active, float64(completed)/observedFor.Seconds())
+	if len(latencies) > 0 {
+		rec.Observations += fmt.Sprintf(" p95Latency=%v", time.Duration(percentile(latencies, 0.95)*float64(time.Second)).Round(time.Millisecond))
+	}
+	if kvCacheN > 0 {
+		rec.Observations += fmt.Sprintf(" avgKVCacheUsage=%.0f%%", kvCacheSum/float64(kvCacheN)*100)
+	}
+
+	return rec
+}
+
+// boundReplicas limits the replicas to the Model's MinReplicas and MaxReplicas.
+func boundReplicas(m kubeaiv1.Model, replicas int32) int32 {
+	replicas = max(replicas, m.Spec.MinReplicas)
+	if m.Spec.MaxReplicas != nil {
+		replicas = min(replicas, *m.Spec.MaxReplicas)
+	}
+	return replicas
+}
+
+// recommendationChanged returns true if the recommendation should be written
+// to the Model's status.
+func recommendationChanged(existing, rec *kubeaiv1.ModelStatusRecommendation) bool {
+	return existing == nil ||
+		existing.Replicas != rec.Replicas ||
+		existing.ResourceProfile != rec.ResourceProfile ||
+		ptr.Deref(existing.MaxNumSeqs, 0) != ptr.Deref(rec.MaxNumSeqs, 0) ||
+		rec.LastUpdateTime.Sub(existing.LastUpdateTime.Time) >= sizingRefreshInterval
+}
+
+// percentile returns the q-percentile (0-1) of the values using the
+// nearest-rank method.
+func percentile(values []float64, q float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
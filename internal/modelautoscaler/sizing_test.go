@@ -0,0 +1,82 @@
+package modelautoscaler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestObserveSizing(t *testing.T) {
+	const model = "my-model"
+	a := &Autoscaler{
+		cfg: config.ModelAutoscaling{
+			Interval:             config.Duration{Duration: 10 * time.Second},
+			RecommendationWindow: config.Duration{Duration: 30 * time.Second},
+		},
+		sizingHistoryByModel: map[string]*sizingHistory{},
+	}
+
+	samples := a.observeSizing(model, sizingSample{activeRequests: 1}, 10)
+	require.Equal(t, []sizingSample{{activeRequests: 1}}, samples, "first observation should not count completed requests")
+	a.observeSizing(model, sizingSample{activeRequests: 2}, 15)
+	a.observeSizing(model, sizingSample{activeRequests: 3}, 3)
+	samples = a.observeSizing(model, sizingSample{activeRequests: 4}, 5)
+	require.Equal(t, []sizingSample{
+		{activeRequests: 2, completedRequests: 5},
+		{activeRequests: 3, completedRequests: 3},
+		{activeRequests: 4, completedRequests: 2},
+	}, samples, "samples outside of the window should be dropped")
+}
+
+func TestSizingRecommendation(t *testing.T) {
+	now := time.Now()
+	m := kubeaiv1.Model{Spec: kubeaiv1.ModelSpec{
+		Engine:          kubeaiv1.VLLMEngine,
+		ResourceProfile: "l4:1",
+		MinReplicas:     1,
+		MaxReplicas:     ptr.To[int32](4),
+		TargetRequests:  ptr.To[int32](10),
+	}}
+	var samples []sizingSample
+	for i := range 20 {
+		samples = append(samples, sizingSample{
+			activeRequests:    float64(i),
+			readyReplicas:     2,
+			completedRequests: 10,
+			p95Latency:        time.Duration(i) * 100 * time.Millisecond,
+			kvCacheUsage:      0.5,
+		})
+	}
+
+	require.Nil(t, sizingRecommendation(m, samples[:4], 20, 10*time.Second, now),
+		"recommendations require a quarter of the window")
+
+	require.Equal(t, &kubeaiv1.ModelStatusRecommendation{
+		Replicas:        2,
+		MaxNumSeqs:      ptr.To[int32](12),
+		Observations:    "p95ActiveRequests=18.00 throughput=1.00req/s p95Latency=1.9s avgKVCacheUsage=50%",
+		ObservedSeconds: 200,
+		LastUpdateTime:  metav1.NewTime(now),
+	}, sizingRecommendation(m, samples, 20, 10*time.Second, now))
+
+	// The smallest step that serves the load within maxReplicas.
+	m.Spec.TargetRequests = ptr.To[int32](4)
+	m.Spec.VerticalScaling = &kubeaiv1.VerticalScaling{Steps: []kubeaiv1.VerticalScalingStep{
+		{ResourceProfile: "l4:1"},
+		{ResourceProfile: "a100:1", TargetRequests: ptr.To[int32](8)},
+	}}
+	rec := sizingRecommendation(m, samples, 20, 10*time.Second, now)
+	require.Equal(t, "a100:1", rec.ResourceProfile)
+	require.Equal(t, int32(3), rec.Replicas)
+
+	require.True(t, recommendationChanged(nil, rec))
+	require.False(t, recommendationChanged(rec, rec))
+	later := *rec
+	later.LastUpdateTime = metav1.NewTime(now.Add(sizingRefreshInterval))
+	require.True(t, recommendationChanged(rec, &later), "recommendations should be refreshed")
+}
@@ -0,0 +1,94 @@
+package modelautoscaler
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+)
+
+// verticalPressure is the direction in which a Model has been pushing
+// against its current vertical scaling step since a point in time.
+type verticalPressure struct {
+	// direction is 1 if the Model needs a larger step and -1 if
+	// a smaller step would be sufficient.
+	direction int
+	since     time.Time
+}
+
+// targetRequests returns the TargetRequests of the Model's active vertical
+// scaling step, falling back to the Model's TargetRequests.
+func targetRequests(m kubeaiv1.Model) int32 {
+	if step := m.Spec.ActiveVerticalScalingStep(); step != nil && step.TargetRequests != nil {
+		return *step.TargetRequests
+	}
+	return *m.Spec.TargetRequests
+}
+
+// replicasForStep returns the number of replicas that the Model needs to
+// serve the average active requests with the given vertical scaling step.
+func replicasForStep(m kubeaiv1.Model, resourceProfile string, averageActiveRequests float64) int32 {
+	m.Spec.ResourceProfile = resourceProfile
+	return max(1, int32(math.Ceil(averageActiveRequests/float64(targetRequests(m)))))
+}
+
+// verticalTarget returns the resource profile that the Model should be
+// switched to (and why), or "" if it should stay on its current step.
+// The Model needs a larger step if it needs more than MaxReplicas, and
+// a smaller step if the smaller step would be able to serve the average
+// active requests with at most half of MaxReplicas. Either has to be true
+// for SustainedSeconds before a switch is recommended.
+func (a *Autoscaler) verticalTarget(m kubeaiv1.Model, averageActiveRequests float64, replicas int32, now time.Time) (string, string) {
+	vs := m.Spec.VerticalScaling
+	if vs == nil || m.Spec.MaxReplicas == nil {
+		delete(a.verticalPressureByModel, m.Name)
+		return "", ""
+	}
+	i := -1
+	for j, step := range vs.Steps {
+		if step.ResourceProfile == m.Spec.ResourceProfile {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		delete(a.verticalPressureByModel, m.Name)
+		return "", ""
+	}
+
+	maxReplicas := *m.Spec.MaxReplicas
+	var direction int
+	var reason string
+	switch {
+	case i < len(vs.Steps)-1 && replicas > maxReplicas:
+		direction = 1
+		reason = fmt.Sprintf("needed %d replicas (maxReplicas=%d)", replicas, maxReplicas)
+	case i > 0:
+		smaller := m
+		smaller.Spec.ResourceProfile = vs.Steps[i-1].ResourceProfile
+		smallerReplicas := int32(math.Ceil(averageActiveRequests / float64(targetRequests(smaller))))
+		if threshold := max(1, maxReplicas/2); smallerReplicas <= threshold {
+			direction = -1
+			reason = fmt.Sprintf("%s would need %d replicas (<= %d)", smaller.Spec.ResourceProfile, smallerReplicas, threshold)
+		}
+	}
+
+	p, ok := a.verticalPressureByModel[m.Name]
+	if direction == 0 {
+		delete(a.verticalPressureByModel, m.Name)
+		return "", ""
+	}
+	if !ok || p.direction != direction {
+		a.verticalPressureByModel[m.Name] = verticalPressure{direction: direction, since: now}
+		return "", ""
+	}
+
+	sustained := time.Duration(vs.SustainedSeconds) * time.Second
+	if now.Sub(p.since) < sustained {
+		return "", ""
+	}
+	// Require the pressure to be sustained again before the next switch.
+	delete(a.verticalPressureByModel, m.Name)
+	return vs.Steps[i+direction].ResourceProfile, fmt.Sprintf("%s for %v (sustainedSeconds=%d)", reason, now.Sub(p.since).Round(time.Second), vs.SustainedSeconds)
+}
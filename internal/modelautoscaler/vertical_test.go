@@ -0,0 +1,72 @@
+package modelautoscaler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestVerticalTarget(t *testing.T) {
+	model := func(resourceProfile string) kubeaiv1.Model {
+		return kubeaiv1.Model{Spec: kubeaiv1.ModelSpec{
+			ResourceProfile: resourceProfile,
+			MaxReplicas:     ptr.To[int32](4),
+			TargetRequests:  ptr.To[int32](10),
+			VerticalScaling: &kubeaiv1.VerticalScaling{
+				Steps: []kubeaiv1.VerticalScalingStep{
+					{ResourceProfile: "l4:1"},
+					{ResourceProfile: "a100:1", TargetRequests: ptr.To[int32](40)},
+				},
+				SustainedSeconds: 60,
+			},
+		}}
+	}
+	a := &Autoscaler{verticalPressureByModel: map[string]verticalPressure{}}
+	start := time.Now()
+
+	// The replicas of the larger step serve the same load.
+	require.Equal(t, int32(2), replicasForStep(model("l4:1"), "a100:1", 50))
+	require.Equal(t, int32(5), replicasForStep(model("a100:1"), "l4:1", 50))
+	require.Equal(t, int32(1), replicasForStep(model("l4:1"), "a100:1", 0))
+
+	// Saturated at the smaller step.
+	small := model("l4:1")
+	profile, _ := a.verticalTarget(small, 50, 5, start)
+	require.Empty(t, profile, "pressure should not be sustained yet")
+	profile, _ = a.verticalTarget(small, 50, 5, start.Add(30*time.Second))
+	require.Empty(t, profile, "pressure should not be sustained yet")
+	profile, reason := a.verticalTarget(small, 50, 5, start.Add(time.Minute))
+	require.Equal(t, "a100:1", profile)
+	require.Equal(t, "needed 5 replicas (maxReplicas=4) for 1m0s (sustainedSeconds=60)", reason)
+
+	// Pressure is reset when the Model is not saturated.
+	a.verticalTarget(small, 50, 5, start)
+	a.verticalTarget(small, 30, 3, start.Add(30*time.Second))
+	profile, _ = a.verticalTarget(small, 50, 5, start.Add(time.Minute))
+	require.Empty(t, profile)
+
+	// The larger step uses its own targetRequests.
+	large := model("a100:1")
+	require.Equal(t, int32(40), targetRequests(large))
+	require.Equal(t, int32(10), targetRequests(small))
+
+	// Underutilized at the larger step: 15 requests would need 2 L4 replicas.
+	profile, _ = a.verticalTarget(large, 15, 1, start)
+	require.Empty(t, profile)
+	profile, reason = a.verticalTarget(large, 15, 1, start.Add(time.Minute))
+	require.Equal(t, "l4:1", profile)
+	require.Equal(t, "l4:1 would need 2 replicas (<= 2) for 1m0s (sustainedSeconds=60)", reason)
+
+	// 30 requests would need 3 L4 replicas, which is more than half of maxReplicas.
+	a.verticalTarget(large, 30, 1, start)
+	profile, _ = a.verticalTarget(large, 30, 1, start.Add(time.Minute))
+	require.Empty(t, profile)
+
+	// No vertical scaling.
+	small.Spec.VerticalScaling = nil
+	profile, _ = a.verticalTarget(small, 50, 5, start.Add(time.Hour))
+	require.Empty(t, profile)
+}
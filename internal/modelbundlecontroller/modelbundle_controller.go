@@ -0,0 +1,185 @@
+package modelbundlecontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ModelBundleReconciler creates, updates and deletes the Models of
+// ModelBundles and reports their readiness.
+type ModelBundleReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=kubeai.org,resources=modelbundles,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=kubeai.org,resources=modelbundles/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=kubeai.org,resources=modelbundles/finalizers,verbs=update
+
+func (r *ModelBundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, resErr error) {
+	log := log.FromContext(ctx)
+	log.Info("Reconciling ModelBundle")
+
+	bundle := &kubeaiv1.ModelBundle{}
+	if err := r.Get(ctx, req.NamespacedName, bundle); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if bundle.DeletionTimestamp != nil {
+		// The Models are garbage collected along with the bundle.
+		return ctrl.Result{}, nil
+	}
+
+	status0 := bundle.Status.DeepCopy()
+	defer func() {
+		if !reflect.DeepEqual(*status0, bundle.Status) {
+			if err := r.Status().Update(ctx, bundle); err != nil {
+				resErr = errors.Join(resErr, err)
+			}
+		}
+	}()
+
+	var (
+		ready     int32
+		notReady  []string
+		conflicts []string
+		failed    []string
+		errs      []error
+	)
+	for _, bm := range bundle.Spec.Models {
+		model := &kubeaiv1.Model{ObjectMeta: metav1.ObjectMeta{Namespace: bundle.Namespace, Name: bm.Name}}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(model), model); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("getting model: %w", err)
+		} else if err == nil && !metav1.IsControlledBy(model, bundle) {
+			conflicts = append(conflicts, bm.Name)
+			continue
+		}
+
+		if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, model, func() error {
+			model.Spec = bundleModelSpec(bundle, bm, model.Spec)
+			k8sutils.SetLabel(model, kubeaiv1.ModelBundleLabel, bundle.Name)
+			return controllerutil.SetControllerReference(bundle, model, r.Scheme)
+		}); err != nil {
+			failed = append(failed, bm.Name)
+			errs = append(errs, fmt.Errorf("creating or updating model %s: %w", bm.Name, err))
+			continue
+		}
+
+		if meta.IsStatusConditionTrue(model.Status.Conditions, kubeaiv1.ModelConditionReady) {
+			ready++
+		} else {
+			notReady = append(notReady, bm.Name)
+		}
+	}
+
+	if err := r.deleteRemovedModels(ctx, bundle); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	bundle.Status.Models = int32(len(bundle.Spec.Models))
+	bundle.Status.ReadyModels = ready
+	cond := metav1.Condition{
+		Type:               kubeaiv1.ModelBundleConditionReady,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: bundle.Generation,
+	}
+	switch {
+	case len(conflicts) > 0:
+		cond.Reason = kubeaiv1.ModelBundleReasonNameConflict
+		cond.Message = "Models that do not belong to the bundle exist: " + strings.Join(conflicts, ", ")
+	case len(failed) > 0:
+		cond.Reason = kubeaiv1.ModelBundleReasonModelError
+		cond.Message = errors.Join(errs...).Error()
+	case bundle.Spec.Suspended:
+		cond.Reason = kubeaiv1.ModelBundleReasonSuspended
+		cond.Message = "All Models are scaled to zero"
+	case len(notReady) > 0:
+		cond.Reason = kubeaiv1.ModelBundleReasonModelsNotReady
+		cond.Message = "Models not ready: " + strings.Join(notReady, ", ")
+	default:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = kubeaiv1.ModelBundleReasonModelsReady
+		cond.Message = "All Models are ready"
+	}
+	meta.SetStatusCondition(&bundle.Status.Conditions, cond)
+
+	return ctrl.Result{}, errors.Join(errs...)
+}
+
+// bundleModelSpec returns the spec of a Model of the bundle given the
+// current spec of the Model.
+func bundleModelSpec(bundle *kubeaiv1.ModelBundle, bm kubeaiv1.ModelBundleModel, current kubeaiv1.ModelSpec) kubeaiv1.ModelSpec {
+	spec := *bm.Spec.DeepCopy()
+
+	// Each Model is scaled from zero along with the other Models.
+	for _, other := range bundle.Spec.Models {
+		if other.Name != bm.Name && !slices.Contains(spec.Dependencies, other.Name) {
+			spec.Dependencies = append(spec.Dependencies, other.Name)
+		}
+	}
+
+	if bundle.Spec.Suspended {
+		spec.AutoscalingDisabled = true
+		spec.Replicas = ptr.To[int32](0)
+		return spec
+	}
+
+	// Keep what the autoscaler manages: the replicas and the resource
+	// profile of the active vertical scaling step.
+	if spec.Replicas == nil {
+		spec.Replicas = current.Replicas
+	}
+	if spec.VerticalScaling != nil {
+		profile := spec.ResourceProfile
+		spec.ResourceProfile = current.ResourceProfile
+		if spec.ActiveVerticalScalingStep() == nil {
+			spec.ResourceProfile = profile
+		}
+	}
+	return spec
+}
+
+// deleteRemovedModels deletes the Models of the bundle that were removed
+// from its spec.
+func (r *ModelBundleReconciler) deleteRemovedModels(ctx context.Context, bundle *kubeaiv1.ModelBundle) error {
+	var list kubeaiv1.ModelList
+	if err := r.List(ctx, &list, client.InNamespace(bundle.Namespace), client.MatchingLabels{
+		kubeaiv1.ModelBundleLabel: bundle.Name,
+	}); err != nil {
+		return fmt.Errorf("listing models: %w", err)
+	}
+	for i := range list.Items {
+		m := &list.Items[i]
+		if !metav1.IsControlledBy(m, bundle) || slices.ContainsFunc(bundle.Spec.Models, func(bm kubeaiv1.ModelBundleModel) bool {
+			return bm.Name == m.Name
+		}) {
+			continue
+		}
+		if err := r.Delete(ctx, m); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("deleting model %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *ModelBundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kubeaiv1.ModelBundle{}).
+		Owns(&kubeaiv1.Model{}).
+		Complete(r)
+}
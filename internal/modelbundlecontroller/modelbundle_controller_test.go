@@ -0,0 +1,114 @@
+package modelbundlecontroller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kubeaiv1.AddToScheme(scheme))
+	ctx := context.Background()
+
+	bundle := &kubeaiv1.ModelBundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "rag", UID: "rag-uid"},
+		Spec: kubeaiv1.ModelBundleSpec{Models: []kubeaiv1.ModelBundleModel{
+			{Name: "llm", Spec: kubeaiv1.ModelSpec{Engine: kubeaiv1.VLLMEngine, URL: "hf://llm"}},
+			{Name: "embedder", Spec: kubeaiv1.ModelSpec{Engine: kubeaiv1.InfinityEngine, URL: "hf://embedder"}},
+			{Name: "reranker", Spec: kubeaiv1.ModelSpec{Engine: kubeaiv1.InfinityEngine, URL: "hf://reranker"}},
+		}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(bundle).
+		WithStatusSubresource(&kubeaiv1.ModelBundle{}, &kubeaiv1.Model{}).
+		Build()
+	r := &ModelBundleReconciler{Client: c, Scheme: scheme}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "rag"}}
+
+	getModel := func(name string) *kubeaiv1.Model {
+		m := &kubeaiv1.Model{}
+		require.NoError(t, c.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, m))
+		return m
+	}
+	requireReady := func(status metav1.ConditionStatus, reason string) {
+		t.Helper()
+		require.NoError(t, c.Get(ctx, req.NamespacedName, bundle))
+		cond := meta.FindStatusCondition(bundle.Status.Conditions, kubeaiv1.ModelBundleConditionReady)
+		require.NotNil(t, cond)
+		require.Equal(t, status, cond.Status)
+		require.Equal(t, reason, cond.Reason)
+	}
+
+	// The Models are created and depend on each other.
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	llm := getModel("llm")
+	require.Equal(t, []string{"embedder", "reranker"}, llm.Spec.Dependencies)
+	require.Equal(t, "rag", llm.Labels[kubeaiv1.ModelBundleLabel])
+	require.True(t, metav1.IsControlledBy(llm, bundle))
+	requireReady(metav1.ConditionFalse, kubeaiv1.ModelBundleReasonModelsNotReady)
+
+	// The bundle is ready once all of its Models are.
+	for _, name := range []string{"llm", "embedder", "reranker"} {
+		m := getModel(name)
+		meta.SetStatusCondition(&m.Status.Conditions, metav1.Condition{
+			Type:   kubeaiv1.ModelConditionReady,
+			Status: metav1.ConditionTrue,
+			Reason: kubeaiv1.ModelReasonReplicasReady,
+		})
+		require.NoError(t, c.Status().Update(ctx, m))
+	}
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	requireReady(metav1.ConditionTrue, kubeaiv1.ModelBundleReasonModelsReady)
+	require.Equal(t, int32(3), bundle.Status.ReadyModels)
+
+	// Replicas that were set by the autoscaler are kept.
+	llm = getModel("llm")
+	llm.Spec.Replicas = ptr.To[int32](3)
+	require.NoError(t, c.Update(ctx, llm))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, ptr.To[int32](3), getModel("llm").Spec.Replicas)
+
+	// Suspended bundles are scaled to zero.
+	require.NoError(t, c.Get(ctx, req.NamespacedName, bundle))
+	bundle.Spec.Suspended = true
+	require.NoError(t, c.Update(ctx, bundle))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	llm = getModel("llm")
+	require.Equal(t, ptr.To[int32](0), llm.Spec.Replicas)
+	require.True(t, llm.Spec.AutoscalingDisabled)
+	requireReady(metav1.ConditionFalse, kubeaiv1.ModelBundleReasonSuspended)
+
+	// Models that are removed from the bundle are deleted.
+	require.NoError(t, c.Get(ctx, req.NamespacedName, bundle))
+	bundle.Spec.Models = bundle.Spec.Models[:2]
+	require.NoError(t, c.Update(ctx, bundle))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "reranker"}, &kubeaiv1.Model{})
+	require.True(t, apierrors.IsNotFound(err))
+
+	// Models that do not belong to the bundle are not taken over.
+	require.NoError(t, c.Create(ctx, &kubeaiv1.Model{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "reranker"}}))
+	require.NoError(t, c.Get(ctx, req.NamespacedName, bundle))
+	bundle.Spec.Models = append(bundle.Spec.Models, kubeaiv1.ModelBundleModel{Name: "reranker"})
+	require.NoError(t, c.Update(ctx, bundle))
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	requireReady(metav1.ConditionFalse, kubeaiv1.ModelBundleReasonNameConflict)
+	require.Empty(t, getModel("reranker").OwnerReferences)
+}
@@ -0,0 +1,120 @@
+package modelcontroller
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/substratusai/kubeai/internal/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	amdGPUResource          = corev1.ResourceName("amd.com/gpu")
+	googleTPUResource       = corev1.ResourceName("google.com/tpu")
+	awsNeuronResource       = corev1.ResourceName("aws.amazon.com/neuron")
+	awsNeuronCoreResource   = corev1.ResourceName("aws.amazon.com/neuroncore")
+	awsNeuronDeviceResource = corev1.ResourceName("aws.amazon.com/neurondevice")
+)
+
+// profileAccelerator returns the accelerator of a resource profile, which is
+// inferred from the accelerator resource of its limits if it is not set.
+func profileAccelerator(rp config.ResourceProfile) config.Accelerator {
+	if rp.Accelerator != "" {
+		return rp.Accelerator
+	}
+	for name := range rp.Limits {
+		switch {
+		case name == nvidiaGPUResource || strings.HasPrefix(string(name), "nvidia.com/mig-"):
+			return config.NVIDIAGPUAccelerator
+		case name == amdGPUResource:
+			return config.AMDGPUAccelerator
+		case name == googleTPUResource:
+			return config.GoogleTPUAccelerator
+		case name == awsNeuronResource || name == awsNeuronCoreResource || name == awsNeuronDeviceResource:
+			return config.AWSNeuronAccelerator
+		}
+	}
+	return ""
+}
+
+// applyProfileEnv adds the env of the resource profile to the model server
+// container. Env of the Model (already in the container) takes precedence.
+func applyProfileEnv(pod *corev1.Pod, c ModelConfig) {
+	if len(c.Env) == 0 {
+		return
+	}
+	for i := range pod.Spec.Containers {
+		server := &pod.Spec.Containers[i]
+		if server.Name != serverContainerName {
+			continue
+		}
+		for _, e := range c.Env {
+			if !slices.ContainsFunc(server.Env, func(existing corev1.EnvVar) bool { return existing.Name == e.Name }) {
+				server.Env = append(server.Env, e)
+			}
+		}
+	}
+}
+
+// vLLMAcceleratorArgs returns the args that vLLM needs to run on the
+// accelerator of the resource profile (unless the Model sets them itself).
+// Models on NVIDIA and AMD GPUs set the tensor parallel size in their args.
+func vLLMAcceleratorArgs(c ModelConfig, args []string) []string {
+	hasArg := func(name string) bool {
+		return slices.ContainsFunc(args, func(arg string) bool { return strings.HasPrefix(arg, name) })
+	}
+
+	var result []string
+	switch profileAccelerator(c.ResourceProfile) {
+	case config.AWSNeuronAccelerator:
+		if !hasArg("--device") {
+			result = append(result, "--device=neuron")
+		}
+		// The model is sharded across the NeuronCores of the Pod.
+		if n := c.Limits[awsNeuronCoreResource]; !n.IsZero() && !hasArg("--tensor-parallel-size") {
+			result = append(result, "--tensor-parallel-size="+strconv.FormatInt(n.Value(), 10))
+		}
+	case config.GoogleTPUAccelerator:
+		// The model is sharded across the TPU chips of the Pod.
+		if n := c.Limits[googleTPUResource]; n.Value() > 1 && !hasArg("--tensor-parallel-size") {
+			result = append(result, "--tensor-parallel-size="+strconv.FormatInt(n.Value(), 10))
+		}
+	}
+	return result
+}
+
+// acceleratorDeviceNames name the devices of the accelerators, as counted
+// by acceleratorDevices.
+var acceleratorDeviceNames = map[config.Accelerator]string{
+	config.NVIDIAGPUAccelerator: "GPUs",
+	config.AMDGPUAccelerator:    "GPUs",
+	config.GoogleTPUAccelerator: "TPU chips",
+	config.AWSNeuronAccelerator: "NeuronCores",
+}
+
+// acceleratorDevices returns the number of accelerator devices in the limits
+// of the config. It returns false if the config has no accelerator or its
+// devices are not counted.
+func acceleratorDevices(c ModelConfig) (int64, bool) {
+	var isDevice func(corev1.ResourceName) bool
+	switch profileAccelerator(c.ResourceProfile) {
+	case config.NVIDIAGPUAccelerator:
+		// Includes MIG slices and renamed time-sliced GPUs.
+		isDevice = func(name corev1.ResourceName) bool { return strings.HasPrefix(string(name), "nvidia.com/") }
+	case config.AMDGPUAccelerator:
+		isDevice = func(name corev1.ResourceName) bool { return name == amdGPUResource }
+	case config.GoogleTPUAccelerator:
+		isDevice = func(name corev1.ResourceName) bool { return name == googleTPUResource }
+	case config.AWSNeuronAccelerator:
+		isDevice = func(name corev1.ResourceName) bool { return name == awsNeuronCoreResource }
+	default:
+		return 0, false
+	}
+	for name, q := range c.Limits {
+		if isDevice(name) {
+			return q.Value(), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,60 @@
+package modelcontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func Test_profileAccelerator(t *testing.T) {
+	limits := func(name corev1.ResourceName) corev1.ResourceList {
+		return corev1.ResourceList{name: resource.MustParse("1"), corev1.ResourceCPU: resource.MustParse("2")}
+	}
+	require.Equal(t, config.NVIDIAGPUAccelerator, profileAccelerator(config.ResourceProfile{Limits: limits(nvidiaGPUResource)}))
+	require.Equal(t, config.NVIDIAGPUAccelerator, profileAccelerator(config.ResourceProfile{Limits: limits("nvidia.com/mig-1g.10gb")}))
+	require.Equal(t, config.AMDGPUAccelerator, profileAccelerator(config.ResourceProfile{Limits: limits(amdGPUResource)}))
+	require.Equal(t, config.GoogleTPUAccelerator, profileAccelerator(config.ResourceProfile{Limits: limits(googleTPUResource)}))
+	require.Equal(t, config.AWSNeuronAccelerator, profileAccelerator(config.ResourceProfile{Limits: limits(awsNeuronCoreResource)}))
+	require.Empty(t, profileAccelerator(config.ResourceProfile{Limits: limits(corev1.ResourceMemory)}))
+	// Set accelerators take precedence (i.e. for renamed resources).
+	require.Equal(t, config.AMDGPUAccelerator, profileAccelerator(config.ResourceProfile{
+		Accelerator: config.AMDGPUAccelerator,
+		Limits:      limits("example.com/gpu"),
+	}))
+}
+
+func Test_applyProfileEnv(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+		{Name: serverContainerName, Env: []corev1.EnvVar{{Name: "FROM_MODEL", Value: "model"}}},
+		{Name: "sidecar"},
+	}}}
+	applyProfileEnv(pod, ModelConfig{ResourceProfile: config.ResourceProfile{Env: []corev1.EnvVar{
+		{Name: "FROM_MODEL", Value: "profile"},
+		{Name: "HIP_FORCE_DEV_KERNARG", Value: "1"},
+	}}})
+	require.Equal(t, []corev1.EnvVar{
+		{Name: "FROM_MODEL", Value: "model"},
+		{Name: "HIP_FORCE_DEV_KERNARG", Value: "1"},
+	}, pod.Spec.Containers[0].Env)
+	require.Empty(t, pod.Spec.Containers[1].Env)
+}
+
+func Test_vLLMAcceleratorArgs(t *testing.T) {
+	cfg := func(limits corev1.ResourceList) ModelConfig {
+		return ModelConfig{
+			ResourceProfile: config.ResourceProfile{Limits: limits},
+		}
+	}
+	neuron := cfg(corev1.ResourceList{awsNeuronCoreResource: resource.MustParse("4")})
+	tpu := cfg(corev1.ResourceList{googleTPUResource: resource.MustParse("4")})
+
+	require.Equal(t, []string{"--device=neuron", "--tensor-parallel-size=4"}, vLLMAcceleratorArgs(neuron, nil))
+	require.Nil(t, vLLMAcceleratorArgs(neuron, []string{"--device=neuron", "--tensor-parallel-size=2"}))
+	require.Equal(t, []string{"--tensor-parallel-size=4"}, vLLMAcceleratorArgs(tpu, nil))
+	require.Nil(t, vLLMAcceleratorArgs(cfg(corev1.ResourceList{googleTPUResource: resource.MustParse("1")}), nil))
+	require.Nil(t, vLLMAcceleratorArgs(cfg(corev1.ResourceList{amdGPUResource: resource.MustParse("4")}), nil))
+	require.Nil(t, vLLMAcceleratorArgs(cfg(corev1.ResourceList{nvidiaGPUResource: resource.MustParse("4")}), nil))
+}
@@ -0,0 +1,45 @@
+package modelcontroller
+
+import (
+	"fmt"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/cronwindow"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setActiveCondition sets the Active condition of a Model with active windows
+// and returns whether the Model is active along with the time at which that
+// changes next (zero if it does not). Invalid windows do not deactivate the
+// Model.
+func setActiveCondition(model *kubeaiv1.Model, now time.Time) (bool, time.Time) {
+	if len(model.Spec.ActiveWindows) == 0 {
+		meta.RemoveStatusCondition(&model.Status.Conditions, kubeaiv1.ModelConditionActive)
+		return true, time.Time{}
+	}
+
+	cond := metav1.Condition{
+		Type:               kubeaiv1.ModelConditionActive,
+		ObservedGeneration: model.Generation,
+	}
+	active, change, err := cronwindow.ModelActive(model, now)
+	switch {
+	case err != nil:
+		active, change = true, time.Time{}
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = kubeaiv1.ModelReasonInvalidActiveWindows
+		cond.Message = err.Error()
+	case active:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = kubeaiv1.ModelReasonInActiveWindow
+		cond.Message = fmt.Sprintf("Active until %s", change.UTC().Format(time.RFC3339))
+	default:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = kubeaiv1.ModelReasonOutsideActiveWindows
+		cond.Message = fmt.Sprintf("Inactive until %s", change.UTC().Format(time.RFC3339))
+	}
+	meta.SetStatusCondition(&model.Status.Conditions, cond)
+	return active, change
+}
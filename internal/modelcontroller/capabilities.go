@@ -0,0 +1,139 @@
+package modelcontroller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	capabilitiesTimeout       = 5 * time.Second
+	capabilitiesRetryInterval = 30 * time.Second
+)
+
+// reconcileCapabilities discovers the capabilities of a Model from the model
+// server of a ready Pod into the Model's status. They are only discovered
+// again once none of the ready Pods has the hash of the Pod that they were
+// discovered from (i.e. after a rollout).
+func (r *ModelReconciler) reconcileCapabilities(ctx context.Context, model *kubeaiv1.Model, pods []corev1.Pod) error {
+	e, err := lookupEngine(model.Spec.Engine)
+	if err != nil || e.capabilities == nil {
+		return nil
+	}
+	pod := capabilitiesPod(model, pods)
+	if pod == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, capabilitiesTimeout)
+	defer cancel()
+	caps, err := e.capabilities(r, ctx, model, pod)
+	if err != nil {
+		return fmt.Errorf("pod %q: %w", pod.Name, err)
+	}
+	caps.PodHash = k8sutils.GetLabel(pod, kubeaiv1.PodHashLabel)
+	model.Status.Capabilities = caps
+	return nil
+}
+
+// capabilitiesPod returns the ready Pod to discover the capabilities of a
+// Model from, or nil if they are up to date.
+func capabilitiesPod(model *kubeaiv1.Model, pods []corev1.Pod) *corev1.Pod {
+	var ready []*corev1.Pod
+	for i := range pods {
+		p := &pods[i]
+		if p.DeletionTimestamp != nil || !k8sutils.PodIsReady(p) {
+			continue
+		}
+		if model.Status.Capabilities != nil && k8sutils.GetLabel(p, kubeaiv1.PodHashLabel) == model.Status.Capabilities.PodHash {
+			return nil
+		}
+		ready = append(ready, p)
+	}
+	if len(ready) == 0 {
+		return nil
+	}
+	return ready[0]
+}
+
+// vLLMCapabilities discovers the capabilities of a vLLM model server from its
+// models endpoint. The maximum LoRA rank is not reported by vLLM, it is
+// taken from the args of the server.
+func (r *ModelReconciler) vLLMCapabilities(ctx context.Context, m *kubeaiv1.Model, pod *corev1.Pod) (*kubeaiv1.ModelStatusCapabilities, error) {
+	models, err := r.VLLMClient.ListModels(ctx, getPodModelServerAddr(pod))
+	if err != nil {
+		return nil, fmt.Errorf("listing vllm models: %w", err)
+	}
+	for _, vm := range models {
+		if vm.Parent != nil {
+			// LoRA adapter.
+			continue
+		}
+		caps := &kubeaiv1.ModelStatusCapabilities{ServedModel: vm.Root}
+		if vm.MaxModelLen > 0 {
+			caps.MaxContextLength = ptr.To(vm.MaxModelLen)
+		}
+		for _, c := range pod.Spec.Containers {
+			if c.Name == serverContainerName {
+				caps.MaxLoRARank = vLLMMaxLoRARank(c.Args)
+			}
+		}
+		return caps, nil
+	}
+	return nil, fmt.Errorf("vllm serves no base model")
+}
+
+// vLLMMaxLoRARank returns the maximum LoRA rank of a vLLM server with the
+// given args, or nil if LoRA is not enabled.
+func vLLMMaxLoRARank(args []string) *int32 {
+	if !slices.Contains(args, "--enable-lora") {
+		return nil
+	}
+	// Default of vLLM.
+	rank := int32(16)
+	for i, arg := range args {
+		var v string
+		switch {
+		case strings.HasPrefix(arg, "--max-lora-rank="):
+			v = strings.TrimPrefix(arg, "--max-lora-rank=")
+		case arg == "--max-lora-rank" && i+1 < len(args):
+			v = args[i+1]
+		default:
+			continue
+		}
+		if n, err := strconv.ParseInt(v, 10, 32); err == nil {
+			rank = int32(n)
+		}
+	}
+	return &rank
+}
+
+// oLlamaCapabilities discovers the capabilities of an Ollama model server from
+// the details of the model.
+func (r *ModelReconciler) oLlamaCapabilities(ctx context.Context, m *kubeaiv1.Model, pod *corev1.Pod) (*kubeaiv1.ModelStatusCapabilities, error) {
+	// The model is copied to the name of the Model (see oLlamaPodForModel).
+	details, err := r.OLlamaClient.Show(ctx, getPodModelServerAddr(pod), m.Name)
+	if err != nil {
+		return nil, fmt.Errorf("showing ollama model: %w", err)
+	}
+	caps := &kubeaiv1.ModelStatusCapabilities{}
+	if u, err := parseModelURL(m.Spec.URL); err == nil {
+		caps.ServedModel = u.ref
+	}
+	if n, ok := details.ContextLength(); ok {
+		caps.MaxContextLength = ptr.To(n)
+	}
+	if details.Capabilities != nil {
+		// Only reported by recent versions of Ollama.
+		caps.Vision = ptr.To(slices.Contains(details.Capabilities, "vision"))
+	}
+	return caps, nil
+}
@@ -0,0 +1,119 @@
+package modelcontroller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/vllmclient"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func Test_capabilitiesPod(t *testing.T) {
+	pod := func(name, hash string, ready bool) corev1.Pod {
+		p := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{v1.PodHashLabel: hash},
+			},
+		}
+		if ready {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+		return p
+	}
+
+	cases := []struct {
+		name         string
+		capabilities *v1.ModelStatusCapabilities
+		pods         []corev1.Pod
+		wantPod      string
+	}{
+		{
+			name: "no ready pods",
+			pods: []corev1.Pod{pod("p1", "a", false)},
+		},
+		{
+			name:    "first discovery",
+			pods:    []corev1.Pod{pod("p1", "a", false), pod("p2", "a", true)},
+			wantPod: "p2",
+		},
+		{
+			name:         "up to date",
+			capabilities: &v1.ModelStatusCapabilities{PodHash: "a"},
+			pods:         []corev1.Pod{pod("p1", "b", true), pod("p2", "a", true)},
+		},
+		{
+			name:         "after rollout",
+			capabilities: &v1.ModelStatusCapabilities{PodHash: "a"},
+			pods:         []corev1.Pod{pod("p1", "b", true)},
+			wantPod:      "p1",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			model := &v1.Model{Status: v1.ModelStatus{Capabilities: c.capabilities}}
+			p := capabilitiesPod(model, c.pods)
+			if c.wantPod == "" {
+				require.Nil(t, p)
+				return
+			}
+			require.NotNil(t, p)
+			require.Equal(t, c.wantPod, p.Name)
+		})
+	}
+}
+
+func Test_vLLMCapabilities(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/models", r.URL.Path)
+		w.Write([]byte(`{"object":"list","data":[
+			{"id":"my-adapter","root":"/adapters/my-adapter","parent":"test-mdl","max_model_len":null},
+			{"id":"test-mdl","root":"meta-llama/Llama-3.1-8B-Instruct","parent":null,"max_model_len":8192}
+		]}`))
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	r := &ModelReconciler{VLLMClient: &vllmclient.Client{HTTPClient: srv.Client()}}
+	model := &v1.Model{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-mdl"},
+		Spec:       v1.ModelSpec{Engine: v1.VLLMEngine},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{v1.PodHashLabel: "abc"},
+			Annotations: map[string]string{
+				v1.ModelPodIPAnnotation:   u.Hostname(),
+				v1.ModelPodPortAnnotation: u.Port(),
+			},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: serverContainerName,
+			Args: []string{"--model=meta-llama/Llama-3.1-8B-Instruct", "--enable-lora", "--max-lora-rank", "64"},
+		}}},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+	}
+
+	require.NoError(t, r.reconcileCapabilities(context.Background(), model, []corev1.Pod{*pod}))
+	require.Equal(t, &v1.ModelStatusCapabilities{
+		PodHash:          "abc",
+		ServedModel:      "meta-llama/Llama-3.1-8B-Instruct",
+		MaxContextLength: ptr.To[int64](8192),
+		MaxLoRARank:      ptr.To[int32](64),
+	}, model.Status.Capabilities)
+}
+
+func Test_vLLMMaxLoRARank(t *testing.T) {
+	require.Nil(t, vLLMMaxLoRARank([]string{"--max-lora-rank=32"}))
+	require.Equal(t, ptr.To[int32](16), vLLMMaxLoRARank([]string{"--enable-lora"}))
+	require.Equal(t, ptr.To[int32](32), vLLMMaxLoRARank([]string{"--enable-lora", "--max-lora-rank=32"}))
+}
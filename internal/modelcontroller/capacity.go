@@ -0,0 +1,148 @@
+package modelcontroller
+
+import (
+	"fmt"
+	"slices"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// applyCapacity places the Pod on the spot or on-demand Nodes of the Model's
+// capacity type.
+func applyCapacity(pod *corev1.Pod, model *kubeaiv1.Model, spot config.Spot) error {
+	c := model.Spec.Capacity
+	if c == nil {
+		return nil
+	}
+	if spot.NodeLabelKey == "" {
+		return fmt.Errorf("spot nodes are not configured (spot.nodeLabelKey in the system config)")
+	}
+
+	// The affinity is shared with the resource profile.
+	pod.Spec.Affinity = pod.Spec.Affinity.DeepCopy()
+	isSpot := corev1.NodeSelectorRequirement{
+		Key:      spot.NodeLabelKey,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{spot.NodeLabelValue},
+	}
+	switch c.Type {
+	case kubeaiv1.SpotCapacityType:
+		requireNodes(pod, isSpot)
+	case kubeaiv1.OnDemandCapacityType:
+		requireNodes(pod, onDemandRequirement(spot))
+		return nil
+	default:
+		nodeAffinity(pod).PreferredDuringSchedulingIgnoredDuringExecution = append(
+			nodeAffinity(pod).PreferredDuringSchedulingIgnoredDuringExecution,
+			corev1.PreferredSchedulingTerm{
+				Weight:     100,
+				Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{isSpot}},
+			},
+		)
+	}
+	pod.Spec.Tolerations = slices.Concat(pod.Spec.Tolerations, spot.Tolerations)
+	return nil
+}
+
+// applyOnDemandFloor moves Pods that are about to be created to on-demand
+// Nodes until the Model has MinOnDemandReplicas Pods there.
+func applyOnDemandFloor(plan *podPlan, model *kubeaiv1.Model, spot config.Spot) {
+	c := model.Spec.Capacity
+	if c == nil || c.Type == kubeaiv1.OnDemandCapacityType || c.MinOnDemandReplicas == 0 {
+		return
+	}
+
+	var onDemand int32
+	for _, p := range plan.toRemain {
+		if isOnDemandFloorPod(p) {
+			onDemand++
+		}
+	}
+	for _, p := range plan.toCreate {
+		if onDemand >= c.MinOnDemandReplicas {
+			return
+		}
+		pinOnDemand(p, spot)
+		onDemand++
+	}
+}
+
+// pinOnDemand replaces the spot requirements and preferences of a Pod with
+// a requirement for on-demand Nodes. The Pod keeps the hash of its Model's
+// Pods so that it is not recreated by rollouts.
+func pinOnDemand(pod *corev1.Pod, spot config.Spot) {
+	pod.Spec.Affinity = pod.Spec.Affinity.DeepCopy()
+	na := nodeAffinity(pod)
+	isSpotKey := func(r corev1.NodeSelectorRequirement) bool { return r.Key == spot.NodeLabelKey }
+	if na.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		for i := range na.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			t := &na.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[i]
+			t.MatchExpressions = slices.DeleteFunc(t.MatchExpressions, isSpotKey)
+		}
+	}
+	na.PreferredDuringSchedulingIgnoredDuringExecution = slices.DeleteFunc(na.PreferredDuringSchedulingIgnoredDuringExecution,
+		func(t corev1.PreferredSchedulingTerm) bool {
+			return slices.ContainsFunc(t.Preference.MatchExpressions, isSpotKey)
+		})
+	requireNodes(pod, onDemandRequirement(spot))
+	k8sutils.SetLabel(pod, kubeaiv1.PodOnDemandFloorLabel, "true")
+}
+
+func isOnDemandFloorPod(pod *corev1.Pod) bool {
+	return k8sutils.GetLabel(pod, kubeaiv1.PodOnDemandFloorLabel) == "true"
+}
+
+func onDemandRequirement(spot config.Spot) corev1.NodeSelectorRequirement {
+	// Also matches Nodes without the label.
+	return corev1.NodeSelectorRequirement{
+		Key:      spot.NodeLabelKey,
+		Operator: corev1.NodeSelectorOpNotIn,
+		Values:   []string{spot.NodeLabelValue},
+	}
+}
+
+// requireNodes adds the requirement to all required node selector terms of
+// the Pod (terms are ORed, their requirements are ANDed).
+func requireNodes(pod *corev1.Pod, r corev1.NodeSelectorRequirement) {
+	na := nodeAffinity(pod)
+	if na.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		na.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	required := na.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	for i := range required.NodeSelectorTerms {
+		required.NodeSelectorTerms[i].MatchExpressions = append(required.NodeSelectorTerms[i].MatchExpressions, r)
+	}
+}
+
+func nodeAffinity(pod *corev1.Pod) *corev1.NodeAffinity {
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity == nil {
+		pod.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	return pod.Spec.Affinity.NodeAffinity
+}
+
+// splitDisruptedPods removes the Pods that are about to be terminated due to
+// a disruption (i.e. a spot preemption notice) from the list so that they are
+// replaced right away instead of once they are gone. Disrupted Pods no longer
+// receive requests (see the endpoints resolver).
+func splitDisruptedPods(pods *corev1.PodList) []corev1.Pod {
+	var remaining, disrupted []corev1.Pod
+	for _, p := range pods.Items {
+		if k8sutils.PodIsDisrupted(&p) {
+			disrupted = append(disrupted, p)
+		} else {
+			remaining = append(remaining, p)
+		}
+	}
+	pods.Items = remaining
+	return disrupted
+}
@@ -0,0 +1,114 @@
+package modelcontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_applyCapacity(t *testing.T) {
+	spot := config.Spot{
+		NodeLabelKey:   "karpenter.sh/capacity-type",
+		NodeLabelValue: "spot",
+		Tolerations:    []corev1.Toleration{{Key: "spot", Operator: corev1.TolerationOpExists}},
+	}
+	gpu := corev1.NodeSelectorRequirement{Key: "gpu", Operator: corev1.NodeSelectorOpExists}
+	isSpot := corev1.NodeSelectorRequirement{Key: spot.NodeLabelKey, Operator: corev1.NodeSelectorOpIn, Values: []string{"spot"}}
+	notSpot := corev1.NodeSelectorRequirement{Key: spot.NodeLabelKey, Operator: corev1.NodeSelectorOpNotIn, Values: []string{"spot"}}
+	required := func(reqs ...corev1.NodeSelectorRequirement) *corev1.NodeSelector {
+		return &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: reqs}}}
+	}
+
+	cases := []struct {
+		name            string
+		capacityType    v1.CapacityType
+		wantRequired    *corev1.NodeSelector
+		wantPreferred   []corev1.PreferredSchedulingTerm
+		wantTolerations []corev1.Toleration
+	}{
+		{
+			name:            "spot",
+			capacityType:    v1.SpotCapacityType,
+			wantRequired:    required(gpu, isSpot),
+			wantTolerations: spot.Tolerations,
+		},
+		{
+			name:         "spot preferred",
+			capacityType: v1.SpotPreferredCapacityType,
+			wantRequired: required(gpu),
+			wantPreferred: []corev1.PreferredSchedulingTerm{{
+				Weight:     100,
+				Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{isSpot}},
+			}},
+			wantTolerations: spot.Tolerations,
+		},
+		{
+			name:         "on-demand",
+			capacityType: v1.OnDemandCapacityType,
+			wantRequired: required(gpu, notSpot),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			profileAffinity := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: required(gpu),
+			}}
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Affinity: profileAffinity}}
+			model := &v1.Model{Spec: v1.ModelSpec{Capacity: &v1.ModelCapacity{Type: c.capacityType}}}
+
+			require.NoError(t, applyCapacity(pod, model, spot))
+			require.Equal(t, c.wantRequired, pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+			require.Equal(t, c.wantPreferred, pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution)
+			require.Equal(t, c.wantTolerations, pod.Spec.Tolerations)
+			// The affinity of the resource profile is not modified.
+			require.Equal(t, required(gpu), profileAffinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+
+			// Pods of the on-demand floor only require on-demand Nodes.
+			pinOnDemand(pod, spot)
+			require.Equal(t, required(gpu, notSpot), pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+			require.Empty(t, pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution)
+			require.True(t, isOnDemandFloorPod(pod))
+		})
+	}
+
+	require.ErrorContains(t, applyCapacity(&corev1.Pod{}, &v1.Model{Spec: v1.ModelSpec{Capacity: &v1.ModelCapacity{}}}, config.Spot{}),
+		"spot nodes are not configured")
+}
+
+func Test_applyOnDemandFloor(t *testing.T) {
+	spot := config.Spot{NodeLabelKey: "karpenter.sh/capacity-type", NodeLabelValue: "spot"}
+	floorPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{v1.PodOnDemandFloorLabel: "true"}}}
+	model := &v1.Model{Spec: v1.ModelSpec{Capacity: &v1.ModelCapacity{
+		Type:                v1.SpotCapacityType,
+		MinOnDemandReplicas: 2,
+	}}}
+
+	plan := &podPlan{
+		toRemain: []*corev1.Pod{floorPod, {}},
+		toCreate: []*corev1.Pod{{}, {}},
+	}
+	applyOnDemandFloor(plan, model, spot)
+	require.True(t, isOnDemandFloorPod(plan.toCreate[0]))
+	require.False(t, isOnDemandFloorPod(plan.toCreate[1]))
+}
+
+func Test_splitDisruptedPods(t *testing.T) {
+	disrupted := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "disrupted"},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{
+			Type:   corev1.DisruptionTarget,
+			Status: corev1.ConditionTrue,
+			Reason: "TerminationByKubelet",
+		}}},
+	}
+	pods := &corev1.PodList{Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "running"}}, disrupted}}
+
+	require.Equal(t, []corev1.Pod{disrupted}, splitDisruptedPods(pods))
+	require.Len(t, pods.Items, 1)
+	require.Equal(t, "running", pods.Items[0].Name)
+}
@@ -0,0 +1,201 @@
+package modelcontroller
+
+import (
+	"fmt"
+	"slices"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// setWaitingForNodesCondition sets the WaitingForNodes condition of the Model
+// based on its Pods and returns the number of unschedulable Pods.
+func setWaitingForNodesCondition(model *kubeaiv1.Model, pods []corev1.Pod) int32 {
+	var (
+		unschedulable int32
+		reason        string
+	)
+	for i := range pods {
+		if _, ok := k8sutils.PodUnschedulableSince(&pods[i]); !ok {
+			continue
+		}
+		unschedulable++
+		if reason == "" {
+			for _, c := range pods[i].Status.Conditions {
+				if c.Type == corev1.PodScheduled {
+					reason = c.Message
+				}
+			}
+		}
+	}
+
+	cond := metav1.Condition{
+		Type:               kubeaiv1.ModelConditionWaitingForNodes,
+		Status:             metav1.ConditionFalse,
+		Reason:             kubeaiv1.ModelReasonPodsScheduled,
+		ObservedGeneration: model.Generation,
+	}
+	if unschedulable > 0 {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = kubeaiv1.ModelReasonPodsUnschedulable
+		cond.Message = fmt.Sprintf("%d of %d Pods are unschedulable", unschedulable, len(pods))
+		if reason != "" {
+			cond.Message += ": " + reason
+		}
+	}
+	meta.SetStatusCondition(&model.Status.Conditions, cond)
+	return unschedulable
+}
+
+// podProblems are the reasons of the Degraded condition by priority,
+// with the descriptions that are used in its message.
+var podProblems = []struct{ reason, description string }{
+	{kubeaiv1.ModelReasonCrashLoop, "are crash looping"},
+	{kubeaiv1.ModelReasonImagePullError, "are unable to pull their image"},
+	{kubeaiv1.ModelReasonUnschedulable, "are unschedulable"},
+}
+
+// podProblem returns the reason why a Pod is unable to start (one of
+// podProblems) and a detail message, or an empty reason.
+func podProblem(pod *corev1.Pod) (string, string) {
+	if _, ok := k8sutils.PodUnschedulableSince(pod); ok {
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodScheduled {
+				return kubeaiv1.ModelReasonUnschedulable, c.Message
+			}
+		}
+	}
+	for _, cs := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+		w := cs.State.Waiting
+		if w == nil {
+			continue
+		}
+		switch w.Reason {
+		case "CrashLoopBackOff":
+			return kubeaiv1.ModelReasonCrashLoop, fmt.Sprintf("container %q: %s", cs.Name, w.Message)
+		case "ErrImagePull", "ImagePullBackOff", "InvalidImageName":
+			return kubeaiv1.ModelReasonImagePullError, fmt.Sprintf("container %q: %s", cs.Name, w.Message)
+		}
+	}
+	return "", ""
+}
+
+// setReplicaConditions summarizes the Pods of a Model in its replica counts
+// and sets the Ready, Loading, ScalingUp and Degraded conditions.
+func setReplicaConditions(model *kubeaiv1.Model, pods []corev1.Pod) {
+	replicas := kubeaiv1.ModelStatusReplicas{All: int32(len(pods))}
+	problems := map[string]int32{}
+	details := map[string]string{}
+	for i := range pods {
+		pod := &pods[i]
+		if k8sutils.PodIsReady(pod) {
+			replicas.Ready++
+			continue
+		}
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		reason, detail := podProblem(pod)
+		if reason != "" {
+			problems[reason]++
+			if details[reason] == "" {
+				details[reason] = detail
+			}
+		}
+		switch {
+		case reason == kubeaiv1.ModelReasonCrashLoop || reason == kubeaiv1.ModelReasonImagePullError:
+			replicas.Unhealthy++
+		case pod.Status.Phase == corev1.PodRunning:
+			replicas.Loading++
+		default:
+			replicas.Pending++
+		}
+	}
+	model.Status.Replicas = replicas
+	desired := ptr.Deref(model.Spec.Replicas, 0)
+
+	setCondition := func(condType string, status bool, reason, message string) {
+		cond := metav1.Condition{
+			Type:               condType,
+			Status:             metav1.ConditionFalse,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: model.Generation,
+		}
+		if status {
+			cond.Status = metav1.ConditionTrue
+		}
+		meta.SetStatusCondition(&model.Status.Conditions, cond)
+	}
+
+	degraded := kubeaiv1.ModelReasonHealthy
+	var degradedMessage string
+	for _, p := range podProblems {
+		if n := problems[p.reason]; n > 0 {
+			degraded = p.reason
+			degradedMessage = fmt.Sprintf("%d of %d Pods %s", n, len(pods), p.description)
+			if details[p.reason] != "" {
+				degradedMessage += ": " + details[p.reason]
+			}
+			break
+		}
+	}
+	setCondition(kubeaiv1.ModelConditionDegraded, degraded != kubeaiv1.ModelReasonHealthy, degraded, degradedMessage)
+
+	if replicas.Loading > 0 {
+		setCondition(kubeaiv1.ModelConditionLoading, true, kubeaiv1.ModelReasonLoading,
+			fmt.Sprintf("Replicas loading the model: %d", replicas.Loading))
+	} else {
+		setCondition(kubeaiv1.ModelConditionLoading, false, kubeaiv1.ModelReasonNotLoading, "")
+	}
+
+	readyMessage := fmt.Sprintf("%d of %d replicas are ready", replicas.Ready, desired)
+	if replicas.Ready < desired {
+		setCondition(kubeaiv1.ModelConditionScalingUp, true, kubeaiv1.ModelReasonReplicasStarting, readyMessage)
+	} else {
+		setCondition(kubeaiv1.ModelConditionScalingUp, false, kubeaiv1.ModelReasonAtDesiredReplicas, "")
+	}
+
+	switch {
+	case replicas.Ready > 0:
+		setCondition(kubeaiv1.ModelConditionReady, true, kubeaiv1.ModelReasonReplicasReady, readyMessage)
+	case desired == 0 && len(pods) == 0:
+		setCondition(kubeaiv1.ModelConditionReady, false, kubeaiv1.ModelReasonScaledToZero, "The Model has no replicas")
+	case degraded != kubeaiv1.ModelReasonHealthy:
+		setCondition(kubeaiv1.ModelConditionReady, false, degraded, degradedMessage)
+	case replicas.Loading > 0:
+		setCondition(kubeaiv1.ModelConditionReady, false, kubeaiv1.ModelReasonLoading,
+			fmt.Sprintf("Replicas loading the model: %d", replicas.Loading))
+	default:
+		setCondition(kubeaiv1.ModelConditionReady, false, kubeaiv1.ModelReasonPending,
+			fmt.Sprintf("Waiting for %d replicas to start", max(desired, replicas.All)))
+	}
+}
+
+// setDownloadingCondition sets the Downloading condition of a Model with a
+// CacheProfile. While the model is downloaded, it has no replicas.
+func setDownloadingCondition(model *kubeaiv1.Model, downloading bool) {
+	cond := metav1.Condition{
+		Type:               kubeaiv1.ModelConditionDownloading,
+		Status:             metav1.ConditionFalse,
+		Reason:             kubeaiv1.ModelReasonCacheLoaded,
+		ObservedGeneration: model.Generation,
+	}
+	if downloading {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = kubeaiv1.ModelReasonDownloading
+		cond.Message = fmt.Sprintf("Loading the model into the cache (Job %s)", loadCacheJobName(model))
+		meta.SetStatusCondition(&model.Status.Conditions, metav1.Condition{
+			Type:               kubeaiv1.ModelConditionReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             kubeaiv1.ModelReasonDownloading,
+			Message:            cond.Message,
+			ObservedGeneration: model.Generation,
+		})
+	}
+	meta.SetStatusCondition(&model.Status.Conditions, cond)
+}
@@ -0,0 +1,119 @@
+package modelcontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestSetWaitingForNodesCondition(t *testing.T) {
+	unschedulable := corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodPending,
+		Conditions: []corev1.PodCondition{{
+			Type:    corev1.PodScheduled,
+			Status:  corev1.ConditionFalse,
+			Reason:  corev1.PodReasonUnschedulable,
+			Message: "0/3 nodes are available: 3 Insufficient nvidia.com/gpu.",
+		}},
+	}}
+	running := corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+
+	model := &kubeaiv1.Model{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+	require.Equal(t, int32(1), setWaitingForNodesCondition(model, []corev1.Pod{running, unschedulable}))
+	cond := meta.FindStatusCondition(model.Status.Conditions, kubeaiv1.ModelConditionWaitingForNodes)
+	require.NotNil(t, cond)
+	require.Equal(t, metav1.ConditionTrue, cond.Status)
+	require.Equal(t, kubeaiv1.ModelReasonPodsUnschedulable, cond.Reason)
+	require.Equal(t, "1 of 2 Pods are unschedulable: 0/3 nodes are available: 3 Insufficient nvidia.com/gpu.", cond.Message)
+	require.Equal(t, int64(2), cond.ObservedGeneration)
+
+	require.Zero(t, setWaitingForNodesCondition(model, []corev1.Pod{running, running}))
+	cond = meta.FindStatusCondition(model.Status.Conditions, kubeaiv1.ModelConditionWaitingForNodes)
+	require.Equal(t, metav1.ConditionFalse, cond.Status)
+	require.Equal(t, kubeaiv1.ModelReasonPodsScheduled, cond.Reason)
+	require.Empty(t, cond.Message)
+	require.Len(t, model.Status.Conditions, 1)
+}
+
+func TestSetReplicaConditions(t *testing.T) {
+	ready := corev1.Pod{Status: corev1.PodStatus{
+		Phase:      corev1.PodRunning,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+	}}
+	loading := corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}
+	pending := corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}}
+	crashLooping := corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodRunning,
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name: "server",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+				Reason:  "CrashLoopBackOff",
+				Message: "back-off 5m0s restarting failed container",
+			}},
+		}},
+	}}
+	unschedulable := corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodPending,
+		Conditions: []corev1.PodCondition{{
+			Type:    corev1.PodScheduled,
+			Status:  corev1.ConditionFalse,
+			Reason:  corev1.PodReasonUnschedulable,
+			Message: "0/3 nodes are available: 3 Insufficient nvidia.com/gpu.",
+		}},
+	}}
+
+	requireCondition := func(t *testing.T, model *kubeaiv1.Model, condType string, status metav1.ConditionStatus, reason, message string) {
+		t.Helper()
+		cond := meta.FindStatusCondition(model.Status.Conditions, condType)
+		require.NotNil(t, cond, condType)
+		require.Equal(t, status, cond.Status, condType)
+		require.Equal(t, reason, cond.Reason, condType)
+		require.Equal(t, message, cond.Message, condType)
+	}
+
+	t.Run("scaled to zero", func(t *testing.T) {
+		model := &kubeaiv1.Model{Spec: kubeaiv1.ModelSpec{Replicas: ptr.To[int32](0)}}
+		setReplicaConditions(model, nil)
+		require.Equal(t, kubeaiv1.ModelStatusReplicas{}, model.Status.Replicas)
+		requireCondition(t, model, kubeaiv1.ModelConditionReady, metav1.ConditionFalse, kubeaiv1.ModelReasonScaledToZero, "The Model has no replicas")
+		requireCondition(t, model, kubeaiv1.ModelConditionScalingUp, metav1.ConditionFalse, kubeaiv1.ModelReasonAtDesiredReplicas, "")
+		requireCondition(t, model, kubeaiv1.ModelConditionDegraded, metav1.ConditionFalse, kubeaiv1.ModelReasonHealthy, "")
+	})
+
+	t.Run("loading", func(t *testing.T) {
+		model := &kubeaiv1.Model{Spec: kubeaiv1.ModelSpec{Replicas: ptr.To[int32](2)}}
+		setReplicaConditions(model, []corev1.Pod{loading, pending})
+		require.Equal(t, kubeaiv1.ModelStatusReplicas{All: 2, Loading: 1, Pending: 1}, model.Status.Replicas)
+		requireCondition(t, model, kubeaiv1.ModelConditionReady, metav1.ConditionFalse, kubeaiv1.ModelReasonLoading, "Replicas loading the model: 1")
+		requireCondition(t, model, kubeaiv1.ModelConditionLoading, metav1.ConditionTrue, kubeaiv1.ModelReasonLoading, "Replicas loading the model: 1")
+		requireCondition(t, model, kubeaiv1.ModelConditionScalingUp, metav1.ConditionTrue, kubeaiv1.ModelReasonReplicasStarting, "0 of 2 replicas are ready")
+	})
+
+	t.Run("degraded", func(t *testing.T) {
+		model := &kubeaiv1.Model{Spec: kubeaiv1.ModelSpec{Replicas: ptr.To[int32](2)}}
+		setReplicaConditions(model, []corev1.Pod{unschedulable, crashLooping})
+		require.Equal(t, kubeaiv1.ModelStatusReplicas{All: 2, Pending: 1, Unhealthy: 1}, model.Status.Replicas)
+		msg := `1 of 2 Pods are crash looping: container "server": back-off 5m0s restarting failed container`
+		requireCondition(t, model, kubeaiv1.ModelConditionDegraded, metav1.ConditionTrue, kubeaiv1.ModelReasonCrashLoop, msg)
+		requireCondition(t, model, kubeaiv1.ModelConditionReady, metav1.ConditionFalse, kubeaiv1.ModelReasonCrashLoop, msg)
+
+		setReplicaConditions(model, []corev1.Pod{unschedulable, ready})
+		requireCondition(t, model, kubeaiv1.ModelConditionDegraded, metav1.ConditionTrue, kubeaiv1.ModelReasonUnschedulable,
+			"1 of 2 Pods are unschedulable: 0/3 nodes are available: 3 Insufficient nvidia.com/gpu.")
+		requireCondition(t, model, kubeaiv1.ModelConditionReady, metav1.ConditionTrue, kubeaiv1.ModelReasonReplicasReady, "1 of 2 replicas are ready")
+	})
+
+	t.Run("downloading", func(t *testing.T) {
+		model := &kubeaiv1.Model{ObjectMeta: metav1.ObjectMeta{Name: "my-model"}}
+		setDownloadingCondition(model, true)
+		requireCondition(t, model, kubeaiv1.ModelConditionDownloading, metav1.ConditionTrue, kubeaiv1.ModelReasonDownloading, "Loading the model into the cache (Job load-cache-my-model)")
+		requireCondition(t, model, kubeaiv1.ModelConditionReady, metav1.ConditionFalse, kubeaiv1.ModelReasonDownloading, "Loading the model into the cache (Job load-cache-my-model)")
+		setDownloadingCondition(model, false)
+		requireCondition(t, model, kubeaiv1.ModelConditionDownloading, metav1.ConditionFalse, kubeaiv1.ModelReasonCacheLoaded, "")
+	})
+}
@@ -0,0 +1,77 @@
+package modelcontroller
+
+import (
+	"context"
+	"fmt"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// reconcileDisruptionBudget creates or updates the PodDisruptionBudget of a
+// Model, which limits the number of the Model's Pods that are evicted at the
+// same time (i.e. when Nodes are drained during cluster upgrades).
+func (r *ModelReconciler) reconcileDisruptionBudget(ctx context.Context, model *kubeaiv1.Model) error {
+	spec, err := disruptionBudgetSpec(model)
+	if err != nil {
+		return err
+	}
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: model.Namespace,
+			Name:      disruptionBudgetName(model),
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, pdb, func() error {
+		pdb.Labels = labelsForModel(model)
+		pdb.Spec = spec
+		return ctrl.SetControllerReference(model, pdb, r.Scheme)
+	}); err != nil {
+		return fmt.Errorf("creating or updating pod disruption budget: %w", err)
+	}
+	return nil
+}
+
+func disruptionBudgetName(m *kubeaiv1.Model) string {
+	return "model-" + m.Name
+}
+
+// disruptionBudgetSpec returns the spec of the PodDisruptionBudget of a
+// Model. Pods that are not ready (i.e. still loading the model) can always
+// be evicted so that they do not block Node drains.
+//
+// The budget of Models with replicas of a single Pod is enforced with
+// MaxUnavailable against the Model's replicas (via its scale subresource).
+// The Pods of multi-node Models are counted individually, so the budget is
+// converted to the minimum number of available Pods: all Pods of the groups
+// that must remain available.
+func disruptionBudgetSpec(m *kubeaiv1.Model) (policyv1.PodDisruptionBudgetSpec, error) {
+	maxUnavailable := intstr.FromInt32(1)
+	if m.Spec.DisruptionBudget != nil {
+		maxUnavailable = m.Spec.DisruptionBudget.MaxUnavailable
+	}
+	spec := policyv1.PodDisruptionBudgetSpec{
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{kubeaiv1.PodModelLabel: m.Name},
+		},
+		UnhealthyPodEvictionPolicy: ptr.To(policyv1.AlwaysAllow),
+	}
+	if m.Spec.MultiNode == nil {
+		spec.MaxUnavailable = &maxUnavailable
+		return spec, nil
+	}
+
+	replicas := int(ptr.Deref(m.Spec.Replicas, 0))
+	unavailable, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, replicas, true)
+	if err != nil {
+		return spec, fmt.Errorf("invalid disruptionBudget.maxUnavailable: %w", err)
+	}
+	minAvailable := intstr.FromInt32(int32(max(0, replicas-unavailable)) * m.Spec.MultiNode.Size)
+	spec.MinAvailable = &minAvailable
+	return spec, nil
+}
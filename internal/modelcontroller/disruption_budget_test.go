@@ -0,0 +1,80 @@
+package modelcontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+)
+
+func Test_disruptionBudgetSpec(t *testing.T) {
+	cases := []struct {
+		name               string
+		budget             *v1.DisruptionBudget
+		multiNode          *v1.MultiNode
+		replicas           int32
+		wantMaxUnavailable *intstr.IntOrString
+		wantMinAvailable   *intstr.IntOrString
+	}{
+		{
+			name:               "default",
+			replicas:           3,
+			wantMaxUnavailable: ptr.To(intstr.FromInt32(1)),
+		},
+		{
+			name:               "percentage",
+			budget:             &v1.DisruptionBudget{MaxUnavailable: intstr.FromString("25%")},
+			replicas:           3,
+			wantMaxUnavailable: ptr.To(intstr.FromString("25%")),
+		},
+		{
+			name:             "multi-node",
+			multiNode:        &v1.MultiNode{Size: 2},
+			replicas:         3,
+			wantMinAvailable: ptr.To(intstr.FromInt32(4)),
+		},
+		{
+			name:             "multi-node percentage rounded up",
+			budget:           &v1.DisruptionBudget{MaxUnavailable: intstr.FromString("50%")},
+			multiNode:        &v1.MultiNode{Size: 4},
+			replicas:         3,
+			wantMinAvailable: ptr.To(intstr.FromInt32(4)),
+		},
+		{
+			name:             "multi-node single replica",
+			multiNode:        &v1.MultiNode{Size: 2},
+			replicas:         1,
+			wantMinAvailable: ptr.To(intstr.FromInt32(0)),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			model := &v1.Model{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-mdl"},
+				Spec: v1.ModelSpec{
+					Replicas:         ptr.To(c.replicas),
+					DisruptionBudget: c.budget,
+					MultiNode:        c.multiNode,
+				},
+			}
+			spec, err := disruptionBudgetSpec(model)
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{v1.PodModelLabel: "test-mdl"}, spec.Selector.MatchLabels)
+			require.Equal(t, policyv1.AlwaysAllow, *spec.UnhealthyPodEvictionPolicy)
+			require.Equal(t, c.wantMaxUnavailable, spec.MaxUnavailable)
+			require.Equal(t, c.wantMinAvailable, spec.MinAvailable)
+		})
+	}
+
+	_, err := disruptionBudgetSpec(&v1.Model{Spec: v1.ModelSpec{
+		Replicas:         ptr.To[int32](2),
+		DisruptionBudget: &v1.DisruptionBudget{MaxUnavailable: intstr.FromString("half")},
+		MultiNode:        &v1.MultiNode{Size: 2},
+	}})
+	require.Error(t, err)
+}
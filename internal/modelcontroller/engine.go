@@ -0,0 +1,190 @@
+package modelcontroller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/engines"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// engine is a model serving engine that Models select with Spec.Engine.
+// Each engine is implemented in an engine_<name>.go file that registers it
+// with registerEngine in an init function. The name must also be added to
+// the allowed values of ModelSpec.Engine.
+type engine struct {
+	// images returns the model server images of the engine by image name
+	// (see config.ResourceProfile.ImageName) from the system config.
+	images func(servers config.ModelServers) map[string]string
+	// podForModel returns the Pod that serves a Model. Its probes decide
+	// when the Pod is ready to receive requests (i.e. once the model is
+	// loaded). Engines that only need to define the model server container
+	// can use serverPodForModel.
+	podForModel func(r *ModelReconciler, m *kubeaiv1.Model, c ModelConfig) *corev1.Pod
+	// dialect adapts requests and responses for model servers that do not
+	// implement the OpenAI API. Optional.
+	dialect engines.Dialect
+	// tokenizePath is the path of the tokenize endpoint of the model server
+	// (see engines.RegisterTokenizePath). Optional.
+	tokenizePath string
+	// capabilities discovers the capabilities of the model from the model
+	// server of a ready Pod (see reconcileCapabilities). Optional.
+	capabilities func(r *ModelReconciler, ctx context.Context, m *kubeaiv1.Model, pod *corev1.Pod) (*kubeaiv1.ModelStatusCapabilities, error)
+	// args are the flags that the model server accepts in the args of
+	// Models, which the Model validation webhook checks. Optional.
+	args *engineArgs
+}
+
+var registeredEngines = map[string]engine{}
+
+// registerEngine registers an engine by name. It panics if the engine is
+// registered twice.
+func registerEngine(name string, e engine) {
+	if _, ok := registeredEngines[name]; ok {
+		panic(fmt.Sprintf("engine %q registered twice", name))
+	}
+	registeredEngines[name] = e
+	if e.dialect != nil {
+		engines.RegisterDialect(name, e.dialect)
+	}
+	if e.tokenizePath != "" {
+		engines.RegisterTokenizePath(name, e.tokenizePath)
+	}
+}
+
+func lookupEngine(name string) (engine, error) {
+	e, ok := registeredEngines[name]
+	if !ok {
+		return engine{}, fmt.Errorf("unknown engine: %q", name)
+	}
+	return e, nil
+}
+
+// serverPodForModel returns a Pod for a Model that runs the given model
+// server container, which listens on the given port. The container is named
+// "server" and gets the image and resources of the Model's config and the
+// Model's env. The Pod gets the scheduling constraints of the resource
+// profile, the model cache and the credentials of the model source.
+func (r *ModelReconciler) serverPodForModel(m *kubeaiv1.Model, c ModelConfig, server corev1.Container, port int32) *corev1.Pod {
+	ann := r.annotationsForModel(m)
+	if _, ok := ann[kubeaiv1.ModelPodPortAnnotation]; !ok {
+		ann[kubeaiv1.ModelPodPortAnnotation] = strconv.Itoa(int(port))
+	}
+
+	server.Name = serverContainerName
+	server.Image = c.Image
+	server.Resources = corev1.ResourceRequirements{
+		Requests: c.Requests,
+		Limits:   c.Limits,
+	}
+	if server.SecurityContext == nil {
+		server.SecurityContext = r.ModelServerPods.ModelContainerSecurityContext
+	}
+	if len(server.Ports) == 0 {
+		server.Ports = []corev1.ContainerPort{
+			{
+				ContainerPort: port,
+				Protocol:      corev1.ProtocolTCP,
+				Name:          "http",
+			},
+		}
+	}
+	var envKeys []string
+	for key := range m.Spec.Env {
+		envKeys = append(envKeys, key)
+	}
+	sort.Strings(envKeys)
+	for _, key := range envKeys {
+		server.Env = append(server.Env, corev1.EnvVar{
+			Name:  key,
+			Value: m.Spec.Env[key],
+		})
+	}
+	server.VolumeMounts = append(server.VolumeMounts, corev1.VolumeMount{
+		Name:      "dshm",
+		MountPath: "/dev/shm",
+	})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   m.Namespace,
+			Labels:      labelsForModel(m),
+			Annotations: ann,
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector:       c.NodeSelector,
+			Affinity:           c.Affinity,
+			Tolerations:        c.Tolerations,
+			RuntimeClassName:   c.RuntimeClassName,
+			ServiceAccountName: r.ModelServerPods.ModelServiceAccountName,
+			SecurityContext:    r.ModelServerPods.ModelPodSecurityContext,
+			Containers:         []corev1.Container{server},
+			Volumes: []corev1.Volume{
+				{
+					Name: "dshm",
+					VolumeSource: corev1.VolumeSource{
+						EmptyDir: &corev1.EmptyDirVolumeSource{
+							Medium: corev1.StorageMediumMemory,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	patchServerCacheVolumes(&pod.Spec, m, c)
+	c.Source.modelAuthCredentials.applyToPodSpec(&pod.Spec, 0)
+
+	return pod
+}
+
+// httpHealthProbes returns the probes of a model server container with an
+// HTTP health endpoint on its "http" port. The startup probe allows the model
+// server to load the model for up to startupTimeout.
+func httpHealthProbes(path string, startupTimeout time.Duration) (startup, readiness, liveness *corev1.Probe) {
+	handler := corev1.ProbeHandler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path: path,
+			Port: intstr.FromString("http"),
+		},
+	}
+	startup = &corev1.Probe{
+		FailureThreshold: int32(max(1, startupTimeout/(2*time.Second))),
+		PeriodSeconds:    2,
+		TimeoutSeconds:   2,
+		SuccessThreshold: 1,
+		ProbeHandler:     handler,
+	}
+	readiness = &corev1.Probe{
+		FailureThreshold: 3,
+		PeriodSeconds:    10,
+		TimeoutSeconds:   2,
+		SuccessThreshold: 1,
+		ProbeHandler:     handler,
+	}
+	liveness = &corev1.Probe{
+		FailureThreshold: 3,
+		PeriodSeconds:    30,
+		TimeoutSeconds:   3,
+		SuccessThreshold: 1,
+		ProbeHandler:     handler,
+	}
+	return startup, readiness, liveness
+}
+
+// modelPath returns the model argument of a model server: the path of the
+// model in the cache or else the reference of the model source (i.e.
+// "<repo>/<model>" for Huggingface).
+func modelPath(m *kubeaiv1.Model, c ModelConfig) string {
+	if m.Spec.CacheProfile != "" {
+		return modelCacheDir(m)
+	}
+	return c.Source.url.ref
+}
@@ -4,11 +4,21 @@ import (
 	"sort"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+func init() {
+	registerEngine(kubeaiv1.FasterWhisperEngine, engine{
+		images: func(servers config.ModelServers) map[string]string {
+			return servers.FasterWhisper.Images
+		},
+		podForModel: (*ModelReconciler).fasterWhisperPodForModel,
+	})
+}
+
 func (r *ModelReconciler) fasterWhisperPodForModel(m *kubeaiv1.Model, c ModelConfig) *corev1.Pod {
 	lbs := labelsForModel(m)
 	ann := r.annotationsForModel(m)
@@ -17,7 +27,7 @@ func (r *ModelReconciler) fasterWhisperPodForModel(m *kubeaiv1.Model, c ModelCon
 	}
 
 	args := []string{}
-	args = append(args, m.Spec.Args...)
+	args = append(args, modelArgs(m)...)
 
 	whisperModel := c.Source.url.ref
 	if m.Spec.CacheProfile != "" {
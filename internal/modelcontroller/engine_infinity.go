@@ -4,11 +4,37 @@ import (
 	"sort"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+func init() {
+	registerEngine(kubeaiv1.InfinityEngine, engine{
+		images: func(servers config.ModelServers) map[string]string {
+			return servers.Infinity.Images
+		},
+		podForModel: (*ModelReconciler).infinityPodForModel,
+		args:        infinityArgs,
+	})
+}
+
+// infinityArgs are the flags of "infinity_emb v2".
+var infinityArgs = &engineArgs{
+	known: []string{
+		"--model-id", "--served-model-name", "--batch-size", "--revision", "--trust-remote-code",
+		"--no-trust-remote-code", "--engine", "--model-warmup", "--no-model-warmup", "--vector-disk-cache",
+		"--no-vector-disk-cache", "--device", "--device-id", "--lengths-via-tokenize",
+		"--no-lengths-via-tokenize", "--dtype", "--embedding-dtype", "--pooling-method", "--compile",
+		"--no-compile", "--bettertransformer", "--no-bettertransformer", "--preload-only",
+		"--no-preload-only", "--host", "--port", "--url-prefix", "--redirect-slash", "--log-level",
+		"--permissive-cors", "--no-permissive-cors", "--api-key", "--proxy-root-path",
+	},
+	// Set with the INFINITY_* env of the Pod.
+	managed: []string{"--model-id", "--served-model-name", "--url-prefix"},
+}
+
 func (r *ModelReconciler) infinityPodForModel(m *kubeaiv1.Model, c ModelConfig) *corev1.Pod {
 	lbs := labelsForModel(m)
 	ann := r.annotationsForModel(m)
@@ -16,7 +42,7 @@ func (r *ModelReconciler) infinityPodForModel(m *kubeaiv1.Model, c ModelConfig)
 	args := []string{
 		"v2",
 	}
-	args = append(args, m.Spec.Args...)
+	args = append(args, modelArgs(m)...)
 
 	if _, ok := ann[kubeaiv1.ModelPodPortAnnotation]; !ok {
 		ann[kubeaiv1.ModelPodPortAnnotation] = "8000"
@@ -44,8 +70,8 @@ func (r *ModelReconciler) infinityPodForModel(m *kubeaiv1.Model, c ModelConfig)
 		},
 		{
 			Name: "INFINITY_ENGINE",
-			// TODO: switch between optimum backend (cpu), nvidia/amd (torch), inf2 (inferentia) based on what is available.
-			Value: "torch",
+			// TODO: switch to the optimum backend on CPUs.
+			Value: infinityEngine(c),
 		},
 		{
 			Name:  "INFINITY_PORT",
@@ -161,3 +187,12 @@ func (r *ModelReconciler) infinityPodForModel(m *kubeaiv1.Model, c ModelConfig)
 
 	return pod
 }
+
+// infinityEngine returns the inference backend of Infinity for the
+// accelerator of the Model's resource profile.
+func infinityEngine(c ModelConfig) string {
+	if profileAccelerator(c.ResourceProfile) == config.AWSNeuronAccelerator {
+		return "neuron"
+	}
+	return "torch"
+}
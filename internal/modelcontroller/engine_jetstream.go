@@ -0,0 +1,135 @@
+package modelcontroller
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	jetStreamGRPCPort = 9000
+	jetStreamHTTPPort = 8000
+)
+
+func init() {
+	registerEngine(kubeaiv1.JetStreamEngine, engine{
+		images: func(servers config.ModelServers) map[string]string {
+			return servers.JetStream.Images
+		},
+		podForModel: (*ModelReconciler).jetStreamPodForModel,
+		dialect:     jetStreamDialect{},
+	})
+}
+
+// jetStreamPodForModel returns a Pod that runs the JetStream server (gRPC)
+// with its HTTP frontend as a second container that receives the requests.
+func (r *ModelReconciler) jetStreamPodForModel(m *kubeaiv1.Model, c ModelConfig) *corev1.Pod {
+	grpcProbe := func(failureThreshold, periodSeconds int32) *corev1.Probe {
+		return &corev1.Probe{
+			FailureThreshold: failureThreshold,
+			PeriodSeconds:    periodSeconds,
+			TimeoutSeconds:   2,
+			SuccessThreshold: 1,
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("grpc")},
+			},
+		}
+	}
+
+	pod := r.serverPodForModel(m, c, corev1.Container{
+		Args: append([]string{
+			"--model_id=" + modelPath(m, c),
+			fmt.Sprintf("--port=%d", jetStreamGRPCPort),
+		}, modelArgs(m)...),
+		Ports: []corev1.ContainerPort{
+			{
+				ContainerPort: jetStreamGRPCPort,
+				Protocol:      corev1.ProtocolTCP,
+				Name:          "grpc",
+			},
+		},
+		// The server only listens once the model is loaded (and warmed up)
+		// on the TPUs, which can take up to an hour.
+		StartupProbe:   grpcProbe(int32(time.Hour/(2*time.Second)), 2),
+		ReadinessProbe: grpcProbe(3, 10),
+		LivenessProbe:  grpcProbe(3, 30),
+	}, jetStreamHTTPPort)
+
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+		Name:            "http",
+		Image:           r.ModelServers.JetStream.HTTPImage,
+		SecurityContext: r.ModelServerPods.ModelContainerSecurityContext,
+		Ports: []corev1.ContainerPort{
+			{
+				ContainerPort: jetStreamHTTPPort,
+				Protocol:      corev1.ProtocolTCP,
+				Name:          "http",
+			},
+		},
+		ReadinessProbe: &corev1.Probe{
+			FailureThreshold: 3,
+			PeriodSeconds:    10,
+			TimeoutSeconds:   2,
+			SuccessThreshold: 1,
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("http")},
+			},
+		},
+	})
+
+	return pod
+}
+
+// jetStreamDialect serves completions with the HTTP frontend of JetStream,
+// which generates text for a prompt at /generate.
+type jetStreamDialect struct{}
+
+// defaultMaxTokens is the max_tokens of OpenAI completions requests that
+// do not set it, JetStream requires it.
+const defaultMaxTokens = 16
+
+func (jetStreamDialect) RewriteRequest(path string, params map[string]interface{}) (string, error) {
+	if path != "/v1/completions" {
+		return "", fmt.Errorf("only completions are supported by the %s engine", kubeaiv1.JetStreamEngine)
+	}
+	if stream, _ := params["stream"].(bool); stream {
+		return "", fmt.Errorf("streaming is not supported by the %s engine", kubeaiv1.JetStreamEngine)
+	}
+	prompt, ok := params["prompt"].(string)
+	if !ok {
+		return "", fmt.Errorf("the %s engine requires a single string prompt", kubeaiv1.JetStreamEngine)
+	}
+	maxTokens, ok := params["max_tokens"]
+	if !ok {
+		maxTokens = defaultMaxTokens
+	}
+
+	clear(params)
+	params["prompt"] = prompt
+	params["max_tokens"] = maxTokens
+	return "/generate", nil
+}
+
+func (jetStreamDialect) RewriteResponse(path string, body []byte) ([]byte, error) {
+	var resp struct {
+		Response string `json:"response"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	return json.Marshal(map[string]any{
+		"object":  "text_completion",
+		"created": time.Now().Unix(),
+		"choices": []any{
+			map[string]any{
+				"index": 0,
+				"text":  resp.Response,
+			},
+		},
+	})
+}
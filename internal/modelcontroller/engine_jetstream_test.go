@@ -0,0 +1,68 @@
+package modelcontroller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_jetStreamPodForModel(t *testing.T) {
+	r := &ModelReconciler{ModelServers: config.ModelServers{
+		JetStream: config.JetStreamModelServer{HTTPImage: "jetstream-http:v1"},
+	}}
+	model := &v1.Model{
+		ObjectMeta: metav1.ObjectMeta{Name: "llama-3-8b", Namespace: "default"},
+		Spec: v1.ModelSpec{
+			Engine: v1.JetStreamEngine,
+			Args:   []string{"--override_batch_size=30"},
+		},
+	}
+	cfg := ModelConfig{
+		Image:  "jetstream-pytorch-server:v1",
+		Source: modelSource{modelAuthCredentials: &modelAuthCredentials{}, url: modelURL{scheme: "hf", ref: "meta-llama/Meta-Llama-3-8B"}},
+	}
+
+	pod := r.jetStreamPodForModel(model, cfg)
+	require.Equal(t, "8000", pod.Annotations[v1.ModelPodPortAnnotation])
+	require.Len(t, pod.Spec.Containers, 2)
+	server, http := pod.Spec.Containers[0], pod.Spec.Containers[1]
+	require.Equal(t, "jetstream-pytorch-server:v1", server.Image)
+	require.Equal(t, []string{"--model_id=meta-llama/Meta-Llama-3-8B", "--port=9000", "--override_batch_size=30"}, server.Args)
+	require.Equal(t, int32(9000), server.Ports[0].ContainerPort)
+	require.Equal(t, "jetstream-http:v1", http.Image)
+	require.Equal(t, int32(8000), http.Ports[0].ContainerPort)
+}
+
+func Test_jetStreamDialect(t *testing.T) {
+	d := jetStreamDialect{}
+
+	params := map[string]interface{}{"model": "llama-3-8b", "prompt": "hello", "temperature": 0.5}
+	path, err := d.RewriteRequest("/v1/completions", params)
+	require.NoError(t, err)
+	require.Equal(t, "/generate", path)
+	require.Equal(t, map[string]interface{}{"prompt": "hello", "max_tokens": defaultMaxTokens}, params)
+
+	_, err = d.RewriteRequest("/v1/chat/completions", map[string]interface{}{"messages": []any{}})
+	require.ErrorContains(t, err, "only completions are supported")
+	_, err = d.RewriteRequest("/v1/completions", map[string]interface{}{"prompt": "hello", "stream": true})
+	require.ErrorContains(t, err, "streaming is not supported")
+	_, err = d.RewriteRequest("/v1/completions", map[string]interface{}{"prompt": []any{"a", "b"}})
+	require.ErrorContains(t, err, "single string prompt")
+
+	body, err := d.RewriteResponse("/v1/completions", []byte(`{"response":" world"}`))
+	require.NoError(t, err)
+	var resp struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Text string `json:"text"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(body, &resp))
+	require.Equal(t, "text_completion", resp.Object)
+	require.Len(t, resp.Choices, 1)
+	require.Equal(t, " world", resp.Choices[0].Text)
+}
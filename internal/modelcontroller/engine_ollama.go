@@ -5,11 +5,22 @@ import (
 	"sort"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+func init() {
+	registerEngine(kubeaiv1.OLlamaEngine, engine{
+		images: func(servers config.ModelServers) map[string]string {
+			return servers.OLlama.Images
+		},
+		podForModel:  (*ModelReconciler).oLlamaPodForModel,
+		capabilities: (*ModelReconciler).oLlamaCapabilities,
+	})
+}
+
 func (r *ModelReconciler) oLlamaPodForModel(m *kubeaiv1.Model, c ModelConfig) *corev1.Pod {
 	lbs := labelsForModel(m)
 	ann := r.annotationsForModel(m)
@@ -86,7 +97,7 @@ func (r *ModelReconciler) oLlamaPodForModel(m *kubeaiv1.Model, c ModelConfig) *c
 				{
 					Name:            serverContainerName,
 					Image:           c.Image,
-					Args:            m.Spec.Args,
+					Args:            modelArgs(m),
 					Env:             env,
 					SecurityContext: r.ModelServerPods.ModelContainerSecurityContext,
 					Resources: corev1.ResourceRequirements{
@@ -0,0 +1,60 @@
+package modelcontroller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_lookupEngine(t *testing.T) {
+	for _, name := range []string{v1.VLLMEngine, v1.OLlamaEngine, v1.FasterWhisperEngine, v1.InfinityEngine, v1.JetStreamEngine} {
+		_, err := lookupEngine(name)
+		require.NoError(t, err, name)
+	}
+	// Echo Models are served by KubeAI without Pods.
+	_, err := lookupEngine(v1.EchoEngine)
+	require.Error(t, err)
+}
+
+func Test_serverPodForModel(t *testing.T) {
+	r := &ModelReconciler{}
+	model := &v1.Model{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-model", Namespace: "default"},
+		Spec: v1.ModelSpec{
+			Engine: "Test",
+			Env:    map[string]string{"B": "2", "A": "1"},
+		},
+	}
+	cfg := ModelConfig{
+		Image:  "my-server:v1",
+		Source: modelSource{modelAuthCredentials: &modelAuthCredentials{}, url: modelURL{scheme: "hf", ref: "org/model"}},
+		ResourceProfile: config.ResourceProfile{
+			NodeSelector: map[string]string{"gpu": "true"},
+		},
+	}
+
+	startup, readiness, liveness := httpHealthProbes("/health", 10*time.Minute)
+	require.Equal(t, int32(300), startup.FailureThreshold)
+	pod := r.serverPodForModel(model, cfg, corev1.Container{
+		Args:           []string{"--model", modelPath(model, cfg)},
+		StartupProbe:   startup,
+		ReadinessProbe: readiness,
+		LivenessProbe:  liveness,
+	}, 30000)
+
+	require.Equal(t, "30000", pod.Annotations[v1.ModelPodPortAnnotation])
+	require.Equal(t, "my-model", pod.Labels[v1.PodModelLabel])
+	require.Equal(t, map[string]string{"gpu": "true"}, pod.Spec.NodeSelector)
+	require.Len(t, pod.Spec.Containers, 1)
+	server := pod.Spec.Containers[0]
+	require.Equal(t, serverContainerName, server.Name)
+	require.Equal(t, "my-server:v1", server.Image)
+	require.Equal(t, []string{"--model", "org/model"}, server.Args)
+	require.Equal(t, int32(30000), server.Ports[0].ContainerPort)
+	require.Equal(t, []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}}, server.Env)
+}
@@ -4,11 +4,73 @@ import (
 	"sort"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+func init() {
+	registerEngine(kubeaiv1.VLLMEngine, engine{
+		images: func(servers config.ModelServers) map[string]string {
+			return servers.VLLM.Images
+		},
+		podForModel:  (*ModelReconciler).vLLMPodForModel,
+		capabilities: (*ModelReconciler).vLLMCapabilities,
+		tokenizePath: "/tokenize",
+		args:         vLLMArgs,
+	})
+}
+
+// vLLMArgs are the flags of the OpenAI-compatible server of vLLM.
+var vLLMArgs = &engineArgs{
+	known: []string{
+		"--host", "--port", "--uvicorn-log-level", "--allow-credentials", "--allowed-origins",
+		"--allowed-methods", "--allowed-headers", "--api-key", "--lora-modules", "--prompt-adapters",
+		"--chat-template", "--chat-template-content-format", "--response-role", "--ssl-keyfile",
+		"--ssl-certfile", "--ssl-ca-certs", "--ssl-cert-reqs", "--root-path", "--middleware",
+		"--return-tokens-as-token-ids", "--disable-frontend-multiprocessing", "--enable-request-id-headers",
+		"--enable-auto-tool-choice", "--tool-call-parser", "--tool-parser-plugin", "--model", "--task",
+		"--tokenizer", "--skip-tokenizer-init", "--revision", "--code-revision", "--tokenizer-revision",
+		"--tokenizer-mode", "--trust-remote-code", "--allowed-local-media-path", "--download-dir",
+		"--load-format", "--config-format", "--dtype", "--kv-cache-dtype", "--quantization-param-path",
+		"--max-model-len", "--guided-decoding-backend", "--distributed-executor-backend", "--worker-use-ray",
+		"--pipeline-parallel-size", "--tensor-parallel-size", "--max-parallel-loading-workers",
+		"--ray-workers-use-nsight", "--block-size", "--enable-prefix-caching", "--disable-sliding-window",
+		"--use-v2-block-manager", "--num-lookahead-slots", "--seed", "--swap-space", "--cpu-offload-gb",
+		"--gpu-memory-utilization", "--num-gpu-blocks-override", "--max-num-batched-tokens", "--max-num-seqs",
+		"--max-logprobs", "--disable-log-stats", "--quantization", "--rope-scaling", "--rope-theta",
+		"--hf-overrides", "--enforce-eager", "--max-seq-len-to-capture", "--disable-custom-all-reduce",
+		"--tokenizer-pool-size", "--tokenizer-pool-type", "--tokenizer-pool-extra-config",
+		"--limit-mm-per-prompt", "--mm-processor-kwargs", "--enable-lora", "--enable-lora-bias", "--max-loras",
+		"--max-lora-rank", "--lora-extra-vocab-size", "--lora-dtype", "--long-lora-scaling-factors",
+		"--max-cpu-loras", "--fully-sharded-loras", "--enable-prompt-adapter", "--max-prompt-adapters",
+		"--max-prompt-adapter-token", "--device", "--num-scheduler-steps", "--multi-step-stream-outputs",
+		"--scheduler-delay-factor", "--enable-chunked-prefill", "--speculative-model",
+		"--speculative-model-quantization", "--num-speculative-tokens", "--speculative-disable-mqa-scorer",
+		"--speculative-draft-tensor-parallel-size", "--speculative-max-model-len",
+		"--speculative-disable-by-batch-size", "--ngram-prompt-lookup-max", "--ngram-prompt-lookup-min",
+		"--spec-decoding-acceptance-method", "--typical-acceptance-sampler-posterior-threshold",
+		"--typical-acceptance-sampler-posterior-alpha", "--disable-logprobs-during-spec-decoding",
+		"--model-loader-extra-config", "--ignore-patterns", "--preemption-mode", "--served-model-name",
+		"--qlora-adapter-name-or-path", "--otlp-traces-endpoint", "--collect-detailed-traces",
+		"--disable-async-output-proc", "--scheduling-policy", "--override-neuron-config",
+		"--override-pooler-config", "--compilation-config", "--kv-transfer-config", "--worker-cls",
+		"--generation-config", "--disable-log-requests", "--max-log-len", "--disable-fastapi-docs",
+		"--enable-prompt-tokens-details",
+	},
+	aliases: map[string]string{
+		"-tp": "--tensor-parallel-size",
+		"-pp": "--pipeline-parallel-size",
+		"-q":  "--quantization",
+		"-O":  "--compilation-config",
+	},
+	abbreviations: true,
+	managed:       []string{"--model", "--served-model-name"},
+	parallelism:   []string{"--tensor-parallel-size", "--pipeline-parallel-size"},
+	accelerator:   vLLMAcceleratorArgs,
+}
+
 func (r *ModelReconciler) vLLMPodForModel(m *kubeaiv1.Model, c ModelConfig) *corev1.Pod {
 	lbs := labelsForModel(m)
 	ann := r.annotationsForModel(m)
@@ -26,7 +88,9 @@ func (r *ModelReconciler) vLLMPodForModel(m *kubeaiv1.Model, c ModelConfig) *cor
 		"--model=" + vllmModelFlag,
 		"--served-model-name=" + m.Name,
 	}
-	args = append(args, m.Spec.Args...)
+	args = append(args, modelArgs(m)...)
+	args = append(args, vLLMGPUMemoryUtilizationArgs(c, args)...)
+	args = append(args, vLLMAcceleratorArgs(c, args)...)
 
 	env := []corev1.EnvVar{}
 
@@ -145,7 +209,11 @@ func (r *ModelReconciler) vLLMPodForModel(m *kubeaiv1.Model, c ModelConfig) *cor
 
 	r.patchServerAdapterLoader(&pod.Spec, m, r.ModelLoaders.Image)
 	patchServerCacheVolumes(&pod.Spec, m, c)
+	patchServerDraftModel(&pod.Spec, m, c)
 	c.Source.modelAuthCredentials.applyToPodSpec(&pod.Spec, 0)
+	if m.Spec.MultiNode != nil {
+		patchMultiNodeLeader(pod, m.Spec.MultiNode)
+	}
 
 	return pod
 }
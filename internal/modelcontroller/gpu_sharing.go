@@ -0,0 +1,80 @@
+package modelcontroller
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/substratusai/kubeai/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	nvidiaGPUResource = corev1.ResourceName("nvidia.com/gpu")
+
+	// Labels of the NVIDIA GPU feature discovery.
+	nvidiaMIGStrategyLabel = "nvidia.com/mig.strategy"
+	nvidiaGPUReplicasLabel = "nvidia.com/gpu.replicas"
+
+	// vLLM allocates this fraction of the GPU memory by default.
+	vLLMDefaultGPUMemoryUtilization = 0.9
+)
+
+// applyGPUSharing returns the resource profile with the GPU requests, limits
+// and node selector of its GPU sharing: one MIG slice or time-sliced GPU
+// replica per unit of the profile instead of a whole GPU.
+func applyGPUSharing(rp config.ResourceProfile) config.ResourceProfile {
+	s := rp.GPUSharing
+	if s == nil {
+		return rp
+	}
+
+	name := nvidiaGPUResource
+	nodeSelector := maps.Clone(rp.NodeSelector)
+	if nodeSelector == nil {
+		nodeSelector = map[string]string{}
+	}
+	if s.MIGProfile != "" {
+		name = corev1.ResourceName("nvidia.com/mig-" + s.MIGProfile)
+		nodeSelector[nvidiaMIGStrategyLabel] = "mixed"
+	} else {
+		nodeSelector[nvidiaGPUReplicasLabel] = strconv.Itoa(int(s.TimeSlicingReplicas))
+	}
+	if s.ResourceName != "" {
+		name = corev1.ResourceName(s.ResourceName)
+	}
+
+	rp.Requests = withGPUSlice(rp.Requests, name)
+	rp.Limits = withGPUSlice(rp.Limits, name)
+	rp.NodeSelector = nodeSelector
+	return rp
+}
+
+// withGPUSlice replaces the whole GPU of a resource list with one unit of the
+// given (sliced) resource.
+func withGPUSlice(resources corev1.ResourceList, name corev1.ResourceName) corev1.ResourceList {
+	result := resources.DeepCopy()
+	if result == nil {
+		result = corev1.ResourceList{}
+	}
+	delete(result, nvidiaGPUResource)
+	result[name] = resource.MustParse("1")
+	return result
+}
+
+// vLLMGPUMemoryUtilizationArgs limits the GPU memory that vLLM allocates to
+// the fraction of a time-sliced GPU that a Pod requests, unless the Model sets
+// the limit itself.
+func vLLMGPUMemoryUtilizationArgs(c ModelConfig, args []string) []string {
+	s := c.GPUSharing
+	if s == nil || s.TimeSlicingReplicas <= 0 || slices.ContainsFunc(args, func(arg string) bool {
+		return strings.HasPrefix(arg, "--gpu-memory-utilization")
+	}) {
+		return nil
+	}
+	fraction := min(float64(c.ResourceProfileMultiple)/float64(s.TimeSlicingReplicas), 1)
+	return []string{fmt.Sprintf("--gpu-memory-utilization=%.2f", fraction*vLLMDefaultGPUMemoryUtilization)}
+}
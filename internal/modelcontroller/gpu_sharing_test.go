@@ -0,0 +1,88 @@
+package modelcontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func Test_applyGPUSharing(t *testing.T) {
+	profile := func(sharing *config.GPUSharing) config.ResourceProfile {
+		return config.ResourceProfile{
+			Requests: corev1.ResourceList{
+				nvidiaGPUResource:  resource.MustParse("1"),
+				corev1.ResourceCPU: resource.MustParse("2"),
+			},
+			Limits:       corev1.ResourceList{nvidiaGPUResource: resource.MustParse("1")},
+			NodeSelector: map[string]string{"pool": "gpu"},
+			GPUSharing:   sharing,
+		}
+	}
+
+	cases := []struct {
+		name             string
+		sharing          *config.GPUSharing
+		wantResource     corev1.ResourceName
+		wantNodeSelector map[string]string
+	}{
+		{
+			name:             "no sharing",
+			wantResource:     nvidiaGPUResource,
+			wantNodeSelector: map[string]string{"pool": "gpu"},
+		},
+		{
+			name:             "mig",
+			sharing:          &config.GPUSharing{MIGProfile: "1g.10gb"},
+			wantResource:     "nvidia.com/mig-1g.10gb",
+			wantNodeSelector: map[string]string{"pool": "gpu", nvidiaMIGStrategyLabel: "mixed"},
+		},
+		{
+			name:             "time slicing",
+			sharing:          &config.GPUSharing{TimeSlicingReplicas: 4},
+			wantResource:     nvidiaGPUResource,
+			wantNodeSelector: map[string]string{"pool": "gpu", nvidiaGPUReplicasLabel: "4"},
+		},
+		{
+			name:             "renamed time-sliced resource",
+			sharing:          &config.GPUSharing{TimeSlicingReplicas: 4, ResourceName: "nvidia.com/gpu.shared"},
+			wantResource:     "nvidia.com/gpu.shared",
+			wantNodeSelector: map[string]string{"pool": "gpu", nvidiaGPUReplicasLabel: "4"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			original := profile(c.sharing)
+			rp := applyGPUSharing(original)
+			require.Equal(t, corev1.ResourceList{
+				c.wantResource:     resource.MustParse("1"),
+				corev1.ResourceCPU: resource.MustParse("2"),
+			}, rp.Requests)
+			require.Equal(t, corev1.ResourceList{c.wantResource: resource.MustParse("1")}, rp.Limits)
+			require.Equal(t, c.wantNodeSelector, rp.NodeSelector)
+			// The configured profile is not modified.
+			require.Equal(t, profile(c.sharing), original)
+		})
+	}
+}
+
+func Test_vLLMGPUMemoryUtilizationArgs(t *testing.T) {
+	timeSliced := func(multiple int32) ModelConfig {
+		return ModelConfig{
+			ResourceProfile:         config.ResourceProfile{GPUSharing: &config.GPUSharing{TimeSlicingReplicas: 4}},
+			ResourceProfileMultiple: multiple,
+		}
+	}
+	require.Nil(t, vLLMGPUMemoryUtilizationArgs(ModelConfig{ResourceProfileMultiple: 1}, nil))
+	require.Nil(t, vLLMGPUMemoryUtilizationArgs(ModelConfig{
+		ResourceProfile:         config.ResourceProfile{GPUSharing: &config.GPUSharing{MIGProfile: "1g.10gb"}},
+		ResourceProfileMultiple: 1,
+	}, nil))
+	require.Equal(t, []string{"--gpu-memory-utilization=0.23"}, vLLMGPUMemoryUtilizationArgs(timeSliced(1), nil))
+	require.Equal(t, []string{"--gpu-memory-utilization=0.45"}, vLLMGPUMemoryUtilizationArgs(timeSliced(2), nil))
+	require.Equal(t, []string{"--gpu-memory-utilization=0.90"}, vLLMGPUMemoryUtilizationArgs(timeSliced(8), nil))
+	require.Nil(t, vLLMGPUMemoryUtilizationArgs(timeSliced(1), []string{"--gpu-memory-utilization=0.3"}))
+}
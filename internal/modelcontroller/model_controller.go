@@ -21,24 +21,33 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/client-go/rest"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
 	"github.com/substratusai/kubeai/internal/config"
 	"github.com/substratusai/kubeai/internal/k8sutils"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"github.com/substratusai/kubeai/internal/modelnamespaces"
+	"github.com/substratusai/kubeai/internal/ollamaclient"
 	"github.com/substratusai/kubeai/internal/vllmclient"
+	"go.opentelemetry.io/otel/metric"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -50,19 +59,39 @@ const (
 // ModelReconciler reconciles a Model object
 type ModelReconciler struct {
 	client.Client
-	RESTConfig              *rest.Config
-	PodRESTClient           rest.Interface
-	Scheme                  *runtime.Scheme
-	VLLMClient              *vllmclient.Client
-	Namespace               string
+	RESTConfig    *rest.Config
+	PodRESTClient rest.Interface
+	Scheme        *runtime.Scheme
+	VLLMClient    *vllmclient.Client
+	OLlamaClient  *ollamaclient.Client
+	Namespace     string
+	// ModelNamespaces are the namespaces that Models are served from
+	// in order of precedence (see the modelnamespaces package).
+	ModelNamespaces         []string
 	AllowPodAddressOverride bool
 	SecretNames             config.SecretNames
 	ResourceProfiles        map[string]config.ResourceProfile
 	CacheProfiles           map[string]config.CacheProfile
+	Spot                    config.Spot
 	ModelServers            config.ModelServers
 	ModelServerPods         config.ModelServerPods
 	ModelLoaders            config.ModelLoading
 	ModelRollouts           config.ModelRollouts
+	// InFlight is used to delete Pods with active requests last
+	// when scaling down. Optional.
+	InFlight InFlightCounter
+	// WeightsRevisions resolves the revision of the weights of Models
+	// with weight updates. Optional.
+	WeightsRevisions WeightsRevisionResolver
+	// Vocabularies resolves the vocabularies of Models to check that draft
+	// Models use the same tokenizer as the Models that use them. Optional.
+	Vocabularies VocabularyResolver
+}
+
+// InFlightCounter reports the number of in-flight requests to a Model's Pods.
+type InFlightCounter interface {
+	// InFlightByPod returns the number of in-flight requests by Pod name.
+	InFlightByPod(model string) map[string]int64
 }
 
 // +kubebuilder:rbac:groups=kubeai.org,resources=models,verbs=get;list;watch;create;update;patch;delete
@@ -73,6 +102,7 @@ type ModelReconciler struct {
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=pods/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups="",resources=pods/finalizers,verbs=update
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
 
 func (r *ModelReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, resErr error) {
 	log := log.FromContext(ctx)
@@ -95,8 +125,23 @@ func (r *ModelReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 
 	// Apply self labels based on features so that we can easily filter models.
 	shouldUpdate := r.applySelfLabels(model)
-	// Apply replica bounds to handle cases where min/max replicas were updated but a scale event was not triggered.
-	if !model.Spec.AutoscalingDisabled {
+	active, activeChange := setActiveCondition(model, time.Now())
+	if !activeChange.IsZero() {
+		// Reconcile again when the Model is activated or deactivated.
+		defer func() {
+			if d := time.Until(activeChange); resErr == nil && d > 0 && (res.RequeueAfter == 0 || d < res.RequeueAfter) {
+				res.RequeueAfter = d
+			}
+		}()
+	}
+	if !active {
+		// Keep the Model at zero replicas outside of its active windows.
+		if model.Spec.Replicas == nil || *model.Spec.Replicas != 0 {
+			model.Spec.Replicas = ptr.To[int32](0)
+			shouldUpdate = true
+		}
+	} else if !model.Spec.AutoscalingDisabled && !model.Spec.AutoscalingDryRun {
+		// Apply replica bounds to handle cases where min/max replicas were updated but a scale event was not triggered.
 		shouldUpdate = r.applyAutoscalingReplicaBounds(model) || shouldUpdate
 	}
 	if shouldUpdate {
@@ -105,6 +150,50 @@ func (r *ModelReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		}
 	}
 
+	if model.DeletionTimestamp == nil {
+		shadowing, err := modelnamespaces.Shadowing(ctx, r.Client, r.ModelNamespaces, req.NamespacedName)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("checking for models with the same name: %w", err)
+		}
+		if shadowing != nil {
+			// Only one Model is served per name, remove the Pods of
+			// this one until the Model that shadows it is deleted.
+			if err := r.DeleteAllOf(ctx, &corev1.Pod{}, client.InNamespace(model.Namespace), client.MatchingLabels{
+				kubeaiv1.PodModelLabel: model.Name,
+			}); err != nil && !apierrors.IsNotFound(err) {
+				return ctrl.Result{}, fmt.Errorf("deleting all pods: %w", err)
+			}
+			model.Status.Replicas = kubeaiv1.ModelStatusReplicas{}
+			meta.SetStatusCondition(&model.Status.Conditions, metav1.Condition{
+				Type:               kubeaiv1.ModelConditionReady,
+				Status:             metav1.ConditionFalse,
+				Reason:             kubeaiv1.ModelReasonNameConflict,
+				Message:            fmt.Sprintf("Model %s/%s is served under this name instead", shadowing.Namespace, shadowing.Name),
+				ObservedGeneration: model.Generation,
+			})
+			return ctrl.Result{}, nil
+		}
+	}
+
+	if model.Spec.Engine == kubeaiv1.EchoEngine {
+		// Echo Models are served by KubeAI itself, remove any Pods
+		// from before the Model was switched to the Echo engine.
+		if err := r.DeleteAllOf(ctx, &corev1.Pod{}, client.InNamespace(model.Namespace), client.MatchingLabels{
+			kubeaiv1.PodModelLabel: model.Name,
+		}); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("deleting all pods: %w", err)
+		}
+		model.Status.Replicas = kubeaiv1.ModelStatusReplicas{}
+		meta.SetStatusCondition(&model.Status.Conditions, metav1.Condition{
+			Type:               kubeaiv1.ModelConditionReady,
+			Status:             metav1.ConditionTrue,
+			Reason:             kubeaiv1.ModelReasonEchoEngine,
+			Message:            "Requests are served by KubeAI",
+			ObservedGeneration: model.Generation,
+		})
+		return ctrl.Result{}, nil
+	}
+
 	modelConfig, err := r.getModelConfig(model)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("getting model profile: %w", err)
@@ -137,31 +226,45 @@ func (r *ModelReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		cacheRes, err := r.reconcileCache(ctx, model, modelConfig)
 		if err != nil {
 			if errors.Is(err, errReturnEarly) {
+				// Waiting for the model to be loaded into the cache.
+				setDownloadingCondition(model, true)
 				return cacheRes, nil
 			}
 			return cacheRes, fmt.Errorf("reconciling cache: %w", err)
 		}
+		setDownloadingCondition(model, false)
 		if !res.IsZero() {
 			return cacheRes, nil
 		}
 	}
 
+	if err := r.resolveDraftModel(ctx, model, &modelConfig); err != nil {
+		if errors.Is(err, errReturnEarly) {
+			// Reconciled again when the draft Model changes.
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("resolving draft model: %w", err)
+	}
+
+	if err := r.reconcileDisruptionBudget(ctx, model); err != nil {
+		return ctrl.Result{}, fmt.Errorf("reconciling disruption budget: %w", err)
+	}
+
+	weightsCheck := r.reconcileWeightsRevision(ctx, model, time.Now())
+
 	allPods := &corev1.PodList{}
 	if err := r.List(ctx, allPods, client.InNamespace(model.Namespace), client.MatchingLabels{
 		kubeaiv1.PodModelLabel: model.Name,
 	}); err != nil {
 		return ctrl.Result{}, fmt.Errorf("listing all node pools: %w", err)
 	}
+	// Only the leader Pods of multi-node groups are replicas.
+	workers := splitWorkerPods(allPods)
 
 	// Summarize all pods.
-	var readyPods int32
-	for _, pod := range allPods.Items {
-		if k8sutils.PodIsReady(&pod) {
-			readyPods++
-		}
-	}
-	model.Status.Replicas.All = int32(len(allPods.Items))
-	model.Status.Replicas.Ready = readyPods
+	setReplicaConditions(model, allPods.Items)
+	unschedulable := setWaitingForNodesCondition(model, slices.Concat(allPods.Items, workers))
+	metrics.ModelReplicasUnschedulable.Record(ctx, int64(unschedulable), metric.WithAttributes(metrics.AttrRequestModel.String(model.Name)))
 
 	scaled := false
 	defer func() {
@@ -174,7 +277,21 @@ func (r *ModelReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		}
 	}()
 
-	plan := r.calculatePodPlan(allPods, model, modelConfig)
+	if disrupted := splitDisruptedPods(allPods); len(disrupted) > 0 {
+		log.Info("Replacing disrupted Pods", "count", len(disrupted))
+	}
+	plan, err := r.calculatePodPlan(allPods, model, modelConfig)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("calculating pod plan: %w", err)
+	}
+	applyOnDemandFloor(plan, model, r.Spot)
+	if len(allPods.Items) == 0 && len(plan.toCreate) > 0 {
+		// Scaling from zero: skip waiting for a Node to be provisioned
+		// if warm Pods are available.
+		if err := r.claimWarmPods(ctx, plan.toCreate, modelConfig); err != nil {
+			log.Error(err, "Failed to claim warm pool Pods")
+		}
+	}
 	if plan.containsActions() {
 		var err error
 		scaled, err = plan.execute(ctx, r.Client, r.Scheme)
@@ -183,6 +300,23 @@ func (r *ModelReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		}
 	}
 
+	if groupPlan := r.calculateGroupPlan(model, plan.toRemain, workers); groupPlan.containsActions() {
+		groupScaled, err := groupPlan.execute(ctx, r.Client, r.Scheme)
+		scaled = scaled || groupScaled
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("executing group plan: %w", err)
+		}
+	}
+
+	if err := r.reconcileCapabilities(ctx, model, allPods.Items); err != nil {
+		// Requests are only validated against discovered capabilities,
+		// retry later instead of blocking the rest of the reconcile.
+		log.Error(err, "Failed to discover model capabilities")
+		if plan.requeueAfter == 0 || plan.requeueAfter > capabilitiesRetryInterval {
+			plan.requeueAfter = capabilitiesRetryInterval
+		}
+	}
+
 	if err := r.reconcileAdapters(ctx, plan.toRemain, model.Spec.Adapters); err != nil {
 		if errors.Is(err, errReturnEarly) {
 			return ctrl.Result{}, nil
@@ -190,7 +324,10 @@ func (r *ModelReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res
 		return ctrl.Result{}, fmt.Errorf("reconciling adapters: %w", err)
 	}
 
-	return ctrl.Result{}, nil
+	if weightsCheck > 0 && (plan.requeueAfter == 0 || weightsCheck < plan.requeueAfter) {
+		plan.requeueAfter = weightsCheck
+	}
+	return ctrl.Result{RequeueAfter: plan.requeueAfter}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -198,9 +335,12 @@ func (r *ModelReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// TODO: Set Model concurrency. Pod rollouts can be slow.
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubeaiv1.Model{}).
+		Watches(&kubeaiv1.Model{}, handler.EnqueueRequestsFromMapFunc(r.modelsWithDraftModel)).
+		Watches(&kubeaiv1.Model{}, handler.EnqueueRequestsFromMapFunc(modelnamespaces.SameNameRequests(r.ModelNamespaces))).
 		Owns(&corev1.Pod{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&batchv1.Job{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
 		Complete(r)
 }
 
@@ -210,6 +350,16 @@ const (
 	appKubernetesIOName = "app.kubernetes.io/name"
 )
 
+// modelArgs returns the Model's Args followed by the Args of its active
+// vertical scaling step.
+func modelArgs(m *kubeaiv1.Model) []string {
+	step := m.Spec.ActiveVerticalScalingStep()
+	if step == nil || len(step.Args) == 0 {
+		return m.Spec.Args
+	}
+	return slices.Concat(m.Spec.Args, step.Args)
+}
+
 func labelsForModel(m *kubeaiv1.Model) map[string]string {
 	engineLowerCase := strings.ToLower(m.Spec.Engine)
 	return map[string]string{
@@ -246,8 +396,15 @@ func (r *ModelReconciler) annotationsForModel(m *kubeaiv1.Model) map[string]stri
 type ModelConfig struct {
 	config.CacheProfile
 	config.ResourceProfile
-	Image  string
-	Source modelSource
+	// ResourceProfileName and ResourceProfileMultiple are parsed
+	// from the Model's resource profile ("<name>:<multiple>").
+	ResourceProfileName     string
+	ResourceProfileMultiple int32
+	Image                   string
+	Source                  modelSource
+	// DraftModel is the resolved draft Model of a Model with SpecDecoding.
+	DraftModel  *kubeaiv1.Model
+	DraftSource modelSource
 }
 
 func (r *ModelReconciler) getModelConfig(model *kubeaiv1.Model) (ModelConfig, error) {
@@ -267,47 +424,60 @@ func (r *ModelReconciler) getModelConfig(model *kubeaiv1.Model) (ModelConfig, er
 		result.CacheProfile = cacheProfile
 	}
 
-	split := strings.Split(model.Spec.ResourceProfile, ":")
+	if err := r.applyResourceProfile(&result, model.Spec.ResourceProfile); err != nil {
+		return result, err
+	}
+
+	image, err := r.lookupServerImage(model, result.ResourceProfile)
+	if err != nil {
+		return result, fmt.Errorf("looking up server image: %w", err)
+	}
+	result.Image = image
+
+	return result, nil
+}
+
+// applyResourceProfile sets the resource profile of the config from the
+// resource profile of a Model ("<name>:<multiple>").
+func (r *ModelReconciler) applyResourceProfile(c *ModelConfig, resourceProfile string) error {
+	split := strings.Split(resourceProfile, ":")
 	if len(split) != 2 {
-		return result, fmt.Errorf("invalid resource profile: %q, should match <name>:<multiple>, example: nvidia-gpu-l4:2", model.Spec.ResourceProfile)
+		return fmt.Errorf("invalid resource profile: %q, should match <name>:<multiple>, example: nvidia-gpu-l4:2", resourceProfile)
 	}
 	name := split[0]
 	multiple, err := strconv.Atoi(split[1])
 	if err != nil {
-		return result, fmt.Errorf("invalid multiple in resource profile multiple: %q: %w", split[1], err)
+		return fmt.Errorf("invalid multiple in resource profile multiple: %q: %w", split[1], err)
 	}
 
 	profile, ok := r.ResourceProfiles[name]
 	if !ok {
-		return result, fmt.Errorf("resource profile not found: %q", name)
-	}
-
-	requests := make(corev1.ResourceList)
-	for key, quantity := range profile.Requests {
-		q := quantity.DeepCopy()
-		q.Mul(int64(multiple))
-		requests[key] = q
-	}
-
-	limits := make(corev1.ResourceList)
-	for key, quantity := range profile.Limits {
-		q := quantity.DeepCopy()
-		q.Mul(int64(multiple))
-		limits[key] = q
+		return fmt.Errorf("resource profile not found: %q", name)
 	}
+	profile = applyGPUSharing(profile)
 
-	result.ResourceProfile = profile
+	c.ResourceProfile = profile
+	c.ResourceProfileName = name
+	c.ResourceProfileMultiple = int32(multiple)
 	// Apply the multiplied requests and limits to the profile.
-	result.Requests = requests
-	result.Limits = limits
+	c.Requests = multiplyResources(profile.Requests, int32(multiple))
+	c.Limits = multiplyResources(profile.Limits, int32(multiple))
+	return nil
+}
 
-	image, err := r.lookupServerImage(model, profile)
-	if err != nil {
-		return result, fmt.Errorf("looking up server image: %w", err)
-	}
-	result.Image = image
+const defaultImageName = "default"
 
-	return result, nil
+// profileImageName returns the name of the server image of a resource profile.
+// If no image name is provided for a profile, the image of its accelerator
+// (i.e. "amd-gpu") or else the default image is used.
+func profileImageName(profile config.ResourceProfile) string {
+	if profile.ImageName != "" {
+		return profile.ImageName
+	}
+	if a := profileAccelerator(profile); a != "" {
+		return string(a)
+	}
+	return defaultImageName
 }
 
 func (r *ModelReconciler) lookupServerImage(model *kubeaiv1.Model, profile config.ResourceProfile) (string, error) {
@@ -315,26 +485,13 @@ func (r *ModelReconciler) lookupServerImage(model *kubeaiv1.Model, profile confi
 		return model.Spec.Image, nil
 	}
 
-	var serverImgs map[string]string
-	switch model.Spec.Engine {
-	case kubeaiv1.OLlamaEngine:
-		serverImgs = r.ModelServers.OLlama.Images
-	case kubeaiv1.FasterWhisperEngine:
-		serverImgs = r.ModelServers.FasterWhisper.Images
-	case kubeaiv1.InfinityEngine:
-		serverImgs = r.ModelServers.Infinity.Images
-	default:
-		serverImgs = r.ModelServers.VLLM.Images
-	}
-
-	// If no image name is provided for a profile, use the default image name.
-	const defaultImageName = "default"
-	imageName := defaultImageName
-	if profile.ImageName != "" {
-		imageName = profile.ImageName
+	eng, err := lookupEngine(model.Spec.Engine)
+	if err != nil {
+		return "", err
 	}
+	serverImgs := eng.images(r.ModelServers)
 
-	if img, ok := serverImgs[imageName]; ok {
+	if img, ok := serverImgs[profileImageName(profile)]; ok {
 		return img, nil
 	}
 
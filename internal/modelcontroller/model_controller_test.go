@@ -89,7 +89,9 @@ func Test_getModelConfig(t *testing.T) {
 				},
 			},
 			expected: ModelConfig{
-				Image: "default-vllm-image",
+				Image:                   "default-vllm-image",
+				ResourceProfileName:     "my-gpu",
+				ResourceProfileMultiple: 2,
 				ResourceProfile: config.ResourceProfile{
 					Limits: corev1.ResourceList{
 						"nvidia.com/gpu": resource.MustParse("2"),
@@ -146,3 +148,22 @@ func requireEqualJSON(t *testing.T, a, b interface{}) {
 	require.NoError(t, err)
 	require.JSONEq(t, string(jsonA), string(jsonB))
 }
+
+func Test_modelArgs(t *testing.T) {
+	model := &v1.Model{Spec: v1.ModelSpec{
+		ResourceProfile: "nvidia-gpu-l4:2",
+		Args:            []string{"--max-model-len=8192"},
+	}}
+	require.Equal(t, []string{"--max-model-len=8192"}, modelArgs(model))
+
+	model.Spec.VerticalScaling = &v1.VerticalScaling{
+		Steps: []v1.VerticalScalingStep{
+			{ResourceProfile: "nvidia-gpu-l4:1"},
+			{ResourceProfile: "nvidia-gpu-l4:2", Args: []string{"--tensor-parallel-size=2"}},
+		},
+	}
+	require.Equal(t, []string{"--max-model-len=8192", "--tensor-parallel-size=2"}, modelArgs(model))
+
+	model.Spec.ResourceProfile = "nvidia-gpu-l4:1"
+	require.Equal(t, []string{"--max-model-len=8192"}, modelArgs(model))
+}
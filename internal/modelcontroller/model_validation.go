@@ -0,0 +1,305 @@
+package modelcontroller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// engineArgs describe the command line flags of a model server that Models
+// set in their args.
+type engineArgs struct {
+	// known flags of the model server. Other flags only result in a
+	// warning, the model server image might be newer than the list.
+	known []string
+	// aliases of known flags (i.e. "-tp" for "--tensor-parallel-size").
+	aliases map[string]string
+	// abbreviations are accepted by the model server: unambiguous prefixes
+	// of known flags, like in Python's argparse.
+	abbreviations bool
+	// managed flags are set by KubeAI and can not be set in Model args.
+	managed []string
+	// parallelism flags multiply to the number of accelerator devices that
+	// a replica uses (i.e. the tensor parallel size).
+	parallelism []string
+	// accelerator returns the args that KubeAI adds for the accelerator of
+	// the resource profile (unless they are in args). Optional.
+	accelerator func(c ModelConfig, args []string) []string
+}
+
+func (r *ModelReconciler) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&kubeaiv1.Model{}).
+		WithValidator(&modelValidator{r: r}).
+		Complete()
+}
+
+// modelValidator rejects Models with args that KubeAI sets or that do not
+// fit their resource profile when they are applied, instead of leaving their
+// Pods crash looping. Args that the engine does not know result in warnings.
+type modelValidator struct {
+	r *ModelReconciler
+}
+
+func (v *modelValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return v.validate(obj.(*kubeaiv1.Model))
+}
+
+func (v *modelValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, m := oldObj.(*kubeaiv1.Model), newObj.(*kubeaiv1.Model)
+	// Updates that do not change the validated fields are admitted, so that
+	// Models that were admitted before the system config changed can still
+	// be updated (i.e. scaled or labeled by KubeAI).
+	if reflect.DeepEqual(validatedSpec(old), validatedSpec(m)) {
+		return nil, nil
+	}
+	return v.validate(m)
+}
+
+func (v *modelValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validatedSpec returns the fields of the Model's spec that are validated.
+func validatedSpec(m *kubeaiv1.Model) kubeaiv1.ModelSpec {
+	spec := kubeaiv1.ModelSpec{
+		Engine:          m.Spec.Engine,
+		Image:           m.Spec.Image,
+		Args:            m.Spec.Args,
+		ResourceProfile: m.Spec.ResourceProfile,
+		MultiNode:       m.Spec.MultiNode,
+		VerticalScaling: m.Spec.VerticalScaling,
+	}
+	if spec.VerticalScaling != nil {
+		// The autoscaler switches between the (validated) steps.
+		spec.ResourceProfile = ""
+	}
+	return spec
+}
+
+func (v *modelValidator) validate(m *kubeaiv1.Model) (admission.Warnings, error) {
+	eng, err := lookupEngine(m.Spec.Engine)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		specPath = field.NewPath("spec")
+		warnings admission.Warnings
+		errs     field.ErrorList
+	)
+	add := func(w admission.Warnings, e field.ErrorList) {
+		warnings = append(warnings, w...)
+		errs = append(errs, e...)
+	}
+
+	add(v.validateArgs(m, eng.args, m.Spec.Args, specPath.Child("args")))
+	if m.Spec.ResourceProfile != "" && m.Spec.VerticalScaling == nil {
+		add(v.validateResourceProfile(m, eng.args, m.Spec.ResourceProfile, m.Spec.Args,
+			specPath.Child("resourceProfile"), specPath.Child("args")))
+	}
+	if vs := m.Spec.VerticalScaling; vs != nil {
+		for i, step := range vs.Steps {
+			stepPath := specPath.Child("verticalScaling", "steps").Index(i)
+			add(v.validateArgs(m, eng.args, step.Args, stepPath.Child("args")))
+			add(v.validateResourceProfile(m, eng.args, step.ResourceProfile, slices.Concat(m.Spec.Args, step.Args),
+				stepPath.Child("resourceProfile"), stepPath.Child("args")))
+		}
+	}
+
+	if len(errs) > 0 {
+		return warnings, apierrors.NewInvalid(kubeaiv1.GroupVersion.WithKind("Model").GroupKind(), m.Name, errs)
+	}
+	return warnings, nil
+}
+
+// validateArgs checks that the args do not contain flags that are managed
+// by KubeAI. Unknown flags result in warnings.
+func (v *modelValidator) validateArgs(m *kubeaiv1.Model, ea *engineArgs, args []string, path *field.Path) (admission.Warnings, field.ErrorList) {
+	if ea == nil {
+		return nil, nil
+	}
+	var (
+		warnings admission.Warnings
+		errs     field.ErrorList
+	)
+	for _, f := range parseFlags(args) {
+		name, known := ea.lookup(f.name)
+		switch {
+		case slices.Contains(ea.managed, name):
+			errs = append(errs, field.Forbidden(path.Index(f.index), fmt.Sprintf("%s is set by KubeAI", f.name)))
+		case !known:
+			msg := fmt.Sprintf("%s: unknown flag %s of the %s engine", path.Index(f.index), f.name, m.Spec.Engine)
+			if s := closestFlag(name, ea.known); s != "" {
+				msg += fmt.Sprintf(", did you mean %s?", s)
+			}
+			warnings = append(warnings, msg)
+		}
+	}
+	return warnings, errs
+}
+
+// validateResourceProfile checks that the resource profile exists and that
+// the parallelism in the args matches its accelerator devices.
+func (v *modelValidator) validateResourceProfile(m *kubeaiv1.Model, ea *engineArgs, resourceProfile string, args []string, profilePath, argsPath *field.Path) (admission.Warnings, field.ErrorList) {
+	var c ModelConfig
+	if err := v.r.applyResourceProfile(&c, resourceProfile); err != nil {
+		msg := err.Error()
+		var names []string
+		for name := range v.r.ResourceProfiles {
+			names = append(names, name)
+		}
+		if len(names) > 0 {
+			sort.Strings(names)
+			msg += fmt.Sprintf(" (available: %s)", strings.Join(names, ", "))
+		}
+		return nil, field.ErrorList{field.Invalid(profilePath, resourceProfile, msg)}
+	}
+	if ea == nil || len(ea.parallelism) == 0 {
+		return nil, nil
+	}
+	devices, ok := acceleratorDevices(c)
+	if !ok {
+		return nil, nil
+	}
+	if m.Spec.MultiNode != nil {
+		devices *= int64(m.Spec.MultiNode.Size)
+	}
+	if ea.accelerator != nil {
+		args = slices.Concat(args, ea.accelerator(c, args))
+	}
+
+	var (
+		size  = int64(1)
+		flags = parseFlags(args)
+		value []string
+	)
+	for _, name := range ea.parallelism {
+		for _, f := range flags {
+			if canonical, _ := ea.lookup(f.name); canonical != name {
+				continue
+			}
+			n, err := strconv.ParseInt(f.value, 10, 64)
+			if err != nil || n < 1 {
+				return nil, field.ErrorList{field.Invalid(argsPath, args[f.index], fmt.Sprintf("%s must be a positive integer", name))}
+			}
+			size *= n
+			value = append(value, fmt.Sprintf("%s=%d", name, n))
+		}
+	}
+
+	noun := acceleratorDeviceNames[profileAccelerator(c.ResourceProfile)]
+	switch {
+	case size > devices:
+		return nil, field.ErrorList{field.Invalid(argsPath, strings.Join(value, " "), fmt.Sprintf(
+			"%s requires %d %s per replica but resource profile %q provides %d, increase the multiple of the resource profile or decrease the parallelism",
+			strings.Join(ea.parallelism, " × "), size, noun, resourceProfile, devices))}
+	case size < devices:
+		return admission.Warnings{fmt.Sprintf(
+			"%s: only %d of the %d %s of resource profile %q are used per replica (%s)",
+			argsPath, size, devices, noun, resourceProfile, strings.Join(ea.parallelism, " × "))}, nil
+	}
+	return nil, nil
+}
+
+// lookup returns the known flag that a flag name refers to, which is either
+// the flag itself, an alias or an abbreviation. If the flag is unknown (or
+// an ambiguous abbreviation), the name is returned with false.
+func (ea *engineArgs) lookup(name string) (string, bool) {
+	if canonical, ok := ea.aliases[name]; ok {
+		return canonical, true
+	}
+	if slices.Contains(ea.known, name) {
+		return name, true
+	}
+	if !ea.abbreviations || !strings.HasPrefix(name, "--") {
+		return name, false
+	}
+	var match string
+	for _, k := range ea.known {
+		if !strings.HasPrefix(k, name) {
+			continue
+		}
+		if match != "" {
+			return name, false
+		}
+		match = k
+	}
+	if match == "" {
+		return name, false
+	}
+	return match, true
+}
+
+// parsedFlag is a flag in the args of a Model.
+type parsedFlag struct {
+	// index of the arg of the flag.
+	index int
+	name  string
+	value string
+}
+
+// parseFlags returns the flags in args. Values are either part of the flag
+// ("--flag=value") or the next arg ("--flag value").
+func parseFlags(args []string) []parsedFlag {
+	var flags []parsedFlag
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		f := parsedFlag{index: i, name: args[i]}
+		if name, value, ok := strings.Cut(args[i], "="); ok {
+			f.name, f.value = name, value
+		} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			f.value = args[i+1]
+			i++
+		}
+		flags = append(flags, f)
+	}
+	return flags
+}
+
+// closestFlag returns the known flag that is closest to the name (i.e. for
+// typos), or "" if no flag is close.
+func closestFlag(name string, known []string) string {
+	const maxDistance = 3
+	closest, closestDistance := "", maxDistance+1
+	for _, k := range known {
+		if d := editDistance(name, k); d < closestDistance {
+			closest, closestDistance = k, d
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
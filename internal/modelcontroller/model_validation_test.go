@@ -0,0 +1,136 @@
+package modelcontroller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_modelValidator(t *testing.T) {
+	v := &modelValidator{r: &ModelReconciler{ResourceProfiles: map[string]config.ResourceProfile{
+		"cpu":           {},
+		"nvidia-gpu-l4": {Limits: corev1.ResourceList{nvidiaGPUResource: resource.MustParse("1")}},
+		"google-tpu-v5e-2x2": {Limits: corev1.ResourceList{
+			googleTPUResource: resource.MustParse("4"),
+		}},
+	}}}
+	model := func(spec v1.ModelSpec) *v1.Model {
+		if spec.Engine == "" {
+			spec.Engine = v1.VLLMEngine
+		}
+		return &v1.Model{ObjectMeta: metav1.ObjectMeta{Name: "my-model"}, Spec: spec}
+	}
+
+	cases := []struct {
+		name         string
+		spec         v1.ModelSpec
+		wantErr      string
+		wantWarnings int
+	}{
+		{
+			name: "valid",
+			spec: v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:2", Args: []string{"--max-model-len=8192", "--tensor-parallel-size", "2"}},
+		},
+		{
+			name:         "unknown flag",
+			spec:         v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:1", Args: []string{"--max-model-length=8192"}},
+			wantWarnings: 1,
+		},
+		{
+			name: "abbreviated flag",
+			spec: v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:2", Args: []string{"--max-num-batched-token=8192", "--tensor-parallel=2"}},
+		},
+		{
+			name:         "ambiguous abbreviation",
+			spec:         v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:1", Args: []string{"--max-num"}},
+			wantWarnings: 1,
+		},
+		{
+			name:    "abbreviated managed flag",
+			spec:    v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:1", Args: []string{"--served-model=other"}},
+			wantErr: "spec.args[0]: Forbidden: --served-model is set by KubeAI",
+		},
+		{
+			name:    "managed flag",
+			spec:    v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:1", Args: []string{"--model=other"}},
+			wantErr: "spec.args[0]: Forbidden: --model is set by KubeAI",
+		},
+		{
+			name:    "too many gpus",
+			spec:    v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:2", Args: []string{"-tp", "2", "--pipeline-parallel-size=2"}},
+			wantErr: `--tensor-parallel-size × --pipeline-parallel-size requires 4 GPUs per replica but resource profile "nvidia-gpu-l4:2" provides 2`,
+		},
+		{
+			name:         "unused gpus",
+			spec:         v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:2"},
+			wantWarnings: 1,
+		},
+		{
+			name: "multi-node",
+			spec: v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:2", MultiNode: &v1.MultiNode{Size: 2}, Args: []string{"--tensor-parallel-size=4"}},
+		},
+		{
+			name: "tpu chips used by default",
+			spec: v1.ModelSpec{ResourceProfile: "google-tpu-v5e-2x2:1"},
+		},
+		{
+			name: "cpu",
+			spec: v1.ModelSpec{ResourceProfile: "cpu:1", Args: []string{"--tensor-parallel-size=2"}},
+		},
+		{
+			name:    "resource profile not found",
+			spec:    v1.ModelSpec{ResourceProfile: "nvidia-gpu-h100:1"},
+			wantErr: `spec.resourceProfile: Invalid value: "nvidia-gpu-h100:1": resource profile not found: "nvidia-gpu-h100" (available: cpu, google-tpu-v5e-2x2, nvidia-gpu-l4)`,
+		},
+		{
+			name: "vertical scaling step",
+			spec: v1.ModelSpec{ResourceProfile: "nvidia-gpu-l4:1", VerticalScaling: &v1.VerticalScaling{Steps: []v1.VerticalScalingStep{
+				{ResourceProfile: "nvidia-gpu-l4:1"},
+				{ResourceProfile: "nvidia-gpu-l4:2", Args: []string{"--tensor-parallel-size=4"}},
+			}}},
+			wantErr: "spec.verticalScaling.steps[1].args",
+		},
+		{
+			name: "engine without args",
+			spec: v1.ModelSpec{Engine: v1.OLlamaEngine, ResourceProfile: "cpu:1", Args: []string{"--anything"}},
+		},
+		{
+			name:         "no infinity abbreviations",
+			spec:         v1.ModelSpec{Engine: v1.InfinityEngine, ResourceProfile: "cpu:1", Args: []string{"--batch", "32"}},
+			wantWarnings: 1,
+		},
+		{
+			name:    "infinity managed flag",
+			spec:    v1.ModelSpec{Engine: v1.InfinityEngine, ResourceProfile: "cpu:1", Args: []string{"--model-id", "other"}},
+			wantErr: "--model-id is set by KubeAI",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			warnings, err := v.ValidateCreate(context.Background(), model(c.spec))
+			if c.wantErr != "" {
+				require.ErrorContains(t, err, c.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Len(t, warnings, c.wantWarnings)
+		})
+	}
+
+	// Updates that do not change the validated fields are not validated.
+	invalid := model(v1.ModelSpec{ResourceProfile: "removed:1"})
+	updated := invalid.DeepCopy()
+	updated.Spec.Replicas = new(int32)
+	_, err := v.ValidateUpdate(context.Background(), invalid, updated)
+	require.NoError(t, err)
+	updated.Spec.Args = []string{"--enforce-eager"}
+	_, err = v.ValidateUpdate(context.Background(), invalid, updated)
+	require.ErrorContains(t, err, "resource profile not found")
+}
@@ -0,0 +1,190 @@
+package modelcontroller
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// multiNodeLeaderScript starts the head of the Ray cluster of a group, waits
+// until all Pods of the group ($0) joined the cluster and then runs the
+// model server (the remaining arguments).
+const multiNodeLeaderScript = `ray start --head --port=6379 --disable-usage-stats
+python3 - "$0" <<'EOF'
+import sys, time, ray
+ray.init(address="auto")
+while sum(1 for n in ray.nodes() if n["Alive"]) < int(sys.argv[1]):
+    time.sleep(5)
+EOF
+exec "$@"`
+
+// multiNodeWorkerScript joins the Ray cluster of the leader Pod of a group.
+const multiNodeWorkerScript = `exec ray start --address="$KUBEAI_LEADER_ADDRESS:6379" --block --disable-usage-stats`
+
+// patchMultiNodeLeader makes a vLLM Pod the leader Pod of a group of a
+// multi-node Model: the Pod runs the head of a Ray cluster, which the
+// worker Pods of its group join, and vLLM distributes the model across it.
+func patchMultiNodeLeader(pod *corev1.Pod, mn *kubeaiv1.MultiNode) {
+	pod.Labels[kubeaiv1.PodRoleLabel] = kubeaiv1.PodRoleLeader
+	for i := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[i]
+		if c.Name != serverContainerName {
+			continue
+		}
+		c.Command = append([]string{"sh", "-c", multiNodeLeaderScript, strconv.Itoa(int(mn.Size))}, c.Command...)
+		c.Args = append(c.Args, "--distributed-executor-backend=ray")
+	}
+}
+
+// splitWorkerPods removes the worker Pods of multi-node groups from the list
+// of Pods and returns them. The remaining (leader) Pods are the replicas of
+// the Model.
+func splitWorkerPods(pods *corev1.PodList) []corev1.Pod {
+	var leaders, workers []corev1.Pod
+	for _, p := range pods.Items {
+		if k8sutils.GetLabel(&p, kubeaiv1.PodRoleLabel) == kubeaiv1.PodRoleWorker {
+			workers = append(workers, p)
+		} else {
+			leaders = append(leaders, p)
+		}
+	}
+	pods.Items = leaders
+	return workers
+}
+
+// calculateGroupPlan calculates the plan to create the missing worker Pods
+// of the groups of the given leader Pods and to delete the worker Pods of
+// groups whose leader Pod is gone. Worker Pods are created once the leader
+// Pod has an IP. A group is replaced as a whole if one of its worker Pods
+// failed or was deleted after the group was ready, as the model server can
+// not recover from losing a part of the model.
+func (r *ModelReconciler) calculateGroupPlan(model *kubeaiv1.Model, leaders []*corev1.Pod, workers []corev1.Pod) *podPlan {
+	plan := &podPlan{
+		model:       model,
+		gracePeriod: r.ModelServerPods.TerminationGracePeriod.Duration,
+	}
+
+	byGroup := map[string][]*corev1.Pod{}
+	for i := range workers {
+		w := &workers[i]
+		group := k8sutils.GetLabel(w, kubeaiv1.PodGroupLabel)
+		byGroup[group] = append(byGroup[group], w)
+	}
+
+	for _, leader := range leaders {
+		group := byGroup[leader.Name]
+		delete(byGroup, leader.Name)
+		if leader.DeletionTimestamp != nil || model.Spec.MultiNode == nil {
+			// Out-of-date groups keep their workers until the
+			// leader Pod is deleted.
+			continue
+		}
+
+		// Names of failed or terminating worker Pods are only reused
+		// after the Pods are gone.
+		taken := map[string]bool{}
+		var healthy int
+		var failed []*corev1.Pod
+		for _, w := range group {
+			taken[w.Name] = true
+			if w.DeletionTimestamp != nil {
+				continue
+			}
+			if w.Status.Phase == corev1.PodFailed {
+				failed = append(failed, w)
+				continue
+			}
+			healthy++
+		}
+		size := int(model.Spec.MultiNode.Size)
+		if k8sutils.PodIsReady(leader) && healthy < size-1 {
+			plan.details = append(plan.details, fmt.Sprintf("Replacing group of Pod %q with %d of %d Pods", leader.Name, healthy+1, size))
+			plan.toDelete = append(plan.toDelete, leader)
+			for _, w := range group {
+				if w.DeletionTimestamp == nil {
+					plan.toDelete = append(plan.toDelete, w)
+				}
+			}
+			continue
+		}
+		for _, w := range failed {
+			plan.details = append(plan.details, fmt.Sprintf("Deleting failed worker Pod %q", w.Name))
+			plan.toDelete = append(plan.toDelete, w)
+		}
+		if leader.Status.PodIP == "" {
+			continue
+		}
+		var created int
+		for i := 1; i < size; i++ {
+			worker := workerPodForLeader(leader, i)
+			if taken[worker.Name] {
+				continue
+			}
+			plan.toCreate = append(plan.toCreate, worker)
+			created++
+		}
+		if created > 0 {
+			plan.details = append(plan.details, fmt.Sprintf("Creating %d worker Pods for Pod %q", created, leader.Name))
+		}
+	}
+
+	for leader, group := range byGroup {
+		for _, w := range group {
+			if w.DeletionTimestamp == nil {
+				plan.details = append(plan.details, fmt.Sprintf("Deleting worker Pod %q of deleted Pod %q", w.Name, leader))
+				plan.toDelete = append(plan.toDelete, w)
+			}
+		}
+	}
+
+	return plan
+}
+
+// workerPodForLeader returns the worker Pod with the given index of the group
+// of a leader Pod. Worker Pods run on the same kind of Node as the leader
+// Pod and only join its Ray cluster.
+func workerPodForLeader(leader *corev1.Pod, index int) *corev1.Pod {
+	labels := maps.Clone(leader.Labels)
+	for k := range labels {
+		if strings.HasPrefix(k, kubeaiv1.PodAdapterLabelPrefix) {
+			delete(labels, k)
+		}
+	}
+	labels[kubeaiv1.PodRoleLabel] = kubeaiv1.PodRoleWorker
+	labels[kubeaiv1.PodGroupLabel] = leader.Name
+
+	spec := leader.Spec.DeepCopy()
+	spec.NodeName = ""
+	var containers []corev1.Container
+	for _, c := range spec.Containers {
+		if c.Name != serverContainerName {
+			// Sidecars (i.e. the adapter loader) are only needed
+			// next to the model server.
+			continue
+		}
+		c.Command = []string{"sh", "-c", multiNodeWorkerScript}
+		c.Args = nil
+		c.Env = append(c.Env, corev1.EnvVar{Name: "KUBEAI_LEADER_ADDRESS", Value: leader.Status.PodIP})
+		c.Ports = nil
+		c.StartupProbe = nil
+		c.ReadinessProbe = nil
+		c.LivenessProbe = nil
+		containers = append(containers, c)
+	}
+	spec.Containers = containers
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-worker-%d", leader.Name, index),
+			Namespace: leader.Namespace,
+			Labels:    labels,
+		},
+		Spec: *spec,
+	}
+}
@@ -0,0 +1,166 @@
+package modelcontroller
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_calculateGroupPlan(t *testing.T) {
+	r := &ModelReconciler{}
+	now := metav1.NewTime(time.Now())
+
+	leader := func(name, ip string, ready bool) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{v1.PodModelLabel: "test-mdl", v1.PodRoleLabel: v1.PodRoleLeader},
+			},
+			Spec: corev1.PodSpec{
+				NodeName:   "node-1",
+				Containers: []corev1.Container{{Name: serverContainerName}, {Name: loaderContainerName}},
+			},
+			Status: corev1.PodStatus{PodIP: ip},
+		}
+		if ready {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+		return p
+	}
+	worker := func(name, group string, phase corev1.PodPhase, deleted bool) corev1.Pod {
+		p := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{v1.PodRoleLabel: v1.PodRoleWorker, v1.PodGroupLabel: group},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+		if deleted {
+			p.DeletionTimestamp = &now
+		}
+		return p
+	}
+
+	cases := []struct {
+		name          string
+		multiNode     *v1.MultiNode
+		leaders       []*corev1.Pod
+		workers       []corev1.Pod
+		wantCreations []string
+		wantDeletions []string
+	}{
+		{
+			name:      "wait for leader IP",
+			multiNode: &v1.MultiNode{Size: 3},
+			leaders:   []*corev1.Pod{leader("l1", "", false)},
+		},
+		{
+			name:          "create workers",
+			multiNode:     &v1.MultiNode{Size: 3},
+			leaders:       []*corev1.Pod{leader("l1", "10.0.0.1", false)},
+			workers:       []corev1.Pod{worker("l1-worker-1", "l1", corev1.PodRunning, false)},
+			wantCreations: []string{"l1-worker-2"},
+		},
+		{
+			name:          "replace failed worker of starting group",
+			multiNode:     &v1.MultiNode{Size: 3},
+			leaders:       []*corev1.Pod{leader("l1", "10.0.0.1", false)},
+			workers:       []corev1.Pod{worker("l1-worker-1", "l1", corev1.PodFailed, false)},
+			wantCreations: []string{"l1-worker-2"},
+			wantDeletions: []string{"l1-worker-1"},
+		},
+		{
+			name:      "ready group",
+			multiNode: &v1.MultiNode{Size: 3},
+			leaders:   []*corev1.Pod{leader("l1", "10.0.0.1", true)},
+			workers: []corev1.Pod{
+				worker("l1-worker-1", "l1", corev1.PodRunning, false),
+				worker("l1-worker-2", "l1", corev1.PodRunning, false),
+			},
+		},
+		{
+			name:      "replace ready group that lost a worker",
+			multiNode: &v1.MultiNode{Size: 3},
+			leaders:   []*corev1.Pod{leader("l1", "10.0.0.1", true)},
+			workers: []corev1.Pod{
+				worker("l1-worker-1", "l1", corev1.PodRunning, false),
+				worker("l1-worker-2", "l1", corev1.PodRunning, true),
+			},
+			wantDeletions: []string{"l1", "l1-worker-1"},
+		},
+		{
+			name:      "delete workers of deleted leader",
+			multiNode: &v1.MultiNode{Size: 2},
+			workers: []corev1.Pod{
+				worker("l1-worker-1", "l1", corev1.PodRunning, false),
+				worker("l2-worker-1", "l2", corev1.PodRunning, true),
+			},
+			wantDeletions: []string{"l1-worker-1"},
+		},
+		{
+			name:    "multi-node disabled",
+			leaders: []*corev1.Pod{leader("l1", "10.0.0.1", true)},
+			workers: []corev1.Pod{worker("l1-worker-1", "l1", corev1.PodRunning, false)},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			model := &v1.Model{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-mdl"},
+				Spec:       v1.ModelSpec{MultiNode: c.multiNode},
+			}
+			plan := r.calculateGroupPlan(model, c.leaders, c.workers)
+
+			var creations, deletions []string
+			for _, p := range plan.toCreate {
+				creations = append(creations, p.Name)
+			}
+			for _, p := range plan.toDelete {
+				deletions = append(deletions, p.Name)
+			}
+			sort.Strings(deletions)
+			require.Equal(t, c.wantCreations, creations, plan.details)
+			require.Equal(t, c.wantDeletions, deletions, plan.details)
+		})
+	}
+}
+
+func Test_workerPodForLeader(t *testing.T) {
+	r := &ModelReconciler{}
+	model := &v1.Model{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-mdl"},
+		Spec: v1.ModelSpec{
+			Engine:    v1.VLLMEngine,
+			URL:       "hf://some-repo/some-model",
+			MultiNode: &v1.MultiNode{Size: 2},
+		},
+	}
+	leader := r.vLLMPodForModel(model, ModelConfig{Source: modelSource{modelAuthCredentials: &modelAuthCredentials{}, url: modelURL{ref: "some-repo/some-model"}}})
+	leader.Name = "model-test-mdl-abc"
+	leader.Labels[v1.PodAdapterLabelPrefix+"my-adapter"] = "abc"
+	leader.Status.PodIP = "10.0.0.1"
+
+	server := leader.Spec.Containers[0]
+	require.Equal(t, v1.PodRoleLeader, leader.Labels[v1.PodRoleLabel])
+	require.Equal(t, []string{"sh", "-c", multiNodeLeaderScript, "2", "python3", "-m", "vllm.entrypoints.openai.api_server"}, server.Command)
+	require.Contains(t, server.Args, "--distributed-executor-backend=ray")
+
+	worker := workerPodForLeader(leader, 1)
+	require.Equal(t, "model-test-mdl-abc-worker-1", worker.Name)
+	require.Equal(t, "test-mdl", worker.Labels[v1.PodModelLabel])
+	require.Equal(t, v1.PodRoleWorker, worker.Labels[v1.PodRoleLabel])
+	require.Equal(t, "model-test-mdl-abc", worker.Labels[v1.PodGroupLabel])
+	require.NotContains(t, worker.Labels, v1.PodAdapterLabelPrefix+"my-adapter")
+	require.Len(t, worker.Spec.Containers, 1)
+	workerServer := worker.Spec.Containers[0]
+	require.Equal(t, []string{"sh", "-c", multiNodeWorkerScript}, workerServer.Command)
+	require.Nil(t, workerServer.Args)
+	require.Nil(t, workerServer.ReadinessProbe)
+	require.Contains(t, workerServer.Env, corev1.EnvVar{Name: "KUBEAI_LEADER_ADDRESS", Value: "10.0.0.1"})
+}
@@ -0,0 +1,84 @@
+package modelcontroller
+
+import (
+	"fmt"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// applyPlacement spreads or packs the Pods of the Model according to its
+// placement policy.
+func applyPlacement(pod *corev1.Pod, model *kubeaiv1.Model) error {
+	p := model.Spec.Placement
+	if p == nil {
+		return nil
+	}
+
+	topologyKey := p.TopologyKey
+	if topologyKey == "" {
+		if p.Policy == kubeaiv1.SpreadZonesPlacementPolicy {
+			topologyKey = corev1.LabelTopologyZone
+		} else {
+			topologyKey = corev1.LabelHostname
+		}
+	}
+	if p.Policy == kubeaiv1.PackPlacementPolicy && topologyKey == corev1.LabelHostname && model.Spec.MultiNode != nil {
+		return fmt.Errorf("multi-node Models can not be packed onto a single Node (set placement.topologyKey)")
+	}
+
+	// Selects the Pods of the Model across revisions.
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{kubeaiv1.PodModelLabel: model.Name}}
+	term := corev1.PodAffinityTerm{LabelSelector: selector, TopologyKey: topologyKey}
+
+	// The affinity is shared with the resource profile.
+	pod.Spec.Affinity = pod.Spec.Affinity.DeepCopy()
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	switch p.Policy {
+	case kubeaiv1.SpreadZonesPlacementPolicy:
+		maxSkew := p.MaxSkew
+		if maxSkew == 0 {
+			maxSkew = 1
+		}
+		whenUnsatisfiable := corev1.ScheduleAnyway
+		if p.Required {
+			whenUnsatisfiable = corev1.DoNotSchedule
+		}
+		pod.Spec.TopologySpreadConstraints = append(pod.Spec.TopologySpreadConstraints, corev1.TopologySpreadConstraint{
+			MaxSkew:           maxSkew,
+			TopologyKey:       topologyKey,
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     selector,
+		})
+	case kubeaiv1.SpreadNodesPlacementPolicy:
+		if pod.Spec.Affinity.PodAntiAffinity == nil {
+			pod.Spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		}
+		paa := pod.Spec.Affinity.PodAntiAffinity
+		if p.Required {
+			paa.RequiredDuringSchedulingIgnoredDuringExecution = append(paa.RequiredDuringSchedulingIgnoredDuringExecution, term)
+		} else {
+			paa.PreferredDuringSchedulingIgnoredDuringExecution = append(paa.PreferredDuringSchedulingIgnoredDuringExecution,
+				corev1.WeightedPodAffinityTerm{Weight: 100, PodAffinityTerm: term})
+		}
+	case kubeaiv1.PackPlacementPolicy:
+		if pod.Spec.Affinity.PodAffinity == nil {
+			pod.Spec.Affinity.PodAffinity = &corev1.PodAffinity{}
+		}
+		pa := pod.Spec.Affinity.PodAffinity
+		// The first Pod of the Model can be scheduled although it does not
+		// find other Pods to be placed with.
+		if p.Required {
+			pa.RequiredDuringSchedulingIgnoredDuringExecution = append(pa.RequiredDuringSchedulingIgnoredDuringExecution, term)
+		} else {
+			pa.PreferredDuringSchedulingIgnoredDuringExecution = append(pa.PreferredDuringSchedulingIgnoredDuringExecution,
+				corev1.WeightedPodAffinityTerm{Weight: 100, PodAffinityTerm: term})
+		}
+	default:
+		return fmt.Errorf("unknown placement policy: %q", p.Policy)
+	}
+	return nil
+}
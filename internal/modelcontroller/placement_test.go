@@ -0,0 +1,96 @@
+package modelcontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_applyPlacement(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{v1.PodModelLabel: "my-model"}}
+	hostnameTerm := corev1.PodAffinityTerm{LabelSelector: selector, TopologyKey: corev1.LabelHostname}
+
+	cases := []struct {
+		name            string
+		placement       v1.ModelPlacement
+		wantConstraints []corev1.TopologySpreadConstraint
+		wantAffinity    *corev1.Affinity
+	}{
+		{
+			name:      "spread zones",
+			placement: v1.ModelPlacement{Policy: v1.SpreadZonesPlacementPolicy},
+			wantConstraints: []corev1.TopologySpreadConstraint{{
+				MaxSkew:           1,
+				TopologyKey:       corev1.LabelTopologyZone,
+				WhenUnsatisfiable: corev1.ScheduleAnyway,
+				LabelSelector:     selector,
+			}},
+			wantAffinity: &corev1.Affinity{},
+		},
+		{
+			name:      "spread zones required",
+			placement: v1.ModelPlacement{Policy: v1.SpreadZonesPlacementPolicy, MaxSkew: 2, Required: true},
+			wantConstraints: []corev1.TopologySpreadConstraint{{
+				MaxSkew:           2,
+				TopologyKey:       corev1.LabelTopologyZone,
+				WhenUnsatisfiable: corev1.DoNotSchedule,
+				LabelSelector:     selector,
+			}},
+			wantAffinity: &corev1.Affinity{},
+		},
+		{
+			name:      "spread nodes",
+			placement: v1.ModelPlacement{Policy: v1.SpreadNodesPlacementPolicy},
+			wantAffinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: 100, PodAffinityTerm: hostnameTerm}},
+			}},
+		},
+		{
+			name:      "spread nodes required",
+			placement: v1.ModelPlacement{Policy: v1.SpreadNodesPlacementPolicy, Required: true},
+			wantAffinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{hostnameTerm},
+			}},
+		},
+		{
+			name:      "pack",
+			placement: v1.ModelPlacement{Policy: v1.PackPlacementPolicy},
+			wantAffinity: &corev1.Affinity{PodAffinity: &corev1.PodAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: 100, PodAffinityTerm: hostnameTerm}},
+			}},
+		},
+		{
+			name:      "pack required in nvlink domain",
+			placement: v1.ModelPlacement{Policy: v1.PackPlacementPolicy, TopologyKey: "nvidia.com/gpu.clique", Required: true},
+			wantAffinity: &corev1.Affinity{PodAffinity: &corev1.PodAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{LabelSelector: selector, TopologyKey: "nvidia.com/gpu.clique"}},
+			}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pod := &corev1.Pod{}
+			model := &v1.Model{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-model"},
+				Spec:       v1.ModelSpec{Placement: &c.placement},
+			}
+			require.NoError(t, applyPlacement(pod, model))
+			require.Equal(t, c.wantConstraints, pod.Spec.TopologySpreadConstraints)
+			require.Equal(t, c.wantAffinity, pod.Spec.Affinity)
+		})
+	}
+
+	// The affinity of the resource profile is not modified.
+	profileAffinity := &corev1.Affinity{}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Affinity: profileAffinity}}
+	model := &v1.Model{Spec: v1.ModelSpec{Placement: &v1.ModelPlacement{Policy: v1.PackPlacementPolicy}}}
+	require.NoError(t, applyPlacement(pod, model))
+	require.Nil(t, profileAffinity.PodAffinity)
+
+	model.Spec.MultiNode = &v1.MultiNode{Size: 2}
+	require.ErrorContains(t, applyPlacement(&corev1.Pod{}, model), "can not be packed onto a single Node")
+}
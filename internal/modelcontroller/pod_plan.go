@@ -6,6 +6,7 @@ import (
 	"math"
 	"sort"
 	"strings"
+	"time"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
 	"github.com/substratusai/kubeai/internal/k8sutils"
@@ -25,21 +26,32 @@ import (
 // - Adds a surge Pod
 // - Recreates any out-of-date Pod that is not Ready immediately
 // - Waits for all Pods to be Ready before recreating any out-of-date Pods that are Ready
-func (r *ModelReconciler) calculatePodPlan(allPods *corev1.PodList, model *kubeaiv1.Model, modelConfig ModelConfig) *podPlan {
-	var podForModel *corev1.Pod
-	switch model.Spec.Engine {
-	case kubeaiv1.OLlamaEngine:
-		podForModel = r.oLlamaPodForModel(model, modelConfig)
-	case kubeaiv1.FasterWhisperEngine:
-		podForModel = r.fasterWhisperPodForModel(model, modelConfig)
-	case kubeaiv1.InfinityEngine:
-		podForModel = r.infinityPodForModel(model, modelConfig)
-	default:
-		podForModel = r.vLLMPodForModel(model, modelConfig)
+// Models with canary rollouts first go through calculateCanaryPodPlan,
+// Models with blue/green weight updates through calculateBlueGreenPodPlan and
+// Models that switch vertical scaling steps through calculateStepSwitchPodPlan.
+func (r *ModelReconciler) calculatePodPlan(allPods *corev1.PodList, model *kubeaiv1.Model, modelConfig ModelConfig) (*podPlan, error) {
+	eng, err := lookupEngine(model.Spec.Engine)
+	if err != nil {
+		return nil, err
 	}
+	podForModel := eng.podForModel(r, model, modelConfig)
+	applyProfileEnv(podForModel, modelConfig)
+	if err := applyCapacity(podForModel, model, r.Spot); err != nil {
+		return nil, fmt.Errorf("applying capacity: %w", err)
+	}
+	if err := applyPlacement(podForModel, model); err != nil {
+		return nil, fmt.Errorf("applying placement: %w", err)
+	}
+	if err := applyPodTemplate(podForModel, model); err != nil {
+		return nil, fmt.Errorf("applying pod template: %w", err)
+	}
+	applyWeightsRevision(podForModel, model)
 	expectedHash := k8sutils.PodHash(podForModel.Spec)
 	podForModel.GenerateName = fmt.Sprintf("model-%s-%s-", model.Name, expectedHash)
 	k8sutils.SetLabel(podForModel, kubeaiv1.PodHashLabel, expectedHash)
+	if model.Spec.VerticalScaling != nil {
+		k8sutils.SetAnnotation(podForModel, kubeaiv1.PodResourceProfileAnnotation, model.Spec.ResourceProfile)
+	}
 
 	var (
 		readyAll  int
@@ -51,7 +63,25 @@ func (r *ModelReconciler) calculatePodPlan(allPods *corev1.PodList, model *kubea
 		return p.Namespace + "/" + p.Name
 	}
 
-	sortPodsByDeletionOrder(allPods.Items, expectedHash)
+	var inFlight map[string]int64
+	if r.InFlight != nil {
+		inFlight = r.InFlight.InFlightByPod(model.Name)
+	}
+	sortPodsByDeletionOrder(allPods.Items, expectedHash, inFlight)
+
+	if plan, ok := r.calculateBlueGreenPodPlan(allPods.Items, model, podForModel); ok {
+		return plan, nil
+	}
+	if plan, ok := r.calculateStepSwitchPodPlan(allPods.Items, model, podForModel); ok {
+		return plan, nil
+	}
+	surge := r.ModelRollouts.Surge
+	if model.Spec.Rollout != nil {
+		if plan, ok := r.calculateCanaryPodPlan(allPods.Items, model, podForModel, time.Now()); ok {
+			return plan, nil
+		}
+		surge = model.Spec.Rollout.Surge
+	}
 
 	for _, p := range allPods.Items {
 		remainder[podKey(p)] = &p
@@ -83,7 +113,7 @@ func (r *ModelReconciler) calculatePodPlan(allPods *corev1.PodList, model *kubea
 		desiredReplicas = *model.Spec.Replicas
 	}
 	if len(outOfDate) > 0 {
-		desiredReplicas += r.ModelRollouts.Surge
+		desiredReplicas += surge
 	}
 	observedReplicas := int32(len(allPods.Items))
 	replicaDiff := observedReplicas - desiredReplicas
@@ -117,7 +147,7 @@ func (r *ModelReconciler) calculatePodPlan(allPods *corev1.PodList, model *kubea
 			details = append(details, fmt.Sprintf("Out-of-date Pod %q is not ready, immediately recreating", pod.Name))
 			appendToDelete(pod)
 			// Avoid recreating the surge Pod when rollout is complete.
-			if recreated < len(outOfDate)-int(r.ModelRollouts.Surge) {
+			if recreated < len(outOfDate)-int(surge) {
 				toCreate = append(toCreate, podForModel.DeepCopy())
 				recreated++
 			}
@@ -127,7 +157,7 @@ func (r *ModelReconciler) calculatePodPlan(allPods *corev1.PodList, model *kubea
 			details = append(details, fmt.Sprintf("All Pods ready, recreating out-of-date Pod %q", pod.Name))
 			appendToDelete(pod)
 			// Avoid recreating the surge Pod when rollout is complete.
-			if recreated < len(outOfDate)-int(r.ModelRollouts.Surge) {
+			if recreated < len(outOfDate)-int(surge) {
 				toCreate = append(toCreate, podForModel.DeepCopy())
 				recreated++
 			}
@@ -141,12 +171,13 @@ func (r *ModelReconciler) calculatePodPlan(allPods *corev1.PodList, model *kubea
 	}
 
 	return &podPlan{
-		model:    model,
-		toCreate: toCreate,
-		toDelete: toDelete,
-		toRemain: toRemain,
-		details:  details,
-	}
+		model:       model,
+		toCreate:    toCreate,
+		toDelete:    toDelete,
+		toRemain:    toRemain,
+		details:     details,
+		gracePeriod: r.ModelServerPods.TerminationGracePeriod.Duration,
+	}, nil
 }
 
 type podPlan struct {
@@ -155,6 +186,12 @@ type podPlan struct {
 	toDelete []*corev1.Pod
 	toRemain []*corev1.Pod
 	details  []string
+	// gracePeriod is given to Ready Pods that are deleted so that
+	// in-flight requests can complete. Zero means the Pod's default.
+	gracePeriod time.Duration
+	// requeueAfter is the time after which the plan should be recalculated
+	// (i.e. at the end of the analysis of a canary rollout).
+	requeueAfter time.Duration
 }
 
 func (pp *podPlan) containsActions() bool {
@@ -162,7 +199,7 @@ func (pp *podPlan) containsActions() bool {
 }
 
 // execute returns true if a Pod was created or deleted.
-func (pp *podPlan) execute(ctx context.Context, client client.Client, scheme *runtime.Scheme) (bool, error) {
+func (pp *podPlan) execute(ctx context.Context, k8sClient client.Client, scheme *runtime.Scheme) (bool, error) {
 	log := log.FromContext(ctx)
 
 	detailsCSV := strings.Join(pp.details, ", ")
@@ -172,12 +209,19 @@ func (pp *podPlan) execute(ctx context.Context, client client.Client, scheme *ru
 
 	// Delete before create to avoid unnecessary Node scale-ups.
 	for _, pod := range pp.toDelete {
-		if err := client.Delete(ctx, &corev1.Pod{
+		var opts []client.DeleteOption
+		if pp.gracePeriod > 0 && k8sutils.PodIsReady(pod) {
+			// Ready Pods might be serving long-running requests (i.e. streams).
+			// Model servers stop accepting new connections on SIGTERM and
+			// wait for in-flight requests before exiting.
+			opts = append(opts, client.GracePeriodSeconds(int64(pp.gracePeriod.Seconds())))
+		}
+		if err := k8sClient.Delete(ctx, &corev1.Pod{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace: pod.Namespace,
 				Name:      pod.Name,
 			},
-		}); err != nil {
+		}, opts...); err != nil {
 			if apierrors.IsNotFound(err) {
 				log.Info("Pod already deleted", "podName", pod.Name)
 			} else {
@@ -191,7 +235,7 @@ func (pp *podPlan) execute(ctx context.Context, client client.Client, scheme *ru
 		if err := ctrl.SetControllerReference(pp.model, pod, scheme); err != nil {
 			return changed, fmt.Errorf("setting controller reference: %w", err)
 		}
-		if err := client.Create(ctx, pod, k8sutils.DefaultCreateOptions()); err != nil {
+		if err := k8sClient.Create(ctx, pod, k8sutils.DefaultCreateOptions()); err != nil {
 			if apierrors.IsAlreadyExists(err) {
 				log.Info("Pod already exists", "podName", pod.Name)
 			} else {
@@ -205,8 +249,9 @@ func (pp *podPlan) execute(ctx context.Context, client client.Client, scheme *ru
 }
 
 // sortPodsByDeletionOrder ensures Pods that are to be deleted/recreated
-// first are lower index.
-func sortPodsByDeletionOrder(pods []corev1.Pod, expectedHash string) {
+// first are lower index. inFlight is the number of in-flight requests by
+// Pod name (may be nil).
+func sortPodsByDeletionOrder(pods []corev1.Pod, expectedHash string, inFlight map[string]int64) {
 	sort.SliceStable(pods, func(i, j int) bool {
 		// Not ready Pods should be deleted first.
 		iReady := k8sutils.PodIsReady(&pods[i])
@@ -229,6 +274,21 @@ func sortPodsByDeletionOrder(pods []corev1.Pod, expectedHash string) {
 			return iHash != expectedHash
 		}
 
+		// Pods of the on-demand floor should be deleted last.
+		iFloor := isOnDemandFloorPod(&pods[i])
+		jFloor := isOnDemandFloorPod(&pods[j])
+		if iFloor != jFloor {
+			return !iFloor
+		}
+
+		// Pods with fewer in-flight requests (i.e. long-running streams)
+		// should be deleted first.
+		iInFlight := inFlight[pods[i].Name]
+		jInFlight := inFlight[pods[j].Name]
+		if iInFlight != jInFlight {
+			return iInFlight < jInFlight
+		}
+
 		// Younger Pods should be deleted first.
 		iCreationTime := pods[i].CreationTimestamp.Time
 		jCreationTime := pods[j].CreationTimestamp.Time
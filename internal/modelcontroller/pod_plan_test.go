@@ -154,7 +154,8 @@ func Test_calculatePodPlan(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			plan := r.calculatePodPlan(&corev1.PodList{Items: c.pods}, model, modelConfig)
+			plan, err := r.calculatePodPlan(&corev1.PodList{Items: c.pods}, model, modelConfig)
+			require.NoError(t, err)
 			detailsCSV := strings.Join(plan.details, ", ")
 			require.Lenf(t, plan.toCreate, c.wantNCreations, "Unexpected creation count, details: %v", detailsCSV)
 			var deletionNames []string
@@ -169,9 +170,10 @@ func Test_calculatePodPlan(t *testing.T) {
 
 func Test_sortPodsByDeletionOrder(t *testing.T) {
 	cases := []struct {
-		name string
-		pods []corev1.Pod
-		want []string
+		name     string
+		pods     []corev1.Pod
+		inFlight map[string]int64
+		want     []string
 	}{
 		{
 			name: "empty",
@@ -252,6 +254,52 @@ func Test_sortPodsByDeletionOrder(t *testing.T) {
 				"scheduled-pod",
 			},
 		},
+		{
+			name: "on-demand floor comparison",
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              "young-floor-pod",
+						CreationTimestamp: testYoungTS,
+						Labels: map[string]string{
+							v1.PodOnDemandFloorLabel: "true",
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              "old-spot-pod",
+						CreationTimestamp: testOldTS,
+					},
+				},
+			},
+			want: []string{
+				"old-spot-pod",
+				"young-floor-pod",
+			},
+		},
+		{
+			name: "in-flight comparison",
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              "old-idle-pod",
+						CreationTimestamp: testOldTS,
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              "young-streaming-pod",
+						CreationTimestamp: testYoungTS,
+					},
+				},
+			},
+			inFlight: map[string]int64{"young-streaming-pod": 1},
+			want: []string{
+				"old-idle-pod",
+				"young-streaming-pod",
+			},
+		},
 		{
 			name: "creation time comparison",
 			pods: []corev1.Pod{
@@ -305,7 +353,7 @@ func Test_sortPodsByDeletionOrder(t *testing.T) {
 
 				randomizePodOrder(pods)
 
-				sortPodsByDeletionOrder(pods, testNewHash)
+				sortPodsByDeletionOrder(pods, testNewHash, c.inFlight)
 
 				var namesAfter []string
 				for _, p := range pods {
@@ -0,0 +1,41 @@
+package modelcontroller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// applyPodTemplate merges the PodTemplate of a Model into a Pod of the Model
+// as a strategic merge patch. The labels of the Pod are kept, as the
+// controller and the endpoint resolver select Pods by them.
+func applyPodTemplate(pod *corev1.Pod, m *kubeaiv1.Model) error {
+	if m.Spec.PodTemplate == nil || len(m.Spec.PodTemplate.Raw) == 0 {
+		return nil
+	}
+
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return fmt.Errorf("encoding pod: %w", err)
+	}
+	patched, err := strategicpatch.StrategicMergePatch(original, m.Spec.PodTemplate.Raw, corev1.Pod{})
+	if err != nil {
+		return fmt.Errorf("merging pod template: %w", err)
+	}
+	merged := &corev1.Pod{}
+	if err := json.Unmarshal(patched, merged); err != nil {
+		return fmt.Errorf("decoding merged pod: %w", err)
+	}
+
+	if merged.Labels == nil {
+		merged.Labels = map[string]string{}
+	}
+	for k, v := range pod.Labels {
+		merged.Labels[k] = v
+	}
+	*pod = *merged
+	return nil
+}
@@ -0,0 +1,54 @@
+package modelcontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func Test_applyPodTemplate(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{v1.PodModelLabel: "my-model"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  serverContainerName,
+				Image: "vllm",
+				Env:   []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "1"}},
+			}},
+			Volumes: []corev1.Volume{{Name: "dshm"}},
+		},
+	}
+	model := &v1.Model{Spec: v1.ModelSpec{PodTemplate: &runtime.RawExtension{Raw: []byte(`{
+		"metadata": {"labels": {"model": "other", "team": "a"}},
+		"spec": {
+			"priorityClassName": "high",
+			"tolerations": [{"key": "dedicated", "operator": "Exists"}],
+			"initContainers": [{"name": "init", "image": "busybox"}],
+			"containers": [
+				{"name": "server", "env": [{"name": "B", "value": "2"}]},
+				{"name": "sidecar", "image": "proxy"}
+			],
+			"volumes": [{"name": "extra", "emptyDir": {}}]
+		}
+	}`)}}}
+
+	require.NoError(t, applyPodTemplate(pod, model))
+	require.Equal(t, map[string]string{v1.PodModelLabel: "my-model", "team": "a"}, pod.Labels)
+	require.Equal(t, "high", pod.Spec.PriorityClassName)
+	require.Len(t, pod.Spec.Tolerations, 1)
+	require.Len(t, pod.Spec.InitContainers, 1)
+	require.Len(t, pod.Spec.Containers, 2)
+	server := pod.Spec.Containers[0]
+	require.Equal(t, "vllm", server.Image)
+	require.ElementsMatch(t, []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "2"}}, server.Env)
+	require.Len(t, pod.Spec.Volumes, 2)
+
+	model.Spec.PodTemplate = &runtime.RawExtension{Raw: []byte(`{"spec": {"containers": "invalid"}}`)}
+	require.Error(t, applyPodTemplate(pod, model))
+}
@@ -0,0 +1,271 @@
+package modelcontroller
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+)
+
+// calculateCanaryPodPlan calculates the Pod plan of a Model with canary
+// rollouts (see ModelSpec.Rollout) and updates the rollout status.
+// The Pods must be sorted by deletion order.
+//
+// When the Pods are out of date, a rollout starts in the Canary phase: the
+// Pods of the stable revision are kept at the Model's replicas and surge Pods
+// of the new revision are created. Once all canary Pods were ready for the
+// analysis time, the rollout continues in the Progressing phase, in which the
+// remaining Pods are replaced by the regular Pod plan. If the canary Pods do
+// not become ready in time or restart too often, the rollout is rolled back:
+// the canary Pods are deleted and the Model is served by the Pods of the
+// stable revision until the Model is updated again. A Pod of the stable
+// revision is recorded in the status on rollback to recreate the stable
+// Pods if they are all deleted (i.e. when the Model is scaled to zero).
+//
+// It returns false if the regular Pod plan applies instead (i.e. when no
+// rollout is in progress).
+func (r *ModelReconciler) calculateCanaryPodPlan(pods []corev1.Pod, model *kubeaiv1.Model, podForModel *corev1.Pod, now time.Time) (*podPlan, bool) {
+	expectedHash := k8sutils.GetLabel(podForModel, kubeaiv1.PodHashLabel)
+	cfg := model.Spec.Rollout
+
+	var canary, outOfDate []corev1.Pod
+	for _, p := range pods {
+		if k8sutils.GetLabel(&p, kubeaiv1.PodHashLabel) == expectedHash {
+			canary = append(canary, p)
+		} else {
+			outOfDate = append(outOfDate, p)
+		}
+	}
+
+	status := model.Status.Rollout
+	if status == nil || status.Revision != expectedHash {
+		if len(outOfDate) == 0 {
+			// Nothing to roll out (i.e. the Model was just created).
+			return nil, false
+		}
+		status = &kubeaiv1.ModelStatusRollout{
+			Revision:       expectedHash,
+			StableRevision: stableRevision(outOfDate, model.Status.Rollout),
+			Phase:          kubeaiv1.RolloutPhaseCanary,
+			StartTime:      metav1.NewTime(now),
+			Message:        fmt.Sprintf("Evaluating %d canary Pods", cfg.Surge),
+		}
+		model.Status.Rollout = status
+	}
+
+	switch status.Phase {
+	case kubeaiv1.RolloutPhaseProgressing:
+		if len(outOfDate) == 0 {
+			status.Phase = kubeaiv1.RolloutPhaseComplete
+			status.Message = "All Pods are up to date"
+		}
+		return nil, false
+	case kubeaiv1.RolloutPhaseComplete:
+		return nil, false
+	}
+
+	plan := &podPlan{
+		model:       model,
+		gracePeriod: r.ModelServerPods.TerminationGracePeriod.Duration,
+	}
+	var stable []corev1.Pod
+	for _, p := range outOfDate {
+		if k8sutils.GetLabel(&p, kubeaiv1.PodHashLabel) == status.StableRevision {
+			stable = append(stable, p)
+		} else {
+			plan.details = append(plan.details, fmt.Sprintf("Deleting Pod %q of an abandoned revision", p.Name))
+			plan.toDelete = append(plan.toDelete, &p)
+		}
+	}
+	var stablePod *corev1.Pod
+	if len(stable) > 0 {
+		stablePod = podFromPod(model, &stable[0])
+	} else if status.Phase == kubeaiv1.RolloutPhaseRolledBack {
+		stablePod = decodeStablePod(status.StablePod)
+	}
+	if stablePod == nil {
+		// There are no Pods of the stable revision to serve the Model
+		// (i.e. it was scaled to zero), so the canary is not compared
+		// with anything.
+		status.Phase = kubeaiv1.RolloutPhaseProgressing
+		status.CanaryReadyTime = nil
+		status.Message = "No Pods of the stable revision, replacing all Pods"
+		return nil, false
+	}
+
+	// Keep the stable revision at the Model's replicas.
+	plan.scale(stable, ptr.Deref(model.Spec.Replicas, 0), stablePod)
+
+	if status.Phase == kubeaiv1.RolloutPhaseRolledBack {
+		if status.StablePod == nil {
+			// Rolled back before the stable Pod was recorded.
+			status.StablePod = encodeStablePod(stablePod)
+		}
+		for _, p := range canary {
+			plan.details = append(plan.details, fmt.Sprintf("Deleting Pod %q of the rolled back revision", p.Name))
+			plan.toDelete = append(plan.toDelete, &p)
+		}
+		return plan, true
+	}
+
+	if reason := canaryFailure(canary, cfg, status, now); reason != "" {
+		status.Phase = kubeaiv1.RolloutPhaseRolledBack
+		status.CanaryReadyTime = nil
+		status.Message = reason
+		status.StablePod = encodeStablePod(stablePod)
+		for _, p := range canary {
+			plan.details = append(plan.details, fmt.Sprintf("Rolling back canary Pod %q", p.Name))
+			plan.toDelete = append(plan.toDelete, &p)
+		}
+		return plan, true
+	}
+
+	var readyCanary int32
+	for _, p := range canary {
+		if k8sutils.PodIsReady(&p) {
+			readyCanary++
+		}
+	}
+	if readyCanary < cfg.Surge {
+		// The analysis starts over when a canary Pod is not ready.
+		status.CanaryReadyTime = nil
+		plan.scale(canary, cfg.Surge, podForModel)
+		plan.requeueAfter = max(time.Second, status.StartTime.Add(time.Duration(cfg.ProgressDeadlineSeconds)*time.Second).Sub(now))
+		return plan, true
+	}
+
+	if status.CanaryReadyTime == nil {
+		status.CanaryReadyTime = ptr.To(metav1.NewTime(now))
+	}
+	remaining := status.CanaryReadyTime.Add(time.Duration(cfg.AnalysisSeconds) * time.Second).Sub(now)
+	if remaining > 0 {
+		plan.scale(canary, cfg.Surge, podForModel)
+		plan.requeueAfter = remaining
+		return plan, true
+	}
+
+	status.Phase = kubeaiv1.RolloutPhaseProgressing
+	status.Message = fmt.Sprintf("Canary Pods were healthy for %ds, replacing the remaining Pods", cfg.AnalysisSeconds)
+	return nil, false
+}
+
+// stableRevision returns the revision of the out-of-date Pods that served
+// the Model before a rollout: the stable revision of the previous rollout
+// (if it was interrupted by another update) or else the most common revision.
+func stableRevision(outOfDate []corev1.Pod, prev *kubeaiv1.ModelStatusRollout) string {
+	counts := map[string]int{}
+	for _, p := range outOfDate {
+		counts[k8sutils.GetLabel(&p, kubeaiv1.PodHashLabel)]++
+	}
+	if prev != nil && prev.Phase != kubeaiv1.RolloutPhaseComplete && counts[prev.StableRevision] > 0 {
+		return prev.StableRevision
+	}
+	var stable string
+	for hash, n := range counts {
+		if n > counts[stable] || (n == counts[stable] && hash < stable) {
+			stable = hash
+		}
+	}
+	return stable
+}
+
+// canaryFailure returns the reason why a rollout is rolled back, or an
+// empty string if the canary Pods are healthy so far.
+func canaryFailure(canary []corev1.Pod, cfg *kubeaiv1.ModelRollout, status *kubeaiv1.ModelStatusRollout, now time.Time) string {
+	var ready int32
+	for _, p := range canary {
+		var restarts int32
+		for _, c := range p.Status.ContainerStatuses {
+			restarts += c.RestartCount
+		}
+		if restarts > cfg.MaxRestarts {
+			return fmt.Sprintf("Canary Pod %q restarted %d times", p.Name, restarts)
+		}
+		if k8sutils.PodIsReady(&p) {
+			ready++
+		}
+	}
+	deadline := time.Duration(cfg.ProgressDeadlineSeconds) * time.Second
+	if ready < cfg.Surge && status.CanaryReadyTime == nil && now.Sub(status.StartTime.Time) >= deadline {
+		return fmt.Sprintf("Canary Pods were not ready within %ds", cfg.ProgressDeadlineSeconds)
+	}
+	return ""
+}
+
+// encodeStablePod encodes a Pod of the stable revision for the rollout
+// status.
+func encodeStablePod(pod *corev1.Pod) *runtime.RawExtension {
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		return nil
+	}
+	return &runtime.RawExtension{Raw: raw}
+}
+
+// decodeStablePod decodes the Pod of the stable revision from the rollout
+// status (nil if none was recorded).
+func decodeStablePod(ext *runtime.RawExtension) *corev1.Pod {
+	if ext == nil || len(ext.Raw) == 0 {
+		return nil
+	}
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(ext.Raw, pod); err != nil {
+		return nil
+	}
+	return pod
+}
+
+// scale adds Pods to the plan to create or delete so that there are n of
+// the given Pods (which must be sorted by deletion order). New Pods are
+// copies of template.
+func (pp *podPlan) scale(pods []corev1.Pod, n int32, template *corev1.Pod) {
+	diff := int(n) - len(pods)
+	switch {
+	case diff > 0:
+		pp.details = append(pp.details, fmt.Sprintf("Creating %d Pods of revision %q", diff, k8sutils.GetLabel(template, kubeaiv1.PodHashLabel)))
+		for range diff {
+			pp.toCreate = append(pp.toCreate, template.DeepCopy())
+		}
+	case diff < 0:
+		pp.details = append(pp.details, fmt.Sprintf("Deleting %d Pods", -diff))
+		for i := range -diff {
+			pp.toDelete = append(pp.toDelete, &pods[i])
+		}
+		pods = pods[-diff:]
+	}
+	for i := range pods {
+		pp.toRemain = append(pp.toRemain, &pods[i])
+	}
+}
+
+// podFromPod returns a new Pod of the same revision as the given Pod, which
+// is used to create Pods of the stable revision during a rollout (the Model
+// only describes the Pods of the new revision).
+func podFromPod(model *kubeaiv1.Model, pod *corev1.Pod) *corev1.Pod {
+	labels := maps.Clone(pod.Labels)
+	for k := range labels {
+		// Adapters are loaded into the new Pod by the controller.
+		if strings.HasPrefix(k, kubeaiv1.PodAdapterLabelPrefix) {
+			delete(labels, k)
+		}
+	}
+	spec := pod.Spec.DeepCopy()
+	spec.NodeName = ""
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("model-%s-%s-", model.Name, k8sutils.GetLabel(pod, kubeaiv1.PodHashLabel)),
+			Namespace:    pod.Namespace,
+			Labels:       labels,
+			Annotations:  maps.Clone(pod.Annotations),
+		},
+		Spec: *spec,
+	}
+}
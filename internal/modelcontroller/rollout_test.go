@@ -0,0 +1,224 @@
+package modelcontroller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func Test_calculateCanaryPodPlan(t *testing.T) {
+	r := &ModelReconciler{}
+	now := time.Now()
+	start := metav1.NewTime(now.Add(-time.Minute))
+
+	testPod := func(name, hash string, ready bool, restarts int32) corev1.Pod {
+		p := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{v1.PodHashLabel: hash},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{Name: serverContainerName, RestartCount: restarts}},
+			},
+		}
+		if ready {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+		return p
+	}
+	podForModel := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		GenerateName: "model-test-mdl-new-",
+		Labels:       map[string]string{v1.PodHashLabel: "new"},
+	}}
+
+	cases := []struct {
+		name          string
+		status        *v1.ModelStatusRollout
+		pods          []corev1.Pod
+		wantHandled   bool
+		wantPhase     v1.ModelRolloutPhase
+		wantCreations []string
+		wantDeletions []string
+		wantRequeue   time.Duration
+	}{
+		{
+			name: "no rollout",
+			pods: []corev1.Pod{
+				testPod("new-1", "new", true, 0),
+			},
+		},
+		{
+			name: "start canary",
+			pods: []corev1.Pod{
+				testPod("stable-1", "stable", true, 0),
+				testPod("stable-2", "stable", true, 0),
+				testPod("abandoned-1", "abandoned", true, 0),
+			},
+			wantHandled:   true,
+			wantPhase:     v1.RolloutPhaseCanary,
+			wantCreations: []string{"model-test-mdl-new-"},
+			wantDeletions: []string{"abandoned-1"},
+			wantRequeue:   time.Hour,
+		},
+		{
+			name:   "wait for canary",
+			status: &v1.ModelStatusRollout{Revision: "new", StableRevision: "stable", Phase: v1.RolloutPhaseCanary, StartTime: start},
+			pods: []corev1.Pod{
+				testPod("new-1", "new", false, 0),
+				testPod("stable-1", "stable", true, 0),
+				testPod("stable-2", "stable", true, 0),
+			},
+			wantHandled: true,
+			wantPhase:   v1.RolloutPhaseCanary,
+			wantRequeue: time.Hour - time.Minute,
+		},
+		{
+			name:   "replace stable pod",
+			status: &v1.ModelStatusRollout{Revision: "new", StableRevision: "stable", Phase: v1.RolloutPhaseCanary, StartTime: start},
+			pods: []corev1.Pod{
+				testPod("new-1", "new", false, 0),
+				testPod("stable-1", "stable", true, 0),
+			},
+			wantHandled:   true,
+			wantPhase:     v1.RolloutPhaseCanary,
+			wantCreations: []string{"model-test-mdl-stable-"},
+			wantRequeue:   time.Hour - time.Minute,
+		},
+		{
+			name:   "canary not ready in time",
+			status: &v1.ModelStatusRollout{Revision: "new", StableRevision: "stable", Phase: v1.RolloutPhaseCanary, StartTime: metav1.NewTime(now.Add(-2 * time.Hour))},
+			pods: []corev1.Pod{
+				testPod("new-1", "new", false, 0),
+				testPod("stable-1", "stable", true, 0),
+				testPod("stable-2", "stable", true, 0),
+			},
+			wantHandled:   true,
+			wantPhase:     v1.RolloutPhaseRolledBack,
+			wantDeletions: []string{"new-1"},
+		},
+		{
+			name:   "canary restarted",
+			status: &v1.ModelStatusRollout{Revision: "new", StableRevision: "stable", Phase: v1.RolloutPhaseCanary, StartTime: start},
+			pods: []corev1.Pod{
+				testPod("new-1", "new", false, 2),
+				testPod("stable-1", "stable", true, 0),
+				testPod("stable-2", "stable", true, 0),
+			},
+			wantHandled:   true,
+			wantPhase:     v1.RolloutPhaseRolledBack,
+			wantDeletions: []string{"new-1"},
+		},
+		{
+			name:   "analyze canary",
+			status: &v1.ModelStatusRollout{Revision: "new", StableRevision: "stable", Phase: v1.RolloutPhaseCanary, StartTime: start},
+			pods: []corev1.Pod{
+				testPod("new-1", "new", true, 1),
+				testPod("stable-1", "stable", true, 0),
+				testPod("stable-2", "stable", true, 0),
+			},
+			wantHandled: true,
+			wantPhase:   v1.RolloutPhaseCanary,
+			wantRequeue: 5 * time.Minute,
+		},
+		{
+			name: "promote canary",
+			status: &v1.ModelStatusRollout{Revision: "new", StableRevision: "stable", Phase: v1.RolloutPhaseCanary, StartTime: start,
+				CanaryReadyTime: ptr.To(metav1.NewTime(now.Add(-5 * time.Minute)))},
+			pods: []corev1.Pod{
+				testPod("new-1", "new", true, 0),
+				testPod("stable-1", "stable", true, 0),
+				testPod("stable-2", "stable", true, 0),
+			},
+			wantPhase: v1.RolloutPhaseProgressing,
+		},
+		{
+			name:   "rolled back",
+			status: &v1.ModelStatusRollout{Revision: "new", StableRevision: "stable", Phase: v1.RolloutPhaseRolledBack, StartTime: start},
+			pods: []corev1.Pod{
+				testPod("new-1", "new", true, 0),
+				testPod("stable-1", "stable", true, 0),
+			},
+			wantHandled:   true,
+			wantPhase:     v1.RolloutPhaseRolledBack,
+			wantCreations: []string{"model-test-mdl-stable-"},
+			wantDeletions: []string{"new-1"},
+		},
+		{
+			name: "rolled back without stable pods",
+			status: &v1.ModelStatusRollout{Revision: "new", StableRevision: "stable", Phase: v1.RolloutPhaseRolledBack, StartTime: start,
+				StablePod: encodeStablePod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "model-test-mdl-stable-",
+					Labels:       map[string]string{v1.PodHashLabel: "stable"},
+				}})},
+			pods: []corev1.Pod{
+				testPod("new-1", "new", true, 0),
+			},
+			wantHandled:   true,
+			wantPhase:     v1.RolloutPhaseRolledBack,
+			wantCreations: []string{"model-test-mdl-stable-", "model-test-mdl-stable-"},
+			wantDeletions: []string{"new-1"},
+		},
+		{
+			name:   "complete",
+			status: &v1.ModelStatusRollout{Revision: "new", StableRevision: "stable", Phase: v1.RolloutPhaseProgressing, StartTime: start},
+			pods: []corev1.Pod{
+				testPod("new-1", "new", true, 0),
+				testPod("new-2", "new", true, 0),
+			},
+			wantPhase: v1.RolloutPhaseComplete,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			model := &v1.Model{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-mdl"},
+				Spec: v1.ModelSpec{
+					Replicas: ptr.To[int32](2),
+					Rollout: &v1.ModelRollout{
+						Surge:                   1,
+						CanaryPercent:           10,
+						AnalysisSeconds:         300,
+						ProgressDeadlineSeconds: 3600,
+						MaxRestarts:             1,
+					},
+				},
+				Status: v1.ModelStatus{Rollout: c.status.DeepCopy()},
+			}
+
+			plan, handled := r.calculateCanaryPodPlan(c.pods, model, podForModel, now)
+			require.Equal(t, c.wantHandled, handled)
+			if c.wantPhase == "" {
+				require.Nil(t, model.Status.Rollout)
+			} else {
+				require.Equal(t, c.wantPhase, model.Status.Rollout.Phase, model.Status.Rollout.Message)
+				require.Equal(t, "new", model.Status.Rollout.Revision)
+				require.Equal(t, "stable", model.Status.Rollout.StableRevision)
+			}
+			if c.wantPhase == v1.RolloutPhaseRolledBack {
+				stablePod := decodeStablePod(model.Status.Rollout.StablePod)
+				require.NotNil(t, stablePod)
+				require.Equal(t, "stable", stablePod.Labels[v1.PodHashLabel])
+			}
+			if !handled {
+				return
+			}
+
+			var creations, deletions []string
+			for _, p := range plan.toCreate {
+				creations = append(creations, p.GenerateName)
+			}
+			for _, p := range plan.toDelete {
+				deletions = append(deletions, p.Name)
+			}
+			require.Equal(t, c.wantCreations, creations, plan.details)
+			require.Equal(t, c.wantDeletions, deletions, plan.details)
+			require.Equal(t, c.wantRequeue, plan.requeueAfter)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package modelcontroller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// resolveDraftModel gets the draft Model of a Model with SpecDecoding into
+// the model config and sets the SpecDecoding condition. It returns
+// errReturnEarly if the draft Model can not be used (yet), so that the
+// Model's Pods are not updated until the draft Model is fixed.
+func (r *ModelReconciler) resolveDraftModel(ctx context.Context, model *kubeaiv1.Model, c *ModelConfig) error {
+	if model.Spec.SpecDecoding == nil {
+		meta.RemoveStatusCondition(&model.Status.Conditions, kubeaiv1.ModelConditionSpecDecoding)
+		return nil
+	}
+
+	name := model.Spec.SpecDecoding.DraftModel
+	draft := &kubeaiv1.Model{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: model.Namespace, Name: name}, draft); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("getting draft model: %w", err)
+		}
+		setSpecDecodingCondition(model, kubeaiv1.ModelReasonDraftModelNotFound, fmt.Sprintf("Draft Model %q not found", name))
+		return errReturnEarly
+	}
+	reason, msg := draftModelProblem(model, draft)
+	if reason == kubeaiv1.ModelReasonDraftModelResolved {
+		if problem := r.draftVocabularyProblem(ctx, model, draft); problem != "" {
+			reason, msg = kubeaiv1.ModelReasonDraftModelIncompatible, problem
+		}
+	}
+	setSpecDecodingCondition(model, reason, msg)
+	if reason != kubeaiv1.ModelReasonDraftModelResolved {
+		return errReturnEarly
+	}
+
+	src, err := r.parseModelSource(draft.Spec.URL)
+	if err != nil {
+		return fmt.Errorf("parsing draft model source: %w", err)
+	}
+	c.DraftModel = draft
+	c.DraftSource = src
+	return nil
+}
+
+// draftModelProblem checks whether a Model can be used as the draft model
+// of another Model. It returns the reason and message of the SpecDecoding
+// condition.
+func draftModelProblem(model, draft *kubeaiv1.Model) (string, string) {
+	incompatible := func(format string, args ...any) (string, string) {
+		return kubeaiv1.ModelReasonDraftModelIncompatible, fmt.Sprintf("Draft Model %q ", draft.Name) + fmt.Sprintf(format, args...)
+	}
+	switch {
+	case draft.Name == model.Name:
+		return incompatible("is the Model itself")
+	case draft.DeletionTimestamp != nil:
+		return incompatible("is being deleted")
+	case draft.Spec.Engine != kubeaiv1.VLLMEngine:
+		return incompatible("uses the %s engine instead of %s", draft.Spec.Engine, kubeaiv1.VLLMEngine)
+	case !slices.Contains(draft.Spec.Features, kubeaiv1.ModelFeatureTextGeneration):
+		return incompatible("does not have the %s feature", kubeaiv1.ModelFeatureTextGeneration)
+	case draft.Spec.SpecDecoding != nil:
+		return incompatible("uses speculative decoding itself")
+	case draft.Spec.CacheProfile != "" && draft.Spec.CacheProfile != model.Spec.CacheProfile:
+		return incompatible("uses cacheProfile %q, expected none or %q", draft.Spec.CacheProfile, model.Spec.CacheProfile)
+	}
+	if draft.Spec.CacheProfile != "" && (draft.Status.Cache == nil || !draft.Status.Cache.Loaded) {
+		return kubeaiv1.ModelReasonDraftModelNotCached, fmt.Sprintf("Waiting for draft Model %q to be loaded into the cache", draft.Name)
+	}
+	return kubeaiv1.ModelReasonDraftModelResolved, fmt.Sprintf("Using draft Model %q", draft.Name)
+}
+
+// VocabularyResolver resolves the size of the vocabulary of the model that a
+// Model URL references.
+type VocabularyResolver interface {
+	// VocabSize returns the size of the vocabulary of the model at the URL.
+	// The revision argument is the revision that the Model requests in its
+	// args (empty by default).
+	VocabSize(ctx context.Context, url, revision string) (int, error)
+}
+
+// draftVocabularyProblem checks that a draft Model has the same vocabulary
+// as the Model, which speculative decoding requires: the model server
+// verifies the tokens of the draft model with the Model, so both have to use
+// the same tokenizer. It returns the message of the SpecDecoding condition
+// if they do not. The check is skipped if the vocabulary of either Model can
+// not be resolved (i.e. for URLs other than Hugging Face repos).
+func (r *ModelReconciler) draftVocabularyProblem(ctx context.Context, model, draft *kubeaiv1.Model) string {
+	if r.Vocabularies == nil {
+		return ""
+	}
+	vocabSize := func(m *kubeaiv1.Model) (int, bool) {
+		var revision string
+		for _, f := range parseFlags(m.Spec.Args) {
+			if f.name == "--revision" {
+				revision = f.value
+			}
+		}
+		size, err := r.Vocabularies.VocabSize(ctx, m.Spec.URL, revision)
+		if err != nil {
+			log.FromContext(ctx).Info("Skipping the vocabulary check of the draft model", "model", m.Name, "error", err.Error())
+			return 0, false
+		}
+		return size, true
+	}
+	want, ok := vocabSize(model)
+	if !ok {
+		return ""
+	}
+	got, ok := vocabSize(draft)
+	if !ok || got == want {
+		return ""
+	}
+	return fmt.Sprintf("Draft Model %q has a vocabulary of %d tokens, expected %d: the draft model must use the same tokenizer as the Model", draft.Name, got, want)
+}
+
+func setSpecDecodingCondition(model *kubeaiv1.Model, reason, msg string) {
+	status := metav1.ConditionFalse
+	if reason == kubeaiv1.ModelReasonDraftModelResolved {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&model.Status.Conditions, metav1.Condition{
+		Type:               kubeaiv1.ModelConditionSpecDecoding,
+		Status:             status,
+		Reason:             reason,
+		Message:            msg,
+		ObservedGeneration: model.Generation,
+	})
+}
+
+const draftModelVolName = "draft-model"
+
+// patchServerDraftModel configures the vLLM server of a Pod to run the draft
+// model of the Model next to the model: the draft model is loaded from the
+// cache of the draft Model (which has the same cache profile as the Model)
+// or else from Huggingface.
+func patchServerDraftModel(podSpec *corev1.PodSpec, m *kubeaiv1.Model, c ModelConfig) {
+	if c.DraftModel == nil {
+		return
+	}
+	draftFlag := c.DraftSource.url.ref
+	if c.DraftModel.Spec.CacheProfile != "" {
+		draftFlag = modelCacheDir(c.DraftModel)
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: draftModelVolName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: cachePVCName(c.DraftModel, c),
+				},
+			},
+		})
+	}
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name != serverContainerName {
+			continue
+		}
+		podSpec.Containers[i].Args = append(podSpec.Containers[i].Args,
+			"--speculative-model="+draftFlag,
+			fmt.Sprintf("--num-speculative-tokens=%d", m.Spec.SpecDecoding.NumSpeculativeTokens),
+		)
+		if c.DraftModel.Spec.CacheProfile != "" {
+			podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, corev1.VolumeMount{
+				Name:      draftModelVolName,
+				MountPath: modelCacheDir(c.DraftModel),
+				SubPath:   strings.TrimPrefix(modelCacheDir(c.DraftModel), "/"),
+				ReadOnly:  true,
+			})
+		} else if c.DraftSource.url.scheme != c.Source.url.scheme {
+			c.DraftSource.modelAuthCredentials.applyToPodSpec(podSpec, i)
+		}
+	}
+}
+
+// modelsWithDraftModel returns requests for the Models that use the given
+// Model as their draft model, so that they are reconciled when their draft
+// Model changes (i.e. when it is created or its cache is loaded).
+func (r *ModelReconciler) modelsWithDraftModel(ctx context.Context, obj client.Object) []reconcile.Request {
+	var models kubeaiv1.ModelList
+	if err := r.List(ctx, &models, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Models with draft model", "draftModel", obj.GetName())
+		return nil
+	}
+	var reqs []reconcile.Request
+	for _, m := range models.Items {
+		if m.Spec.SpecDecoding != nil && m.Spec.SpecDecoding.DraftModel == obj.GetName() {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: m.Namespace, Name: m.Name}})
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,153 @@
+package modelcontroller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type fakeVocabularies map[string]int
+
+func (f fakeVocabularies) VocabSize(_ context.Context, url, revision string) (int, error) {
+	size, ok := f[url+"@"+revision]
+	if !ok {
+		return 0, errors.New("unsupported")
+	}
+	return size, nil
+}
+
+func Test_draftVocabularyProblem(t *testing.T) {
+	ctx := context.Background()
+	r := &ModelReconciler{Vocabularies: fakeVocabularies{
+		"hf://meta-llama/Llama-3.1-70B-Instruct@": 128256,
+		"hf://meta-llama/Llama-3.2-1B-Instruct@":  128256,
+		"hf://Qwen/Qwen2.5-0.5B-Instruct@v1":      151936,
+	}}
+	model := &v1.Model{Spec: v1.ModelSpec{URL: "hf://meta-llama/Llama-3.1-70B-Instruct"}}
+	draft := func(url string, args ...string) *v1.Model {
+		return &v1.Model{ObjectMeta: metav1.ObjectMeta{Name: "draft"}, Spec: v1.ModelSpec{URL: url, Args: args}}
+	}
+
+	require.Empty(t, r.draftVocabularyProblem(ctx, model, draft("hf://meta-llama/Llama-3.2-1B-Instruct")))
+	require.Equal(t, `Draft Model "draft" has a vocabulary of 151936 tokens, expected 128256: the draft model must use the same tokenizer as the Model`,
+		r.draftVocabularyProblem(ctx, model, draft("hf://Qwen/Qwen2.5-0.5B-Instruct", "--revision=v1")))
+	// Vocabularies that can not be resolved are not checked.
+	require.Empty(t, r.draftVocabularyProblem(ctx, model, draft("s3://bucket/draft")))
+	require.Empty(t, (&ModelReconciler{}).draftVocabularyProblem(ctx, model, draft("hf://Qwen/Qwen2.5-0.5B-Instruct", "--revision=v1")))
+}
+
+func Test_draftModelProblem(t *testing.T) {
+	model := &v1.Model{
+		ObjectMeta: metav1.ObjectMeta{Name: "llama-70b"},
+		Spec: v1.ModelSpec{
+			Engine:       v1.VLLMEngine,
+			CacheProfile: "efs",
+			SpecDecoding: &v1.SpecDecoding{DraftModel: "llama-1b"},
+		},
+	}
+	validDraft := func() *v1.Model {
+		return &v1.Model{
+			ObjectMeta: metav1.ObjectMeta{Name: "llama-1b"},
+			Spec: v1.ModelSpec{
+				Engine:   v1.VLLMEngine,
+				Features: []v1.ModelFeature{v1.ModelFeatureTextGeneration},
+			},
+		}
+	}
+
+	cases := []struct {
+		name       string
+		draft      func(*v1.Model)
+		wantReason string
+	}{
+		{
+			name:       "valid",
+			draft:      func(*v1.Model) {},
+			wantReason: v1.ModelReasonDraftModelResolved,
+		},
+		{
+			name:       "itself",
+			draft:      func(d *v1.Model) { d.Name = model.Name },
+			wantReason: v1.ModelReasonDraftModelIncompatible,
+		},
+		{
+			name:       "other engine",
+			draft:      func(d *v1.Model) { d.Spec.Engine = v1.OLlamaEngine },
+			wantReason: v1.ModelReasonDraftModelIncompatible,
+		},
+		{
+			name:       "embedding model",
+			draft:      func(d *v1.Model) { d.Spec.Features = []v1.ModelFeature{v1.ModelFeatureTextEmbedding} },
+			wantReason: v1.ModelReasonDraftModelIncompatible,
+		},
+		{
+			name:       "draft with draft",
+			draft:      func(d *v1.Model) { d.Spec.SpecDecoding = &v1.SpecDecoding{DraftModel: "other"} },
+			wantReason: v1.ModelReasonDraftModelIncompatible,
+		},
+		{
+			name:       "other cache profile",
+			draft:      func(d *v1.Model) { d.Spec.CacheProfile = "filestore" },
+			wantReason: v1.ModelReasonDraftModelIncompatible,
+		},
+		{
+			name:       "not cached yet",
+			draft:      func(d *v1.Model) { d.Spec.CacheProfile = "efs" },
+			wantReason: v1.ModelReasonDraftModelNotCached,
+		},
+		{
+			name: "cached",
+			draft: func(d *v1.Model) {
+				d.Spec.CacheProfile = "efs"
+				d.Status.Cache = &v1.ModelStatusCache{Loaded: true}
+			},
+			wantReason: v1.ModelReasonDraftModelResolved,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			draft := validDraft()
+			c.draft(draft)
+			reason, msg := draftModelProblem(model, draft)
+			require.Equal(t, c.wantReason, reason, msg)
+		})
+	}
+}
+
+func Test_patchServerDraftModel(t *testing.T) {
+	r := &ModelReconciler{}
+	model := &v1.Model{
+		ObjectMeta: metav1.ObjectMeta{Name: "llama-70b", UID: types.UID("70b70b70b")},
+		Spec: v1.ModelSpec{
+			Engine:       v1.VLLMEngine,
+			URL:          "s3://my-bucket/llama-70b",
+			CacheProfile: "efs",
+			SpecDecoding: &v1.SpecDecoding{DraftModel: "llama-1b", NumSpeculativeTokens: 5},
+		},
+	}
+	cfg := ModelConfig{
+		Source: modelSource{modelAuthCredentials: &modelAuthCredentials{}, url: modelURL{scheme: "s3", ref: "my-bucket/llama-70b"}},
+		DraftModel: &v1.Model{
+			ObjectMeta: metav1.ObjectMeta{Name: "llama-1b", UID: types.UID("1b1b1b1b1")},
+			Spec:       v1.ModelSpec{CacheProfile: "efs"},
+		},
+		DraftSource: modelSource{modelAuthCredentials: &modelAuthCredentials{}, url: modelURL{scheme: "hf", ref: "meta-llama/llama-1b"}},
+	}
+
+	pod := r.vLLMPodForModel(model, cfg)
+	server := pod.Spec.Containers[0]
+	require.Contains(t, server.Args, "--speculative-model=/models/llama-1b-1b1b1b1b1")
+	require.Contains(t, server.Args, "--num-speculative-tokens=5")
+	require.Equal(t, "models/llama-1b-1b1b1b1b1", server.VolumeMounts[len(server.VolumeMounts)-1].SubPath)
+	require.Equal(t, "model-cache-llama-1b-1b1b1b1", pod.Spec.Volumes[len(pod.Spec.Volumes)-1].PersistentVolumeClaim.ClaimName)
+
+	cfg.DraftModel.Spec.CacheProfile = ""
+	pod = r.vLLMPodForModel(model, cfg)
+	require.Contains(t, pod.Spec.Containers[0].Args, "--speculative-model=meta-llama/llama-1b")
+}
@@ -0,0 +1,104 @@
+package modelcontroller
+
+import (
+	"fmt"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+// calculateStepSwitchPodPlan calculates the Pod plan of a Model with vertical
+// scaling that was switched to another step (resource profile) while Pods of
+// a previous step exist. The Pods must be sorted by deletion order.
+//
+// The replicas and the resource profile of the Model are switched together
+// (i.e. from 4 replicas with 1 GPU to 2 replicas with 2 GPUs), so replacing
+// the Pods one by one would not keep the capacity of the Model. Instead, up
+// to Surge Pods of the new step are created at a time and ready Pods of the
+// previous steps are kept while they are needed to serve the Model's
+// TargetRequests (as configured for each step) together with the ready Pods
+// of the new step.
+//
+// It returns false if the regular Pod plan applies instead (i.e. when no
+// Pods of a previous step are left).
+func (r *ModelReconciler) calculateStepSwitchPodPlan(pods []corev1.Pod, model *kubeaiv1.Model, podForModel *corev1.Pod) (*podPlan, bool) {
+	vs := model.Spec.VerticalScaling
+	if vs == nil {
+		return nil, false
+	}
+
+	expectedHash := k8sutils.GetLabel(podForModel, kubeaiv1.PodHashLabel)
+	var current, previous []corev1.Pod
+	for _, p := range pods {
+		if k8sutils.GetLabel(&p, kubeaiv1.PodHashLabel) == expectedHash {
+			current = append(current, p)
+			continue
+		}
+		// Pods without the annotation were created before vertical
+		// scaling was enabled.
+		if profile := k8sutils.GetAnnotation(&p, kubeaiv1.PodResourceProfileAnnotation); profile != "" && profile != model.Spec.ResourceProfile {
+			previous = append(previous, p)
+		} else {
+			current = append(current, p)
+		}
+	}
+	if len(previous) == 0 {
+		return nil, false
+	}
+
+	plan := &podPlan{
+		model:       model,
+		gracePeriod: r.ModelServerPods.TerminationGracePeriod.Duration,
+	}
+
+	replicas := ptr.Deref(model.Spec.Replicas, 0)
+	target := stepTargetRequests(model, model.Spec.ResourceProfile)
+	var ready int32
+	for _, p := range current {
+		if k8sutils.PodIsReady(&p) {
+			ready++
+		}
+	}
+	surge := max(vs.Surge, 1)
+	plan.scale(current, min(replicas, ready+surge), podForModel)
+
+	// Keep the Pods that are deleted last (at the end of the list) while
+	// the ready Pods of the new step do not serve the Model's replicas.
+	missing := int64(replicas-min(ready, replicas)) * target
+	keep := map[int]bool{}
+	for i := len(previous) - 1; i >= 0 && missing > 0; i-- {
+		if !k8sutils.PodIsReady(&previous[i]) {
+			continue
+		}
+		keep[i] = true
+		missing -= stepTargetRequests(model, k8sutils.GetAnnotation(&previous[i], kubeaiv1.PodResourceProfileAnnotation))
+	}
+	var deleted int
+	for i := range previous {
+		if keep[i] {
+			plan.toRemain = append(plan.toRemain, &previous[i])
+		} else {
+			plan.toDelete = append(plan.toDelete, &previous[i])
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		plan.details = append(plan.details, fmt.Sprintf("Deleting %d Pods of previous resource profiles, %d ready Pods of resource profile %q", deleted, ready, model.Spec.ResourceProfile))
+	}
+	return plan, true
+}
+
+// stepTargetRequests returns the TargetRequests of the vertical scaling step
+// of the resource profile, falling back to the Model's TargetRequests.
+func stepTargetRequests(m *kubeaiv1.Model, resourceProfile string) int64 {
+	if m.Spec.VerticalScaling != nil {
+		for _, step := range m.Spec.VerticalScaling.Steps {
+			if step.ResourceProfile == resourceProfile && step.TargetRequests != nil {
+				return int64(*step.TargetRequests)
+			}
+		}
+	}
+	return int64(ptr.Deref(m.Spec.TargetRequests, 1))
+}
@@ -0,0 +1,124 @@
+package modelcontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func Test_calculateStepSwitchPodPlan(t *testing.T) {
+	r := &ModelReconciler{}
+
+	testPod := func(name, hash, profile string, ready bool) corev1.Pod {
+		p := corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{v1.PodHashLabel: hash},
+			Annotations: map[string]string{v1.PodResourceProfileAnnotation: profile},
+		}}
+		if ready {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+		return p
+	}
+	podForModel := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		GenerateName: "model-test-mdl-new-",
+		Labels:       map[string]string{v1.PodHashLabel: "new"},
+		Annotations:  map[string]string{v1.PodResourceProfileAnnotation: "gpu:2"},
+	}}
+	// Switched from 4 replicas with 1 GPU to 2 replicas with 2 GPUs.
+	oneGPU := []corev1.Pod{
+		testPod("old-1", "old", "gpu:1", true),
+		testPod("old-2", "old", "gpu:1", true),
+		testPod("old-3", "old", "gpu:1", true),
+		testPod("old-4", "old", "gpu:1", true),
+	}
+
+	cases := []struct {
+		name          string
+		pods          []corev1.Pod
+		wantHandled   bool
+		wantCreations int
+		wantDeletions []string
+	}{
+		{
+			name: "up to date",
+			pods: []corev1.Pod{testPod("new-1", "new", "gpu:2", true)},
+		},
+		{
+			name: "spec change",
+			pods: []corev1.Pod{testPod("old-1", "old", "gpu:2", true)},
+		},
+		{
+			name:          "start switch",
+			pods:          oneGPU,
+			wantHandled:   true,
+			wantCreations: 1,
+		},
+		{
+			name:        "wait for new pod",
+			pods:        append([]corev1.Pod{testPod("new-1", "new", "gpu:2", false)}, oneGPU...),
+			wantHandled: true,
+		},
+		{
+			name:          "replace capacity of ready pod",
+			pods:          append([]corev1.Pod{testPod("new-1", "new", "gpu:2", true)}, oneGPU...),
+			wantHandled:   true,
+			wantCreations: 1,
+			wantDeletions: []string{"old-1", "old-2"},
+		},
+		{
+			name: "not ready pods of previous step",
+			pods: []corev1.Pod{
+				testPod("old-1", "old", "gpu:1", false),
+				testPod("old-2", "old", "gpu:1", true),
+			},
+			wantHandled:   true,
+			wantCreations: 1,
+			wantDeletions: []string{"old-1"},
+		},
+		{
+			name: "switch complete",
+			pods: []corev1.Pod{
+				testPod("new-1", "new", "gpu:2", true),
+				testPod("new-2", "new", "gpu:2", true),
+				testPod("old-1", "old", "gpu:1", true),
+			},
+			wantHandled:   true,
+			wantDeletions: []string{"old-1"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			model := &v1.Model{Spec: v1.ModelSpec{
+				Replicas:        ptr.To[int32](2),
+				ResourceProfile: "gpu:2",
+				TargetRequests:  ptr.To[int32](10),
+				VerticalScaling: &v1.VerticalScaling{
+					Steps: []v1.VerticalScalingStep{
+						{ResourceProfile: "gpu:1"},
+						{ResourceProfile: "gpu:2", TargetRequests: ptr.To[int32](20)},
+					},
+					Surge: 1,
+				},
+			}}
+			pods := append([]corev1.Pod(nil), c.pods...)
+			sortPodsByDeletionOrder(pods, "new", nil)
+			plan, handled := r.calculateStepSwitchPodPlan(pods, model, podForModel)
+			require.Equal(t, c.wantHandled, handled)
+			if !handled {
+				return
+			}
+			require.Len(t, plan.toCreate, c.wantCreations)
+			var deletions []string
+			for _, p := range plan.toDelete {
+				deletions = append(deletions, p.Name)
+			}
+			require.ElementsMatch(t, c.wantDeletions, deletions)
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package modelcontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// WarmPool keeps placeholder Pods running for resource profiles that have a
+// warm pool configured. The Pods hold on to provisioned Nodes and pre-pull
+// the server image. When a Model is scaled from zero, the ModelReconciler
+// claims (deletes) a warm Pod and schedules the Model Pod onto its Node.
+type WarmPool struct {
+	client.Client
+	Namespace        string
+	ResourceProfiles map[string]config.ResourceProfile
+	ModelServers     config.ModelServers
+	// Interval is the time between reconciliations (i.e. how long it takes
+	// to replace claimed Pods).
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable.
+func (w *WarmPool) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.reconcile(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to reconcile warm pool")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *WarmPool) reconcile(ctx context.Context) error {
+	log := log.FromContext(ctx)
+
+	var pods corev1.PodList
+	if err := w.List(ctx, &pods, client.InNamespace(w.Namespace), client.HasLabels{kubeaiv1.PodWarmPoolLabel}); err != nil {
+		return fmt.Errorf("listing warm pool pods: %w", err)
+	}
+	podsByProfile := map[string][]corev1.Pod{}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		profile := k8sutils.GetLabel(&pod, kubeaiv1.PodWarmPoolLabel)
+		podsByProfile[profile] = append(podsByProfile[profile], pod)
+	}
+
+	var errs error
+	for name, pods := range podsByProfile {
+		if rp, ok := w.ResourceProfiles[name]; ok && rp.WarmPool != nil {
+			continue
+		}
+		// The warm pool was removed from the profile.
+		for _, pod := range pods {
+			errs = errors.Join(errs, w.deletePod(ctx, pod))
+		}
+	}
+
+	for name, rp := range w.ResourceProfiles {
+		if rp.WarmPool == nil {
+			continue
+		}
+		desired := warmPodForProfile(w.Namespace, name, applyGPUSharing(rp), warmPoolImage(rp, w.ModelServers))
+		toCreate, toDelete := planWarmPool(podsByProfile[name], rp.WarmPool.Replicas, k8sutils.GetLabel(desired, kubeaiv1.PodHashLabel))
+		if toCreate > 0 || len(toDelete) > 0 {
+			log.Info("Reconciling warm pool", "resourceProfile", name, "creating", toCreate, "deleting", len(toDelete))
+		}
+		for _, pod := range toDelete {
+			errs = errors.Join(errs, w.deletePod(ctx, pod))
+		}
+		for i := 0; i < toCreate; i++ {
+			if err := w.Create(ctx, desired.DeepCopy(), k8sutils.DefaultCreateOptions()); err != nil {
+				errs = errors.Join(errs, fmt.Errorf("creating warm pool pod: %w", err))
+			}
+		}
+	}
+
+	return errs
+}
+
+func (w *WarmPool) deletePod(ctx context.Context, pod corev1.Pod) error {
+	if err := w.Delete(ctx, &pod); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("deleting warm pool pod: %w", err)
+	}
+	return nil
+}
+
+// planWarmPool returns the number of warm Pods to create and the warm Pods
+// to delete so that the given number of up-to-date replicas are running.
+func planWarmPool(pods []corev1.Pod, replicas int32, expectedHash string) (int, []corev1.Pod) {
+	sortPodsByDeletionOrder(pods, expectedHash, nil)
+
+	var (
+		upToDate []corev1.Pod
+		toDelete []corev1.Pod
+	)
+	for _, pod := range pods {
+		if k8sutils.GetLabel(&pod, kubeaiv1.PodHashLabel) == expectedHash {
+			upToDate = append(upToDate, pod)
+		} else {
+			toDelete = append(toDelete, pod)
+		}
+	}
+
+	if excess := len(upToDate) - int(replicas); excess > 0 {
+		return 0, append(toDelete, upToDate[:excess]...)
+	}
+	return int(replicas) - len(upToDate), toDelete
+}
+
+func warmPoolImage(rp config.ResourceProfile, servers config.ModelServers) string {
+	if rp.WarmPool.Image != "" {
+		return rp.WarmPool.Image
+	}
+	if img, ok := servers.VLLM.Images[profileImageName(rp)]; ok {
+		return img
+	}
+	return servers.VLLM.Images[defaultImageName]
+}
+
+func warmPodForProfile(namespace, name string, rp config.ResourceProfile, image string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Labels: map[string]string{
+				kubeaiv1.PodWarmPoolLabel:      name,
+				"app.kubernetes.io/managed-by": "kubeai",
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector:      rp.NodeSelector,
+			Affinity:          rp.Affinity,
+			Tolerations:       rp.Tolerations,
+			RuntimeClassName:  rp.RuntimeClassName,
+			PriorityClassName: rp.WarmPool.PriorityClassName,
+			// Claimed Pods should release their resources immediately.
+			TerminationGracePeriodSeconds: ptr.To[int64](0),
+			Containers: []corev1.Container{
+				{
+					Name:    "warm",
+					Image:   image,
+					Command: []string{"sleep", "infinity"},
+					Resources: corev1.ResourceRequirements{
+						Requests: multiplyResources(rp.Requests, rp.WarmPool.Multiple),
+						Limits:   multiplyResources(rp.Limits, rp.WarmPool.Multiple),
+					},
+				},
+			},
+		},
+	}
+
+	hash := k8sutils.PodHash(pod.Spec)
+	pod.GenerateName = fmt.Sprintf("warm-pool-%s-%s-", name, hash)
+	k8sutils.SetLabel(pod, kubeaiv1.PodHashLabel, hash)
+
+	return pod
+}
+
+// claimWarmPods deletes ready warm Pods of the Model's resource profile and
+// makes the given Pods prefer the Nodes that the warm Pods were running on.
+func (r *ModelReconciler) claimWarmPods(ctx context.Context, toCreate []*corev1.Pod, modelConfig ModelConfig) error {
+	log := log.FromContext(ctx)
+
+	rp, ok := r.ResourceProfiles[modelConfig.ResourceProfileName]
+	if !ok || rp.WarmPool == nil || rp.WarmPool.Multiple < modelConfig.ResourceProfileMultiple {
+		return nil
+	}
+
+	var warmPods corev1.PodList
+	if err := r.List(ctx, &warmPods, client.InNamespace(r.Namespace), client.MatchingLabels{
+		kubeaiv1.PodWarmPoolLabel: modelConfig.ResourceProfileName,
+	}); err != nil {
+		return fmt.Errorf("listing warm pool pods: %w", err)
+	}
+
+	claimable := claimableWarmPods(warmPods.Items)
+	for _, pod := range toCreate {
+		for len(claimable) > 0 {
+			warm := claimable[0]
+			claimable = claimable[1:]
+			// The UID precondition avoids claiming a Pod that was replaced
+			// since it was listed.
+			if err := r.Delete(ctx, &warm, client.Preconditions{UID: &warm.UID}, client.GracePeriodSeconds(0)); err != nil {
+				if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+					continue
+				}
+				return fmt.Errorf("deleting warm pool pod: %w", err)
+			}
+			log.Info("Claimed warm pool Pod", "podName", warm.Name, "nodeName", warm.Spec.NodeName)
+			preferNode(pod, warm.Spec.NodeName)
+			break
+		}
+	}
+
+	return nil
+}
+
+// claimableWarmPods returns the warm Pods that are running on a Node
+// (with the image pulled).
+func claimableWarmPods(pods []corev1.Pod) []corev1.Pod {
+	var claimable []corev1.Pod
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && k8sutils.PodIsScheduled(&pod) && k8sutils.PodIsReady(&pod) {
+			claimable = append(claimable, pod)
+		}
+	}
+	return claimable
+}
+
+func preferNode(pod *corev1.Pod, nodeName string) {
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity == nil {
+		pod.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	na := pod.Spec.Affinity.NodeAffinity
+	na.PreferredDuringSchedulingIgnoredDuringExecution = append(na.PreferredDuringSchedulingIgnoredDuringExecution,
+		corev1.PreferredSchedulingTerm{
+			Weight: 100,
+			Preference: corev1.NodeSelectorTerm{
+				MatchFields: []corev1.NodeSelectorRequirement{{
+					Key:      "metadata.name",
+					Operator: corev1.NodeSelectorOpIn,
+					Values:   []string{nodeName},
+				}},
+			},
+		},
+	)
+}
+
+func multiplyResources(resources corev1.ResourceList, multiple int32) corev1.ResourceList {
+	result := make(corev1.ResourceList)
+	for key, quantity := range resources {
+		q := quantity.DeepCopy()
+		q.Mul(int64(multiple))
+		result[key] = q
+	}
+	return result
+}
@@ -0,0 +1,183 @@
+package modelcontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func Test_warmPodForProfile(t *testing.T) {
+	rp := config.ResourceProfile{
+		Requests: corev1.ResourceList{
+			"nvidia.com/gpu": resource.MustParse("1"),
+		},
+		Limits: corev1.ResourceList{
+			"nvidia.com/gpu": resource.MustParse("1"),
+		},
+		NodeSelector: map[string]string{"node": "selector"},
+		WarmPool: &config.WarmPool{
+			Replicas:          1,
+			Multiple:          2,
+			PriorityClassName: "low",
+		},
+	}
+
+	pod := warmPodForProfile("test-ns", "my-gpu", rp, "my-image")
+	require.Equal(t, "test-ns", pod.Namespace)
+	require.Equal(t, "my-gpu", k8sutils.GetLabel(pod, v1.PodWarmPoolLabel))
+	require.Equal(t, "warm-pool-my-gpu-"+k8sutils.GetLabel(pod, v1.PodHashLabel)+"-", pod.GenerateName)
+	require.Equal(t, rp.NodeSelector, pod.Spec.NodeSelector)
+	require.Equal(t, "low", pod.Spec.PriorityClassName)
+	require.Len(t, pod.Spec.Containers, 1)
+	require.Equal(t, "my-image", pod.Spec.Containers[0].Image)
+	require.Equal(t, "2", ptr.To(pod.Spec.Containers[0].Resources.Requests["nvidia.com/gpu"]).String())
+	require.Equal(t, "2", ptr.To(pod.Spec.Containers[0].Resources.Limits["nvidia.com/gpu"]).String())
+
+	// Changes to the profile should change the hash.
+	rp.WarmPool.Multiple = 1
+	updated := warmPodForProfile("test-ns", "my-gpu", rp, "my-image")
+	require.NotEqual(t, k8sutils.GetLabel(pod, v1.PodHashLabel), k8sutils.GetLabel(updated, v1.PodHashLabel))
+}
+
+func Test_warmPoolImage(t *testing.T) {
+	servers := config.ModelServers{
+		VLLM: config.ModelServer{
+			Images: map[string]string{
+				"default":    "vllm-default",
+				"nvidia-gpu": "vllm-gpu",
+			},
+		},
+	}
+	cases := []struct {
+		name string
+		rp   config.ResourceProfile
+		want string
+	}{
+		{
+			name: "explicit image",
+			rp:   config.ResourceProfile{ImageName: "nvidia-gpu", WarmPool: &config.WarmPool{Image: "custom"}},
+			want: "custom",
+		},
+		{
+			name: "profile image name",
+			rp:   config.ResourceProfile{ImageName: "nvidia-gpu", WarmPool: &config.WarmPool{}},
+			want: "vllm-gpu",
+		},
+		{
+			name: "default image",
+			rp:   config.ResourceProfile{ImageName: "unknown", WarmPool: &config.WarmPool{}},
+			want: "vllm-default",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want, warmPoolImage(c.rp, servers))
+		})
+	}
+}
+
+func Test_planWarmPool(t *testing.T) {
+	pod := func(name, hash string, ready bool) corev1.Pod {
+		p := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Labels:            map[string]string{v1.PodHashLabel: hash},
+				CreationTimestamp: testOldTS,
+			},
+		}
+		if ready {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+		return p
+	}
+
+	cases := []struct {
+		name          string
+		pods          []corev1.Pod
+		replicas      int32
+		wantCreate    int
+		wantDeletions []string
+	}{
+		{
+			name:       "scale up from empty",
+			replicas:   2,
+			wantCreate: 2,
+		},
+		{
+			name:       "replace claimed pod",
+			pods:       []corev1.Pod{pod("a", testNewHash, true)},
+			replicas:   2,
+			wantCreate: 1,
+		},
+		{
+			name:          "delete excess not-ready pods first",
+			pods:          []corev1.Pod{pod("ready", testNewHash, true), pod("not-ready", testNewHash, false)},
+			replicas:      1,
+			wantDeletions: []string{"not-ready"},
+		},
+		{
+			name:          "replace out-of-date pods",
+			pods:          []corev1.Pod{pod("old", "old-hash", true), pod("new", testNewHash, true)},
+			replicas:      2,
+			wantCreate:    1,
+			wantDeletions: []string{"old"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			create, toDelete := planWarmPool(c.pods, c.replicas, testNewHash)
+			require.Equal(t, c.wantCreate, create)
+			var deletions []string
+			for _, p := range toDelete {
+				deletions = append(deletions, p.Name)
+			}
+			require.Equal(t, c.wantDeletions, deletions)
+		})
+	}
+}
+
+func Test_claimableWarmPods(t *testing.T) {
+	ready := []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "claimable"},
+			Spec:       corev1.PodSpec{NodeName: "node-a"},
+			Status:     corev1.PodStatus{Conditions: ready},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "not-ready"},
+			Spec:       corev1.PodSpec{NodeName: "node-b"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "deleting", DeletionTimestamp: &testYoungTS},
+			Spec:       corev1.PodSpec{NodeName: "node-c"},
+			Status:     corev1.PodStatus{Conditions: ready},
+		},
+	}
+
+	claimable := claimableWarmPods(pods)
+	require.Len(t, claimable, 1)
+	require.Equal(t, "claimable", claimable[0].Name)
+}
+
+func Test_preferNode(t *testing.T) {
+	pod := &corev1.Pod{}
+	preferNode(pod, "node-a")
+	require.Equal(t, []corev1.PreferredSchedulingTerm{{
+		Weight: 100,
+		Preference: corev1.NodeSelectorTerm{
+			MatchFields: []corev1.NodeSelectorRequirement{{
+				Key:      "metadata.name",
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{"node-a"},
+			}},
+		},
+	}}, pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution)
+}
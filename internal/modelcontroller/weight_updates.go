@@ -0,0 +1,220 @@
+package modelcontroller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/k8sutils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// WeightsRevisionResolver resolves the revision of the weights that a Model
+// URL references.
+type WeightsRevisionResolver interface {
+	// Revision returns the revision of the weights at the URL. The revision
+	// argument is the revision that the Model requests in its args (i.e.
+	// a branch of a Hugging Face repo), it is empty by default.
+	Revision(ctx context.Context, url, revision string) (string, error)
+}
+
+const (
+	// weightsRevisionEnv is set in the model server container to the
+	// revision of the weights, so that Pods are replaced when it changes.
+	weightsRevisionEnv = "KUBEAI_WEIGHTS_REVISION"
+
+	defaultWeightsCheckInterval = 10 * time.Minute
+)
+
+// reconcileWeightsRevision resolves the revision of the Model's weights once
+// per check interval (see ModelSpec.WeightUpdates) and returns the time after
+// which it should be resolved again (zero if never).
+func (r *ModelReconciler) reconcileWeightsRevision(ctx context.Context, model *kubeaiv1.Model, now time.Time) time.Duration {
+	cfg := model.Spec.WeightUpdates
+	if cfg == nil || r.WeightsRevisions == nil {
+		model.Status.Weights = nil
+		return 0
+	}
+	status := model.Status.Weights
+	if status == nil {
+		status = &kubeaiv1.ModelStatusWeights{}
+		model.Status.Weights = status
+	}
+	if model.Spec.CacheProfile != "" {
+		status.Message = "Weight updates are not supported for Models with a cache profile"
+		return 0
+	}
+
+	interval := time.Duration(cfg.CheckIntervalSeconds) * time.Second
+	if interval == 0 {
+		interval = defaultWeightsCheckInterval
+	}
+	if status.LastCheckTime != nil {
+		if remaining := status.LastCheckTime.Add(interval).Sub(now); remaining > 0 {
+			return remaining
+		}
+	}
+
+	var revision string
+	for _, f := range parseFlags(model.Spec.Args) {
+		if f.name == "--revision" {
+			revision = f.value
+		}
+	}
+	resolved, err := r.WeightsRevisions.Revision(ctx, model.Spec.URL, revision)
+	status.LastCheckTime = ptr.To(metav1.NewTime(now))
+	if err != nil {
+		// The Pods keep the last known revision.
+		log.FromContext(ctx).Error(err, "Failed to resolve the revision of the weights")
+		status.Message = err.Error()
+		return interval
+	}
+	status.Message = ""
+	status.Revision = resolved
+	return interval
+}
+
+// applyWeightsRevision sets the revision of the weights on the Pod of a Model
+// that restarts its Pods when the weights change. Model servers that load
+// weights from Hugging Face are pinned to the resolved commit, so that Pods
+// load the revision they are labeled with even if the branch moved on.
+func applyWeightsRevision(pod *corev1.Pod, model *kubeaiv1.Model) {
+	cfg := model.Spec.WeightUpdates
+	if cfg == nil || cfg.Policy == "" || cfg.Policy == kubeaiv1.IgnoreWeightUpdatePolicy ||
+		model.Status.Weights == nil || model.Status.Weights.Revision == "" {
+		return
+	}
+	revision := model.Status.Weights.Revision
+	k8sutils.SetLabel(pod, kubeaiv1.PodWeightsRevisionLabel, revision)
+	flag := weightsRevisionFlag(model)
+	for i := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[i]
+		if c.Name != serverContainerName {
+			continue
+		}
+		c.Env = append(c.Env, corev1.EnvVar{Name: weightsRevisionEnv, Value: revision})
+		if flag != "" {
+			c.Args = setFlag(c.Args, flag, revision)
+		}
+	}
+}
+
+// weightsRevisionFlag returns the flag of the model server that selects the
+// revision of the weights, or "" if the weights can not be pinned (i.e. the
+// revision of S3 URLs is a hash of the objects).
+func weightsRevisionFlag(model *kubeaiv1.Model) string {
+	u, err := parseModelURL(model.Spec.URL)
+	if err != nil || u.scheme != "hf" {
+		return ""
+	}
+	switch model.Spec.Engine {
+	case kubeaiv1.VLLMEngine, kubeaiv1.InfinityEngine:
+		return "--revision"
+	}
+	return ""
+}
+
+// setFlag replaces the values of a flag in args (i.e. "--revision=main" or
+// "--revision main") with a single "--flag=value".
+func setFlag(args []string, name, value string) []string {
+	out := make([]string, 0, len(args)+1)
+	for i := 0; i < len(args); i++ {
+		if args[i] == name {
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+			}
+			continue
+		}
+		if strings.HasPrefix(args[i], name+"=") {
+			continue
+		}
+		out = append(out, args[i])
+	}
+	return append(out, name+"="+value)
+}
+
+// calculateBlueGreenPodPlan calculates the Pod plan of a Model with the
+// BlueGreen weight update policy after its weights changed and updates the
+// swap revision in the status. The Pods must be sorted by deletion order.
+//
+// Pods with the new weights are created in addition to the Pods with the
+// previous weights, which keep serving the Model. Once the Model's replicas
+// of the new Pods are ready, the previous Pods are deleted at once.
+//
+// It returns false if the regular Pod plan applies instead (i.e. when the
+// out-of-date Pods have the current weights).
+func (r *ModelReconciler) calculateBlueGreenPodPlan(pods []corev1.Pod, model *kubeaiv1.Model, podForModel *corev1.Pod) (*podPlan, bool) {
+	status := model.Status.Weights
+	if status == nil {
+		return nil, false
+	}
+	if cfg := model.Spec.WeightUpdates; cfg == nil || cfg.Policy != kubeaiv1.BlueGreenWeightUpdatePolicy || status.Revision == "" {
+		status.SwapRevision = ""
+		return nil, false
+	}
+
+	expectedHash := k8sutils.GetLabel(podForModel, kubeaiv1.PodHashLabel)
+	var (
+		green, blue []corev1.Pod
+		swap        bool
+	)
+	for _, p := range pods {
+		if k8sutils.GetLabel(&p, kubeaiv1.PodHashLabel) == expectedHash {
+			green = append(green, p)
+			continue
+		}
+		blue = append(blue, p)
+		// Pods without the label were created before the policy was set.
+		if rev := k8sutils.GetLabel(&p, kubeaiv1.PodWeightsRevisionLabel); rev != "" && rev != status.Revision {
+			swap = true
+		}
+	}
+	if !swap {
+		status.SwapRevision = ""
+		return nil, false
+	}
+
+	plan := &podPlan{
+		model:       model,
+		gracePeriod: r.ModelServerPods.TerminationGracePeriod.Duration,
+	}
+	var serving []corev1.Pod
+	for _, p := range blue {
+		if prev := status.SwapRevision; prev != "" && prev != expectedHash && k8sutils.GetLabel(&p, kubeaiv1.PodHashLabel) == prev {
+			// The weights changed again during the swap.
+			plan.details = append(plan.details, fmt.Sprintf("Deleting Pod %q of an abandoned swap", p.Name))
+			plan.toDelete = append(plan.toDelete, &p)
+			continue
+		}
+		serving = append(serving, p)
+	}
+	status.SwapRevision = expectedHash
+
+	replicas := ptr.Deref(model.Spec.Replicas, 0)
+	var ready int32
+	for _, p := range green {
+		if k8sutils.PodIsReady(&p) {
+			ready++
+		}
+	}
+	if ready < replicas {
+		plan.scale(green, replicas, podForModel)
+		for i := range serving {
+			plan.toRemain = append(plan.toRemain, &serving[i])
+		}
+		return plan, true
+	}
+
+	plan.details = append(plan.details, fmt.Sprintf("Swapping %d Pods with the previous weights for %d Pods with the new weights", len(serving), ready))
+	for i := range serving {
+		plan.toDelete = append(plan.toDelete, &serving[i])
+	}
+	plan.scale(green, replicas, podForModel)
+	status.SwapRevision = ""
+	return plan, true
+}
@@ -0,0 +1,205 @@
+package modelcontroller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "github.com/substratusai/kubeai/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+type fakeWeightsRevisions struct {
+	revision string
+	err      error
+	calls    []string
+}
+
+func (f *fakeWeightsRevisions) Revision(_ context.Context, url, revision string) (string, error) {
+	f.calls = append(f.calls, url+"@"+revision)
+	return f.revision, f.err
+}
+
+func Test_reconcileWeightsRevision(t *testing.T) {
+	ctx := context.Background()
+	resolver := &fakeWeightsRevisions{revision: "abc"}
+	r := &ModelReconciler{WeightsRevisions: resolver}
+	now := time.Now()
+	model := &v1.Model{Spec: v1.ModelSpec{
+		URL:           "hf://org/model",
+		Engine:        v1.VLLMEngine,
+		Args:          []string{"--revision", "v2"},
+		WeightUpdates: &v1.ModelWeightUpdates{Policy: v1.RollingRestartWeightUpdatePolicy, CheckIntervalSeconds: 600},
+	}}
+
+	require.Equal(t, 10*time.Minute, r.reconcileWeightsRevision(ctx, model, now))
+	require.Equal(t, "abc", model.Status.Weights.Revision)
+	require.Equal(t, []string{"hf://org/model@v2"}, resolver.calls)
+
+	// Not resolved again until the check interval passed.
+	require.Equal(t, 5*time.Minute, r.reconcileWeightsRevision(ctx, model, now.Add(5*time.Minute)))
+	require.Len(t, resolver.calls, 1)
+
+	// The last known revision is kept on errors.
+	resolver.err = errors.New("unavailable")
+	r.reconcileWeightsRevision(ctx, model, now.Add(10*time.Minute))
+	require.Equal(t, "abc", model.Status.Weights.Revision)
+	require.Equal(t, "unavailable", model.Status.Weights.Message)
+
+	serverPod := func() *corev1.Pod {
+		return &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: serverContainerName,
+			Args: []string{"--model=org/model", "--revision", "v2", "--served-model-name=model"},
+		}}}}
+	}
+	pod := serverPod()
+	applyWeightsRevision(pod, model)
+	require.Equal(t, "abc", pod.Labels[v1.PodWeightsRevisionLabel])
+	require.Equal(t, []corev1.EnvVar{{Name: weightsRevisionEnv, Value: "abc"}}, pod.Spec.Containers[0].Env)
+	// The model server loads the resolved commit.
+	require.Equal(t, []string{"--model=org/model", "--served-model-name=model", "--revision=abc"}, pod.Spec.Containers[0].Args)
+
+	// Engines without a revision flag only get the env var.
+	model.Spec.Engine = v1.OLlamaEngine
+	pod = serverPod()
+	applyWeightsRevision(pod, model)
+	require.Equal(t, []string{"--model=org/model", "--revision", "v2", "--served-model-name=model"}, pod.Spec.Containers[0].Args)
+	model.Spec.Engine = v1.VLLMEngine
+
+	// Pods are not restarted with the Ignore policy.
+	model.Spec.WeightUpdates.Policy = v1.IgnoreWeightUpdatePolicy
+	pod = serverPod()
+	applyWeightsRevision(pod, model)
+	require.Empty(t, pod.Labels)
+	require.Empty(t, pod.Spec.Containers[0].Env)
+	require.Equal(t, serverPod().Spec.Containers[0].Args, pod.Spec.Containers[0].Args)
+
+	model.Spec.WeightUpdates = nil
+	r.reconcileWeightsRevision(ctx, model, now)
+	require.Nil(t, model.Status.Weights)
+}
+
+func Test_calculateBlueGreenPodPlan(t *testing.T) {
+	r := &ModelReconciler{}
+
+	testPod := func(name, hash, revision string, ready bool) corev1.Pod {
+		p := corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{v1.PodHashLabel: hash, v1.PodWeightsRevisionLabel: revision},
+		}}
+		if ready {
+			p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		}
+		return p
+	}
+	podForModel := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		GenerateName: "model-test-mdl-new-",
+		Labels:       map[string]string{v1.PodHashLabel: "new", v1.PodWeightsRevisionLabel: "rev2"},
+	}}
+
+	cases := []struct {
+		name             string
+		policy           v1.WeightUpdatePolicy
+		swapRevision     string
+		pods             []corev1.Pod
+		wantHandled      bool
+		wantSwapRevision string
+		wantCreations    int
+		wantDeletions    []string
+	}{
+		{
+			name:   "up to date",
+			policy: v1.BlueGreenWeightUpdatePolicy,
+			pods:   []corev1.Pod{testPod("new-1", "new", "rev2", true)},
+		},
+		{
+			name:   "rolling restart",
+			policy: v1.RollingRestartWeightUpdatePolicy,
+			pods:   []corev1.Pod{testPod("old-1", "old", "rev1", true)},
+		},
+		{
+			name:   "spec change",
+			policy: v1.BlueGreenWeightUpdatePolicy,
+			pods:   []corev1.Pod{testPod("old-1", "old", "rev2", true)},
+		},
+		{
+			name:   "start swap",
+			policy: v1.BlueGreenWeightUpdatePolicy,
+			pods: []corev1.Pod{
+				testPod("old-1", "old", "rev1", true),
+				testPod("old-2", "old", "rev1", true),
+			},
+			wantHandled:      true,
+			wantSwapRevision: "new",
+			wantCreations:    2,
+		},
+		{
+			name:         "wait for new pods",
+			policy:       v1.BlueGreenWeightUpdatePolicy,
+			swapRevision: "new",
+			pods: []corev1.Pod{
+				testPod("new-1", "new", "rev2", true),
+				testPod("new-2", "new", "rev2", false),
+				testPod("old-1", "old", "rev1", true),
+				testPod("old-2", "old", "rev1", true),
+			},
+			wantHandled:      true,
+			wantSwapRevision: "new",
+		},
+		{
+			name:         "swap",
+			policy:       v1.BlueGreenWeightUpdatePolicy,
+			swapRevision: "new",
+			pods: []corev1.Pod{
+				testPod("new-1", "new", "rev2", true),
+				testPod("new-2", "new", "rev2", true),
+				testPod("old-1", "old", "rev1", true),
+				testPod("old-2", "old", "rev1", true),
+			},
+			wantHandled:   true,
+			wantDeletions: []string{"old-1", "old-2"},
+		},
+		{
+			name:         "weights changed during swap",
+			policy:       v1.BlueGreenWeightUpdatePolicy,
+			swapRevision: "abandoned",
+			pods: []corev1.Pod{
+				testPod("abandoned-1", "abandoned", "rev1.5", false),
+				testPod("old-1", "old", "rev1", true),
+				testPod("old-2", "old", "rev1", true),
+			},
+			wantHandled:      true,
+			wantSwapRevision: "new",
+			wantCreations:    2,
+			wantDeletions:    []string{"abandoned-1"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			model := &v1.Model{
+				Spec: v1.ModelSpec{
+					Replicas:      ptr.To[int32](2),
+					WeightUpdates: &v1.ModelWeightUpdates{Policy: c.policy},
+				},
+				Status: v1.ModelStatus{Weights: &v1.ModelStatusWeights{Revision: "rev2", SwapRevision: c.swapRevision}},
+			}
+			plan, handled := r.calculateBlueGreenPodPlan(c.pods, model, podForModel)
+			require.Equal(t, c.wantHandled, handled)
+			require.Equal(t, c.wantSwapRevision, model.Status.Weights.SwapRevision)
+			if !handled {
+				return
+			}
+			require.Len(t, plan.toCreate, c.wantCreations)
+			var deletions []string
+			for _, p := range plan.toDelete {
+				deletions = append(deletions, p.Name)
+			}
+			require.Equal(t, c.wantDeletions, deletions)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Package modelnamespaces decides which Model is served under a name when
+// KubeAI serves Models from multiple namespaces. The first namespace is
+// KubeAI's own: its Models are served by name and by alias before any
+// other Model. Models in the other (team) namespaces are only served by
+// name, and if Models in multiple team namespaces have the same name, the
+// oldest one is served. The other Models are shadowed. A team can
+// therefore neither take over the name of another team's Model nor claim
+// names with aliases.
+package modelnamespaces
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Served returns the Model that is served under a name, which is either the
+// name or an alias of the Model (nil if there is none).
+func Served(ctx context.Context, c client.Reader, namespaces []string, name string) (*kubeaiv1.Model, error) {
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+	m, err := get(ctx, c, namespaces[0], name)
+	if err != nil || m != nil {
+		return m, err
+	}
+	var list kubeaiv1.ModelList
+	if err := c.List(ctx, &list, client.InNamespace(namespaces[0])); err != nil {
+		return nil, fmt.Errorf("list models: %w", err)
+	}
+	var served *kubeaiv1.Model
+	for i := range list.Items {
+		candidate := &list.Items[i]
+		if slices.Contains(candidate.Spec.Aliases, name) && (served == nil || Older(candidate, served)) {
+			served = candidate
+		}
+	}
+	if served != nil {
+		return served, nil
+	}
+
+	for _, ns := range namespaces[1:] {
+		m, err := get(ctx, c, ns, name)
+		if err != nil {
+			return nil, err
+		}
+		// Models that were created in the same second are ordered by
+		// namespace.
+		if m != nil && (served == nil || m.CreationTimestamp.Before(&served.CreationTimestamp)) {
+			served = m
+		}
+	}
+	return served, nil
+}
+
+// Shadowing returns the Model that is served under the name of the given
+// Model instead of it (nil if the Model is served).
+func Shadowing(ctx context.Context, c client.Reader, namespaces []string, model types.NamespacedName) (*kubeaiv1.Model, error) {
+	served, err := Served(ctx, c, namespaces, model.Name)
+	if err != nil {
+		return nil, err
+	}
+	if served == nil || (served.Namespace == model.Namespace && served.Name == model.Name) {
+		return nil, nil
+	}
+	return served, nil
+}
+
+// ServedModels returns the Models of all namespaces that are not shadowed.
+func ServedModels(ctx context.Context, c client.Reader, namespaces []string) ([]kubeaiv1.Model, error) {
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+	var models []kubeaiv1.Model
+	// Names of KubeAI's namespace and the oldest Model with each name of
+	// the team namespaces.
+	names := map[string]struct{}{}
+	byName := map[string]int{}
+	for i, ns := range namespaces {
+		list := &kubeaiv1.ModelList{}
+		if err := c.List(ctx, list, client.InNamespace(ns)); err != nil {
+			return nil, fmt.Errorf("list models: %w", err)
+		}
+		if i == 0 {
+			models = list.Items
+			for _, m := range list.Items {
+				names[m.Name] = struct{}{}
+				for _, alias := range m.Spec.Aliases {
+					names[alias] = struct{}{}
+				}
+			}
+			continue
+		}
+		for _, m := range list.Items {
+			if _, ok := names[m.Name]; ok {
+				continue
+			}
+			if j, ok := byName[m.Name]; ok {
+				if m.CreationTimestamp.Before(&models[j].CreationTimestamp) {
+					models[j] = m
+				}
+				continue
+			}
+			byName[m.Name] = len(models)
+			models = append(models, m)
+		}
+	}
+	return models, nil
+}
+
+// Older returns true if Model a was created before Model b. Models that
+// were created in the same second are ordered by name.
+func Older(a, b *kubeaiv1.Model) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+// SameNameRequests returns a handler.MapFunc that maps a Model to requests
+// for the Models in the other namespaces that it could shadow (with the
+// same name or, for Models in KubeAI's namespace, named like one of its
+// aliases), so that a shadowed Model is served once the Model that shadows
+// it is deleted.
+func SameNameRequests(namespaces []string) handler.MapFunc {
+	return func(_ context.Context, obj client.Object) []reconcile.Request {
+		names := []string{obj.GetName()}
+		if m, ok := obj.(*kubeaiv1.Model); ok && len(namespaces) > 0 && m.Namespace == namespaces[0] {
+			names = append(names, m.Spec.Aliases...)
+		}
+		var reqs []reconcile.Request
+		for _, ns := range namespaces {
+			if ns == obj.GetNamespace() {
+				continue
+			}
+			for _, name := range names {
+				reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: ns, Name: name}})
+			}
+		}
+		return reqs
+	}
+}
+
+func get(ctx context.Context, c client.Reader, namespace, name string) (*kubeaiv1.Model, error) {
+	m := &kubeaiv1.Model{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, m); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m, nil
+}
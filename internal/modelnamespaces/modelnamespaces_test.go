@@ -0,0 +1,101 @@
+package modelnamespaces
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestShadowing(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kubeaiv1.AddToScheme(scheme))
+	t0 := metav1.Now()
+	model := func(namespace, name string, created metav1.Time, aliases ...string) *kubeaiv1.Model {
+		return &kubeaiv1.Model{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, CreationTimestamp: created},
+			Spec:       kubeaiv1.ModelSpec{Aliases: aliases},
+		}
+	}
+	later := metav1.NewTime(t0.Add(time.Hour))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		model("kubeai", "llama", later, "gpt-4o"),
+		model("team-a", "llama", t0),
+		model("team-a", "qwen", later),
+		model("team-b", "qwen", t0),
+		model("team-a", "gemma", t0),
+		model("team-b", "gemma", t0),
+		model("team-b", "gpt-4o", t0),
+		model("team-a", "mistral", t0, "phi"),
+		model("team-b", "phi", later),
+	).Build()
+	namespaces := []string{"kubeai", "team-a", "team-b"}
+	ctx := context.Background()
+
+	cases := []struct {
+		namespace, name string
+		wantShadowedBy  string
+	}{
+		// Models of KubeAI's namespace take precedence by name and by alias.
+		{namespace: "kubeai", name: "llama"},
+		{namespace: "team-a", name: "llama", wantShadowedBy: "kubeai/llama"},
+		{namespace: "team-b", name: "gpt-4o", wantShadowedBy: "kubeai/llama"},
+		// A team can not take over the name of an older Model of another team.
+		{namespace: "team-a", name: "qwen", wantShadowedBy: "team-b/qwen"},
+		{namespace: "team-b", name: "qwen"},
+		// Models that were created at the same time are ordered by namespace.
+		{namespace: "team-a", name: "gemma"},
+		{namespace: "team-b", name: "gemma", wantShadowedBy: "team-a/gemma"},
+		// Aliases of Models in team namespaces are ignored.
+		{namespace: "team-b", name: "phi"},
+	}
+	for _, tc := range cases {
+		m, err := Shadowing(ctx, c, namespaces, types.NamespacedName{Namespace: tc.namespace, Name: tc.name})
+		require.NoError(t, err)
+		if tc.wantShadowedBy == "" {
+			require.Nil(t, m, "%s/%s", tc.namespace, tc.name)
+			continue
+		}
+		require.NotNil(t, m, "%s/%s", tc.namespace, tc.name)
+		require.Equal(t, tc.wantShadowedBy, m.Namespace+"/"+m.Name)
+	}
+
+	models, err := ServedModels(ctx, c, namespaces)
+	require.NoError(t, err)
+	var served []string
+	for _, m := range models {
+		served = append(served, m.Namespace+"/"+m.Name)
+	}
+	require.ElementsMatch(t, []string{"kubeai/llama", "team-b/qwen", "team-a/gemma", "team-a/mistral", "team-b/phi"}, served)
+
+	m, err := Served(ctx, c, namespaces, "phi")
+	require.NoError(t, err)
+	require.Equal(t, "team-b/phi", m.Namespace+"/"+m.Name)
+	m, err = Served(ctx, c, namespaces, "unknown")
+	require.NoError(t, err)
+	require.Nil(t, m)
+}
+
+func TestSameNameRequests(t *testing.T) {
+	reqs := SameNameRequests([]string{"kubeai", "team-a", "team-b"})(context.Background(),
+		&kubeaiv1.Model{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "llama"}, Spec: kubeaiv1.ModelSpec{Aliases: []string{"ignored"}}})
+	require.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "kubeai", Name: "llama"}},
+		{NamespacedName: types.NamespacedName{Namespace: "team-b", Name: "llama"}},
+	}, reqs)
+
+	// Models of KubeAI's namespace shadow Models that are named like their aliases.
+	reqs = SameNameRequests([]string{"kubeai", "team-a"})(context.Background(),
+		&kubeaiv1.Model{ObjectMeta: metav1.ObjectMeta{Namespace: "kubeai", Name: "llama"}, Spec: kubeaiv1.ModelSpec{Aliases: []string{"gpt-4o"}}})
+	require.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "llama"}},
+		{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "gpt-4o"}},
+	}, reqs)
+}
@@ -0,0 +1,92 @@
+package modelproxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// coldStartHistorySize is the number of recent cold starts per Model that
+// the estimated cold start time is based on.
+const coldStartHistorySize = 10
+
+// coldStarts tracks how long it took for Models without ready replicas to
+// serve the first parked request.
+type coldStarts struct {
+	mtx sync.Mutex
+	// map[<model-name>]<time-when-the-first-request-was-parked>
+	parked map[string]time.Time
+	// map[<model-name>]<recent-cold-start-durations>
+	history map[string][]time.Duration
+	// unreported are the Models that completed a cold start while their
+	// status did not report ready replicas yet. Requests are not parked for
+	// them until it does, otherwise the same cold start would complete again.
+	unreported map[string]bool
+}
+
+func newColdStarts() *coldStarts {
+	return &coldStarts{
+		parked:     map[string]time.Time{},
+		history:    map[string][]time.Duration{},
+		unreported: map[string]bool{},
+	}
+}
+
+// park records that a request is waiting for a Model without ready replicas.
+// The cold start is measured from the first parked request.
+func (c *coldStarts) park(model string, now time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.unreported[model] {
+		return
+	}
+	if _, ok := c.parked[model]; !ok {
+		c.parked[model] = now
+	}
+}
+
+// ready records that the Model is serving requests, completing a cold
+// start if requests were parked. reported is true if the status of the Model
+// reports ready replicas. It returns the duration of the completed cold
+// start (if any).
+func (c *coldStarts) ready(model string, now time.Time, reported bool) (time.Duration, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if reported {
+		delete(c.unreported, model)
+	}
+	start, ok := c.parked[model]
+	if !ok {
+		return 0, false
+	}
+	delete(c.parked, model)
+	if !reported {
+		c.unreported[model] = true
+	}
+	h := append(c.history[model], now.Sub(start))
+	if len(h) > coldStartHistorySize {
+		h = h[len(h)-coldStartHistorySize:]
+	}
+	c.history[model] = h
+	return now.Sub(start), true
+}
+
+// retryAfter returns how long a client should wait before retrying a parked
+// request: the median of the recent cold starts minus the time that the
+// current cold start has been in progress (at least one second).
+// The fallback is returned if there is no history for the Model.
+func (c *coldStarts) retryAfter(model string, now time.Time, fallback time.Duration) time.Duration {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	h := c.history[model]
+	if len(h) == 0 {
+		return max(fallback, time.Second)
+	}
+	sorted := append([]time.Duration(nil), h...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	remaining := sorted[len(sorted)/2]
+	if start, ok := c.parked[model]; ok {
+		remaining -= now.Sub(start)
+	}
+	return max(remaining, time.Second)
+}
@@ -0,0 +1,53 @@
+package modelproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestColdStarts(t *testing.T) {
+	c := newColdStarts()
+	t0 := time.Now()
+
+	require.Equal(t, 5*time.Second, c.retryAfter("m", t0, 5*time.Second), "no history should fall back")
+	require.Equal(t, time.Second, c.retryAfter("m", t0, 0), "retry after should be at least one second")
+
+	// Not parked.
+	c.ready("m", t0, true)
+	require.Empty(t, c.history["m"])
+
+	// The cold start is measured from the first parked request.
+	c.park("m", t0)
+	c.park("m", t0.Add(10*time.Second))
+	d, ok := c.ready("m", t0.Add(60*time.Second), false)
+	require.True(t, ok)
+	require.Equal(t, 60*time.Second, d)
+	_, ok = c.ready("m", t0.Add(70*time.Second), false)
+	require.False(t, ok, "the cold start should only complete once")
+	// Requests are not parked again until the status of the Model reports
+	// ready replicas.
+	c.park("m", t0.Add(80*time.Second))
+	_, ok = c.ready("m", t0.Add(90*time.Second), false)
+	require.False(t, ok, "the cold start should only complete once")
+	c.ready("m", t0.Add(100*time.Second), true)
+	require.Equal(t, []time.Duration{60 * time.Second}, c.history["m"])
+
+	c.park("m", t0)
+	c.ready("m", t0.Add(20*time.Second), true)
+	c.park("m", t0)
+	c.ready("m", t0.Add(30*time.Second), true)
+	require.Equal(t, 30*time.Second, c.retryAfter("m", t0, 5*time.Second), "median of recent cold starts")
+
+	// Time already spent in the current cold start is subtracted.
+	c.park("m", t0)
+	require.Equal(t, 10*time.Second, c.retryAfter("m", t0.Add(20*time.Second), 5*time.Second))
+	require.Equal(t, time.Second, c.retryAfter("m", t0.Add(time.Minute), 5*time.Second))
+
+	for i := range 2 * coldStartHistorySize {
+		c.park("m", t0)
+		c.ready("m", t0.Add(time.Duration(i)*time.Second), true)
+	}
+	require.Len(t, c.history["m"], coldStartHistorySize)
+}
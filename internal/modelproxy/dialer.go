@@ -0,0 +1,114 @@
+package modelproxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/substratusai/kubeai/internal/config"
+)
+
+// newTransport returns the transport that requests are proxied to model
+// servers with.
+func newTransport(cfg config.ModelProxyDialer) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = newDialer(cfg).DialContext
+	t.IdleConnTimeout = cfg.IdleConnTimeout.Duration
+	return t
+}
+
+// dialer dials model server endpoints.
+//
+// Endpoints are usually Pod IPs which are dialed directly. The addresses of
+// endpoint hostnames (i.e. external endpoints) are cached, so that DNS is
+// not queried for every new connection, and are dialed one at a time
+// instead of racing IPv4 and IPv6 connections ("happy eyeballs"), which
+// leaves a half-open connection in conntrack for each lost race.
+type dialer struct {
+	dialer *net.Dialer
+	ttl    time.Duration
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mtx   sync.Mutex
+	cache map[string]cachedAddrs
+}
+
+type cachedAddrs struct {
+	addrs   []net.IPAddr
+	expires time.Time
+}
+
+func newDialer(cfg config.ModelProxyDialer) *dialer {
+	return &dialer{
+		dialer: &net.Dialer{
+			Timeout:   cfg.ConnectTimeout.Duration,
+			KeepAlive: cfg.KeepAlive.Duration,
+			// Disable happy eyeballs, addresses are dialed one at a time.
+			FallbackDelay: -1,
+		},
+		ttl:    cfg.AddressCacheTTL.Duration,
+		lookup: net.DefaultResolver.LookupIPAddr,
+		cache:  map[string]cachedAddrs{},
+	}
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	// The addresses of the host might have changed.
+	d.forget(host)
+	return nil, firstErr
+}
+
+// resolve returns the IP addresses of a hostname from the cache or DNS.
+func (d *dialer) resolve(ctx context.Context, host string) ([]net.IPAddr, error) {
+	now := time.Now()
+	d.mtx.Lock()
+	cached, ok := d.cache[host]
+	d.mtx.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	if d.ttl > 0 {
+		d.mtx.Lock()
+		d.cache[host] = cachedAddrs{addrs: addrs, expires: now.Add(d.ttl)}
+		d.mtx.Unlock()
+	}
+	return addrs, nil
+}
+
+func (d *dialer) forget(host string) {
+	d.mtx.Lock()
+	delete(d.cache, host)
+	d.mtx.Unlock()
+}
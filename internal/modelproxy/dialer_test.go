@@ -0,0 +1,81 @@
+package modelproxy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+)
+
+func TestDialer(t *testing.T) {
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+
+	d := newDialer(config.ModelProxyDialer{
+		ConnectTimeout:  config.Duration{Duration: time.Second},
+		AddressCacheTTL: config.Duration{Duration: time.Minute},
+	})
+	var lookups int
+	addrs := []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}
+	d.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups++
+		require.Equal(t, "model-server.example", host)
+		return addrs, nil
+	}
+
+	dial := func(t *testing.T, address string) {
+		t.Helper()
+		conn, err := d.DialContext(ctx, "tcp", address)
+		require.NoError(t, err)
+		conn.Close()
+	}
+
+	t.Run("ip is not resolved", func(t *testing.T) {
+		dial(t, ln.Addr().String())
+		require.Equal(t, 0, lookups)
+	})
+
+	t.Run("hostname is resolved once", func(t *testing.T) {
+		dial(t, net.JoinHostPort("model-server.example", port))
+		dial(t, net.JoinHostPort("model-server.example", port))
+		require.Equal(t, 1, lookups)
+	})
+
+	t.Run("addresses are dialed in order", func(t *testing.T) {
+		d.forget("model-server.example")
+		lookups = 0
+		// Nothing listens on 127.0.0.2.
+		addrs = []net.IPAddr{{IP: net.ParseIP("127.0.0.2")}, {IP: net.ParseIP("127.0.0.1")}}
+		dial(t, net.JoinHostPort("model-server.example", port))
+		require.Equal(t, 1, lookups)
+	})
+
+	t.Run("failed dial forgets addresses", func(t *testing.T) {
+		d.forget("model-server.example")
+		lookups = 0
+		addrs = []net.IPAddr{{IP: net.ParseIP("127.0.0.2")}}
+		_, err := d.DialContext(ctx, "tcp", net.JoinHostPort("model-server.example", port))
+		require.Error(t, err)
+
+		addrs = []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}
+		dial(t, net.JoinHostPort("model-server.example", port))
+		require.Equal(t, 2, lookups)
+	})
+}
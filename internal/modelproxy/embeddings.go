@@ -0,0 +1,218 @@
+package modelproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/endpoints"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// embeddingCoalescer coalesces embeddings requests for the same model (with
+// the same parameters) into batches that are sent to a model server in one
+// request. A batch is sent when it has maxBatchSize inputs or maxLatency
+// after its first request was added.
+type embeddingCoalescer struct {
+	maxBatchSize int
+	maxLatency   time.Duration
+
+	mtx sync.Mutex
+	// pending are the batches that were not sent yet by key
+	// (see embeddingKey()).
+	pending map[string]*embeddingBatch
+}
+
+func newEmbeddingCoalescer(cfg *config.ModelProxyEmbeddingCoalescing) *embeddingCoalescer {
+	return &embeddingCoalescer{
+		maxBatchSize: cfg.MaxBatchSize,
+		maxLatency:   cfg.MaxLatency.Duration,
+		pending:      map[string]*embeddingBatch{},
+	}
+}
+
+type embeddingBatch struct {
+	key    string
+	reqs   []*coalescedEmbedding
+	inputs int
+	timer  *time.Timer
+}
+
+// coalescedEmbedding is a request in a batch. The result of the batch
+// is sent to done.
+type coalescedEmbedding struct {
+	pr     *proxyRequest
+	inputs []any
+	done   chan coalescedResult
+}
+
+// coalescedResult is the part of the response to a batch of a request.
+type coalescedResult struct {
+	// proxy is true if the request was not coalesced with other requests
+	// and should be proxied as is.
+	proxy  bool
+	header http.Header
+	status int
+	body   []byte
+	// err is set if the response to the batch could not be split.
+	err error
+	// gpuSeconds is the share of the GPU time of the batch.
+	gpuSeconds float64
+}
+
+// add adds a request to the pending batch of its key. The send function is
+// called (in a new goroutine) with each batch that is ready to be sent.
+func (c *embeddingCoalescer) add(key string, e *coalescedEmbedding, send func(*embeddingBatch)) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	b, ok := c.pending[key]
+	if ok && b.inputs+len(e.inputs) > c.maxBatchSize {
+		// The request does not fit into the pending batch.
+		c.take(b)
+		go send(b)
+		ok = false
+	}
+	if !ok {
+		b = &embeddingBatch{key: key}
+		b.timer = time.AfterFunc(c.maxLatency, func() {
+			c.mtx.Lock()
+			defer c.mtx.Unlock()
+			if c.take(b) {
+				go send(b)
+			}
+		})
+		c.pending[key] = b
+	}
+	b.reqs = append(b.reqs, e)
+	b.inputs += len(e.inputs)
+	if b.inputs >= c.maxBatchSize {
+		c.take(b)
+		go send(b)
+	}
+}
+
+// take removes a pending batch. It returns false if the batch was
+// already removed. Must be called with the lock held.
+func (c *embeddingCoalescer) take(b *embeddingBatch) bool {
+	if c.pending[b.key] != b {
+		return false
+	}
+	delete(c.pending, b.key)
+	b.timer.Stop()
+	return true
+}
+
+// proxyCoalesced is like proxyHTTP() but coalesces embeddings requests with
+// other requests if embedding coalescing is enabled.
+func (h *Handler) proxyCoalesced(w http.ResponseWriter, pr *proxyRequest) {
+	// Requests in the dialect of a model server are not OpenAI requests.
+	if h.embeddings == nil || pr.r.URL.Path != apiutils.EmbeddingsPath || pr.dialect != nil {
+		h.proxyHTTP(w, pr)
+		return
+	}
+	inputs, ok := apiutils.EmbeddingInputs(pr.params)
+	if !ok {
+		h.proxyHTTP(w, pr)
+		return
+	}
+
+	e := &coalescedEmbedding{pr: pr, inputs: inputs, done: make(chan coalescedResult, 1)}
+	h.embeddings.add(embeddingKey(pr), e, h.sendEmbeddingBatch)
+	var res coalescedResult
+	select {
+	case res = <-e.done:
+	case <-pr.r.Context().Done():
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "request cancelled while coalescing: %v", pr.r.Context().Err())
+		return
+	}
+	if res.proxy {
+		h.proxyHTTP(w, pr)
+		return
+	}
+	pr.coalescedGPUSeconds = res.gpuSeconds
+	if res.err != nil {
+		pr.sendErrorResponse(w, http.StatusBadGateway, "splitting coalesced response: %v", res.err)
+		return
+	}
+	pr.sendBufferedResponse(w, res.header, res.status, res.body)
+}
+
+// embeddingKey returns the key of the requests that a request can be
+// coalesced with: requests for the same model with the same parameters
+// (except the input) and credentials.
+func embeddingKey(pr *proxyRequest) string {
+	params := maps.Clone(pr.params)
+	delete(params, "input")
+	// Map keys are sorted when encoded.
+	paramsKey, _ := json.Marshal(params)
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s", pr.model, pr.adapter, paramsKey, pr.r.Header.Get("Authorization"))
+}
+
+// sendEmbeddingBatch sends the inputs of a batch to a model server in one
+// request and sends the part of the response of each request to the request.
+// The request is sent with the headers of the first request of the batch.
+func (h *Handler) sendEmbeddingBatch(b *embeddingBatch) {
+	first := b.reqs[0].pr
+	metrics.InferenceCoalescedEmbeddings.Record(first.r.Context(), int64(len(b.reqs)),
+		metric.WithAttributes(metrics.AttrRequestModel.String(apiutils.MergeModelAdapter(first.model, first.adapter))))
+
+	if len(b.reqs) == 1 {
+		b.reqs[0].done <- coalescedResult{proxy: true}
+		return
+	}
+
+	counts := make([]int, len(b.reqs))
+	var inputs []any
+	for i, e := range b.reqs {
+		inputs = append(inputs, e.inputs...)
+		counts[i] = len(e.inputs)
+	}
+	params := maps.Clone(first.params)
+	params["input"] = inputs
+
+	// The batch is not cancelled along with the first request.
+	ctx := endpoints.WithUsage(endpoints.WithRetryTargeting(context.WithoutCancel(first.r.Context())))
+	send := func(res coalescedResult) {
+		for _, e := range b.reqs {
+			e.done <- res
+		}
+	}
+	batch, err := first.subRequest(ctx, params)
+	if err != nil {
+		send(coalescedResult{err: err})
+		return
+	}
+
+	rec := newResponseBuffer()
+	h.proxyHTTP(rec, batch)
+	gpuSeconds := endpoints.GPUSeconds(ctx)
+
+	mediaType, _, _ := mime.ParseMediaType(rec.header.Get("Content-Type"))
+	if rec.status < 200 || rec.status >= 300 || mediaType != "application/json" {
+		// Every request gets the (error) response.
+		send(coalescedResult{header: rec.header, status: rec.status, body: rec.body, gpuSeconds: gpuSeconds / float64(len(b.reqs))})
+		return
+	}
+	bodies, err := apiutils.SplitEmbeddingResponse(rec.body, counts)
+	if err != nil {
+		send(coalescedResult{err: err})
+		return
+	}
+	for i, e := range b.reqs {
+		e.done <- coalescedResult{
+			header:     rec.header,
+			status:     rec.status,
+			body:       bodies[i],
+			gpuSeconds: gpuSeconds * float64(counts[i]) / float64(len(inputs)),
+		}
+	}
+}
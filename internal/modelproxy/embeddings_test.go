@@ -0,0 +1,103 @@
+package modelproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+)
+
+func TestHandlerEmbeddingCoalescing(t *testing.T) {
+	var backendRequests atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendRequests.Add(1)
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// The embeddings are returned in reverse order.
+		var data []string
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, fmt.Sprintf(`{"object":"embedding","index":%d,"embedding":[%d]}`, i, len(req.Input[i])))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"object":"list","model":"test-model","data":[%s],"usage":{"prompt_tokens":%d,"total_tokens":%d}}`,
+			strings.Join(data, ","), 10*len(req.Input), 10*len(req.Input))
+	}))
+	defer backend.Close()
+
+	models := &testModelInterface{models: map[string]testMockModel{"test-model": {}}}
+	h := NewHandler(models, staticResolver(backend.Listener.Addr().String()), 3, nil, config.ModelProxy{
+		StreamBufferSize: 64,
+		SlowClientPolicy: config.SlowClientPolicyBlock,
+		EmbeddingCoalescing: &config.ModelProxyEmbeddingCoalescing{
+			MaxBatchSize: 4,
+			MaxLatency:   config.Duration{Duration: time.Minute},
+		},
+	})
+	embed := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(body)))
+		return w
+	}
+
+	// The batch is sent once it has 4 inputs.
+	inputs := []string{`"a"`, `["bb","ccc"]`, `"dddd"`}
+	bodies := make([]string, len(inputs))
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := embed(`{"model":"test-model","input":` + input + `}`)
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			bodies[i] = w.Body.String()
+		}()
+	}
+	wg.Wait()
+
+	require.EqualValues(t, 1, backendRequests.Load())
+	require.JSONEq(t, `{"object":"list","model":"test-model","data":[{"object":"embedding","index":0,"embedding":[1]}],"usage":{"prompt_tokens":10,"total_tokens":10}}`, bodies[0])
+	require.JSONEq(t, `{"object":"list","model":"test-model","data":[{"object":"embedding","index":0,"embedding":[2]},{"object":"embedding","index":1,"embedding":[3]}],"usage":{"prompt_tokens":20,"total_tokens":20}}`, bodies[1])
+	require.JSONEq(t, `{"object":"list","model":"test-model","data":[{"object":"embedding","index":0,"embedding":[4]}],"usage":{"prompt_tokens":10,"total_tokens":10}}`, bodies[2])
+
+	// Requests with different parameters are not coalesced and a batch
+	// is sent after the maximum latency (requests that are not coalesced
+	// are proxied as is).
+	h.embeddings.maxLatency = 10 * time.Millisecond
+	for _, dims := range []string{"1", "2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := embed(`{"model":"test-model","input":["a"],"dimensions":` + dims + `}`)
+			require.Equal(t, http.StatusOK, w.Code)
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 3, backendRequests.Load())
+
+	// Token inputs are not coalesced.
+	w := embed(`{"model":"test-model","input":[[1,2,3]]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.EqualValues(t, 4, backendRequests.Load())
+}
+
+// staticResolver resolves all models to its address.
+type staticResolver string
+
+func (r staticResolver) AwaitBestAddress(context.Context, string, string) (string, func(), error) {
+	return string(r), func() {}, nil
+}
@@ -0,0 +1,34 @@
+package modelproxy
+
+import (
+	"io"
+
+	"github.com/substratusai/kubeai/internal/anthropicapi"
+	"github.com/substratusai/kubeai/internal/responsesapi"
+)
+
+// frontend is an API that is served with chat completion requests, for model
+// servers that only implement the chat completions API.
+type frontend struct {
+	chatCompletionParams func(params map[string]any) (map[string]any, error)
+	fromChatCompletion   func(params map[string]any, body []byte) ([]byte, error)
+	newStream            func(params map[string]any, chat io.ReadCloser) io.ReadCloser
+	// errorBody returns the body of the error responses of the API.
+	// Error responses have the format of the OpenAI API if it is nil.
+	errorBody func(status int, msg string) any
+}
+
+// frontends are the APIs that are served with chat completions by path.
+var frontends = map[string]*frontend{
+	responsesapi.Path: {
+		chatCompletionParams: responsesapi.ChatCompletionParams,
+		fromChatCompletion:   responsesapi.FromChatCompletion,
+		newStream:            responsesapi.NewStream,
+	},
+	anthropicapi.MessagesPath: {
+		chatCompletionParams: anthropicapi.ChatCompletionParams,
+		fromChatCompletion:   anthropicapi.FromChatCompletion,
+		newStream:            anthropicapi.NewStream,
+		errorBody:            anthropicapi.ErrorBody,
+	},
+}
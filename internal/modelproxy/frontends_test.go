@@ -0,0 +1,148 @@
+package modelproxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+)
+
+func TestHandlerResponses(t *testing.T) {
+	models := &testModelInterface{models: map[string]testMockModel{
+		"llm": {engine: kubeaiv1.EchoEngine},
+	}}
+	h := NewHandler(models, blockingResolver{}, 3, nil, config.ModelProxy{
+		StreamBufferSize: 64,
+		SlowClientPolicy: config.SlowClientPolicyBlock,
+	})
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"model":"llm","instructions":"Be brief.","input":"hello world"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		ID     string `json:"id"`
+		Object string `json:"object"`
+		Status string `json:"status"`
+		Output []struct {
+			Type    string `json:"type"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+		Usage struct {
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.True(t, strings.HasPrefix(resp.ID, "resp_"), resp.ID)
+	require.Equal(t, "response", resp.Object)
+	require.Equal(t, "completed", resp.Status)
+	require.Len(t, resp.Output, 1)
+	require.Equal(t, "message", resp.Output[0].Type)
+	require.Equal(t, "output_text", resp.Output[0].Content[0].Type)
+	require.Equal(t, "hello world", resp.Output[0].Content[0].Text)
+	require.Positive(t, resp.Usage.OutputTokens)
+
+	w = post(`{"model":"llm","input":[{"role":"user","content":[{"type":"input_text","text":"one two three"}]}],"stream":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var (
+		types []string
+		text  string
+		last  map[string]any
+	)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+		require.EqualValues(t, len(types), event["sequence_number"])
+		types = append(types, event["type"].(string))
+		if event["type"] == "response.output_text.delta" {
+			text += event["delta"].(string)
+		}
+		last = event
+	}
+	require.Equal(t, []string{"response.created", "response.in_progress", "response.output_item.added", "response.content_part.added"}, types[:4])
+	require.Equal(t, []string{"response.output_text.done", "response.content_part.done", "response.output_item.done", "response.completed"}, types[len(types)-4:])
+	require.Equal(t, "one two three", text)
+	require.NotNil(t, last["response"].(map[string]any)["usage"])
+
+	w = post(`{"model":"llm","input":"hello","previous_response_id":"resp_1"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "previous_response_id is not supported")
+}
+
+func TestHandlerAnthropicMessages(t *testing.T) {
+	models := &testModelInterface{models: map[string]testMockModel{
+		"llm": {engine: kubeaiv1.EchoEngine},
+	}}
+	h := NewHandler(models, blockingResolver{}, 3, nil, config.ModelProxy{
+		StreamBufferSize: 64,
+		SlowClientPolicy: config.SlowClientPolicyBlock,
+	})
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"model":"llm","max_tokens":100,"system":"Be brief.","messages":[{"role":"user","content":"hello world"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var msg struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &msg))
+	require.True(t, strings.HasPrefix(msg.ID, "msg_"), msg.ID)
+	require.Equal(t, "message", msg.Type)
+	require.Len(t, msg.Content, 1)
+	require.Equal(t, "hello world", msg.Content[0].Text)
+	require.Equal(t, "end_turn", msg.StopReason)
+
+	w = post(`{"model":"llm","max_tokens":100,"stream":true,"messages":[{"role":"user","content":[{"type":"text","text":"one two three"}]}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var (
+		types []string
+		text  string
+	)
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+		types = append(types, event["type"].(string))
+		if event["type"] == "content_block_delta" {
+			text += event["delta"].(map[string]any)["text"].(string)
+		}
+	}
+	require.Equal(t, []string{"message_start", "content_block_start"}, types[:2])
+	require.Equal(t, []string{"content_block_stop", "message_delta", "message_stop"}, types[len(types)-3:])
+	require.Equal(t, "one two three", text)
+
+	// Errors have the format of the Anthropic API.
+	w = post(`{"model":"llm","max_tokens":100,"messages":[{"role":"system","content":"a"}]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.JSONEq(t, `{"type":"error","error":{"type":"invalid_request_error","message":"messages[0]: role must be user or assistant"}}`, w.Body.String())
+}
@@ -3,21 +3,47 @@ package modelproxy
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"time"
 
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/admission"
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/debuglog"
+	"github.com/substratusai/kubeai/internal/echo"
+	"github.com/substratusai/kubeai/internal/endpoints"
+	"github.com/substratusai/kubeai/internal/engines"
 	"github.com/substratusai/kubeai/internal/metrics"
+	"github.com/substratusai/kubeai/internal/webhooks"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
 
 type ModelScaler interface {
-	LookupModel(ctx context.Context, model, adapter string, selectors []string) (bool, error)
+	LookupModel(ctx context.Context, model, adapter string, selectors []string) (string, bool, error)
+	LookupPassthroughPaths(ctx context.Context, model string) ([]string, error)
+	LookupMaxQueueWait(ctx context.Context, model string) (time.Duration, bool, error)
+	LookupChatMessageNormalization(ctx context.Context, model string) (*kubeaiv1.ChatMessageNormalization, error)
+	LookupCapabilities(ctx context.Context, model string) (*kubeaiv1.ModelStatusCapabilities, error)
+	LookupDeprecation(ctx context.Context, model string) (*kubeaiv1.ModelDeprecation, error)
+	LookupSafetyPolicy(ctx context.Context, model string) (*kubeaiv1.ModelSafetyPolicy, error)
+	LookupActive(ctx context.Context, model string) (bool, time.Time, error)
+	LookupEngine(ctx context.Context, model string) (string, []string, error)
 	ScaleAtLeastOneReplica(ctx context.Context, model string) error
 }
 
+type Admission interface {
+	Admit(req *admission.Request) admission.Decision
+}
+
 type EndpointResolver interface {
 	AwaitBestAddress(ctx context.Context, model, adapter string) (string, func(), error)
 }
@@ -29,6 +55,16 @@ type Handler struct {
 	resolver    EndpointResolver
 	maxRetries  int
 	retryCodes  map[int]struct{}
+	cfg         config.ModelProxy
+	coldStarts  *coldStarts
+	transport   *http.Transport
+	// embeddings is nil unless embeddings requests are coalesced.
+	embeddings *embeddingCoalescer
+
+	// Admission evaluates admission policies for requests. Nil allows all requests.
+	Admission Admission
+	// Webhooks are notified of completed cold starts. Nil disables notifications.
+	Webhooks *webhooks.Notifier
 }
 
 func NewHandler(
@@ -36,12 +72,39 @@ func NewHandler(
 	resolver EndpointResolver,
 	maxRetries int,
 	retryCodes map[int]struct{},
+	cfg config.ModelProxy,
 ) *Handler {
-	return &Handler{
+	h := &Handler{
 		modelScaler: modelScaler,
 		resolver:    resolver,
 		maxRetries:  maxRetries,
 		retryCodes:  retryCodes,
+		cfg:         cfg,
+		coldStarts:  newColdStarts(),
+		transport:   newTransport(cfg.Dialer),
+	}
+	if cfg.EmbeddingCoalescing != nil {
+		h.embeddings = newEmbeddingCoalescer(cfg.EmbeddingCoalescing)
+	}
+	return h
+}
+
+// Transport returns the transport that requests are proxied to model servers
+// with, so that other clients of model servers can share its connections.
+func (h *Handler) Transport() http.RoundTripper {
+	return h.transport
+}
+
+// coldStartReady records that a Model is serving requests and notifies
+// webhooks if this completed a cold start. reported is true if the status of
+// the Model reports ready replicas.
+func (h *Handler) coldStartReady(model string, reported bool) {
+	if d, ok := h.coldStarts.ready(model, time.Now(), reported); ok {
+		h.Webhooks.Notify(webhooks.Event{
+			Type:    webhooks.EventColdStartCompleted,
+			Model:   model,
+			Message: fmt.Sprintf("serving requests after a cold start of %v", d.Round(time.Second)),
+		})
 	}
 }
 
@@ -58,39 +121,238 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Proxy", "lingo")
 
 	pr := newProxyRequest(r)
+	if r.URL.Path == apiutils.ModerationsPath && h.cfg.Moderation != nil {
+		// Moderation requests do not need to name the Moderation Model.
+		pr.defaultModel = h.cfg.Moderation.Model
+	}
 
 	// TODO: Only parse model for paths that would have a model.
 	if err := pr.parse(); err != nil {
 		pr.sendErrorResponse(w, http.StatusBadRequest, "unable to parse model: %v", err)
 		return
 	}
+	if pr.streamedBody != nil {
+		// Model servers might respond (i.e. stream partial transcriptions)
+		// while the upload is still being received. Not supported by all
+		// servers (HTTP/2 always is full duplex).
+		_ = http.NewResponseController(w).EnableFullDuplex()
+	}
 
+	h.serve(w, pr)
+}
+
+// serve proxies a request for which the model has already been determined.
+func (h *Handler) serve(w http.ResponseWriter, pr *proxyRequest) {
+	// Retries should prefer endpoints on other Nodes and zones.
+	pr.r = pr.r.WithContext(endpoints.WithUsage(endpoints.WithRetryTargeting(pr.r.Context())))
+	r := pr.r
 	log.Println("model:", pr.model, "adapter:", pr.adapter)
+	debuglog.Printf(pr.model, pr.id, "received request: %s %s, adapter: %q, selectors: %v", r.Method, r.URL.Path, pr.adapter, pr.selectors)
 
-	metricAttrs := metric.WithAttributeSet(attribute.NewSet(
-		metrics.AttrRequestModel.String(pr.requestedModel),
+	model, modelExists, err := h.modelScaler.LookupModel(r.Context(), pr.model, pr.adapter, pr.selectors)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
+		return
+	}
+	if !modelExists {
+		pr.sendErrorResponse(w, http.StatusNotFound, "%v: %v", ErrModelNotFound, pr.requestedModel)
+		return
+	}
+	if err := pr.resolveAlias(model); err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model alias: %v", err)
+		return
+	}
+
+	// Policies are evaluated against the resolved Model, so that they can
+	// not be bypassed by requesting an alias.
+	if h.Admission != nil && !isModeration(r.Context()) {
+		decision := h.Admission.Admit(&admission.Request{
+			Model:          apiutils.MergeModelAdapter(pr.model, pr.adapter),
+			RequestedModel: pr.requestedModel,
+			Path:           r.URL.Path,
+			Header:         r.Header.Get,
+			Params:         pr.params,
+		})
+		if !decision.Allowed {
+			metrics.AdmissionDenials.Add(r.Context(), 1, metric.WithAttributes(metrics.AttrAdmissionRule.String(decision.Rule)))
+			pr.sendErrorResponse(w, http.StatusForbidden, "%s", decision.Message)
+			return
+		}
+		if decision.Mutated {
+			if err := pr.setParams(); err != nil {
+				pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to apply admission policy: %v", err)
+				return
+			}
+		}
+	}
+
+	// Metrics are recorded by the name of the Model (not the alias that
+	// was requested) as the autoscaler scales Models by them.
+	metricAttrs := metric.WithAttributeSet(attribute.NewSet(append(
+		metrics.RequestTagAttributes(r.Header.Get),
+		metrics.AttrRequestModel.String(apiutils.MergeModelAdapter(pr.model, pr.adapter)),
 		metrics.AttrRequestType.String(metrics.AttrRequestTypeHTTP),
-	))
+	)...))
+	pr.metricAttrs = metricAttrs
+	metrics.InferenceRequests.Add(pr.r.Context(), 1, metricAttrs)
 	metrics.InferenceRequestsActive.Add(pr.r.Context(), 1, metricAttrs)
 	defer metrics.InferenceRequestsActive.Add(pr.r.Context(), -1, metricAttrs)
+	defer func() {
+		if pr.status >= 500 {
+			metrics.InferenceRequestErrors.Add(pr.r.Context(), 1, metricAttrs)
+		}
+	}()
 
-	modelExists, err := h.modelScaler.LookupModel(r.Context(), pr.model, pr.adapter, pr.selectors)
+	deprecation, err := h.modelScaler.LookupDeprecation(r.Context(), pr.model)
 	if err != nil {
 		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
 		return
 	}
-	if !modelExists {
-		pr.sendErrorResponse(w, http.StatusNotFound, "model not found: %v", pr.requestedModel)
+	if apiutils.SetDeprecationHeaders(w.Header(), deprecation) {
+		metrics.InferenceDeprecatedRequests.Add(r.Context(), 1, metricAttrs)
+	}
+
+	active, activeAt, err := h.modelScaler.LookupActive(r.Context(), pr.model)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
+		return
+	}
+	if !active {
+		// Rejecting the request instead of waiting for the Model to be
+		// activated, which could take hours.
+		pr.sendUnavailableResponse(w, time.Until(activeAt), "%v: %v is outside of its active windows until %v",
+			ErrModelInactive, pr.requestedModel, activeAt.UTC().Format(time.RFC3339))
 		return
 	}
 
-	// Ensure the backend is scaled to at least one Pod.
-	if err := h.modelScaler.ScaleAtLeastOneReplica(r.Context(), pr.model); err != nil {
-		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to scale model: %v", err)
+	// Passthrough requests (without params) are sent unchanged.
+	if f := frontends[r.URL.Path]; f != nil && pr.params != nil {
+		if err := pr.toChatCompletion(f); err != nil {
+			pr.sendErrorResponse(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+
+	chatMessages, err := h.modelScaler.LookupChatMessageNormalization(r.Context(), pr.model)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
 		return
 	}
+	if apiutils.NormalizeChatMessages(pr.params, chatMessages) {
+		if err := pr.setParams(); err != nil {
+			pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to normalize chat messages: %v", err)
+			return
+		}
+	}
+
+	capabilities, err := h.modelScaler.LookupCapabilities(r.Context(), pr.model)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
+		return
+	}
+	if err := apiutils.CheckCapabilities(pr.params, capabilities); err != nil {
+		pr.sendErrorResponse(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if r.URL.Path == apiutils.SpeechPath {
+		if err := apiutils.CheckSpeechParams(pr.params); err != nil {
+			pr.sendErrorResponse(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
 
-	h.proxyHTTP(w, pr)
+	if path := pr.apiPath(); path == chatCompletionsPath || path == "/v1/completions" {
+		policy, err := h.modelScaler.LookupSafetyPolicy(r.Context(), pr.model)
+		if err != nil {
+			pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
+			return
+		}
+		if policy != nil && !h.moderate(w, pr, policy) {
+			return
+		}
+	}
+
+	engine, args, err := h.modelScaler.LookupEngine(r.Context(), pr.model)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
+		return
+	}
+	if path := pr.apiPath(); (path == chatCompletionsPath || path == "/v1/completions") && pr.params != nil {
+		// Model servers with a dialect are not sent stream_options.
+		pr.usage, err = pr.countUsage(engines.LookupDialect(engine) == nil)
+		if err != nil {
+			pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to request usage: %v", err)
+			return
+		}
+		if path == chatCompletionsPath && h.cfg.StructuredOutputs != nil {
+			// The schema is read before the request is rewritten for a dialect.
+			if schema, ok := apiutils.ResponseFormatSchema(pr.params); ok {
+				pr.outputSchema, err = apiutils.CompileJSONSchema(schema)
+				if err != nil {
+					pr.sendErrorResponse(w, http.StatusBadRequest, "invalid response_format schema: %v", err)
+					return
+				}
+			}
+		}
+	}
+	if (r.URL.Path == apiutils.TokenizePath || r.URL.Path == apiutils.CountTokensPath) && pr.params != nil {
+		pr.backendPath = tokenizePath(engine)
+		if pr.backendPath == "" {
+			// The Model is not scaled to estimate the count.
+			h.estimateTokens(w, pr, capabilities)
+			return
+		}
+	} else if d := engines.LookupDialect(engine); d != nil {
+		if err := pr.applyDialect(d); err != nil {
+			pr.sendErrorResponse(w, http.StatusBadRequest, "unable to rewrite request for engine %s: %v", engine, err)
+			return
+		}
+	}
+	if engine == kubeaiv1.EchoEngine {
+		// Echo Models are served in-process and never scaled.
+		pr.echo, err = echo.NewHandler(args)
+		if err != nil {
+			pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to configure echo engine: %v", err)
+			return
+		}
+	} else {
+		// Ensure the backend is scaled to at least one Pod.
+		if err := h.modelScaler.ScaleAtLeastOneReplica(r.Context(), pr.model); err != nil {
+			pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to scale model: %v", err)
+			return
+		}
+
+		pr.maxQueueWait, pr.coldStart, err = h.modelScaler.LookupMaxQueueWait(r.Context(), pr.model)
+		if err != nil {
+			pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
+			return
+		}
+		if pr.coldStart {
+			if pr.maxQueueWait == 0 {
+				pr.maxQueueWait = h.cfg.MaxParkDuration.Duration
+			}
+			h.coldStarts.park(pr.model, time.Now())
+		} else {
+			h.coldStartReady(pr.model, true)
+		}
+	}
+
+	switch r.URL.Path {
+	case apiutils.ModerationsPath:
+		h.proxyModerations(w, pr)
+	case apiutils.CountTokensPath:
+		h.proxyCountTokens(w, pr)
+	default:
+		h.proxyCoalesced(w, pr)
+	}
+	metrics.InferenceRequestDuration.Record(pr.r.Context(), time.Since(pr.start).Seconds(), metricAttrs)
+	if n := endpoints.RequestEndpoints(pr.r.Context()); n > 0 {
+		metrics.InferenceRequestEndpoints.Record(pr.r.Context(), int64(n), metricAttrs)
+	}
+	if gpuSeconds := endpoints.GPUSeconds(pr.r.Context()) + pr.coalescedGPUSeconds; gpuSeconds > 0 {
+		metrics.InferenceGPUSeconds.Add(pr.r.Context(), gpuSeconds, metricAttrs)
+		log.Printf("Request %v used approximately %.3f GPU-seconds of model %v", pr.id, gpuSeconds, pr.model)
+	}
 }
 
 // AdditionalProxyRewrite is an injection point for modifying proxy requests.
@@ -100,9 +362,21 @@ var AdditionalProxyRewrite = func(*httputil.ProxyRequest) {}
 func (h *Handler) proxyHTTP(w http.ResponseWriter, pr *proxyRequest) {
 	log.Printf("Waiting for host: %v", pr.id)
 
-	addr, decrementInflight, err := h.resolver.AwaitBestAddress(pr.r.Context(), pr.model, pr.adapter)
+	addr, decrementInflight, err := h.awaitBestAddress(pr)
 	if err != nil {
 		switch {
+		case errors.Is(err, ErrScaleTimeout):
+			metrics.EndpointWaitQueueTimeouts.Add(pr.r.Context(), 1, pr.metricAttrs)
+			// The Model is likely still scaling up, retrying after the same
+			// amount of time gives the client a deterministic backoff.
+			retryAfter := pr.maxQueueWait
+			if pr.coldStart {
+				// Estimate when the Model will be ready from recent cold starts.
+				retryAfter = h.coldStarts.retryAfter(pr.model, time.Now(), pr.maxQueueWait)
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			pr.sendErrorResponse(w, http.StatusServiceUnavailable, "exceeded max queue wait of %v while finding host (retry after %v)", pr.maxQueueWait, retryAfter)
+			return
 		case errors.Is(err, context.Canceled):
 			pr.sendErrorResponse(w, http.StatusInternalServerError, "request cancelled while finding host: %v", err)
 			return
@@ -116,28 +390,81 @@ func (h *Handler) proxyHTTP(w http.ResponseWriter, pr *proxyRequest) {
 	}
 	// NOTE: decrementInflight will be called after the request succeeds or fails after all retries.
 	defer decrementInflight()
+	if pr.coldStart {
+		h.coldStartReady(pr.model, false)
+	}
+	debuglog.Printf(pr.model, pr.id, "selected endpoint %s (attempt %d)", addr, pr.attempt)
 
+	var transport http.RoundTripper = h.transport
+	if pr.echo != nil {
+		transport = pr.echo
+	}
 	proxy := &httputil.ReverseProxy{
+		Transport: transport,
 		Rewrite: func(r *httputil.ProxyRequest) {
 			r.SetURL(&url.URL{
 				Scheme: "http",
 				Host:   addr,
 			})
 			r.Out.Host = r.In.Host
+			if pr.backendPath != "" {
+				r.Out.URL.Path = pr.backendPath
+				r.Out.URL.RawPath = ""
+			}
 			AdditionalProxyRewrite(r)
 		},
 	}
+	if pr.r.URL.Path == apiutils.SpeechPath {
+		// Audio is flushed as it is synthesized, so that clients can start
+		// playing it before the whole input was synthesized.
+		proxy.FlushInterval = -1
+	}
 
 	proxy.ModifyResponse = func(r *http.Response) error {
 		// Record the response for metrics.
 		pr.status = r.StatusCode
+		debuglog.Printf(pr.model, pr.id, "received response from %s: %d", addr, r.StatusCode)
 
 		// This point is reached if a response code is received.
-		if h.isRetryCode(r.StatusCode) && pr.attempt < h.maxRetries {
+		if h.isRetryCode(r.StatusCode) && pr.attempt < h.maxRetries && pr.retryable() {
 			// Returning an error will trigger the ErrorHandler.
 			return ErrRetry
 		}
 
+		if err := pr.rewriteResponse(r); err != nil {
+			return err
+		}
+		if err := h.checkStructuredOutput(pr, r); err != nil {
+			return err
+		}
+		stream := isEventStream(r)
+		// Only the tokens of successful responses are counted.
+		var counter *usageCounter
+		if r.StatusCode >= 200 && r.StatusCode < 300 {
+			counter = pr.usage
+		}
+		if stream {
+			r.Body = newStreamBuffer(pr.r.Context(), r.Body, h.cfg, pr.metricAttrs, counter)
+		} else if counter != nil {
+			r.Body = &usageBody{ReadCloser: r.Body, onEOF: func(u *usage) {
+				if u != nil {
+					counter.usage = u
+					counter.record(pr.r.Context(), pr.metricAttrs)
+				}
+			}}
+		}
+		if err := pr.translateResponse(r); err != nil {
+			return err
+		}
+		if !stream && pr.responseCodec != nil {
+			if err := pr.encodeResponse(r); err != nil {
+				return err
+			}
+		}
+		r.Body = &firstByteReader{ReadCloser: r.Body, onFirstByte: func() {
+			metrics.InferenceTimeToFirstByte.Record(pr.r.Context(), time.Since(pr.start).Seconds(), pr.metricAttrs)
+		}}
+
 		return nil
 	}
 
@@ -145,7 +472,11 @@ func (h *Handler) proxyHTTP(w http.ResponseWriter, pr *proxyRequest) {
 		// This point could be reached if a bad response code was sent by the backend
 		// or
 		// if there was an issue with the connection and no response was ever received.
-		if err != nil && r.Context().Err() == nil && pr.attempt < h.maxRetries {
+		if errors.Is(err, errInvalidOutput) {
+			h.proxyHTTP(w, pr)
+			return
+		}
+		if err != nil && r.Context().Err() == nil && pr.attempt < h.maxRetries && pr.retryable() {
 			pr.attempt++
 
 			log.Printf("Retrying request (%v/%v): %v: %v", pr.attempt, h.maxRetries, pr.id, err)
@@ -154,6 +485,10 @@ func (h *Handler) proxyHTTP(w http.ResponseWriter, pr *proxyRequest) {
 		}
 
 		if !errors.Is(err, ErrRetry) {
+			if !pr.retryable() {
+				pr.sendErrorResponse(w, http.StatusBadGateway, "proxy: streamed upload can not be retried: %v", err)
+				return
+			}
 			pr.sendErrorResponse(w, http.StatusBadGateway, "proxy: exceeded retries: %v/%v", pr.attempt, h.maxRetries)
 		}
 	}
@@ -164,6 +499,66 @@ func (h *Handler) proxyHTTP(w http.ResponseWriter, pr *proxyRequest) {
 
 var ErrRetry = errors.New("retry")
 
+// Errors that requests can fail with, so that embedders can tell them
+// apart with errors.Is.
+var (
+	// ErrModelNotFound means that the requested Model (or adapter) does not
+	// exist or does not match the selectors of the request.
+	ErrModelNotFound = errors.New("model not found")
+	// ErrModelInactive means that the requested Model is outside of its
+	// active windows (see Model.spec.activeWindows).
+	ErrModelInactive = errors.New("model inactive")
+	// ErrScaleTimeout means that a request waited longer than the Model's
+	// max queue wait for an endpoint (i.e. while scaling from zero).
+	ErrScaleTimeout = errors.New("max queue wait exceeded")
+	// ErrNoCapacity means that the Model had no endpoints when the request
+	// stopped waiting for one.
+	ErrNoCapacity = endpoints.ErrNoCapacity
+	// ErrAdapterNotLoaded means that none of the Model's endpoints had the
+	// requested adapter loaded when the request stopped waiting for one.
+	ErrAdapterNotLoaded = endpoints.ErrAdapterNotLoaded
+)
+
+// awaitBestAddress waits for an endpoint for at most the Model's max queue
+// wait. ErrScaleTimeout is only returned if the max queue wait elapsed
+// (as opposed to the client's deadline).
+func (h *Handler) awaitBestAddress(pr *proxyRequest) (string, func(), error) {
+	if pr.echo != nil {
+		return echo.Host, func() {}, nil
+	}
+	ctx := pr.r.Context()
+	if pr.maxQueueWait > 0 {
+		if pr.queueDeadline.IsZero() {
+			pr.queueDeadline = time.Now().Add(pr.maxQueueWait)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadlineCause(ctx, pr.queueDeadline, ErrScaleTimeout)
+		defer cancel()
+	}
+	addr, decrement, err := h.resolver.AwaitBestAddress(ctx, pr.model, pr.adapter)
+	if err != nil && errors.Is(context.Cause(ctx), ErrScaleTimeout) {
+		return "", decrement, ErrScaleTimeout
+	}
+	return addr, decrement, err
+}
+
+// firstByteReader calls onFirstByte when the first byte is read from the
+// underlying reader.
+type firstByteReader struct {
+	io.ReadCloser
+	onFirstByte func()
+	read        bool
+}
+
+func (r *firstByteReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && !r.read {
+		r.read = true
+		r.onFirstByte()
+	}
+	return n, err
+}
+
 func (h *Handler) isRetryCode(status int) bool {
 	var retry bool
 	// TODO: avoid the nil check here and set a default map in the constructor.
@@ -1,11 +1,15 @@
 package modelproxy
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -13,8 +17,14 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/admission"
 	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/engines"
 	"github.com/substratusai/kubeai/internal/metrics/metricstest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
 )
 
 func TestHandler(t *testing.T) {
@@ -25,6 +35,12 @@ func TestHandler(t *testing.T) {
 		model3   = "model3"
 		adapter3 = "adapter3"
 
+		model4 = "model4"
+		model5 = "model5"
+		model6 = "model6"
+		model7 = "model7"
+		model8 = "model8"
+
 		maxRetries = 3
 	)
 	models := map[string]testMockModel{
@@ -35,6 +51,28 @@ func TestHandler(t *testing.T) {
 				adapter3: true,
 			},
 		},
+		model4: {
+			chatMessages: &kubeaiv1.ChatMessageNormalization{
+				SystemToUser:          true,
+				MergeConsecutiveRoles: true,
+			},
+		},
+		model5: {
+			capabilities: &kubeaiv1.ModelStatusCapabilities{MaxContextLength: ptr.To[int64](4096)},
+		},
+		model6: {
+			aliases: []string{"gpt-4o-mini"},
+		},
+		model7: {
+			inactiveUntil: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		model8: {
+			deprecation: &kubeaiv1.ModelDeprecation{
+				Deprecated:       true,
+				SunsetDate:       &metav1.Time{Time: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)},
+				ReplacementModel: model1,
+			},
+		},
 	}
 
 	type metricsTestSpec struct {
@@ -45,13 +83,15 @@ func TestHandler(t *testing.T) {
 		reqBody    string
 		reqHeaders map[string]string
 
-		backendPanic bool
-		backendCode  int
-		backendBody  string
+		backendPanic   bool
+		backendCode    int
+		backendBody    string
+		backendHeaders map[string]string
 
 		expRewrittenReqBody    string
 		expCode                int
 		expBody                string
+		expRespHeaders         map[string]string
 		expMetrics             *metricsTestSpec
 		expBackendRequestCount int
 	}{
@@ -90,6 +130,15 @@ func TestHandler(t *testing.T) {
 			},
 			expBackendRequestCount: 1,
 		},
+		"happy 200 chat messages normalized": {
+			reqBody:                fmt.Sprintf(`{"model":%q,"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`, model4),
+			expRewrittenReqBody:    fmt.Sprintf(`{"messages":[{"content":"be brief\n\nhi","role":"user"}],"model":%q}`, model4),
+			backendCode:            http.StatusOK,
+			backendBody:            `{"result":"ok"}`,
+			expCode:                http.StatusOK,
+			expBody:                `{"result":"ok"}`,
+			expBackendRequestCount: 1,
+		},
 		"404 model+adapter in body but missing adapter": {
 			reqBody: fmt.Sprintf(`{"model":%q}`, apiutils.MergeModelAdapter(model1, "no-such-adapter")),
 			expCode: http.StatusNotFound,
@@ -132,6 +181,78 @@ func TestHandler(t *testing.T) {
 			},
 			expBackendRequestCount: 1,
 		},
+		"happy 200 msgpack request and response": {
+			reqHeaders: map[string]string{"Content-Type": "application/msgpack"},
+			// {"model":"model1"}
+			reqBody:             "\x81\xa5model\xa6model1",
+			expRewrittenReqBody: `{"model":"model1"}`,
+			backendCode:         http.StatusOK,
+			backendBody:         `{"result":"ok"}`,
+			backendHeaders:      map[string]string{"Content-Type": "application/json"},
+			expCode:             http.StatusOK,
+			expBody:             "\x81\xa6result\xa2ok",
+			expMetrics: &metricsTestSpec{
+				expModel: model1,
+			},
+			expBackendRequestCount: 1,
+		},
+		"happy 200 json request with cbor response": {
+			reqHeaders:     map[string]string{"Accept": "application/cbor"},
+			reqBody:        fmt.Sprintf(`{"model":%q}`, model1),
+			backendCode:    http.StatusOK,
+			backendBody:    `{"result":"ok"}`,
+			backendHeaders: map[string]string{"Content-Type": "application/json"},
+			expCode:        http.StatusOK,
+			expBody:        "\xa1\x66result\x62ok",
+			expMetrics: &metricsTestSpec{
+				expModel: model1,
+			},
+			expBackendRequestCount: 1,
+		},
+		"alias": {
+			reqBody:             `{"model":"gpt-4o-mini"}`,
+			expRewrittenReqBody: fmt.Sprintf(`{"model":%q}`, model6),
+			backendCode:         http.StatusOK,
+			backendBody:         `{"result":"ok"}`,
+			expCode:             http.StatusOK,
+			expBody:             `{"result":"ok"}`,
+			expMetrics: &metricsTestSpec{
+				// Recorded by the name of the Model for the autoscaler.
+				expModel: model6,
+			},
+			expBackendRequestCount: 1,
+		},
+		"max_tokens exceeds context length": {
+			reqBody:                fmt.Sprintf(`{"model":%q,"max_tokens":5000}`, model5),
+			expCode:                http.StatusBadRequest,
+			expBody:                `{"error":"max_tokens of 5000 exceeds the maximum context length of the model (4096 tokens)"}` + "\n",
+			expBackendRequestCount: 0,
+		},
+		"inactive model": {
+			reqBody:                fmt.Sprintf(`{"model":%q}`, model7),
+			expCode:                http.StatusServiceUnavailable,
+			expBody:                `{"error":"model inactive: model7 is outside of its active windows until 2100-01-01T00:00:00Z"}` + "\n",
+			expBackendRequestCount: 0,
+		},
+		"deprecated model": {
+			reqBody:     fmt.Sprintf(`{"model":%q}`, model8),
+			backendCode: http.StatusOK,
+			backendBody: `{"choices":[{"text":"hello"}]}`,
+			expCode:     http.StatusOK,
+			expBody:     `{"choices":[{"text":"hello"}]}`,
+			expRespHeaders: map[string]string{
+				"Deprecation": "true",
+				"Sunset":      "Fri, 01 Jan 2100 00:00:00 GMT",
+			},
+			expBackendRequestCount: 1,
+		},
+		"invalid msgpack request": {
+			reqHeaders:             map[string]string{"Content-Type": "application/msgpack"},
+			reqBody:                "\x81\xa5mod",
+			expCode:                http.StatusBadRequest,
+			expBody:                `{"error":"unable to parse model: converting body to json: decoding application/msgpack: unexpected EOF"}` + "\n",
+			expBackendRequestCount: 0,
+		},
 		"retryable 500": {
 			reqBody:     fmt.Sprintf(`{"model":%q}`, model1),
 			backendCode: http.StatusInternalServerError,
@@ -195,6 +316,9 @@ func TestHandler(t *testing.T) {
 					panic("panicing on purpose")
 				}
 
+				for k, v := range spec.backendHeaders {
+					w.Header().Set(k, v)
+				}
 				if spec.backendCode != 0 {
 					w.WriteHeader(spec.backendCode)
 				}
@@ -208,7 +332,7 @@ func TestHandler(t *testing.T) {
 				models:  models,
 				address: backend.Listener.Addr().String(),
 			}
-			h := NewHandler(testInf, testInf, maxRetries, nil)
+			h := NewHandler(testInf, testInf, maxRetries, nil, config.ModelProxy{StreamBufferSize: 64, SlowClientPolicy: config.SlowClientPolicyBlock})
 			server := httptest.NewServer(h)
 
 			// Issue request.
@@ -249,6 +373,9 @@ func TestHandler(t *testing.T) {
 			// Assert on response.
 			assert.Equal(t, spec.expCode, resp.StatusCode, "Unexpected response code to client")
 			assert.Equal(t, spec.expBody, string(respBody), "Unexpected response body to client")
+			for k, v := range spec.expRespHeaders {
+				assert.Equal(t, v, resp.Header.Get(k), "Unexpected response header %s", k)
+			}
 			assert.Equal(t, spec.expBackendRequestCount, backendRequestCount, "Unexpected number of requests sent to backend")
 			assert.Equal(t, spec.expBackendRequestCount, testInf.hostRequestCount, "Unexpected number of requests for backend hosts")
 
@@ -262,7 +389,17 @@ func TestHandler(t *testing.T) {
 }
 
 type testMockModel struct {
-	adapters map[string]bool
+	adapters         map[string]bool
+	aliases          []string
+	passthroughPaths []string
+	maxQueueWait     time.Duration
+	coldStart        bool
+	chatMessages     *kubeaiv1.ChatMessageNormalization
+	capabilities     *kubeaiv1.ModelStatusCapabilities
+	inactiveUntil    time.Time
+	deprecation      *kubeaiv1.ModelDeprecation
+	safetyPolicy     *kubeaiv1.ModelSafetyPolicy
+	engine           string
 }
 
 type testModelInterface struct {
@@ -276,18 +413,58 @@ type testModelInterface struct {
 	models map[string]testMockModel
 }
 
-func (t *testModelInterface) LookupModel(ctx context.Context, model, adapter string, selector []string) (bool, error) {
+func (t *testModelInterface) LookupModel(ctx context.Context, model, adapter string, selector []string) (string, bool, error) {
 	m, ok := t.models[model]
+	if !ok {
+		for name, candidate := range t.models {
+			if slices.Contains(candidate.aliases, model) {
+				model, m, ok = name, candidate, true
+			}
+		}
+	}
 	if ok {
 		if adapter == "" {
-			return true, nil
+			return model, true, nil
 		}
 		if m.adapters == nil {
-			return false, nil
+			return "", false, nil
 		}
-		return m.adapters[adapter], nil
+		return model, m.adapters[adapter], nil
 	}
-	return false, nil
+	return "", false, nil
+}
+
+func (t *testModelInterface) LookupPassthroughPaths(ctx context.Context, model string) ([]string, error) {
+	return t.models[model].passthroughPaths, nil
+}
+
+func (t *testModelInterface) LookupChatMessageNormalization(ctx context.Context, model string) (*kubeaiv1.ChatMessageNormalization, error) {
+	return t.models[model].chatMessages, nil
+}
+
+func (t *testModelInterface) LookupCapabilities(ctx context.Context, model string) (*kubeaiv1.ModelStatusCapabilities, error) {
+	return t.models[model].capabilities, nil
+}
+
+func (t *testModelInterface) LookupDeprecation(ctx context.Context, model string) (*kubeaiv1.ModelDeprecation, error) {
+	return t.models[model].deprecation, nil
+}
+
+func (t *testModelInterface) LookupSafetyPolicy(ctx context.Context, model string) (*kubeaiv1.ModelSafetyPolicy, error) {
+	return t.models[model].safetyPolicy, nil
+}
+
+func (t *testModelInterface) LookupActive(ctx context.Context, model string) (bool, time.Time, error) {
+	until := t.models[model].inactiveUntil
+	return until.IsZero(), until, nil
+}
+
+func (t *testModelInterface) LookupEngine(ctx context.Context, model string) (string, []string, error) {
+	return t.models[model].engine, nil, nil
+}
+
+func (t *testModelInterface) LookupMaxQueueWait(ctx context.Context, model string) (time.Duration, bool, error) {
+	return t.models[model].maxQueueWait, t.models[model].coldStart, nil
 }
 
 func (t *testModelInterface) ScaleAtLeastOneReplica(ctx context.Context, model string) error {
@@ -300,3 +477,270 @@ func (t *testModelInterface) AwaitBestAddress(ctx context.Context, model, adapte
 	t.requestedAdapter = adapter
 	return t.address, func() {}, nil
 }
+
+func TestHandlerMaxQueueWait(t *testing.T) {
+	models := &testModelInterface{models: map[string]testMockModel{
+		"limited":   {maxQueueWait: 100 * time.Millisecond},
+		"unlimited": {},
+	}}
+	h := NewHandler(models, blockingResolver{}, 3, nil, config.ModelProxy{StreamBufferSize: 64, SlowClientPolicy: config.SlowClientPolicyBlock})
+
+	// The max queue wait results in a 503 with a Retry-After header.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"model":"limited"}`)))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+	require.Equal(t, `{"error":"Service Unavailable"}`+"\n", w.Body.String())
+
+	// The client deadline results in a 504 without a Retry-After header.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"model":"unlimited"}`)).WithContext(ctx))
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+	require.Empty(t, w.Header().Get("Retry-After"))
+}
+
+func TestHandlerMaxQueueWaitRetries(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	models := &testModelInterface{models: map[string]testMockModel{
+		"limited": {maxQueueWait: time.Minute},
+	}}
+	resolver := &deadlineResolver{address: backend.Listener.Addr().String()}
+	h := NewHandler(models, resolver, 3, nil, config.ModelProxy{StreamBufferSize: 64, SlowClientPolicy: config.SlowClientPolicyBlock})
+
+	// The max queue wait is measured from the first attempt.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"model":"limited"}`)))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Len(t, resolver.deadlines, 4)
+	for _, d := range resolver.deadlines {
+		require.Equal(t, resolver.deadlines[0], d)
+	}
+}
+
+// deadlineResolver records the deadlines of the contexts that addresses
+// are awaited with.
+type deadlineResolver struct {
+	address   string
+	deadlines []time.Time
+}
+
+func (r *deadlineResolver) AwaitBestAddress(ctx context.Context, model, adapter string) (string, func(), error) {
+	d, _ := ctx.Deadline()
+	r.deadlines = append(r.deadlines, d)
+	return r.address, func() {}, nil
+}
+
+func TestHandlerMaxParkDuration(t *testing.T) {
+	models := &testModelInterface{models: map[string]testMockModel{
+		"cold": {coldStart: true},
+	}}
+	h := NewHandler(models, blockingResolver{}, 3, nil, config.ModelProxy{
+		StreamBufferSize: 64,
+		SlowClientPolicy: config.SlowClientPolicyBlock,
+		MaxParkDuration:  config.Duration{Duration: 100 * time.Millisecond},
+	})
+	h.coldStarts.history["cold"] = []time.Duration{30 * time.Second}
+
+	// The Retry-After header is the estimated remaining cold start time.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"model":"cold"}`)))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "30", w.Header().Get("Retry-After"))
+}
+
+// blockingResolver never finds an endpoint.
+type blockingResolver struct{}
+
+func (blockingResolver) AwaitBestAddress(ctx context.Context, model, adapter string) (string, func(), error) {
+	<-ctx.Done()
+	return "", func() {}, ctx.Err()
+}
+
+func TestHandlerAdmission(t *testing.T) {
+	var backendBody string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		backendBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	models := &testModelInterface{
+		models:  map[string]testMockModel{"my-model": {aliases: []string{"my-alias"}}},
+		address: backend.Listener.Addr().String(),
+	}
+	h := NewHandler(models, models, 3, nil, config.ModelProxy{StreamBufferSize: 64, SlowClientPolicy: config.SlowClientPolicyBlock})
+	var requestedModel string
+	h.Admission = admitFunc(func(req *admission.Request) admission.Decision {
+		// Policies see the resolved Model.
+		require.Equal(t, "my-model", req.Model)
+		requestedModel = req.RequestedModel
+		require.Equal(t, "/v1/completions", req.Path)
+		if req.Header("X-Team") != "research" {
+			return admission.Decision{Rule: "teams", Message: "team not allowed"}
+		}
+		req.Params["max_tokens"] = 100.0
+		return admission.Decision{Allowed: true, Mutated: true}
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"my-model","max_tokens":5000}`)))
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Equal(t, `{"error":"team not allowed"}`+"\n", w.Body.String())
+	require.Zero(t, models.hostRequestCount, "denied requests should not be proxied")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"my-alias","max_tokens":5000}`)))
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Equal(t, "my-alias", requestedModel)
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"my-model","max_tokens":5000}`))
+	r.Header.Set("X-Team", "research")
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"model":"my-model","max_tokens":100}`, backendBody)
+}
+
+type admitFunc func(req *admission.Request) admission.Decision
+
+func (f admitFunc) Admit(req *admission.Request) admission.Decision { return f(req) }
+
+func TestHandlerEcho(t *testing.T) {
+	models := &testModelInterface{models: map[string]testMockModel{
+		"echo": {engine: kubeaiv1.EchoEngine},
+	}}
+	// Echo Models are served without resolving an endpoint.
+	h := NewHandler(models, blockingResolver{}, 3, nil, config.ModelProxy{StreamBufferSize: 64, SlowClientPolicy: config.SlowClientPolicyBlock})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"echo","prompt":"hello world"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"text":"hello world"`)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"echo","prompt":"hello world","stream":true}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), `"text":" world"`)
+	require.True(t, strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n"))
+
+	// Audio is passed through as is.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/audio/speech", strings.NewReader(`{"model":"echo","input":"hello world","response_format":"wav"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "audio/wav", w.Header().Get("Content-Type"))
+	require.True(t, strings.HasPrefix(w.Body.String(), "RIFF"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/audio/speech", strings.NewReader(`{"model":"echo","input":""}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "input must be a non-empty string")
+}
+
+func TestHandlerChunkedUpload(t *testing.T) {
+	models := &testModelInterface{models: map[string]testMockModel{
+		"whisper": {engine: kubeaiv1.EchoEngine},
+	}}
+	h := NewHandler(models, blockingResolver{}, 3, nil, config.ModelProxy{StreamBufferSize: 64, SlowClientPolicy: config.SlowClientPolicyBlock})
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	// The upload is streamed to the model server while it is written and
+	// the partial transcriptions are streamed back.
+	body, w := io.Pipe()
+	mw := multipart.NewWriter(w)
+	go func() {
+		mw.WriteField("model", "whisper")
+		mw.WriteField("stream", "true")
+		fw, _ := mw.CreateFormFile("file", "audio.wav")
+		for i := 0; i < 10; i++ {
+			fw.Write(bytes.Repeat([]byte{byte(i)}, 1024))
+		}
+		mw.WriteField("prompt", "hello world")
+		w.CloseWithError(mw.Close())
+	}()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/audio/transcriptions", body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(respBody), `"type":"transcript.text.done"`)
+	require.Contains(t, string(respBody), `"text":"hello world"`)
+
+	// The model must precede the file.
+	var buf bytes.Buffer
+	mw = multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", "audio.wav")
+	require.NoError(t, err)
+	fw.Write(bytes.Repeat([]byte{1}, 2<<20))
+	mw.WriteField("model", "whisper")
+	require.NoError(t, mw.Close())
+	req, err = http.NewRequest(http.MethodPost, server.URL+"/v1/audio/transcriptions", io.NopCloser(&buf))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	respBody, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(respBody), "the 'model' field must precede the file in chunked uploads")
+}
+
+func TestHandlerDialect(t *testing.T) {
+	engines.RegisterDialect("TestDialect", testDialect{})
+
+	var backendPath, backendBody string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		backendPath, backendBody = r.URL.Path, string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"output":"hi"}`))
+	}))
+	defer backend.Close()
+
+	models := &testModelInterface{
+		models:  map[string]testMockModel{"my-model": {engine: "TestDialect"}},
+		address: backend.Listener.Addr().String(),
+	}
+	h := NewHandler(models, models, 3, nil, config.ModelProxy{StreamBufferSize: 64, SlowClientPolicy: config.SlowClientPolicyBlock})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"my-model","prompt":"hello"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "/generate", backendPath)
+	require.JSONEq(t, `{"model":"my-model","text":"hello"}`, backendBody)
+	require.JSONEq(t, `{"choices":[{"text":"hi"}]}`, w.Body.String())
+}
+
+// testDialect serves completions with a model server that expects
+// {"text": ...} at /generate and responds with {"output": ...}.
+type testDialect struct{}
+
+func (testDialect) RewriteRequest(path string, params map[string]interface{}) (string, error) {
+	params["text"] = params["prompt"]
+	delete(params, "prompt")
+	return "/generate", nil
+}
+
+func (testDialect) RewriteResponse(path string, body []byte) ([]byte, error) {
+	var resp struct {
+		Output string `json:"output"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]any{"choices": []any{map[string]any{"text": resp.Output}}})
+}
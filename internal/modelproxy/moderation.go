@@ -0,0 +1,164 @@
+package modelproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/metrics"
+)
+
+const chatCompletionsPath = "/v1/chat/completions"
+
+type moderationKey struct{}
+
+// withModeration marks the context of a moderation request that KubeAI sends
+// for a request that was already admitted. Moderation requests are not
+// evaluated by admission policies.
+func withModeration(ctx context.Context) context.Context {
+	return context.WithValue(ctx, moderationKey{}, true)
+}
+
+func isModeration(ctx context.Context) bool {
+	moderation, _ := ctx.Value(moderationKey{}).(bool)
+	return moderation
+}
+
+// proxyModerations serves a moderation request with a Moderation Model:
+// each input is classified by a chat completion request to the Model.
+func (h *Handler) proxyModerations(w http.ResponseWriter, pr *proxyRequest) {
+	inputs, err := apiutils.ModerationInputs(pr.params)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	results := make([]apiutils.ModerationResult, len(inputs))
+	for i, input := range inputs {
+		sub, err := pr.subRequest(pr.r.Context(), apiutils.ModerationChatParams(pr.params["model"], input))
+		if err != nil {
+			pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to create classification request: %v", err)
+			return
+		}
+		sub.backendPath = chatCompletionsPath
+		rec := newResponseBuffer()
+		h.proxyHTTP(rec, sub)
+		if rec.status < 200 || rec.status >= 300 {
+			pr.sendBufferedResponse(w, rec.header, rec.status, rec.body)
+			return
+		}
+		if results[i], err = apiutils.ParseModerationCompletion(rec.body); err != nil {
+			pr.sendErrorResponse(w, http.StatusBadGateway, "unable to classify input: %v", err)
+			return
+		}
+	}
+
+	body, err := apiutils.ModerationResponse(pr.id, pr.requestedModel, results)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to encode response: %v", err)
+		return
+	}
+	pr.sendBufferedResponse(w, http.Header{"Content-Type": {"application/json"}}, http.StatusOK, body)
+}
+
+// moderate classifies the text of a completion or chat completion request
+// with the Moderation Model of the safety policy of the requested Model.
+// It sends an error response and returns false if the request must not be
+// sent to the model server.
+func (h *Handler) moderate(w http.ResponseWriter, pr *proxyRequest, policy *kubeaiv1.ModelSafetyPolicy) bool {
+	flagged, err := h.Moderate(pr.r.Context(), pr.id, policy, pr.params)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusBadGateway, "%v", err)
+		return false
+	}
+	if flagged != "" {
+		metrics.ModerationFlagged.Add(pr.r.Context(), 1, pr.metricAttrs)
+		pr.sendErrorResponse(w, http.StatusBadRequest, "%s", flagged)
+		return false
+	}
+	return true
+}
+
+// Moderate classifies the text of the params of a completion or chat
+// completion request with the Moderation Model of a safety policy. It
+// returns the reason that the request must be rejected for if it was
+// flagged or can not be moderated (empty otherwise), and an error if the
+// moderation failed. Failures only let the request through if the policy
+// fails open and the Moderation Model is unavailable (it does not exist or
+// responded with a 5xx status), never if the moderation request was
+// rejected.
+func (h *Handler) Moderate(ctx context.Context, id string, policy *kubeaiv1.ModelSafetyPolicy, params map[string]any) (string, error) {
+	model := policy.Model
+	if model == "" && h.cfg.Moderation != nil {
+		model = h.cfg.Moderation.Model
+	}
+	fail := func(format string, args ...any) (string, error) {
+		if policy.FailOpen {
+			log.Printf("Sending request %v without moderation: "+format, append([]any{id}, args...)...)
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to moderate request: "+format, args...)
+	}
+	if model == "" {
+		return fail("no moderation model configured")
+	}
+	text, err := apiutils.ModerationText(params)
+	if err != nil {
+		return fmt.Sprintf("the request can not be moderated by the safety policy of the model: %v", err), nil
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", nil
+	}
+	if _, exists, err := h.modelScaler.LookupModel(ctx, model, "", nil); err != nil {
+		return "", fmt.Errorf("unable to moderate request: %w", err)
+	} else if !exists {
+		return fail("moderation model %s not found", model)
+	}
+
+	// The moderation request is served like any other request (i.e. the
+	// Moderation Model is scaled from zero), but with none of the headers
+	// of the moderated request, which could select Pods or change how
+	// the request is served.
+	body, err := json.Marshal(map[string]any{"model": model, "input": text})
+	if err != nil {
+		return "", fmt.Errorf("unable to moderate request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(withModeration(ctx), http.MethodPost, apiutils.ModerationsPath, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("unable to moderate request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rec := newResponseBuffer()
+	h.ServeHTTP(rec, req)
+	switch {
+	case rec.status >= 500:
+		return fail("moderation model %s responded with status %d", model, rec.status)
+	case rec.status != http.StatusOK:
+		return "", fmt.Errorf("unable to moderate request: moderation model %s responded with status %d", model, rec.status)
+	}
+	results, err := apiutils.ParseModerationResponse(rec.body)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if len(results) == 0 {
+		return fail("moderation model %s returned no results", model)
+	}
+
+	for _, result := range results {
+		if !result.Flagged {
+			continue
+		}
+		msg := "the request was flagged by the safety policy of the model"
+		if categories := result.FlaggedCategories(); len(categories) > 0 {
+			msg += " (categories: " + strings.Join(categories, ", ") + ")"
+		}
+		return msg, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,83 @@
+package modelproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+)
+
+func TestHandlerModeration(t *testing.T) {
+	// Echo Models "classify" inputs as their own text, so that inputs that
+	// start with "unsafe" are flagged.
+	models := &testModelInterface{models: map[string]testMockModel{
+		"guard":     {engine: kubeaiv1.EchoEngine, aliases: []string{"omni-moderation-latest"}},
+		"llm":       {engine: kubeaiv1.EchoEngine, safetyPolicy: &kubeaiv1.ModelSafetyPolicy{}},
+		"fail-open": {engine: kubeaiv1.EchoEngine, safetyPolicy: &kubeaiv1.ModelSafetyPolicy{Model: "missing", FailOpen: true}},
+		"fail":      {engine: kubeaiv1.EchoEngine, safetyPolicy: &kubeaiv1.ModelSafetyPolicy{Model: "missing"}},
+	}}
+	h := NewHandler(models, blockingResolver{}, 3, nil, config.ModelProxy{
+		StreamBufferSize: 64,
+		SlowClientPolicy: config.SlowClientPolicyBlock,
+		Moderation:       &config.ModelProxyModeration{Model: "guard"},
+	})
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w
+	}
+
+	// Moderation requests without a model use the configured model.
+	w := post("/v1/moderations", `{"input":["hello","unsafe\nS1"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Model   string `json:"model"`
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "guard", resp.Model)
+	require.Len(t, resp.Results, 2)
+	require.False(t, resp.Results[0].Flagged)
+	require.True(t, resp.Results[1].Flagged)
+	require.True(t, resp.Results[1].Categories["violence"])
+
+	w = post("/v1/moderations", `{"model":"omni-moderation-latest","input":"hello"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = post("/v1/moderations", `{"input":[{"type":"image_url"}]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Requests of Models with a safety policy are moderated first.
+	w = post("/v1/chat/completions", `{"model":"llm","messages":[{"role":"user","content":"hello"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"content":"hello"`)
+
+	w = post("/v1/chat/completions", `{"model":"llm","messages":[{"role":"user","content":"unsafe\nS10"}]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "the request was flagged by the safety policy of the model (categories: hate)")
+
+	// Requests that can not be moderated are rejected unless the policy
+	// fails open.
+	w = post("/v1/completions", `{"model":"fail","prompt":"hello"}`)
+	require.Equal(t, http.StatusBadGateway, w.Code)
+	w = post("/v1/completions", `{"model":"fail-open","prompt":"hello"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Messages of all roles and all prompts are moderated.
+	w = post("/v1/chat/completions", `{"model":"llm","messages":[{"role":"system","content":"unsafe\nS1"},{"role":"user","content":"hello"}]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = post("/v1/completions", `{"model":"llm","prompt":["unsafe\nS1","hello"]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	// Token prompts can not be moderated, even if the policy fails open.
+	w = post("/v1/completions", `{"model":"fail-open","prompt":[1,2,3]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "can not be moderated")
+}
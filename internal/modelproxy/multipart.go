@@ -0,0 +1,137 @@
+package modelproxy
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"sync"
+
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+// maxBufferedFormBytes limits the size of the form fields that precede the
+// "model" field of chunked multipart uploads. They are buffered until the
+// model is known.
+const maxBufferedFormBytes = 1 << 20
+
+// streamMultipart reads the parts of a chunked multipart upload up to the
+// "model" field and streams the remaining parts (i.e. the audio file) to the
+// model server as they are received. As with buffered uploads, the "model"
+// field is omitted (see parse).
+func (pr *proxyRequest) streamMultipart(mr *multipart.Reader, boundary string) error {
+	type bufferedPart struct {
+		header textproto.MIMEHeader
+		data   []byte
+	}
+	var (
+		preceding []bufferedPart
+		buffered  int
+	)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return fmt.Errorf("missing 'model' field")
+		}
+		if err != nil {
+			return fmt.Errorf("iterating over multipart form: %w", err)
+		}
+		data, err := io.ReadAll(io.LimitReader(p, int64(maxBufferedFormBytes-buffered+1)))
+		if err != nil {
+			return fmt.Errorf("reading multipart form value: %w", err)
+		}
+		if p.FormName() == "model" {
+			pr.model, pr.adapter = apiutils.SplitModelAdapter(string(data))
+			pr.requestedModel = string(data)
+			break
+		}
+		buffered += len(data)
+		if buffered > maxBufferedFormBytes {
+			return fmt.Errorf("the 'model' field must precede the file in chunked uploads")
+		}
+		preceding = append(preceding, bufferedPart{header: p.Header, data: data})
+	}
+
+	pr.streamedBody = &streamedBody{write: func(w io.Writer) error {
+		mw := multipart.NewWriter(w)
+		mw.SetBoundary(boundary)
+		for _, p := range preceding {
+			pw, err := mw.CreatePart(p.header)
+			if err != nil {
+				return err
+			}
+			if _, err := pw.Write(p.data); err != nil {
+				return err
+			}
+		}
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("iterating over multipart form: %w", err)
+			}
+			pw, err := mw.CreatePart(p.Header)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(pw, p); err != nil {
+				return err
+			}
+		}
+		return mw.Close()
+	}}
+	return nil
+}
+
+// streamedBody is the body of a chunked upload that is sent to the model
+// server while it is received from the client. It can only be sent once:
+// requests are not retried once the body was read (see retryable).
+type streamedBody struct {
+	// write writes the body as it is received.
+	write func(w io.Writer) error
+
+	mtx sync.Mutex
+	r   *io.PipeReader
+}
+
+func (b *streamedBody) Read(p []byte) (int, error) {
+	b.mtx.Lock()
+	if b.r == nil {
+		// The client is only read from once the request is sent (i.e. after
+		// waiting for an endpoint).
+		r, w := io.Pipe()
+		b.r = r
+		go func() {
+			w.CloseWithError(b.write(w))
+		}()
+	}
+	r := b.r
+	b.mtx.Unlock()
+	return r.Read(p)
+}
+
+// Close aborts the upload. It is a no-op if the body was not read, so that
+// requests that failed before their body was sent can be retried.
+func (b *streamedBody) Close() error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.r == nil {
+		return nil
+	}
+	return b.r.Close()
+}
+
+// read returns true if the body was (partially) sent.
+func (b *streamedBody) read() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.r != nil
+}
+
+// retryable returns false for requests with a streamed body that was
+// already (partially) sent to a model server.
+func (pr *proxyRequest) retryable() bool {
+	return pr.streamedBody == nil || !pr.streamedBody.read()
+}
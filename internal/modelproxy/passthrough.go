@@ -0,0 +1,76 @@
+package modelproxy
+
+import (
+	"io"
+	"net/http"
+	"path"
+	"slices"
+
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+// ServePassthrough serves requests for model server paths that are not part
+// of the OpenAI API (e.g. a vector search endpoint of an embedding server).
+// The model and path are taken from the "model" and "path" URL pattern
+// wildcards. The path must be registered on the Model (.spec.passthroughPaths)
+// and allowed by the system's passthrough path allowlist.
+func (h *Handler) ServePassthrough(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Proxy", "lingo")
+
+	requestedModel := r.PathValue("model")
+	urlPath := "/" + r.PathValue("path")
+
+	pr := newProxyRequest(r)
+	pr.selectors = r.Header.Values("X-Label-Selector")
+	pr.requestedModel = requestedModel
+	pr.model, pr.adapter = apiutils.SplitModelAdapter(requestedModel)
+
+	// Reject paths such as "/v1/search/../load_lora_adapter" that could
+	// otherwise be used to reach paths that are not allowed.
+	if path.Clean(urlPath) != urlPath {
+		pr.sendErrorResponse(w, http.StatusBadRequest, "invalid passthrough path: %v", urlPath)
+		return
+	}
+	if !h.cfg.PassthroughPathAllowed(urlPath) {
+		pr.sendErrorResponse(w, http.StatusForbidden, "passthrough path not allowed: %v", urlPath)
+		return
+	}
+
+	model, modelExists, err := h.modelScaler.LookupModel(r.Context(), pr.model, pr.adapter, pr.selectors)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
+		return
+	}
+	if !modelExists {
+		pr.sendErrorResponse(w, http.StatusNotFound, "model not found: %v", requestedModel)
+		return
+	}
+	pr.model = model
+	modelPaths, err := h.modelScaler.LookupPassthroughPaths(r.Context(), pr.model)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to resolve model: %v", err)
+		return
+	}
+	if !slices.ContainsFunc(modelPaths, func(pattern string) bool {
+		ok, _ := path.Match(pattern, urlPath)
+		return ok
+	}) {
+		pr.sendErrorResponse(w, http.StatusNotFound, "passthrough path not found for model %v: %v", requestedModel, urlPath)
+		return
+	}
+
+	// Buffer the body so that the request can be retried.
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusBadRequest, "unable to read request body: %v", err)
+		return
+	}
+	pr.body = body
+
+	// Send the request to the model server path (without the KubeAI prefix).
+	pr.r = r.Clone(r.Context())
+	pr.r.URL.Path = urlPath
+	pr.r.URL.RawPath = ""
+
+	h.serve(w, pr)
+}
@@ -0,0 +1,99 @@
+package modelproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+)
+
+func TestServePassthrough(t *testing.T) {
+	var backendPaths []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendPaths = append(backendPaths, r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer backend.Close()
+
+	testInf := &testModelInterface{
+		address: backend.Listener.Addr().String(),
+		models: map[string]testMockModel{
+			"embedder": {passthroughPaths: []string{"/v1/search", "/v1/collections/*"}},
+			"other":    {},
+		},
+	}
+	h := NewHandler(testInf, testInf, 0, nil, config.ModelProxy{
+		StreamBufferSize:         64,
+		SlowClientPolicy:         config.SlowClientPolicyBlock,
+		PassthroughPathAllowlist: []string{"/v1/search", "/v1/collections/*", "/v1/load_lora_adapter"},
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openai/v1/models/{model}/passthrough/{path...}", h.ServePassthrough)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cases := map[string]struct {
+		path        string
+		expCode     int
+		expBody     string
+		expBackend  string
+		expBackends int
+	}{
+		"registered path": {
+			path:        "/openai/v1/models/embedder/passthrough/v1/search",
+			expCode:     http.StatusOK,
+			expBody:     `{"query":"hello"}`,
+			expBackend:  "/v1/search",
+			expBackends: 1,
+		},
+		"registered wildcard path": {
+			path:        "/openai/v1/models/embedder/passthrough/v1/collections/docs",
+			expCode:     http.StatusOK,
+			expBody:     `{"query":"hello"}`,
+			expBackend:  "/v1/collections/docs",
+			expBackends: 1,
+		},
+		"allowed but not registered on model": {
+			path:    "/openai/v1/models/other/passthrough/v1/search",
+			expCode: http.StatusNotFound,
+			expBody: `{"error":"passthrough path not found for model other: /v1/search"}` + "\n",
+		},
+		"registered on model but not allowed": {
+			path:    "/openai/v1/models/embedder/passthrough/v1/tokenize",
+			expCode: http.StatusForbidden,
+			expBody: `{"error":"passthrough path not allowed: /v1/tokenize"}` + "\n",
+		},
+		"model not found": {
+			path:    "/openai/v1/models/does-not-exist/passthrough/v1/search",
+			expCode: http.StatusNotFound,
+			expBody: `{"error":"model not found: does-not-exist"}` + "\n",
+		},
+		"unclean path": {
+			path:    "/openai/v1/models/embedder/passthrough/v1/collections/docs/",
+			expCode: http.StatusBadRequest,
+			expBody: `{"error":"invalid passthrough path: /v1/collections/docs/"}` + "\n",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			backendPaths = nil
+			resp, err := http.Post(server.URL+c.path, "application/json", strings.NewReader(`{"query":"hello"}`))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, c.expCode, resp.StatusCode)
+			require.Equal(t, c.expBody, string(body))
+			require.Len(t, backendPaths, c.expBackends)
+			if c.expBackends > 0 {
+				require.Equal(t, c.expBackend, backendPaths[0])
+			}
+		})
+	}
+}
@@ -2,16 +2,25 @@ package modelproxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/bodycodec"
+	"github.com/substratusai/kubeai/internal/echo"
+	"github.com/substratusai/kubeai/internal/engines"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // proxyRequest keeps track of the state of a request that is to be proxied.
@@ -22,21 +31,72 @@ type proxyRequest struct {
 	// body will be stored here if the request body needed to be read
 	// in order to determine the model.
 	body []byte
+	// streamedBody is set instead of body for chunked multipart uploads.
+	streamedBody *streamedBody
+	// params is the decoded JSON body. It is nil for multipart requests.
+	params map[string]interface{}
+
+	// requestCodec is set if the request body was converted to JSON.
+	requestCodec bodycodec.Codec
+	// responseCodec is set if JSON responses should be converted
+	// before they are sent to the client.
+	responseCodec bodycodec.Codec
 
 	selectors []string
+	// defaultModel is the model of requests without a model.
+	defaultModel string
 
 	id             string
+	start          time.Time
 	status         int
 	requestedModel string
 	model          string
 	adapter        string
 	attempt        int
+
+	// maxQueueWait is the maximum amount of time to wait for an
+	// endpoint. Zero means no limit.
+	maxQueueWait time.Duration
+	// queueDeadline is when the max queue wait ends. It is set when the
+	// request first waits for an endpoint so that retries do not reset it.
+	queueDeadline time.Time
+	// coldStart is true if the Model had no ready replicas when
+	// the request was received.
+	coldStart bool
+	// echo is set if the Model uses the Echo engine. It is used
+	// as the transport instead of proxying to an endpoint.
+	echo *echo.Handler
+	// dialect is set if the model server of the Model's engine does not
+	// implement the OpenAI API. backendPath is the path that the request
+	// is sent to on the model server then.
+	dialect     engines.Dialect
+	backendPath string
+	// frontend is set if the request is of an API that is served as a chat
+	// completion request (see toChatCompletion()), frontendParams are the
+	// params of the request then.
+	frontend       *frontend
+	frontendParams map[string]any
+	// usage counts the tokens of completion and chat completion requests
+	// for the token metrics.
+	usage *usageCounter
+	// outputSchema is set if the output of a chat completion request must
+	// match the schema of its response format (see checkStructuredOutput()).
+	// outputRetries counts how often the request was sent again because it
+	// did not.
+	outputSchema  *jsonschema.Schema
+	outputRetries int
+
+	metricAttrs metric.MeasurementOption
+	// coalescedGPUSeconds is the share of the GPU time of the batch that
+	// the request was coalesced into (see proxyCoalesced()).
+	coalescedGPUSeconds float64
 }
 
 func newProxyRequest(r *http.Request) *proxyRequest {
 	pr := &proxyRequest{
 		r:      r,
 		id:     uuid.New().String(),
+		start:  time.Now(),
 		status: http.StatusOK,
 	}
 
@@ -75,6 +135,16 @@ func (pr *proxyRequest) parse() error {
 			return fmt.Errorf("no boundary specified in multipart form data")
 		}
 
+		mr := multipart.NewReader(pr.r.Body, boundary)
+		if pr.r.ContentLength < 0 {
+			// Chunked uploads (i.e. of audio that is still being recorded)
+			// are streamed to the model server instead of being buffered.
+			if err := pr.streamMultipart(mr, boundary); err != nil {
+				return err
+			}
+			break
+		}
+
 		var buf bytes.Buffer
 		mw := multipart.NewWriter(&buf)
 		// Keep the same boundary as the initial request (probably not necessary)
@@ -83,7 +153,6 @@ func (pr *proxyRequest) parse() error {
 		// Iterate over the parts of the multipart form data:
 		// - If the part is named "model", save the value to the proxy request.
 		// - Otherwise, just copy the part to the new multipart writer.
-		mr := multipart.NewReader(pr.r.Body, boundary)
 		for {
 			p, err := mr.NextPart()
 			if err == io.EOF {
@@ -124,13 +193,31 @@ func (pr *proxyRequest) parse() error {
 		// Set a new content length based on the new body - which had the "model" field removed.
 		pr.r.ContentLength = int64(len(pr.body))
 
-	// Assume "application/json":
+	// Assume "application/json" (or an encoding that can be converted to JSON):
 	default:
-		if err := pr.readModelFromBody(pr.r.Body); err != nil {
+		body := pr.r.Body
+		if codec, ok := bodycodec.Lookup(mediaType); ok {
+			// Model servers only accept JSON.
+			encoded, err := io.ReadAll(pr.r.Body)
+			if err != nil {
+				return fmt.Errorf("reading body: %w", err)
+			}
+			jsonBody, err := bodycodec.ToJSON(codec, encoded)
+			if err != nil {
+				return fmt.Errorf("converting body to json: %w", err)
+			}
+			pr.requestCodec = codec
+			pr.r.Header.Set("Content-Type", "application/json")
+			body = io.NopCloser(bytes.NewReader(jsonBody))
+		}
+		if err := pr.readModelFromBody(body); err != nil {
 			return fmt.Errorf("reading model from body: %w", err)
 		}
 	}
 
+	// Respond in the encoding of the request unless the client asks otherwise.
+	pr.responseCodec = bodycodec.Negotiate(pr.r.Header.Get("Accept"), pr.requestCodec)
+
 	return nil
 }
 
@@ -140,6 +227,10 @@ func (pr *proxyRequest) readModelFromBody(r io.ReadCloser) error {
 		return fmt.Errorf("decoding: %w", err)
 	}
 	modelInf, ok := payload["model"]
+	if !ok && pr.defaultModel != "" {
+		modelInf, ok = pr.defaultModel, true
+		payload["model"] = pr.defaultModel
+	}
 	if !ok {
 		return fmt.Errorf("missing 'model' field")
 	}
@@ -150,6 +241,7 @@ func (pr *proxyRequest) readModelFromBody(r io.ReadCloser) error {
 
 	pr.requestedModel = modelStr
 	pr.model, pr.adapter = apiutils.SplitModelAdapter(modelStr)
+	pr.params = payload
 
 	if pr.adapter != "" {
 		// vLLM expects the adapter to be in the model field.
@@ -166,6 +258,124 @@ func (pr *proxyRequest) readModelFromBody(r io.ReadCloser) error {
 	return nil
 }
 
+// resolveAlias replaces the requested model with the Model that it is an
+// alias of, both in the request and in the body that is sent to the model
+// server (which only serves the model by the name of the Model).
+func (pr *proxyRequest) resolveAlias(model string) error {
+	if model == pr.model {
+		return nil
+	}
+	pr.model = model
+	if pr.params == nil || pr.adapter != "" {
+		// Multipart requests are sent without a model and vLLM
+		// expects the adapter in the model field.
+		return nil
+	}
+	pr.params["model"] = model
+	return pr.setParams()
+}
+
+// setParams replaces the JSON body with the (mutated) params.
+func (pr *proxyRequest) setParams() error {
+	body, err := json.Marshal(pr.params)
+	if err != nil {
+		return fmt.Errorf("marshalling: %w", err)
+	}
+	pr.body = body
+	pr.r.ContentLength = int64(len(pr.body))
+	return nil
+}
+
+// apiPath returns the path of the OpenAI API that the request is served with.
+func (pr *proxyRequest) apiPath() string {
+	if pr.frontend != nil {
+		return chatCompletionsPath
+	}
+	return pr.r.URL.Path
+}
+
+// toChatCompletion rewrites a request of a frontend API to the chat completion
+// request that serves it. The response is translated back by
+// translateResponse().
+func (pr *proxyRequest) toChatCompletion(f *frontend) error {
+	params, err := f.chatCompletionParams(pr.params)
+	if err != nil {
+		return err
+	}
+	pr.frontend = f
+	pr.frontendParams = pr.params
+	pr.params = params
+	pr.backendPath = chatCompletionsPath
+	return pr.setParams()
+}
+
+// applyDialect rewrites a JSON request for the dialect of the model server.
+// Multipart requests are sent unchanged.
+func (pr *proxyRequest) applyDialect(d engines.Dialect) error {
+	if pr.params == nil {
+		return nil
+	}
+	path, params, err := engines.RewriteRequest(d, pr.apiPath(), pr.params)
+	if err != nil {
+		return err
+	}
+	pr.dialect = d
+	pr.params = params
+	pr.backendPath = path
+	return pr.setParams()
+}
+
+// rewriteResponse rewrites a successful JSON response of a model server
+// with a dialect.
+func (pr *proxyRequest) rewriteResponse(r *http.Response) error {
+	if pr.dialect == nil || r.StatusCode < 200 || r.StatusCode >= 300 {
+		return nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	rewritten, err := pr.dialect.RewriteResponse(pr.apiPath(), body)
+	if err != nil {
+		return fmt.Errorf("rewriting response: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	r.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+	return nil
+}
+
+// translateResponse translates a successful chat completion response to the
+// response of the frontend API of the request.
+func (pr *proxyRequest) translateResponse(r *http.Response) error {
+	if pr.frontend == nil || r.StatusCode < 200 || r.StatusCode >= 300 {
+		return nil
+	}
+	if isEventStream(r) {
+		r.Body = pr.frontend.newStream(pr.frontendParams, r.Body)
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	translated, err := pr.frontend.fromChatCompletion(pr.frontendParams, body)
+	if err != nil {
+		return fmt.Errorf("translating chat completion: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(translated))
+	r.ContentLength = int64(len(translated))
+	r.Header.Set("Content-Length", strconv.Itoa(len(translated)))
+	return nil
+}
+
 // sendErrorResponse sends an error response to the client and
 // records the status code. If the status code is 5xx, the error
 // message is not included in the response body.
@@ -180,11 +390,32 @@ func (pr *proxyRequest) sendErrorResponse(w http.ResponseWriter, status int, for
 		msg = http.StatusText(status)
 	}
 
-	if err := json.NewEncoder(w).Encode(struct {
+	pr.writeError(w, msg)
+}
+
+// sendUnavailableResponse sends a 503 with a Retry-After header. Unlike other
+// 5xx responses, the message is meant for the client.
+func (pr *proxyRequest) sendUnavailableResponse(w http.ResponseWriter, retryAfter time.Duration, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("sending error response: %v: %v", http.StatusServiceUnavailable, msg)
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	pr.setStatus(w, http.StatusServiceUnavailable)
+	pr.writeError(w, msg)
+}
+
+func (pr *proxyRequest) writeError(w http.ResponseWriter, msg string) {
+	var body any = struct {
 		Error string `json:"error"`
 	}{
 		Error: msg,
-	}); err != nil {
+	}
+	if f := frontends[pr.r.URL.Path]; f != nil && f.errorBody != nil {
+		body = f.errorBody(pr.status, msg)
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
 		log.Printf("error encoding error response: %v", err)
 	}
 }
@@ -202,5 +433,101 @@ func (pr *proxyRequest) httpRequest() *http.Request {
 	if pr.body != nil {
 		clone.Body = io.NopCloser(bytes.NewReader(pr.body))
 	}
+	if pr.streamedBody != nil {
+		clone.Body = pr.streamedBody
+		clone.ContentLength = -1
+	}
+	if pr.responseCodec != nil {
+		clone.Header.Set("Accept", "application/json")
+		// The response is converted, so it should not be compressed.
+		clone.Header.Del("Accept-Encoding")
+	}
 	return clone
 }
+
+// subRequest returns a request for the same Model with other params that is
+// sent on behalf of the request (i.e. with the inputs of coalesced requests).
+func (pr *proxyRequest) subRequest(ctx context.Context, params map[string]any) (*proxyRequest, error) {
+	sub := &proxyRequest{
+		r:              pr.r.WithContext(ctx),
+		id:             uuid.New().String(),
+		start:          time.Now(),
+		status:         http.StatusOK,
+		params:         params,
+		requestedModel: pr.requestedModel,
+		model:          pr.model,
+		adapter:        pr.adapter,
+		maxQueueWait:   pr.maxQueueWait,
+		coldStart:      pr.coldStart,
+		echo:           pr.echo,
+		metricAttrs:    pr.metricAttrs,
+	}
+	if err := sub.setParams(); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// sendBufferedResponse sends a buffered response (i.e. the part of the
+// response to a coalesced request) to the client. JSON bodies are converted
+// with the response codec.
+func (pr *proxyRequest) sendBufferedResponse(w http.ResponseWriter, header http.Header, status int, body []byte) {
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	if mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type")); pr.responseCodec != nil && mediaType == "application/json" {
+		if encoded, err := bodycodec.FromJSON(pr.responseCodec, body); err == nil {
+			body = encoded
+			w.Header().Set("Content-Type", pr.responseCodec.MediaType())
+		}
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	pr.setStatus(w, status)
+	_, _ = w.Write(body)
+}
+
+// responseBuffer is a http.ResponseWriter that buffers a response.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   []byte
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: http.Header{}, status: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header { return b.header }
+
+func (b *responseBuffer) WriteHeader(status int) { b.status = status }
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.body = append(b.body, p...)
+	return len(p), nil
+}
+
+// encodeResponse converts a JSON response body using the response codec.
+// If the body can not be converted, the JSON body is sent instead.
+func (pr *proxyRequest) encodeResponse(r *http.Response) error {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	encoded, err := bodycodec.FromJSON(pr.responseCodec, body)
+	if err != nil {
+		log.Printf("unable to convert response to %s, sending json: %v", pr.responseCodec.MediaType(), err)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(encoded))
+	r.ContentLength = int64(len(encoded))
+	r.Header.Set("Content-Length", strconv.Itoa(len(encoded)))
+	r.Header.Set("Content-Type", pr.responseCodec.MediaType())
+	return nil
+}
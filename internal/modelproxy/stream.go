@@ -0,0 +1,293 @@
+package modelproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/metric"
+)
+
+func isEventStream(r *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// streamBuffer reads server-sent events from the model server ahead of the
+// client, holding at most size events. When the buffer is full the
+// configured SlowClientPolicy is applied.
+type streamBuffer struct {
+	upstream io.ReadCloser
+	size     int
+	policy   string
+
+	ctx         context.Context
+	metricAttrs metric.MeasurementOption
+	// usage counts the tokens of the events. Optional.
+	usage *usageCounter
+
+	mtx  sync.Mutex
+	cond *sync.Cond
+	// events that have been read from upstream but not yet by the client.
+	events [][]byte
+	// current is the remainder of the event that is being read by the client.
+	current []byte
+	// err is the error (i.e. io.EOF) that was encountered reading from upstream.
+	err    error
+	closed bool
+}
+
+func newStreamBuffer(ctx context.Context, upstream io.ReadCloser, cfg config.ModelProxy, metricAttrs metric.MeasurementOption, usage *usageCounter) *streamBuffer {
+	b := &streamBuffer{
+		upstream:    upstream,
+		size:        cfg.StreamBufferSize,
+		policy:      cfg.SlowClientPolicy,
+		ctx:         ctx,
+		metricAttrs: metricAttrs,
+		usage:       usage,
+	}
+	b.cond = sync.NewCond(&b.mtx)
+	go b.fill()
+	return b
+}
+
+// fill reads events from upstream until an error is encountered
+// or the buffer is closed.
+func (b *streamBuffer) fill() {
+	r := bufio.NewReader(b.upstream)
+	for {
+		event, err := readEvent(r)
+		if len(event) > 0 && b.usage != nil && !b.usage.observe(event) {
+			event = nil
+		}
+		if len(event) > 0 && !b.push(event) {
+			b.recordUsage()
+			return
+		}
+		if err != nil {
+			b.recordUsage()
+			b.mtx.Lock()
+			b.err = err
+			b.cond.Broadcast()
+			b.mtx.Unlock()
+			return
+		}
+	}
+}
+
+// recordUsage records the token metrics of the events that were read.
+func (b *streamBuffer) recordUsage() {
+	if b.usage != nil {
+		b.usage.record(b.ctx, b.metricAttrs)
+	}
+}
+
+// push adds an event to the buffer, waiting for the client (i.e. applying
+// backpressure to the model server) if the buffer is full and the events
+// can not be coalesced. It returns false if the buffer was closed.
+func (b *streamBuffer) push(event []byte) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if len(b.events) >= b.size {
+		metrics.InferenceStreamBufferFull.Add(b.ctx, 1, b.metricAttrs)
+	}
+	for len(b.events) >= b.size && !b.closed {
+		if b.policy == config.SlowClientPolicyCoalesce {
+			if n := coalesceEvents(&b.events); n > 0 {
+				metrics.InferenceStreamEventsCoalesced.Add(b.ctx, int64(n), b.metricAttrs)
+				continue
+			}
+		}
+		b.cond.Wait()
+	}
+	if b.closed {
+		return false
+	}
+
+	b.events = append(b.events, event)
+	b.cond.Broadcast()
+	return true
+}
+
+func (b *streamBuffer) Read(p []byte) (int, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for len(b.current) == 0 {
+		if len(b.events) > 0 {
+			b.current = b.events[0]
+			b.events = b.events[1:]
+			b.cond.Broadcast()
+			break
+		}
+		if b.err != nil {
+			return 0, b.err
+		}
+		if b.closed {
+			return 0, errors.New("read on closed stream buffer")
+		}
+		b.cond.Wait()
+	}
+
+	n := copy(p, b.current)
+	b.current = b.current[n:]
+	return n, nil
+}
+
+func (b *streamBuffer) Close() error {
+	b.mtx.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mtx.Unlock()
+	return b.upstream.Close()
+}
+
+// readEvent reads a single server-sent event (including the trailing blank line).
+func readEvent(r *bufio.Reader) ([]byte, error) {
+	var event []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		event = append(event, line...)
+		if err != nil {
+			return event, err
+		}
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return event, nil
+		}
+	}
+}
+
+// coalesceEvents merges adjacent OpenAI streaming chunks in place and
+// returns the number of events that were merged away.
+func coalesceEvents(events *[][]byte) int {
+	in := *events
+	out := in[:1]
+	var merged int
+	for _, e := range in[1:] {
+		if m, ok := mergeChunks(out[len(out)-1], e); ok {
+			out[len(out)-1] = m
+			merged++
+		} else {
+			out = append(out, e)
+		}
+	}
+	*events = out
+	return merged
+}
+
+// mergeChunks merges the text of two OpenAI completion or chat completion
+// chunks ("data: {...}" events). Only chunks that contain nothing other
+// than text are merged so that no information is lost.
+func mergeChunks(a, b []byte) ([]byte, bool) {
+	aChunk, ok := parseChunk(a)
+	if !ok {
+		return nil, false
+	}
+	bChunk, ok := parseChunk(b)
+	if !ok {
+		return nil, false
+	}
+	aChoices, bChoices := aChunk["choices"].([]any), bChunk["choices"].([]any)
+	if len(aChoices) != len(bChoices) {
+		return nil, false
+	}
+	for i := range aChoices {
+		ac, bc := aChoices[i].(map[string]any), bChoices[i].(map[string]any)
+		if ac["index"] != bc["index"] || ac["finish_reason"] != nil {
+			return nil, false
+		}
+	}
+
+	for i := range aChoices {
+		ac, bc := aChoices[i].(map[string]any), bChoices[i].(map[string]any)
+		if text, ok := bc["text"].(string); ok {
+			ac["text"] = stringField(ac, "text") + text
+		}
+		if bDelta, ok := bc["delta"].(map[string]any); ok {
+			aDelta, ok := ac["delta"].(map[string]any)
+			if !ok {
+				aDelta = map[string]any{}
+				ac["delta"] = aDelta
+			}
+			if content, ok := bDelta["content"].(string); ok {
+				aDelta["content"] = stringField(aDelta, "content") + content
+			}
+		}
+		ac["finish_reason"] = bc["finish_reason"]
+	}
+
+	data, err := json.Marshal(aChunk)
+	if err != nil {
+		return nil, false
+	}
+	return append(append([]byte("data: "), data...), '\n', '\n'), true
+}
+
+func stringField(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// Fields that a chunk may contain to be merged. Fields that are only
+// allowed to be null are set to false.
+var (
+	mergeableChunkFields  = map[string]bool{"id": true, "object": true, "created": true, "model": true, "choices": true, "system_fingerprint": true, "usage": false}
+	mergeableChoiceFields = map[string]bool{"index": true, "text": true, "delta": true, "finish_reason": true, "logprobs": false, "stop_reason": false}
+	mergeableDeltaFields  = map[string]bool{"content": true}
+)
+
+// parseChunk parses a "data: {...}" event that only contains
+// mergeable fields.
+func parseChunk(event []byte) (map[string]any, bool) {
+	data, ok := bytes.CutPrefix(bytes.TrimRight(event, "\r\n"), []byte("data: "))
+	if !ok || bytes.ContainsAny(data, "\n") {
+		return nil, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Preserve numbers (i.e. timestamps) as-is.
+	dec.UseNumber()
+	var c map[string]any
+	if err := dec.Decode(&c); err != nil {
+		return nil, false
+	}
+	if !onlyFields(c, mergeableChunkFields) {
+		return nil, false
+	}
+	choices, ok := c["choices"].([]any)
+	if !ok || len(choices) == 0 {
+		return nil, false
+	}
+	for _, choice := range choices {
+		choice, ok := choice.(map[string]any)
+		if !ok || !onlyFields(choice, mergeableChoiceFields) {
+			return nil, false
+		}
+		if d, ok := choice["delta"]; ok {
+			d, ok := d.(map[string]any)
+			if !ok || !onlyFields(d, mergeableDeltaFields) {
+				return nil, false
+			}
+		}
+	}
+	return c, true
+}
+
+func onlyFields(m map[string]any, allowed map[string]bool) bool {
+	for k, v := range m {
+		nonNull, ok := allowed[k]
+		if !ok || (!nonNull && v != nil) {
+			return false
+		}
+	}
+	return true
+}
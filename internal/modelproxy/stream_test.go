@@ -0,0 +1,124 @@
+package modelproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/metrics/metricstest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+func chatChunk(content string, finishReason string) string {
+	fr := "null"
+	if finishReason != "" {
+		fr = fmt.Sprintf("%q", finishReason)
+	}
+	return fmt.Sprintf(`data: {"id":"chat-1","object":"chat.completion.chunk","created":1727000000,"model":"m","choices":[{"index":0,"delta":{"content":%q},"logprobs":null,"finish_reason":%s}]}`+"\n\n", content, fr)
+}
+
+func TestCoalesceEvents(t *testing.T) {
+	events := [][]byte{
+		[]byte(`data: {"id":"chat-1","object":"chat.completion.chunk","created":1727000000,"model":"m","choices":[{"index":0,"delta":{"role":"assistant","content":""},"logprobs":null,"finish_reason":null}]}` + "\n\n"),
+		[]byte(chatChunk("Hello", "")),
+		[]byte(chatChunk(", ", "")),
+		[]byte(chatChunk("world", "stop")),
+		[]byte(chatChunk("!", "")),
+		[]byte("data: [DONE]\n\n"),
+	}
+
+	require.Equal(t, 2, coalesceEvents(&events))
+	require.Len(t, events, 4)
+	require.Contains(t, string(events[0]), `"role":"assistant"`, "chunks with a role should not be merged")
+	requireEventEqual(t, chatChunk("Hello, world", "stop"), string(events[1]))
+	require.Equal(t, chatChunk("!", ""), string(events[2]), "chunks after a finish reason should not be merged")
+	require.Equal(t, "data: [DONE]\n\n", string(events[3]))
+
+	completions := [][]byte{
+		[]byte(`data: {"id":"cmpl-1","object":"text_completion","created":1727000000,"model":"m","choices":[{"index":0,"text":"a","logprobs":null,"finish_reason":null}]}` + "\n\n"),
+		[]byte(`data: {"id":"cmpl-1","object":"text_completion","created":1727000000,"model":"m","choices":[{"index":0,"text":"b","logprobs":null,"finish_reason":null}]}` + "\n\n"),
+	}
+	require.Equal(t, 1, coalesceEvents(&completions))
+	var c struct {
+		Created json.Number `json:"created"`
+		Choices []struct {
+			Text string `json:"text"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(string(completions[0])), "data: ")), &c))
+	require.Equal(t, "ab", c.Choices[0].Text)
+	require.Equal(t, json.Number("1727000000"), c.Created)
+}
+
+func requireEventEqual(t *testing.T, expected, actual string) {
+	t.Helper()
+	require.True(t, strings.HasSuffix(actual, "\n\n"), "event should end with a blank line")
+	require.JSONEq(t,
+		strings.TrimPrefix(strings.TrimSpace(expected), "data: "),
+		strings.TrimPrefix(strings.TrimSpace(actual), "data: "),
+	)
+}
+
+func TestStreamBuffer(t *testing.T) {
+	metricstest.Init(t)
+
+	var upstream strings.Builder
+	var expected strings.Builder
+	for i := 0; i < 100; i++ {
+		upstream.WriteString(chatChunk(fmt.Sprint(i), ""))
+		expected.WriteString(fmt.Sprint(i))
+	}
+	upstream.WriteString("data: [DONE]\n\n")
+
+	readAll := func(t *testing.T, policy string) string {
+		body := io.NopCloser(strings.NewReader(upstream.String()))
+		b := newStreamBuffer(context.Background(), body, config.ModelProxy{StreamBufferSize: 4, SlowClientPolicy: policy},
+			metric.WithAttributeSet(attribute.NewSet()), nil)
+		t.Cleanup(func() { b.Close() })
+
+		// Wait for the buffer to fill up.
+		require.Eventually(t, func() bool {
+			b.mtx.Lock()
+			defer b.mtx.Unlock()
+			return len(b.events) == 4 || b.err != nil
+		}, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+
+		data, err := io.ReadAll(b)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("block", func(t *testing.T) {
+		data := readAll(t, config.SlowClientPolicyBlock)
+		require.Equal(t, upstream.String(), data, "stream should be passed through unchanged")
+	})
+
+	t.Run("coalesce", func(t *testing.T) {
+		data := readAll(t, config.SlowClientPolicyCoalesce)
+		var text strings.Builder
+		for _, event := range strings.Split(strings.TrimSpace(data), "\n\n") {
+			if event == "data: [DONE]" {
+				continue
+			}
+			var c struct {
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &c))
+			text.WriteString(c.Choices[0].Delta.Content)
+		}
+		require.Equal(t, expected.String(), text.String(), "coalesced stream should contain all of the text")
+		require.Less(t, strings.Count(data, "data: "), 101, "events should have been coalesced")
+	})
+}
@@ -0,0 +1,62 @@
+package modelproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// errInvalidOutput is returned by ModifyResponse if the output of a
+// structured output request did not match its schema and the request is
+// sent again.
+var errInvalidOutput = errors.New("output does not match the response format")
+
+// checkStructuredOutput checks that a successful, non-streamed response to a
+// chat completion request with a JSON response format matches the schema
+// of the request (see config.ModelProxyStructuredOutputs). Repaired outputs
+// replace the body of the response.
+func (h *Handler) checkStructuredOutput(pr *proxyRequest, r *http.Response) error {
+	if pr.outputSchema == nil || r.StatusCode < 200 || r.StatusCode >= 300 || isEventStream(r) {
+		return nil
+	}
+	cfg := h.cfg.StructuredOutputs
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	checked, repaired, err := apiutils.CheckStructuredOutput(body, pr.outputSchema, cfg.Repair)
+	var result string
+	switch {
+	case err == nil && repaired:
+		result = metrics.AttrStructuredOutputResultRepaired
+		body = checked
+	case err == nil && pr.outputRetries > 0:
+		result = metrics.AttrStructuredOutputResultRetried
+	case err == nil:
+		result = metrics.AttrStructuredOutputResultValid
+	case pr.outputRetries < cfg.MaxRetries:
+		pr.outputRetries++
+		log.Printf("Retrying request with invalid output (%v/%v): %v: %v", pr.outputRetries, cfg.MaxRetries, pr.id, err)
+		return errInvalidOutput
+	default:
+		log.Printf("Returning invalid output of request %v: %v", pr.id, err)
+		result = metrics.AttrStructuredOutputResultInvalid
+	}
+	metrics.InferenceStructuredOutputs.Add(pr.r.Context(), 1, pr.metricAttrs,
+		metric.WithAttributes(metrics.AttrStructuredOutputResult.String(result)))
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
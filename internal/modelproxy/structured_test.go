@@ -0,0 +1,103 @@
+package modelproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"github.com/substratusai/kubeai/internal/metrics/metricstest"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestHandlerStructuredOutputs(t *testing.T) {
+	metricstest.Init(t)
+
+	// The backend responds with the queued outputs in order.
+	var (
+		mtx     sync.Mutex
+		outputs []string
+	)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		content := outputs[0]
+		outputs = outputs[1:]
+		mtx.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"index": 0, "message": map[string]any{"role": "assistant", "content": content}}},
+		}))
+	}))
+	t.Cleanup(backend.Close)
+
+	models := &testModelInterface{models: map[string]testMockModel{
+		"m": {engine: kubeaiv1.VLLMEngine},
+	}}
+	h := NewHandler(models, staticResolver(backend.Listener.Addr().String()), 3, nil, config.ModelProxy{
+		StructuredOutputs: &config.ModelProxyStructuredOutputs{MaxRetries: 1, Repair: true},
+	})
+	post := func(queued ...string) string {
+		mtx.Lock()
+		outputs = queued
+		mtx.Unlock()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{
+			"model": "m",
+			"messages": [{"role": "user", "content": "name?"}],
+			"response_format": {"type": "json_schema", "json_schema": {"name": "n", "schema": {
+				"type": "object",
+				"properties": {"name": {"type": "string"}},
+				"required": ["name"],
+				"additionalProperties": false
+			}}}
+		}`)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		mtx.Lock()
+		defer mtx.Unlock()
+		require.Empty(t, outputs, "all queued outputs should be requested")
+		var resp struct {
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Choices[0].Message.Content
+	}
+
+	require.Equal(t, `{"name": "a"}`, post(`{"name": "a"}`))
+	require.Equal(t, `{"name": "a"}`, post("```json\n{\"name\": \"a\",}\n```"))
+	require.Equal(t, `{"name": "b"}`, post(`{"nom": "a"}`, `{"name": "b"}`))
+	// The last output is returned if no output matched.
+	require.Equal(t, `Sure!`, post(`I don't know.`, `Sure!`))
+
+	// Schemas that do not compile are rejected before the request is proxied.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{
+		"model": "m",
+		"messages": [{"role": "user", "content": "name?"}],
+		"response_format": {"type": "json_schema", "json_schema": {"name": "n", "schema": {"$ref": "file:///etc/passwd"}}}
+	}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "invalid response_format schema")
+
+	mets := metricstest.Collect(t)
+	attrs := func(result string) attribute.Set {
+		return attribute.NewSet(
+			metrics.AttrRequestModel.String("m"),
+			metrics.AttrRequestType.String(metrics.AttrRequestTypeHTTP),
+			metrics.AttrStructuredOutputResult.String(result),
+		)
+	}
+	metricstest.RequireCounterMetric(t, mets, metrics.InferenceStructuredOutputsMetricName, attrs(metrics.AttrStructuredOutputResultValid), 1)
+	metricstest.RequireCounterMetric(t, mets, metrics.InferenceStructuredOutputsMetricName, attrs(metrics.AttrStructuredOutputResultRepaired), 1)
+	metricstest.RequireCounterMetric(t, mets, metrics.InferenceStructuredOutputsMetricName, attrs(metrics.AttrStructuredOutputResultRetried), 1)
+	metricstest.RequireCounterMetric(t, mets, metrics.InferenceStructuredOutputsMetricName, attrs(metrics.AttrStructuredOutputResultInvalid), 1)
+}
@@ -0,0 +1,69 @@
+package modelproxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/echo"
+	"github.com/substratusai/kubeai/internal/engines"
+)
+
+// tokenizePath returns the path of the tokenize endpoint of the model server
+// of an engine or "" if it has none.
+func tokenizePath(engine string) string {
+	if engine == kubeaiv1.EchoEngine {
+		return echo.TokenizePath
+	}
+	return engines.LookupTokenizePath(engine)
+}
+
+// estimateTokens serves a tokenize or count tokens request for a Model whose
+// model server can not tokenize with the built-in tokenizer, which only
+// estimates the count.
+func (h *Handler) estimateTokens(w http.ResponseWriter, pr *proxyRequest, caps *kubeaiv1.ModelStatusCapabilities) {
+	count, err := apiutils.EstimateTokenCount(pr.params)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	resp := apiutils.TokenizeResponse{Count: count, Estimated: true}
+	if caps != nil {
+		resp.MaxModelLen = caps.MaxContextLength
+	}
+	h.sendTokenizeResponse(w, pr, resp)
+}
+
+// proxyCountTokens serves a count tokens request with the tokenize endpoint
+// of the model server.
+func (h *Handler) proxyCountTokens(w http.ResponseWriter, pr *proxyRequest) {
+	sub, err := pr.subRequest(pr.r.Context(), pr.params)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to create tokenize request: %v", err)
+		return
+	}
+	sub.backendPath = pr.backendPath
+	rec := newResponseBuffer()
+	h.proxyHTTP(rec, sub)
+	if rec.status < 200 || rec.status >= 300 {
+		pr.sendBufferedResponse(w, rec.header, rec.status, rec.body)
+		return
+	}
+	var resp apiutils.TokenizeResponse
+	if err := json.Unmarshal(rec.body, &resp); err != nil {
+		pr.sendErrorResponse(w, http.StatusBadGateway, "unable to decode tokenize response: %v", err)
+		return
+	}
+	resp.Tokens = nil
+	h.sendTokenizeResponse(w, pr, resp)
+}
+
+func (h *Handler) sendTokenizeResponse(w http.ResponseWriter, pr *proxyRequest, resp apiutils.TokenizeResponse) {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		pr.sendErrorResponse(w, http.StatusInternalServerError, "unable to encode response: %v", err)
+		return
+	}
+	pr.sendBufferedResponse(w, http.Header{"Content-Type": {"application/json"}}, http.StatusOK, body)
+}
@@ -0,0 +1,52 @@
+package modelproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	"k8s.io/utils/ptr"
+)
+
+func TestHandlerTokenize(t *testing.T) {
+	models := &testModelInterface{models: map[string]testMockModel{
+		"echo": {engine: kubeaiv1.EchoEngine},
+		// No tokenize path is registered for the engine in this test.
+		"other": {engine: kubeaiv1.OLlamaEngine, capabilities: &kubeaiv1.ModelStatusCapabilities{MaxContextLength: ptr.To[int64](8192)}},
+	}}
+	h := NewHandler(models, blockingResolver{}, 3, nil, config.ModelProxy{
+		StreamBufferSize: 64,
+		SlowClientPolicy: config.SlowClientPolicyBlock,
+	})
+	post := func(path, body string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+		return w.Code, resp
+	}
+
+	// Requests are proxied to the tokenize endpoint of the model server.
+	code, resp := post("/v1/tokenize", `{"model":"echo","prompt":"one two three"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.EqualValues(t, 3, resp["count"])
+	require.Len(t, resp["tokens"], 3)
+
+	code, resp = post("/v1/count_tokens", `{"model":"echo","messages":[{"role":"user","content":"one two"}]}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]any{"count": float64(2)}, resp)
+
+	// Other model servers are not sent requests, the count is estimated.
+	code, resp = post("/v1/count_tokens", `{"model":"other","prompt":"Hello, world!"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]any{"count": float64(4), "max_model_len": float64(8192), "estimated": true}, resp)
+	require.Zero(t, models.hostRequestCount)
+
+	code, _ = post("/v1/tokenize", `{"model":"other"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+}
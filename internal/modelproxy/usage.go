@@ -0,0 +1,136 @@
+package modelproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// usageCounter counts the tokens of a completion or chat completion for the
+// token metrics. Model servers send the usage of streamed responses in the
+// last chunk if it is requested with stream_options.include_usage, which the
+// proxy adds to streamed requests (see countUsage()). Otherwise the
+// tokens are estimated with the built-in tokenizer.
+type usageCounter struct {
+	params map[string]any
+	// strip is true if the usage was requested by the proxy and not by the
+	// client: the chunk with the usage is not sent to the client then.
+	strip bool
+
+	usage *usage
+	// completion estimates the tokens of the generated text of a streamed
+	// response in case the usage is missing.
+	completion apiutils.TextTokenCounter
+	recorded   bool
+}
+
+type usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+// countUsage returns the usageCounter of a completion or chat completion
+// request. If requestStreamUsage is true, the usage of streamed responses is
+// requested from the model server.
+func (pr *proxyRequest) countUsage(requestStreamUsage bool) (*usageCounter, error) {
+	u := &usageCounter{params: pr.params}
+	if stream, _ := pr.params["stream"].(bool); !stream || !requestStreamUsage {
+		return u, nil
+	}
+	opts, _ := pr.params["stream_options"].(map[string]any)
+	if include, _ := opts["include_usage"].(bool); include {
+		return u, nil
+	}
+	if opts == nil {
+		opts = map[string]any{}
+		pr.params["stream_options"] = opts
+	}
+	opts["include_usage"] = true
+	u.strip = true
+	return u, pr.setParams()
+}
+
+// observe counts the tokens of a server-sent event of a streamed response. It
+// returns false if the event must not be sent to the client.
+func (u *usageCounter) observe(event []byte) bool {
+	data, ok := bytes.CutPrefix(bytes.TrimRight(event, "\r\n"), []byte("data: "))
+	if !ok || bytes.Equal(data, []byte("[DONE]")) {
+		return true
+	}
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+			// The text of completions.
+			Text string `json:"text"`
+		} `json:"choices"`
+		Usage *usage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return true
+	}
+	for _, c := range chunk.Choices {
+		u.completion.Write(c.Delta.Content)
+		u.completion.Write(c.Text)
+	}
+	if chunk.Usage != nil {
+		u.usage = chunk.Usage
+		if u.strip && len(chunk.Choices) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// record records the token metrics once. The tokens of streamed responses
+// without usage are estimated.
+func (u *usageCounter) record(ctx context.Context, metricAttrs metric.MeasurementOption) {
+	if u.recorded {
+		return
+	}
+	u.recorded = true
+
+	var estimated bool
+	var prompt, completion int64
+	if u.usage != nil {
+		prompt, completion = u.usage.PromptTokens, u.usage.CompletionTokens
+	} else {
+		estimated = true
+		if n, err := apiutils.EstimateTokenCount(u.params); err == nil {
+			prompt = int64(n)
+		}
+		completion = int64(u.completion.Count())
+	}
+	attrs := metric.WithAttributes(metrics.AttrUsageEstimated.Bool(estimated))
+	metrics.InferencePromptTokens.Add(ctx, prompt, metricAttrs, attrs)
+	metrics.InferenceCompletionTokens.Add(ctx, completion, metricAttrs, attrs)
+}
+
+// usageBody reads the usage of a JSON response once its body was read.
+type usageBody struct {
+	io.ReadCloser
+	buf bytes.Buffer
+	// onEOF is called with the usage of the response (nil if it has none).
+	onEOF func(*usage)
+}
+
+func (b *usageBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if errors.Is(err, io.EOF) && b.onEOF != nil {
+		var resp struct {
+			Usage *usage `json:"usage"`
+		}
+		_ = json.Unmarshal(b.buf.Bytes(), &resp)
+		b.onEOF(resp.Usage)
+		b.onEOF = nil
+	}
+	return n, err
+}
@@ -0,0 +1,72 @@
+package modelproxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"github.com/substratusai/kubeai/internal/metrics/metricstest"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestHandlerUsage(t *testing.T) {
+	metricstest.Init(t)
+
+	// The backend does not send the usage that the proxy requests.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+		require.Equal(t, map[string]any{"include_usage": true}, params["stream_options"])
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"choices":[{"index":0,"delta":{"content":"Hello"}}]}`+"\n\n")
+		io.WriteString(w, `data: {"choices":[{"index":0,"delta":{"content":" there"}}]}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(backend.Close)
+
+	models := &testModelInterface{models: map[string]testMockModel{
+		"echo":  {engine: kubeaiv1.EchoEngine},
+		"other": {engine: kubeaiv1.VLLMEngine},
+	}}
+	h := NewHandler(models, staticResolver(backend.Listener.Addr().String()), 3, nil, config.ModelProxy{
+		StreamBufferSize: 64,
+		SlowClientPolicy: config.SlowClientPolicyBlock,
+	})
+	post := func(body string) string {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w.Body.String()
+	}
+
+	// The usage that the proxy requested is not sent to the client.
+	body := post(`{"model":"echo","stream":true,"messages":[{"role":"user","content":"one two three"}]}`)
+	require.NotContains(t, body, `"usage"`)
+	body = post(`{"model":"echo","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"one two three"}]}`)
+	require.Contains(t, body, `"usage"`)
+	post(`{"model":"echo","messages":[{"role":"user","content":"one two three"}]}`)
+
+	// The tokens of streamed responses without usage are estimated.
+	post(`{"model":"other","stream":true,"messages":[{"role":"user","content":"Hello, world!"}]}`)
+
+	mets := metricstest.Collect(t)
+	attrs := func(model string, estimated bool) attribute.Set {
+		return attribute.NewSet(
+			metrics.AttrRequestModel.String(model),
+			metrics.AttrRequestType.String(metrics.AttrRequestTypeHTTP),
+			metrics.AttrUsageEstimated.Bool(estimated),
+		)
+	}
+	metricstest.RequireCounterMetric(t, mets, metrics.InferencePromptTokensMetricName, attrs("echo", false), 9)
+	metricstest.RequireCounterMetric(t, mets, metrics.InferenceCompletionTokensMetricName, attrs("echo", false), 9)
+	// 4 tokens per message plus "Hello", ",", " world", "!".
+	metricstest.RequireCounterMetric(t, mets, metrics.InferencePromptTokensMetricName, attrs("other", true), 8)
+	metricstest.RequireCounterMetric(t, mets, metrics.InferenceCompletionTokensMetricName, attrs("other", true), 2)
+}
@@ -4,35 +4,84 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
 	"sync"
+	"time"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/cronwindow"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"github.com/substratusai/kubeai/internal/modelnamespaces"
+	"go.opentelemetry.io/otel/metric"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// burstWindow is the period of time after a request for a scaled-to-zero
+// Model arrives in which subsequent requests are counted as part of the same burst.
+const burstWindow = 2 * time.Second
+
+// Event reasons recorded on Models when they are scaled.
+const (
+	EventReasonScaledUp   = "ScaledUp"
+	EventReasonScaledDown = "ScaledDown"
+	// EventReasonScaleRecommended is recorded instead of scaling
+	// Models that have AutoscalingDryRun enabled.
+	EventReasonScaleRecommended = "ScaleRecommended"
+	// EventReasonResourceProfileSwitched is recorded when the autoscaler
+	// switches a Model to another vertical scaling step.
+	EventReasonResourceProfileSwitched = "ResourceProfileSwitched"
+	// EventReasonResourceProfileRecommended is recorded instead of switching
+	// the resource profile of Models that have AutoscalingDryRun enabled.
+	EventReasonResourceProfileRecommended = "ResourceProfileRecommended"
+)
+
 type ModelScaler struct {
-	client                   client.Client
-	namespace                string
+	client client.Client
+	// namespaces that Models are served from, starting with KubeAI's
+	// namespace (see the modelnamespaces package).
+	namespaces               []string
+	recorder                 record.EventRecorder
 	consecutiveScaleDownsMtx sync.RWMutex
 	consecutiveScaleDowns    map[string]int
+	// consecutiveScaleUps is guarded by consecutiveScaleDownsMtx.
+	consecutiveScaleUps map[string]int
+
+	burstsMtx sync.Mutex
+	// map[<model-name>]burst
+	bursts map[string]burst
+
+	recommendationsMtx sync.Mutex
+	// map[<model-name>]<last-recommended-replicas>
+	recommendations map[string]int32
+}
+
+func NewModelScaler(client client.Client, namespaces []string, recorder record.EventRecorder) *ModelScaler {
+	return &ModelScaler{client: client, namespaces: namespaces, recorder: recorder, consecutiveScaleDowns: map[string]int{}, consecutiveScaleUps: map[string]int{}, bursts: map[string]burst{}, recommendations: map[string]int32{}}
 }
 
-func NewModelScaler(client client.Client, namespace string) *ModelScaler {
-	return &ModelScaler{client: client, namespace: namespace, consecutiveScaleDowns: map[string]int{}}
+// burst tracks requests for a Model that arrived shortly after it
+// was observed to be scaled to zero.
+type burst struct {
+	start    time.Time
+	requests int32
 }
 
 // LookupModel checks if a model exists and matches the given label selectors.
-func (s *ModelScaler) LookupModel(ctx context.Context, model, adapter string, labelSelectors []string) (bool, error) {
-	m := &kubeaiv1.Model{}
-	if err := s.client.Get(ctx, types.NamespacedName{Name: model, Namespace: s.namespace}, m); err != nil {
-		if apierrors.IsNotFound(err) {
-			return false, nil
-		}
-		return false, err
+// The model can be requested by the name of a Model or by one of its aliases,
+// the name of the Model is returned.
+func (s *ModelScaler) LookupModel(ctx context.Context, model, adapter string, labelSelectors []string) (string, bool, error) {
+	m, err := s.getModelOrAlias(ctx, model)
+	if err != nil {
+		return "", false, err
+	}
+	if m == nil {
+		return "", false, nil
 	}
 
 	modelLabels := m.GetLabels()
@@ -42,10 +91,10 @@ func (s *ModelScaler) LookupModel(ctx context.Context, model, adapter string, la
 	for _, sel := range labelSelectors {
 		parsedSel, err := labels.Parse(sel)
 		if err != nil {
-			return false, fmt.Errorf("parse label selector: %w", err)
+			return "", false, fmt.Errorf("parse label selector: %w", err)
 		}
 		if !parsedSel.Matches(labels.Set(modelLabels)) {
-			return false, nil
+			return "", false, nil
 		}
 	}
 
@@ -58,29 +107,168 @@ func (s *ModelScaler) LookupModel(ctx context.Context, model, adapter string, la
 			}
 		}
 		if !adapterFound {
-			return false, nil
+			return "", false, nil
 		}
 	}
 
-	return true, nil
+	return m.Name, true, nil
 }
 
-func (s *ModelScaler) ListAllModels(ctx context.Context) ([]kubeaiv1.Model, error) {
-	models := &kubeaiv1.ModelList{}
-	if err := s.client.List(ctx, models, client.InNamespace(s.namespace)); err != nil {
-		return nil, fmt.Errorf("list models: %w", err)
+// getModelOrAlias returns the Model that is served under the given name or
+// alias (nil if there is none, see the modelnamespaces package).
+func (s *ModelScaler) getModelOrAlias(ctx context.Context, name string) (*kubeaiv1.Model, error) {
+	return modelnamespaces.Served(ctx, s.client, s.namespaces, name)
+}
+
+// getModel returns the served Model with the given name.
+func (s *ModelScaler) getModel(ctx context.Context, name string) (*kubeaiv1.Model, error) {
+	m, err := modelnamespaces.Served(ctx, s.client, s.namespaces, name)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, apierrors.NewNotFound(kubeaiv1.GroupVersion.WithResource("models").GroupResource(), name)
 	}
+	return m, nil
+}
+
+// LookupPassthroughPaths returns the passthrough paths of a Model.
+func (s *ModelScaler) LookupPassthroughPaths(ctx context.Context, model string) ([]string, error) {
+	m, err := s.getModel(ctx, model)
+	if err != nil {
+		return nil, fmt.Errorf("get model: %w", err)
+	}
+	return m.Spec.PassthroughPaths, nil
+}
+
+// LookupChatMessageNormalization returns the fixes for the messages of chat
+// completion requests of a Model (nil if none are configured).
+func (s *ModelScaler) LookupChatMessageNormalization(ctx context.Context, model string) (*kubeaiv1.ChatMessageNormalization, error) {
+	m, err := s.getModel(ctx, model)
+	if err != nil {
+		return nil, fmt.Errorf("get model: %w", err)
+	}
+	return m.Spec.ChatMessages, nil
+}
+
+// LookupCapabilities returns the capabilities of a Model that were discovered
+// from its model server (nil if they were not discovered yet).
+func (s *ModelScaler) LookupCapabilities(ctx context.Context, model string) (*kubeaiv1.ModelStatusCapabilities, error) {
+	m, err := s.getModel(ctx, model)
+	if err != nil {
+		return nil, fmt.Errorf("get model: %w", err)
+	}
+	return m.Status.Capabilities, nil
+}
 
-	return models.Items, nil
+// LookupDeprecation returns the deprecation of a Model (nil if it is not
+// deprecated).
+func (s *ModelScaler) LookupDeprecation(ctx context.Context, model string) (*kubeaiv1.ModelDeprecation, error) {
+	m, err := s.getModel(ctx, model)
+	if err != nil {
+		return nil, fmt.Errorf("get model: %w", err)
+	}
+	return m.Spec.Deprecation, nil
 }
 
+// LookupSafetyPolicy returns the safety policy of a Model (nil if its
+// requests are not moderated).
+func (s *ModelScaler) LookupSafetyPolicy(ctx context.Context, model string) (*kubeaiv1.ModelSafetyPolicy, error) {
+	m, err := s.getModel(ctx, model)
+	if err != nil {
+		return nil, fmt.Errorf("get model: %w", err)
+	}
+	return m.Spec.SafetyPolicy, nil
+}
+
+// LookupActive returns true if the Model is within one of its active windows
+// (see Model.spec.activeWindows). Otherwise it also returns the time at which
+// the Model is activated next.
+func (s *ModelScaler) LookupActive(ctx context.Context, model string) (bool, time.Time, error) {
+	m, err := s.getModel(ctx, model)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("get model: %w", err)
+	}
+	active, next, err := cronwindow.ModelActive(m, time.Now())
+	if err != nil {
+		// Invalid windows do not deactivate the Model
+		// (see the Active condition of the Model).
+		log.Printf("unable to evaluate active windows of model %s: %v", model, err)
+		return true, time.Time{}, nil
+	}
+	if active {
+		return true, time.Time{}, nil
+	}
+	return false, next, nil
+}
+
+// LookupEngine returns the engine and the Args of a Model.
+func (s *ModelScaler) LookupEngine(ctx context.Context, model string) (string, []string, error) {
+	m, err := s.getModel(ctx, model)
+	if err != nil {
+		return "", nil, fmt.Errorf("get model: %w", err)
+	}
+	return m.Spec.Engine, m.Spec.Args, nil
+}
+
+// LookupMaxQueueWait returns the maximum amount of time that a request may
+// wait for an endpoint of the Model (zero means no limit) and whether
+// the Model has no ready replicas (i.e. it is scaling from zero).
+func (s *ModelScaler) LookupMaxQueueWait(ctx context.Context, model string) (time.Duration, bool, error) {
+	m, err := s.getModel(ctx, model)
+	if err != nil {
+		return 0, false, fmt.Errorf("get model: %w", err)
+	}
+	return maxQueueWait(m), m.Status.Replicas.Ready == 0, nil
+}
+
+// maxQueueWait returns the max queue wait that applies in the current
+// readiness state of the Model: MaxScaleFromZeroWaitSeconds while no
+// replicas are ready, MaxQueueWaitSeconds otherwise.
+func maxQueueWait(m *kubeaiv1.Model) time.Duration {
+	seconds := m.Spec.MaxQueueWaitSeconds
+	if m.Status.Replicas.Ready == 0 && m.Spec.MaxScaleFromZeroWaitSeconds != nil {
+		seconds = m.Spec.MaxScaleFromZeroWaitSeconds
+	}
+	if seconds == nil {
+		return 0
+	}
+	return time.Duration(*seconds) * time.Second
+}
+
+// ListAllModels returns the served Models of all namespaces (see the
+// modelnamespaces package).
+func (s *ModelScaler) ListAllModels(ctx context.Context) ([]kubeaiv1.Model, error) {
+	return modelnamespaces.ServedModels(ctx, s.client, s.namespaces)
+}
+
+// ScaleAtLeastOneReplica ensures the model is scaled to at least one
+// replica. If the model is scaled from zero, the Models it depends on are
+// scaled from zero too.
+// If a burst of requests arrives for a Model that is scaled to zero, the
+// Model is scaled to enough replicas to serve the whole burst (based on
+// its TargetRequests) instead of a single replica.
 func (s *ModelScaler) ScaleAtLeastOneReplica(ctx context.Context, model string) error {
-	obj := &kubeaiv1.Model{}
-	if err := s.client.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: model}, obj); err != nil {
+	return s.scaleAtLeastOneReplica(ctx, model, map[string]struct{}{}, true)
+}
+
+func (s *ModelScaler) scaleAtLeastOneReplica(ctx context.Context, model string, visited map[string]struct{}, countBurst bool) error {
+	// Guard against dependency cycles.
+	if _, ok := visited[model]; ok {
+		return nil
+	}
+	visited[model] = struct{}{}
+
+	obj, err := s.getModel(ctx, model)
+	if err != nil {
 		return fmt.Errorf("get scale: %w", err)
 	}
 
-	if obj.Spec.AutoscalingDisabled {
+	if obj.Spec.AutoscalingDisabled || obj.Spec.AutoscalingDryRun {
+		return nil
+	}
+	if active, _, err := cronwindow.ModelActive(obj, time.Now()); err == nil && !active {
+		// The Model is kept at zero replicas outside of its active windows.
 		return nil
 	}
 
@@ -89,21 +277,76 @@ func (s *ModelScaler) ScaleAtLeastOneReplica(ctx context.Context, model string)
 		replicas = *obj.Spec.Replicas
 	}
 
-	if replicas == 0 && !obj.Spec.AutoscalingDisabled {
+	if replicas == 0 {
+		// Dependencies are only scaled when the Model is scaled from zero,
+		// afterwards they are autoscaled on their own traffic.
+		for _, dep := range obj.Spec.Dependencies {
+			if err := s.scaleAtLeastOneReplica(ctx, dep, visited, false); err != nil {
+				// A missing or failing dependency should not prevent
+				// the requested model from being scaled.
+				log.Printf("unable to scale dependency %s of model %s: %v", dep, model, err)
+			}
+		}
+	}
+
+	desiredReplicas := int32(1)
+	if countBurst {
+		if n := s.observeBurst(obj.Name, replicas == 0, time.Now()); n > 0 && obj.Spec.TargetRequests != nil {
+			targetRequests := *obj.Spec.TargetRequests
+			if step := obj.Spec.ActiveVerticalScalingStep(); step != nil && step.TargetRequests != nil {
+				targetRequests = *step.TargetRequests
+			}
+			desiredReplicas = enforceReplicaBounds(burstReplicas(n, targetRequests), obj)
+		}
+	}
+
+	if replicas < desiredReplicas {
+		log.Printf("scaling model %s from %d to %d replicas to serve incoming requests", obj.Name, replicas, desiredReplicas)
 		scale := &autoscalingv1.Scale{
-			Spec: autoscalingv1.ScaleSpec{Replicas: 1},
+			Spec: autoscalingv1.ScaleSpec{Replicas: desiredReplicas},
 		}
 		if err := s.client.SubResource("scale").Update(ctx, obj, client.WithSubResourceBody(scale)); err != nil {
 			return fmt.Errorf("update scale: %w", err)
 		}
+		s.recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonScaledUp,
+			"Scaled from %d to %d replicas to serve incoming requests", replicas, desiredReplicas)
 	}
 
 	return nil
 }
 
+// observeBurst records a request for a Model and returns the number of requests
+// in the current burst, or 0 if no burst is in progress. A burst starts when a
+// request arrives for a Model that is scaled to zero and lasts for burstWindow.
+func (s *ModelScaler) observeBurst(model string, scaledToZero bool, now time.Time) int32 {
+	s.burstsMtx.Lock()
+	defer s.burstsMtx.Unlock()
+
+	b, ok := s.bursts[model]
+	if !ok || now.Sub(b.start) > burstWindow {
+		if !scaledToZero {
+			delete(s.bursts, model)
+			return 0
+		}
+		b = burst{start: now}
+	}
+	b.requests++
+	s.bursts[model] = b
+
+	return b.requests
+}
+
+// burstReplicas returns the number of replicas needed to serve a burst of
+// requests given the target number of requests per replica.
+func burstReplicas(requests, targetRequests int32) int32 {
+	return int32(math.Ceil(float64(requests) / float64(targetRequests)))
+}
+
 // Scale scales the model to the desired number of replicas, enforcing the min and max replica bounds.
 // Model should have .Spec defined before calling Scale().
-func (s *ModelScaler) Scale(ctx context.Context, model *kubeaiv1.Model, replicas int32, requiredConsecutiveScaleDowns int) error {
+// The explanation describes why the replicas were chosen and is included
+// in the Event that is recorded on the Model when it is scaled.
+func (s *ModelScaler) Scale(ctx context.Context, model *kubeaiv1.Model, replicas int32, requiredConsecutiveScaleDowns, requiredConsecutiveScaleUps int, explanation string) error {
 	//obj := &kubeaiv1.Model{}
 	//if err := s.client.Get(ctx, types.NamespacedName{Namespace: s.namespace, Name: model}, obj); err != nil {
 	//	return fmt.Errorf("get scale: %w", err)
@@ -116,6 +359,10 @@ func (s *ModelScaler) Scale(ctx context.Context, model *kubeaiv1.Model, replicas
 		existingReplicas = *model.Spec.Replicas
 	}
 
+	metricAttrs := metric.WithAttributes(metrics.AttrRequestModel.String(model.Name))
+	metrics.ModelReplicasDesired.Record(ctx, int64(replicas), metricAttrs)
+	metrics.ModelReplicasActual.Record(ctx, int64(model.Status.Replicas.Ready), metricAttrs)
+
 	if existingReplicas > replicas {
 		// Scale down
 		s.consecutiveScaleDownsMtx.RLock()
@@ -125,16 +372,38 @@ func (s *ModelScaler) Scale(ctx context.Context, model *kubeaiv1.Model, replicas
 			log.Printf("model %s has %d consecutive scale downs (< %d), not scaling down yet", model.Name, consec, requiredConsecutiveScaleDowns)
 			s.consecutiveScaleDownsMtx.Lock()
 			s.consecutiveScaleDowns[model.Name]++
+			s.consecutiveScaleUps[model.Name] = 0
 			s.consecutiveScaleDownsMtx.Unlock()
 			return nil
 		}
+		s.consecutiveScaleDownsMtx.Lock()
+		s.consecutiveScaleUps[model.Name] = 0
+		s.consecutiveScaleDownsMtx.Unlock()
+	} else if existingReplicas < replicas {
+		// Scale up
+		s.consecutiveScaleDownsMtx.Lock()
+		s.consecutiveScaleDowns[model.Name] = 0
+		consec := s.consecutiveScaleUps[model.Name]
+		if consec < requiredConsecutiveScaleUps {
+			log.Printf("model %s has %d consecutive scale ups (< %d), not scaling up yet", model.Name, consec, requiredConsecutiveScaleUps)
+			s.consecutiveScaleUps[model.Name]++
+			s.consecutiveScaleDownsMtx.Unlock()
+			return nil
+		}
+		s.consecutiveScaleDownsMtx.Unlock()
 	} else {
-		// Scale up or constant scale.
+		// Constant scale.
 		s.consecutiveScaleDownsMtx.Lock()
 		s.consecutiveScaleDowns[model.Name] = 0
+		s.consecutiveScaleUps[model.Name] = 0
 		s.consecutiveScaleDownsMtx.Unlock()
 	}
 
+	if model.Spec.AutoscalingDryRun {
+		s.recommend(model, existingReplicas, replicas, explanation)
+		return nil
+	}
+
 	if existingReplicas != replicas {
 		log.Printf("scaling model %s from %d to %d replicas", model.Name, existingReplicas, replicas)
 		scale := &autoscalingv1.Scale{
@@ -143,11 +412,73 @@ func (s *ModelScaler) Scale(ctx context.Context, model *kubeaiv1.Model, replicas
 		if err := s.client.SubResource("scale").Update(ctx, model, client.WithSubResourceBody(scale)); err != nil {
 			return fmt.Errorf("update scale: %w", err)
 		}
+		reason := EventReasonScaledUp
+		if replicas < existingReplicas {
+			reason = EventReasonScaledDown
+		}
+		s.recorder.Eventf(model, corev1.EventTypeNormal, reason,
+			"Scaled from %d to %d replicas: %s", existingReplicas, replicas, explanation)
+	}
+
+	return nil
+}
+
+// SwitchResourceProfile switches the Model to another resource profile and
+// number of replicas at once, which rolls out new Pods (see the
+// VerticalScaling Surge of the Model).
+func (s *ModelScaler) SwitchResourceProfile(ctx context.Context, model *kubeaiv1.Model, resourceProfile string, replicas int32, explanation string) error {
+	existing := model.Spec.ResourceProfile
+	existingReplicas := ptr.Deref(model.Spec.Replicas, 0)
+	replicas = enforceReplicaBounds(replicas, model)
+	if model.Spec.AutoscalingDryRun {
+		s.recorder.Eventf(model, corev1.EventTypeNormal, EventReasonResourceProfileRecommended,
+			"Recommended switching from %d replicas of resource profile %s to %d replicas of %s (dry run): %s",
+			existingReplicas, existing, replicas, resourceProfile, explanation)
+		return nil
+	}
+
+	log.Printf("switching model %s from %d replicas of resource profile %s to %d replicas of %s", model.Name, existingReplicas, existing, replicas, resourceProfile)
+	patch := client.MergeFrom(model.DeepCopy())
+	model.Spec.ResourceProfile = resourceProfile
+	model.Spec.Replicas = ptr.To(replicas)
+	if err := s.client.Patch(ctx, model, patch); err != nil {
+		return fmt.Errorf("patch resource profile: %w", err)
 	}
+	s.recorder.Eventf(model, corev1.EventTypeNormal, EventReasonResourceProfileSwitched,
+		"Switched from %d replicas of resource profile %s to %d replicas of %s: %s",
+		existingReplicas, existing, replicas, resourceProfile, explanation)
+
+	return nil
+}
 
+// UpdateRecommendation writes a right-sizing recommendation to the
+// status of the Model.
+func (s *ModelScaler) UpdateRecommendation(ctx context.Context, model *kubeaiv1.Model, rec *kubeaiv1.ModelStatusRecommendation) error {
+	patch := client.MergeFrom(model.DeepCopy())
+	model.Status.Recommendation = rec
+	if err := s.client.Status().Patch(ctx, model, patch); err != nil {
+		return fmt.Errorf("patch status: %w", err)
+	}
 	return nil
 }
 
+// recommend records an Event on a Model that has AutoscalingDryRun enabled
+// instead of scaling it. To avoid recording the same recommendation on every
+// autoscaling interval, Events are only recorded when the recommendation changes.
+func (s *ModelScaler) recommend(model *kubeaiv1.Model, existingReplicas, replicas int32, explanation string) {
+	s.recommendationsMtx.Lock()
+	last, ok := s.recommendations[model.Name]
+	s.recommendations[model.Name] = replicas
+	s.recommendationsMtx.Unlock()
+
+	if replicas == existingReplicas || (ok && last == replicas) {
+		return
+	}
+	log.Printf("dry run: recommending scaling model %s from %d to %d replicas", model.Name, existingReplicas, replicas)
+	s.recorder.Eventf(model, corev1.EventTypeNormal, EventReasonScaleRecommended,
+		"Recommended scaling from %d to %d replicas (dry run): %s", existingReplicas, replicas, explanation)
+}
+
 func enforceReplicaBounds(replicas int32, model *kubeaiv1.Model) int32 {
 	max := model.Spec.MaxReplicas
 	min := model.Spec.MinReplicas
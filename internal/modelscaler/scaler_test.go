@@ -0,0 +1,246 @@
+package modelscaler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestObserveBurst(t *testing.T) {
+	const model = "my-model"
+	s := NewModelScaler(nil, []string{"default"}, record.NewFakeRecorder(10))
+	t0 := time.Now()
+
+	require.Equal(t, int32(0), s.observeBurst(model, false, t0),
+		"requests for a scaled-up model should not start a burst")
+	require.Equal(t, int32(1), s.observeBurst(model, true, t0))
+	require.Equal(t, int32(2), s.observeBurst(model, false, t0.Add(time.Second)),
+		"requests within the burst window should count even after the model was scaled up")
+	require.Equal(t, int32(3), s.observeBurst(model, true, t0.Add(burstWindow)))
+	require.Equal(t, int32(0), s.observeBurst(model, false, t0.Add(burstWindow+time.Second)),
+		"burst should end after the burst window")
+	require.Equal(t, int32(1), s.observeBurst(model, true, t0.Add(burstWindow+2*time.Second)),
+		"new burst should start when the model is scaled to zero again")
+}
+
+func TestBurstReplicas(t *testing.T) {
+	require.Equal(t, int32(1), burstReplicas(1, 100))
+	require.Equal(t, int32(1), burstReplicas(100, 100))
+	require.Equal(t, int32(2), burstReplicas(101, 100))
+	require.Equal(t, int32(5), burstReplicas(9, 2))
+}
+
+func TestScaleDryRun(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	// A nil client ensures that the Model is never actually scaled.
+	s := NewModelScaler(nil, []string{"default"}, recorder)
+	model := &kubeaiv1.Model{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-model", Namespace: "default"},
+		Spec: kubeaiv1.ModelSpec{
+			Replicas:          ptr.To[int32](1),
+			MaxReplicas:       ptr.To[int32](5),
+			AutoscalingDryRun: true,
+		},
+	}
+	ctx := context.Background()
+
+	require.NoError(t, s.Scale(ctx, model, 3, 0, 0, "reason"))
+	require.Equal(t, "Normal ScaleRecommended Recommended scaling from 1 to 3 replicas (dry run): reason", <-recorder.Events)
+
+	require.NoError(t, s.Scale(ctx, model, 3, 0, 0, "reason"))
+	require.Empty(t, recorder.Events, "unchanged recommendations should not be recorded again")
+
+	require.NoError(t, s.Scale(ctx, model, 10, 0, 0, "reason"))
+	require.Equal(t, "Normal ScaleRecommended Recommended scaling from 1 to 5 replicas (dry run): reason", <-recorder.Events,
+		"recommendations should be within the replica bounds")
+
+	require.NoError(t, s.Scale(ctx, model, 1, 0, 0, "reason"))
+	require.Empty(t, recorder.Events, "recommending the current replicas should not be recorded")
+	require.Equal(t, int32(1), *model.Spec.Replicas)
+}
+
+func TestScaleUpDelay(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	s := NewModelScaler(nil, []string{"default"}, recorder)
+	model := &kubeaiv1.Model{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-model", Namespace: "default"},
+		Spec: kubeaiv1.ModelSpec{
+			Replicas:          ptr.To[int32](1),
+			MaxReplicas:       ptr.To[int32](5),
+			AutoscalingDryRun: true,
+		},
+	}
+	ctx := context.Background()
+
+	require.NoError(t, s.Scale(ctx, model, 3, 0, 2, "reason"))
+	require.NoError(t, s.Scale(ctx, model, 3, 0, 2, "reason"))
+	require.Empty(t, recorder.Events, "scale up should be delayed")
+
+	require.NoError(t, s.Scale(ctx, model, 1, 0, 2, "reason"))
+	require.NoError(t, s.Scale(ctx, model, 3, 0, 2, "reason"))
+	require.Empty(t, recorder.Events, "constant scale should reset the delay")
+
+	require.NoError(t, s.Scale(ctx, model, 3, 0, 2, "reason"))
+	require.NoError(t, s.Scale(ctx, model, 3, 0, 2, "reason"))
+	require.Equal(t, "Normal ScaleRecommended Recommended scaling from 1 to 3 replicas (dry run): reason", <-recorder.Events)
+}
+
+func TestMaxQueueWait(t *testing.T) {
+	model := &kubeaiv1.Model{}
+	require.Zero(t, maxQueueWait(model))
+
+	model.Spec.MaxQueueWaitSeconds = ptr.To[int64](5)
+	require.Equal(t, 5*time.Second, maxQueueWait(model), "max queue wait should apply while scaling from zero by default")
+
+	model.Spec.MaxScaleFromZeroWaitSeconds = ptr.To[int64](300)
+	require.Equal(t, 300*time.Second, maxQueueWait(model))
+
+	model.Status.Replicas.Ready = 1
+	require.Equal(t, 5*time.Second, maxQueueWait(model))
+
+	model.Spec.MaxQueueWaitSeconds = nil
+	require.Zero(t, maxQueueWait(model), "scale from zero wait should not apply to ready replicas")
+}
+
+func TestLookupModelAlias(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kubeaiv1.AddToScheme(scheme))
+	t0 := metav1.NewTime(time.Now().Truncate(time.Second))
+	model := func(name string, created metav1.Time, aliases ...string) *kubeaiv1.Model {
+		return &kubeaiv1.Model{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", CreationTimestamp: created},
+			Spec: kubeaiv1.ModelSpec{
+				Aliases:  aliases,
+				Adapters: []kubeaiv1.Adapter{{Name: "my-adapter"}},
+			},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		model("llama-3.1-8b", t0, "gpt-4o-mini", "gpt-4o"),
+		model("llama-3.1-70b", metav1.NewTime(t0.Add(-time.Hour)), "gpt-4o"),
+		model("gpt-4o-mini-shadow", t0, "llama-3.1-8b"),
+	).Build()
+	s := NewModelScaler(c, []string{"default"}, record.NewFakeRecorder(10))
+	ctx := context.Background()
+
+	cases := []struct {
+		requested, adapter string
+		want               string
+	}{
+		{requested: "llama-3.1-8b", want: "llama-3.1-8b"},
+		{requested: "gpt-4o-mini", want: "llama-3.1-8b"},
+		{requested: "gpt-4o-mini", adapter: "my-adapter", want: "llama-3.1-8b"},
+		// The oldest Model with the alias wins.
+		{requested: "gpt-4o", want: "llama-3.1-70b"},
+		{requested: "gpt-3.5-turbo"},
+		{requested: "gpt-4o-mini", adapter: "other-adapter"},
+	}
+	for _, tc := range cases {
+		name, ok, err := s.LookupModel(ctx, tc.requested, tc.adapter, nil)
+		require.NoError(t, err)
+		require.Equal(t, tc.want != "", ok, tc.requested)
+		require.Equal(t, tc.want, name, tc.requested)
+	}
+}
+
+func TestModelNamespaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kubeaiv1.AddToScheme(scheme))
+	t0 := metav1.Now()
+	model := func(namespace, name string, created metav1.Time, aliases ...string) *kubeaiv1.Model {
+		return &kubeaiv1.Model{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, CreationTimestamp: created},
+			Spec:       kubeaiv1.ModelSpec{Engine: namespace, Aliases: aliases},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		model("kubeai", "llama", t0, "gpt-4o-mini"),
+		model("team-a", "llama", t0),
+		model("team-a", "qwen", metav1.NewTime(t0.Add(time.Hour)), "gpt-4o"),
+		model("team-b", "qwen", t0),
+		model("team-b", "gpt-4o-mini", t0),
+		model("team-b", "gemma", t0),
+		model("other-team", "mistral", t0),
+	).Build()
+	s := NewModelScaler(c, []string{"kubeai", "team-a", "team-b"}, record.NewFakeRecorder(10))
+	ctx := context.Background()
+
+	models, err := s.ListAllModels(ctx)
+	require.NoError(t, err)
+	var served []string
+	for _, m := range models {
+		served = append(served, m.Namespace+"/"+m.Name)
+	}
+	// Models of other namespaces and shadowed Models are not served.
+	require.ElementsMatch(t, []string{"kubeai/llama", "team-b/qwen", "team-b/gemma"}, served)
+
+	// Models of KubeAI's namespace take precedence.
+	engine, _, err := s.LookupEngine(ctx, "llama")
+	require.NoError(t, err)
+	require.Equal(t, "kubeai", engine)
+	name, ok, err := s.LookupModel(ctx, "gpt-4o-mini", "", nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "llama", name)
+
+	// The oldest Model of the team namespaces is served.
+	engine, _, err = s.LookupEngine(ctx, "qwen")
+	require.NoError(t, err)
+	require.Equal(t, "team-b", engine)
+
+	// Aliases of Models in team namespaces are ignored.
+	_, ok, err = s.LookupModel(ctx, "gpt-4o", "", nil)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, ok, err = s.LookupModel(ctx, "mistral", "", nil)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestScaleDependencies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kubeaiv1.AddToScheme(scheme))
+	model := func(name string, replicas int32, deps ...string) *kubeaiv1.Model {
+		return &kubeaiv1.Model{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: kubeaiv1.ModelSpec{
+				Replicas:     ptr.To(replicas),
+				MaxReplicas:  ptr.To[int32](3),
+				Dependencies: deps,
+			},
+		}
+	}
+	var scaled []string
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		model("cold", 0, "cold-dep"),
+		model("cold-dep", 0),
+		model("warm", 1, "warm-dep"),
+		model("warm-dep", 0),
+	).WithInterceptorFuncs(interceptor.Funcs{
+		SubResourceUpdate: func(_ context.Context, _ client.Client, subResource string, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+			require.Equal(t, "scale", subResource)
+			scaled = append(scaled, obj.GetName())
+			return nil
+		},
+	}).Build()
+	s := NewModelScaler(c, []string{"default"}, record.NewFakeRecorder(10))
+	ctx := context.Background()
+
+	require.NoError(t, s.ScaleAtLeastOneReplica(ctx, "cold"))
+	require.Equal(t, []string{"cold-dep", "cold"}, scaled, "dependencies should be scaled from zero with the Model")
+
+	scaled = nil
+	require.NoError(t, s.ScaleAtLeastOneReplica(ctx, "warm"))
+	require.Empty(t, scaled, "dependencies of a scaled up Model should not be scaled")
+}
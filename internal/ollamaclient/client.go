@@ -0,0 +1,66 @@
+package ollamaclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type Client struct {
+	HTTPClient *http.Client
+}
+
+type ShowResponse struct {
+	// Capabilities of the model (i.e. "completion", "vision").
+	Capabilities []string `json:"capabilities"`
+	// ModelInfo is the metadata of the model file, with keys such as
+	// "general.architecture" and "<architecture>.context_length".
+	ModelInfo map[string]any `json:"model_info"`
+}
+
+// ContextLength returns the context length of the model from its metadata.
+func (r *ShowResponse) ContextLength() (int64, bool) {
+	arch, _ := r.ModelInfo["general.architecture"].(string)
+	if arch == "" {
+		return 0, false
+	}
+	// JSON numbers are decoded as float64.
+	n, ok := r.ModelInfo[arch+".context_length"].(float64)
+	return int64(n), ok
+}
+
+// Show the details of a model of the Ollama server.
+// See: https://github.com/ollama/ollama/blob/main/docs/api.md#show-model-information
+func (c *Client) Show(ctx context.Context, addr, model string) (*ShowResponse, error) {
+	body, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling body as json: %w", err)
+	}
+
+	url := addr + "/api/show"
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating http request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("sending http request: POST %s: %w", url, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(httpResp.Body)
+		return nil, fmt.Errorf("unexpected status code: POST %s: %d: %s", url, httpResp.StatusCode, string(respBody))
+	}
+
+	var resp ShowResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decoding response body: %w", err)
+	}
+	return &resp, nil
+}
@@ -14,12 +14,18 @@ import (
 type Handler struct {
 	ModelProxy *modelproxy.Handler
 	K8sClient  client.Client
+	// ModelNamespaces are the namespaces that Models are served from,
+	// starting with KubeAI's own namespace (see modelnamespaces).
+	ModelNamespaces []string
 	http.Handler
 }
 
-func NewHandler(k8sClient client.Client, modelProxy *modelproxy.Handler) *Handler {
+// NewHandler returns the handler of the OpenAI API. The Files and Batches
+// APIs are only served if batchAPI is not nil.
+func NewHandler(k8sClient client.Client, modelNamespaces []string, modelProxy *modelproxy.Handler, batchAPI http.Handler) *Handler {
 	h := &Handler{
-		K8sClient: k8sClient,
+		K8sClient:       k8sClient,
+		ModelNamespaces: modelNamespaces,
 	}
 
 	mux := http.NewServeMux()
@@ -39,7 +45,25 @@ func NewHandler(k8sClient client.Client, modelProxy *modelproxy.Handler) *Handle
 	handle("/openai/v1/completions", http.StripPrefix("/openai", modelProxy))
 	handle("/openai/v1/embeddings", http.StripPrefix("/openai", modelProxy))
 	handle("/openai/v1/audio/transcriptions", http.StripPrefix("/openai", modelProxy))
+	handle("/openai/v1/audio/speech", http.StripPrefix("/openai", modelProxy))
+	handle("/openai/v1/moderations", http.StripPrefix("/openai", modelProxy))
+	handle("/openai/v1/responses", http.StripPrefix("/openai", modelProxy))
+	handle("/openai/v1/tokenize", http.StripPrefix("/openai", modelProxy))
+	handle("/openai/v1/count_tokens", http.StripPrefix("/openai", modelProxy))
 	handle("/openai/v1/models", http.HandlerFunc(h.getModels))
+	// Anthropic Messages API requests are served as chat completions.
+	handle("/anthropic/v1/messages", http.StripPrefix("/anthropic", modelProxy))
+	// Model IDs (i.e. aliases) may contain slashes.
+	handle("/openai/v1/models/{id...}", http.HandlerFunc(h.getModel))
+	// Only paths registered on a Model and allowed by the system's
+	// passthrough path allowlist are proxied.
+	handle("/openai/v1/models/{model}/passthrough/{path...}", http.HandlerFunc(modelProxy.ServePassthrough))
+	if batchAPI != nil {
+		handle("/openai/v1/files", http.StripPrefix("/openai", batchAPI))
+		handle("/openai/v1/files/", http.StripPrefix("/openai", batchAPI))
+		handle("/openai/v1/batches", http.StripPrefix("/openai", batchAPI))
+		handle("/openai/v1/batches/", http.StripPrefix("/openai", batchAPI))
+	}
 
 	// Add HTTP instrumentation for the whole server.
 	h.Handler = otelhttp.NewHandler(mux, "/")
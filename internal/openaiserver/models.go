@@ -2,12 +2,18 @@ package openaiserver
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"slices"
+	"time"
 
 	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
 	"github.com/substratusai/kubeai/internal/apiutils"
+	"github.com/substratusai/kubeai/internal/modelnamespaces"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"sigs.k8s.io/controller-runtime/pkg/client"
+	"k8s.io/utils/ptr"
 )
 
 func (h *Handler) getModels(w http.ResponseWriter, r *http.Request) {
@@ -24,41 +30,10 @@ func (h *Handler) getModels(w http.ResponseWriter, r *http.Request) {
 		features = []string{kubeaiv1.ModelFeatureTextGeneration}
 	}
 
-	var listOpts []client.ListOption
-	headerSelectors := r.Header.Values("X-Label-Selector")
-	for _, sel := range headerSelectors {
-		parsedSel, err := labels.Parse(sel)
-		if err != nil {
-			sendErrorResponse(w, http.StatusBadRequest, "failed to parse label selector: %v", err)
-			return
-		}
-		listOpts = append(listOpts, client.MatchingLabelsSelector{Selector: parsedSel})
-	}
-
-	var k8sModels []kubeaiv1.Model
-	k8sModelNames := map[string]struct{}{}
-	for _, feature := range features {
-		// NOTE: At time of writing an OR query is not supported with the
-		// Kubernetes API server
-		// so we just do multiple queries and merge the results.
-		labelSelector := client.MatchingLabels{kubeaiv1.ModelFeatureLabelDomain + "/" + feature: "true"}
-		list := &kubeaiv1.ModelList{}
-		opts := append([]client.ListOption{labelSelector}, listOpts...)
-		if err := h.K8sClient.List(r.Context(), list, opts...); err != nil {
-			sendErrorResponse(w, http.StatusInternalServerError, "failed to list models: %v", err)
-			return
-		}
-		for _, model := range list.Items {
-			if _, ok := k8sModelNames[model.Name]; !ok {
-				k8sModels = append(k8sModels, model)
-				k8sModelNames[model.Name] = struct{}{}
-			}
-		}
-	}
-
-	models := make([]Model, 0)
-	for _, k8sModel := range k8sModels {
-		models = append(models, k8sModelToOpenAIModels(k8sModel)...)
+	models, status, err := h.listModels(r, features)
+	if err != nil {
+		sendErrorResponse(w, status, "%v", err)
+		return
 	}
 
 	// Wrapper struct to match the desired output format
@@ -76,6 +51,86 @@ func (h *Handler) getModels(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getModel returns a single model (or adapter or alias) by its ID.
+// Example: /v1/models/llama-3.1-8b-instruct
+func (h *Handler) getModel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	id := r.PathValue("id")
+	models, status, err := h.listModels(r, nil)
+	if err != nil {
+		sendErrorResponse(w, status, "%v", err)
+		return
+	}
+	for _, m := range models {
+		if m.ID == id {
+			if err := json.NewEncoder(w).Encode(m); err != nil {
+				sendErrorResponse(w, http.StatusInternalServerError, "failed to encode response: %v", err)
+			}
+			return
+		}
+	}
+	sendErrorResponse(w, http.StatusNotFound, "model not found: %s", id)
+}
+
+// listModels returns the models (including adapters and aliases) of the
+// served Models with any of the features (all Models if empty) that match
+// the label selectors of the "X-Label-Selector" headers. Aliases are only
+// listed for the Models of KubeAI's namespace, which are the only Models
+// that are served by alias. The returned status is the HTTP status code of
+// the error.
+func (h *Handler) listModels(r *http.Request, features []string) ([]Model, int, error) {
+	var selectors []labels.Selector
+	for _, sel := range r.Header.Values("X-Label-Selector") {
+		parsedSel, err := labels.Parse(sel)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("failed to parse label selector: %w", err)
+		}
+		selectors = append(selectors, parsedSel)
+	}
+
+	// The selectors are matched after listing the served Models because
+	// Models that do not match them can still shadow Models in other
+	// namespaces.
+	k8sModels, err := modelnamespaces.ServedModels(r.Context(), h.K8sClient, h.ModelNamespaces)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to list models: %w", err)
+	}
+
+	models := make([]Model, 0)
+	for _, k8sModel := range k8sModels {
+		if !matchesModel(k8sModel, selectors, features) {
+			continue
+		}
+		if k8sModel.Namespace != h.ModelNamespaces[0] {
+			k8sModel.Spec.Aliases = nil
+		}
+		models = append(models, k8sModelToOpenAIModels(k8sModel)...)
+	}
+	return models, http.StatusOK, nil
+}
+
+// matchesModel returns true if the labels of a Model match all selectors
+// and any of the features (or features is empty).
+func matchesModel(m kubeaiv1.Model, selectors []labels.Selector, features []string) bool {
+	set := labels.Set(m.Labels)
+	for _, sel := range selectors {
+		if !sel.Matches(set) {
+			return false
+		}
+	}
+	if len(features) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(features, func(feature string) bool {
+		return set[kubeaiv1.ModelFeatureLabelDomain+"/"+feature] == "true"
+	})
+}
+
 // Model is a struct that represents a model object
 // from the OpenAI API.
 type Model struct {
@@ -87,13 +142,68 @@ type Model struct {
 	// Adiditional (non-OpenAI) fields
 
 	Features []kubeaiv1.ModelFeature `json:"features,omitempty"`
+
+	// Parent is the Model of an adapter or alias.
+	Parent string `json:"parent,omitempty"`
+	// Aliases of the Model. Not set for adapters and aliases.
+	Aliases []string `json:"aliases,omitempty"`
+
+	// Ready is true while at least one replica of the Model is ready.
+	// Requests for Models that are not ready wait for a replica (i.e. while
+	// the Model is scaled from zero).
+	Ready bool `json:"ready"`
+	// Status is the reason of the Ready condition of the Model
+	// (i.e. "ReplicasReady", "ScaledToZero" or "Loading").
+	Status       string            `json:"status,omitempty"`
+	Replicas     ModelReplicas     `json:"replicas"`
+	Capabilities ModelCapabilities `json:"capabilities"`
+
+	// Set for deprecated Models (see Model.spec.deprecation).
+	Deprecated       bool   `json:"deprecated,omitempty"`
+	SunsetDate       string `json:"sunset_date,omitempty"`
+	ReplacementModel string `json:"replacement_model,omitempty"`
+}
+
+type ModelReplicas struct {
+	// Desired is the number of replicas that the Model is scaled to.
+	Desired int32 `json:"desired"`
+	Ready   int32 `json:"ready"`
+	// All replicas, including replicas that are not ready yet.
+	All int32 `json:"all"`
+}
+
+// ModelCapabilities are the capabilities of a model, based on its features
+// and the capabilities that were discovered from its model server.
+type ModelCapabilities struct {
+	// ContextLength is the maximum number of tokens of the prompt and the
+	// generated tokens of a request. Not set until it was discovered from a
+	// ready replica.
+	ContextLength  *int64 `json:"context_length,omitempty"`
+	Vision         bool   `json:"vision"`
+	TextGeneration bool   `json:"text_generation"`
+	Embeddings     bool   `json:"embeddings"`
+	SpeechToText   bool   `json:"speech_to_text"`
+	TextToSpeech   bool   `json:"text_to_speech"`
+	Moderation     bool   `json:"moderation"`
 }
 
 func k8sModelToOpenAIModels(k8sM kubeaiv1.Model) []Model {
-	models := make([]Model, 1+len(k8sM.Spec.Adapters))
-	models[0] = constructOpenAIModel(k8sM, "")
-	for i, adapter := range k8sM.Spec.Adapters {
-		models[i+1] = constructOpenAIModel(k8sM, adapter.Name)
+	models := make([]Model, 0, 1+len(k8sM.Spec.Adapters)+len(k8sM.Spec.Aliases))
+	base := constructOpenAIModel(k8sM, "")
+	base.Aliases = k8sM.Spec.Aliases
+	models = append(models, base)
+	for _, adapter := range k8sM.Spec.Adapters {
+		m := constructOpenAIModel(k8sM, adapter.Name)
+		m.Parent = k8sM.Name
+		models = append(models, m)
+	}
+	// Aliases are listed so that clients which check for a model before
+	// requesting it find the alias.
+	for _, alias := range k8sM.Spec.Aliases {
+		m := constructOpenAIModel(k8sM, "")
+		m.ID = alias
+		m.Parent = k8sM.Name
+		models = append(models, m)
 	}
 	return models
 }
@@ -104,6 +214,37 @@ func constructOpenAIModel(k8sM kubeaiv1.Model, adapter string) Model {
 	m.Created = k8sM.CreationTimestamp.Unix()
 	m.Object = "model"
 	m.OwnedBy = k8sM.Spec.Owner
+	if owner := k8sM.Labels[kubeaiv1.ModelOwnedByLabel]; owner != "" {
+		m.OwnedBy = owner
+	}
 	m.Features = k8sM.Spec.Features
+
+	if ready := meta.FindStatusCondition(k8sM.Status.Conditions, kubeaiv1.ModelConditionReady); ready != nil {
+		m.Ready = ready.Status == metav1.ConditionTrue
+		m.Status = ready.Reason
+	}
+	m.Replicas = ModelReplicas{
+		Desired: ptr.Deref(k8sM.Spec.Replicas, 0),
+		Ready:   k8sM.Status.Replicas.Ready,
+		All:     k8sM.Status.Replicas.All,
+	}
+	m.Capabilities = ModelCapabilities{
+		TextGeneration: slices.Contains(k8sM.Spec.Features, kubeaiv1.ModelFeatureTextGeneration),
+		Embeddings:     slices.Contains(k8sM.Spec.Features, kubeaiv1.ModelFeatureTextEmbedding),
+		SpeechToText:   slices.Contains(k8sM.Spec.Features, kubeaiv1.ModelFeatureSpeechToText),
+		TextToSpeech:   slices.Contains(k8sM.Spec.Features, kubeaiv1.ModelFeatureTextToSpeech),
+		Moderation:     slices.Contains(k8sM.Spec.Features, kubeaiv1.ModelFeatureModeration),
+	}
+	if caps := k8sM.Status.Capabilities; caps != nil {
+		m.Capabilities.ContextLength = caps.MaxContextLength
+		m.Capabilities.Vision = ptr.Deref(caps.Vision, false)
+	}
+	if d := k8sM.Spec.Deprecation; d != nil && d.Deprecated {
+		m.Deprecated = true
+		if d.SunsetDate != nil {
+			m.SunsetDate = d.SunsetDate.UTC().Format(time.RFC3339)
+		}
+		m.ReplacementModel = d.ReplacementModel
+	}
 	return m
 }
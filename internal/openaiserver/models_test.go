@@ -0,0 +1,138 @@
+package openaiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestModels(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kubeaiv1.AddToScheme(scheme))
+	llm := &kubeaiv1.Model{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "llm", Labels: map[string]string{
+			kubeaiv1.ModelFeatureLabelDomain + "/" + kubeaiv1.ModelFeatureTextGeneration: "true",
+			kubeaiv1.ModelOwnedByLabel: "team-a",
+		}},
+		Spec: kubeaiv1.ModelSpec{
+			Features: []kubeaiv1.ModelFeature{kubeaiv1.ModelFeatureTextGeneration},
+			Replicas: ptr.To[int32](2),
+			Aliases:  []string{"openai/gpt-4o-mini"},
+			Adapters: []kubeaiv1.Adapter{{Name: "sql", URL: "hf://sql"}},
+		},
+		Status: kubeaiv1.ModelStatus{
+			Replicas: kubeaiv1.ModelStatusReplicas{All: 2, Ready: 1},
+			Capabilities: &kubeaiv1.ModelStatusCapabilities{
+				MaxContextLength: ptr.To[int64](8192),
+				Vision:           ptr.To(true),
+			},
+			Conditions: []metav1.Condition{{
+				Type:   kubeaiv1.ModelConditionReady,
+				Status: metav1.ConditionTrue,
+				Reason: kubeaiv1.ModelReasonReplicasReady,
+			}},
+		},
+	}
+	embedder := &kubeaiv1.Model{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "embedder", Labels: map[string]string{
+			kubeaiv1.ModelFeatureLabelDomain + "/" + kubeaiv1.ModelFeatureTextEmbedding: "true",
+		}},
+		Spec: kubeaiv1.ModelSpec{Features: []kubeaiv1.ModelFeature{kubeaiv1.ModelFeatureTextEmbedding}},
+	}
+	// Models in team namespaces are listed unless they are shadowed, but
+	// without their aliases, which are not served.
+	teamModel := &kubeaiv1.Model{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "team-llm", Labels: map[string]string{
+			kubeaiv1.ModelFeatureLabelDomain + "/" + kubeaiv1.ModelFeatureTextGeneration: "true",
+		}},
+		Spec: kubeaiv1.ModelSpec{
+			Features: []kubeaiv1.ModelFeature{kubeaiv1.ModelFeatureTextGeneration},
+			Aliases:  []string{"team-alias"},
+		},
+	}
+	shadowedModel := &kubeaiv1.Model{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "embedder", Labels: map[string]string{
+			kubeaiv1.ModelFeatureLabelDomain + "/" + kubeaiv1.ModelFeatureTextGeneration: "true",
+		}},
+		Spec: kubeaiv1.ModelSpec{Features: []kubeaiv1.ModelFeature{kubeaiv1.ModelFeatureTextGeneration}},
+	}
+	h := &Handler{
+		K8sClient:       fake.NewClientBuilder().WithScheme(scheme).WithObjects(llm, embedder, teamModel, shadowedModel).Build(),
+		ModelNamespaces: []string{"default", "team-b"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openai/v1/models", h.getModels)
+	mux.HandleFunc("/openai/v1/models/{id...}", h.getModel)
+
+	get := func(path string, wantStatus int, v any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, wantStatus, w.Code, w.Body.String())
+		if v != nil {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(v))
+		}
+	}
+
+	var list struct {
+		Data []Model `json:"data"`
+	}
+	get("/openai/v1/models", http.StatusOK, &list)
+	require.Len(t, list.Data, 4)
+	m := list.Data[0]
+	require.Equal(t, "llm", m.ID)
+	require.Equal(t, "team-a", m.OwnedBy)
+	require.True(t, m.Ready)
+	require.Equal(t, kubeaiv1.ModelReasonReplicasReady, m.Status)
+	require.Equal(t, ModelReplicas{Desired: 2, Ready: 1, All: 2}, m.Replicas)
+	require.Equal(t, ModelCapabilities{ContextLength: ptr.To[int64](8192), Vision: true, TextGeneration: true}, m.Capabilities)
+	require.Equal(t, []string{"openai/gpt-4o-mini"}, m.Aliases)
+	require.Equal(t, "llm_sql", list.Data[1].ID)
+	require.Equal(t, "llm", list.Data[1].Parent)
+
+	// Aliases (with slashes) can be retrieved.
+	var alias Model
+	get("/openai/v1/models/openai/gpt-4o-mini", http.StatusOK, &alias)
+	require.Equal(t, "openai/gpt-4o-mini", alias.ID)
+	require.Equal(t, "llm", alias.Parent)
+
+	// Models of all features can be retrieved.
+	var embedderModel Model
+	get("/openai/v1/models/embedder", http.StatusOK, &embedderModel)
+	require.False(t, embedderModel.Ready)
+	require.True(t, embedderModel.Capabilities.Embeddings)
+
+	require.Equal(t, "team-llm", list.Data[3].ID)
+	require.Empty(t, list.Data[3].Aliases)
+	get("/openai/v1/models/team-alias", http.StatusNotFound, nil)
+
+	// The shadowed Model of the team namespace is not listed.
+	get("/openai/v1/models?feature=TextEmbedding&feature=TextGeneration", http.StatusOK, &list)
+	var ids []string
+	for _, m := range list.Data {
+		ids = append(ids, m.ID)
+	}
+	require.ElementsMatch(t, []string{"embedder", "llm", "llm_sql", "openai/gpt-4o-mini", "team-llm"}, ids)
+
+	// Label selectors are matched.
+	var selected struct {
+		Data []Model `json:"data"`
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/openai/v1/models", nil)
+	req.Header.Set("X-Label-Selector", kubeaiv1.ModelOwnedByLabel+"=team-a")
+	mux.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&selected))
+	require.Len(t, selected.Data, 3)
+
+	get("/openai/v1/models/unknown", http.StatusNotFound, nil)
+}
@@ -0,0 +1,110 @@
+package requestindex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// metadataParamPrefix is the prefix of query parameters that filter
+// requests by metadata (i.e. "metadata.batch-id=123").
+const metadataParamPrefix = "metadata."
+
+// NewHandler returns an API handler for querying the index:
+//
+//	GET /requests      - List requests, filtered by the "status", "model", "stream",
+//	                     and "metadata.<key>" query parameters (at most "limit" requests,
+//	                     default 100, max MaxLimit). The "next_page_token" of the response
+//	                     is passed as the "page_token" parameter to list the next page.
+//	GET /requests/{id} - Get a request by the ID of its request message.
+func (i *Index) NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /requests", func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		records, next, err := i.List(r.Context(), f)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		if records == nil {
+			records = []Record{}
+		}
+		resp := map[string]any{"requests": records}
+		if next != "" {
+			resp["next_page_token"] = next
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+	mux.HandleFunc("GET /requests/{id}", func(w http.ResponseWriter, r *http.Request) {
+		record, err := i.Get(r.Context(), r.PathValue("id"))
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				writeError(w, http.StatusNotFound, "request not found: %v", r.PathValue("id"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, record)
+	})
+	return mux
+}
+
+func parseFilter(r *http.Request) (Filter, error) {
+	q := r.URL.Query()
+	f := Filter{
+		Status:    Status(q.Get("status")),
+		Model:     q.Get("model"),
+		Stream:    q.Get("stream"),
+		Limit:     100,
+		PageToken: q.Get("page_token"),
+	}
+	switch f.Status {
+	case "", StatusRunning, StatusSucceeded, StatusFailed:
+	default:
+		return f, fmt.Errorf("invalid status: %q", f.Status)
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return f, fmt.Errorf("invalid limit: %q (must be between 1 and %d)", limit, MaxLimit)
+		}
+		f.Limit = n
+	}
+	if f.PageToken != "" {
+		if _, err := parsePageToken(f.PageToken); err != nil {
+			return f, err
+		}
+	}
+	for k, v := range q {
+		key, ok := strings.CutPrefix(k, metadataParamPrefix)
+		if !ok {
+			continue
+		}
+		if key == "" || strings.Contains(key, ".") {
+			return f, fmt.Errorf("invalid metadata key: %q", key)
+		}
+		if f.Metadata == nil {
+			f.Metadata = map[string]string{}
+		}
+		f.Metadata[key] = v[0]
+	}
+	return f, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,318 @@
+// Package requestindex records the status of asynchronous (messaging)
+// requests in a document store so that they can be queried by ID or
+// filtered by metadata.
+package requestindex
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gocloud.dev/docstore"
+	"gocloud.dev/gcerrors"
+)
+
+// Status of an indexed request.
+type Status string
+
+const (
+	StatusRunning   Status = "Running"
+	StatusSucceeded Status = "Succeeded"
+	StatusFailed    Status = "Failed"
+)
+
+// MaxLimit is the maximum number of requests that are returned by a
+// single List call.
+const MaxLimit = 1000
+
+// ErrNotFound is returned by Get for requests that are not indexed.
+var ErrNotFound = errors.New("request not found")
+
+// Record is the indexed status of a request message.
+type Record struct {
+	// ID is the ID of the request message (the "request_message_id"
+	// metadata of the response message).
+	ID     string `docstore:"id" json:"id"`
+	Stream string `docstore:"stream" json:"stream"`
+	Model  string `docstore:"model" json:"model,omitempty"`
+	Path   string `docstore:"path" json:"path,omitempty"`
+	Status Status `docstore:"status" json:"status"`
+	// StatusCode of the response. Not set while the request is running.
+	StatusCode int `docstore:"status_code" json:"status_code,omitempty"`
+	// Metadata contains the string values of the request metadata.
+	Metadata map[string]string `docstore:"metadata" json:"metadata,omitempty"`
+	// ResultURL is the topic that the response is published to.
+	ResultURL string `docstore:"result_url" json:"result_url,omitempty"`
+	// Batch is only set for batch request messages.
+	Batch *BatchStatus `docstore:"batch" json:"batch,omitempty"`
+	// GPUSeconds is the approximate GPU time that was used by the request
+	// (the time on the model server times the GPUs of the model server
+	// divided by its concurrent requests). Not set for batch request messages.
+	GPUSeconds float64   `docstore:"gpu_seconds" json:"gpu_seconds,omitempty"`
+	CreatedAt  time.Time `docstore:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `docstore:"updated_at" json:"updated_at"`
+}
+
+// BatchStatus is the progress of a batch request message.
+type BatchStatus struct {
+	Total     int `docstore:"total" json:"total"`
+	Completed int `docstore:"completed" json:"completed"`
+	Failed    int `docstore:"failed" json:"failed"`
+}
+
+// Filter selects the requests returned by List. Empty fields match
+// all requests.
+type Filter struct {
+	Status   Status
+	Model    string
+	Stream   string
+	Metadata map[string]string
+	// Limit is the maximum number of (most recently created) requests
+	// to return. Zero or values above MaxLimit mean MaxLimit.
+	Limit int
+	// PageToken continues a previous List call with the same filter
+	// (the next page token that it returned).
+	PageToken string
+}
+
+// Index is a collection of request records.
+type Index struct {
+	coll      *docstore.Collection
+	retention time.Duration
+	now       func() time.Time
+}
+
+// Open opens the collection at the given URL
+// (see https://gocloud.dev/howto/docstore/). The key field of the
+// collection must be "id". Records are removed once they have not been
+// updated for the retention period.
+func Open(ctx context.Context, url string, retention time.Duration) (*Index, error) {
+	coll, err := docstore.OpenCollection(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("opening collection: %w", err)
+	}
+	return newIndex(coll, retention), nil
+}
+
+func newIndex(coll *docstore.Collection, retention time.Duration) *Index {
+	return &Index{coll: coll, retention: retention, now: time.Now}
+}
+
+// Put creates or replaces the record of a request. UpdatedAt is set to
+// the current time.
+func (i *Index) Put(ctx context.Context, r *Record) error {
+	r.UpdatedAt = i.now()
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = r.UpdatedAt
+	}
+	return i.coll.Put(ctx, r)
+}
+
+// Get returns the record of a request or ErrNotFound.
+func (i *Index) Get(ctx context.Context, id string) (*Record, error) {
+	r := &Record{ID: id}
+	if err := i.coll.Get(ctx, r); err != nil {
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// List returns the records that match the filter, most recently
+// created first, and the token of the next page (empty on the last page).
+func (i *Index) List(ctx context.Context, f Filter) ([]Record, string, error) {
+	limit := f.Limit
+	if limit <= 0 || limit > MaxLimit {
+		limit = MaxLimit
+	}
+	var after *cursor
+	if f.PageToken != "" {
+		c, err := parsePageToken(f.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &c
+	}
+
+	q := i.coll.Query()
+	if f.Status != "" {
+		q = q.Where("status", "=", string(f.Status))
+	}
+	if f.Model != "" {
+		q = q.Where("model", "=", f.Model)
+	}
+	if f.Stream != "" {
+		q = q.Where("stream", "=", f.Stream)
+	}
+	for k, v := range f.Metadata {
+		q = q.Where(docstore.FieldPath("metadata."+k), "=", v)
+	}
+
+	if after != nil {
+		q = q.Where("created_at", "<=", after.createdAt)
+	}
+
+	// Not all providers support ordering by arbitrary fields, so the
+	// newest matches are selected while iterating, keeping at most one
+	// more record than the page in memory.
+	iter := q.Get(ctx)
+	defer iter.Stop()
+	page := &recordHeap{}
+	for {
+		var r Record
+		err := iter.Next(ctx, &r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("querying requests: %w", err)
+		}
+		if after != nil && !after.before(&r) {
+			continue
+		}
+		heap.Push(page, r)
+		if page.Len() > limit+1 {
+			heap.Pop(page)
+		}
+	}
+
+	records := []Record(*page)
+	sort.Slice(records, func(a, b int) bool { return newer(&records[a], &records[b]) })
+	var next string
+	if len(records) > limit {
+		records = records[:limit]
+		last := records[limit-1]
+		next = cursor{createdAt: last.CreatedAt, id: last.ID}.pageToken()
+	}
+	return records, next, nil
+}
+
+// newer reports whether a is listed before b: ordered by creation time and
+// then by ID, both descending.
+func newer(a, b *Record) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+// recordHeap is a min-heap of the records of a page: the record that is
+// listed last is at the top.
+type recordHeap []Record
+
+func (h recordHeap) Len() int           { return len(h) }
+func (h recordHeap) Less(a, b int) bool { return newer(&h[b], &h[a]) }
+func (h recordHeap) Swap(a, b int)      { h[a], h[b] = h[b], h[a] }
+func (h *recordHeap) Push(x any)        { *h = append(*h, x.(Record)) }
+func (h *recordHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// cursor is the position of the last record of a page.
+type cursor struct {
+	createdAt time.Time
+	id        string
+}
+
+// before reports whether the cursor is listed before the record (the
+// record belongs to a later page).
+func (c cursor) before(r *Record) bool {
+	return newer(&Record{ID: c.id, CreatedAt: c.createdAt}, r)
+}
+
+func (c cursor) pageToken() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.createdAt.UTC().Format(time.RFC3339Nano) + " " + c.id))
+}
+
+func parsePageToken(token string) (cursor, error) {
+	invalid := fmt.Errorf("invalid page token: %q", token)
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor{}, invalid
+	}
+	ts, id, ok := strings.Cut(string(b), " ")
+	if !ok {
+		return cursor{}, invalid
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return cursor{}, invalid
+	}
+	return cursor{createdAt: createdAt, id: id}, nil
+}
+
+// Start periodically removes records that have outlived the retention
+// period until the context is cancelled.
+func (i *Index) Start(ctx context.Context) {
+	ticker := time.NewTicker(max(i.retention/10, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := i.expire(ctx)
+		if err != nil {
+			log.Printf("Failed to remove expired requests from index: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Removed %d expired requests from index", n)
+		}
+	}
+}
+
+// expire removes records that were last updated before the retention
+// period and returns the number of removed records.
+func (i *Index) expire(ctx context.Context) (int, error) {
+	expired, err := getAll(ctx, i.coll.Query().Where("updated_at", "<", i.now().Add(-i.retention)).Get(ctx))
+	if err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	actions := i.coll.Actions()
+	for j := range expired {
+		actions.Delete(&expired[j])
+	}
+	if err := actions.Do(ctx); err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+// Close closes the collection (which persists in-memory collections
+// that are configured with a filename).
+func (i *Index) Close() error {
+	return i.coll.Close()
+}
+
+func getAll(ctx context.Context, iter *docstore.DocumentIterator) ([]Record, error) {
+	defer iter.Stop()
+	var records []Record
+	for {
+		var r Record
+		err := iter.Next(ctx, &r)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("querying requests: %w", err)
+		}
+		records = append(records, r)
+	}
+}
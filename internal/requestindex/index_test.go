@@ -0,0 +1,161 @@
+package requestindex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/docstore/memdocstore"
+)
+
+func newTestIndex(t *testing.T) *Index {
+	coll, err := memdocstore.OpenCollection("id", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { coll.Close() })
+	return newIndex(coll, time.Hour)
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+	t0 := time.Now()
+	idx.now = func() time.Time { return t0 }
+
+	require.NoError(t, idx.Put(ctx, &Record{ID: "a", Stream: "0", Model: "m1", Status: StatusRunning, Metadata: map[string]string{"team": "x"}}))
+	idx.now = func() time.Time { return t0.Add(time.Minute) }
+	require.NoError(t, idx.Put(ctx, &Record{ID: "b", Stream: "0", Model: "m2", Status: StatusRunning, Metadata: map[string]string{"team": "y"}}))
+	require.NoError(t, idx.Put(ctx, &Record{ID: "c", Stream: "1", Model: "m1", Status: StatusRunning, Metadata: map[string]string{"team": "x"}}))
+
+	// Completing a request keeps the creation time.
+	a, err := idx.Get(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, a.CreatedAt.Equal(t0))
+	a.Status, a.StatusCode = StatusSucceeded, http.StatusOK
+	require.NoError(t, idx.Put(ctx, a))
+	a, err = idx.Get(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, StatusSucceeded, a.Status)
+	require.True(t, a.CreatedAt.Equal(t0))
+	require.True(t, a.UpdatedAt.Equal(t0.Add(time.Minute)))
+
+	_, err = idx.Get(ctx, "does-not-exist")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	ids := func(f Filter) []string {
+		records, _, err := idx.List(ctx, f)
+		require.NoError(t, err)
+		var ids []string
+		for _, r := range records {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	require.ElementsMatch(t, []string{"a", "b", "c"}, ids(Filter{}))
+	require.Equal(t, []string{"a"}, ids(Filter{Status: StatusSucceeded}))
+	require.ElementsMatch(t, []string{"a", "c"}, ids(Filter{Model: "m1"}))
+	require.Equal(t, []string{"c"}, ids(Filter{Stream: "1"}))
+	require.ElementsMatch(t, []string{"a", "c"}, ids(Filter{Metadata: map[string]string{"team": "x"}}))
+	require.Empty(t, ids(Filter{Metadata: map[string]string{"team": "z"}}))
+	require.Len(t, ids(Filter{Limit: 2}), 2)
+	require.NotContains(t, ids(Filter{Limit: 2}), "a", "most recently created requests should be listed first")
+
+	// Requests are removed once they have not been updated for the retention period.
+	idx.now = func() time.Time { return t0.Add(time.Hour + 90*time.Second) }
+	require.NoError(t, idx.Put(ctx, &Record{ID: "b", Stream: "0", Model: "m2", Status: StatusFailed}))
+	n, err := idx.expire(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, []string{"b"}, ids(Filter{}))
+}
+
+func TestListPages(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+	t0 := time.Now()
+	// Requests created at the same time are ordered by ID.
+	for j, id := range []string{"a", "b", "c", "d", "e"} {
+		idx.now = func() time.Time { return t0.Add(time.Duration(j/2) * time.Second) }
+		require.NoError(t, idx.Put(ctx, &Record{ID: id, Stream: "0", Status: StatusRunning}))
+	}
+
+	var (
+		pages [][]string
+		token string
+	)
+	for {
+		records, next, err := idx.List(ctx, Filter{Limit: 2, PageToken: token})
+		require.NoError(t, err)
+		var ids []string
+		for _, r := range records {
+			ids = append(ids, r.ID)
+		}
+		pages = append(pages, ids)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	require.Equal(t, [][]string{{"e", "d"}, {"c", "b"}, {"a"}}, pages)
+
+	// A page that ends with the last request has no next page.
+	records, next, err := idx.List(ctx, Filter{Limit: 5})
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+	require.Empty(t, next)
+
+	_, _, err = idx.List(ctx, Filter{PageToken: "invalid"})
+	require.Error(t, err)
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestIndex(t)
+	require.NoError(t, idx.Put(ctx, &Record{ID: "a", Stream: "0", Status: StatusSucceeded, Metadata: map[string]string{"batch-id": "123"}}))
+	require.NoError(t, idx.Put(ctx, &Record{ID: "b", Stream: "0", Status: StatusRunning}))
+	h := idx.NewHandler()
+
+	get := func(url string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	code, body := get("/requests/a")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "Succeeded", body["status"])
+
+	code, _ = get("/requests/c")
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, body = get("/requests?metadata.batch-id=123")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, body["requests"], 1)
+
+	code, body = get("/requests?status=Failed")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []any{}, body["requests"])
+
+	code, _ = get("/requests?status=Unknown")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("/requests?limit=0")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("/requests?limit=1001")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("/requests?page_token=invalid")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, body = get("/requests?limit=1")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, body["requests"], 1)
+	require.NotEmpty(t, body["next_page_token"])
+	code, body = get("/requests?limit=1&page_token=" + body["next_page_token"].(string))
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, body["requests"], 1)
+	require.Nil(t, body["next_page_token"])
+}
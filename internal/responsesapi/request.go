@@ -0,0 +1,177 @@
+// Package responsesapi translates requests of the OpenAI Responses API
+// (/v1/responses) to chat completion requests and translates the chat
+// completions (and their streamed chunks) back, so that the Responses API is
+// served by model servers that only implement chat completions.
+// Responses are not stored (store is always false).
+package responsesapi
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Path is the path of Responses API requests.
+const Path = "/v1/responses"
+
+// passthroughParams are the params that have the same meaning in both APIs.
+var passthroughParams = []string{"model", "temperature", "top_p", "parallel_tool_calls", "user", "stream"}
+
+// ChatCompletionParams returns the params of the chat completion request
+// that serves a Responses API request.
+func ChatCompletionParams(params map[string]any) (map[string]any, error) {
+	if id, _ := params["previous_response_id"].(string); id != "" {
+		return nil, fmt.Errorf("previous_response_id is not supported, responses are not stored")
+	}
+
+	chat := map[string]any{}
+	for _, p := range passthroughParams {
+		if v, ok := params[p]; ok {
+			chat[p] = v
+		}
+	}
+	if stream, _ := params["stream"].(bool); stream {
+		// The usage is part of the response.completed event.
+		chat["stream_options"] = map[string]any{"include_usage": true}
+	}
+	if v, ok := params["max_output_tokens"]; ok {
+		chat["max_tokens"] = v
+	}
+
+	var messages []any
+	if instructions, _ := params["instructions"].(string); instructions != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": instructions})
+	}
+	inputMessages, err := inputMessages(params["input"])
+	if err != nil {
+		return nil, err
+	}
+	chat["messages"] = append(messages, inputMessages...)
+
+	if tools, ok := params["tools"].([]any); ok && len(tools) > 0 {
+		chatTools, err := chatTools(tools)
+		if err != nil {
+			return nil, err
+		}
+		chat["tools"] = chatTools
+	}
+	switch choice := params["tool_choice"].(type) {
+	case string:
+		chat["tool_choice"] = choice
+	case map[string]any:
+		if choice["type"] != "function" {
+			return nil, fmt.Errorf("tool_choice of type %v is not supported", choice["type"])
+		}
+		chat["tool_choice"] = map[string]any{"type": "function", "function": map[string]any{"name": choice["name"]}}
+	}
+
+	if text, ok := params["text"].(map[string]any); ok {
+		if format, ok := text["format"].(map[string]any); ok {
+			switch format["type"] {
+			case "json_schema":
+				schema := maps.Clone(format)
+				delete(schema, "type")
+				chat["response_format"] = map[string]any{"type": "json_schema", "json_schema": schema}
+			case "json_object":
+				chat["response_format"] = map[string]any{"type": "json_object"}
+			}
+		}
+	}
+	return chat, nil
+}
+
+// inputMessages returns the chat messages of the input of a request: a
+// string (the user message) or a list of input items.
+func inputMessages(input any) ([]any, error) {
+	switch input := input.(type) {
+	case string:
+		return []any{map[string]any{"role": "user", "content": input}}, nil
+	case []any:
+		var messages []any
+		for i, v := range input {
+			item, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("input[%d] must be an object", i)
+			}
+			typ, _ := item["type"].(string)
+			if typ == "" && item["role"] != nil {
+				typ = "message"
+			}
+			switch typ {
+			case "message":
+				content, err := messageContent(item["content"])
+				if err != nil {
+					return nil, fmt.Errorf("input[%d]: %w", i, err)
+				}
+				messages = append(messages, map[string]any{"role": item["role"], "content": content})
+			case "function_call":
+				call := map[string]any{
+					"id":       item["call_id"],
+					"type":     "function",
+					"function": map[string]any{"name": item["name"], "arguments": item["arguments"]},
+				}
+				// Consecutive function calls are one assistant message.
+				if n := len(messages); n > 0 {
+					if prev, _ := messages[n-1].(map[string]any); prev["role"] == "assistant" && prev["tool_calls"] != nil {
+						prev["tool_calls"] = append(prev["tool_calls"].([]any), call)
+						continue
+					}
+				}
+				messages = append(messages, map[string]any{"role": "assistant", "content": nil, "tool_calls": []any{call}})
+			case "function_call_output":
+				messages = append(messages, map[string]any{"role": "tool", "tool_call_id": item["call_id"], "content": item["output"]})
+			case "reasoning":
+				// Reasoning is not sent back to model servers.
+			default:
+				return nil, fmt.Errorf("input[%d]: items of type %q are not supported", i, typ)
+			}
+		}
+		return messages, nil
+	}
+	return nil, fmt.Errorf("input must be a string or a list of input items")
+}
+
+// messageContent returns the chat message content of the content of a
+// message input item.
+func messageContent(content any) (any, error) {
+	parts, ok := content.([]any)
+	if !ok {
+		return content, nil
+	}
+	chatParts := make([]any, 0, len(parts))
+	for _, p := range parts {
+		part, _ := p.(map[string]any)
+		switch part["type"] {
+		case "input_text", "output_text":
+			chatParts = append(chatParts, map[string]any{"type": "text", "text": part["text"]})
+		case "input_image":
+			url, _ := part["image_url"].(string)
+			if url == "" {
+				return nil, fmt.Errorf("images must have an image_url (file_id is not supported)")
+			}
+			image := map[string]any{"url": url}
+			if detail, ok := part["detail"]; ok {
+				image["detail"] = detail
+			}
+			chatParts = append(chatParts, map[string]any{"type": "image_url", "image_url": image})
+		default:
+			return nil, fmt.Errorf("content of type %v is not supported", part["type"])
+		}
+	}
+	return chatParts, nil
+}
+
+// chatTools returns the chat completion tools of the tools of a request.
+// Only function tools are supported (no built-in tools).
+func chatTools(tools []any) ([]any, error) {
+	chatTools := make([]any, 0, len(tools))
+	for i, t := range tools {
+		tool, _ := t.(map[string]any)
+		if tool["type"] != "function" {
+			return nil, fmt.Errorf("tools[%d]: tools of type %v are not supported", i, tool["type"])
+		}
+		function := maps.Clone(tool)
+		delete(function, "type")
+		chatTools = append(chatTools, map[string]any{"type": "function", "function": function})
+	}
+	return chatTools, nil
+}
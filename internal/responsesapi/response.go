@@ -0,0 +1,238 @@
+package responsesapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// chatUsage is the usage of a chat completion.
+type chatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// chatToolCall is a tool call of a chat completion (or a delta of one).
+type chatToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// outputItem is a message or function call item of the output of a response.
+type outputItem struct {
+	id string
+	// callIndex is the index of the tool call of a function call item.
+	callIndex int
+	isCall    bool
+	text      strings.Builder
+	callID    string
+	name      string
+	arguments strings.Builder
+}
+
+func (it *outputItem) json(status string) map[string]any {
+	if it.isCall {
+		return map[string]any{
+			"type":      "function_call",
+			"id":        it.id,
+			"call_id":   it.callID,
+			"name":      it.name,
+			"arguments": it.arguments.String(),
+			"status":    status,
+		}
+	}
+	content := []any{}
+	if status == "completed" {
+		content = []any{textPart(it.text.String())}
+	}
+	return map[string]any{
+		"type":    "message",
+		"id":      it.id,
+		"role":    "assistant",
+		"status":  status,
+		"content": content,
+	}
+}
+
+func textPart(text string) map[string]any {
+	return map[string]any{"type": "output_text", "text": text, "annotations": []any{}}
+}
+
+// response is a response of the Responses API that is built from a chat
+// completion.
+type response struct {
+	params       map[string]any
+	id           string
+	model        any
+	createdAt    int64
+	items        []*outputItem
+	finishReason string
+	usage        *chatUsage
+}
+
+func newResponse(params map[string]any, chatID string, model any, created int64) *response {
+	if chatID == "" {
+		chatID = newID()
+	}
+	if model == nil {
+		model = params["model"]
+	}
+	if created == 0 {
+		created = time.Now().Unix()
+	}
+	return &response{params: params, id: "resp_" + strings.TrimPrefix(chatID, "chatcmpl-"), model: model, createdAt: created}
+}
+
+// message returns the message item of the response, adding it if it is new.
+func (r *response) message() (*outputItem, bool) {
+	for _, it := range r.items {
+		if !it.isCall {
+			return it, false
+		}
+	}
+	it := &outputItem{id: "msg_" + newID()}
+	r.items = append(r.items, it)
+	return it, true
+}
+
+// call returns the function call item of a tool call, adding it if it is new.
+func (r *response) call(index int) (*outputItem, bool) {
+	for _, it := range r.items {
+		if it.isCall && it.callIndex == index {
+			return it, false
+		}
+	}
+	it := &outputItem{id: "fc_" + newID(), isCall: true, callIndex: index}
+	r.items = append(r.items, it)
+	return it, true
+}
+
+func (r *response) outputIndex(it *outputItem) int {
+	for i := range r.items {
+		if r.items[i] == it {
+			return i
+		}
+	}
+	return -1
+}
+
+// status returns the status of a finished response and the reason it is
+// incomplete, if it is.
+func (r *response) status() (string, any) {
+	switch r.finishReason {
+	case "length":
+		return "incomplete", map[string]any{"reason": "max_output_tokens"}
+	case "content_filter":
+		return "incomplete", map[string]any{"reason": "content_filter"}
+	}
+	return "completed", nil
+}
+
+// json returns the response object with the given status and output.
+func (r *response) json(status string, incomplete any, output []any) map[string]any {
+	if output == nil {
+		output = []any{}
+	}
+	resp := map[string]any{
+		"id":                   r.id,
+		"object":               "response",
+		"created_at":           r.createdAt,
+		"status":               status,
+		"model":                r.model,
+		"output":               output,
+		"error":                nil,
+		"incomplete_details":   incomplete,
+		"instructions":         r.param("instructions", nil),
+		"max_output_tokens":    r.param("max_output_tokens", nil),
+		"temperature":          r.param("temperature", 1),
+		"top_p":                r.param("top_p", 1),
+		"tools":                r.param("tools", []any{}),
+		"tool_choice":          r.param("tool_choice", "auto"),
+		"parallel_tool_calls":  r.param("parallel_tool_calls", true),
+		"text":                 r.param("text", map[string]any{"format": map[string]any{"type": "text"}}),
+		"metadata":             r.param("metadata", map[string]any{}),
+		"user":                 r.param("user", nil),
+		"previous_response_id": nil,
+		"store":                false,
+		"usage":                nil,
+	}
+	if r.usage != nil {
+		resp["usage"] = map[string]any{
+			"input_tokens":          r.usage.PromptTokens,
+			"input_tokens_details":  map[string]any{"cached_tokens": 0},
+			"output_tokens":         r.usage.CompletionTokens,
+			"output_tokens_details": map[string]any{"reasoning_tokens": 0},
+			"total_tokens":          r.usage.TotalTokens,
+		}
+	}
+	return resp
+}
+
+// final returns the finished response object.
+func (r *response) final() map[string]any {
+	status, incomplete := r.status()
+	output := make([]any, len(r.items))
+	for i, it := range r.items {
+		output[i] = it.json("completed")
+	}
+	return r.json(status, incomplete, output)
+}
+
+func (r *response) param(key string, def any) any {
+	if v, ok := r.params[key]; ok && v != nil {
+		return v
+	}
+	return def
+}
+
+// FromChatCompletion returns the body of the response to a Responses API
+// request from the body of the chat completion that served it.
+func FromChatCompletion(params map[string]any, body []byte) ([]byte, error) {
+	var chat struct {
+		ID      string `json:"id"`
+		Model   any    `json:"model"`
+		Created int64  `json:"created"`
+		Choices []struct {
+			Message struct {
+				Content   string         `json:"content"`
+				ToolCalls []chatToolCall `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *chatUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return nil, fmt.Errorf("decoding chat completion: %w", err)
+	}
+	if len(chat.Choices) == 0 {
+		return nil, fmt.Errorf("chat completion has no choices")
+	}
+
+	r := newResponse(params, chat.ID, chat.Model, chat.Created)
+	r.usage = chat.Usage
+	choice := chat.Choices[0]
+	r.finishReason = choice.FinishReason
+	if choice.Message.Content != "" {
+		it, _ := r.message()
+		it.text.WriteString(choice.Message.Content)
+	}
+	for i, tc := range choice.Message.ToolCalls {
+		it, _ := r.call(i)
+		it.callID = tc.ID
+		it.name = tc.Function.Name
+		it.arguments.WriteString(tc.Function.Arguments)
+	}
+	return json.Marshal(r.final())
+}
+
+func newID() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
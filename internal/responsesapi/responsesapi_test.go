@@ -0,0 +1,135 @@
+package responsesapi_test
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/responsesapi"
+)
+
+func TestChatCompletionParams(t *testing.T) {
+	t.Parallel()
+
+	var params map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "m",
+		"instructions": "Be brief.",
+		"max_output_tokens": 10,
+		"stream": true,
+		"input": [
+			{"role": "user", "content": [{"type": "input_text", "text": "weather?"}, {"type": "input_image", "image_url": "data:x"}]},
+			{"type": "function_call", "call_id": "c1", "name": "weather", "arguments": "{\"city\":\"a\"}"},
+			{"type": "function_call", "call_id": "c2", "name": "weather", "arguments": "{\"city\":\"b\"}"},
+			{"type": "function_call_output", "call_id": "c1", "output": "sunny"},
+			{"type": "reasoning", "summary": []}
+		],
+		"tools": [{"type": "function", "name": "weather", "parameters": {"type": "object"}}],
+		"tool_choice": {"type": "function", "name": "weather"},
+		"text": {"format": {"type": "json_schema", "name": "s", "schema": {"type": "object"}}}
+	}`), &params))
+
+	chat, err := responsesapi.ChatCompletionParams(params)
+	require.NoError(t, err)
+	exp := `{
+		"model": "m",
+		"max_tokens": 10,
+		"stream": true,
+		"stream_options": {"include_usage": true},
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "weather?"}, {"type": "image_url", "image_url": {"url": "data:x"}}]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "c1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"a\"}"}},
+				{"id": "c2", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"b\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "c1", "content": "sunny"}
+		],
+		"tools": [{"type": "function", "function": {"name": "weather", "parameters": {"type": "object"}}}],
+		"tool_choice": {"type": "function", "function": {"name": "weather"}},
+		"response_format": {"type": "json_schema", "json_schema": {"name": "s", "schema": {"type": "object"}}}
+	}`
+	got, err := json.Marshal(chat)
+	require.NoError(t, err)
+	require.JSONEq(t, exp, string(got))
+
+	_, err = responsesapi.ChatCompletionParams(map[string]any{"input": "a", "tools": []any{map[string]any{"type": "web_search"}}})
+	require.EqualError(t, err, "tools[0]: tools of type web_search are not supported")
+}
+
+func TestFromChatCompletion(t *testing.T) {
+	t.Parallel()
+
+	body, err := responsesapi.FromChatCompletion(map[string]any{"model": "m"}, []byte(`{
+		"id": "chatcmpl-1", "model": "m", "created": 1,
+		"choices": [{"message": {"role": "assistant", "content": null, "tool_calls": [
+			{"id": "c1", "type": "function", "function": {"name": "weather", "arguments": "{}"}}
+		]}, "finish_reason": "tool_calls"}],
+		"usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}
+	}`))
+	require.NoError(t, err)
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(body, &resp))
+	require.Equal(t, "resp_1", resp["id"])
+	require.Equal(t, "completed", resp["status"])
+	output := resp["output"].([]any)
+	require.Len(t, output, 1)
+	call := output[0].(map[string]any)
+	require.Equal(t, "function_call", call["type"])
+	require.Equal(t, "c1", call["call_id"])
+	require.Equal(t, "weather", call["name"])
+	require.Equal(t, "{}", call["arguments"])
+	require.EqualValues(t, 5, resp["usage"].(map[string]any)["total_tokens"])
+
+	body, err = responsesapi.FromChatCompletion(map[string]any{}, []byte(`{"choices": [{"message": {"content": "a"}, "finish_reason": "length"}]}`))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &resp))
+	require.Equal(t, "incomplete", resp["status"])
+	require.Equal(t, map[string]any{"reason": "max_output_tokens"}, resp["incomplete_details"])
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	chat := `data: {"id":"chatcmpl-1","choices":[{"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"c1","function":{"name":"weather","arguments":""}}]}}]}
+
+data: {"id":"chatcmpl-1","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}
+
+data: {"id":"chatcmpl-1","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"a\"}"}}]},"finish_reason":"tool_calls"}]}
+
+data: {"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}
+
+data: [DONE]
+
+`
+	out, err := io.ReadAll(responsesapi.NewStream(map[string]any{}, io.NopCloser(strings.NewReader(chat))))
+	require.NoError(t, err)
+
+	var types []string
+	var done map[string]any
+	for _, line := range strings.Split(string(out), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+		types = append(types, event["type"].(string))
+		if event["type"] == "response.function_call_arguments.done" {
+			done = event
+		}
+	}
+	require.Equal(t, []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.completed",
+	}, types)
+	require.Equal(t, `{"city":"a"}`, done["arguments"])
+}
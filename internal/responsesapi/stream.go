@@ -0,0 +1,178 @@
+package responsesapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/substratusai/kubeai/internal/apiutils"
+)
+
+// NewStream returns the streamed events of the response to a Responses API
+// request from the server-sent events of the chat completion that serves it.
+func NewStream(params map[string]any, chat io.ReadCloser) io.ReadCloser {
+	return &stream{params: params, body: chat, r: bufio.NewReader(chat)}
+}
+
+type stream struct {
+	params map[string]any
+	body   io.ReadCloser
+	r      *bufio.Reader
+
+	// resp is the response that is built from the chunks, it is nil until
+	// the first chunk has been read.
+	resp *response
+	// out are the events that have not been read by the client.
+	out  bytes.Buffer
+	seq  int
+	done bool
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	for s.out.Len() == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	return s.out.Read(p)
+}
+
+func (s *stream) Close() error {
+	return s.body.Close()
+}
+
+// next translates the next chat completion event.
+func (s *stream) next() error {
+	data, err := apiutils.ReadEventData(s.r)
+	if errors.Is(err, io.EOF) || string(data) == "[DONE]" {
+		s.finish()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.chunk(data)
+	return nil
+}
+
+// chunk translates a chat completion chunk.
+func (s *stream) chunk(data []byte) {
+	var chunk struct {
+		ID      string `json:"id"`
+		Model   any    `json:"model"`
+		Created int64  `json:"created"`
+		Choices []struct {
+			Delta struct {
+				Content   string         `json:"content"`
+				ToolCalls []chatToolCall `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *chatUsage `json:"usage"`
+		Error any        `json:"error"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		s.fail(fmt.Sprintf("decoding chat completion chunk: %v", err))
+		return
+	}
+	if chunk.Error != nil {
+		msg, _ := json.Marshal(chunk.Error)
+		if e, ok := chunk.Error.(map[string]any); ok {
+			if m, ok := e["message"].(string); ok {
+				msg = []byte(m)
+			}
+		}
+		s.fail(string(msg))
+		return
+	}
+
+	if s.resp == nil {
+		s.resp = newResponse(s.params, chunk.ID, chunk.Model, chunk.Created)
+		s.emit("response.created", map[string]any{"response": s.resp.json("in_progress", nil, nil)})
+		s.emit("response.in_progress", map[string]any{"response": s.resp.json("in_progress", nil, nil)})
+	}
+	if chunk.Usage != nil {
+		s.resp.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+	choice := chunk.Choices[0]
+	if choice.FinishReason != "" {
+		s.resp.finishReason = choice.FinishReason
+	}
+	if choice.Delta.Content != "" {
+		it, added := s.resp.message()
+		idx := s.resp.outputIndex(it)
+		if added {
+			s.emit("response.output_item.added", map[string]any{"output_index": idx, "item": it.json("in_progress")})
+			s.emit("response.content_part.added", map[string]any{"item_id": it.id, "output_index": idx, "content_index": 0, "part": textPart("")})
+		}
+		it.text.WriteString(choice.Delta.Content)
+		s.emit("response.output_text.delta", map[string]any{"item_id": it.id, "output_index": idx, "content_index": 0, "delta": choice.Delta.Content})
+	}
+	for _, tc := range choice.Delta.ToolCalls {
+		it, added := s.resp.call(tc.Index)
+		idx := s.resp.outputIndex(it)
+		if tc.ID != "" {
+			it.callID = tc.ID
+		}
+		it.name += tc.Function.Name
+		if added {
+			s.emit("response.output_item.added", map[string]any{"output_index": idx, "item": it.json("in_progress")})
+		}
+		if tc.Function.Arguments != "" {
+			it.arguments.WriteString(tc.Function.Arguments)
+			s.emit("response.function_call_arguments.delta", map[string]any{"item_id": it.id, "output_index": idx, "delta": tc.Function.Arguments})
+		}
+	}
+}
+
+// finish closes the output items and completes the response.
+func (s *stream) finish() {
+	s.done = true
+	if s.resp == nil {
+		s.fail("the model server ended the stream without a chunk")
+		return
+	}
+	for idx, it := range s.resp.items {
+		if it.isCall {
+			s.emit("response.function_call_arguments.done", map[string]any{"item_id": it.id, "output_index": idx, "arguments": it.arguments.String()})
+		} else {
+			text := it.text.String()
+			s.emit("response.output_text.done", map[string]any{"item_id": it.id, "output_index": idx, "content_index": 0, "text": text})
+			s.emit("response.content_part.done", map[string]any{"item_id": it.id, "output_index": idx, "content_index": 0, "part": textPart(text)})
+		}
+		s.emit("response.output_item.done", map[string]any{"output_index": idx, "item": it.json("completed")})
+	}
+	resp := s.resp.final()
+	if resp["status"] == "incomplete" {
+		s.emit("response.incomplete", map[string]any{"response": resp})
+	} else {
+		s.emit("response.completed", map[string]any{"response": resp})
+	}
+}
+
+// fail ends the stream with an error event.
+func (s *stream) fail(msg string) {
+	s.done = true
+	s.emit("error", map[string]any{"code": nil, "message": msg, "param": nil})
+}
+
+func (s *stream) emit(typ string, fields map[string]any) {
+	fields["type"] = typ
+	fields["sequence_number"] = s.seq
+	s.seq++
+	data, err := json.Marshal(fields)
+	if err != nil {
+		// The fields are always encodable.
+		panic(err)
+	}
+	fmt.Fprintf(&s.out, "event: %s\ndata: %s\n\n", typ, data)
+}
@@ -72,6 +72,43 @@ func (c *Client) UnloadLoraAdapter(ctx context.Context, addr string, req UnloadA
 	return nil
 }
 
+// Model is a model served by the VLLM model server: the base model or a
+// loaded LoRA adapter (which has a Parent).
+type Model struct {
+	ID          string  `json:"id"`
+	Root        string  `json:"root"`
+	Parent      *string `json:"parent"`
+	MaxModelLen int64   `json:"max_model_len"`
+}
+
+// List the models served by the VLLM model server.
+// See: https://platform.openai.com/docs/api-reference/models/list
+func (c *Client) ListModels(ctx context.Context, addr string) ([]Model, error) {
+	url := addr + "/v1/models"
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating http request: %w", err)
+	}
+	httpResp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("sending http request: GET %s: %w", url, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(httpResp.Body)
+		return nil, fmt.Errorf("unexpected status code: GET %s: %d: %s", url, httpResp.StatusCode, string(respBody))
+	}
+
+	var resp struct {
+		Data []Model `json:"data"`
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decoding response body: %w", err)
+	}
+	return resp.Data, nil
+}
+
 type errorResponse struct {
 	Message string `json:"message"`
 	Type    string `json:"type"`
@@ -0,0 +1,167 @@
+// Package webhooks notifies external systems (i.e. ChatOps or automation)
+// of Model lifecycle and traffic events.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Event types.
+const (
+	// EventColdStartCompleted is sent by the gateway when a Model without
+	// ready replicas serves its first request.
+	EventColdStartCompleted = "ColdStartCompleted"
+	// EventScaledToZero is sent by the autoscaler when a Model is scaled
+	// to zero after being idle for its scaleToZeroIdleSeconds.
+	EventScaledToZero = "ScaledToZero"
+	// EventAlertFiring is sent by the autoscaler when an alert starts
+	// firing for a Model (i.e. a sustained error rate).
+	EventAlertFiring = "AlertFiring"
+	// EventAlertResolved is sent by the autoscaler when an alert stops
+	// firing for a Model.
+	EventAlertResolved = "AlertResolved"
+)
+
+const (
+	// queueSize is the number of events that are buffered for delivery.
+	// Events are dropped if the queue is full.
+	queueSize = 100
+	// maxAttempts is the number of times that delivery of an event to a
+	// webhook is attempted.
+	maxAttempts = 3
+)
+
+// Event is POSTed to webhooks as JSON.
+type Event struct {
+	Type  string `json:"type"`
+	Model string `json:"model"`
+	// Reason is the name of the alert for alert events.
+	Reason  string    `json:"reason,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+	// Text is a human-readable summary of the event, which is displayed
+	// by Slack-compatible incoming webhooks.
+	Text string `json:"text"`
+}
+
+// Notifier delivers events to webhooks in the background.
+// All methods are no-ops on a nil receiver.
+type Notifier struct {
+	hooks  []config.Webhook
+	client *http.Client
+	queue  chan Event
+	// backoff is the time between delivery attempts.
+	backoff time.Duration
+}
+
+// New returns a Notifier for the given webhooks, or nil if there are none.
+func New(hooks []config.Webhook) *Notifier {
+	if len(hooks) == 0 {
+		return nil
+	}
+	return &Notifier{
+		hooks:   hooks,
+		client:  &http.Client{},
+		queue:   make(chan Event, queueSize),
+		backoff: time.Second,
+	}
+}
+
+// Notify queues an event for delivery without blocking.
+func (n *Notifier) Notify(e Event) {
+	if n == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Text == "" {
+		e.Text = fmt.Sprintf("[kubeai] %s: model %s: %s", e.Type, e.Model, e.Message)
+	}
+	select {
+	case n.queue <- e:
+	default:
+		log.Printf("Dropping webhook event %s for model %q: queue is full", e.Type, e.Model)
+		metrics.WebhookFailures.Add(context.Background(), 1, metric.WithAttributes(metrics.AttrWebhookEvent.String(e.Type)))
+	}
+}
+
+// Start delivers queued events until the context is cancelled.
+func (n *Notifier) Start(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-n.queue:
+			for _, hook := range n.hooks {
+				if len(hook.Events) > 0 && !slices.Contains(hook.Events, e.Type) {
+					continue
+				}
+				if err := n.deliver(ctx, hook, e); err != nil {
+					log.Printf("Failed to deliver webhook event %s for model %q to %s: %v", e.Type, e.Model, hook.URL, err)
+					metrics.WebhookFailures.Add(ctx, 1, metric.WithAttributes(metrics.AttrWebhookEvent.String(e.Type)))
+				}
+			}
+		}
+	}
+}
+
+// deliver POSTs an event to a webhook, retrying failed attempts.
+func (n *Notifier) deliver(ctx context.Context, hook config.Webhook, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshalling event: %w", err)
+	}
+	for attempt := 1; ; attempt++ {
+		err = n.post(ctx, hook, body)
+		if err == nil || attempt == maxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * n.backoff):
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, hook config.Webhook, body []byte) error {
+	if hook.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout.Duration)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/metrics/metricstest"
+)
+
+func TestNotifier(t *testing.T) {
+	metricstest.Init(t)
+
+	received := make(chan Event, 10)
+	var failures int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		if failures < 1 {
+			failures++
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var e Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		received <- e
+	}))
+	t.Cleanup(srv.Close)
+
+	require.Nil(t, New(nil))
+
+	n := New([]config.Webhook{{
+		URL:     srv.URL,
+		Events:  []string{EventAlertFiring},
+		Headers: map[string]string{"Authorization": "Bearer abc"},
+		Timeout: config.Duration{Duration: time.Second},
+	}})
+	n.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go n.Start(ctx)
+
+	// Not subscribed to.
+	n.Notify(Event{Type: EventScaledToZero, Model: "m1", Message: "idle"})
+	// Delivered after a failed attempt.
+	n.Notify(Event{Type: EventAlertFiring, Model: "m1", Reason: "HighErrorRate", Message: "10 of 10 requests failed"})
+
+	select {
+	case e := <-received:
+		require.Equal(t, EventAlertFiring, e.Type)
+		require.Equal(t, "m1", e.Model)
+		require.Equal(t, "HighErrorRate", e.Reason)
+		require.Equal(t, "[kubeai] AlertFiring: model m1: 10 of 10 requests failed", e.Text)
+		require.False(t, e.Time.IsZero())
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	require.Equal(t, 1, failures)
+	require.Empty(t, received)
+}
+
+func TestNilNotifier(t *testing.T) {
+	var n *Notifier
+	n.Notify(Event{Type: EventScaledToZero})
+	n.Start(context.Background())
+}
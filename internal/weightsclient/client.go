@@ -0,0 +1,211 @@
+// Package weightsclient resolves the revision of the model weights that a
+// Model URL references, so that Model Pods can be updated when the weights
+// change, and the size of the vocabulary of the model (i.e. to check that a
+// draft model uses the same tokenizer).
+package weightsclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// ErrUnsupported is returned for URLs of which the revision can not be
+// resolved (i.e. "pvc://" URLs).
+var ErrUnsupported = errors.New("revision can not be resolved")
+
+type Client struct {
+	HTTPClient *http.Client
+	// HuggingfaceURL is the URL of the Hugging Face Hub.
+	// Defaults to "https://huggingface.co".
+	HuggingfaceURL string
+	// HuggingfaceToken is used to resolve the revisions of private and
+	// gated repos. Optional.
+	HuggingfaceToken string
+	// S3 is used to resolve the revisions of "s3://" URLs. Defaults to a
+	// client with the credentials of the environment.
+	S3 s3iface.S3API
+
+	s3Once sync.Once
+	s3Err  error
+
+	// vocabSizes caches the vocabulary sizes by URL and revision.
+	vocabSizes sync.Map
+}
+
+// Revision returns the revision of the weights at the URL. For Hugging Face
+// repos, it is the commit of the given revision (defaults to "main"). For S3,
+// it is a hash of the keys and ETags of the objects under the URL (which
+// change with every new version of an object).
+func (c *Client) Revision(ctx context.Context, modelURL, revision string) (string, error) {
+	scheme, ref, ok := strings.Cut(modelURL, "://")
+	if !ok {
+		return "", fmt.Errorf("invalid model URL: %s", modelURL)
+	}
+	switch scheme {
+	case "hf":
+		return c.huggingfaceRevision(ctx, ref, revision)
+	case "s3":
+		return c.s3Revision(ctx, ref)
+	default:
+		return "", fmt.Errorf("%w for %s:// URLs", ErrUnsupported, scheme)
+	}
+}
+
+func (c *Client) huggingfaceRevision(ctx context.Context, repo, revision string) (string, error) {
+	if revision == "" {
+		revision = "main"
+	}
+	base := c.HuggingfaceURL
+	if base == "" {
+		base = "https://huggingface.co"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/api/models/%s/revision/%s", strings.TrimSuffix(base, "/"), repo, url.PathEscape(revision)), nil)
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	if c.HuggingfaceToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.HuggingfaceToken)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("getting revision: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("getting revision %q of %s: unexpected status code: %d: %s", revision, repo, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var info struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("decoding revision: %w", err)
+	}
+	if info.SHA == "" {
+		return "", fmt.Errorf("no commit for revision %q of %s", revision, repo)
+	}
+	return info.SHA, nil
+}
+
+// VocabSize returns the size of the vocabulary of the model at the URL (the
+// "vocab_size" of its config.json) at the given revision (defaults to
+// "main"). Only Hugging Face repos are supported.
+func (c *Client) VocabSize(ctx context.Context, modelURL, revision string) (int, error) {
+	scheme, ref, ok := strings.Cut(modelURL, "://")
+	if !ok {
+		return 0, fmt.Errorf("invalid model URL: %s", modelURL)
+	}
+	if scheme != "hf" {
+		return 0, fmt.Errorf("%w for %s:// URLs", ErrUnsupported, scheme)
+	}
+	if revision == "" {
+		revision = "main"
+	}
+	key := modelURL + "@" + revision
+	if size, ok := c.vocabSizes.Load(key); ok {
+		return size.(int), nil
+	}
+	size, err := c.huggingfaceVocabSize(ctx, ref, revision)
+	if err != nil {
+		return 0, err
+	}
+	c.vocabSizes.Store(key, size)
+	return size, nil
+}
+
+func (c *Client) huggingfaceVocabSize(ctx context.Context, repo, revision string) (int, error) {
+	base := c.HuggingfaceURL
+	if base == "" {
+		base = "https://huggingface.co"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/%s/resolve/%s/config.json", strings.TrimSuffix(base, "/"), repo, url.PathEscape(revision)), nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+	if c.HuggingfaceToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.HuggingfaceToken)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("getting config: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("getting config.json of %s: unexpected status code: %d: %s", repo, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var config struct {
+		VocabSize int `json:"vocab_size"`
+		// Multimodal models configure the language model separately.
+		TextConfig struct {
+			VocabSize int `json:"vocab_size"`
+		} `json:"text_config"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&config); err != nil {
+		return 0, fmt.Errorf("decoding config.json of %s: %w", repo, err)
+	}
+	switch {
+	case config.VocabSize > 0:
+		return config.VocabSize, nil
+	case config.TextConfig.VocabSize > 0:
+		return config.TextConfig.VocabSize, nil
+	}
+	return 0, fmt.Errorf("no vocab_size in config.json of %s", repo)
+}
+
+func (c *Client) s3Revision(ctx context.Context, ref string) (string, error) {
+	c.s3Once.Do(func() {
+		if c.S3 != nil {
+			return
+		}
+		var sess *session.Session
+		sess, c.s3Err = session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+		if c.s3Err == nil {
+			c.S3 = s3.New(sess)
+		}
+	})
+	if c.s3Err != nil {
+		return "", fmt.Errorf("creating s3 client: %w", c.s3Err)
+	}
+
+	bucket, prefix, _ := strings.Cut(ref, "/")
+	var objects []string
+	if err := c.S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, o := range page.Contents {
+			objects = append(objects, aws.StringValue(o.Key)+" "+aws.StringValue(o.ETag))
+		}
+		return true
+	}); err != nil {
+		return "", fmt.Errorf("listing objects: %w", err)
+	}
+	if len(objects) == 0 {
+		return "", fmt.Errorf("no objects under s3://%s", ref)
+	}
+	sort.Strings(objects)
+	h := sha256.New()
+	for _, o := range objects {
+		fmt.Fprintln(h, o)
+	}
+	// Shortened to the length of a commit (i.e. to fit into labels).
+	return hex.EncodeToString(h.Sum(nil)[:20]), nil
+}
@@ -0,0 +1,108 @@
+package weightsclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHuggingfaceRevision(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer my-token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/api/models/org/model/revision/main":
+			w.Write([]byte(`{"id":"org/model","sha":"0123abcd"}`))
+		default:
+			http.Error(w, `{"error":"Revision Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := &Client{HTTPClient: srv.Client(), HuggingfaceURL: srv.URL, HuggingfaceToken: "my-token"}
+
+	rev, err := c.Revision(context.Background(), "hf://org/model", "")
+	require.NoError(t, err)
+	require.Equal(t, "0123abcd", rev)
+
+	_, err = c.Revision(context.Background(), "hf://org/model", "v2")
+	require.ErrorContains(t, err, "unexpected status code: 404")
+
+	_, err = c.Revision(context.Background(), "pvc://my-pvc", "")
+	require.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestVocabSize(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/org/model/resolve/main/config.json":
+			w.Write([]byte(`{"architectures":["LlamaForCausalLM"],"vocab_size":128256}`))
+		case "/org/vision/resolve/main/config.json":
+			w.Write([]byte(`{"text_config":{"vocab_size":32064}}`))
+		case "/org/broken/resolve/main/config.json":
+			w.Write([]byte(`{}`))
+		default:
+			http.Error(w, "Entry not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := &Client{HTTPClient: srv.Client(), HuggingfaceURL: srv.URL}
+	ctx := context.Background()
+
+	size, err := c.VocabSize(ctx, "hf://org/model", "")
+	require.NoError(t, err)
+	require.Equal(t, 128256, size)
+	// Sizes are cached.
+	_, err = c.VocabSize(ctx, "hf://org/model", "main")
+	require.NoError(t, err)
+	require.Equal(t, 1, requests)
+
+	size, err = c.VocabSize(ctx, "hf://org/vision", "")
+	require.NoError(t, err)
+	require.Equal(t, 32064, size)
+
+	_, err = c.VocabSize(ctx, "hf://org/broken", "")
+	require.ErrorContains(t, err, "no vocab_size")
+	_, err = c.VocabSize(ctx, "hf://org/model", "v2")
+	require.ErrorContains(t, err, "unexpected status code: 404")
+	_, err = c.VocabSize(ctx, "s3://bucket/model", "")
+	require.ErrorIs(t, err, ErrUnsupported)
+}
+
+type fakeS3 struct {
+	s3iface.S3API
+	objects []*s3.Object
+}
+
+func (f *fakeS3) ListObjectsV2PagesWithContext(_ aws.Context, in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
+	fn(&s3.ListObjectsV2Output{Contents: f.objects}, true)
+	return nil
+}
+
+func TestS3Revision(t *testing.T) {
+	fake := &fakeS3{objects: []*s3.Object{
+		{Key: aws.String("model/config.json"), ETag: aws.String(`"1"`)},
+		{Key: aws.String("model/model.safetensors"), ETag: aws.String(`"2"`)},
+	}}
+	c := &Client{S3: fake}
+
+	rev1, err := c.Revision(context.Background(), "s3://bucket/model", "")
+	require.NoError(t, err)
+	require.Len(t, rev1, 40)
+
+	fake.objects[1].ETag = aws.String(`"3"`)
+	rev2, err := c.Revision(context.Background(), "s3://bucket/model", "")
+	require.NoError(t, err)
+	require.NotEqual(t, rev1, rev2)
+
+	fake.objects = nil
+	_, err = c.Revision(context.Background(), "s3://bucket/model", "")
+	require.ErrorContains(t, err, "no objects")
+}
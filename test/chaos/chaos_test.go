@@ -0,0 +1,139 @@
+package chaos
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestProxyBackendRestarts sends concurrent requests via the model proxy
+// while backends are killed and replaced. Requests that were in flight on a
+// killed backend should be retried on another backend.
+func TestProxyBackendRestarts(t *testing.T) {
+	h := newHarness(t, 3)
+
+	const (
+		requests    = 200
+		concurrency = 20
+	)
+	var ids []string
+	for i := 0; i < requests; i++ {
+		ids = append(ids, fmt.Sprintf("http-%d", i))
+	}
+
+	stopChaos := make(chan struct{})
+	chaosDone := make(chan struct{})
+	go func() {
+		defer close(chaosDone)
+		for i := 0; ; i++ {
+			select {
+			case <-stopChaos:
+				return
+			case <-time.After(30 * time.Millisecond):
+			}
+			if i%5 == 4 {
+				// Kill all backends: requests should wait for a replacement.
+				for b := range h.backends {
+					h.killBackend(b)
+				}
+				time.Sleep(50 * time.Millisecond)
+				for b := range h.backends {
+					h.restartBackend(b)
+				}
+				continue
+			}
+			b := i % len(h.backends)
+			h.killBackend(b)
+			time.Sleep(20 * time.Millisecond)
+			h.restartBackend(b)
+		}
+	}()
+
+	var (
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, concurrency)
+		errs = make(chan error, requests)
+	)
+	for _, id := range ids {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			text, err := h.sendHTTPRequest(id)
+			if err != nil {
+				errs <- fmt.Errorf("request %q: %w", id, err)
+				return
+			}
+			if text != id {
+				errs <- fmt.Errorf("request %q: received response for %q", id, text)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stopChaos)
+	<-chaosDone
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	h.requireNoDoubleInference(ids)
+	h.requireNoInflight()
+}
+
+// TestMessengerBrokerRestarts publishes request messages while the broker
+// is repeatedly taken down. Acknowledgements that are lost while the broker
+// is down cause messages to be redelivered, which should be answered
+// without running inference again.
+func TestMessengerBrokerRestarts(t *testing.T) {
+	h := newHarness(t, 3)
+	h.startMessenger(5, 2*time.Second)
+
+	const requests = 100
+	var ids []string
+	for i := 0; i < requests; i++ {
+		ids = append(ids, fmt.Sprintf("message-%d", i))
+	}
+
+	for i, id := range ids {
+		h.publish(id)
+		if i%25 == 10 {
+			// Take the broker down while messages are being handled.
+			time.Sleep(20 * time.Millisecond)
+			h.broker.setDown(true)
+			time.Sleep(100 * time.Millisecond)
+			h.broker.setDown(false)
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		h.mtx.Lock()
+		defer h.mtx.Unlock()
+		for _, id := range ids {
+			if len(h.responses[id]) == 0 {
+				return false
+			}
+		}
+		return h.broker.pending() == 0
+	}, 30*time.Second, 50*time.Millisecond, "every request should be answered and acknowledged")
+
+	h.mtx.Lock()
+	for _, id := range ids {
+		// Redelivered requests are answered again with the same response.
+		for _, resp := range h.responses[id] {
+			require.JSONEq(t, fmt.Sprintf(`{
+	"metadata": {"id": %q},
+	"status_code": 200,
+	"body": {"choices": [{"text": %q}]}
+}`, id, id), resp)
+		}
+	}
+	h.mtx.Unlock()
+
+	h.requireNoDoubleInference(ids)
+	h.requireNoInflight()
+}
@@ -0,0 +1,569 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	kubeaiv1 "github.com/substratusai/kubeai/api/v1"
+	"github.com/substratusai/kubeai/internal/config"
+	"github.com/substratusai/kubeai/internal/messenger"
+	"github.com/substratusai/kubeai/internal/metrics"
+	"github.com/substratusai/kubeai/internal/metrics/metricstest"
+	"github.com/substratusai/kubeai/internal/modelproxy"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/driver"
+	_ "gocloud.dev/pubsub/mempubsub"
+)
+
+const testModel = "chaos-model"
+
+// harness runs the model proxy and a messenger in-process against fake
+// model servers and an in-memory broker that can be killed and restarted
+// while requests are in flight.
+type harness struct {
+	t *testing.T
+
+	backends  []*backend
+	endpoints *fakeEndpoints
+	proxy     *httptest.Server
+	broker    *broker
+
+	mtx sync.Mutex
+	// completions is the number of inferences that were completed by
+	// the backends by request ID.
+	completions map[string]int
+	// responses are the response messages received by request ID.
+	responses map[string][]string
+}
+
+func newHarness(t *testing.T, backends int) *harness {
+	metricstest.Init(t)
+
+	h := &harness{
+		t:           t,
+		endpoints:   newFakeEndpoints(),
+		completions: map[string]int{},
+		responses:   map[string][]string{},
+	}
+	for i := 0; i < backends; i++ {
+		b := &backend{latency: 10 * time.Millisecond, onComplete: h.complete}
+		b.start(t)
+		h.endpoints.set(b.addr, true)
+		h.backends = append(h.backends, b)
+	}
+	t.Cleanup(func() {
+		for _, b := range h.backends {
+			b.kill()
+		}
+	})
+
+	proxy := modelproxy.NewHandler(fakeScaler{}, h.endpoints, 3, nil, config.ModelProxy{
+		StreamBufferSize: 64,
+		SlowClientPolicy: config.SlowClientPolicyBlock,
+	})
+	h.proxy = httptest.NewServer(proxy)
+	t.Cleanup(h.proxy.Close)
+
+	return h
+}
+
+func (h *harness) complete(id string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.completions[id]++
+}
+
+// killBackend removes the backend from the endpoints and kills it, aborting
+// in-flight requests.
+func (h *harness) killBackend(i int) {
+	h.endpoints.set(h.backends[i].addr, false)
+	h.backends[i].kill()
+}
+
+// restartBackend starts the backend on a new address (like a replacement Pod).
+func (h *harness) restartBackend(i int) {
+	h.backends[i].start(h.t)
+	h.endpoints.set(h.backends[i].addr, true)
+}
+
+// sendHTTPRequest sends a completion request for the given ID via the
+// model proxy and returns the generated text.
+func (h *harness) sendHTTPRequest(id string) (string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(h.proxy.URL+"/v1/completions", "application/json",
+		strings.NewReader(fmt.Sprintf(`{"model": %q, "prompt": %q}`, testModel, id)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
+	}
+	return completionText(body)
+}
+
+// startMessenger starts a messenger that receives requests from the
+// harness broker and collects the responses.
+func (h *harness) startMessenger(maxHandlers int, ackDeadline time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.t.Cleanup(cancel)
+
+	name := strings.ToLower(h.t.Name())
+	h.broker = newBroker(name, ackDeadline)
+	h.t.Cleanup(func() { brokers.Delete(name) })
+
+	responsesURL := "mem://" + name + "-responses"
+	stream := config.MessageStream{
+		Name:          "0",
+		RequestsURL:   "chaos://" + name,
+		ResponsesURL:  responsesURL,
+		MaxHandlers:   maxHandlers,
+		Deduplication: &config.MessageDeduplication{IdempotencyKey: "id", TTL: config.Duration{Duration: time.Hour}, MaxEntries: 10000},
+	}
+	msgr, err := messenger.NewMessenger(ctx, stream, time.Second,
+		fakeScaler{}, h.endpoints, &http.Client{Timeout: 30 * time.Second},
+	)
+	require.NoError(h.t, err)
+	responses, err := pubsub.OpenSubscription(ctx, responsesURL)
+	require.NoError(h.t, err)
+
+	go func() {
+		if err := msgr.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			h.t.Errorf("messenger stopped: %v", err)
+		}
+	}()
+	go func() {
+		for {
+			msg, err := responses.Receive(ctx)
+			if err != nil {
+				return
+			}
+			msg.Ack()
+			var resp struct {
+				Metadata struct {
+					ID string `json:"id"`
+				} `json:"metadata"`
+			}
+			if err := json.Unmarshal(msg.Body, &resp); err != nil {
+				h.t.Errorf("unmarshalling response message: %v", err)
+				continue
+			}
+			h.mtx.Lock()
+			h.responses[resp.Metadata.ID] = append(h.responses[resp.Metadata.ID], string(msg.Body))
+			h.mtx.Unlock()
+		}
+	}()
+}
+
+// publish sends a completion request message for the given ID.
+func (h *harness) publish(id string) {
+	h.broker.publish([]byte(fmt.Sprintf(`{
+	"path": "/v1/completions",
+	"metadata": {"id": %q},
+	"body": {"model": %q, "prompt": %q}
+}`, id, testModel, id)))
+}
+
+// requireNoDoubleInference asserts that every request was completed by
+// a backend exactly once.
+func (h *harness) requireNoDoubleInference(ids []string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	for _, id := range ids {
+		require.Equal(h.t, 1, h.completions[id], "request %q should be completed exactly once", id)
+	}
+}
+
+// requireNoInflight asserts that in-flight counters have returned to zero.
+func (h *harness) requireNoInflight() {
+	require.Eventually(h.t, func() bool {
+		return h.endpoints.inflight() == 0
+	}, 5*time.Second, 10*time.Millisecond, "endpoint in-flight requests should return to zero")
+
+	mets := metricstest.Collect(h.t)
+	for _, sm := range mets.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != metrics.InferenceRequestsActiveMetricName {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				require.Zero(h.t, dp.Value, "active requests should return to zero: %v", dp.Attributes.Encoded(nil))
+			}
+		}
+	}
+}
+
+func completionText(body []byte) (string, error) {
+	var completion struct {
+		Choices []struct {
+			Text string `json:"text"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return "", fmt.Errorf("unmarshalling completion: %w", err)
+	}
+	if len(completion.Choices) != 1 {
+		return "", fmt.Errorf("unexpected completion: %s", body)
+	}
+	return completion.Choices[0].Text, nil
+}
+
+// Backends //
+
+// backend is a fake model server that echoes the prompt of completion
+// requests. It can be killed and restarted on a new address.
+type backend struct {
+	latency    time.Duration
+	onComplete func(id string)
+
+	// mtx is held for writing while killing the backend so that responses
+	// are either fully sent and counted as completed or not sent at all.
+	mtx    sync.RWMutex
+	up     bool
+	addr   string
+	server *http.Server
+}
+
+func (b *backend) start(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.up = true
+	b.addr = ln.Addr().String()
+	b.server = &http.Server{Handler: b}
+	go b.server.Serve(ln)
+}
+
+func (b *backend) kill() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if !b.up {
+		return
+	}
+	b.up = false
+	b.server.Close()
+}
+
+func (b *backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Read the whole body so that killing the backend does not reset
+	// connections with unread data.
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	var req struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case <-time.After(b.latency):
+	case <-r.Context().Done():
+		return
+	}
+
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	if !b.up {
+		panic(http.ErrAbortHandler)
+	}
+	resp := []byte(fmt.Sprintf(`{"choices": [{"text": %q}]}`, req.Prompt))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(resp)))
+	w.Write(resp)
+	w.(http.Flusher).Flush()
+	b.onComplete(req.Prompt)
+}
+
+// Endpoints //
+
+// fakeEndpoints resolves the addresses of the backends that are up,
+// choosing the address with the fewest in-flight requests.
+type fakeEndpoints struct {
+	mtx            sync.Mutex
+	inflightByAddr map[string]int
+	totalInflight  int
+	// changed is closed when addresses are added.
+	changed chan struct{}
+}
+
+func newFakeEndpoints() *fakeEndpoints {
+	return &fakeEndpoints{
+		inflightByAddr: map[string]int{},
+		changed:        make(chan struct{}),
+	}
+}
+
+func (e *fakeEndpoints) set(addr string, up bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if !up {
+		delete(e.inflightByAddr, addr)
+		return
+	}
+	e.inflightByAddr[addr] = 0
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+func (e *fakeEndpoints) inflight() int {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.totalInflight
+}
+
+func (e *fakeEndpoints) AwaitBestAddress(ctx context.Context, model, adapter string) (string, func(), error) {
+	for {
+		e.mtx.Lock()
+		best, bestInflight := "", 0
+		for addr, n := range e.inflightByAddr {
+			if best == "" || n < bestInflight {
+				best, bestInflight = addr, n
+			}
+		}
+		if best != "" {
+			e.inflightByAddr[best]++
+			e.totalInflight++
+			e.mtx.Unlock()
+
+			var once sync.Once
+			return best, func() {
+				once.Do(func() {
+					e.mtx.Lock()
+					defer e.mtx.Unlock()
+					if _, ok := e.inflightByAddr[best]; ok {
+						e.inflightByAddr[best]--
+					}
+					e.totalInflight--
+				})
+			}, nil
+		}
+		changed := e.changed
+		e.mtx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+type fakeScaler struct{}
+
+func (fakeScaler) LookupModel(ctx context.Context, model, adapter string, selectors []string) (string, bool, error) {
+	return model, model == testModel && adapter == "", nil
+}
+
+func (fakeScaler) LookupPassthroughPaths(ctx context.Context, model string) ([]string, error) {
+	return nil, nil
+}
+
+func (fakeScaler) LookupChatMessageNormalization(ctx context.Context, model string) (*kubeaiv1.ChatMessageNormalization, error) {
+	return nil, nil
+}
+
+func (fakeScaler) LookupCapabilities(ctx context.Context, model string) (*kubeaiv1.ModelStatusCapabilities, error) {
+	return nil, nil
+}
+
+func (fakeScaler) LookupDeprecation(ctx context.Context, model string) (*kubeaiv1.ModelDeprecation, error) {
+	return nil, nil
+}
+
+func (fakeScaler) LookupSafetyPolicy(ctx context.Context, model string) (*kubeaiv1.ModelSafetyPolicy, error) {
+	return nil, nil
+}
+
+func (fakeScaler) LookupActive(ctx context.Context, model string) (bool, time.Time, error) {
+	return true, time.Time{}, nil
+}
+
+func (fakeScaler) LookupEngine(ctx context.Context, model string) (string, []string, error) {
+	return kubeaiv1.VLLMEngine, nil, nil
+}
+
+func (fakeScaler) LookupMaxQueueWait(ctx context.Context, model string) (time.Duration, bool, error) {
+	return 0, false, nil
+}
+
+func (fakeScaler) ScaleAtLeastOneReplica(ctx context.Context, model string) error {
+	return nil
+}
+
+// Broker //
+
+// brokers are the brokers that can be opened via "chaos://<name>" URLs.
+var brokers sync.Map
+
+func init() {
+	pubsub.DefaultURLMux().RegisterSubscription("chaos", brokerURLOpener{})
+}
+
+type brokerURLOpener struct{}
+
+func (brokerURLOpener) OpenSubscriptionURL(ctx context.Context, u *url.URL) (*pubsub.Subscription, error) {
+	b, ok := brokers.Load(u.Host)
+	if !ok {
+		return nil, fmt.Errorf("broker not found: %s", u.Host)
+	}
+	return pubsub.NewSubscription(&brokerSubscription{b: b.(*broker)}, nil, nil), nil
+}
+
+var errBrokerDown = errors.New("broker is down")
+
+// broker is an in-memory queue with at-least-once delivery: messages that
+// are not acknowledged within the ack deadline are redelivered. While the
+// broker is down, receiving fails and acknowledgements are lost.
+type broker struct {
+	ackDeadline time.Duration
+
+	mtx      sync.Mutex
+	down     bool
+	nextID   int
+	messages map[string]*brokerMessage
+}
+
+type brokerMessage struct {
+	body      []byte
+	visibleAt time.Time
+}
+
+func newBroker(name string, ackDeadline time.Duration) *broker {
+	b := &broker{
+		ackDeadline: ackDeadline,
+		messages:    map[string]*brokerMessage{},
+	}
+	brokers.Store(name, b)
+	return b
+}
+
+func (b *broker) publish(body []byte) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.nextID++
+	b.messages[fmt.Sprintf("msg-%d", b.nextID)] = &brokerMessage{body: body}
+}
+
+func (b *broker) setDown(down bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.down = down
+}
+
+// pending returns the number of messages that have not been acknowledged.
+func (b *broker) pending() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return len(b.messages)
+}
+
+func (b *broker) receive(now time.Time, max int) ([]*driver.Message, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.down {
+		return nil, errBrokerDown
+	}
+	var msgs []*driver.Message
+	for id, m := range b.messages {
+		if len(msgs) == max {
+			break
+		}
+		if now.Before(m.visibleAt) {
+			continue
+		}
+		m.visibleAt = now.Add(b.ackDeadline)
+		msgs = append(msgs, &driver.Message{
+			LoggableID: id,
+			Body:       m.body,
+			AckID:      id,
+			AsFunc:     func(any) bool { return false },
+		})
+	}
+	return msgs, nil
+}
+
+func (b *broker) settle(ids []driver.AckID, ack bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.down {
+		return
+	}
+	for _, id := range ids {
+		if ack {
+			delete(b.messages, id.(string))
+		} else if m, ok := b.messages[id.(string)]; ok {
+			m.visibleAt = time.Time{}
+		}
+	}
+}
+
+type brokerSubscription struct {
+	b *broker
+}
+
+func (s *brokerSubscription) ReceiveBatch(ctx context.Context, maxMessages int) ([]*driver.Message, error) {
+	msgs, err := s.b.receive(time.Now(), maxMessages)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		// Avoid spinning when there are no messages.
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return msgs, nil
+}
+
+func (s *brokerSubscription) SendAcks(ctx context.Context, ackIDs []driver.AckID) error {
+	s.b.settle(ackIDs, true)
+	return nil
+}
+
+func (s *brokerSubscription) CanNack() bool { return true }
+
+func (s *brokerSubscription) SendNacks(ctx context.Context, ackIDs []driver.AckID) error {
+	s.b.settle(ackIDs, false)
+	return nil
+}
+
+func (s *brokerSubscription) IsRetryable(error) bool { return false }
+
+func (s *brokerSubscription) As(i interface{}) bool { return false }
+
+func (s *brokerSubscription) ErrorAs(error, interface{}) bool { return false }
+
+func (s *brokerSubscription) ErrorCode(err error) gcerrors.ErrorCode {
+	if errors.Is(err, errBrokerDown) {
+		return gcerrors.Internal
+	}
+	return gcerrors.Unknown
+}
+
+func (s *brokerSubscription) Close() error { return nil }
@@ -0,0 +1,37 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+// TestModelBurstScaling tests that a burst of requests for a Model that is
+// scaled to zero scales the Model to enough replicas to serve the whole burst.
+func TestModelBurstScaling(t *testing.T) {
+	initTest(t, baseSysCfg(t))
+
+	m := modelForTest(t)
+	m.Spec.TargetRequests = ptr.To[int32](2)
+	m.Spec.MaxReplicas = ptr.To[int32](10)
+	require.NoError(t, testK8sClient.Create(testCtx, m))
+
+	testModelBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(testModelBackend.Close)
+	updateModelWithBackend(t, m, testModelBackend)
+
+	var wg sync.WaitGroup
+	sendRequests(t, &wg, m.Name, nil, 6, http.StatusOK, "", "burst of requests")
+
+	requireModelReplicas(t, m, 3, "Model should be scaled up to serve the whole burst", 5*time.Second)
+
+	markAllModelPodsReady(t, m)
+	wg.Wait()
+}
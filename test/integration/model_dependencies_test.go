@@ -0,0 +1,45 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+// TestModelDependencies tests that a Model's dependencies are scaled from zero
+// when the Model itself is scaled from zero.
+func TestModelDependencies(t *testing.T) {
+	initTest(t, baseSysCfg(t))
+
+	dep := modelForTest(t)
+	dep.Name = dep.Name + "-dep"
+	dep.Spec.MaxReplicas = ptr.To[int32](1)
+	require.NoError(t, testK8sClient.Create(testCtx, dep))
+
+	m := modelForTest(t)
+	m.Spec.MaxReplicas = ptr.To[int32](1)
+	m.Spec.Dependencies = []string{dep.Name}
+	require.NoError(t, testK8sClient.Create(testCtx, m))
+
+	testModelBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(testModelBackend.Close)
+	updateModelWithBackend(t, m, testModelBackend)
+
+	requireModelReplicas(t, dep, 0, "Dependency should start at zero replicas", 2*time.Second)
+
+	var wg sync.WaitGroup
+	sendRequests(t, &wg, m.Name, nil, 1, http.StatusOK, "", "request to parent model")
+
+	requireModelReplicas(t, m, 1, "Model should be scaled up from zero", 5*time.Second)
+	requireModelReplicas(t, dep, 1, "Dependency should be scaled up along with the Model", 5*time.Second)
+
+	markAllModelPodsReady(t, m)
+	wg.Wait()
+}
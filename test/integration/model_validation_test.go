@@ -262,6 +262,39 @@ func TestModelValidation(t *testing.T) {
 				"s3://",
 			},
 		},
+		{
+			model: v1.Model{
+				ObjectMeta: metadata("echo-engine-valid"),
+				Spec: v1.ModelSpec{
+					URL:      "echo://test-model",
+					Engine:   "Echo",
+					Features: []v1.ModelFeature{},
+				},
+			},
+			expValid: true,
+		},
+		{
+			model: v1.Model{
+				ObjectMeta: metadata("echo-engine-with-hf-url-invalid"),
+				Spec: v1.ModelSpec{
+					URL:      "hf://test-repo/test-model",
+					Engine:   "Echo",
+					Features: []v1.ModelFeature{},
+				},
+			},
+			expErrContain: "only supported with the Echo engine",
+		},
+		{
+			model: v1.Model{
+				ObjectMeta: metadata("echo-url-with-vllm-engine-invalid"),
+				Spec: v1.ModelSpec{
+					URL:      "echo://test-model",
+					Engine:   "VLLM",
+					Features: []v1.ModelFeature{},
+				},
+			},
+			expErrContain: "only supported with the Echo engine",
+		},
 		{
 			model: v1.Model{
 				ObjectMeta: metadata("update-no-changes-valid"),